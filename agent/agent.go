@@ -26,6 +26,9 @@ func NewAgent(config *config.Config) (*Agent, error) {
 		Config: config,
 	}
 
+	models.SetUsageSampling(a.Config.Agent.PluginUsageSampling)
+	models.SetPanicRestartDelay(a.Config.Agent.PanicRestartDelay.Duration)
+
 	if !a.Config.Agent.OmitHostname {
 		if a.Config.Agent.Hostname == "" {
 			hostname, err := os.Hostname()
@@ -45,6 +48,11 @@ func NewAgent(config *config.Config) (*Agent, error) {
 // Connect connects to all configured outputs
 func (a *Agent) Connect() error {
 	for _, o := range a.Config.Outputs {
+		if err := o.OpenBuffer(); err != nil {
+			return fmt.Errorf("Output %s: unable to open buffer spill file: %s",
+				o.Name, err)
+		}
+
 		switch ot := o.Output.(type) {
 		case telegraf.ServiceOutput:
 			if err := ot.Start(); err != nil {
@@ -79,6 +87,10 @@ func (a *Agent) Close() error {
 		case telegraf.ServiceOutput:
 			ot.Stop()
 		}
+		if berr := o.Close(); berr != nil {
+			log.Printf("E! Unable to close the buffer of output %s: %s",
+				o.Name, berr)
+		}
 	}
 	return err
 }
@@ -101,6 +113,8 @@ func (a *Agent) gatherer(
 	shutdown chan struct{},
 	input *models.RunningInput,
 	interval time.Duration,
+	offset time.Duration,
+	clock *clockWatcher,
 	metricC chan telegraf.Metric,
 ) {
 	defer panicRecover(input)
@@ -114,11 +128,20 @@ func (a *Agent) gatherer(
 	acc.SetPrecision(a.Config.Agent.Precision.Duration,
 		a.Config.Agent.Interval.Duration)
 
+	jitter := a.Config.Agent.CollectionJitter.Duration
+	if input.Config.CollectionJitter != 0 {
+		jitter = input.Config.CollectionJitter
+	}
+
+	internal.Sleep(offset, shutdown)
 	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	defer func() {
+		ticker.Stop()
+	}()
 
 	for {
-		internal.RandomSleep(a.Config.Agent.CollectionJitter.Duration, shutdown)
+		jumped := clock.Jumped()
+		internal.RandomSleep(jitter, shutdown)
 
 		start := time.Now()
 		gatherWithTimeout(shutdown, input, acc, interval)
@@ -131,6 +154,14 @@ func (a *Agent) gatherer(
 			return
 		case <-ticker.C:
 			continue
+		case <-jumped:
+			// the clock stepped, the input is collected right away and its
+			// interval is aligned again on the clock
+			ticker.Stop()
+			if a.Config.Agent.RoundInterval {
+				internal.Sleep(alignDelay(time.Now(), interval, offset), shutdown)
+			}
+			ticker = time.NewTicker(interval)
 		}
 	}
 }
@@ -150,7 +181,7 @@ func gatherWithTimeout(
 	defer ticker.Stop()
 	done := make(chan error)
 	go func() {
-		done <- input.Input.Gather(acc)
+		done <- input.Gather(acc)
 	}()
 
 	for {
@@ -369,18 +400,25 @@ func (a *Agent) Run(shutdown chan struct{}) error {
 	// Start all ServicePlugins
 	for _, input := range a.Config.Inputs {
 		input.SetDefaultTags(a.Config.Tags)
-		switch p := input.Input.(type) {
+		switch input.Input.(type) {
 		case telegraf.ServiceInput:
 			acc := NewAccumulator(input, metricC)
 			// Service input plugins should set their own precision of their
 			// metrics.
 			acc.SetPrecision(time.Nanosecond, 0)
-			if err := p.Start(acc); err != nil {
+			err := input.Start(acc)
+			if _, ok := err.(*models.PanicError); ok {
+				// the input is disabled, the others keep running, and it is
+				// stopped on shutdown as it may have started partially
+				defer input.Stop()
+				continue
+			}
+			if err != nil {
 				log.Printf("E! Service for input %s failed to start, exiting\n%s\n",
 					input.Name(), err.Error())
 				return err
 			}
-			defer p.Stop()
+			defer input.Stop()
 		}
 	}
 
@@ -390,6 +428,16 @@ func (a *Agent) Run(shutdown chan struct{}) error {
 		time.Sleep(time.Duration(i - (time.Now().UnixNano() % i)))
 	}
 
+	var clock *clockWatcher
+	if threshold := a.Config.Agent.ClockJumpThreshold.Duration; threshold > 0 {
+		clock = newClockWatcher(threshold)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.watchClock(shutdown, clock, metricC)
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -411,16 +459,24 @@ func (a *Agent) Run(shutdown chan struct{}) error {
 	}
 
 	wg.Add(len(a.Config.Inputs))
+	// instances counts the inputs of each name, to stagger them apart
+	instances := make(map[string]int)
 	for _, input := range a.Config.Inputs {
 		interval := a.Config.Agent.Interval.Duration
 		// overwrite global interval if this plugin has it's own.
 		if input.Config.Interval != 0 {
 			interval = input.Config.Interval
 		}
-		go func(in *models.RunningInput, interv time.Duration) {
+		var offset time.Duration
+		if a.Config.Agent.CollectionStagger {
+			key := fmt.Sprintf("%s#%d", input.Config.Name, instances[input.Config.Name])
+			offset = internal.StaggerOffset(key, interval)
+			instances[input.Config.Name]++
+		}
+		go func(in *models.RunningInput, interv, offset time.Duration) {
 			defer wg.Done()
-			a.gatherer(shutdown, in, interv, metricC)
-		}(input, interval)
+			a.gatherer(shutdown, in, interv, offset, clock, metricC)
+		}(input, interval, offset)
 	}
 
 	wg.Wait()
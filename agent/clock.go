@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// clockWatcher detects the steps of the system clock, such as NTP
+// corrections or the resume of a suspended VM, by comparing the time elapsed
+// on the wall clock to the time elapsed on the monotonic clock.
+type clockWatcher struct {
+	threshold time.Duration
+	// wall reads the wall clock, replaced by the tests
+	wall func() time.Time
+
+	lastWall time.Time
+	lastMono time.Time
+
+	mu     sync.Mutex
+	jumped chan struct{}
+}
+
+func newClockWatcher(threshold time.Duration) *clockWatcher {
+	c := &clockWatcher{
+		threshold: threshold,
+		wall: func() time.Time {
+			return time.Now().Round(0)
+		},
+		jumped: make(chan struct{}),
+	}
+	c.lastMono = time.Now()
+	c.lastWall = c.wall()
+	return c
+}
+
+// Jumped returns a channel closed on the next step of the clock. A nil
+// watcher never reports a step.
+func (c *clockWatcher) Jumped() <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.jumped
+}
+
+// check reads the clocks and returns the step of the wall clock since the
+// previous check and the new reading of the wall clock. ok is false when
+// the step is within the threshold.
+func (c *clockWatcher) check() (offset time.Duration, now time.Time, ok bool) {
+	mono := time.Now()
+	now = c.wall()
+	offset = now.Sub(c.lastWall) - mono.Sub(c.lastMono)
+	c.lastWall, c.lastMono = now, mono
+	if offset < c.threshold && offset > -c.threshold {
+		return 0, now, false
+	}
+	c.mu.Lock()
+	close(c.jumped)
+	c.jumped = make(chan struct{})
+	c.mu.Unlock()
+	return offset, now, true
+}
+
+// watchClock checks the clock every second until shutdown.
+func (a *Agent) watchClock(
+	shutdown chan struct{},
+	clock *clockWatcher,
+	metricC chan telegraf.Metric,
+) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdown:
+			return
+		case <-ticker.C:
+			if offset, now, ok := clock.check(); ok {
+				a.clockJumped(shutdown, offset, now, metricC)
+			}
+		}
+	}
+}
+
+// clockJumped handles a step of offset of the clock detected at now: the
+// gatherers align their interval again on their own, the aggregation
+// periods restart and the buffered metrics are optionally retimestamped.
+func (a *Agent) clockJumped(
+	shutdown chan struct{},
+	offset time.Duration,
+	now time.Time,
+	metricC chan telegraf.Metric,
+) {
+	log.Printf("W! The system clock stepped by %s, aligning the collection "+
+		"again", offset)
+
+	for _, agg := range a.Config.Aggregators {
+		agg.Realign(now)
+	}
+
+	retimed := 0
+	if a.Config.Agent.ClockJumpRetimestamp && offset < 0 {
+		retimed = a.retime(offset, now)
+	}
+
+	tags := make(map[string]string, len(a.Config.Tags))
+	for k, v := range a.Config.Tags {
+		tags[k] = v
+	}
+	m, err := metric.New("clock_jump", tags, map[string]interface{}{
+		"offset_ns": offset.Nanoseconds(),
+		"retimed":   int64(retimed),
+	}, now)
+	if err != nil {
+		log.Printf("E! Unable to create the clock_jump metric: %s", err)
+		return
+	}
+	select {
+	case metricC <- m:
+	case <-shutdown:
+	}
+}
+
+// retime moves by offset the timestamps of the metrics buffered by the
+// outputs after a backward step of the clock detected at now, the metrics
+// timestamped after now. Forward steps are not retimed: after the resume of
+// a suspended VM the clock was right before the step and so are the
+// timestamps.
+func (a *Agent) retime(offset time.Duration, now time.Time) int {
+	match := func(m telegraf.Metric) bool {
+		return m.Time().After(now)
+	}
+	retimed := 0
+	for _, o := range a.Config.Outputs {
+		retimed += o.RetimeBuffer(offset, match)
+	}
+	return retimed
+}
+
+// alignDelay returns the time from now to the next multiple of interval,
+// plus offset.
+func alignDelay(now time.Time, interval, offset time.Duration) time.Duration {
+	d := interval - time.Duration(now.UnixNano()%int64(interval)) + offset
+	return d % interval
+}
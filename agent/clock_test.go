@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockWatcher(t *testing.T) {
+	c := newClockWatcher(time.Minute)
+	var skew time.Duration
+	c.wall = func() time.Time {
+		return time.Now().Round(0).Add(skew)
+	}
+	c.lastWall = c.wall()
+
+	jumped := c.Jumped()
+	_, _, ok := c.check()
+	assert.False(t, ok)
+
+	skew = -time.Hour
+	offset, now, ok := c.check()
+	assert.True(t, ok)
+	assert.InDelta(t, float64(-time.Hour), float64(offset), float64(time.Second))
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), now, time.Second)
+	select {
+	case <-jumped:
+	default:
+		t.Error("the step of the clock was not reported")
+	}
+
+	// the next step is reported on a new channel
+	jumped = c.Jumped()
+	_, _, ok = c.check()
+	assert.False(t, ok)
+	select {
+	case <-jumped:
+		t.Error("no step of the clock expected")
+	default:
+	}
+
+	var nilClock *clockWatcher
+	assert.Nil(t, nilClock.Jumped())
+}
+
+func TestAlignDelay(t *testing.T) {
+	now := time.Unix(100, int64(300*time.Millisecond))
+	assert.Equal(t, 700*time.Millisecond, alignDelay(now, time.Second, 0))
+	assert.Equal(t, 1700*time.Millisecond, alignDelay(now, 10*time.Second, 2*time.Second))
+	assert.Equal(t, time.Duration(0), alignDelay(time.Unix(100, 0), time.Second, 0))
+}
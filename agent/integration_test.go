@@ -0,0 +1,295 @@
+// +build integration
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/influxdata/telegraf/internal/config"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/influxdata/telegraf/plugins/inputs/statsd"
+	_ "github.com/influxdata/telegraf/plugins/outputs/druid"
+	_ "github.com/influxdata/telegraf/plugins/outputs/influxdb"
+	_ "github.com/influxdata/telegraf/plugins/outputs/kafka"
+)
+
+// The integration tests run a complete telegraf pipeline (statsd input ->
+// processors -> outputs) against real sinks started in docker containers.
+// No Druid is started: the druid output posts to testutil.DruidStub, an
+// in-process stub of the Tranquility endpoint, and the events of the Kafka
+// topic consumed by Druid are checked against the parse step of an
+// ingestion spec. Run them with `make test-integration`.
+
+const integrationConfig = `
+[agent]
+  interval = "1s"
+  flush_interval = "1s"
+  round_interval = false
+  omit_hostname = true
+
+[[inputs.statsd]]
+  service_address = "%[1]s"
+  percentiles = [90]
+
+[[outputs.influxdb]]
+  urls = ["http://%[2]s:8086"]
+  database = "telegraf"
+
+[[outputs.kafka]]
+  brokers = ["%[2]s:9092"]
+  topic = "telegraf"
+  data_format = "influx"
+
+## Druid consumes JSON events from its own topic through the Kafka
+## indexing service, the test parses them in-process like its indexer.
+[[outputs.kafka]]
+  brokers = ["%[2]s:9092"]
+  topic = "druid"
+  data_format = "json"
+  json_timestamp_units = "1ms"
+
+[[outputs.druid]]
+  url = "%[3]s/v1/post/{datasource}"
+  datasource = "telegraf"
+  event_id_column = "event_id"
+  content_encoding = "gzip"
+`
+
+var integrationContainers = []*testutil.Container{
+	{
+		Name:  "telegraf_it_zookeeper",
+		Image: "wurstmeister/zookeeper",
+		Ports: []string{"2181:2181"},
+	},
+	{
+		Name:  "telegraf_it_kafka",
+		Image: "wurstmeister/kafka",
+		Ports: []string{"9092:9092"},
+		Links: []string{"telegraf_it_zookeeper:zookeeper"},
+		Env: map[string]string{
+			"KAFKA_ADVERTISED_HOST_NAME": testutil.GetLocalHost(),
+			"KAFKA_ADVERTISED_PORT":      "9092",
+			"KAFKA_ZOOKEEPER_CONNECT":    "zookeeper:2181",
+			"KAFKA_CREATE_TOPICS":        "telegraf:1:1,druid:1:1",
+		},
+		WaitFor: testutil.GetLocalHost() + ":9092",
+	},
+	{
+		Name:    "telegraf_it_influxdb",
+		Image:   "influxdb:1.3",
+		Ports:   []string{"8086:8086"},
+		WaitFor: testutil.GetLocalHost() + ":8086",
+	},
+}
+
+func TestMain(m *testing.M) {
+	if !testutil.DockerAvailable() {
+		log.Println("docker is not available, skipping integration tests")
+		os.Exit(0)
+	}
+
+	for _, c := range integrationContainers {
+		if err := c.Start(); err != nil {
+			log.Println(err)
+			terminateContainers()
+			os.Exit(1)
+		}
+	}
+	// kafka accepts connections before the topics are created
+	time.Sleep(10 * time.Second)
+
+	res := m.Run()
+	terminateContainers()
+	os.Exit(res)
+}
+
+func terminateContainers() {
+	for _, c := range integrationContainers {
+		if err := c.Terminate(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func TestIntegration_StatsdPipeline(t *testing.T) {
+	host := testutil.GetLocalHost()
+	statsdAddr := "127.0.0.1:18125"
+	druid := testutil.NewDruidStub()
+	defer druid.Close()
+
+	f, err := ioutil.TempFile("", "telegraf-integration")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = fmt.Fprintf(f, integrationConfig, statsdAddr, host, druid.URL)
+	require.NoError(t, err)
+	f.Close()
+
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfig(f.Name()))
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	require.NoError(t, a.Connect())
+
+	shutdown := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.Run(shutdown)
+	}()
+
+	// give the statsd listener time to bind
+	time.Sleep(time.Second)
+	conn, err := net.Dial("udp", statsdAddr)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		fmt.Fprint(conn, "integration.requests:1|c\n")
+		fmt.Fprint(conn, "integration.latency:42|ms\n")
+		time.Sleep(time.Second)
+	}
+	conn.Close()
+	time.Sleep(2 * time.Second)
+	close(shutdown)
+	<-done
+
+	t.Run("influxdb", func(t *testing.T) {
+		count := influxCount(t, host, `SELECT count("value") FROM "integration_requests"`)
+		require.True(t, count > 0, "no points written to influxdb")
+	})
+
+	t.Run("kafka", func(t *testing.T) {
+		msgs := consumeTopic(t, host, "telegraf")
+		require.NotEmpty(t, msgs)
+		var found bool
+		for _, msg := range msgs {
+			if strings.HasPrefix(string(msg), "integration_latency,") {
+				found = true
+			}
+		}
+		require.True(t, found, "no integration_latency metric in kafka topic")
+	})
+
+	t.Run("druid", func(t *testing.T) {
+		rows := druid.Rows("telegraf")
+		require.NotEmpty(t, rows)
+		var found bool
+		for _, row := range rows {
+			ts, ok := row["timestamp"].(float64)
+			require.True(t, ok, "no timestamp in row %v", row)
+			require.True(t, int64(ts) > time.Now().Add(-time.Hour).UnixNano()/int64(time.Millisecond),
+				"timestamp %v is not in milliseconds", row["timestamp"])
+			require.NotEmpty(t, row["event_id"])
+			if row["name"] == "integration_requests" {
+				found = true
+				require.Contains(t, row, "integration_requests_value")
+				require.Equal(t, "counter", row["metric_type"])
+			}
+		}
+		require.True(t, found, "no integration_requests row posted to druid")
+	})
+
+	t.Run("druid_events", func(t *testing.T) {
+		msgs := consumeTopic(t, host, "druid")
+		require.NotEmpty(t, msgs)
+		for _, msg := range msgs {
+			row, err := parseDruidEvent(msg)
+			require.NoError(t, err, string(msg))
+			require.Contains(t, row, "metric_type")
+		}
+	})
+}
+
+// influxCount runs a single count query and returns the first value.
+func influxCount(t *testing.T, host, query string) int64 {
+	u := fmt.Sprintf("http://%s:8086/query?db=telegraf&q=%s",
+		host, url.QueryEscape(query))
+	resp, err := http.Get(u)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var body struct {
+		Results []struct {
+			Series []struct {
+				Values [][]interface{} `json:"values"`
+			} `json:"series"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	if len(body.Results) == 0 || len(body.Results[0].Series) == 0 {
+		return 0
+	}
+	values := body.Results[0].Series[0].Values
+	if len(values) == 0 || len(values[0]) < 2 {
+		return 0
+	}
+	n, _ := values[0][1].(float64)
+	return int64(n)
+}
+
+// consumeTopic returns every message currently stored in the first partition
+// of topic.
+func consumeTopic(t *testing.T, host, topic string) [][]byte {
+	consumer, err := sarama.NewConsumer([]string{host + ":9092"}, nil)
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	pc, err := consumer.ConsumePartition(topic, 0, sarama.OffsetOldest)
+	require.NoError(t, err)
+	defer pc.Close()
+
+	var msgs [][]byte
+	for {
+		select {
+		case msg := <-pc.Messages():
+			msgs = append(msgs, msg.Value)
+		case <-time.After(5 * time.Second):
+			return msgs
+		}
+	}
+}
+
+// parseDruidEvent checks an event in-process, no Druid is involved: it
+// mimics the parse step of a Druid ingestion spec using a flattenSpec over
+// the telegraf JSON format, tags become dimensions, fields become metrics
+// and every row must carry a millisecond timestamp.
+func parseDruidEvent(msg []byte) (map[string]interface{}, error) {
+	var event struct {
+		Name      string                 `json:"name"`
+		Tags      map[string]string      `json:"tags"`
+		Fields    map[string]interface{} `json:"fields"`
+		Timestamp int64                  `json:"timestamp"`
+	}
+	if err := json.Unmarshal(msg, &event); err != nil {
+		return nil, err
+	}
+	if event.Timestamp < time.Now().Add(-time.Hour).UnixNano()/int64(time.Millisecond) {
+		return nil, fmt.Errorf("timestamp %d is not in milliseconds", event.Timestamp)
+	}
+
+	row := map[string]interface{}{
+		"timestamp": event.Timestamp,
+		"name":      event.Name,
+	}
+	for k, v := range event.Tags {
+		row[k] = v
+	}
+	for k, v := range event.Fields {
+		if _, ok := v.(float64); !ok {
+			return nil, fmt.Errorf("metric %s is not numeric: %v", k, v)
+		}
+		row[event.Name+"_"+k] = v
+	}
+	return row, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/influxdata/telegraf/internal/config"
+)
+
+// loadConfig loads the configuration file and the configuration directory
+// given on the command line.
+func loadConfig(inputFilters, outputFilters []string) (*config.Config, error) {
+	c := config.NewConfig()
+	c.OutputFilters = outputFilters
+	c.InputFilters = inputFilters
+	if err := c.LoadConfig(*fConfig); err != nil {
+		return nil, err
+	}
+	if *fConfigDirectory != "" {
+		if err := c.LoadDirectory(*fConfigDirectory); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// checkConfig returns the errors of a loaded configuration which prevent
+// telegraf from running, outputs are not required in test mode.
+func checkConfig(c *config.Config, test bool) error {
+	if !test && len(c.Outputs) == 0 {
+		return fmt.Errorf("Error: no outputs found, did you provide a valid config file?")
+	}
+	if len(c.Inputs) == 0 {
+		return fmt.Errorf("Error: no inputs found, did you provide a valid config file?")
+	}
+	if int64(c.Agent.Interval.Duration) <= 0 {
+		return fmt.Errorf("Agent interval must be positive, found %s",
+			c.Agent.Interval.Duration)
+	}
+	if int64(c.Agent.FlushInterval.Duration) <= 0 {
+		return fmt.Errorf("Agent flush_interval must be positive; found %s",
+			c.Agent.FlushInterval.Duration)
+	}
+	return nil
+}
+
+// configCommand runs the config subcommands on the configuration given on
+// the command line: validate loads it and reports its first error, print
+// prints the loaded files with their environment variables replaced and
+// their secrets redacted, and print --resolved the effective configuration.
+func configCommand(args []string, inputFilters, outputFilters []string) {
+	if len(args) == 0 {
+		log.Fatal("E! usage: telegraf config validate|print [--resolved]")
+	}
+	c, err := loadConfig(inputFilters, outputFilters)
+	if err == nil && args[0] == "validate" {
+		err = checkConfig(c, false)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case args[0] == "validate" && len(args) == 1:
+		fmt.Printf("Configuration is valid: %d inputs, %d outputs, "+
+			"%d processors, %d aggregators\n", len(c.Inputs), len(c.Outputs),
+			len(c.Processors), len(c.Aggregators))
+	case args[0] == "print" && len(args) == 1:
+		for _, path := range c.Files {
+			contents, err := config.RedactedFile(path)
+			if err != nil {
+				log.Fatal("E! " + err.Error())
+			}
+			fmt.Printf("# %s\n%s\n", path, contents)
+		}
+	case args[0] == "print" && len(args) == 2 &&
+		(args[1] == "--resolved" || args[1] == "-resolved"):
+		fmt.Print(c.EffectiveConfig())
+	default:
+		log.Fatal("E! usage: telegraf config validate|print [--resolved]")
+	}
+}
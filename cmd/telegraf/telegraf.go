@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	_ "net/http/pprof" // Comment this line to disable pprof endpoint.
@@ -14,6 +15,7 @@ import (
 
 	"github.com/influxdata/telegraf/agent"
 	"github.com/influxdata/telegraf/internal/config"
+	"github.com/influxdata/telegraf/internal/migrate"
 	"github.com/influxdata/telegraf/logger"
 	_ "github.com/influxdata/telegraf/plugins/aggregators/all"
 	"github.com/influxdata/telegraf/plugins/inputs"
@@ -31,6 +33,8 @@ var pprofAddr = flag.String("pprof-addr", "",
 var fQuiet = flag.Bool("quiet", false,
 	"run in quiet mode")
 var fTest = flag.Bool("test", false, "gather metrics, print them out, and exit")
+var fPrintEffectiveConfig = flag.Bool("print-effective-config", false,
+	"print the loaded configuration with the default values, and exit")
 var fConfig = flag.String("config", "", "configuration file to load")
 var fConfigDirectory = flag.String("config-directory", "",
 	"directory containing additional *.conf files")
@@ -84,10 +88,21 @@ Usage:
 The commands & flags are:
 
   config              print out full sample configuration to stdout
+  config validate     load the configuration, report its first error with
+                      its file and line and exit with status 1 if invalid
+  config print [--resolved]
+                      print the configuration files with their environment
+                      variables replaced or, with --resolved, the effective
+                      configuration
   version             print the version to stdout
+  migrate statsd <file>
+                      convert an etsy/statsd config file to telegraf plugins
 
   --config <file>     configuration file to load
   --test              gather metrics once, print them to stdout, and exit
+  --print-effective-config
+                      print the loaded configuration, with the default values
+                      and the deprecated options, to stdout and exit
   --config-directory  directory containing additional *.conf files
   --input-filter      filter the input plugins to enable, separator is :
   --output-filter     filter the output plugins to enable, separator is :
@@ -101,9 +116,18 @@ Examples:
   # generate a telegraf config file:
   telegraf config > telegraf.conf
 
+  # convert a statsd config to the statsd input and outputs of its backends
+  telegraf migrate statsd /etc/statsd/config.js > statsd.conf
+
   # generate config with only cpu input & influxdb output plugins defined
   telegraf --input-filter cpu --output-filter influxdb config
 
+  # check a configuration before deploying it
+  telegraf --config telegraf.conf --config-directory telegraf.d config validate
+
+  # print the configuration telegraf runs with, to diff it across versions
+  telegraf --config telegraf.conf --print-effective-config
+
   # run a single telegraf collection, outputing metrics to stdout
   telegraf --config telegraf.conf --test
 
@@ -132,35 +156,16 @@ func reloadLoop(
 		reload <- false
 
 		// If no other options are specified, load the config file and run.
-		c := config.NewConfig()
-		c.OutputFilters = outputFilters
-		c.InputFilters = inputFilters
-		err := c.LoadConfig(*fConfig)
+		c, err := loadConfig(inputFilters, outputFilters)
 		if err != nil {
 			log.Fatal("E! " + err.Error())
 		}
-
-		if *fConfigDirectory != "" {
-			err = c.LoadDirectory(*fConfigDirectory)
-			if err != nil {
-				log.Fatal("E! " + err.Error())
-			}
-		}
-		if !*fTest && len(c.Outputs) == 0 {
-			log.Fatalf("E! Error: no outputs found, did you provide a valid config file?")
-		}
-		if len(c.Inputs) == 0 {
-			log.Fatalf("E! Error: no inputs found, did you provide a valid config file?")
-		}
-
-		if int64(c.Agent.Interval.Duration) <= 0 {
-			log.Fatalf("E! Agent interval must be positive, found %s",
-				c.Agent.Interval.Duration)
+		if *fPrintEffectiveConfig {
+			fmt.Print(c.EffectiveConfig())
+			os.Exit(0)
 		}
-
-		if int64(c.Agent.FlushInterval.Duration) <= 0 {
-			log.Fatalf("E! Agent flush_interval must be positive; found %s",
-				c.Agent.Interval.Duration)
+		if err = checkConfig(c, *fTest); err != nil {
+			log.Fatal("E! " + err.Error())
 		}
 
 		ag, err := agent.NewAgent(c)
@@ -191,6 +196,10 @@ func reloadLoop(
 		shutdown := make(chan struct{})
 		signals := make(chan os.Signal)
 		signal.Notify(signals, os.Interrupt, syscall.SIGHUP)
+		var secretsChanged <-chan struct{}
+		if d := c.Agent.SecretRefreshInterval.Duration; d > 0 {
+			secretsChanged = c.Secrets.Watch(d, shutdown)
+		}
 		go func() {
 			select {
 			case sig := <-signals:
@@ -203,6 +212,11 @@ func reloadLoop(
 					reload <- true
 					close(shutdown)
 				}
+			case <-secretsChanged:
+				log.Printf("I! Secrets changed, reloading Telegraf config\n")
+				<-reload
+				reload <- true
+				close(shutdown)
 			case <-stop:
 				close(shutdown)
 			}
@@ -317,6 +331,10 @@ func main() {
 			fmt.Printf("Telegraf %s (git: %s %s)\n", displayVersion(), branch, commit)
 			return
 		case "config":
+			if len(args) > 1 {
+				configCommand(args[1:], inputFilters, outputFilters)
+				return
+			}
 			config.PrintSampleConfig(
 				inputFilters,
 				outputFilters,
@@ -324,6 +342,20 @@ func main() {
 				processorFilters,
 			)
 			return
+		case "migrate":
+			if len(args) != 3 || args[1] != "statsd" {
+				log.Fatal("E! usage: telegraf migrate statsd <file>")
+			}
+			buf, err := ioutil.ReadFile(args[2])
+			if err != nil {
+				log.Fatal("E! " + err.Error())
+			}
+			out, err := migrate.Statsd(buf, args[2])
+			if err != nil {
+				log.Fatal("E! " + err.Error())
+			}
+			fmt.Print(out)
+			return
 		}
 	}
 
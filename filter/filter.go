@@ -1,6 +1,8 @@
 package filter
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/gobwas/glob"
@@ -45,6 +47,36 @@ func Compile(filters []string) (Filter, error) {
 	}
 }
 
+// CompileWithRegex is Compile, the filters enclosed in slashes being
+// regular expressions, ie:
+//
+//   f, _ := CompileWithRegex([]string{"time_*", "/^usage_(user|system)$/"})
+//   f.Match("time_user")   // true
+//   f.Match("usage_user")  // true
+//   f.Match("usage_guest") // false
+//
+func CompileWithRegex(filters []string) (Filter, error) {
+	var globs []string
+	var regexps []*regexp.Regexp
+	for _, filter := range filters {
+		if len(filter) < 2 || filter[0] != '/' || filter[len(filter)-1] != '/' {
+			globs = append(globs, filter)
+			continue
+		}
+		re, err := regexp.Compile(filter[1 : len(filter)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %s: %s", filter, err)
+		}
+		regexps = append(regexps, re)
+	}
+
+	f, err := Compile(globs)
+	if err != nil || len(regexps) == 0 {
+		return f, err
+	}
+	return &filterregex{glob: f, regexps: regexps}, nil
+}
+
 // hasMeta reports whether path contains any magic glob characters.
 func hasMeta(s string) bool {
 	return strings.IndexAny(s, "*?[") >= 0
@@ -77,3 +109,20 @@ func compileFilterNoGlob(filters []string) Filter {
 	}
 	return &out
 }
+
+type filterregex struct {
+	glob    Filter
+	regexps []*regexp.Regexp
+}
+
+func (f *filterregex) Match(s string) bool {
+	if f.glob != nil && f.glob.Match(s) {
+		return true
+	}
+	for _, re := range f.regexps {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -37,6 +37,32 @@ func TestCompile(t *testing.T) {
 	assert.True(t, f.Match("network"))
 }
 
+func TestCompileWithRegex(t *testing.T) {
+	f, err := CompileWithRegex([]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, f)
+
+	f, err = CompileWithRegex([]string{"cpu*", "/^usage_(user|system)$/"})
+	assert.NoError(t, err)
+	assert.True(t, f.Match("cpu0"))
+	assert.True(t, f.Match("usage_user"))
+	assert.False(t, f.Match("usage_guest"))
+	assert.False(t, f.Match("/^usage_(user|system)$/"))
+
+	f, err = CompileWithRegex([]string{"/time_.*/"})
+	assert.NoError(t, err)
+	assert.True(t, f.Match("cpu_time_user"))
+	assert.False(t, f.Match("cpu"))
+
+	// a single slash is a glob
+	f, err = CompileWithRegex([]string{"/"})
+	assert.NoError(t, err)
+	assert.True(t, f.Match("/"))
+
+	_, err = CompileWithRegex([]string{"/usage_(/"})
+	assert.Error(t, err)
+}
+
 var benchbool bool
 
 func BenchmarkFilterSingleNoGlobFalse(b *testing.B) {
@@ -1,9 +1,12 @@
 package buffer
 
 import (
+	"log"
 	"sync"
+	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/selfstat"
 )
 
@@ -12,11 +15,26 @@ var (
 	MetricsDropped = selfstat.Register("agent", "metrics_dropped", map[string]string{})
 )
 
-// Buffer is an object for storing metrics in a circular buffer.
+// Buffer is an ordered queue of metrics in two tiers: a ring in memory
+// holding the newest metrics and, optionally, a spill file on disk holding
+// the metrics pushed out of the full ring. Metrics are always returned
+// oldest first: the metrics requeued after a failed write, then the ones of
+// the spill file, then the ones of the ring.
 type Buffer struct {
-	buf chan telegraf.Metric
-
 	mu sync.Mutex
+
+	// ring of metrics in memory, first is the index of the oldest one and
+	// n the number of metrics in the ring
+	ring  []telegraf.Metric
+	first int
+	n     int
+
+	// spill is nil when the buffer does not spill to disk
+	spill *spill
+
+	// requeued are the metrics of failed writes, they are older than any
+	// other metric of the buffer
+	requeued []telegraf.Metric
 }
 
 // NewBuffer returns a Buffer
@@ -24,50 +42,216 @@ type Buffer struct {
 //   called when the buffer is full, then the oldest metric(s) will be dropped.
 func NewBuffer(size int) *Buffer {
 	return &Buffer{
-		buf: make(chan telegraf.Metric, size),
+		ring: make([]telegraf.Metric, size),
+	}
+}
+
+// NewSpillBuffer returns a Buffer keeping size metrics in memory. If Add is
+// called when the memory is full, the oldest metric(s) are moved to the file
+// configured by c. The file is truncated, unless it is persistent.
+func NewSpillBuffer(size int, c SpillConfig) (*Buffer, error) {
+	s, err := openSpill(c)
+	if err != nil {
+		return nil, err
 	}
+	b := NewBuffer(size)
+	b.spill = s
+	return b, nil
 }
 
 // IsEmpty returns true if Buffer is empty.
 func (b *Buffer) IsEmpty() bool {
-	return len(b.buf) == 0
+	return b.Len() == 0
 }
 
 // Len returns the current length of the buffer.
 func (b *Buffer) Len() int {
-	return len(b.buf)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.requeued) + b.n
+	if b.spill != nil {
+		n += b.spill.n
+	}
+	return n
 }
 
-// Add adds metrics to the buffer.
+// MemoryLen returns the number of metrics held in memory, including the
+// requeued ones.
+func (b *Buffer) MemoryLen() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.requeued) + b.n
+}
+
+// RequeuedLen returns the number of requeued metrics.
+func (b *Buffer) RequeuedLen() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.requeued)
+}
+
+// DiskLen returns the number of metrics in the spill file and the number of
+// bytes they use.
+func (b *Buffer) DiskLen() (int, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.spill == nil {
+		return 0, 0
+	}
+	return b.spill.n, b.spill.size - b.spill.off
+}
+
+// Add adds metrics to the buffer. The metrics spilled to disk are flushed to
+// the file before it returns.
 func (b *Buffer) Add(metrics ...telegraf.Metric) {
-	for i, _ := range metrics {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	spilled := false
+	for i := range metrics {
 		MetricsWritten.Incr(1)
-		select {
-		case b.buf <- metrics[i]:
-		default:
-			b.mu.Lock()
-			MetricsDropped.Incr(1)
-			<-b.buf
-			b.buf <- metrics[i]
-			b.mu.Unlock()
+		if b.n == len(b.ring) {
+			b.overflow(b.pop())
+			spilled = true
 		}
+		b.ring[(b.first+b.n)%len(b.ring)] = metrics[i]
+		b.n++
+	}
+	if spilled && b.spill != nil {
+		if err := b.spill.flush(); err != nil {
+			log.Printf("E! Unable to flush the metrics spilled to %s: %s",
+				b.spill.path, err)
+		}
+	}
+}
+
+// overflow moves a metric pushed out of the ring to the spill file, or
+// drops it.
+func (b *Buffer) overflow(m telegraf.Metric) {
+	if b.spill == nil {
+		MetricsDropped.Incr(1)
+		return
+	}
+	dropped, err := b.spill.push(m)
+	if err != nil {
+		log.Printf("E! Unable to spill metric to %s: %s", b.spill.path, err)
+		MetricsDropped.Incr(1)
+		return
+	}
+	if dropped {
+		MetricsDropped.Incr(1)
 	}
 }
 
+// pop removes the oldest metric of the ring.
+func (b *Buffer) pop() telegraf.Metric {
+	m := b.ring[b.first]
+	b.ring[b.first] = nil
+	b.first = (b.first + 1) % len(b.ring)
+	b.n--
+	return m
+}
+
 // Batch returns a batch of metrics of size batchSize.
 // the batch will be of maximum length batchSize. It can be less than batchSize,
 // if the length of Buffer is less than batchSize.
+// The metrics are removed from the buffer, use Requeue to put them back.
 func (b *Buffer) Batch(batchSize int) []telegraf.Metric {
 	b.mu.Lock()
-	n := min(len(b.buf), batchSize)
-	out := make([]telegraf.Metric, n)
-	for i := 0; i < n; i++ {
-		out[i] = <-b.buf
+	defer b.mu.Unlock()
+
+	n := min(len(b.requeued), batchSize)
+	out := make([]telegraf.Metric, n, batchSize)
+	copy(out, b.requeued[:n])
+	b.requeued = b.requeued[n:]
+	if len(b.requeued) == 0 {
+		b.requeued = nil
+	}
+
+	if b.spill != nil && len(out) < batchSize {
+		var err error
+		out, err = b.spill.pop(out, batchSize-len(out))
+		if err != nil {
+			log.Printf("E! Unable to read metrics spilled to %s, dropping "+
+				"%d metrics: %s", b.spill.path, b.spill.n, err)
+			MetricsDropped.Incr(int64(b.spill.n))
+			b.spill.reset()
+		}
+	}
+
+	for len(out) < batchSize && b.n > 0 {
+		out = append(out, b.pop())
 	}
-	b.mu.Unlock()
 	return out
 }
 
+// Requeue puts a batch back at the head of the buffer, it is returned
+// before any other metric by the next calls to Batch. Requeued metrics are
+// not subject to the size of the buffer.
+func (b *Buffer) Requeue(batch []telegraf.Metric) {
+	if len(batch) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	requeued := make([]telegraf.Metric, 0, len(batch)+len(b.requeued))
+	requeued = append(requeued, batch...)
+	b.requeued = append(requeued, b.requeued...)
+}
+
+// Retime moves by offset the timestamps of the metrics held in memory for
+// which match returns true, and returns their number. The metrics spilled to
+// disk keep their timestamps.
+func (b *Buffer) Retime(offset time.Duration, match func(telegraf.Metric) bool) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	retime := func(m telegraf.Metric) telegraf.Metric {
+		if !match(m) {
+			return m
+		}
+		moved, err := metric.New(m.Name(), m.Tags(), m.Fields(),
+			m.Time().Add(offset), m.Type())
+		if err != nil {
+			return m
+		}
+		moved.SetAggregate(m.IsAggregate())
+		n++
+		return moved
+	}
+	for i := range b.requeued {
+		b.requeued[i] = retime(b.requeued[i])
+	}
+	for i := 0; i < b.n; i++ {
+		j := (b.first + i) % len(b.ring)
+		b.ring[j] = retime(b.ring[j])
+	}
+	return n
+}
+
+// Close removes the spill file, the metrics it holds are lost. If the file
+// is persistent, the metrics held in memory are saved to it instead, to be
+// read back by the next buffer.
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.spill == nil {
+		return nil
+	}
+	var err error
+	if b.spill.persist {
+		ring := make([]telegraf.Metric, 0, b.n)
+		for b.n > 0 {
+			ring = append(ring, b.pop())
+		}
+		err = b.spill.save(b.requeued, ring)
+		b.requeued = nil
+	} else {
+		err = b.spill.close()
+	}
+	b.spill = nil
+	return err
+}
+
 func min(a, b int) int {
 	if b < a {
 		return b
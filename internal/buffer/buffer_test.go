@@ -1,12 +1,18 @@
 package buffer
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/testutil"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var metricList = []telegraf.Metric{
@@ -98,3 +104,296 @@ func TestGettingBatches(t *testing.T) {
 	assert.Equal(t, int64(0), MetricsDropped.Get())
 	assert.Equal(t, int64(10), MetricsWritten.Get())
 }
+
+func TestRequeue(t *testing.T) {
+	b := NewBuffer(10)
+
+	b.Add(metricList[:3]...)
+	batch := b.Batch(2)
+	b.Add(metricList[3:]...)
+	b.Requeue(batch)
+
+	assert.Equal(t, 5, b.Len())
+	assert.Equal(t, metricList, b.Batch(10))
+}
+
+func TestRetime(t *testing.T) {
+	b := NewBuffer(10)
+
+	b.Add(metricList[:3]...)
+	batch := b.Batch(2)
+	b.Add(metricList[3:]...)
+	b.Requeue(batch)
+
+	// the metrics whose value is over 5
+	n := b.Retime(time.Hour, func(m telegraf.Metric) bool {
+		return m.Fields()["value"].(int64) > 5
+	})
+	assert.Equal(t, 3, n)
+
+	ts := metricList[0].Time()
+	for i, m := range b.Batch(10) {
+		assert.Equal(t, metricList[i].Name(), m.Name())
+		if m.Fields()["value"].(int64) > 5 {
+			assert.Equal(t, ts.Add(time.Hour), m.Time())
+		} else {
+			assert.Equal(t, ts, m.Time())
+		}
+	}
+}
+
+func TestSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.spill")
+
+	b, err := NewSpillBuffer(2, SpillConfig{Path: path})
+	require.NoError(t, err)
+	MetricsDropped.Set(0)
+
+	b.Add(metricList...)
+	assert.Equal(t, 5, b.Len())
+	assert.Equal(t, 2, b.MemoryLen())
+	n, size := b.DiskLen()
+	assert.Equal(t, 3, n)
+	assert.True(t, size > 0)
+	assert.Zero(t, MetricsDropped.Get())
+
+	// the spilled metrics are returned first, in order
+	batch := b.Batch(2)
+	assertMetrics(t, metricList[:2], batch)
+	b.Requeue(batch)
+	assertMetrics(t, metricList, b.Batch(10))
+
+	// the file is emptied once read
+	n, size = b.DiskLen()
+	assert.Equal(t, 0, n)
+	assert.Equal(t, int64(0), size)
+	assert.True(t, b.IsEmpty())
+
+	require.NoError(t, b.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// Test that the spilled metrics are on disk once added, before the file is
+// read or closed
+func TestSpillFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.spill")
+
+	b, err := NewSpillBuffer(2, SpillConfig{Path: path})
+	require.NoError(t, err)
+	defer b.Close()
+
+	b.Add(metricList...)
+	buf, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	var expected []byte
+	for _, m := range metricList[:3] {
+		expected = append(expected, m.Serialize()...)
+	}
+	assert.Equal(t, string(expected), string(buf))
+}
+
+func TestSpillLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b, err := NewSpillBuffer(1, SpillConfig{
+		Path:  filepath.Join(dir, "test.spill"),
+		Limit: 2,
+	})
+	require.NoError(t, err)
+	defer b.Close()
+	MetricsDropped.Set(0)
+
+	// the 2 oldest metrics are dropped from the file
+	b.Add(metricList...)
+	assert.Equal(t, 3, b.Len())
+	assert.Equal(t, int64(2), MetricsDropped.Get())
+	assertMetrics(t, metricList[2:], b.Batch(10))
+
+	// metrics spilled after the file was read
+	b.Add(metricList[:2]...)
+	assertMetrics(t, metricList[:2], b.Batch(10))
+}
+
+func TestSpillDropNewest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b, err := NewSpillBuffer(1, SpillConfig{
+		Path:       filepath.Join(dir, "test.spill"),
+		Limit:      2,
+		DropNewest: true,
+	})
+	require.NoError(t, err)
+	defer b.Close()
+	MetricsDropped.Set(0)
+
+	// the metrics pushed out of memory once the file is full are dropped
+	b.Add(metricList...)
+	assert.Equal(t, 3, b.Len())
+	assert.Equal(t, int64(2), MetricsDropped.Get())
+	assertMetrics(t, []telegraf.Metric{metricList[0], metricList[1], metricList[4]},
+		b.Batch(10))
+}
+
+// Test that a persistent buffer saves its metrics when closed, in order, and
+// reads them back when created
+func TestSpillPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := SpillConfig{Path: filepath.Join(dir, "test.spill"), Persist: true}
+
+	b, err := NewSpillBuffer(2, c)
+	require.NoError(t, err)
+	b.Add(metricList...)
+	batch := b.Batch(1)
+	b.Requeue(batch)
+	require.NoError(t, b.Close())
+
+	b, err = NewSpillBuffer(2, c)
+	require.NoError(t, err)
+	assert.Equal(t, 5, b.Len())
+	n, _ := b.DiskLen()
+	assert.Equal(t, 5, n)
+	assertMetrics(t, metricList[:3], b.Batch(3))
+	require.NoError(t, b.Close())
+
+	// a truncated last line is dropped, and the limit applied
+	f, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString("mymetric6 value=")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	MetricsDropped.Set(0)
+	c.Limit = 1
+	b, err = NewSpillBuffer(2, c)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), MetricsDropped.Get())
+	assertMetrics(t, metricList[4:], b.Batch(10))
+	require.NoError(t, b.Close())
+
+	b, err = NewSpillBuffer(2, c)
+	require.NoError(t, err)
+	defer b.Close()
+	assert.True(t, b.IsEmpty())
+}
+
+// Test that a persistent file written for another output is set aside rather
+// than read back
+func TestSpillPersistHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := SpillConfig{
+		Path:    filepath.Join(dir, "test.spill"),
+		ID:      "outputs.file sha256 0123",
+		Persist: true,
+	}
+
+	b, err := NewSpillBuffer(1, c)
+	require.NoError(t, err)
+	b.Add(metricList...)
+	require.NoError(t, b.Close())
+
+	data, err := ioutil.ReadFile(c.Path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data),
+		"# telegraf buffer of outputs.file sha256 0123\n"))
+
+	b, err = NewSpillBuffer(1, c)
+	require.NoError(t, err)
+	assertMetrics(t, metricList[:2], b.Batch(2))
+	require.NoError(t, b.Close())
+
+	c.ID = "outputs.file sha256 4567"
+	b, err = NewSpillBuffer(1, c)
+	require.NoError(t, err)
+	assert.True(t, b.IsEmpty())
+	require.NoError(t, b.Close())
+
+	rejected, err := ioutil.ReadFile(c.Path + ".rejected")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(rejected),
+		"# telegraf buffer of outputs.file sha256 0123\n"))
+	assert.Equal(t, 4, strings.Count(string(rejected), "\n"))
+}
+
+// Test that an unparsable line is dropped alone
+func TestSpillBadLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := SpillConfig{Path: filepath.Join(dir, "test.spill"), ID: "test", Persist: true}
+
+	b, err := NewSpillBuffer(1, c)
+	require.NoError(t, err)
+	b.Add(metricList[:3]...)
+	require.NoError(t, b.Close())
+
+	data, err := ioutil.ReadFile(c.Path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(data), "\n")
+	lines[2] = "not line protocol\n"
+	require.NoError(t, ioutil.WriteFile(c.Path, []byte(strings.Join(lines, "")), 0600))
+
+	MetricsDropped.Set(0)
+	b, err = NewSpillBuffer(1, c)
+	require.NoError(t, err)
+	defer b.Close()
+	assertMetrics(t, []telegraf.Metric{metricList[0], metricList[2]}, b.Batch(10))
+	assert.Equal(t, int64(1), MetricsDropped.Get())
+	assert.True(t, b.IsEmpty())
+}
+
+// Test that the header is kept when the file is compacted
+func TestSpillCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := SpillConfig{Path: filepath.Join(dir, "test.spill"), ID: "test", Persist: true}
+
+	s, err := openSpill(c)
+	require.NoError(t, err)
+	for _, m := range metricList {
+		_, err := s.push(m)
+		require.NoError(t, err)
+	}
+	out, err := s.pop(nil, 2)
+	require.NoError(t, err)
+	assertMetrics(t, metricList[:2], out)
+
+	require.NoError(t, s.compact())
+	assert.Equal(t, 3, s.n)
+	out, err = s.pop(nil, 1)
+	require.NoError(t, err)
+	assertMetrics(t, metricList[2:3], out)
+	require.NoError(t, s.save(nil, nil))
+
+	s, err = openSpill(c)
+	require.NoError(t, err)
+	defer s.close()
+	assert.Equal(t, 2, s.n)
+	out, err = s.pop(nil, 10)
+	require.NoError(t, err)
+	assertMetrics(t, metricList[3:], out)
+}
+
+// assertMetrics compares metrics read back from disk, which do not keep
+// their type.
+func assertMetrics(t *testing.T, expected, actual []telegraf.Metric) {
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		assert.Equal(t, expected[i].String(), actual[i].String())
+	}
+}
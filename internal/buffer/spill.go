@@ -0,0 +1,376 @@
+package buffer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// compactSize is the number of bytes consumed at the beginning of a spill
+// file above which the file is rewritten, when they are more than half of
+// the file.
+const compactSize = 16 * 1024 * 1024
+
+// SpillConfig configures the file a Buffer moves its oldest metrics to when
+// it is full.
+type SpillConfig struct {
+	Path string
+	// ID identifies the output the file belongs to, it is written in the
+	// header of the file and a persisted file with another ID is not read
+	// back. Empty writes no header.
+	ID string
+	// Limit is the max number of metrics in the file, 0 is unlimited.
+	Limit int
+	// DropNewest drops the metrics pushed out of memory when the file is
+	// full, instead of the oldest metrics of the file.
+	DropNewest bool
+	// Persist keeps the file when the buffer is closed, with the metrics
+	// held in memory, and reads it back when the buffer is created.
+	Persist bool
+}
+
+// spill is a queue of metrics in a file, one metric per line in line
+// protocol, after the header line holding the ID. Metrics are appended at the
+// end of the file and read from an offset, the file is truncated whenever it
+// is fully read. Unless it is persistent, the file is truncated when opened
+// and removed when closed. The type of the metrics (counter, gauge...) is not
+// kept.
+type spill struct {
+	path       string
+	limit      int
+	dropNewest bool
+	persist    bool
+	header     []byte
+
+	w  *os.File
+	bw *bufio.Writer
+	r  *os.File
+	br *bufio.Reader
+
+	// n is the number of metrics in the file, size the number of bytes
+	// written to it and off the number of bytes read from it, the header
+	// included.
+	n    int
+	size int64
+	off  int64
+}
+
+// errHeaderMismatch is returned by load for a file written for another ID.
+type errHeaderMismatch struct {
+	header []byte
+}
+
+func (e *errHeaderMismatch) Error() string {
+	return fmt.Sprintf("the file belongs to %q", bytes.TrimSpace(e.header))
+}
+
+func openSpill(c SpillConfig) (*spill, error) {
+	s := &spill{
+		path:       c.Path,
+		limit:      c.Limit,
+		dropNewest: c.DropNewest,
+		persist:    c.Persist,
+	}
+	if c.ID != "" {
+		s.header = []byte(fmt.Sprintf("# telegraf buffer of %s\n", c.ID))
+	}
+	if !s.persist {
+		if err := s.open(os.O_TRUNC); err != nil {
+			return nil, err
+		}
+		return s, s.reset()
+	}
+
+	if err := s.open(0); err != nil {
+		return nil, err
+	}
+	err := s.load()
+	if _, ok := err.(*errHeaderMismatch); ok {
+		// the metrics are kept aside rather than replayed to the wrong output
+		s.w.Close()
+		s.r.Close()
+		rejected := s.path + ".rejected"
+		log.Printf("E! Not reading back the buffer spill file %s, %s, moved "+
+			"to %s", s.path, err, rejected)
+		if err := os.Rename(s.path, rejected); err != nil {
+			return nil, err
+		}
+		if err := s.open(os.O_TRUNC); err != nil {
+			return nil, err
+		}
+		return s, s.reset()
+	}
+	if err != nil {
+		s.w.Close()
+		s.r.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load counts the metrics of a persisted file. A last line without newline,
+// left by a crash, is removed, and the oldest metrics above the limit are
+// skipped.
+func (s *spill) load() error {
+	if len(s.header) > 0 {
+		header, err := s.br.ReadBytes('\n')
+		if err == io.EOF && len(header) == 0 {
+			// new file
+			return s.reset()
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if !bytes.Equal(header, s.header) {
+			return &errHeaderMismatch{header: header}
+		}
+	}
+
+	size := int64(len(s.header))
+	for {
+		line, err := s.br.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		size += int64(len(line))
+		s.n++
+	}
+	if err := s.w.Truncate(size); err != nil {
+		return err
+	}
+	s.size = size
+	s.off = int64(len(s.header))
+	if _, err := s.r.Seek(s.off, io.SeekStart); err != nil {
+		return err
+	}
+	s.br.Reset(s.r)
+
+	for s.limit > 0 && s.n > s.limit {
+		if err := s.skip(); err != nil {
+			return err
+		}
+		MetricsDropped.Incr(1)
+	}
+	return nil
+}
+
+func (s *spill) open(flag int) error {
+	w, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND|flag, 0600)
+	if err != nil {
+		return err
+	}
+	r, err := os.Open(s.path)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	s.w, s.r = w, r
+	s.bw = bufio.NewWriter(w)
+	s.br = bufio.NewReader(r)
+	return nil
+}
+
+// push appends a metric to the file, dropping the oldest one, or the metric
+// itself with dropNewest, if the file is full. It returns whether a metric
+// was dropped.
+func (s *spill) push(m telegraf.Metric) (bool, error) {
+	dropped := false
+	if s.limit > 0 && s.n >= s.limit {
+		if s.dropNewest {
+			return true, nil
+		}
+		if err := s.skip(); err != nil {
+			return false, err
+		}
+		dropped = true
+	}
+	n, err := s.bw.Write(m.Serialize())
+	s.size += int64(n)
+	if err != nil {
+		return dropped, err
+	}
+	s.n++
+	return dropped, nil
+}
+
+// flush writes the metrics pushed to the file, so that they are not lost if
+// telegraf crashes.
+func (s *spill) flush() error {
+	return s.bw.Flush()
+}
+
+// skip drops the oldest metric of the file.
+func (s *spill) skip() error {
+	if err := s.bw.Flush(); err != nil {
+		return err
+	}
+	line, err := s.br.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	s.off += int64(len(line))
+	s.n--
+	return nil
+}
+
+// pop appends up to max of the oldest metrics of the file to out.
+func (s *spill) pop(out []telegraf.Metric, max int) ([]telegraf.Metric, error) {
+	if s.n == 0 {
+		return out, nil
+	}
+	if err := s.bw.Flush(); err != nil {
+		return out, err
+	}
+	for i := 0; i < max && s.n > 0; i++ {
+		line, err := s.br.ReadBytes('\n')
+		if err != nil {
+			return out, err
+		}
+		s.off += int64(len(line))
+		s.n--
+		metrics, err := metric.Parse(line)
+		if err != nil {
+			log.Printf("W! Dropping a metric of the buffer spill file %s "+
+				"that could not be parsed: %s", s.path, err)
+			MetricsDropped.Incr(1)
+			continue
+		}
+		out = append(out, metrics...)
+	}
+
+	if s.n == 0 {
+		return out, s.reset()
+	}
+	if s.off > compactSize && s.off > s.size/2 {
+		return out, s.compact()
+	}
+	return out, nil
+}
+
+// reset empties the file, but for the header.
+func (s *spill) reset() error {
+	s.n = 0
+	s.size = int64(len(s.header))
+	s.off = s.size
+	s.bw.Reset(s.w)
+	if err := s.w.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(s.header); err != nil {
+		return err
+	}
+	if _, err := s.r.Seek(s.off, io.SeekStart); err != nil {
+		return err
+	}
+	s.br.Reset(s.r)
+	return nil
+}
+
+// compact rewrites the file without the metrics already read.
+func (s *spill) compact() error {
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := s.r.Seek(s.off, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	_, err = f.Write(s.header)
+	if err == nil {
+		_, err = io.Copy(f, s.r)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	s.w.Close()
+	s.r.Close()
+	s.size -= s.off - int64(len(s.header))
+	s.off = int64(len(s.header))
+	if err := s.open(0); err != nil {
+		return err
+	}
+	if _, err := s.r.Seek(s.off, io.SeekStart); err != nil {
+		return err
+	}
+	s.br.Reset(s.r)
+	return nil
+}
+
+// close closes and removes the file.
+func (s *spill) close() error {
+	s.w.Close()
+	s.r.Close()
+	return os.Remove(s.path)
+}
+
+// save closes the file after rewriting it with the metrics of head, the
+// ones of the file not read yet and the ones of tail, in this order.
+func (s *spill) save(head, tail []telegraf.Metric) error {
+	defer s.r.Close()
+	defer s.w.Close()
+	if err := s.bw.Flush(); err != nil {
+		return err
+	}
+	if len(head) == 0 && len(tail) == 0 && s.off == int64(len(s.header)) {
+		return nil
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	_, err = w.Write(s.header)
+	if err == nil {
+		err = writeMetrics(w, head)
+	}
+	if err == nil {
+		if _, err = s.r.Seek(s.off, io.SeekStart); err == nil {
+			_, err = io.Copy(w, s.r)
+		}
+	}
+	if err == nil {
+		err = writeMetrics(w, tail)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func writeMetrics(w io.Writer, metrics []telegraf.Metric) error {
+	for _, m := range metrics {
+		if _, err := w.Write(m.Serialize()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
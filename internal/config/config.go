@@ -2,8 +2,11 @@ package config
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math"
@@ -18,13 +21,17 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/buffer"
+	"github.com/influxdata/telegraf/internal/jsonschema"
 	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/internal/secret"
 	"github.com/influxdata/telegraf/plugins/aggregators"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
 	"github.com/influxdata/telegraf/plugins/processors"
 	"github.com/influxdata/telegraf/plugins/serializers"
+	"github.com/influxdata/telegraf/plugins/serializers/json"
 
 	"github.com/influxdata/toml"
 	"github.com/influxdata/toml/ast"
@@ -38,8 +45,57 @@ var (
 	// Default output plugins
 	outputDefaults = []string{"influxdb"}
 
-	// envVarRe is a regex to find environment variables in the config file
-	envVarRe = regexp.MustCompile(`\$\w+`)
+	// envVarRe is a regex to find environment variables in the config file,
+	// $VAR, ${VAR} or ${VAR:-default}
+	envVarRe = regexp.MustCompile(`\$\{(\w+)(:-([^}]*))?\}|\$\w+`)
+
+	// optionLineRe matches the lines setting an option, tableLineRe the
+	// headers of the tables and quotedRe the strings of a line, as read by
+	// RedactedFile.
+	optionLineRe = regexp.MustCompile(`^\s*"?([\w.-]+)"?\s*=`)
+	tableLineRe  = regexp.MustCompile(`^\s*\[\[?[\w.-]+\]\]?\s*(#.*)?$`)
+	quotedRe     = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'[^']*'`)
+
+	// spillNameRe matches the valid spill_name of the outputs.
+	spillNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+	// deprecatedPlugins maps the deprecated plugins to their replacement.
+	deprecatedPlugins = map[string]string{
+		"inputs.snmp_legacy":     "use inputs.snmp",
+		"inputs.tcp_listener":    "use inputs.socket_listener",
+		"inputs.udp_listener":    "use inputs.socket_listener",
+		"outputs.riemann_legacy": "use outputs.riemann",
+	}
+
+	// deprecatedOptions maps the plugins to their deprecated options and
+	// their replacement.
+	deprecatedOptions = map[string]map[string]string{
+		"agent": {
+			"utc": "timestamps are always UTC",
+		},
+		"inputs.httpjson": {
+			"name": "use name_override, name_prefix or name_suffix",
+		},
+		"inputs.rabbitmq": {
+			"name": "use tags",
+		},
+		"inputs.statsd": {
+			"udp_packet_size": "the buffer is always of the maximum size",
+		},
+		"inputs.udp_listener": {
+			"udp_packet_size": "the buffer is always of the maximum size",
+		},
+		"outputs.amqp": {
+			"precision": "the precision is not used",
+		},
+		"outputs.kinesis": {
+			"partitionkey":            "use [outputs.kinesis.partition]",
+			"use_random_partitionkey": "use [outputs.kinesis.partition]",
+		},
+		"outputs.librato": {
+			"source_tag": "use template",
+		},
+	}
 )
 
 // Config specifies the URL/user/password for the database that telegraf
@@ -56,6 +112,23 @@ type Config struct {
 	Aggregators []*models.RunningAggregator
 	// Processors have a slice wrapper type because they need to be sorted
 	Processors models.RunningProcessors
+
+	// Deprecations lists the deprecated plugins and options in use.
+	Deprecations []string
+
+	// Files lists the configuration files loaded, in order.
+	Files []string
+
+	// Secrets resolves the references to secrets of the configuration.
+	Secrets *secret.Resolver
+
+	// profiles maps the profiles defined so far to whether they are active.
+	profiles map[string]bool
+	// loading holds the absolute paths of the files being loaded, the file
+	// given to LoadConfig and the files including it.
+	loading map[string]bool
+	// spillFiles holds the names of the spill files of the outputs.
+	spillFiles map[string]bool
 }
 
 func NewConfig() *Config {
@@ -65,6 +138,8 @@ func NewConfig() *Config {
 			Interval:      internal.Duration{Duration: 10 * time.Second},
 			RoundInterval: true,
 			FlushInterval: internal.Duration{Duration: 10 * time.Second},
+
+			MetricBufferSpillLimit: 1000000,
 		},
 
 		Tags:          make(map[string]string),
@@ -73,6 +148,7 @@ func NewConfig() *Config {
 		Processors:    make([]*models.RunningProcessor, 0),
 		InputFilters:  make([]string, 0),
 		OutputFilters: make([]string, 0),
+		Secrets:       secret.NewResolver(),
 	}
 	return c
 }
@@ -99,6 +175,11 @@ type AgentConfig struct {
 	// same time, which can have a measurable effect on the system.
 	CollectionJitter internal.Duration
 
+	// CollectionStagger starts the collection of each input at a fixed
+	// offset within its interval, derived from the hash of its name and
+	// position, rather than all at the same time.
+	CollectionStagger bool
+
 	// FlushInterval is the Interval at which to flush data
 	FlushInterval internal.Duration
 
@@ -119,6 +200,21 @@ type AgentConfig struct {
 	// not be less than 2 times MetricBatchSize.
 	MetricBufferLimit int
 
+	// MetricBufferSpillDirectory is the directory of the files the outputs
+	// move their oldest metrics to when their buffer is full, instead of
+	// dropping them. Empty disables spilling.
+	MetricBufferSpillDirectory string
+	// MetricBufferSpillLimit is the max number of metrics that each output
+	// keeps on disk. 0 is unlimited.
+	MetricBufferSpillLimit int
+	// MetricBufferSpillDrop is the metrics dropped when the limit is
+	// reached: "oldest", the default, or "newest".
+	MetricBufferSpillDrop string
+	// MetricBufferSpillPersist keeps the files when telegraf stops, with
+	// the metrics of the buffers in memory, to write them after a restart.
+	// The type of the metrics is not kept on disk.
+	MetricBufferSpillPersist bool
+
 	// FlushBufferWhenFull tells Telegraf to flush the metric buffer whenever
 	// it fills up, regardless of FlushInterval. Setting this option to true
 	// does _not_ deactivate FlushInterval.
@@ -139,6 +235,27 @@ type AgentConfig struct {
 	Quiet        bool
 	Hostname     string
 	OmitHostname bool
+
+	// PluginUsageSampling measures the CPU time and allocations of one in
+	// every PluginUsageSampling calls to each plugin, 0 disables it.
+	PluginUsageSampling int
+
+	// PanicRestartDelay is the time after which an input or output which
+	// panicked is restarted, 0 disables it until telegraf restarts.
+	PanicRestartDelay internal.Duration
+
+	// SecretRefreshInterval is how often the secrets are checked, the
+	// configuration is reloaded when one changed. 0 disables the checks.
+	SecretRefreshInterval internal.Duration
+
+	// ClockJumpThreshold is the step of the system clock over which the
+	// collection and the aggregation periods are aligned again and a
+	// clock_jump metric is emitted. 0 disables the detection.
+	ClockJumpThreshold internal.Duration
+	// ClockJumpRetimestamp moves the timestamps of the metrics buffered in
+	// memory by a backward step of the clock, the metrics spilled to disk
+	// are not moved.
+	ClockJumpRetimestamp bool
 }
 
 // Inputs returns a list of strings of the configured inputs.
@@ -186,7 +303,16 @@ var header = `# Telegraf Configuration
 #
 # Environment variables can be used anywhere in this config file, simply prepend
 # them with $. For strings the variable must be within quotes (ie, "$STR_VAR"),
-# for numbers and booleans they should be plain (ie, $INT_VAR, $BOOL_VAR)
+# for numbers and booleans they should be plain (ie, $INT_VAR, $BOOL_VAR).
+# ${VAR:-default} uses default when VAR is unset.
+#
+# Other configuration files, directories of .conf files or globs can be
+# loaded after this one with a top level include option, ie
+# include = ["telegraf.d"]
+#
+# Credentials can be read from secret stores with "@secret:<store>:<key>"
+# strings, ie password = "@secret:env:INFLUX_PASSWORD", see the [secretstores]
+# table in docs/CONFIGURATION.md.
 
 
 # Global tags can be specified here in key="value" format.
@@ -216,11 +342,29 @@ var header = `# Telegraf Configuration
   ## This buffer only fills when writes fail to output plugin(s).
   metric_buffer_limit = 10000
 
+  ## When set, the oldest metrics of a full buffer are moved to a file in this
+  ## directory, one per output, instead of being dropped. They are written
+  ## before the metrics in memory, in order.
+  # metric_buffer_spill_directory = "/var/lib/telegraf/buffer"
+  ## Maximum number of metrics each output keeps on disk. 0 is unlimited.
+  # metric_buffer_spill_limit = 1000000
+  ## Metrics dropped when the limit is reached: "oldest" or "newest".
+  # metric_buffer_spill_drop = "oldest"
+  ## Keep the files when telegraf stops, with the metrics held in memory, so
+  ## that they are written after a restart. The file of an output is found
+  ## back by its spill_name option, or else by the hash of its options. The
+  ## metrics are stored in line protocol, their type (counter, gauge...) is
+  ## lost and they are read back untyped.
+  # metric_buffer_spill_persist = false
+
   ## Collection jitter is used to jitter the collection by a random amount.
   ## Each plugin will sleep for a random time within jitter before collecting.
   ## This can be used to avoid many plugins querying things like sysfs at the
   ## same time, which can have a measurable effect on the system.
   collection_jitter = "0s"
+  ## Start the collection of each input at a fixed offset within its
+  ## interval, derived from its name, instead of all at the same time.
+  # collection_stagger = false
 
   ## Default flushing interval for all outputs. You shouldn't set this below
   ## interval. Maximum flush_interval will be flush_interval + flush_jitter
@@ -252,6 +396,33 @@ var header = `# Telegraf Configuration
   ## If set to true, do no set the "host" tag in the telegraf agent.
   omit_hostname = false
 
+  ## Measure the CPU time and allocations of one in every
+  ## plugin_usage_sampling calls to each plugin, reported in the
+  ## internal_gather, internal_process and internal_write metrics of the
+  ## internal input. 0 (default) disables the measurement.
+  # plugin_usage_sampling = 0
+
+  ## An input or output which panics is disabled, the other plugins keep
+  ## running. It is restarted after panic_restart_delay, 0 (default) keeps
+  ## it disabled until telegraf restarts.
+  # panic_restart_delay = "0s"
+
+  ## How often the secrets referenced as "@secret:<store>:<key>" are
+  ## checked, the configuration is reloaded when one changed. 0 (default)
+  ## disables the checks.
+  # secret_refresh_interval = "0s"
+
+  ## A step of the system clock larger than clock_jump_threshold, such as an
+  ## NTP correction or the resume of a suspended VM, aligns the collection
+  ## and the aggregation periods again and emits a clock_jump metric. 0
+  ## (default) disables the detection.
+  # clock_jump_threshold = "0s"
+  ## Move the timestamps of the metrics buffered in memory by a backward step
+  ## of the clock, the ones timestamped in the future. Forward steps, such as
+  ## the resume of a suspended VM, are not retimed. The metrics spilled to
+  ## disk keep their timestamps.
+  # clock_jump_retimestamp = false
+
 
 ###############################################################################
 #                            OUTPUT PLUGINS                                   #
@@ -507,7 +678,25 @@ func PrintOutputConfig(name string) error {
 	return nil
 }
 
+// LoadDirectory loads the .conf files of the directory and its
+// subdirectories, in the lexical order of their paths.
 func (c *Config) LoadDirectory(path string) error {
+	paths, err := directoryFiles(path)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if err = c.LoadConfig(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// directoryFiles returns the .conf files of the directory and its
+// subdirectories, in the lexical order of their paths.
+func directoryFiles(path string) ([]string, error) {
+	var paths []string
 	walkfn := func(thispath string, info os.FileInfo, _ error) error {
 		if info == nil {
 			log.Printf("W! Telegraf is not permitted to read %s", thispath)
@@ -520,13 +709,11 @@ func (c *Config) LoadDirectory(path string) error {
 		if len(name) < 6 || name[len(name)-5:] != ".conf" {
 			return nil
 		}
-		err := c.LoadConfig(thispath)
-		if err != nil {
-			return err
-		}
+		paths = append(paths, thispath)
 		return nil
 	}
-	return filepath.Walk(path, walkfn)
+	err := filepath.Walk(path, walkfn)
+	return paths, err
 }
 
 // Try to find a default config file at these locations (in order):
@@ -553,7 +740,10 @@ func getDefaultConfigPath() (string, error) {
 		" in $TELEGRAF_CONFIG_PATH, %s, or %s", homefile, etcfile)
 }
 
-// LoadConfig loads the given config file and applies it to c
+// LoadConfig loads the given config file and the files it includes, and
+// applies them to c. The secret stores, global tags, agent options and
+// profiles of all the files are loaded before any plugin is built, so that
+// those of the included files apply to the plugins of the including file.
 func (c *Config) LoadConfig(path string) error {
 	var err error
 	if path == "" {
@@ -561,19 +751,85 @@ func (c *Config) LoadConfig(path string) error {
 			return err
 		}
 	}
+	files, err := c.parseFiles(path)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		// Parse the secret stores, before the secrets of any file:
+		if val, ok := f.tbl.Fields["secretstores"]; ok {
+			subTable, ok := val.(*ast.Table)
+			if !ok {
+				return fmt.Errorf("%s: invalid configuration", f.path)
+			}
+			if err = c.loadSecretStores(subTable); err != nil {
+				return fmt.Errorf("Error parsing %s, %s", f.path, err)
+			}
+		}
+	}
+	for _, f := range files {
+		if err = c.loadSettings(f.path, f.tbl); err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		if err = c.loadPlugins(f.path, f.tbl); err != nil {
+			return err
+		}
+	}
+
+	if len(c.Processors) > 1 {
+		sort.Sort(c.Processors)
+	}
+	return nil
+}
+
+// configFile is a parsed configuration file.
+type configFile struct {
+	path string
+	tbl  *ast.Table
+}
+
+// parseFiles parses the configuration file path and, after it, the files it
+// includes.
+func (c *Config) parseFiles(path string) ([]configFile, error) {
+	leave, err := c.enterFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+	c.Files = append(c.Files, path)
+
 	tbl, err := parseFile(path)
 	if err != nil {
+		return nil, fmt.Errorf("Error parsing %s, %s", path, err)
+	}
+	included, err := c.parseIncludes(path, includeOption(tbl))
+	if err != nil {
+		return nil, err
+	}
+	return append([]configFile{{path: path, tbl: tbl}}, included...), nil
+}
+
+// loadSettings replaces the secrets of the configuration file path, and
+// loads its global tags, agent options and profiles.
+func (c *Config) loadSettings(path string, tbl *ast.Table) error {
+	if err := c.resolveSecrets(tbl); err != nil {
 		return fmt.Errorf("Error parsing %s, %s", path, err)
 	}
 
 	// Parse tags tables first:
 	for _, tableName := range []string{"tags", "global_tags"} {
 		if val, ok := tbl.Fields[tableName]; ok {
+			if tableName == "tags" {
+				c.addDeprecation("the [tags] table, use [global_tags]")
+			}
 			subTable, ok := val.(*ast.Table)
 			if !ok {
 				return fmt.Errorf("%s: invalid configuration", path)
 			}
-			if err = toml.UnmarshalTable(subTable, c.Tags); err != nil {
+			if err := toml.UnmarshalTable(subTable, c.Tags); err != nil {
 				log.Printf("E! Could not parse [global_tags] config\n")
 				return fmt.Errorf("Error parsing %s, %s", path, err)
 			}
@@ -586,13 +842,29 @@ func (c *Config) LoadConfig(path string) error {
 		if !ok {
 			return fmt.Errorf("%s: invalid configuration", path)
 		}
-		if err = toml.UnmarshalTable(subTable, c.Agent); err != nil {
+		c.checkDeprecated("agent", subTable)
+		if err := toml.UnmarshalTable(subTable, c.Agent); err != nil {
 			log.Printf("E! Could not parse [agent] config\n")
 			return fmt.Errorf("Error parsing %s, %s", path, err)
 		}
 	}
 
-	// Parse all the rest of the plugins:
+	// Parse profiles table, before the plugins enabled by them:
+	if val, ok := tbl.Fields["profiles"]; ok {
+		subTable, ok := val.(*ast.Table)
+		if !ok {
+			return fmt.Errorf("%s: invalid configuration", path)
+		}
+		if err := c.loadProfiles(subTable); err != nil {
+			return fmt.Errorf("Error parsing %s, %s", path, err)
+		}
+	}
+	return nil
+}
+
+// loadPlugins builds the plugins of the configuration file path.
+func (c *Config) loadPlugins(path string, tbl *ast.Table) error {
+	var err error
 	for name, val := range tbl.Fields {
 		subTable, ok := val.(*ast.Table)
 		if !ok {
@@ -600,19 +872,19 @@ func (c *Config) LoadConfig(path string) error {
 		}
 
 		switch name {
-		case "agent", "global_tags", "tags":
+		case "agent", "global_tags", "tags", "profiles", "secretstores":
 		case "outputs":
 			for pluginName, pluginVal := range subTable.Fields {
 				switch pluginSubTable := pluginVal.(type) {
 				// legacy [outputs.influxdb] support
 				case *ast.Table:
 					if err = c.addOutput(pluginName, pluginSubTable); err != nil {
-						return fmt.Errorf("Error parsing %s, %s", path, err)
+						return tableError(path, pluginSubTable, err)
 					}
 				case []*ast.Table:
 					for _, t := range pluginSubTable {
 						if err = c.addOutput(pluginName, t); err != nil {
-							return fmt.Errorf("Error parsing %s, %s", path, err)
+							return tableError(path, t, err)
 						}
 					}
 				default:
@@ -621,17 +893,20 @@ func (c *Config) LoadConfig(path string) error {
 				}
 			}
 		case "inputs", "plugins":
+			if name == "plugins" {
+				c.addDeprecation("the [plugins] table, use [inputs]")
+			}
 			for pluginName, pluginVal := range subTable.Fields {
 				switch pluginSubTable := pluginVal.(type) {
 				// legacy [inputs.cpu] support
 				case *ast.Table:
 					if err = c.addInput(pluginName, pluginSubTable); err != nil {
-						return fmt.Errorf("Error parsing %s, %s", path, err)
+						return tableError(path, pluginSubTable, err)
 					}
 				case []*ast.Table:
 					for _, t := range pluginSubTable {
 						if err = c.addInput(pluginName, t); err != nil {
-							return fmt.Errorf("Error parsing %s, %s", path, err)
+							return tableError(path, t, err)
 						}
 					}
 				default:
@@ -645,7 +920,7 @@ func (c *Config) LoadConfig(path string) error {
 				case []*ast.Table:
 					for _, t := range pluginSubTable {
 						if err = c.addProcessor(pluginName, t); err != nil {
-							return fmt.Errorf("Error parsing %s, %s", path, err)
+							return tableError(path, t, err)
 						}
 					}
 				default:
@@ -659,7 +934,7 @@ func (c *Config) LoadConfig(path string) error {
 				case []*ast.Table:
 					for _, t := range pluginSubTable {
 						if err = c.addAggregator(pluginName, t); err != nil {
-							return fmt.Errorf("Error parsing %s, %s", path, err)
+							return tableError(path, t, err)
 						}
 					}
 				default:
@@ -671,17 +946,40 @@ func (c *Config) LoadConfig(path string) error {
 		// identifiers are present
 		default:
 			if err = c.addInput(name, subTable); err != nil {
-				return fmt.Errorf("Error parsing %s, %s", path, err)
+				return tableError(path, subTable, err)
 			}
 		}
 	}
 
-	if len(c.Processors) > 1 {
-		sort.Sort(c.Processors)
-	}
 	return nil
 }
 
+// addDeprecation records and logs the use of a deprecated feature.
+func (c *Config) addDeprecation(msg string) {
+	log.Printf("W! DEPRECATED: %s", msg)
+	c.Deprecations = append(c.Deprecations, msg)
+}
+
+// checkDeprecated records the deprecated plugin and options of the table
+// of a plugin, named by its type and name, ie "inputs.statsd".
+func (c *Config) checkDeprecated(plugin string, tbl *ast.Table) {
+	if replacement, ok := deprecatedPlugins[plugin]; ok {
+		c.addDeprecation(fmt.Sprintf("%s, %s", plugin, replacement))
+	}
+	options := deprecatedOptions[plugin]
+	keys := make([]string, 0, len(options))
+	for option := range options {
+		keys = append(keys, option)
+	}
+	sort.Strings(keys)
+	for _, option := range keys {
+		if _, ok := tbl.Fields[option]; ok {
+			c.addDeprecation(fmt.Sprintf("%s option %s, %s", plugin, option,
+				options[option]))
+		}
+	}
+}
+
 // trimBOM trims the Byte-Order-Marks from the beginning of the file.
 // this is for Windows compatability only.
 // see https://github.com/influxdata/telegraf/issues/1378
@@ -693,6 +991,16 @@ func trimBOM(f []byte) []byte {
 // returns the AST produced from the TOML parser. When loading the file, it
 // will find environment variables and replace them.
 func parseFile(fpath string) (*ast.Table, error) {
+	contents, err := ExpandedFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	return toml.Parse(contents)
+}
+
+// ExpandedFile returns the contents of a configuration file with its
+// environment variables replaced, as parsed.
+func ExpandedFile(fpath string) ([]byte, error) {
 	contents, err := ioutil.ReadFile(fpath)
 	if err != nil {
 		return nil, err
@@ -700,18 +1008,73 @@ func parseFile(fpath string) (*ast.Table, error) {
 	// ugh windows why
 	contents = trimBOM(contents)
 
-	env_vars := envVarRe.FindAll(contents, -1)
-	for _, env_var := range env_vars {
-		env_val := os.Getenv(strings.TrimPrefix(string(env_var), "$"))
-		if env_val != "" {
-			contents = bytes.Replace(contents, env_var, []byte(env_val), 1)
+	return envVarRe.ReplaceAllFunc(contents, expandEnvVar), nil
+}
+
+// RedactedFile returns the contents of a configuration file with its
+// environment variables replaced, except in the options named like
+// passwords and secrets, and with the passwords of its URLs and DSNs
+// replaced by "******", to be printed.
+func RedactedFile(fpath string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	contents = trimBOM(contents)
+
+	var buf bytes.Buffer
+	// the option of the line, or of the multi-line array it continues
+	var key string
+	for _, line := range bytes.SplitAfter(contents, []byte("\n")) {
+		if m := optionLineRe.FindSubmatch(line); m != nil {
+			key = string(m[1])
+		} else if tableLineRe.Match(line) {
+			key = ""
 		}
+		if isRedacted(key) {
+			buf.Write(line)
+			continue
+		}
+		line = envVarRe.ReplaceAllFunc(line, expandEnvVar)
+		buf.Write(quotedRe.ReplaceAllFunc(line, func(q []byte) []byte {
+			quote := string(q[:1])
+			return []byte(quote + redactPasswords(string(q[1:len(q)-1])) + quote)
+		}))
 	}
+	return buf.Bytes(), nil
+}
 
-	return toml.Parse(contents)
+// tableError returns the error of the plugin table tbl of the file path,
+// with the line of the table unless the error has its own.
+func tableError(path string, tbl *ast.Table, err error) error {
+	if _, ok := err.(*toml.LineError); ok {
+		return fmt.Errorf("Error parsing %s, %s", path, err)
+	}
+	return fmt.Errorf("Error parsing %s, line %d: %s", path, tbl.Line, err)
+}
+
+// expandEnvVar returns the value of the environment variable v. An unset
+// ${VAR:-default} is replaced by its default, other unset variables are left
+// as is since $ is also used by some plugins, ie for regex groups.
+func expandEnvVar(v []byte) []byte {
+	m := envVarRe.FindSubmatch(v)
+	name := m[1]
+	if len(name) == 0 {
+		name = v[1:]
+	}
+	if val := os.Getenv(string(name)); val != "" {
+		return []byte(val)
+	}
+	if len(m[2]) > 0 {
+		return m[3]
+	}
+	return v
 }
 
 func (c *Config) addAggregator(name string, table *ast.Table) error {
+	if ok, err := c.enabled(table); !ok || err != nil {
+		return err
+	}
 	creator, ok := aggregators.Aggregators[name]
 	if !ok {
 		return fmt.Errorf("Undefined but requested aggregator: %s", name)
@@ -732,6 +1095,9 @@ func (c *Config) addAggregator(name string, table *ast.Table) error {
 }
 
 func (c *Config) addProcessor(name string, table *ast.Table) error {
+	if ok, err := c.enabled(table); !ok || err != nil {
+		return err
+	}
 	creator, ok := processors.Processors[name]
 	if !ok {
 		return fmt.Errorf("Undefined but requested processor: %s", name)
@@ -761,17 +1127,26 @@ func (c *Config) addOutput(name string, table *ast.Table) error {
 	if len(c.OutputFilters) > 0 && !sliceContains(name, c.OutputFilters) {
 		return nil
 	}
+	if ok, err := c.enabled(table); !ok || err != nil {
+		return err
+	}
+	// the options are consumed while the output is built
+	hash := tableHash(table)
 	creator, ok := outputs.Outputs[name]
 	if !ok {
 		return fmt.Errorf("Undefined but requested output: %s", name)
 	}
 	output := creator()
+	c.checkDeprecated("outputs."+name, table)
 
 	// If the output has a SetSerializer function, then this means it can write
 	// arbitrary types of output, so build the serializer and set it.
+	var serializerConfig *serializers.Config
 	switch t := output.(type) {
 	case serializers.SerializerOutput:
-		serializer, err := buildSerializer(name, table)
+		var serializer serializers.Serializer
+		var err error
+		serializerConfig, serializer, err = buildSerializer(name, table)
 		if err != nil {
 			return err
 		}
@@ -782,23 +1157,135 @@ func (c *Config) addOutput(name string, table *ast.Table) error {
 	if err != nil {
 		return err
 	}
+	outputConfig.Serializer = serializerConfig
 
 	if err := toml.UnmarshalTable(table, output); err != nil {
 		return err
 	}
+	if t, ok := output.(outputs.GlobalTagsOutput); ok {
+		t.SetGlobalTags(c.Tags)
+	}
 
 	ro := models.NewRunningOutput(name, output, outputConfig,
 		c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+	if c.Agent.MetricBufferSpillDirectory != "" {
+		file, id := spillIdentity(name, outputConfig.SpillName, hash)
+		if c.spillFiles == nil {
+			c.spillFiles = make(map[string]bool)
+		}
+		if c.spillFiles[file] {
+			return fmt.Errorf("Output %s: the buffer spill file %s is used by "+
+				"another output, set a distinct spill_name", name, file)
+		}
+		c.spillFiles[file] = true
+		spill := buffer.SpillConfig{
+			Path:    filepath.Join(c.Agent.MetricBufferSpillDirectory, file),
+			ID:      id,
+			Limit:   c.Agent.MetricBufferSpillLimit,
+			Persist: c.Agent.MetricBufferSpillPersist,
+		}
+		switch c.Agent.MetricBufferSpillDrop {
+		case "", "oldest":
+		case "newest":
+			spill.DropNewest = true
+		default:
+			return fmt.Errorf("Invalid metric_buffer_spill_drop %q, must be "+
+				"oldest or newest", c.Agent.MetricBufferSpillDrop)
+		}
+		ro.SpillToDisk(spill)
+	}
+	if outputConfig.Validate != "" {
+		v, err := buildValidator(outputConfig)
+		if err != nil {
+			return fmt.Errorf("Output %s: %s", name, err)
+		}
+		if err := ro.SetValidator(v, outputConfig.DeadLetterFile); err != nil {
+			return fmt.Errorf("Output %s: unable to open dead letter file: %s",
+				name, err)
+		}
+	}
 	c.Outputs = append(c.Outputs, ro)
 	return nil
 }
 
+// spillIdentity returns the name of the spill file of an output and the ID
+// written in its header. The output is identified by its spill_name, or else
+// by the hash of its options, rather than by its position in the
+// configuration.
+func spillIdentity(name, spillName, hash string) (string, string) {
+	if spillName != "" {
+		return fmt.Sprintf("%s-%s.spill", name, spillName),
+			fmt.Sprintf("outputs.%s spill_name %s", name, spillName)
+	}
+	return fmt.Sprintf("%s-%s.spill", name, hash[:16]),
+		fmt.Sprintf("outputs.%s sha256 %s", name, hash)
+}
+
+// tableHash returns the hex SHA-256 of the options of a table, independent
+// of their order and formatting. The values are hashed as written, before
+// their secrets are resolved.
+func tableHash(tbl *ast.Table) string {
+	h := sha256.New()
+	writeTable(h, tbl)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeTable(w io.Writer, tbl *ast.Table) {
+	keys := make([]string, 0, len(tbl.Fields))
+	for key := range tbl.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch v := tbl.Fields[key].(type) {
+		case *ast.KeyValue:
+			fmt.Fprintf(w, "%q=%s\n", key, v.Value.Source())
+		case *ast.Table:
+			fmt.Fprintf(w, "[%q]\n", key)
+			writeTable(w, v)
+			fmt.Fprintf(w, "[]\n")
+		case []*ast.Table:
+			for _, t := range v {
+				fmt.Fprintf(w, "[[%q]]\n", key)
+				writeTable(w, t)
+				fmt.Fprintf(w, "[]\n")
+			}
+		}
+	}
+}
+
+// buildValidator returns the validator of the metrics of an output. The JSON
+// documents validated against the schema have the timestamp units of the
+// serializer of the output, seconds by default.
+func buildValidator(oc *models.OutputConfig) (models.Validator, error) {
+	if oc.Validate == "line_protocol" {
+		return &models.LineProtocolValidator{}, nil
+	}
+	data, err := ioutil.ReadFile(oc.ValidateSchema)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := jsonschema.Compile(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %s", oc.ValidateSchema, err)
+	}
+	serializer := &json.JsonSerializer{}
+	if oc.Serializer != nil {
+		serializer.TimestampUnits = oc.Serializer.TimestampUnits
+	}
+	return &models.JSONSchemaValidator{Schema: schema, Serializer: serializer}, nil
+}
+
 func (c *Config) addInput(name string, table *ast.Table) error {
 	if len(c.InputFilters) > 0 && !sliceContains(name, c.InputFilters) {
 		return nil
 	}
+	if ok, err := c.enabled(table); !ok || err != nil {
+		return err
+	}
 	// Legacy support renaming io input to diskio
 	if name == "io" {
+		c.addDeprecation("inputs.io, use inputs.diskio")
 		name = "diskio"
 	}
 
@@ -807,6 +1294,7 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 		return fmt.Errorf("Undefined but requested input: %s", name)
 	}
 	input := creator()
+	c.checkDeprecated("inputs."+name, table)
 
 	// If the input has a SetParser function, then this means it can accept
 	// arbitrary types of input, so build the parser and set it.
@@ -819,6 +1307,15 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 		t.SetParser(parser)
 	}
 
+	var subParsers []parsers.Parser
+	if t, ok := input.(parsers.SubParserInput); ok {
+		var err error
+		subParsers, err = buildSubParsers(name, t.ParserTable(), table)
+		if err != nil {
+			return err
+		}
+	}
+
 	pluginConfig, err := buildInput(name, table)
 	if err != nil {
 		return err
@@ -827,6 +1324,9 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 	if err := toml.UnmarshalTable(table, input); err != nil {
 		return err
 	}
+	if t, ok := input.(parsers.SubParserInput); ok {
+		t.SetSubParsers(subParsers)
+	}
 
 	rp := models.NewRunningInput(input, pluginConfig)
 	c.Inputs = append(c.Inputs, rp)
@@ -1126,6 +1626,19 @@ func buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
 		}
 	}
 
+	if node, ok := tbl.Fields["collection_jitter"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				dur, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, err
+				}
+
+				cp.CollectionJitter = dur
+			}
+		}
+	}
+
 	if node, ok := tbl.Fields["name_prefix"]; ok {
 		if kv, ok := node.(*ast.KeyValue); ok {
 			if str, ok := kv.Value.(*ast.String); ok {
@@ -1163,6 +1676,7 @@ func buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
 	delete(tbl.Fields, "name_suffix")
 	delete(tbl.Fields, "name_override")
 	delete(tbl.Fields, "interval")
+	delete(tbl.Fields, "collection_jitter")
 	delete(tbl.Fields, "tags")
 	var err error
 	cp.Filter, err = buildFilter(tbl)
@@ -1172,6 +1686,28 @@ func buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
 	return cp, nil
 }
 
+// buildSubParsers builds the parsers of the sub-tables sub of an input, in
+// order. The parser of a sub-table without data_format is nil, the input
+// uses its own.
+func buildSubParsers(name, sub string, tbl *ast.Table) ([]parsers.Parser, error) {
+	subTables, ok := tbl.Fields[sub].([]*ast.Table)
+	if !ok {
+		return nil, nil
+	}
+	subParsers := make([]parsers.Parser, len(subTables))
+	for i, subTable := range subTables {
+		if _, ok := subTable.Fields["data_format"]; !ok {
+			continue
+		}
+		parser, err := buildParser(name, subTable)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %s", name, sub, err)
+		}
+		subParsers[i] = parser
+	}
+	return subParsers, nil
+}
+
 // buildParser grabs the necessary entries from the ast.Table for creating
 // a parsers.Parser object, and creates it, which can then be added onto
 // an Input object.
@@ -1225,6 +1761,42 @@ func buildParser(name string, tbl *ast.Table) (parsers.Parser, error) {
 		}
 	}
 
+	if node, ok := tbl.Fields["json_query"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				c.JSONQuery = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["json_string_fields"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if ary, ok := kv.Value.(*ast.Array); ok {
+				for _, elem := range ary.Value {
+					if str, ok := elem.(*ast.String); ok {
+						c.JSONStringFields = append(c.JSONStringFields, str.Value)
+					}
+				}
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["json_time_key"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				c.JSONTimeKey = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["json_time_format"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				c.JSONTimeFormat = str.Value
+			}
+		}
+	}
+
 	if node, ok := tbl.Fields["data_type"]; ok {
 		if kv, ok := node.(*ast.KeyValue); ok {
 			if str, ok := kv.Value.(*ast.String); ok {
@@ -1261,24 +1833,164 @@ func buildParser(name string, tbl *ast.Table) (parsers.Parser, error) {
 		}
 	}
 
+	if node, ok := tbl.Fields["csv_column_names"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if ary, ok := kv.Value.(*ast.Array); ok {
+				for _, elem := range ary.Value {
+					if str, ok := elem.(*ast.String); ok {
+						c.CSVColumnNames = append(c.CSVColumnNames, str.Value)
+					}
+				}
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["csv_column_types"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if ary, ok := kv.Value.(*ast.Array); ok {
+				for _, elem := range ary.Value {
+					if str, ok := elem.(*ast.String); ok {
+						c.CSVColumnTypes = append(c.CSVColumnTypes, str.Value)
+					}
+				}
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["csv_comment"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				c.CSVComment = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["csv_delimiter"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				c.CSVDelimiter = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["csv_header_row_count"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if integer, ok := kv.Value.(*ast.Integer); ok {
+				v, err := strconv.Atoi(integer.Value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid csv_header_row_count: %s", err)
+				}
+				c.CSVHeaderRowCount = v
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["csv_measurement_column"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				c.CSVMeasurementColumn = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["csv_skip_columns"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if integer, ok := kv.Value.(*ast.Integer); ok {
+				v, err := strconv.Atoi(integer.Value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid csv_skip_columns: %s", err)
+				}
+				c.CSVSkipColumns = v
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["csv_skip_rows"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if integer, ok := kv.Value.(*ast.Integer); ok {
+				v, err := strconv.Atoi(integer.Value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid csv_skip_rows: %s", err)
+				}
+				c.CSVSkipRows = v
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["csv_tag_columns"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if ary, ok := kv.Value.(*ast.Array); ok {
+				for _, elem := range ary.Value {
+					if str, ok := elem.(*ast.String); ok {
+						c.CSVTagColumns = append(c.CSVTagColumns, str.Value)
+					}
+				}
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["csv_timestamp_column"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				c.CSVTimestampColumn = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["csv_timestamp_format"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				c.CSVTimestampFormat = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["csv_trim_space"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if b, ok := kv.Value.(*ast.Boolean); ok {
+				v, err := strconv.ParseBool(b.Value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid csv_trim_space: %s", err)
+				}
+				c.CSVTrimSpace = v
+			}
+		}
+	}
+
 	c.MetricName = name
 
 	delete(tbl.Fields, "data_format")
 	delete(tbl.Fields, "separator")
 	delete(tbl.Fields, "templates")
 	delete(tbl.Fields, "tag_keys")
+	delete(tbl.Fields, "json_query")
+	delete(tbl.Fields, "json_string_fields")
+	delete(tbl.Fields, "json_time_key")
+	delete(tbl.Fields, "json_time_format")
 	delete(tbl.Fields, "data_type")
 	delete(tbl.Fields, "collectd_auth_file")
 	delete(tbl.Fields, "collectd_security_level")
 	delete(tbl.Fields, "collectd_typesdb")
+	delete(tbl.Fields, "csv_column_names")
+	delete(tbl.Fields, "csv_column_types")
+	delete(tbl.Fields, "csv_comment")
+	delete(tbl.Fields, "csv_delimiter")
+	delete(tbl.Fields, "csv_header_row_count")
+	delete(tbl.Fields, "csv_measurement_column")
+	delete(tbl.Fields, "csv_skip_columns")
+	delete(tbl.Fields, "csv_skip_rows")
+	delete(tbl.Fields, "csv_tag_columns")
+	delete(tbl.Fields, "csv_timestamp_column")
+	delete(tbl.Fields, "csv_timestamp_format")
+	delete(tbl.Fields, "csv_trim_space")
 
 	return parsers.NewParser(c)
 }
 
 // buildSerializer grabs the necessary entries from the ast.Table for creating
 // a serializers.Serializer object, and creates it, which can then be added onto
-// an Output object.
-func buildSerializer(name string, tbl *ast.Table) (serializers.Serializer, error) {
+// an Output object. The configuration of the serializer is returned with it.
+func buildSerializer(name string, tbl *ast.Table) (*serializers.Config, serializers.Serializer, error) {
 	c := &serializers.Config{TimestampUnits: time.Duration(1 * time.Second)}
 
 	if node, ok := tbl.Fields["data_format"]; ok {
@@ -1314,7 +2026,7 @@ func buildSerializer(name string, tbl *ast.Table) (serializers.Serializer, error
 			if str, ok := kv.Value.(*ast.String); ok {
 				timestampVal, err := time.ParseDuration(str.Value)
 				if err != nil {
-					return nil, fmt.Errorf("Unable to parse json_timestamp_units as a duration, %s", err)
+					return nil, nil, fmt.Errorf("Unable to parse json_timestamp_units as a duration, %s", err)
 				}
 				// now that we have a duration, truncate it to the nearest
 				// power of ten (just in case)
@@ -1325,11 +2037,25 @@ func buildSerializer(name string, tbl *ast.Table) (serializers.Serializer, error
 		}
 	}
 
+	if node, ok := tbl.Fields["influx_uint_support"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if b, ok := kv.Value.(*ast.Boolean); ok {
+				var err error
+				c.InfluxUintSupport, err = strconv.ParseBool(b.Value)
+				if err != nil {
+					return nil, nil, fmt.Errorf("Unable to parse influx_uint_support as a boolean, %s", err)
+				}
+			}
+		}
+	}
+
 	delete(tbl.Fields, "data_format")
 	delete(tbl.Fields, "prefix")
 	delete(tbl.Fields, "template")
 	delete(tbl.Fields, "json_timestamp_units")
-	return serializers.NewSerializer(c)
+	delete(tbl.Fields, "influx_uint_support")
+	serializer, err := serializers.NewSerializer(c)
+	return c, serializer, err
 }
 
 // buildOutput parses output specific items from the ast.Table,
@@ -1342,9 +2068,92 @@ func buildOutput(name string, tbl *ast.Table) (*models.OutputConfig, error) {
 		return nil, err
 	}
 	oc := &models.OutputConfig{
-		Name:   name,
-		Filter: filter,
+		Name:           name,
+		Filter:         filter,
+		DeliveryPolicy: models.DeliveryAtLeastOnce,
+	}
+
+	if node, ok := tbl.Fields["delivery_policy"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				oc.DeliveryPolicy = str.Value
+			}
+		}
+	}
+	switch oc.DeliveryPolicy {
+	case models.DeliveryAtLeastOnce, models.DeliveryAtMostOnce:
+	default:
+		return nil, fmt.Errorf("Output %s: invalid delivery_policy %q",
+			name, oc.DeliveryPolicy)
+	}
+	delete(tbl.Fields, "delivery_policy")
+
+	for key, value := range map[string]*string{
+		"validate":         &oc.Validate,
+		"validate_schema":  &oc.ValidateSchema,
+		"dead_letter_file": &oc.DeadLetterFile,
+		"spill_name":       &oc.SpillName,
+	} {
+		if node, ok := tbl.Fields[key]; ok {
+			if kv, ok := node.(*ast.KeyValue); ok {
+				if str, ok := kv.Value.(*ast.String); ok {
+					*value = str.Value
+				}
+			}
+		}
+		delete(tbl.Fields, key)
+	}
+	switch oc.Validate {
+	case "", "line_protocol":
+	case "json_schema":
+		if oc.ValidateSchema == "" {
+			return nil, fmt.Errorf("Output %s: validate_schema is required "+
+				"with validate = \"json_schema\"", name)
+		}
+	default:
+		return nil, fmt.Errorf("Output %s: invalid validate %q", name, oc.Validate)
+	}
+	if oc.SpillName != "" && !spillNameRe.MatchString(oc.SpillName) {
+		return nil, fmt.Errorf("Output %s: invalid spill_name %q, only letters, "+
+			"digits, '.', '_' and '-' are allowed", name, oc.SpillName)
+	}
+
+	shard := &models.Shard{}
+	if node, ok := tbl.Fields["shard_tag"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				shard.Tag = str.Value
+			}
+		}
 	}
+	if node, ok := tbl.Fields["shards"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if ary, ok := kv.Value.(*ast.Array); ok {
+				for _, elem := range ary.Value {
+					if str, ok := elem.(*ast.String); ok {
+						shard.Shards = append(shard.Shards, str.Value)
+					}
+				}
+			}
+		}
+	}
+	if node, ok := tbl.Fields["shard"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				shard.Name = str.Value
+			}
+		}
+	}
+	if shard.Tag != "" || len(shard.Shards) > 0 || shard.Name != "" {
+		if err := shard.Validate(); err != nil {
+			return nil, fmt.Errorf("Output %s: %s", name, err)
+		}
+		oc.Shard = shard
+	}
+	delete(tbl.Fields, "shard_tag")
+	delete(tbl.Fields, "shards")
+	delete(tbl.Fields, "shard")
+
 	// Outputs don't support FieldDrop/FieldPass, so set to NameDrop/NamePass
 	if len(oc.Filter.FieldDrop) > 0 {
 		oc.Filter.NameDrop = oc.Filter.FieldDrop
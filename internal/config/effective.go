@@ -0,0 +1,404 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/models"
+)
+
+// redactedKeys are the parts of the option names whose values are not
+// printed.
+var redactedKeys = []string{"password", "secret", "token", "api_key", "apikey",
+	"access_key", "credentials", "private_key"}
+
+var (
+	// userinfoRe matches the user and password of a URL, or of a DSN such
+	// as user:password@tcp(host)/db.
+	userinfoRe = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*://)?([^:/@\s]*):[^@\s]*@`)
+	// dsnPasswordRe matches the password of a DSN of key=value pairs, such
+	// as host=db password=secret or Server=db;Password=secret.
+	dsnPasswordRe = regexp.MustCompile(`(?i)\b(password|pwd)(\s*=\s*)('[^']*'|[^\s;]*)`)
+)
+
+// EffectiveConfig returns the loaded configuration as TOML, with the value
+// every option of the agent and of the plugins resolved to, including the
+// default values of the options that are not set. The deprecated options
+// are listed at the top, the values of the passwords and secrets, the values
+// resolved from the secret stores whatever their option, and the passwords
+// of the URLs and DSNs, are replaced by "******".
+func (c *Config) EffectiveConfig() string {
+	var buf bytes.Buffer
+
+	buf.WriteString("# Effective Telegraf configuration\n")
+	for _, d := range c.Deprecations {
+		buf.WriteString("# DEPRECATED: " + d + "\n")
+	}
+
+	buf.WriteString("\n[global_tags]\n")
+	writeMap(&buf, "  ", reflect.ValueOf(c.Tags))
+
+	agent := *c.Agent
+	if agent.MetricBatchSize == 0 {
+		agent.MetricBatchSize = models.DEFAULT_METRIC_BATCH_SIZE
+	}
+	if agent.MetricBufferLimit == 0 {
+		agent.MetricBufferLimit = models.DEFAULT_METRIC_BUFFER_LIMIT
+	}
+	buf.WriteString("\n[agent]\n")
+	writeStruct(&buf, "agent", reflect.ValueOf(agent))
+
+	for _, p := range c.Processors {
+		table := "processors." + p.Name
+		buf.WriteString("\n[[" + table + "]]\n")
+		writeOption(&buf, "order", p.Config.Order)
+		writeFilter(&buf, p.Config.Filter)
+		writeStruct(&buf, table, reflect.ValueOf(p.Processor))
+		writeTagFilters(&buf, table, p.Config.Filter)
+	}
+
+	for _, a := range c.Aggregators {
+		table := "aggregators." + a.Config.Name
+		buf.WriteString("\n[[" + table + "]]\n")
+		writeOption(&buf, "period", a.Config.Period)
+		writeOption(&buf, "delay", a.Config.Delay)
+		writeOption(&buf, "drop_original", a.Config.DropOriginal)
+		writeOption(&buf, "name_override", a.Config.NameOverride)
+		writeOption(&buf, "name_prefix", a.Config.MeasurementPrefix)
+		writeOption(&buf, "name_suffix", a.Config.MeasurementSuffix)
+		writeFilter(&buf, a.Config.Filter)
+		writeStruct(&buf, table, reflect.ValueOf(a.Aggregator()))
+		writeTagFilters(&buf, table, a.Config.Filter)
+		writeTags(&buf, table, a.Config.Tags)
+	}
+
+	for _, i := range c.Inputs {
+		table := "inputs." + i.Config.Name
+		interval := i.Config.Interval
+		if interval == 0 {
+			interval = c.Agent.Interval.Duration
+		}
+		jitter := i.Config.CollectionJitter
+		if jitter == 0 {
+			jitter = c.Agent.CollectionJitter.Duration
+		}
+		buf.WriteString("\n[[" + table + "]]\n")
+		writeOption(&buf, "interval", interval)
+		writeOption(&buf, "collection_jitter", jitter)
+		writeOption(&buf, "name_override", i.Config.NameOverride)
+		writeOption(&buf, "name_prefix", i.Config.MeasurementPrefix)
+		writeOption(&buf, "name_suffix", i.Config.MeasurementSuffix)
+		writeFilter(&buf, i.Config.Filter)
+		writeStruct(&buf, table, reflect.ValueOf(i.Input))
+		writeTagFilters(&buf, table, i.Config.Filter)
+		writeTags(&buf, table, i.Config.Tags)
+	}
+
+	for _, o := range c.Outputs {
+		table := "outputs." + o.Config.Name
+		buf.WriteString("\n[[" + table + "]]\n")
+		writeOption(&buf, "delivery_policy", o.Config.DeliveryPolicy)
+		if o.Config.Validate != "" {
+			writeOption(&buf, "validate", o.Config.Validate)
+			writeOption(&buf, "validate_schema", o.Config.ValidateSchema)
+			writeOption(&buf, "dead_letter_file", o.Config.DeadLetterFile)
+		}
+		if s := o.Config.Shard; s != nil {
+			writeOption(&buf, "shard_tag", s.Tag)
+			writeOption(&buf, "shards", s.Shards)
+			writeOption(&buf, "shard", s.Name)
+		}
+		if s := o.Config.Serializer; s != nil {
+			writeOption(&buf, "data_format", s.DataFormat)
+			switch s.DataFormat {
+			case "influx":
+				writeOption(&buf, "influx_uint_support", s.InfluxUintSupport)
+			case "graphite":
+				writeOption(&buf, "prefix", s.Prefix)
+				writeOption(&buf, "template", s.Template)
+			case "json":
+				writeOption(&buf, "json_timestamp_units", s.TimestampUnits)
+			}
+		}
+		writeFilter(&buf, o.Config.Filter)
+		writeStruct(&buf, table, reflect.ValueOf(o.Output))
+		writeTagFilters(&buf, table, o.Config.Filter)
+	}
+	return redactSecrets(buf.String(), c.Secrets.Values())
+}
+
+func writeOption(buf *bytes.Buffer, key string, v interface{}) {
+	if s, ok := formatValue(key, reflect.ValueOf(v)); ok {
+		buf.WriteString("  " + key + " = " + s + "\n")
+	}
+}
+
+func writeFilter(buf *bytes.Buffer, f models.Filter) {
+	lists := []struct {
+		key  string
+		list []string
+	}{
+		{"namepass", f.NamePass},
+		{"namedrop", f.NameDrop},
+		{"fieldpass", f.FieldPass},
+		{"fielddrop", f.FieldDrop},
+		{"taginclude", f.TagInclude},
+		{"tagexclude", f.TagExclude},
+	}
+	for _, l := range lists {
+		if len(l.list) > 0 {
+			writeOption(buf, l.key, l.list)
+		}
+	}
+}
+
+// writeTagFilters writes the tagpass and tagdrop sub-tables, after the
+// options of the plugin.
+func writeTagFilters(buf *bytes.Buffer, table string, f models.Filter) {
+	for _, name := range []string{"tagpass", "tagdrop"} {
+		filters := f.TagPass
+		if name == "tagdrop" {
+			filters = f.TagDrop
+		}
+		if len(filters) == 0 {
+			continue
+		}
+		buf.WriteString("  [" + table + "." + name + "]\n")
+		for _, tf := range filters {
+			s, _ := formatValue(tf.Name, reflect.ValueOf(tf.Filter))
+			buf.WriteString("    " + strconv.Quote(tf.Name) + " = " + s + "\n")
+		}
+	}
+}
+
+func writeTags(buf *bytes.Buffer, table string, tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+	buf.WriteString("  [" + table + ".tags]\n")
+	writeMap(buf, "    ", reflect.ValueOf(tags))
+}
+
+// writeStruct writes the options of a plugin: its exported fields, named
+// after their toml tag or in snake case. The fields holding structs of
+// telegraf packages are written as sub-tables, the fields whose type cannot
+// be set in the configuration are skipped.
+func writeStruct(buf *bytes.Buffer, table string, v reflect.Value) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	depth := strings.Count(table, ".")
+	if depth == 0 {
+		// the options of the agent are indented like the plugins'
+		depth = 1
+	}
+
+	// sub-tables must follow the options of the table
+	var tables []func()
+	writeFields(buf, table, strings.Repeat("  ", depth), v, deprecatedOptions[table], &tables)
+	for _, write := range tables {
+		write()
+	}
+}
+
+// writeFields writes the options of the fields of v, and appends the
+// writers of its sub-tables to tables. The fields of embedded structs are
+// written as the fields of v. The deprecated options are only written when
+// they are set.
+func writeFields(
+	buf *bytes.Buffer,
+	table, indent string,
+	v reflect.Value,
+	deprecated map[string]string,
+	tables *[]func(),
+) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		key := f.Tag.Get("toml")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = internal.SnakeCase(f.Name)
+		}
+		fv := v.Field(i)
+		if _, ok := deprecated[key]; ok &&
+			reflect.DeepEqual(fv.Interface(), reflect.Zero(fv.Type()).Interface()) {
+			continue
+		}
+
+		if f.Anonymous && fv.Kind() == reflect.Struct && isConfigStruct(fv.Type()) {
+			writeFields(buf, table, indent, fv, deprecated, tables)
+			continue
+		}
+		if s, ok := formatValue(key, fv); ok {
+			buf.WriteString(indent + key + " = " + s + "\n")
+			continue
+		}
+
+		sub := table + "." + key
+		switch {
+		case isConfigStruct(fv.Type()):
+			*tables = append(*tables, func() {
+				if fv.Kind() == reflect.Ptr && fv.IsNil() {
+					return
+				}
+				buf.WriteString(indent + "[" + sub + "]\n")
+				writeStruct(buf, sub, fv)
+			})
+		case fv.Kind() == reflect.Slice && isConfigStruct(fv.Type().Elem()):
+			*tables = append(*tables, func() {
+				for j := 0; j < fv.Len(); j++ {
+					buf.WriteString(indent + "[[" + sub + "]]\n")
+					writeStruct(buf, sub, fv.Index(j))
+				}
+			})
+		case fv.Kind() == reflect.Map:
+			*tables = append(*tables, func() {
+				if fv.Len() == 0 {
+					return
+				}
+				buf.WriteString(indent + "[" + sub + "]\n")
+				writeMap(buf, indent+"  ", fv)
+			})
+		}
+	}
+}
+
+// isConfigStruct returns whether t is a struct, or a pointer to a struct,
+// of a telegraf package, which are the only ones written as sub-tables.
+func isConfigStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct &&
+		t != reflect.TypeOf(internal.Duration{}) &&
+		strings.HasPrefix(t.PkgPath(), "github.com/influxdata/telegraf")
+}
+
+func writeMap(buf *bytes.Buffer, indent string, v reflect.Value) {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	for _, k := range keys {
+		key := fmt.Sprint(k.Interface())
+		if s, ok := formatValue(key, v.MapIndex(k)); ok {
+			buf.WriteString(indent + strconv.Quote(key) + " = " + s + "\n")
+		}
+	}
+}
+
+// formatValue returns the TOML representation of a value, or false if it
+// is not a scalar or an array of scalars.
+func formatValue(key string, v reflect.Value) (string, bool) {
+	if !v.IsValid() {
+		return "", false
+	}
+	switch x := v.Interface().(type) {
+	case internal.Duration:
+		return strconv.Quote(x.Duration.String()), true
+	case time.Duration:
+		return strconv.Quote(x.String()), true
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if v.String() != "" && isRedacted(key) {
+			return `"******"`, true
+		}
+		return strconv.Quote(redactPasswords(v.String())), true
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		s := strconv.FormatFloat(v.Float(), 'f', -1, 64)
+		if !strings.ContainsAny(s, ".IN") {
+			// an integer would not be decoded in a float
+			s += ".0"
+		}
+		return s, true
+	case reflect.Slice, reflect.Array:
+		if !isScalar(v.Type().Elem()) {
+			return "", false
+		}
+		elems := make([]string, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s, ok := formatValue(key, v.Index(i))
+			if !ok {
+				return "", false
+			}
+			elems[i] = s
+		}
+		return "[" + strings.Join(elems, ", ") + "]", true
+	}
+	return "", false
+}
+
+// isScalar returns whether the values of type t are written by
+// formatValue.
+func isScalar(t reflect.Type) bool {
+	switch t {
+	case reflect.TypeOf(internal.Duration{}), reflect.TypeOf(time.Duration(0)):
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice, reflect.Array:
+		return isScalar(t.Elem())
+	}
+	return false
+}
+
+// redactPasswords replaces the password of a URL or DSN by "******".
+func redactPasswords(s string) string {
+	s = userinfoRe.ReplaceAllString(s, "${1}${2}:******@")
+	return dsnPasswordRe.ReplaceAllString(s, "${1}${2}******")
+}
+
+// redactSecrets replaces the quoted values of config equal to one of the
+// secrets, as they are written with or without their password redacted.
+func redactSecrets(config string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		config = strings.Replace(config, strconv.Quote(secret), `"******"`, -1)
+		config = strings.Replace(config, strconv.Quote(redactPasswords(secret)), `"******"`, -1)
+	}
+	return config
+}
+
+func isRedacted(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range redactedKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
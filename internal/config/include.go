@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/influxdata/toml/ast"
+)
+
+// parseIncludes parses the files of the include option of the
+// configuration file path. An include is a file, a directory whose .conf
+// files are parsed in lexical order, or a glob whose matches are parsed in
+// lexical order. Relative includes are relative to the directory of path.
+func (c *Config) parseIncludes(path string, includes []string) ([]configFile, error) {
+	var files []configFile
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+
+		var paths []string
+		if strings.ContainsAny(include, "*?[") {
+			matches, err := filepath.Glob(include)
+			if err != nil {
+				return nil, fmt.Errorf("invalid include %s: %s", include, err)
+			}
+			sort.Strings(matches)
+			paths = matches
+		} else {
+			paths = []string{include}
+		}
+
+		for _, p := range paths {
+			info, err := os.Stat(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid include: %s", err)
+			}
+			confs := []string{p}
+			if info.IsDir() {
+				if confs, err = directoryFiles(p); err != nil {
+					return nil, err
+				}
+			}
+			for _, conf := range confs {
+				included, err := c.parseFiles(conf)
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, included...)
+			}
+		}
+	}
+	return files, nil
+}
+
+// enterFile records that the configuration file path is being loaded, to
+// detect include cycles. The returned function must be called once it is
+// loaded.
+func (c *Config) enterFile(path string) (func(), error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if c.loading == nil {
+		c.loading = make(map[string]bool)
+	}
+	if c.loading[abs] {
+		return nil, fmt.Errorf("%s includes itself", path)
+	}
+	c.loading[abs] = true
+	return func() { delete(c.loading, abs) }, nil
+}
+
+// includeOption returns and removes the include option of the top level
+// table of a configuration file.
+func includeOption(tbl *ast.Table) []string {
+	includes := stringArray(tbl, "include")
+	delete(tbl.Fields, "include")
+	return includes
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/toml"
+	"github.com/influxdata/toml/ast"
+)
+
+// profile is a [profiles.<name>] table, the profile is active when all its
+// conditions match.
+type profile struct {
+	EnabledWhen []string `toml:"enabled_when"`
+}
+
+// loadProfiles evaluates the profiles of the [profiles] table.
+func (c *Config) loadProfiles(tbl *ast.Table) error {
+	if c.profiles == nil {
+		c.profiles = make(map[string]bool)
+	}
+	for name, val := range tbl.Fields {
+		subTable, ok := val.(*ast.Table)
+		if !ok {
+			return fmt.Errorf("invalid profile %s", name)
+		}
+		var p profile
+		if err := toml.UnmarshalTable(subTable, &p); err != nil {
+			return fmt.Errorf("invalid profile %s: %s", name, err)
+		}
+		active, err := c.matchConditions(p.EnabledWhen)
+		if err != nil {
+			return fmt.Errorf("invalid profile %s: %s", name, err)
+		}
+		c.profiles[name] = active
+	}
+	return nil
+}
+
+// enabled returns whether the plugin of the table is enabled by its
+// profiles and enabled_when options, which are removed from the table. A
+// plugin with profiles is enabled if one of them is active, and with
+// enabled_when if all its conditions match.
+func (c *Config) enabled(tbl *ast.Table) (bool, error) {
+	profiles := stringArray(tbl, "profiles")
+	conditions := stringArray(tbl, "enabled_when")
+	delete(tbl.Fields, "profiles")
+	delete(tbl.Fields, "enabled_when")
+
+	if len(profiles) > 0 {
+		active := false
+		for _, name := range profiles {
+			a, ok := c.profiles[name]
+			if !ok {
+				return false, fmt.Errorf("undefined profile %s", name)
+			}
+			active = active || a
+		}
+		if !active {
+			return false, nil
+		}
+	}
+	return c.matchConditions(conditions)
+}
+
+// matchConditions returns whether all the conditions match. A condition is
+// "hostname=<glob>" or "env.<variable>=<glob>", or the same with != to
+// match the values not matching the glob. Unset variables are empty.
+func (c *Config) matchConditions(conditions []string) (bool, error) {
+	for _, cond := range conditions {
+		i := strings.Index(cond, "=")
+		if i <= 0 {
+			return false, fmt.Errorf("invalid condition %q", cond)
+		}
+		key, pattern := strings.TrimSpace(cond[:i]), strings.TrimSpace(cond[i+1:])
+		negate := strings.HasSuffix(key, "!")
+		key = strings.TrimSpace(strings.TrimSuffix(key, "!"))
+
+		var value string
+		switch {
+		case key == "hostname":
+			value = c.Agent.Hostname
+			if value == "" {
+				hostname, err := os.Hostname()
+				if err != nil {
+					return false, err
+				}
+				value = hostname
+			}
+		case strings.HasPrefix(key, "env.") && len(key) > len("env."):
+			value = os.Getenv(strings.TrimPrefix(key, "env."))
+		default:
+			return false, fmt.Errorf("invalid condition %q, must be on "+
+				"hostname or env.<variable>", cond)
+		}
+
+		f, err := filter.Compile([]string{pattern})
+		if err != nil {
+			return false, fmt.Errorf("invalid condition %q: %s", cond, err)
+		}
+		if f.Match(value) == negate {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// stringArray returns the strings of the array option key of the table.
+func stringArray(tbl *ast.Table, key string) []string {
+	var out []string
+	if node, ok := tbl.Fields[key]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if ary, ok := kv.Value.(*ast.Array); ok {
+				for _, elem := range ary.Value {
+					if str, ok := elem.(*ast.String); ok {
+						out = append(out, str.Value)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
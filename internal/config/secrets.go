@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/influxdata/telegraf/internal/secret"
+	"github.com/influxdata/toml"
+	"github.com/influxdata/toml/ast"
+)
+
+// loadSecretStores configures the secret stores of the [secretstores]
+// table, whose options may reference the env and file stores.
+func (c *Config) loadSecretStores(tbl *ast.Table) error {
+	for name, val := range tbl.Fields {
+		subTable, ok := val.(*ast.Table)
+		if !ok {
+			return fmt.Errorf("invalid secret store %s", name)
+		}
+		creator, ok := secret.Stores[name]
+		if !ok {
+			return fmt.Errorf("Undefined but requested secret store: %s", name)
+		}
+		if err := c.resolveSecrets(subTable); err != nil {
+			return err
+		}
+		store := creator()
+		if err := toml.UnmarshalTable(subTable, store); err != nil {
+			return fmt.Errorf("invalid secret store %s: %s", name, err)
+		}
+		c.Secrets.AddStore(name, store)
+	}
+	return nil
+}
+
+// resolveSecrets replaces the strings of the value v of a configuration,
+// and of its tables and arrays, which reference a secret by the secret.
+func (c *Config) resolveSecrets(v interface{}) error {
+	switch v := v.(type) {
+	case *ast.Table:
+		for _, field := range v.Fields {
+			if err := c.resolveSecrets(field); err != nil {
+				return err
+			}
+		}
+	case []*ast.Table:
+		for _, t := range v {
+			if err := c.resolveSecrets(t); err != nil {
+				return err
+			}
+		}
+	case *ast.KeyValue:
+		return c.resolveSecrets(v.Value)
+	case *ast.Array:
+		for _, elem := range v.Value {
+			if err := c.resolveSecrets(elem); err != nil {
+				return err
+			}
+		}
+	case *ast.String:
+		if !secret.IsReference(v.Value) {
+			return nil
+		}
+		value, err := c.Secrets.Resolve(v.Value)
+		if err != nil {
+			return err
+		}
+		v.Value = value
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"log"
 	"math/big"
@@ -155,6 +156,46 @@ func GetTLSConfig(
 	return t, nil
 }
 
+// GetServerTLSConfig gets a tls.Config to terminate TLS on a listener. If
+// SSLAllowedClientCAs is set, clients must present a certificate signed by
+// one of these CAs.
+func GetServerTLSConfig(
+	SSLCert, SSLKey string,
+	SSLAllowedClientCAs []string,
+) (*tls.Config, error) {
+	if SSLCert == "" && SSLKey == "" && len(SSLAllowedClientCAs) == 0 {
+		return nil, nil
+	}
+	if SSLCert == "" || SSLKey == "" {
+		return nil, errors.New("both a TLS key and certificate are required")
+	}
+
+	cert, err := tls.LoadX509KeyPair(SSLCert, SSLKey)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Could not load TLS server key/certificate from %s:%s: %s",
+			SSLKey, SSLCert, err)
+	}
+	t := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if len(SSLAllowedClientCAs) > 0 {
+		caCertPool := x509.NewCertPool()
+		for _, ca := range SSLAllowedClientCAs {
+			caCert, err := ioutil.ReadFile(ca)
+			if err != nil {
+				return nil, fmt.Errorf("Could not load TLS client CA: %s", err)
+			}
+			caCertPool.AppendCertsFromPEM(caCert)
+		}
+		t.ClientCAs = caCertPool
+		t.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return t, nil
+}
+
 // SnakeCase converts the given string to snake case following the Golang format:
 // acronyms are converted to lower-case and preceded by an underscore.
 func SnakeCase(in string) string {
@@ -217,6 +258,31 @@ func WaitTimeout(c *exec.Cmd, timeout time.Duration) error {
 	}
 }
 
+// StaggerOffset returns an offset within interval derived from the hash of
+// key, so that a given key always gets the same offset.
+func StaggerOffset(key string, interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+// Sleep sleeps for d. If the shutdown channel is closed, it returns before
+// it has finished sleeping.
+func Sleep(d time.Duration, shutdown chan struct{}) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	select {
+	case <-t.C:
+	case <-shutdown:
+		t.Stop()
+	}
+}
+
 // RandomSleep will sleep for a random amount of time up to max.
 // If the shutdown channel is closed, it will return before it has finished
 // sleeping.
@@ -132,6 +132,15 @@ func TestRandomSleep(t *testing.T) {
 	assert.True(t, elapsed < time.Millisecond*150)
 }
 
+func TestStaggerOffset(t *testing.T) {
+	interval := 10 * time.Second
+	offset := StaggerOffset("docker#0", interval)
+	assert.True(t, offset >= 0 && offset < interval)
+	assert.Equal(t, offset, StaggerOffset("docker#0", interval))
+	assert.NotEqual(t, offset, StaggerOffset("docker#1", interval))
+	assert.Equal(t, time.Duration(0), StaggerOffset("docker#0", 0))
+}
+
 func TestDuration(t *testing.T) {
 	var d Duration
 
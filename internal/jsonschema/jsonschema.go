@@ -0,0 +1,375 @@
+// Package jsonschema validates JSON documents against a subset of JSON
+// Schema: type, enum, const, properties, required, additionalProperties,
+// patternProperties, items, minItems, maxItems, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, minLength, maxLength, pattern, allOf,
+// anyOf and not. The schemas using other keywords, such as $ref or format,
+// are rejected rather than partially enforced, only the annotations $schema,
+// $id, $comment, title, description, default and examples are allowed.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// keywords are the supported keywords, true for the annotations which do
+// not take part in the validation.
+var keywords = map[string]bool{
+	"type":                 false,
+	"enum":                 false,
+	"const":                false,
+	"properties":           false,
+	"required":             false,
+	"additionalProperties": false,
+	"patternProperties":    false,
+	"items":                false,
+	"minItems":             false,
+	"maxItems":             false,
+	"minimum":              false,
+	"maximum":              false,
+	"exclusiveMinimum":     false,
+	"exclusiveMaximum":     false,
+	"minLength":            false,
+	"maxLength":            false,
+	"pattern":              false,
+	"allOf":                false,
+	"anyOf":                false,
+	"not":                  false,
+	"$schema":              true,
+	"$id":                  true,
+	"$comment":             true,
+	"title":                true,
+	"description":          true,
+	"default":              true,
+	"examples":             true,
+}
+
+// Schema is a compiled JSON schema.
+type Schema struct {
+	Types                []string           `json:"-"`
+	Enum                 []interface{}      `json:"enum"`
+	Const                *interface{}       `json:"const"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	PatternProperties    map[string]*Schema `json:"patternProperties"`
+	AdditionalProperties *Schema            `json:"-"`
+	// NoAdditionalProperties is set by "additionalProperties": false
+	NoAdditionalProperties bool      `json:"-"`
+	Items                  *Schema   `json:"items"`
+	MinItems               *int      `json:"minItems"`
+	MaxItems               *int      `json:"maxItems"`
+	Minimum                *float64  `json:"minimum"`
+	Maximum                *float64  `json:"maximum"`
+	ExclusiveMinimum       *float64  `json:"exclusiveMinimum"`
+	ExclusiveMaximum       *float64  `json:"exclusiveMaximum"`
+	MinLength              *int      `json:"minLength"`
+	MaxLength              *int      `json:"maxLength"`
+	Pattern                string    `json:"pattern"`
+	AllOf                  []*Schema `json:"allOf"`
+	AnyOf                  []*Schema `json:"anyOf"`
+	Not                    *Schema   `json:"not"`
+
+	pattern  *regexp.Regexp
+	patterns map[string]*regexp.Regexp
+}
+
+// Compile parses a JSON schema.
+func Compile(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// UnmarshalJSON parses the keywords of the schema which can have several
+// forms, and compiles its patterns.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	var unsupported []string
+	for k := range all {
+		if _, ok := keywords[k]; !ok {
+			unsupported = append(unsupported, k)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return fmt.Errorf("unsupported keywords %q", unsupported)
+	}
+
+	// schema is Schema without its methods, to decode the plain keywords
+	type schema Schema
+	if err := json.Unmarshal(data, (*schema)(s)); err != nil {
+		return err
+	}
+
+	var raw struct {
+		Type                 json.RawMessage `json:"type"`
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw.Type) > 0 {
+		var t string
+		if err := json.Unmarshal(raw.Type, &t); err == nil {
+			s.Types = []string{t}
+		} else if err := json.Unmarshal(raw.Type, &s.Types); err != nil {
+			return fmt.Errorf("invalid type: %s", raw.Type)
+		}
+	}
+	switch a := bytes.TrimSpace(raw.AdditionalProperties); {
+	case len(a) == 0, bytes.Equal(a, []byte("true")):
+	case bytes.Equal(a, []byte("false")):
+		s.NoAdditionalProperties = true
+	default:
+		s.AdditionalProperties = &Schema{}
+		if err := json.Unmarshal(a, s.AdditionalProperties); err != nil {
+			return err
+		}
+	}
+
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %s", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	if len(s.PatternProperties) > 0 {
+		s.patterns = make(map[string]*regexp.Regexp, len(s.PatternProperties))
+		for p := range s.PatternProperties {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return fmt.Errorf("invalid pattern property %q: %s", p, err)
+			}
+			s.patterns[p] = re
+		}
+	}
+	return nil
+}
+
+// ValidateBytes validates a JSON document.
+func (s *Schema) ValidateBytes(data []byte) error {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return err
+	}
+	return s.Validate(v)
+}
+
+// Validate validates a decoded JSON document, numbers can be float64 or
+// json.Number.
+func (s *Schema) Validate(v interface{}) error {
+	return s.validate("", v)
+}
+
+func (s *Schema) validate(path string, v interface{}) error {
+	if len(s.Types) > 0 {
+		ok := false
+		for _, t := range s.Types {
+			ok = ok || hasType(v, t)
+		}
+		if !ok {
+			return errorf(path, "%s is not of type %v", typeOf(v), s.Types)
+		}
+	}
+	if len(s.Enum) > 0 {
+		ok := false
+		for _, e := range s.Enum {
+			ok = ok || equal(e, v)
+		}
+		if !ok {
+			return errorf(path, "value is not one of %v", s.Enum)
+		}
+	}
+	if s.Const != nil && !equal(*s.Const, v) {
+		return errorf(path, "value is not %v", *s.Const)
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if err := s.validateObject(path, v); err != nil {
+			return err
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return errorf(path, "less than %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return errorf(path, "more than %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(fmt.Sprintf("%s/%d", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			return errorf(path, "shorter than %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return errorf(path, "longer than %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return errorf(path, "%q does not match %q", v, s.Pattern)
+		}
+	}
+	if f, ok := number(v); ok {
+		if s.Minimum != nil && f < *s.Minimum {
+			return errorf(path, "%v is less than %v", f, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return errorf(path, "%v is greater than %v", f, *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum {
+			return errorf(path, "%v is not greater than %v", f, *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && f >= *s.ExclusiveMaximum {
+			return errorf(path, "%v is not less than %v", f, *s.ExclusiveMaximum)
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		if err := sub.validate(path, v); err != nil {
+			return err
+		}
+	}
+	if len(s.AnyOf) > 0 {
+		var err error
+		for _, sub := range s.AnyOf {
+			if err = sub.validate(path, v); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return errorf(path, "no schema of anyOf matches: %s", err)
+		}
+	}
+	if s.Not != nil && s.Not.validate(path, v) == nil {
+		return errorf(path, "value matches the schema of not")
+	}
+	return nil
+}
+
+func (s *Schema) validateObject(path string, v map[string]interface{}) error {
+	for _, key := range s.Required {
+		if _, ok := v[key]; !ok {
+			return errorf(path, "missing required property %q", key)
+		}
+	}
+
+	// validate the properties in order, for the errors to be stable
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		matched := false
+		if sub, ok := s.Properties[k]; ok {
+			matched = true
+			if err := sub.validate(path+"/"+k, v[k]); err != nil {
+				return err
+			}
+		}
+		for p, re := range s.patterns {
+			if re.MatchString(k) {
+				matched = true
+				if err := s.PatternProperties[p].validate(path+"/"+k, v[k]); err != nil {
+					return err
+				}
+			}
+		}
+		if matched {
+			continue
+		}
+		if s.NoAdditionalProperties {
+			return errorf(path, "additional property %q is not allowed", k)
+		}
+		if s.AdditionalProperties != nil {
+			if err := s.AdditionalProperties.validate(path+"/"+k, v[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func errorf(path, format string, args ...interface{}) error {
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+}
+
+func hasType(v interface{}, t string) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	case "number":
+		_, ok := number(v)
+		return ok
+	case "integer":
+		f, ok := number(v)
+		return ok && f == float64(int64(f))
+	default:
+		return false
+	}
+}
+
+func typeOf(v interface{}) string {
+	for _, t := range []string{"object", "array", "string", "boolean", "null", "integer", "number"} {
+		if hasType(v, t) {
+			return t
+		}
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// equal compares JSON values, numbers by value.
+func equal(a, b interface{}) bool {
+	fa, okA := number(a)
+	fb, okB := number(b)
+	if okA || okB {
+		return okA && okB && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,106 @@
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const metricSchema = `{
+	"type": "object",
+	"required": ["name", "fields", "tags"],
+	"properties": {
+		"name": {"type": "string", "pattern": "^statsd_"},
+		"tags": {
+			"type": "object",
+			"required": ["host"],
+			"additionalProperties": {"type": "string", "maxLength": 8}
+		},
+		"fields": {
+			"type": "object",
+			"patternProperties": {"^count": {"type": "integer", "minimum": 0}},
+			"additionalProperties": false
+		},
+		"timestamp": {"type": ["integer", "null"]}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Compile([]byte(metricSchema))
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		doc string
+		err string
+	}{
+		{`{"name":"statsd_a","tags":{"host":"a"},"fields":{"count":1},"timestamp":1}`, ""},
+		{`{"name":"statsd_a","tags":{"host":"a"},"fields":{"count_ok":2}}`, ""},
+		{`{"name":"cpu","tags":{"host":"a"},"fields":{"count":1}}`,
+			`/name: "cpu" does not match "^statsd_"`},
+		{`{"name":"statsd_a","tags":{},"fields":{"count":1}}`,
+			`/tags: missing required property "host"`},
+		{`{"name":"statsd_a","tags":{"host":"a-long-host"},"fields":{"count":1}}`,
+			`/tags/host: longer than 8 characters`},
+		{`{"name":"statsd_a","tags":{"host":"a"},"fields":{"count":-1}}`,
+			`/fields/count: -1 is less than 0`},
+		{`{"name":"statsd_a","tags":{"host":"a"},"fields":{"count":1.5}}`,
+			`/fields/count: number is not of type [integer]`},
+		{`{"name":"statsd_a","tags":{"host":"a"},"fields":{"value":1}}`,
+			`/fields: additional property "value" is not allowed`},
+		{`{"name":"statsd_a","tags":{"host":"a"},"fields":{"count":1},"timestamp":"now"}`,
+			`/timestamp: string is not of type [integer null]`},
+		{`[]`, `/: array is not of type [object]`},
+	} {
+		err := s.ValidateBytes([]byte(tt.doc))
+		if tt.err == "" {
+			assert.NoError(t, err, tt.doc)
+		} else if assert.Error(t, err, tt.doc) {
+			assert.Equal(t, tt.err, err.Error(), tt.doc)
+		}
+	}
+}
+
+func TestValidateCombinators(t *testing.T) {
+	s, err := Compile([]byte(`{
+		"anyOf": [{"type": "string"}, {"type": "number", "exclusiveMaximum": 10}],
+		"not": {"enum": ["forbidden", 5]}
+	}`))
+	require.NoError(t, err)
+
+	assert.NoError(t, s.ValidateBytes([]byte(`"ok"`)))
+	assert.NoError(t, s.ValidateBytes([]byte(`9.5`)))
+	assert.Error(t, s.ValidateBytes([]byte(`10`)))
+	assert.Error(t, s.ValidateBytes([]byte(`true`)))
+	assert.Error(t, s.ValidateBytes([]byte(`"forbidden"`)))
+	assert.Error(t, s.ValidateBytes([]byte(`5`)))
+}
+
+func TestCompileInvalid(t *testing.T) {
+	_, err := Compile([]byte(`{"pattern": "("}`))
+	assert.Error(t, err)
+	_, err = Compile([]byte(`{"type": 1}`))
+	assert.Error(t, err)
+}
+
+func TestCompileUnsupported(t *testing.T) {
+	for _, schema := range []string{
+		`{"$ref": "#/definitions/metric"}`,
+		`{"oneOf": [{"type": "string"}]}`,
+		`{"format": "date-time"}`,
+		`{"if": {"type": "string"}, "then": {"minLength": 1}}`,
+		`{"dependencies": {"a": ["b"]}}`,
+		`{"properties": {"fields": {"propertyNames": {"pattern": "^[a-z]+$"}}}}`,
+	} {
+		_, err := Compile([]byte(schema))
+		assert.Error(t, err, schema)
+	}
+
+	_, err := Compile([]byte(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title": "metric",
+		"description": "a metric",
+		"type": "object"
+	}`))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,381 @@
+// Package migrate converts the configuration of other metric agents to
+// telegraf configuration.
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsdConfig is the subset of the etsy/statsd configuration that has an
+// equivalent in telegraf, see exampleConfig.js in the statsd repository.
+type statsdConfig struct {
+	Port             *int
+	Address          string
+	AddressIPv6      bool `json:"address_ipv6"`
+	Server           string
+	FlushInterval    *float64
+	PercentThreshold interface{}
+	DeleteIdleStats  *bool
+	DeleteGauges     *bool
+	DeleteTimers     *bool
+	DeleteSets       *bool
+	DeleteCounters   *bool
+	Backends         []string
+
+	GraphiteHost string
+	GraphitePort *int
+	Graphite     struct {
+		GlobalPrefix *string
+	}
+
+	// statsd-influxdb-backend
+	InfluxDB struct {
+		Host     string
+		Port     *int
+		SSL      bool
+		Database string
+		Username string
+		Password string
+	}
+}
+
+// statsdKeys are the top level keys of the statsd configuration that are
+// converted, the others are reported as not converted.
+var statsdKeys = map[string]bool{
+	"port": true, "address": true, "address_ipv6": true, "server": true,
+	"flushInterval": true, "percentThreshold": true, "deleteIdleStats": true,
+	"deleteGauges": true, "deleteTimers": true, "deleteSets": true,
+	"deleteCounters": true, "backends": true, "graphiteHost": true,
+	"graphitePort": true, "graphite": true, "influxdb": true,
+}
+
+// Statsd converts an etsy/statsd configuration file, a javascript object,
+// to the equivalent statsd input and output plugins. Settings without an
+// equivalent are listed in comments.
+func Statsd(src []byte, name string) (string, error) {
+	js, err := jsToJSON(src)
+	if err != nil {
+		return "", err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(js, &raw); err != nil {
+		return "", fmt.Errorf("%s is not a statsd configuration: %s", name, err)
+	}
+	var c statsdConfig
+	if err := json.Unmarshal(js, &c); err != nil {
+		return "", fmt.Errorf("invalid statsd configuration %s: %s", name, err)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Generated by \"telegraf migrate statsd\" from %s\n", name)
+	var ignored []string
+	for k := range raw {
+		if !statsdKeys[k] {
+			ignored = append(ignored, k)
+		}
+	}
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		fmt.Fprintf(&b, "# Not converted: %s\n", strings.Join(ignored, ", "))
+	}
+
+	if err := writeStatsdInput(&b, &c); err != nil {
+		return "", err
+	}
+
+	backends := c.Backends
+	if backends == nil {
+		// the graphite backend is the default of statsd
+		backends = []string{"./backends/graphite"}
+	}
+	for _, backend := range backends {
+		b.WriteString("\n")
+		writeStatsdBackend(&b, &c, backend)
+	}
+	return b.String(), nil
+}
+
+func writeStatsdInput(b *bytes.Buffer, c *statsdConfig) error {
+	b.WriteString("\n[[inputs.statsd]]\n")
+
+	protocol := "udp"
+	switch c.Server {
+	case "", "./servers/udp":
+	case "./servers/tcp":
+		protocol = "tcp"
+	default:
+		fmt.Fprintf(b, "  ## Unsupported server %q, using udp\n", c.Server)
+	}
+	if protocol == "udp" && c.AddressIPv6 {
+		protocol = "udp6"
+	}
+	port := 8125
+	if c.Port != nil {
+		port = *c.Port
+	}
+	address := c.Address
+	if address == "0.0.0.0" || address == "::" {
+		address = ""
+	}
+	fmt.Fprintf(b, "  protocol = %q\n", protocol)
+	fmt.Fprintf(b, "  service_address = %q\n", joinHostPort(address, port))
+
+	if c.FlushInterval != nil {
+		d := time.Duration(*c.FlushInterval) * time.Millisecond
+		fmt.Fprintf(b, "  ## statsd flushInterval, make it the agent flush_interval too\n")
+		fmt.Fprintf(b, "  interval = %q\n", d.String())
+	}
+
+	// statsd keeps idle stats unless deleteIdleStats, telegraf deletes
+	// them by default
+	idle := c.DeleteIdleStats != nil && *c.DeleteIdleStats
+	for _, d := range []struct {
+		option string
+		value  *bool
+	}{
+		{"delete_gauges", c.DeleteGauges},
+		{"delete_counters", c.DeleteCounters},
+		{"delete_sets", c.DeleteSets},
+		{"delete_timings", c.DeleteTimers},
+	} {
+		v := idle
+		if d.value != nil {
+			v = *d.value
+		}
+		fmt.Fprintf(b, "  %s = %t\n", d.option, v)
+	}
+
+	percentiles, fractional, err := statsdPercentiles(c.PercentThreshold)
+	if err != nil {
+		return err
+	}
+	if len(fractional) > 0 {
+		fmt.Fprintf(b, "  ## Not converted, percentiles must be integers: %s\n",
+			strings.Join(fractional, ", "))
+	}
+	fmt.Fprintf(b, "  percentiles = [%s]\n", strings.Join(percentiles, ", "))
+	return nil
+}
+
+// statsdPercentiles converts percentThreshold, a number or a list of numbers
+// defaulting to 90. Telegraf percentiles are integers, the fractional
+// thresholds are returned separately.
+func statsdPercentiles(v interface{}) ([]string, []string, error) {
+	var thresholds []interface{}
+	switch v := v.(type) {
+	case nil:
+		return []string{"90"}, nil, nil
+	case []interface{}:
+		thresholds = v
+	default:
+		thresholds = []interface{}{v}
+	}
+
+	var percentiles, fractional []string
+	for _, t := range thresholds {
+		f, ok := t.(float64)
+		if !ok {
+			if s, isString := t.(string); isString {
+				var err error
+				f, err = strconv.ParseFloat(s, 64)
+				ok = err == nil
+			}
+		}
+		if !ok || f <= 0 || f > 100 {
+			return nil, nil, fmt.Errorf("invalid percentThreshold %v", t)
+		}
+		if f != math.Trunc(f) {
+			fractional = append(fractional, strconv.FormatFloat(f, 'f', -1, 64))
+			continue
+		}
+		percentiles = append(percentiles, strconv.Itoa(int(f)))
+	}
+	return percentiles, fractional, nil
+}
+
+func writeStatsdBackend(b *bytes.Buffer, c *statsdConfig, backend string) {
+	switch strings.TrimSuffix(backend, ".js") {
+	case "./backends/graphite":
+		host := c.GraphiteHost
+		if host == "" {
+			host = "localhost"
+		}
+		port := 2003
+		if c.GraphitePort != nil {
+			port = *c.GraphitePort
+		}
+		prefix := "stats"
+		if c.Graphite.GlobalPrefix != nil {
+			prefix = *c.Graphite.GlobalPrefix
+		}
+		b.WriteString("[[outputs.graphite]]\n")
+		fmt.Fprintf(b, "  servers = [%q]\n", joinHostPort(host, port))
+		fmt.Fprintf(b, "  prefix = %q\n", prefix)
+	case "./backends/console":
+		b.WriteString("[[outputs.file]]\n")
+		b.WriteString("  files = [\"stdout\"]\n")
+	case "statsd-influxdb-backend":
+		host := c.InfluxDB.Host
+		if host == "" {
+			host = "127.0.0.1"
+		}
+		port := 8086
+		if c.InfluxDB.Port != nil {
+			port = *c.InfluxDB.Port
+		}
+		scheme := "http"
+		if c.InfluxDB.SSL {
+			scheme = "https"
+		}
+		database := c.InfluxDB.Database
+		if database == "" {
+			database = "statsd"
+		}
+		b.WriteString("[[outputs.influxdb]]\n")
+		fmt.Fprintf(b, "  urls = [%q]\n", scheme+"://"+joinHostPort(host, port))
+		fmt.Fprintf(b, "  database = %q\n", database)
+		if c.InfluxDB.Username != "" {
+			fmt.Fprintf(b, "  username = %q\n", c.InfluxDB.Username)
+			fmt.Fprintf(b, "  password = %q\n", c.InfluxDB.Password)
+		}
+	default:
+		fmt.Fprintf(b, "## Backend %q has no equivalent output, configure one manually\n",
+			backend)
+	}
+}
+
+func joinHostPort(host string, port int) string {
+	if strings.Contains(host, ":") {
+		return fmt.Sprintf("[%s]:%d", host, port)
+	}
+	return fmt.Sprintf("%s:%d", host, port)
+}
+
+// jsToJSON converts a javascript object literal to JSON: comments and
+// trailing commas are removed, keys are quoted and single quoted strings are
+// double quoted.
+func jsToJSON(src []byte) ([]byte, error) {
+	var out bytes.Buffer
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '"' || c == '\'':
+			s, n, err := jsString(src[i:])
+			if err != nil {
+				return nil, err
+			}
+			q, _ := json.Marshal(s)
+			out.Write(q)
+			i += n
+		case c == '/' && i+1 < len(src) && (src[i+1] == '/' || src[i+1] == '*'):
+			i = skipComment(src, i)
+		case c == ',':
+			// drop trailing commas
+			j := skipSpace(src, i+1)
+			if j < len(src) && (src[j] == '}' || src[j] == ']') {
+				i++
+				continue
+			}
+			out.WriteByte(c)
+			i++
+		case c >= '0' && c <= '9':
+			// copy numbers, exponents included, so that they are not
+			// mistaken for keys
+			j := i + 1
+			for j < len(src) && (src[j] == '.' || (src[j] >= '0' && src[j] <= '9') ||
+				src[j]|0x20 == 'e' || ((src[j] == '+' || src[j] == '-') && src[j-1]|0x20 == 'e')) {
+				j++
+			}
+			out.Write(src[i:j])
+			i = j
+		case c == '_' || c == '$' || (c|0x20 >= 'a' && c|0x20 <= 'z'):
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '$' ||
+				(src[j]|0x20 >= 'a' && src[j]|0x20 <= 'z') ||
+				(src[j] >= '0' && src[j] <= '9')) {
+				j++
+			}
+			ident := string(src[i:j])
+			switch ident {
+			case "true", "false", "null":
+				out.WriteString(ident)
+			default:
+				q, _ := json.Marshal(ident)
+				out.Write(q)
+			}
+			i = j
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// jsString returns the value of the string literal at the start of src and
+// its length.
+func jsString(src []byte) (string, int, error) {
+	quote := src[0]
+	var s []byte
+	for i := 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			if i+1 >= len(src) {
+				break
+			}
+			i++
+			switch src[i] {
+			case 'n':
+				s = append(s, '\n')
+			case 't':
+				s = append(s, '\t')
+			default:
+				s = append(s, src[i])
+			}
+		case quote:
+			return string(s), i + 1, nil
+		default:
+			s = append(s, src[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string %.20q", src)
+}
+
+// skipComment returns the index following the comment starting at i.
+func skipComment(src []byte, i int) int {
+	if src[i+1] == '/' {
+		end := bytes.IndexByte(src[i:], '\n')
+		if end < 0 {
+			return len(src)
+		}
+		return i + end
+	}
+	end := bytes.Index(src[i+2:], []byte("*/"))
+	if end < 0 {
+		return len(src)
+	}
+	return i + 2 + end + 2
+}
+
+// skipSpace returns the index of the first character from i that is not a
+// space or part of a comment.
+func skipSpace(src []byte, i int) int {
+	for i < len(src) {
+		switch {
+		case src[i] == ' ' || src[i] == '\t' || src[i] == '\n' || src[i] == '\r':
+			i++
+		case src[i] == '/' && i+1 < len(src) && (src[i+1] == '/' || src[i+1] == '*'):
+			i = skipComment(src, i)
+		default:
+			return i
+		}
+	}
+	return i
+}
@@ -0,0 +1,116 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const statsdConfigJS = `
+/*
+ * statsd configuration
+ */
+{
+  graphitePort: 2003,
+  graphiteHost: "graphite.example.com",
+  port: 8126, // non default
+  address: '10.0.0.1',
+  flushInterval: 60000,
+  percentThreshold: [90, 99, 99.9],
+  deleteIdleStats: true,
+  deleteCounters: false,
+  backends: [ "./backends/graphite", "./backends/console", "./backends/repeater", ],
+  graphite: { legacyNamespace: false, globalPrefix: "metrics" },
+  repeater: [ { host: '10.0.0.2', port: 8125 } ],
+}
+`
+
+func TestStatsd(t *testing.T) {
+	out, err := Statsd([]byte(statsdConfigJS), "config.js")
+	require.NoError(t, err)
+
+	expected := `# Generated by "telegraf migrate statsd" from config.js
+# Not converted: repeater
+
+[[inputs.statsd]]
+  protocol = "udp"
+  service_address = "10.0.0.1:8126"
+  ## statsd flushInterval, make it the agent flush_interval too
+  interval = "1m0s"
+  delete_gauges = true
+  delete_counters = false
+  delete_sets = true
+  delete_timings = true
+  ## Not converted, percentiles must be integers: 99.9
+  percentiles = [90, 99]
+
+[[outputs.graphite]]
+  servers = ["graphite.example.com:2003"]
+  prefix = "metrics"
+
+[[outputs.file]]
+  files = ["stdout"]
+
+## Backend "./backends/repeater" has no equivalent output, configure one manually
+`
+	assert.Equal(t, expected, out)
+}
+
+func TestStatsdDefaults(t *testing.T) {
+	out, err := Statsd([]byte(`{ server: "./servers/tcp" }`), "config.js")
+	require.NoError(t, err)
+
+	expected := `# Generated by "telegraf migrate statsd" from config.js
+
+[[inputs.statsd]]
+  protocol = "tcp"
+  service_address = ":8125"
+  delete_gauges = false
+  delete_counters = false
+  delete_sets = false
+  delete_timings = false
+  percentiles = [90]
+
+[[outputs.graphite]]
+  servers = ["localhost:2003"]
+  prefix = "stats"
+`
+	assert.Equal(t, expected, out)
+}
+
+func TestStatsdInfluxDB(t *testing.T) {
+	js := `{
+  backends: ["statsd-influxdb-backend"],
+  percentThreshold: 95,
+  influxdb: { host: "influx", ssl: true, database: "metrics", username: "u", password: "p" }
+}`
+	out, err := Statsd([]byte(js), "config.js")
+	require.NoError(t, err)
+	assert.Contains(t, out, "  percentiles = [95]\n")
+	assert.Contains(t, out, `[[outputs.influxdb]]
+  urls = ["https://influx:8086"]
+  database = "metrics"
+  username = "u"
+  password = "p"
+`)
+}
+
+func TestStatsdInvalid(t *testing.T) {
+	_, err := Statsd([]byte(`{ port: 8125`), "config.js")
+	assert.Error(t, err)
+
+	_, err = Statsd([]byte(`{ percentThreshold: -1 }`), "config.js")
+	assert.Error(t, err)
+
+	_, err = Statsd([]byte(`{ address: "unterminated }`), "config.js")
+	assert.Error(t, err)
+}
+
+func TestJSToJSON(t *testing.T) {
+	out, err := jsToJSON([]byte(`{a: 'it\'s', "b": [1, 2e3,], c: true, // d: 1
+/* e: 2, */ f: null,}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"a": "it's", "b": [1, 2e3], "c": true, 
+ "f": null}`, string(out))
+}
@@ -60,11 +60,11 @@ func (f *Filter) Compile() error {
 		return fmt.Errorf("Error compiling 'namepass', %s", err)
 	}
 
-	f.fieldDrop, err = filter.Compile(f.FieldDrop)
+	f.fieldDrop, err = filter.CompileWithRegex(f.FieldDrop)
 	if err != nil {
 		return fmt.Errorf("Error compiling 'fielddrop', %s", err)
 	}
-	f.fieldPass, err = filter.Compile(f.FieldPass)
+	f.fieldPass, err = filter.CompileWithRegex(f.FieldPass)
 	if err != nil {
 		return fmt.Errorf("Error compiling 'fieldpass', %s", err)
 	}
@@ -215,6 +215,24 @@ func TestFilter_FieldDrop(t *testing.T) {
 	}
 }
 
+func TestFilter_FieldPassRegex(t *testing.T) {
+	f := Filter{
+		FieldPass: []string{"/^usage_(user|system)$/", "time_*"},
+		FieldDrop: []string{"/_guest/"},
+	}
+	require.NoError(t, f.Compile())
+
+	for _, field := range []string{"usage_user", "usage_system", "time_user"} {
+		assert.True(t, f.shouldFieldPass(field), field)
+	}
+	for _, field := range []string{"usage_idle", "usage_user_total", "time_guest"} {
+		assert.False(t, f.shouldFieldPass(field), field)
+	}
+
+	f = Filter{FieldPass: []string{"/usage_(/"}}
+	assert.Error(t, f.Compile())
+}
+
 func TestFilter_TagPass(t *testing.T) {
 	filters := []TagFilter{
 		TagFilter{
@@ -100,13 +100,14 @@ func makemetric(
 			continue
 		}
 		// Validate uint64 and float64 fields
-		// convert all int & uint types to int64
+		// convert all int & uint types to int64, except the uint64 which are
+		// kept unsigned, the serializers decide how to write them
 		switch val := v.(type) {
 		case nil:
 			// delete nil fields
 			delete(fields, k)
 		case uint:
-			fields[k] = int64(val)
+			fields[k] = uint64(val)
 			continue
 		case uint8:
 			fields[k] = int64(val)
@@ -130,12 +131,6 @@ func makemetric(
 			fields[k] = int64(val)
 			continue
 		case uint64:
-			// InfluxDB does not support writing uint64
-			if val < uint64(9223372036854775808) {
-				fields[k] = int64(val)
-			} else {
-				fields[k] = int64(9223372036854775807)
-			}
 			continue
 		case float32:
 			fields[k] = float64(val)
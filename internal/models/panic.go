@@ -0,0 +1,101 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// panicRestartDelay is the time after which a plugin which panicked is
+// called again, 0 disables it until telegraf restarts.
+var panicRestartDelay int64
+
+// SetPanicRestartDelay sets the time after which a plugin which panicked is
+// called again, it is restarted first if it is a service input or an output.
+// 0 disables the plugin until telegraf restarts.
+func SetPanicRestartDelay(d time.Duration) {
+	atomic.StoreInt64(&panicRestartDelay, int64(d))
+}
+
+// PanicError is the error of a plugin call which panicked.
+type PanicError struct {
+	Plugin string
+	Value  interface{}
+	Stack  []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s panicked: %v", e.Plugin, e.Value)
+}
+
+// health recovers the panics of the calls to a plugin, which is unhealthy
+// after one until it is restarted.
+type health struct {
+	sync.Mutex
+	unhealthy bool
+	// restartAt is the time the plugin is restarted, zero if never
+	restartAt time.Time
+
+	Panics selfstat.Stat
+}
+
+func newHealth(measurement string, tags map[string]string) *health {
+	return &health{
+		Panics: selfstat.Register(measurement, "panics", tags),
+	}
+}
+
+// Healthy returns whether the plugin has not panicked since it was last
+// started.
+func (h *health) Healthy() bool {
+	h.Lock()
+	defer h.Unlock()
+	return !h.unhealthy
+}
+
+// ready returns whether the plugin can be called, and whether it must be
+// restarted first because it panicked.
+func (h *health) ready() (ok, restart bool) {
+	h.Lock()
+	defer h.Unlock()
+	if !h.unhealthy {
+		return true, false
+	}
+	if h.restartAt.IsZero() || time.Now().Before(h.restartAt) {
+		return false, false
+	}
+	h.unhealthy = false
+	return true, true
+}
+
+// call calls f, a panic is logged with its stack, marks the plugin unhealthy
+// and is returned as a *PanicError.
+func (h *health) call(plugin string, f func() error) (err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		perr := &PanicError{Plugin: plugin, Value: v, Stack: debug.Stack()}
+		log.Printf("E! %s, Stack:\n%s\n", perr, perr.Stack)
+
+		h.Panics.Incr(1)
+		h.Lock()
+		h.unhealthy = true
+		h.restartAt = time.Time{}
+		if d := time.Duration(atomic.LoadInt64(&panicRestartDelay)); d > 0 {
+			h.restartAt = time.Now().Add(d)
+			log.Printf("E! %s is disabled, restarting it in %s", plugin, d)
+		} else {
+			log.Printf("E! %s is disabled until telegraf restarts", plugin)
+		}
+		h.Unlock()
+		err = perr
+	}()
+	return f()
+}
@@ -12,6 +12,8 @@ type RunningAggregator struct {
 	Config *AggregatorConfig
 
 	metrics chan telegraf.Metric
+	// realign restarts the aggregation period at the given time
+	realign chan time.Time
 
 	periodStart time.Time
 	periodEnd   time.Time
@@ -25,6 +27,7 @@ func NewRunningAggregator(
 		a:       a,
 		Config:  conf,
 		metrics: make(chan telegraf.Metric, 100),
+		realign: make(chan time.Time, 1),
 	}
 }
 
@@ -44,6 +47,11 @@ type AggregatorConfig struct {
 	Delay  time.Duration
 }
 
+// Aggregator returns the aggregator plugin.
+func (r *RunningAggregator) Aggregator() telegraf.Aggregator {
+	return r.a
+}
+
 func (r *RunningAggregator) Name() string {
 	return "aggregators." + r.Config.Name
 }
@@ -138,7 +146,9 @@ func (r *RunningAggregator) Run(
 	r.periodEnd = r.periodStart.Add(r.Config.Period)
 	time.Sleep(r.Config.Delay)
 	periodT := time.NewTicker(r.Config.Period)
-	defer periodT.Stop()
+	defer func() {
+		periodT.Stop()
+	}()
 
 	for {
 		select {
@@ -161,6 +171,26 @@ func (r *RunningAggregator) Run(
 			r.periodEnd = r.periodStart.Add(r.Config.Period)
 			r.push(acc)
 			r.reset()
+		case now := <-r.realign:
+			// the clock stepped, the metrics of the current period are
+			// pushed and a new period starts now
+			r.push(acc)
+			r.reset()
+			r.periodStart = now.Truncate(time.Second)
+			truncation = now.Sub(r.periodStart)
+			r.periodEnd = r.periodStart.Add(r.Config.Period)
+			periodT.Stop()
+			periodT = time.NewTicker(r.Config.Period)
 		}
 	}
 }
+
+// Realign restarts the aggregation period at now, after a step of the
+// system clock left it out of the timestamps of the new metrics.
+func (r *RunningAggregator) Realign(now time.Time) {
+	select {
+	case r.realign <- now:
+	default:
+		// a realignment is already pending
+	}
+}
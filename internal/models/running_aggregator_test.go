@@ -137,6 +137,54 @@ func TestAddAndPushOnePeriod(t *testing.T) {
 	wg.Wait()
 }
 
+func TestRealign(t *testing.T) {
+	a := &TestAggregator{}
+	ra := NewRunningAggregator(a, &AggregatorConfig{
+		Name: "TestRunningAggregator",
+		Filter: Filter{
+			NamePass: []string{"*"},
+		},
+		Period: time.Hour,
+	})
+	assert.NoError(t, ra.Config.Filter.Compile())
+	acc := testutil.Accumulator{}
+	shutdown := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ra.Run(&acc, time.Now(), shutdown)
+	}()
+
+	// the clock stepped back a day, the metrics are outside the period
+	// until it is realigned
+	stepped := time.Now().Add(-24 * time.Hour)
+	ra.Realign(stepped.Add(-time.Second))
+	for len(ra.realign) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	m := ra.MakeMetric(
+		"RITest",
+		map[string]interface{}{"value": int(101)},
+		map[string]string{},
+		telegraf.Untyped,
+		stepped,
+	)
+	assert.False(t, ra.Add(m))
+
+	for {
+		time.Sleep(time.Millisecond)
+		if atomic.LoadInt64(&a.sum) > 0 {
+			break
+		}
+	}
+	assert.Equal(t, int64(101), atomic.LoadInt64(&a.sum))
+
+	close(shutdown)
+	wg.Wait()
+}
+
 func TestAddDropOriginal(t *testing.T) {
 	ra := NewRunningAggregator(&TestAggregator{}, &AggregatorConfig{
 		Name: "TestRunningAggregator",
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/influxdata/telegraf"
@@ -18,6 +19,14 @@ type RunningInput struct {
 	defaultTags map[string]string
 
 	MetricsGathered selfstat.Stat
+	GatherErrors    selfstat.Stat
+
+	usage  *usage
+	health *health
+	// started is set once a service input is started, with acc, to restart
+	// it
+	started bool
+	acc     telegraf.Accumulator
 }
 
 func NewRunningInput(
@@ -32,6 +41,13 @@ func NewRunningInput(
 			"metrics_gathered",
 			map[string]string{"input": config.Name},
 		),
+		GatherErrors: selfstat.Register(
+			"gather",
+			"gather_errors",
+			map[string]string{"input": config.Name},
+		),
+		usage:  newUsage("gather", map[string]string{"input": config.Name}),
+		health: newHealth("gather", map[string]string{"input": config.Name}),
 	}
 }
 
@@ -44,12 +60,82 @@ type InputConfig struct {
 	Tags              map[string]string
 	Filter            Filter
 	Interval          time.Duration
+	// CollectionJitter overrides the collection jitter of the agent if not
+	// zero.
+	CollectionJitter time.Duration
 }
 
 func (r *RunningInput) Name() string {
 	return "inputs." + r.Config.Name
 }
 
+// Gather gathers the metrics of the input, sampling its resource usage if
+// enabled with SetUsageSampling. A panic of the input is returned as a
+// *PanicError, the input is then not gathered until it is restarted, see
+// SetPanicRestartDelay.
+func (r *RunningInput) Gather(acc telegraf.Accumulator) error {
+	ok, restart := r.health.ready()
+	if !ok {
+		return nil
+	}
+	if restart {
+		if err := r.restart(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	r.usage.measure(func() {
+		err = r.health.call(r.Name(), func() error {
+			return r.Input.Gather(acc)
+		})
+	})
+	return err
+}
+
+// Start starts a service input, a panic is recovered as for Gather.
+func (r *RunningInput) Start(acc telegraf.Accumulator) error {
+	s, ok := r.Input.(telegraf.ServiceInput)
+	if !ok {
+		return nil
+	}
+	r.started, r.acc = true, acc
+	return r.health.call(r.Name(), func() error {
+		return s.Start(acc)
+	})
+}
+
+// Stop stops a service input, a panic is recovered as for Gather.
+func (r *RunningInput) Stop() error {
+	s, ok := r.Input.(telegraf.ServiceInput)
+	if !ok {
+		return nil
+	}
+	return r.health.call(r.Name(), func() error {
+		s.Stop()
+		return nil
+	})
+}
+
+// Healthy returns whether the input has not panicked since it was last
+// started.
+func (r *RunningInput) Healthy() bool {
+	return r.health.Healthy()
+}
+
+// restart restarts the input after a panic, service inputs are stopped and
+// started again.
+func (r *RunningInput) restart() error {
+	log.Printf("I! Restarting %s after a panic", r.Name())
+	if !r.started {
+		return nil
+	}
+	if err := r.Stop(); err != nil {
+		return err
+	}
+	return r.Start(r.acc)
+}
+
 // MakeMetric either returns a metric, or returns nil if the metric doesn't
 // need to be created (because of filtering, an error, etc.)
 func (r *RunningInput) MakeMetric(
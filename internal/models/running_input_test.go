@@ -168,6 +168,49 @@ func TestMakeMetricFilteredOut(t *testing.T) {
 	assert.Nil(t, m)
 }
 
+// Test that the fields are filtered whatever the type of the metric
+func TestMakeMetricFieldFilter(t *testing.T) {
+	ri := NewRunningInput(&testInput{}, &InputConfig{
+		Name: "TestRunningInput",
+		Filter: Filter{
+			FieldPass: []string{"/^usage_/", "time"},
+			FieldDrop: []string{"usage_guest*"},
+		},
+	})
+	assert.NoError(t, ri.Config.Filter.Compile())
+
+	for _, mType := range []telegraf.ValueType{telegraf.Untyped, telegraf.Gauge, telegraf.Counter} {
+		m := ri.MakeMetric(
+			"RITest",
+			map[string]interface{}{
+				"usage_user":  1.0,
+				"usage_guest": 2.0,
+				"time":        int64(3),
+				"idle":        4.0,
+			},
+			nil,
+			mType,
+			time.Now(),
+		)
+		require.NotNil(t, m)
+		assert.Equal(t, map[string]interface{}{
+			"usage_user": 1.0,
+			"time":       int64(3),
+		}, m.Fields())
+		assert.Equal(t, mType, m.Type())
+	}
+
+	// the metrics without fields left are dropped
+	m := ri.MakeMetric(
+		"RITest",
+		map[string]interface{}{"idle": 4.0},
+		nil,
+		telegraf.Gauge,
+		time.Now(),
+	)
+	assert.Nil(t, m)
+}
+
 func TestMakeMetricWithDaemonTags(t *testing.T) {
 	now := time.Now()
 	ri := NewRunningInput(&testInput{}, &InputConfig{
@@ -258,14 +301,14 @@ func TestMakeMetricAllFieldTypes(t *testing.T) {
 	assert.Contains(t, m.String(), "b=10i")
 	assert.Contains(t, m.String(), "c=10i")
 	assert.Contains(t, m.String(), "d=10i")
-	assert.Contains(t, m.String(), "e=10i")
+	assert.Contains(t, m.String(), "e=10u")
 	assert.Contains(t, m.String(), "f=10i")
 	assert.Contains(t, m.String(), "g=10i")
 	assert.Contains(t, m.String(), "h=10i")
-	assert.Contains(t, m.String(), "i=10i")
+	assert.Contains(t, m.String(), "i=10u")
 	assert.Contains(t, m.String(), "j=10")
 	assert.NotContains(t, m.String(), "j=10i")
-	assert.Contains(t, m.String(), "k=9223372036854775807i")
+	assert.Contains(t, m.String(), "k=9223372036854775810u")
 	assert.Contains(t, m.String(), "l=\"foobar\"")
 	assert.Contains(t, m.String(), "m=true")
 }
@@ -456,6 +499,69 @@ func TestMakeMetric_TrailingSlash(t *testing.T) {
 	}
 }
 
+func TestRunningInputPanic(t *testing.T) {
+	input := &panicInput{panics: 1}
+	ri := NewRunningInput(input, &InputConfig{Name: "TestRunningInputPanic"})
+	ri.health.Panics.Set(0)
+
+	err := ri.Gather(nil)
+	require.Error(t, err)
+	assert.IsType(t, &PanicError{}, err)
+	assert.False(t, ri.Healthy())
+	assert.Equal(t, int64(1), ri.health.Panics.Get())
+
+	// disabled until telegraf restarts
+	require.NoError(t, ri.Gather(nil))
+	assert.Equal(t, 1, input.gathers)
+}
+
+func TestRunningInputPanicRestart(t *testing.T) {
+	SetPanicRestartDelay(time.Millisecond)
+	defer SetPanicRestartDelay(0)
+
+	input := &panicInput{panics: 1}
+	ri := NewRunningInput(input, &InputConfig{Name: "TestRunningInputPanicRestart"})
+	require.NoError(t, ri.Start(nil))
+	assert.Error(t, ri.Gather(nil))
+	require.NoError(t, ri.Gather(nil))
+	assert.Equal(t, 1, input.gathers)
+
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, ri.Gather(nil))
+	assert.True(t, ri.Healthy())
+	assert.Equal(t, 2, input.gathers)
+	assert.Equal(t, 2, input.starts)
+	assert.Equal(t, 1, input.stops)
+}
+
+// panicInput is a service input whose first Gather calls panic.
+type panicInput struct {
+	panics  int
+	gathers int
+	starts  int
+	stops   int
+}
+
+func (p *panicInput) Description() string  { return "" }
+func (p *panicInput) SampleConfig() string { return "" }
+
+func (p *panicInput) Gather(acc telegraf.Accumulator) error {
+	p.gathers++
+	if p.gathers <= p.panics {
+		panic("gather")
+	}
+	return nil
+}
+
+func (p *panicInput) Start(acc telegraf.Accumulator) error {
+	p.starts++
+	return nil
+}
+
+func (p *panicInput) Stop() {
+	p.stops++
+}
+
 type testInput struct{}
 
 func (t *testInput) Description() string                   { return "" }
@@ -1,13 +1,17 @@
 package models
 
 import (
+	"fmt"
 	"log"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal/buffer"
 	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/influxdata/telegraf/selfstat"
 )
 
@@ -19,6 +23,15 @@ const (
 	DEFAULT_METRIC_BUFFER_LIMIT = 10000
 )
 
+// Delivery policies of an output.
+const (
+	// DeliveryAtLeastOnce keeps the metrics of a failed write in the buffer
+	// and retries them on the next flush.
+	DeliveryAtLeastOnce = "at_least_once"
+	// DeliveryAtMostOnce drops the metrics of a failed write.
+	DeliveryAtMostOnce = "at_most_once"
+)
+
 // RunningOutput contains the output configuration
 type RunningOutput struct {
 	Name              string
@@ -29,12 +42,37 @@ type RunningOutput struct {
 
 	MetricsFiltered selfstat.Stat
 	MetricsWritten  selfstat.Stat
+	MetricsDropped  selfstat.Stat
+	WriteErrors     selfstat.Stat
 	BufferSize      selfstat.Stat
 	BufferLimit     selfstat.Stat
 	WriteTime       selfstat.Stat
 
-	metrics     *buffer.Buffer
-	failMetrics *buffer.Buffer
+	// occupancy of the memory and disk tiers of the buffer, the disk stats
+	// are only registered when the buffer spills to disk
+	BufferMemorySize selfstat.Stat
+	BufferDiskSize   selfstat.Stat
+	BufferDiskBytes  selfstat.Stat
+	BufferDiskLimit  selfstat.Stat
+
+	// MetricsRejected is only registered when the output validates its
+	// metrics
+	MetricsRejected selfstat.Stat
+
+	buffer *buffer.Buffer
+	// spill configures the spill file of the buffer until OpenBuffer opens
+	// it
+	spill *buffer.SpillConfig
+	// validator rejects the invalid metrics before they are buffered, they
+	// are appended to deadLetter if not nil
+	validator  Validator
+	deadLetter *os.File
+	// failing is set while the last write failed, metrics are then only
+	// written on flush.
+	failing int32
+
+	usage  *usage
+	health *health
 
 	// Guards against concurrent calls to the Output as described in #3009
 	sync.Mutex
@@ -55,8 +93,7 @@ func NewRunningOutput(
 	}
 	ro := &RunningOutput{
 		Name:              name,
-		metrics:           buffer.NewBuffer(batchSize),
-		failMetrics:       buffer.NewBuffer(bufferLimit),
+		buffer:            buffer.NewBuffer(bufferLimit),
 		Output:            output,
 		Config:            conf,
 		MetricBufferLimit: bufferLimit,
@@ -71,6 +108,16 @@ func NewRunningOutput(
 			"metrics_filtered",
 			map[string]string{"output": name},
 		),
+		MetricsDropped: selfstat.Register(
+			"write",
+			"metrics_dropped",
+			map[string]string{"output": name},
+		),
+		WriteErrors: selfstat.Register(
+			"write",
+			"write_errors",
+			map[string]string{"output": name},
+		),
 		BufferSize: selfstat.Register(
 			"write",
 			"buffer_size",
@@ -81,22 +128,95 @@ func NewRunningOutput(
 			"buffer_limit",
 			map[string]string{"output": name},
 		),
+		BufferMemorySize: selfstat.Register(
+			"write",
+			"buffer_memory_size",
+			map[string]string{"output": name},
+		),
 		WriteTime: selfstat.RegisterTiming(
 			"write",
 			"write_time_ns",
 			map[string]string{"output": name},
 		),
+		usage:  newUsage("write", map[string]string{"output": name}),
+		health: newHealth("write", map[string]string{"output": name}),
 	}
 	ro.BufferLimit.Incr(int64(ro.MetricBufferLimit))
 	return ro
 }
 
+// SpillToDisk makes the buffer of the output move its oldest metrics to the
+// file configured by c when it is full. The file is only opened by
+// OpenBuffer, loading a configuration leaves it untouched.
+func (ro *RunningOutput) SpillToDisk(c buffer.SpillConfig) {
+	ro.spill = &c
+
+	tags := map[string]string{"output": ro.Name}
+	ro.BufferDiskSize = selfstat.Register("write", "buffer_disk_size", tags)
+	ro.BufferDiskBytes = selfstat.Register("write", "buffer_disk_bytes", tags)
+	ro.BufferDiskLimit = selfstat.Register("write", "buffer_disk_limit", tags)
+	ro.BufferDiskLimit.Set(int64(c.Limit))
+}
+
+// OpenBuffer opens the spill file of the buffer, if any, when the agent
+// starts. The file is truncated, unless it is persistent. The metrics added
+// before are kept.
+func (ro *RunningOutput) OpenBuffer() error {
+	if ro.spill == nil {
+		return nil
+	}
+	b, err := buffer.NewSpillBuffer(ro.MetricBufferLimit, *ro.spill)
+	if err != nil {
+		return err
+	}
+	ro.spill = nil
+	b.Add(ro.buffer.Batch(ro.buffer.Len())...)
+	ro.buffer = b
+	return nil
+}
+
+// SetValidator makes the output reject the metrics failing v. The rejected
+// metrics are appended to the file at deadLetterPath in line protocol, or
+// dropped if empty.
+func (ro *RunningOutput) SetValidator(v Validator, deadLetterPath string) error {
+	if deadLetterPath != "" {
+		f, err := os.OpenFile(deadLetterPath,
+			os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		ro.deadLetter = f
+	}
+	ro.validator = v
+	ro.MetricsRejected = selfstat.Register("write", "metrics_rejected",
+		map[string]string{"output": ro.Name})
+	return nil
+}
+
+// RetimeBuffer moves by offset the timestamps of the buffered metrics for
+// which match returns true, see buffer.Retime.
+func (ro *RunningOutput) RetimeBuffer(offset time.Duration, match func(telegraf.Metric) bool) int {
+	return ro.buffer.Retime(offset, match)
+}
+
+// Close releases the buffer of the output, the metrics it holds are lost.
+func (ro *RunningOutput) Close() error {
+	if ro.deadLetter != nil {
+		ro.deadLetter.Close()
+	}
+	return ro.buffer.Close()
+}
+
 // AddMetric adds a metric to the output. This function can also write cached
 // points if FlushBufferWhenFull is true.
 func (ro *RunningOutput) AddMetric(m telegraf.Metric) {
 	if m == nil {
 		return
 	}
+	// the shard is chosen before the tags are filtered
+	if ro.Config.Shard != nil && !ro.Config.Shard.Accept(m) {
+		return
+	}
 	// Filter any tagexclude/taginclude parameters before adding metric
 	if ro.Config.Filter.IsActive() {
 		// In order to filter out tags, we need to create a new metric, since
@@ -113,82 +233,180 @@ func (ro *RunningOutput) AddMetric(m telegraf.Metric) {
 		m, _ = metric.New(name, tags, fields, t)
 	}
 
-	ro.metrics.Add(m)
-	if ro.metrics.Len() == ro.MetricBatchSize {
-		batch := ro.metrics.Batch(ro.MetricBatchSize)
-		err := ro.write(batch)
-		if err != nil {
-			ro.failMetrics.Add(batch...)
+	if ro.validator != nil {
+		if err := ro.validator.Validate(m); err != nil {
+			ro.reject(m, err)
+			return
 		}
 	}
+
+	ro.buffer.Add(m)
+	if ro.buffer.Len() >= ro.MetricBatchSize && atomic.LoadInt32(&ro.failing) == 0 {
+		ro.writeBatch()
+	}
+}
+
+// Healthy returns whether the output has not panicked since it was last
+// restarted.
+func (ro *RunningOutput) Healthy() bool {
+	return ro.health.Healthy()
 }
 
-// Write writes all cached points to this output.
+// Write writes the metrics of the failed writes and a batch of new metrics
+// to this output, or all cached points if the buffer spills to disk, the
+// spilled metrics would otherwise never catch up. Batches are written oldest
+// first and it stops at the first failed write, so that the metrics are
+// retried in order on the next flush.
 func (ro *RunningOutput) Write() error {
-	nFails, nMetrics := ro.failMetrics.Len(), ro.metrics.Len()
-	ro.BufferSize.Set(int64(nFails + nMetrics))
+	nMetrics := ro.buffer.Len()
+	ro.updateBufferStats(nMetrics)
 	log.Printf("D! Output [%s] buffer fullness: %d / %d metrics. ",
-		ro.Name, nFails+nMetrics, ro.MetricBufferLimit)
-	var err error
-	if !ro.failMetrics.IsEmpty() {
-		// how many batches of failed writes we need to write.
-		nBatches := nFails/ro.MetricBatchSize + 1
-		batchSize := ro.MetricBatchSize
-
-		for i := 0; i < nBatches; i++ {
-			// If it's the last batch, only grab the metrics that have not had
-			// a write attempt already (this is primarily to preserve order).
-			if i == nBatches-1 {
-				batchSize = nFails % ro.MetricBatchSize
-			}
-			batch := ro.failMetrics.Batch(batchSize)
-			// If we've already failed previous writes, don't bother trying to
-			// write to this output again. We are not exiting the loop just so
-			// that we can rotate the metrics to preserve order.
-			if err == nil {
-				err = ro.write(batch)
-			}
-			if err != nil {
-				ro.failMetrics.Add(batch...)
-			}
+		ro.Name, nMetrics, ro.MetricBufferLimit)
+
+	if ro.BufferDiskSize == nil {
+		// the new batch is requeued with the failed metrics, so that it is
+		// retried with them on the next flush if a write fails
+		ro.Lock()
+		if n := ro.buffer.RequeuedLen() + ro.MetricBatchSize; n < nMetrics {
+			nMetrics = n
 		}
+		ro.buffer.Requeue(ro.buffer.Batch(nMetrics))
+		ro.Unlock()
 	}
 
-	batch := ro.metrics.Batch(ro.MetricBatchSize)
-	// see comment above about not trying to write to an already failed output.
-	// if ro.failMetrics is empty then err will always be nil at this point.
-	if err == nil {
-		err = ro.write(batch)
+	// metrics added during the write wait for the next flush
+	nBatches := (nMetrics + ro.MetricBatchSize - 1) / ro.MetricBatchSize
+	for i := 0; i < nBatches; i++ {
+		if err := ro.writeBatch(); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
+func (ro *RunningOutput) updateBufferStats(nMetrics int) {
+	ro.BufferSize.Set(int64(nMetrics))
+	ro.BufferMemorySize.Set(int64(ro.buffer.MemoryLen()))
+	if ro.BufferDiskSize != nil {
+		n, size := ro.buffer.DiskLen()
+		ro.BufferDiskSize.Set(int64(n))
+		ro.BufferDiskBytes.Set(size)
+	}
+}
+
+// writeBatch writes the oldest metrics of the buffer.
+func (ro *RunningOutput) writeBatch() error {
+	// Guards against concurrent calls to the Output, and keeps a failed
+	// batch the oldest metrics of the buffer until it is requeued.
+	ro.Lock()
+	defer ro.Unlock()
+	batch := ro.buffer.Batch(ro.MetricBatchSize)
+	err := ro.write(batch)
 	if err != nil {
-		ro.failMetrics.Add(batch...)
+		atomic.StoreInt32(&ro.failing, 1)
+		ro.fail(batch)
 		return err
 	}
+	atomic.StoreInt32(&ro.failing, 0)
 	return nil
 }
 
+// reject drops an invalid metric, after appending it to the dead letter
+// file.
+func (ro *RunningOutput) reject(m telegraf.Metric, err error) {
+	ro.MetricsRejected.Incr(1)
+	log.Printf("W! Output [%s] rejected invalid metric %s: %s",
+		ro.Name, m.Name(), err)
+	if ro.deadLetter == nil {
+		return
+	}
+	if _, err := ro.deadLetter.Write(m.Serialize()); err != nil {
+		log.Printf("E! Output [%s] unable to write to the dead letter file: %s",
+			ro.Name, err)
+	}
+}
+
+// fail keeps the metrics of a failed write at the head of the buffer for the
+// next flush, unless the output only wants them delivered at most once.
+func (ro *RunningOutput) fail(metrics []telegraf.Metric) {
+	if ro.Config.DeliveryPolicy == DeliveryAtMostOnce {
+		log.Printf("W! Output [%s] dropped %d metrics after a failed write",
+			ro.Name, len(metrics))
+		ro.MetricsDropped.Incr(int64(len(metrics)))
+		return
+	}
+	ro.buffer.Requeue(metrics)
+}
+
 func (ro *RunningOutput) write(metrics []telegraf.Metric) error {
 	nMetrics := len(metrics)
 	if nMetrics == 0 {
 		return nil
 	}
-	ro.Lock()
-	defer ro.Unlock()
+	plugin := "outputs." + ro.Name
+	ok, restart := ro.health.ready()
+	if !ok {
+		ro.WriteErrors.Incr(1)
+		return fmt.Errorf("%s is disabled after a panic", plugin)
+	}
+	if restart {
+		log.Printf("I! Restarting %s after a panic", plugin)
+		err := ro.health.call(plugin, func() error {
+			if err := ro.Output.Close(); err != nil {
+				log.Printf("D! Output [%s] error closing: %s", ro.Name, err)
+			}
+			return ro.Output.Connect()
+		})
+		if err != nil {
+			ro.WriteErrors.Incr(1)
+			return err
+		}
+	}
+
 	start := time.Now()
-	err := ro.Output.Write(metrics)
+	var err error
+	ro.usage.measure(func() {
+		err = ro.health.call(plugin, func() error {
+			return ro.Output.Write(metrics)
+		})
+	})
 	elapsed := time.Since(start)
-	if err == nil {
-		log.Printf("D! Output [%s] wrote batch of %d metrics in %s\n",
-			ro.Name, nMetrics, elapsed)
-		ro.MetricsWritten.Incr(int64(nMetrics))
-		ro.WriteTime.Incr(elapsed.Nanoseconds())
+	if err != nil {
+		ro.WriteErrors.Incr(1)
+		return err
 	}
-	return err
+	log.Printf("D! Output [%s] wrote batch of %d metrics in %s\n",
+		ro.Name, nMetrics, elapsed)
+	ro.MetricsWritten.Incr(int64(nMetrics))
+	ro.WriteTime.Incr(elapsed.Nanoseconds())
+	return nil
 }
 
 // OutputConfig containing name and filter
 type OutputConfig struct {
 	Name   string
 	Filter Filter
+
+	// DeliveryPolicy is either DeliveryAtLeastOnce (the default) or
+	// DeliveryAtMostOnce.
+	DeliveryPolicy string
+
+	// Serializer is the configuration of the serializer of the output, nil
+	// if the output does not serialize the metrics.
+	Serializer *serializers.Config
+
+	// Shard restricts the output to a shard of the metrics, nil if the
+	// output gets all of them.
+	Shard *Shard
+
+	// Validate is the validation of the metrics: empty, "line_protocol" or
+	// "json_schema" with the schema at ValidateSchema. The rejected metrics
+	// are appended to DeadLetterFile if set.
+	Validate       string
+	ValidateSchema string
+	DeadLetterFile string
+
+	// SpillName names the buffer spill file of the output, which is
+	// otherwise named after the hash of the options of the output.
+	SpillName string
 }
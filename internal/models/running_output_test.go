@@ -2,10 +2,19 @@ package models
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/buffer"
+	"github.com/influxdata/telegraf/internal/jsonschema"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/serializers/json"
 	"github.com/influxdata/telegraf/testutil"
 
 	"github.com/stretchr/testify/assert"
@@ -142,6 +151,49 @@ func TestRunningOutput_PassFilter(t *testing.T) {
 	assert.Len(t, m.Metrics(), 10)
 }
 
+// Test that the metrics failing validation are written to the dead letter
+// file instead of the output
+func TestRunningOutput_Validate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "running_output")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	deadLetter := filepath.Join(dir, "dead_letter.out")
+
+	schema, err := jsonschema.Compile([]byte(
+		`{"properties": {"name": {"pattern": "^metric[0-9]$"}}}`))
+	require.NoError(t, err)
+	m := &mockOutput{}
+	ro := NewRunningOutput("test", m, &OutputConfig{}, 1000, 10000)
+	require.NoError(t, ro.SetValidator(&JSONSchemaValidator{
+		Schema:     schema,
+		Serializer: &json.JsonSerializer{},
+	}, deadLetter))
+	ro.MetricsRejected.Set(0)
+
+	for _, metric := range append(first5, next5...) {
+		ro.AddMetric(metric)
+	}
+	require.NoError(t, ro.Write())
+	assert.Len(t, m.Metrics(), 9)
+	assert.Equal(t, int64(1), ro.MetricsRejected.Get())
+	require.NoError(t, ro.Close())
+
+	rejected, err := ioutil.ReadFile(deadLetter)
+	require.NoError(t, err)
+	assert.Equal(t, string(next5[4].Serialize()), string(rejected))
+}
+
+func TestLineProtocolValidator(t *testing.T) {
+	v := &LineProtocolValidator{}
+	assert.NoError(t, v.Validate(first5[0]))
+
+	long, err := metric.New("cpu", map[string]string{},
+		map[string]interface{}{"value": strings.Repeat("a", maxStringFieldSize+1)},
+		time.Now())
+	require.NoError(t, err)
+	assert.Error(t, v.Validate(long))
+}
+
 // Test that tags are properly included
 func TestRunningOutput_TagIncludeNoMatch(t *testing.T) {
 	conf := &OutputConfig{
@@ -306,6 +358,7 @@ func TestRunningOutputWriteFail(t *testing.T) {
 	m := &mockOutput{}
 	m.failWrite = true
 	ro := NewRunningOutput("test", m, conf, 4, 12)
+	ro.WriteErrors.Set(0)
 
 	// Fill buffer to limit twice
 	for _, metric := range first5 {
@@ -322,6 +375,8 @@ func TestRunningOutputWriteFail(t *testing.T) {
 	require.Error(t, err)
 	// no successful flush yet
 	assert.Len(t, m.Metrics(), 0)
+	// the first batch failed when the buffer was full, then on the flush
+	assert.Equal(t, int64(2), ro.WriteErrors.Get())
 
 	m.failWrite = false
 	err = ro.Write()
@@ -330,6 +385,93 @@ func TestRunningOutputWriteFail(t *testing.T) {
 	assert.Len(t, m.Metrics(), 10)
 }
 
+// Test that a flush writes the metrics of the failed writes and a single
+// batch of new metrics
+func TestRunningOutputWriteOneBatch(t *testing.T) {
+	conf := &OutputConfig{
+		Filter: Filter{},
+	}
+
+	m := &mockOutput{}
+	ro := NewRunningOutput("test", m, conf, 4, 100)
+	m.failWrite = true
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	for _, metric := range next5 {
+		ro.AddMetric(metric)
+	}
+	// the first batch failed when it was full
+	assert.Equal(t, 10, ro.buffer.Len())
+
+	m.failWrite = false
+	require.NoError(t, ro.Write())
+	assert.Equal(t, append(first5, next5[:3]...), m.Metrics())
+	require.NoError(t, ro.Write())
+	assert.Equal(t, append(first5, next5...), m.Metrics())
+}
+
+func TestRunningOutputWriteFailAtMostOnce(t *testing.T) {
+	conf := &OutputConfig{
+		Filter:         Filter{},
+		DeliveryPolicy: DeliveryAtMostOnce,
+	}
+
+	m := &mockOutput{}
+	m.failWrite = true
+	ro := NewRunningOutput("test", m, conf, 4, 12)
+	ro.MetricsDropped.Set(0)
+
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	// the first batch of 4 failed and was dropped
+	assert.Equal(t, 1, ro.buffer.Len())
+	assert.Equal(t, int64(4), ro.MetricsDropped.Get())
+
+	err := ro.Write()
+	require.Error(t, err)
+	assert.Equal(t, int64(5), ro.MetricsDropped.Get())
+
+	m.failWrite = false
+	for _, metric := range next5 {
+		ro.AddMetric(metric)
+	}
+	// a batch of new metrics is written on each flush
+	err = ro.Write()
+	require.NoError(t, err)
+	assert.Len(t, m.Metrics(), 4)
+	err = ro.Write()
+	require.NoError(t, err)
+
+	// only the metrics added after the failure are written
+	assert.Len(t, m.Metrics(), 5)
+}
+
+func TestRunningOutputShard(t *testing.T) {
+	shards := []string{"a", "b"}
+	var written []telegraf.Metric
+	for _, name := range shards {
+		conf := &OutputConfig{
+			Filter: Filter{TagExclude: []string{"host"}},
+			Shard:  &Shard{Tag: "host", Shards: shards, Name: name},
+		}
+		require.NoError(t, conf.Filter.Compile())
+		m := &mockOutput{}
+		ro := NewRunningOutput("test", m, conf, 1000, 10000)
+		for i := 0; i < 20; i++ {
+			ro.AddMetric(hostMetric(fmt.Sprintf("host%d", i)))
+		}
+		require.NoError(t, ro.Write())
+		written = append(written, m.Metrics()...)
+	}
+	// the shard is chosen before the tag is excluded
+	assert.Len(t, written, 20)
+	for _, m := range written {
+		assert.False(t, m.HasTag("host"))
+	}
+}
+
 // Verify that the order of points is preserved during a write failure.
 func TestRunningOutputWriteFailOrder(t *testing.T) {
 	conf := &OutputConfig{
@@ -479,6 +621,99 @@ func TestRunningOutputWriteFailOrder3(t *testing.T) {
 	assert.Equal(t, expected, m.Metrics())
 }
 
+// Verify that the metrics spilled to disk are written in order, before the
+// ones in memory.
+func TestRunningOutputWriteFailSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "running_output")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := &OutputConfig{
+		Filter: Filter{},
+	}
+
+	m := &mockOutput{}
+	m.failWrite = true
+	ro := NewRunningOutput("test", m, conf, 4, 4)
+	ro.SpillToDisk(buffer.SpillConfig{
+		Path:  filepath.Join(dir, "test.spill"),
+		Limit: 100,
+	})
+	_, err = os.Stat(filepath.Join(dir, "test.spill"))
+	assert.True(t, os.IsNotExist(err))
+	require.NoError(t, ro.OpenBuffer())
+	defer ro.Close()
+
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	for _, metric := range next5 {
+		ro.AddMetric(metric)
+	}
+	err = ro.Write()
+	require.Error(t, err)
+	assert.Equal(t, int64(10), ro.BufferSize.Get())
+	// the failed batch of 4 is requeued in memory, in front of the spill file
+	assert.Equal(t, int64(8), ro.BufferMemorySize.Get())
+	assert.Equal(t, int64(2), ro.BufferDiskSize.Get())
+
+	m.failWrite = false
+	err = ro.Write()
+	require.NoError(t, err)
+
+	expected := append(first5, next5...)
+	require.Len(t, m.Metrics(), len(expected))
+	for i := range expected {
+		assert.Equal(t, expected[i].String(), m.Metrics()[i].String())
+	}
+}
+
+func TestRunningOutputPanic(t *testing.T) {
+	SetPanicRestartDelay(time.Millisecond)
+	defer SetPanicRestartDelay(0)
+
+	m := &panicOutput{panics: 1}
+	ro := NewRunningOutput("TestRunningOutputPanic", m, &OutputConfig{}, 10, 100)
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+
+	err := ro.Write()
+	require.Error(t, err)
+	assert.IsType(t, &PanicError{}, err)
+	assert.False(t, ro.Healthy())
+	require.Error(t, ro.Write())
+	assert.Len(t, m.Metrics(), 0)
+
+	// the output is reconnected and writes the metrics kept in the buffer
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, ro.Write())
+	assert.True(t, ro.Healthy())
+	assert.Len(t, m.Metrics(), 5)
+	assert.Equal(t, 1, m.connects)
+}
+
+// panicOutput is an output whose first writes panic.
+type panicOutput struct {
+	mockOutput
+	panics   int
+	writes   int
+	connects int
+}
+
+func (m *panicOutput) Connect() error {
+	m.connects++
+	return nil
+}
+
+func (m *panicOutput) Write(metrics []telegraf.Metric) error {
+	m.writes++
+	if m.writes <= m.panics {
+		panic("write")
+	}
+	return m.mockOutput.Write(metrics)
+}
+
 type mockOutput struct {
 	sync.Mutex
 
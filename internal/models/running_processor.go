@@ -12,6 +12,8 @@ type RunningProcessor struct {
 	sync.Mutex
 	Processor telegraf.Processor
 	Config    *ProcessorConfig
+
+	usage *usage
 }
 
 type RunningProcessors []*RunningProcessor
@@ -31,6 +33,10 @@ func (rp *RunningProcessor) Apply(in ...telegraf.Metric) []telegraf.Metric {
 	rp.Lock()
 	defer rp.Unlock()
 
+	if rp.usage == nil {
+		rp.usage = newUsage("process", map[string]string{"processor": rp.Name})
+	}
+
 	ret := []telegraf.Metric{}
 
 	for _, metric := range in {
@@ -44,7 +50,9 @@ func (rp *RunningProcessor) Apply(in ...telegraf.Metric) []telegraf.Metric {
 		}
 		// This metric should pass through the filter, so call the filter Apply
 		// function and append results to the output slice.
-		ret = append(ret, rp.Processor.Apply(metric)...)
+		rp.usage.measure(func() {
+			ret = append(ret, rp.Processor.Apply(metric)...)
+		})
 	}
 
 	return ret
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/influxdata/telegraf"
+)
+
+// Shard spreads the metrics over several outputs, one per endpoint, by the
+// value of a tag: each output gets the metrics whose tag value hashes to its
+// shard. The shard of a tag value is chosen by rendezvous hashing, so that
+// adding or removing a shard only moves the tag values of this shard.
+type Shard struct {
+	// Tag is the tag the metrics are sharded by, the metrics without it all
+	// go to the shard of the empty value.
+	Tag string
+	// Shards are the names of all the shards, the same in every output.
+	Shards []string
+	// Name is the shard of the output.
+	Name string
+}
+
+// Validate returns an error if the shard of the output is not one of the
+// shards.
+func (s *Shard) Validate() error {
+	if s.Tag == "" {
+		return fmt.Errorf("shard_tag is required with shards")
+	}
+	seen := make(map[string]bool, len(s.Shards))
+	for _, name := range s.Shards {
+		if seen[name] {
+			return fmt.Errorf("duplicate shard %q", name)
+		}
+		seen[name] = true
+	}
+	if !seen[s.Name] {
+		return fmt.Errorf("shard %q is not one of the shards %v", s.Name, s.Shards)
+	}
+	return nil
+}
+
+// Accept returns whether the metric belongs to the shard of the output.
+func (s *Shard) Accept(m telegraf.Metric) bool {
+	return s.shardOf(m.Tags()[s.Tag]) == s.Name
+}
+
+// shardOf returns the shard with the highest hash of its name and value.
+func (s *Shard) shardOf(value string) string {
+	var best string
+	var bestHash uint64
+	for i, name := range s.Shards {
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(value))
+		if sum := mix(h.Sum64()); i == 0 || sum > bestHash {
+			best, bestHash = name, sum
+		}
+	}
+	return best
+}
+
+// mix spreads the bits of a FNV hash, whose high bits barely change with the
+// last bytes of the input.
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
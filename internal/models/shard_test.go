@@ -0,0 +1,58 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hostMetric(host string) telegraf.Metric {
+	m, _ := metric.New("cpu", map[string]string{"host": host},
+		map[string]interface{}{"usage": 42.0}, time.Now())
+	return m
+}
+
+func TestShardAccept(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	counts := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		m := hostMetric(fmt.Sprintf("host%d", i))
+		accepted := 0
+		for _, name := range names {
+			s := &Shard{Tag: "host", Shards: names, Name: name}
+			if s.Accept(m) {
+				accepted++
+				counts[name]++
+			}
+		}
+		// every metric goes to exactly one shard
+		require.Equal(t, 1, accepted)
+	}
+	for _, name := range names {
+		assert.True(t, counts[name] > 50, "shard %s got %d metrics", name, counts[name])
+	}
+}
+
+func TestShardRemove(t *testing.T) {
+	before := &Shard{Tag: "host", Shards: []string{"a", "b", "c"}}
+	after := &Shard{Tag: "host", Shards: []string{"a", "c"}}
+	for i := 0; i < 300; i++ {
+		host := fmt.Sprintf("host%d", i)
+		// only the values of the removed shard move
+		if shard := before.shardOf(host); shard != "b" {
+			assert.Equal(t, shard, after.shardOf(host), host)
+		}
+	}
+}
+
+func TestShardValidate(t *testing.T) {
+	assert.NoError(t, (&Shard{Tag: "host", Shards: []string{"a", "b"}, Name: "b"}).Validate())
+	assert.Error(t, (&Shard{Shards: []string{"a", "b"}, Name: "b"}).Validate())
+	assert.Error(t, (&Shard{Tag: "host", Shards: []string{"a", "b"}, Name: "c"}).Validate())
+	assert.Error(t, (&Shard{Tag: "host", Shards: []string{"a", "a"}, Name: "a"}).Validate())
+}
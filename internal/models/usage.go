@@ -0,0 +1,78 @@
+package models
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// usageSampleEvery is the sampling rate of plugin resource usage, one call
+// in every usageSampleEvery is measured, 0 disables the measurement.
+var usageSampleEvery int64
+
+// SetUsageSampling measures the CPU time and the memory allocations of one
+// call in every n to the Gather, Apply and Write functions of the plugins.
+// 0 disables the measurement.
+func SetUsageSampling(n int) {
+	atomic.StoreInt64(&usageSampleEvery, int64(n))
+}
+
+// usage measures the resources used by the calls to a plugin and reports
+// the average per sampled call as internal metrics.
+//
+// Measuring is costly, runtime.ReadMemStats stops the world, hence the
+// sampling. The CPU time is the time spent by the thread running the call,
+// so work the plugin hands off to other goroutines is not accounted for, and
+// it is only available on linux. Allocations are process wide, they include
+// the allocations of the plugins running at the same time.
+type usage struct {
+	measurement string
+	tags        map[string]string
+	calls       int64
+
+	once       sync.Once
+	cpuTime    selfstat.Stat
+	allocs     selfstat.Stat
+	allocBytes selfstat.Stat
+}
+
+func newUsage(measurement string, tags map[string]string) *usage {
+	return &usage{measurement: measurement, tags: tags}
+}
+
+// measure calls f, measuring its resource usage if the call is sampled.
+func (u *usage) measure(f func()) {
+	every := atomic.LoadInt64(&usageSampleEvery)
+	if u == nil || every <= 0 || atomic.AddInt64(&u.calls, 1)%every != 0 {
+		f()
+		return
+	}
+
+	// the stats are only registered once sampling is enabled, so that they
+	// do not show up as zeros otherwise
+	u.once.Do(func() {
+		u.cpuTime = selfstat.RegisterTiming(u.measurement, "cpu_time_ns", u.tags)
+		u.allocs = selfstat.RegisterTiming(u.measurement, "allocs", u.tags)
+		u.allocBytes = selfstat.RegisterTiming(u.measurement, "alloc_bytes", u.tags)
+	})
+
+	// keep the goroutine on its thread so that the thread CPU time is the
+	// CPU time of the call
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start, ok := threadCPUTime()
+	f()
+	end, _ := threadCPUTime()
+	runtime.ReadMemStats(&after)
+
+	if ok {
+		u.cpuTime.Incr(int64(end - start))
+	}
+	u.allocs.Incr(int64(after.Mallocs - before.Mallocs))
+	u.allocBytes.Incr(int64(after.TotalAlloc - before.TotalAlloc))
+}
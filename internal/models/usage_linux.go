@@ -0,0 +1,20 @@
+// +build linux
+
+package models
+
+import (
+	"syscall"
+	"time"
+)
+
+// RUSAGE_THREAD is not defined by the syscall package
+const rusageThread = 1
+
+// threadCPUTime returns the user and system CPU time of the current thread.
+func threadCPUTime() (time.Duration, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(rusageThread, &ru); err != nil {
+		return 0, false
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), true
+}
@@ -0,0 +1,10 @@
+// +build !linux
+
+package models
+
+import "time"
+
+// threadCPUTime is only available on linux.
+func threadCPUTime() (time.Duration, bool) {
+	return 0, false
+}
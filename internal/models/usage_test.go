@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sink [][]byte
+
+func TestUsageDisabled(t *testing.T) {
+	u := newUsage("test_usage", map[string]string{"input": "disabled"})
+	called := false
+	u.measure(func() { called = true })
+	assert.True(t, called)
+	assert.Nil(t, u.allocs)
+}
+
+func TestUsageSampling(t *testing.T) {
+	SetUsageSampling(2)
+	defer SetUsageSampling(0)
+
+	u := newUsage("test_usage", map[string]string{"input": "sampled"})
+	calls := 0
+	for i := 0; i < 4; i++ {
+		u.measure(func() {
+			calls++
+			sink = append(sink, make([]byte, 1024))
+		})
+	}
+	assert.Equal(t, 4, calls)
+	// two calls out of four were measured, the timing stats average them
+	assert.True(t, u.allocs.Get() > 0)
+	assert.True(t, u.allocBytes.Get() >= 1024)
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/jsonschema"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/serializers/json"
+)
+
+// maxStringFieldSize is the maximum size of a string field accepted by
+// InfluxDB.
+const maxStringFieldSize = 64 * 1024
+
+// Validator checks the metrics of an output before they are written.
+type Validator interface {
+	Validate(m telegraf.Metric) error
+}
+
+// LineProtocolValidator checks that metrics serialize to valid line
+// protocol, which is parsed back to the same metric.
+type LineProtocolValidator struct{}
+
+func (v *LineProtocolValidator) Validate(m telegraf.Metric) error {
+	if m.Name() == "" {
+		return fmt.Errorf("empty measurement name")
+	}
+	for k, v := range m.Tags() {
+		if k == "" || v == "" {
+			return fmt.Errorf("empty tag key or value %q=%q", k, v)
+		}
+	}
+	fields := m.Fields()
+	if len(fields) == 0 {
+		return fmt.Errorf("no field")
+	}
+	for k, v := range fields {
+		switch v := v.(type) {
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("field %s is not a number: %v", k, v)
+			}
+		case string:
+			if len(v) > maxStringFieldSize {
+				return fmt.Errorf("string field %s longer than %d bytes",
+					k, maxStringFieldSize)
+			}
+		}
+	}
+
+	parsed, err := metric.Parse(m.Serialize())
+	if err != nil {
+		return err
+	}
+	if len(parsed) != 1 || parsed[0].Name() != m.Name() ||
+		len(parsed[0].Fields()) != len(fields) {
+		return fmt.Errorf("line protocol %q does not parse back to the metric",
+			m.Serialize())
+	}
+	return nil
+}
+
+// JSONSchemaValidator checks the JSON serialization of metrics against a
+// JSON schema.
+type JSONSchemaValidator struct {
+	Schema     *jsonschema.Schema
+	Serializer *json.JsonSerializer
+}
+
+func (v *JSONSchemaValidator) Validate(m telegraf.Metric) error {
+	b, err := v.Serializer.Serialize(m)
+	if err != nil {
+		return err
+	}
+	return v.Schema.ValidateBytes(b)
+}
@@ -0,0 +1,68 @@
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	internalaws "github.com/influxdata/telegraf/internal/config/aws"
+)
+
+// AWSSecretsManager is the store of the secrets of AWS Secrets Manager, the
+// key is the name or ARN of the secret, and the field of the JSON object of
+// the secret if it is one, ie telegraf/druid#password.
+type AWSSecretsManager struct {
+	Region    string `toml:"region"`
+	AccessKey string `toml:"access_key"`
+	SecretKey string `toml:"secret_key"`
+	RoleARN   string `toml:"role_arn"`
+	Profile   string `toml:"profile"`
+	Filename  string `toml:"shared_credential_file"`
+	Token     string `toml:"token"`
+
+	svc *secretsmanager.SecretsManager
+}
+
+func (a *AWSSecretsManager) Get(key string) (string, error) {
+	if a.svc == nil {
+		credentialConfig := &internalaws.CredentialConfig{
+			Region:    a.Region,
+			AccessKey: a.AccessKey,
+			SecretKey: a.SecretKey,
+			RoleARN:   a.RoleARN,
+			Profile:   a.Profile,
+			Filename:  a.Filename,
+			Token:     a.Token,
+		}
+		a.svc = secretsmanager.New(credentialConfig.Credentials())
+	}
+
+	name, field := splitField(key)
+	out, err := a.svc.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	secret := aws.StringValue(out.SecretString)
+	if out.SecretString == nil {
+		secret = string(out.SecretBinary)
+	}
+	if field == "" {
+		return secret, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object: %s", name, err)
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %s", name, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
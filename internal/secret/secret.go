@@ -0,0 +1,146 @@
+// Package secret resolves the references to secrets of the configuration,
+// strings such as "@secret:vault:kv/data/telegraf#password", with secret
+// stores.
+package secret
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const prefix = "@secret:"
+
+// Store is a secret store, which returns the secret of a key.
+type Store interface {
+	Get(key string) (string, error)
+}
+
+// Stores are the creators of the secret stores which are configured in the
+// [secretstores] table, by name.
+var Stores = map[string]func() Store{
+	"vault": func() Store { return &Vault{} },
+	"aws":   func() Store { return &AWSSecretsManager{} },
+}
+
+// IsReference returns whether s is a reference to a secret,
+// "@secret:<store>:<key>".
+func IsReference(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// splitField splits the key path#field of a secret with fields.
+func splitField(key string) (path, field string) {
+	if i := strings.LastIndex(key, "#"); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return key, ""
+}
+
+// Resolver resolves references to secrets with its stores, the env and file
+// stores are always available. It keeps the values of the references it
+// resolved to detect when they are rotated.
+type Resolver struct {
+	sync.Mutex
+	stores map[string]Store
+	values map[string]string
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		stores: map[string]Store{
+			"env":  Env{},
+			"file": File{},
+		},
+		values: make(map[string]string),
+	}
+}
+
+// AddStore adds the store s, referenced as name.
+func (r *Resolver) AddStore(name string, s Store) {
+	r.Lock()
+	defer r.Unlock()
+	r.stores[name] = s
+}
+
+// Resolve returns the secret of the reference ref.
+func (r *Resolver) Resolve(ref string) (string, error) {
+	r.Lock()
+	defer r.Unlock()
+	value, err := r.get(ref)
+	if err != nil {
+		return "", err
+	}
+	r.values[ref] = value
+	return value, nil
+}
+
+func (r *Resolver) get(ref string) (string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(ref, prefix), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("invalid secret %s, must be @secret:<store>:<key>", ref)
+	}
+	store, ok := r.stores[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("undefined secret store %s in %s", parts[0], ref)
+	}
+	value, err := store.Get(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("unable to get secret %s: %s", ref, err)
+	}
+	return value, nil
+}
+
+// Values returns the secrets of the references resolved so far.
+func (r *Resolver) Values() []string {
+	r.Lock()
+	defer r.Unlock()
+	values := make([]string, 0, len(r.values))
+	for _, value := range r.values {
+		values = append(values, value)
+	}
+	return values
+}
+
+// Changed returns whether the secret of a reference resolved so far has
+// changed. The references whose secret can not be got are logged and
+// considered unchanged.
+func (r *Resolver) Changed() bool {
+	r.Lock()
+	defer r.Unlock()
+	for ref, old := range r.values {
+		value, err := r.get(ref)
+		if err != nil {
+			log.Printf("W! %s", err)
+			continue
+		}
+		if value != old {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch checks every interval whether a secret has changed, until done is
+// closed. The returned channel is closed when one has.
+func (r *Resolver) Watch(interval time.Duration, done <-chan struct{}) <-chan struct{} {
+	changed := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if r.Changed() {
+					close(changed)
+					return
+				}
+			}
+		}
+	}()
+	return changed
+}
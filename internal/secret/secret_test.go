@@ -0,0 +1,104 @@
+package secret
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveEnv(t *testing.T) {
+	require.NoError(t, os.Setenv("TELEGRAF_TEST_SECRET", "s3cr3t"))
+	defer os.Unsetenv("TELEGRAF_TEST_SECRET")
+
+	r := NewResolver()
+	value, err := r.Resolve("@secret:env:TELEGRAF_TEST_SECRET")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	_, err = r.Resolve("@secret:env:TELEGRAF_TEST_UNSET")
+	assert.Error(t, err)
+	_, err = r.Resolve("@secret:env")
+	assert.Error(t, err)
+}
+
+func vaultServer(password *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/data/telegraf":
+			w.Write([]byte(`{"data":{"data":{"druid_pass":"` + *password +
+				`"},"metadata":{"version":1}}}`))
+		case "/v1/secret/telegraf":
+			w.Write([]byte(`{"data":{"druid_pass":"` + *password + `"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+}
+
+func TestVault(t *testing.T) {
+	password := "first"
+	ts := vaultServer(&password)
+	defer ts.Close()
+
+	r := NewResolver()
+	r.AddStore("vault", &Vault{Address: ts.URL, Token: "token"})
+
+	value, err := r.Resolve("@secret:vault:kv/data/telegraf#druid_pass")
+	require.NoError(t, err)
+	assert.Equal(t, "first", value)
+	value, err = r.Resolve("@secret:vault:secret/telegraf#druid_pass")
+	require.NoError(t, err)
+	assert.Equal(t, "first", value)
+
+	_, err = r.Resolve("@secret:vault:kv/data/telegraf#other")
+	assert.Error(t, err)
+	_, err = r.Resolve("@secret:vault:kv/data/missing#druid_pass")
+	assert.Error(t, err)
+	_, err = r.Resolve("@secret:vault:kv/data/telegraf")
+	assert.Error(t, err)
+
+	r.AddStore("denied", &Vault{Address: ts.URL, Token: "wrong"})
+	_, err = r.Resolve("@secret:denied:kv/data/telegraf#druid_pass")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "permission denied")
+}
+
+func TestWatch(t *testing.T) {
+	password := "first"
+	ts := vaultServer(&password)
+	defer ts.Close()
+
+	r := NewResolver()
+	r.AddStore("vault", &Vault{Address: ts.URL, Token: "token"})
+	_, err := r.Resolve("@secret:vault:kv/data/telegraf#druid_pass")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	defer close(done)
+	changed := r.Watch(10*time.Millisecond, done)
+	select {
+	case <-changed:
+		t.Fatal("secret reported as changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	r.Lock()
+	password = "rotated"
+	r.Unlock()
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("rotated secret not detected")
+	}
+}
@@ -0,0 +1,32 @@
+package secret
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Env is the store of the secrets in environment variables, the key is the
+// name of the variable.
+type Env struct{}
+
+func (Env) Get(key string) (string, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", key)
+	}
+	return value, nil
+}
+
+// File is the store of the secrets in files, the key is the path of the file,
+// whose trailing newlines are removed.
+type File struct{}
+
+func (File) Get(key string) (string, error) {
+	contents, err := ioutil.ReadFile(key)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(contents), "\r\n"), nil
+}
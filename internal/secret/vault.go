@@ -0,0 +1,135 @@
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+)
+
+// Vault is the store of the secrets of a HashiCorp Vault server, the key is
+// the API path of the secret and its field, ie kv/data/telegraf#password for
+// the password of the secret telegraf of the KV version 2 engine kv.
+type Vault struct {
+	// Address defaults to $VAULT_ADDR, Token to the contents of TokenFile,
+	// then to $VAULT_TOKEN.
+	Address   string
+	Token     string
+	TokenFile string `toml:"token_file"`
+	Timeout   internal.Duration
+
+	// Path to CA file
+	SSLCA string `toml:"ssl_ca"`
+	// Path to host cert file
+	SSLCert string `toml:"ssl_cert"`
+	// Path to cert key file
+	SSLKey string `toml:"ssl_key"`
+	// Use SSL but skip chain & host verification
+	InsecureSkipVerify bool
+
+	client *http.Client
+}
+
+func (v *Vault) Get(key string) (string, error) {
+	path, field := splitField(key)
+	if field == "" {
+		return "", errors.New("the key of a vault secret must be path#field")
+	}
+	if v.client == nil {
+		tlsCfg, err := internal.GetTLSConfig(
+			v.SSLCert, v.SSLKey, v.SSLCA, v.InsecureSkipVerify)
+		if err != nil {
+			return "", err
+		}
+		timeout := v.Timeout.Duration
+		if timeout == 0 {
+			timeout = 5 * time.Second
+		}
+		v.client = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsCfg},
+			Timeout:   timeout,
+		}
+	}
+
+	address := v.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return "", errors.New("the vault address is not set")
+	}
+	token, err := v.token()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("GET",
+		strings.TrimSuffix(address, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []string               `json:"errors"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(b, &body) == nil && len(body.Errors) > 0 {
+			return "", fmt.Errorf("vault returned HTTP status %s: %s",
+				resp.Status, strings.Join(body.Errors, ", "))
+		}
+		return "", fmt.Errorf("vault returned HTTP status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("unable to decode the vault response: %s", err)
+	}
+
+	// the KV version 2 engine returns the secret in data.data, with its
+	// metadata in data.metadata
+	data := body.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %s", path, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// token returns the token, the token file is read again for each secret as
+// it may be renewed by an agent.
+func (v *Vault) token() (string, error) {
+	if v.Token != "" {
+		return v.Token, nil
+	}
+	if v.TokenFile != "" {
+		token, err := File{}.Get(v.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("unable to read the vault token: %s", err)
+		}
+		return token, nil
+	}
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	return "", errors.New("the vault token is not set")
+}
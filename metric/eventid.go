@@ -0,0 +1,70 @@
+package metric
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"sort"
+	"strconv"
+
+	"github.com/influxdata/telegraf"
+)
+
+// EventID returns a deterministic ID of the metric m, the hex encoded first
+// 16 bytes of the SHA-256 of its name, tags, fields and timestamp. The same
+// metric sent again, ie when a write is retried, has the same ID, which can be
+// used downstream to drop the duplicates.
+func EventID(m telegraf.Metric) string {
+	h := sha256.New()
+	writeString(h, m.Name())
+
+	tags := m.Tags()
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeString(h, k)
+		writeString(h, tags[k])
+	}
+	h.Write([]byte{0})
+
+	fields := m.Fields()
+	keys = keys[:0]
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := make([]byte, 0, 32)
+	for _, k := range keys {
+		writeString(h, k)
+		// the type is part of the ID, 1i and 1.0 are different values
+		buf = buf[:0]
+		switch v := fields[k].(type) {
+		case int64:
+			buf = strconv.AppendInt(append(buf, 'i'), v, 10)
+		case uint64:
+			buf = strconv.AppendUint(append(buf, 'u'), v, 10)
+		case float64:
+			buf = strconv.AppendFloat(append(buf, 'f'), v, 'g', -1, 64)
+		case bool:
+			buf = strconv.AppendBool(append(buf, 'b'), v)
+		case string:
+			buf = append(append(buf, 's'), v...)
+		}
+		writeString(h, string(buf))
+	}
+	h.Write([]byte{0})
+
+	h.Write(strconv.AppendInt(nil, m.UnixNano(), 10))
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// writeString writes s to h prefixed by its length, so that the
+// concatenation of strings is not ambiguous.
+func writeString(h hash.Hash, s string) {
+	h.Write(strconv.AppendInt(nil, int64(len(s)), 10))
+	h.Write([]byte{':'})
+	h.Write([]byte(s))
+}
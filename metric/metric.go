@@ -351,6 +351,12 @@ func (m *metric) Fields() map[string]interface{} {
 				} else {
 					// TODO handle error or just ignore field silently?
 				}
+			case 'u':
+				// unsigned integer field
+				n, err := parseUintBytes(m.fields[i:][i2:i3-1], 10, 64)
+				if err == nil {
+					fieldMap[unescape(string(m.fields[i:][0:i1]), "fieldkey")] = n
+				}
 			default:
 				// float field
 				n, err := parseFloatBytes(m.fields[i:][i2:i3], 64)
@@ -580,15 +586,8 @@ func appendField(b []byte, k string, v interface{}) []byte {
 		b = strconv.AppendInt(b, int64(v), 10)
 		b = append(b, 'i')
 	case uint64:
-		// Cap uints above the maximum int value
-		var intv int64
-		if v <= uint64(MaxInt) {
-			intv = int64(v)
-		} else {
-			intv = int64(MaxInt)
-		}
-		b = strconv.AppendInt(b, intv, 10)
-		b = append(b, 'i')
+		b = strconv.AppendUint(b, v, 10)
+		b = append(b, 'u')
 	case uint32:
 		b = strconv.AppendInt(b, int64(v), 10)
 		b = append(b, 'i')
@@ -599,15 +598,8 @@ func appendField(b []byte, k string, v interface{}) []byte {
 		b = strconv.AppendInt(b, int64(v), 10)
 		b = append(b, 'i')
 	case uint:
-		// Cap uints above the maximum int value
-		var intv int64
-		if v <= uint(MaxInt) {
-			intv = int64(v)
-		} else {
-			intv = int64(MaxInt)
-		}
-		b = strconv.AppendInt(b, intv, 10)
-		b = append(b, 'i')
+		b = strconv.AppendUint(b, uint64(v), 10)
+		b = append(b, 'u')
 	case float32:
 		b = strconv.AppendFloat(b, float64(v), 'f', -1, 32)
 	case []byte:
@@ -621,3 +613,47 @@ func appendField(b []byte, k string, v interface{}) []byte {
 
 	return b
 }
+
+// UintToInt returns m with its unsigned integer fields converted to integers,
+// capped to the maximum integer, for the consumers that do not support
+// unsigned integers such as InfluxDB before 1.4. m is returned as is if it
+// has no unsigned integer field.
+func UintToInt(m telegraf.Metric) telegraf.Metric {
+	if mm, ok := m.(*metric); ok && !hasUint(mm.fields) {
+		return m
+	}
+
+	fields := m.Fields()
+	converted := false
+	for k, v := range fields {
+		if v, ok := v.(uint64); ok {
+			if v > uint64(MaxInt) {
+				v = uint64(MaxInt)
+			}
+			fields[k] = int64(v)
+			converted = true
+		}
+	}
+	if !converted {
+		return m
+	}
+
+	out, err := New(m.Name(), m.Tags(), fields, m.Time(), m.Type())
+	if err != nil {
+		return m
+	}
+	out.SetAggregate(m.IsAggregate())
+	return out
+}
+
+// hasUint returns whether the fields may contain an unsigned integer: a
+// digit followed by an u ending a value. It can be fooled by string values.
+func hasUint(fields []byte) bool {
+	for i := 1; i < len(fields); i++ {
+		if fields[i] == 'u' && isNumeric(fields[i-1]) &&
+			(i == len(fields)-1 || fields[i+1] == ',') {
+			return true
+		}
+	}
+	return false
+}
@@ -188,6 +188,40 @@ func TestHashID_Consistency(t *testing.T) {
 	}
 }
 
+func TestEventID(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	m, _ := New("cpu",
+		map[string]string{"host": "a", "cpu": "cpu0"},
+		map[string]interface{}{"usage": float64(1), "count": int64(2)},
+		now)
+	id := EventID(m)
+	assert.Len(t, id, 32)
+
+	// the same metric, with tags and fields in another order, has the
+	// same ID
+	m2, _ := New("cpu",
+		map[string]string{"cpu": "cpu0", "host": "a"},
+		map[string]interface{}{"count": int64(2), "usage": float64(1)},
+		now)
+	assert.Equal(t, id, EventID(m2))
+
+	for _, other := range []struct {
+		name   string
+		tags   map[string]string
+		fields map[string]interface{}
+		t      time.Time
+	}{
+		{"mem", m.Tags(), m.Fields(), now},
+		{"cpu", map[string]string{"host": "b", "cpu": "cpu0"}, m.Fields(), now},
+		{"cpu", map[string]string{"hos": "ta", "cpu": "cpu0"}, m.Fields(), now},
+		{"cpu", m.Tags(), map[string]interface{}{"usage": int64(1), "count": int64(2)}, now},
+		{"cpu", m.Tags(), m.Fields(), now.Add(time.Nanosecond)},
+	} {
+		m3, _ := New(other.name, other.tags, other.fields, other.t)
+		assert.NotEqual(t, id, EventID(m3))
+	}
+}
+
 func TestNewMetric_NameModifiers(t *testing.T) {
 	now := time.Now()
 	tags := map[string]string{}
@@ -342,14 +376,46 @@ func TestNewMetric_AllTypes(t *testing.T) {
 	assert.Contains(t, m.String(), "int16=1i")
 	assert.Contains(t, m.String(), "int8=1i")
 	assert.Contains(t, m.String(), "int=1i")
-	assert.Contains(t, m.String(), "uint64=1i")
+	assert.Contains(t, m.String(), "uint64=1u")
 	assert.Contains(t, m.String(), "uint32=1i")
 	assert.Contains(t, m.String(), "uint16=1i")
 	assert.Contains(t, m.String(), "uint8=1i")
-	assert.Contains(t, m.String(), "uint=1i")
+	assert.Contains(t, m.String(), "uint=1u")
 	assert.NotContains(t, m.String(), "nil")
-	assert.Contains(t, m.String(), fmt.Sprintf("maxuint64=%di", MaxInt))
-	assert.Contains(t, m.String(), fmt.Sprintf("maxuint=%di", MaxInt))
+	assert.Contains(t, m.String(), fmt.Sprintf("maxuint64=%du", uint64(MaxInt)+10))
+	assert.Contains(t, m.String(), fmt.Sprintf("maxuint=%du", uint64(MaxInt)+10))
+}
+
+func TestNewMetricUintFields(t *testing.T) {
+	now := time.Now()
+	m, err := New("cpu", nil, map[string]interface{}{
+		"small": uint64(1),
+		"large": uint64(MaxInt) + 10,
+		"int":   int64(-1),
+		"s":     "1u",
+	}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"small": uint64(1),
+		"large": uint64(MaxInt) + 10,
+		"int":   int64(-1),
+		"s":     "1u",
+	}, m.Fields())
+
+	converted := UintToInt(m)
+	assert.Equal(t, map[string]interface{}{
+		"small": int64(1),
+		"large": int64(MaxInt),
+		"int":   int64(-1),
+		"s":     "1u",
+	}, converted.Fields())
+	assert.Equal(t, m.Name(), converted.Name())
+	assert.Equal(t, now.UnixNano(), converted.UnixNano())
+
+	// metrics without unsigned fields are not copied
+	m, err = New("cpu", nil, map[string]interface{}{"s": "1u", "f": 1.0}, now)
+	assert.NoError(t, err)
+	assert.True(t, m == UintToInt(m))
 }
 
 func TestIndexUnescapedByte(t *testing.T) {
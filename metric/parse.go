@@ -21,6 +21,9 @@ const (
 	// the number of characters for the smallest possible int64 (-9223372036854775808)
 	minInt64Digits = 20
 
+	// the number of characters for the largest possible uint64 (18446744073709551615)
+	maxUint64Digits = 20
+
 	// the number of characters required for the largest float64 before a range check
 	// would occur during parsing
 	maxFloat64Digits = 25
@@ -464,7 +467,7 @@ func isNumeric(b byte) bool {
 // error if a invalid number is scanned.
 func scanNumber(buf []byte, i int) (int, error) {
 	start := i
-	var isInt bool
+	var isInt, isUnsigned bool
 
 	// Is negative number?
 	if i < len(buf) && buf[i] == '-' {
@@ -496,6 +499,13 @@ func scanNumber(buf []byte, i int) (int, error) {
 			continue
 		}
 
+		if buf[i] == 'u' && i > start && !isInt {
+			isInt = true
+			isUnsigned = true
+			i++
+			continue
+		}
+
 		if buf[i] == '.' {
 			// Can't have more than 1 decimal (e.g. 1.1.1 should fail)
 			if decimal {
@@ -531,6 +541,9 @@ func scanNumber(buf []byte, i int) (int, error) {
 	if isInt && (decimal || scientific) {
 		return i, ErrInvalidNumber
 	}
+	if isUnsigned && buf[start] == '-' {
+		return i, ErrInvalidNumber
+	}
 
 	numericDigits := i - start
 	if isInt {
@@ -551,7 +564,17 @@ func scanNumber(buf []byte, i int) (int, error) {
 	// out or range numbers from being parsed successfully.  This uses some simple heuristics to decide
 	// if we should parse the number to the actual type.  It does not do it all the time because it incurs
 	// extra allocations and we end up converting the type again when writing points to disk.
-	if isInt {
+	if isUnsigned {
+		// Make sure the last char is an 'u' for unsigned integers
+		if buf[i-1] != 'u' {
+			return i, ErrInvalidNumber
+		}
+		if len(buf[start:i-1]) >= maxUint64Digits {
+			if _, err := parseUintBytes(buf[start:i-1], 10, 64); err != nil {
+				return i, makeError(fmt.Sprintf("unable to parse unsigned integer %s: %s", buf[start:i-1], err), buf, i)
+			}
+		}
+	} else if isInt {
 		// Make sure the last char is an 'i' for integers (e.g. 9i10 is not valid)
 		if buf[i-1] != 'i' {
 			return i, ErrInvalidNumber
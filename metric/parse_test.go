@@ -231,6 +231,17 @@ func TestParseFalseBooleans(t *testing.T) {
 	}
 }
 
+func TestParseUnsigned(t *testing.T) {
+	metrics, err := Parse([]byte("test a=1u,b=18446744073709551615u,c=-1i\n"))
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, map[string]interface{}{
+		"a": uint64(1),
+		"b": uint64(18446744073709551615),
+		"c": int64(-1),
+	}, metrics[0].Fields())
+}
+
 func TestParsePointBadNumber(t *testing.T) {
 	for _, tt := range []string{
 		"cpu v=- ",
@@ -348,6 +359,10 @@ func TestParseInvalidNumbers(t *testing.T) {
 		"test b=nan",
 		"test b=9i10",
 		"test b=9999999999999999999i",
+		"test b=-1u",
+		"test b=1.5u",
+		"test b=1ui",
+		"test b=18446744073709551616u",
 	} {
 		_, err := Parse([]byte(tt + "\n"))
 		assert.Error(t, err, tt)
@@ -1,6 +1,10 @@
 package all
 
 import (
+	_ "github.com/influxdata/telegraf/plugins/aggregators/ewma"
+	_ "github.com/influxdata/telegraf/plugins/aggregators/heartbeat"
 	_ "github.com/influxdata/telegraf/plugins/aggregators/histogram"
 	_ "github.com/influxdata/telegraf/plugins/aggregators/minmax"
+	_ "github.com/influxdata/telegraf/plugins/aggregators/rollup"
+	_ "github.com/influxdata/telegraf/plugins/aggregators/topk"
 )
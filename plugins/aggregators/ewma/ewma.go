@@ -0,0 +1,177 @@
+package ewma
+
+import (
+	"log"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/plugins/aggregators"
+)
+
+const defaultAlpha = 0.3
+
+// EWMA smooths the fields of each series with an exponentially weighted
+// moving average, which is emitted at the end of each period. The averages
+// are kept across the periods.
+type EWMA struct {
+	Alpha             float64  `toml:"alpha"`
+	Fields            []string `toml:"fields"`
+	Suffix            string   `toml:"suffix"`
+	MaxMissingPeriods int      `toml:"max_missing_periods"`
+
+	fieldFilter filter.Filter
+	initialized bool
+
+	cache map[uint64]*series
+}
+
+type series struct {
+	name   string
+	tags   map[string]string
+	fields map[string]float64
+
+	// seen is true if the series produced data during the current period
+	seen bool
+	// missing is the number of consecutive periods without data
+	missing int
+}
+
+func NewEWMA() telegraf.Aggregator {
+	e := &EWMA{
+		Alpha:             defaultAlpha,
+		Suffix:            "_ewma",
+		MaxMissingPeriods: 10,
+	}
+	e.cache = make(map[uint64]*series)
+	return e
+}
+
+var sampleConfig = `
+  ## General Aggregator Arguments:
+  ## The period on which to emit the averages.
+  period = "30s"
+  ## If true, the original metric will be dropped by the
+  ## aggregator and will not get sent to the output plugins.
+  drop_original = false
+
+  ## Weight of each new value, between 0 and 1: the higher, the faster the
+  ## average follows the values.
+  alpha = 0.3
+
+  ## Fields averaged, glob patterns are supported. All the numeric fields
+  ## by default.
+  # fields = ["usage_*", "load1"]
+
+  ## Suffix added to the names of the averaged fields.
+  # suffix = "_ewma"
+
+  ## Forget the averages of the series that did not produce data for this
+  ## many consecutive periods, 0 keeps them forever.
+  # max_missing_periods = 10
+`
+
+func (e *EWMA) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *EWMA) Description() string {
+	return "Smooth fields with an exponentially weighted moving average."
+}
+
+func (e *EWMA) init() {
+	e.initialized = true
+	if e.Alpha <= 0 || e.Alpha > 1 {
+		log.Printf("E! [aggregators.ewma] invalid alpha %v, must be in ]0, 1], "+
+			"using %v", e.Alpha, defaultAlpha)
+		e.Alpha = defaultAlpha
+	}
+	f, err := filter.Compile(e.Fields)
+	if err != nil {
+		log.Printf("E! [aggregators.ewma] invalid fields %v, all the "+
+			"numeric fields are averaged: %s", e.Fields, err)
+		return
+	}
+	e.fieldFilter = f
+}
+
+func (e *EWMA) Add(in telegraf.Metric) {
+	if !e.initialized {
+		e.init()
+	}
+
+	id := in.HashID()
+	s, ok := e.cache[id]
+	if !ok {
+		s = &series{
+			name:   in.Name(),
+			tags:   in.Tags(),
+			fields: make(map[string]float64),
+		}
+		e.cache[id] = s
+	}
+	for k, v := range in.Fields() {
+		if e.fieldFilter != nil && !e.fieldFilter.Match(k) {
+			continue
+		}
+		fv, ok := convert(v)
+		if !ok {
+			continue
+		}
+		if avg, ok := s.fields[k]; ok {
+			s.fields[k] = avg + e.Alpha*(fv-avg)
+		} else {
+			// the first value starts the average
+			s.fields[k] = fv
+		}
+	}
+	s.seen = true
+	s.missing = 0
+}
+
+// Push emits the averages of the series which produced data during the
+// period.
+func (e *EWMA) Push(acc telegraf.Accumulator) {
+	for _, s := range e.cache {
+		if !s.seen || len(s.fields) == 0 {
+			continue
+		}
+		fields := make(map[string]interface{}, len(s.fields))
+		for k, v := range s.fields {
+			fields[k+e.Suffix] = v
+		}
+		acc.AddFields(s.name, fields, s.tags)
+	}
+}
+
+// Reset starts a new period, the averages are kept.
+func (e *EWMA) Reset() {
+	for id, s := range e.cache {
+		if !s.seen {
+			s.missing++
+		}
+		if e.MaxMissingPeriods > 0 && s.missing >= e.MaxMissingPeriods {
+			delete(e.cache, id)
+			continue
+		}
+		s.seen = false
+	}
+}
+
+func convert(in interface{}) (float64, bool) {
+	switch v := in.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	aggregators.Add("ewma", func() telegraf.Aggregator {
+		return NewEWMA()
+	})
+}
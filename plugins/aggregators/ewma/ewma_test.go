@@ -0,0 +1,86 @@
+package ewma
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMetric(t *testing.T, fields map[string]interface{}) telegraf.Metric {
+	m, err := metric.New("cpu", map[string]string{"cpu": "cpu0"}, fields, time.Now())
+	require.NoError(t, err)
+	return m
+}
+
+// Test that the average is kept across the periods
+func TestEWMA(t *testing.T) {
+	e := NewEWMA().(*EWMA)
+	e.Alpha = 0.5
+
+	e.Add(newMetric(t, map[string]interface{}{"usage": 10.0, "host": "a"}))
+	e.Add(newMetric(t, map[string]interface{}{"usage": int64(20)}))
+	acc := testutil.Accumulator{}
+	e.Push(&acc)
+	e.Reset()
+	acc.AssertContainsTaggedFields(t, "cpu",
+		map[string]interface{}{"usage_ewma": 15.0},
+		map[string]string{"cpu": "cpu0"})
+
+	e.Add(newMetric(t, map[string]interface{}{"usage": 25.0}))
+	acc.ClearMetrics()
+	e.Push(&acc)
+	e.Reset()
+	acc.AssertContainsFields(t, "cpu", map[string]interface{}{"usage_ewma": 20.0})
+
+	// the series without data during the period are not emitted
+	acc.ClearMetrics()
+	e.Push(&acc)
+	assert.Equal(t, uint64(0), acc.NMetrics())
+}
+
+func TestEWMAUnsigned(t *testing.T) {
+	e := NewEWMA().(*EWMA)
+	e.Alpha = 0.5
+
+	e.Add(newMetric(t, map[string]interface{}{"bytes": uint64(10)}))
+	e.Add(newMetric(t, map[string]interface{}{"bytes": uint64(1 << 63)}))
+	acc := testutil.Accumulator{}
+	e.Push(&acc)
+	acc.AssertContainsFields(t, "cpu",
+		map[string]interface{}{"bytes_ewma": 5 + float64(1<<62)})
+}
+
+func TestEWMAFields(t *testing.T) {
+	e := NewEWMA().(*EWMA)
+	e.Fields = []string{"usage_*"}
+	e.Suffix = "_smooth"
+
+	e.Add(newMetric(t, map[string]interface{}{"usage_user": 10.0, "load": 1.0}))
+	acc := testutil.Accumulator{}
+	e.Push(&acc)
+	acc.AssertContainsFields(t, "cpu", map[string]interface{}{"usage_user_smooth": 10.0})
+}
+
+func TestEWMAMaxMissingPeriods(t *testing.T) {
+	e := NewEWMA().(*EWMA)
+	e.MaxMissingPeriods = 2
+
+	e.Add(newMetric(t, map[string]interface{}{"usage": 10.0}))
+	e.Reset()
+	e.Reset()
+	assert.Len(t, e.cache, 1)
+	e.Reset()
+	assert.Len(t, e.cache, 0)
+}
+
+func TestEWMAInvalidAlpha(t *testing.T) {
+	e := NewEWMA().(*EWMA)
+	e.Alpha = 2
+	e.Add(newMetric(t, map[string]interface{}{"usage": 10.0}))
+	assert.Equal(t, defaultAlpha, e.Alpha)
+}
@@ -0,0 +1,126 @@
+package heartbeat
+
+import (
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/aggregators"
+)
+
+// Heartbeat remembers every series it has seen and, at the end of each
+// period, emits a default value for the series that did not produce any
+// data during that period.
+type Heartbeat struct {
+	DefaultValue      float64 `toml:"default_value"`
+	PresentField      string  `toml:"present_field"`
+	MaxMissingPeriods int     `toml:"max_missing_periods"`
+
+	cache map[uint64]*series
+}
+
+type series struct {
+	name   string
+	tags   map[string]string
+	fields map[string]bool
+
+	// seen is true if the series produced data during the current period
+	seen bool
+	// missing is the number of consecutive periods without data
+	missing int
+}
+
+func NewHeartbeat() telegraf.Aggregator {
+	hb := &Heartbeat{}
+	hb.cache = make(map[uint64]*series)
+	return hb
+}
+
+var sampleConfig = `
+  ## General Aggregator Arguments:
+  ## The period on which to check for missing series.
+  period = "30s"
+  ## If true, the original metric will be dropped by the
+  ## aggregator and will not get sent to the output plugins.
+  drop_original = false
+
+  ## Value emitted for every field of a series that did not produce any data
+  ## during the period.
+  default_value = 0.0
+
+  ## If set, instead of filling every field with default_value, a single
+  ## field with this name is emitted for every series: 1 if the series
+  ## produced data during the period, 0 if it did not.
+  # present_field = "present"
+
+  ## Forget series that did not produce data for this many consecutive
+  ## periods, 0 keeps them forever.
+  max_missing_periods = 0
+`
+
+func (h *Heartbeat) SampleConfig() string {
+	return sampleConfig
+}
+
+func (h *Heartbeat) Description() string {
+	return "Emit a default value for series that stopped producing data."
+}
+
+func (h *Heartbeat) Add(in telegraf.Metric) {
+	id := in.HashID()
+	s, ok := h.cache[id]
+	if !ok {
+		s = &series{
+			name:   in.Name(),
+			tags:   in.Tags(),
+			fields: make(map[string]bool),
+		}
+		h.cache[id] = s
+	}
+	for k := range in.Fields() {
+		s.fields[k] = true
+	}
+	s.seen = true
+	s.missing = 0
+}
+
+func (h *Heartbeat) Push(acc telegraf.Accumulator) {
+	for _, s := range h.cache {
+		if h.PresentField != "" {
+			var present int64
+			if s.seen {
+				present = 1
+			}
+			acc.AddFields(s.name,
+				map[string]interface{}{h.PresentField: present}, s.tags)
+			continue
+		}
+
+		if s.seen {
+			continue
+		}
+		fields := make(map[string]interface{}, len(s.fields))
+		for k := range s.fields {
+			fields[k] = h.DefaultValue
+		}
+		acc.AddFields(s.name, fields, s.tags)
+	}
+}
+
+// Reset starts a new period, the series are kept so that their absence can
+// be detected in the next period.
+func (h *Heartbeat) Reset() {
+	for id, s := range h.cache {
+		if !s.seen {
+			s.missing++
+		}
+		if h.MaxMissingPeriods > 0 && s.missing >= h.MaxMissingPeriods {
+			delete(h.cache, id)
+			continue
+		}
+		s.seen = false
+	}
+}
+
+func init() {
+	aggregators.Add("heartbeat", func() telegraf.Aggregator {
+		return NewHeartbeat()
+	})
+}
@@ -0,0 +1,95 @@
+package heartbeat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+var m1, _ = metric.New("statsd_requests",
+	map[string]string{"service": "api"},
+	map[string]interface{}{
+		"value": int64(10),
+		"rate":  float64(1),
+	},
+	time.Now(),
+)
+var m2, _ = metric.New("statsd_requests",
+	map[string]string{"service": "web"},
+	map[string]interface{}{
+		"value": int64(3),
+	},
+	time.Now(),
+)
+
+// Test that only the series missing from the period get a default value
+func TestHeartbeatFillsMissingSeries(t *testing.T) {
+	acc := testutil.Accumulator{}
+	hb := NewHeartbeat()
+
+	hb.Add(m1)
+	hb.Add(m2)
+	hb.Push(&acc)
+	hb.Reset()
+	assert.Equal(t, uint64(0), acc.NMetrics())
+
+	hb.Add(m2)
+	hb.Push(&acc)
+	hb.Reset()
+
+	assert.Equal(t, uint64(1), acc.NMetrics())
+	acc.AssertContainsTaggedFields(t, "statsd_requests",
+		map[string]interface{}{
+			"value": float64(0),
+			"rate":  float64(0),
+		},
+		map[string]string{"service": "api"},
+	)
+}
+
+// Test the present field mode
+func TestHeartbeatPresentField(t *testing.T) {
+	acc := testutil.Accumulator{}
+	hb := &Heartbeat{PresentField: "present", cache: make(map[uint64]*series)}
+
+	hb.Add(m1)
+	hb.Add(m2)
+	hb.Reset()
+
+	hb.Add(m2)
+	hb.Push(&acc)
+
+	acc.AssertContainsTaggedFields(t, "statsd_requests",
+		map[string]interface{}{"present": int64(0)},
+		map[string]string{"service": "api"},
+	)
+	acc.AssertContainsTaggedFields(t, "statsd_requests",
+		map[string]interface{}{"present": int64(1)},
+		map[string]string{"service": "web"},
+	)
+}
+
+// Test that series are forgotten after max_missing_periods
+func TestHeartbeatMaxMissingPeriods(t *testing.T) {
+	acc := testutil.Accumulator{}
+	hb := &Heartbeat{MaxMissingPeriods: 2, cache: make(map[uint64]*series)}
+
+	hb.Add(m1)
+	hb.Reset()
+	hb.Push(&acc)
+	hb.Reset()
+	assert.Equal(t, uint64(1), acc.NMetrics())
+
+	acc.ClearMetrics()
+	hb.Push(&acc)
+	hb.Reset()
+	assert.Equal(t, uint64(1), acc.NMetrics())
+
+	acc.ClearMetrics()
+	hb.Push(&acc)
+	hb.Reset()
+	assert.Equal(t, uint64(0), acc.NMetrics())
+}
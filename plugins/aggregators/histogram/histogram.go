@@ -18,6 +18,11 @@ const bucketInf = "+Inf"
 type HistogramAggregator struct {
 	Configs []config `toml:"config"`
 
+	// ResetBuckets resets the counts at every period
+	ResetBuckets bool `toml:"reset"`
+	// SumAndCount adds the count and sum of the values of the fields
+	SumAndCount bool `toml:"sum_and_count"`
+
 	buckets bucketsByMetrics
 	cache   map[uint64]metricHistogramCollection
 }
@@ -41,6 +46,7 @@ type buckets []float64
 // metricHistogramCollection aggregates the histogram data
 type metricHistogramCollection struct {
 	histogramCollection map[string]counts
+	sums                map[string]float64
 	name                string
 	tags                map[string]string
 }
@@ -72,6 +78,16 @@ var sampleConfig = `
   ## aggregator and will not get sent to the output plugins.
   drop_original = false
 
+  ## If true, the counts are reset at every period, otherwise they keep
+  ## increasing while telegraf is running, like the counts of a prometheus
+  ## histogram.
+  # reset = false
+
+  ## If true, a metric without "le" tag holds the <field>_count and
+  ## <field>_sum fields, the number and the sum of the values, so that the
+  ## histograms are complete prometheus histograms.
+  # sum_and_count = false
+
   ## Example config that aggregates all fields of the metric.
   # [[aggregators.histogram.config]]
   #   ## The set of buckets.
@@ -120,6 +136,7 @@ func (h *HistogramAggregator) Add(in telegraf.Metric) {
 			name:                in.Name(),
 			tags:                in.Tags(),
 			histogramCollection: make(map[string]counts),
+			sums:                make(map[string]float64),
 		}
 	}
 
@@ -132,6 +149,7 @@ func (h *HistogramAggregator) Add(in telegraf.Metric) {
 			if value, ok := convert(value); ok {
 				index := sort.SearchFloat64s(buckets, value)
 				agr.histogramCollection[field][index]++
+				agr.sums[field] += value
 			}
 		}
 	}
@@ -152,6 +170,21 @@ func (h *HistogramAggregator) Push(acc telegraf.Accumulator) {
 	for _, metric := range metricsWithGroupedFields {
 		acc.AddFields(metric.name, makeFieldsWithCount(metric.fieldsWithCount), metric.tags)
 	}
+
+	if h.SumAndCount {
+		for _, aggregate := range h.cache {
+			fields := make(map[string]interface{})
+			for field, counts := range aggregate.histogramCollection {
+				count := int64(0)
+				for _, c := range counts {
+					count += c
+				}
+				fields[field+"_count"] = count
+				fields[field+"_sum"] = aggregate.sums[field]
+			}
+			acc.AddFields(aggregate.name, fields, copyTags(aggregate.tags))
+		}
+	}
 }
 
 // groupFieldsByBuckets groups fields by metric buckets which are represented as tags
@@ -201,9 +234,13 @@ func (h *HistogramAggregator) groupField(
 	)
 }
 
-// Reset does nothing, because we need to collect counts for a long time, otherwise if config parameter 'reset' has
-// small value, we will get a histogram with a small amount of the distribution.
-func (h *HistogramAggregator) Reset() {}
+// Reset does nothing unless the reset option is set, because we need to collect counts for a long time, otherwise
+// if config parameter 'period' has small value, we will get a histogram with a small amount of the distribution.
+func (h *HistogramAggregator) Reset() {
+	if h.ResetBuckets {
+		h.resetCache()
+	}
+}
 
 // resetCache resets cached counts(hits) in the buckets
 func (h *HistogramAggregator) resetCache() {
@@ -267,6 +304,8 @@ func convert(in interface{}) (float64, bool) {
 		return v, true
 	case int64:
 		return float64(v), true
+	case uint64:
+		return float64(v), true
 	default:
 		return 0, false
 	}
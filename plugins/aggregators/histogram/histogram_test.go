@@ -152,6 +152,90 @@ func TestHistogramDifferentPeriodsAndAllFields(t *testing.T) {
 	assertContainsTaggedField(t, acc, "first_metric_name", map[string]interface{}{"a_bucket": int64(2), "b_bucket": int64(1), "c_bucket": int64(1)}, bucketInf)
 }
 
+// TestHistogramWithReset tests that the counts are reset between periods with the reset option
+func TestHistogramWithReset(t *testing.T) {
+	var cfg []config
+	cfg = append(cfg, config{Metric: "first_metric_name", Fields: []string{"a"}, Buckets: []float64{0.0, 10.0, 20.0}})
+	histogram := NewTestHistogram(cfg)
+	histogram.(*HistogramAggregator).ResetBuckets = true
+
+	acc := &testutil.Accumulator{}
+	histogram.Add(firstMetric1)
+	histogram.Push(acc)
+	histogram.Reset()
+
+	assertContainsTaggedField(t, acc, "first_metric_name", map[string]interface{}{"a_bucket": int64(1)}, "20")
+
+	acc.ClearMetrics()
+	histogram.Add(firstMetric2)
+	histogram.Push(acc)
+	histogram.Reset()
+
+	assertContainsTaggedField(t, acc, "first_metric_name", map[string]interface{}{"a_bucket": int64(1)}, "20")
+	assertContainsTaggedField(t, acc, "first_metric_name", map[string]interface{}{"a_bucket": int64(1)}, bucketInf)
+
+	acc.ClearMetrics()
+	histogram.Push(acc)
+	assert.Len(t, acc.Metrics, 0)
+}
+
+// TestHistogramWithSumAndCount tests the count and sum fields
+func TestHistogramWithSumAndCount(t *testing.T) {
+	var cfg []config
+	cfg = append(cfg, config{Metric: "first_metric_name", Buckets: []float64{0.0, 20.0, 40.0}})
+	histogram := NewTestHistogram(cfg)
+	histogram.(*HistogramAggregator).SumAndCount = true
+
+	acc := &testutil.Accumulator{}
+	histogram.Add(firstMetric1)
+	histogram.Add(firstMetric2)
+	histogram.Push(acc)
+
+	if len(acc.Metrics) != 5 {
+		assert.Fail(t, "Incorrect number of metrics")
+	}
+	assertContainsTaggedField(t, acc, "first_metric_name", map[string]interface{}{"a_bucket": int64(2), "b_bucket": int64(0), "c_bucket": int64(0)}, "20")
+	acc.AssertContainsTaggedFields(t, "first_metric_name",
+		map[string]interface{}{
+			"a_count": int64(2),
+			"a_sum":   firstMetric1.Fields()["a"].(float64) + firstMetric2.Fields()["a"].(float64),
+			"b_count": int64(1),
+			"b_sum":   float64(40),
+			"c_count": int64(1),
+			"c_sum":   float64(40),
+		},
+		map[string]string{"tag_name": "tag_value"})
+}
+
+// TestHistogramUnsigned tests the unsigned integer fields
+func TestHistogramUnsigned(t *testing.T) {
+	var cfg []config
+	cfg = append(cfg, config{Metric: "unsigned_metric_name", Buckets: []float64{0.0, 20.0, 40.0}})
+	histogram := NewTestHistogram(cfg)
+	histogram.(*HistogramAggregator).SumAndCount = true
+
+	acc := &testutil.Accumulator{}
+	for _, v := range []uint64{15, 30, 1 << 63} {
+		m, _ := metric.New("unsigned_metric_name",
+			map[string]string{"tag_name": "tag_value"},
+			map[string]interface{}{"a": v},
+			time.Now(),
+		)
+		histogram.Add(m)
+	}
+	histogram.Push(acc)
+
+	assertContainsTaggedField(t, acc, "unsigned_metric_name", map[string]interface{}{"a_bucket": int64(1)}, "20")
+	assertContainsTaggedField(t, acc, "unsigned_metric_name", map[string]interface{}{"a_bucket": int64(2)}, "40")
+	assertContainsTaggedField(t, acc, "unsigned_metric_name", map[string]interface{}{"a_bucket": int64(3)}, bucketInf)
+	acc.AssertContainsTaggedFields(t, "unsigned_metric_name",
+		map[string]interface{}{
+			"a_count": int64(3),
+			"a_sum":   float64(45) + float64(1<<63),
+		},
+		map[string]string{"tag_name": "tag_value"})
+}
+
 // TestWrongBucketsOrder tests the calling panic with incorrect order of buckets
 func TestWrongBucketsOrder(t *testing.T) {
 	defer func() {
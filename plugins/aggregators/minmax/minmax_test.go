@@ -160,3 +160,28 @@ func TestMinMaxDifferentPeriods(t *testing.T) {
 	}
 	acc.AssertContainsTaggedFields(t, "m1", expectedFields, expectedTags)
 }
+
+// Test the unsigned integer fields.
+func TestMinMaxUnsigned(t *testing.T) {
+	acc := testutil.Accumulator{}
+	minmax := NewMinMax()
+
+	for _, v := range []uint64{3, 1, 1 << 63} {
+		m, _ := metric.New("m1",
+			map[string]string{"foo": "bar"},
+			map[string]interface{}{"a": v},
+			time.Now(),
+		)
+		minmax.Add(m)
+	}
+	minmax.Push(&acc)
+
+	expectedFields := map[string]interface{}{
+		"a_max": float64(1 << 63),
+		"a_min": float64(1),
+	}
+	expectedTags := map[string]string{
+		"foo": "bar",
+	}
+	acc.AssertContainsTaggedFields(t, "m1", expectedFields, expectedTags)
+}
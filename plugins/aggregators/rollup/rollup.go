@@ -0,0 +1,212 @@
+package rollup
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/plugins/aggregators"
+)
+
+// Rollup merges, over each period, the series of a measurement differing
+// only in the values of some tags, ie the series of every host, and emits
+// the sum or mean of their fields as a single series without these tags.
+type Rollup struct {
+	DropTags    []string `toml:"drop_tags"`
+	Aggregation string   `toml:"aggregation"`
+	Fields      []string `toml:"fields"`
+	SeriesField string   `toml:"series_field"`
+
+	fieldFilter filter.Filter
+	initialized bool
+	// warned is set once an invalid configuration has been logged
+	warned bool
+
+	cache map[string]*group
+}
+
+// group holds the series merged into a rolled up series, by their id.
+type group struct {
+	name   string
+	tags   map[string]string
+	series map[uint64]map[string]*stat
+}
+
+// stat is the sum and count of the values of a field of a series over the
+// period.
+type stat struct {
+	sum   float64
+	count int64
+}
+
+func NewRollup() telegraf.Aggregator {
+	r := &Rollup{
+		Aggregation: "sum",
+	}
+	r.Reset()
+	return r
+}
+
+var sampleConfig = `
+  ## General Aggregator Arguments:
+  ## The period on which to flush & clear the aggregator.
+  period = "30s"
+  ## If true, the original metric will be dropped by the
+  ## aggregator and will not get sent to the output plugins.
+  drop_original = false
+  ## Suffix added to the measurement of the rolled up series.
+  # name_suffix = "_rollup"
+
+  ## Tags removed from the series, the series left with the same tags are
+  ## merged into one.
+  drop_tags = ["host"]
+
+  ## How the values of the merged series are combined: sum or mean. The
+  ## values of each series are first averaged over the period.
+  # aggregation = "sum"
+
+  ## Fields rolled up, glob patterns are supported. All the numeric fields
+  ## by default.
+  # fields = ["*_bytes", "requests"]
+
+  ## If set, the number of merged series is added in this field.
+  # series_field = "series"
+`
+
+func (r *Rollup) SampleConfig() string {
+	return sampleConfig
+}
+
+func (r *Rollup) Description() string {
+	return "Sum or average fields across the series differing only in some tags."
+}
+
+func (r *Rollup) init() {
+	r.initialized = true
+	f, err := filter.Compile(r.Fields)
+	if err != nil {
+		log.Printf("E! [aggregators.rollup] invalid fields %v, all the "+
+			"numeric fields are rolled up: %s", r.Fields, err)
+		return
+	}
+	r.fieldFilter = f
+}
+
+func (r *Rollup) Add(in telegraf.Metric) {
+	if !r.initialized {
+		r.init()
+	}
+
+	tags := in.Tags()
+	for _, k := range r.DropTags {
+		delete(tags, k)
+	}
+	key := groupKey(in.Name(), tags)
+	g, ok := r.cache[key]
+	if !ok {
+		g = &group{
+			name:   in.Name(),
+			tags:   tags,
+			series: make(map[uint64]map[string]*stat),
+		}
+		r.cache[key] = g
+	}
+
+	id := in.HashID()
+	fields, ok := g.series[id]
+	if !ok {
+		fields = make(map[string]*stat)
+		g.series[id] = fields
+	}
+	for k, v := range in.Fields() {
+		if r.fieldFilter != nil && !r.fieldFilter.Match(k) {
+			continue
+		}
+		fv, ok := convert(v)
+		if !ok {
+			continue
+		}
+		st, ok := fields[k]
+		if !ok {
+			st = &stat{}
+			fields[k] = st
+		}
+		st.sum += fv
+		st.count++
+	}
+}
+
+func (r *Rollup) Push(acc telegraf.Accumulator) {
+	switch r.Aggregation {
+	case "sum", "mean":
+	default:
+		if !r.warned {
+			log.Printf("E! [aggregators.rollup] unknown aggregation %q, must be "+
+				"sum or mean", r.Aggregation)
+			r.warned = true
+		}
+		return
+	}
+
+	for _, g := range r.cache {
+		sums := make(map[string]float64)
+		counts := make(map[string]int64)
+		for _, fields := range g.series {
+			for k, st := range fields {
+				sums[k] += st.sum / float64(st.count)
+				counts[k]++
+			}
+		}
+		if len(sums) == 0 {
+			continue
+		}
+
+		fields := make(map[string]interface{}, len(sums)+1)
+		for k, sum := range sums {
+			if r.Aggregation == "mean" {
+				sum /= float64(counts[k])
+			}
+			fields[k] = sum
+		}
+		if r.SeriesField != "" {
+			fields[r.SeriesField] = int64(len(g.series))
+		}
+		acc.AddFields(g.name, fields, g.tags)
+	}
+}
+
+func (r *Rollup) Reset() {
+	r.cache = make(map[string]*group)
+}
+
+// groupKey returns the key of the rolled up series of the given measurement
+// and remaining tags.
+func groupKey(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		keys = append(keys, k+"="+v)
+	}
+	sort.Strings(keys)
+	return name + "\x00" + strings.Join(keys, "\x00")
+}
+
+func convert(in interface{}) (float64, bool) {
+	switch v := in.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	aggregators.Add("rollup", func() telegraf.Aggregator {
+		return NewRollup()
+	})
+}
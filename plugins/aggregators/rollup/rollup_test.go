@@ -0,0 +1,103 @@
+package rollup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMetric(host, region string, requests int64, latency float64) telegraf.Metric {
+	m, _ := metric.New("http",
+		map[string]string{"host": host, "region": region},
+		map[string]interface{}{
+			"requests": requests,
+			"latency":  latency,
+			"status":   "ok",
+		},
+		time.Now(),
+	)
+	return m
+}
+
+func newRollup(aggregation string) *Rollup {
+	r := NewRollup().(*Rollup)
+	r.DropTags = []string{"host"}
+	r.Aggregation = aggregation
+	return r
+}
+
+// Test that the series of every host are summed, after averaging the values
+// of each series over the period
+func TestRollupSum(t *testing.T) {
+	acc := testutil.Accumulator{}
+	r := newRollup("sum")
+	r.SeriesField = "series"
+
+	r.Add(newMetric("a", "eu", 10, 0.1))
+	r.Add(newMetric("a", "eu", 20, 0.3))
+	r.Add(newMetric("b", "eu", 5, 0.5))
+	r.Add(newMetric("c", "us", 1, 1))
+	r.Push(&acc)
+
+	require.Len(t, acc.Metrics, 2)
+	acc.AssertContainsTaggedFields(t, "http",
+		map[string]interface{}{"requests": float64(20), "latency": 0.7, "series": int64(2)},
+		map[string]string{"region": "eu"})
+	acc.AssertContainsTaggedFields(t, "http",
+		map[string]interface{}{"requests": float64(1), "latency": float64(1), "series": int64(1)},
+		map[string]string{"region": "us"})
+
+	r.Reset()
+	acc.ClearMetrics()
+	r.Push(&acc)
+	assert.Len(t, acc.Metrics, 0)
+}
+
+// Test the mean aggregation and the fields option
+func TestRollupMeanFields(t *testing.T) {
+	acc := testutil.Accumulator{}
+	r := newRollup("mean")
+	r.Fields = []string{"req*"}
+
+	r.Add(newMetric("a", "eu", 10, 0.1))
+	r.Add(newMetric("b", "eu", 30, 0.5))
+	r.Push(&acc)
+
+	require.Len(t, acc.Metrics, 1)
+	assert.Equal(t, map[string]interface{}{"requests": float64(20)}, acc.Metrics[0].Fields)
+}
+
+// Test that the unsigned integer fields are rolled up
+func TestRollupUnsigned(t *testing.T) {
+	acc := testutil.Accumulator{}
+	r := newRollup("sum")
+
+	for host, v := range map[string]uint64{"a": 1 << 62, "b": 1 << 62} {
+		m, _ := metric.New("http",
+			map[string]string{"host": host, "region": "eu"},
+			map[string]interface{}{"bytes": v},
+			time.Now(),
+		)
+		r.Add(m)
+	}
+	r.Push(&acc)
+
+	require.Len(t, acc.Metrics, 1)
+	assert.Equal(t, map[string]interface{}{"bytes": float64(1 << 63)}, acc.Metrics[0].Fields)
+}
+
+// Test that nothing is emitted with an unknown aggregation
+func TestRollupUnknownAggregation(t *testing.T) {
+	acc := testutil.Accumulator{}
+	r := newRollup("median")
+
+	r.Add(newMetric("a", "eu", 10, 0.1))
+	r.Push(&acc)
+
+	assert.Len(t, acc.Metrics, 0)
+}
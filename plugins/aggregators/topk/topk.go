@@ -0,0 +1,220 @@
+package topk
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/aggregators"
+)
+
+// TopK keeps, over each period, the K series of each measurement with the
+// highest aggregated value of a field, and emits their aggregated fields.
+type TopK struct {
+	K           int      `toml:"k"`
+	Field       string   `toml:"field"`
+	Aggregation string   `toml:"aggregation"`
+	GroupBy     []string `toml:"group_by"`
+	RankField   string   `toml:"rank_field"`
+
+	cache map[uint64]*series
+	// warned is set once an invalid configuration has been logged
+	warned bool
+}
+
+type series struct {
+	name   string
+	tags   map[string]string
+	fields map[string]*stat
+}
+
+// stat aggregates the values of a field over the period, last is the last
+// value of non numeric fields.
+type stat struct {
+	numeric bool
+	count   int64
+	sum     float64
+	max     float64
+	last    interface{}
+}
+
+func NewTopK() telegraf.Aggregator {
+	t := &TopK{
+		K:           10,
+		Aggregation: "mean",
+	}
+	t.Reset()
+	return t
+}
+
+var sampleConfig = `
+  ## General Aggregator Arguments:
+  ## The period on which to flush & clear the aggregator.
+  period = "30s"
+  ## If true, the original metric will be dropped by the
+  ## aggregator and will not get sent to the output plugins.
+  drop_original = true
+
+  ## Number of series kept per measurement.
+  k = 10
+
+  ## Field the series are ranked by, the series without it are dropped.
+  field = "cpu_usage"
+
+  ## Aggregation of the values of the period, used to rank the series and
+  ## emitted for every numeric field of the kept series: mean, max or sum.
+  # aggregation = "mean"
+
+  ## Rank the series separately for every value of these tags, ie keep the
+  ## top K processes of each host.
+  # group_by = ["host"]
+
+  ## If set, the rank of the series, starting at 1, is added in this field.
+  # rank_field = "rank"
+`
+
+func (t *TopK) SampleConfig() string {
+	return sampleConfig
+}
+
+func (t *TopK) Description() string {
+	return "Keep only the top K series of each measurement, ranked by a field."
+}
+
+func (t *TopK) Add(in telegraf.Metric) {
+	id := in.HashID()
+	s, ok := t.cache[id]
+	if !ok {
+		s = &series{
+			name:   in.Name(),
+			tags:   in.Tags(),
+			fields: make(map[string]*stat),
+		}
+		t.cache[id] = s
+	}
+
+	for k, v := range in.Fields() {
+		st, ok := s.fields[k]
+		if !ok {
+			st = &stat{}
+			s.fields[k] = st
+		}
+		fv, numeric := convert(v)
+		if !numeric {
+			st.last = v
+			continue
+		}
+		if !st.numeric || fv > st.max {
+			st.max = fv
+		}
+		st.numeric = true
+		st.count++
+		st.sum += fv
+	}
+}
+
+func (t *TopK) Push(acc telegraf.Accumulator) {
+	switch t.Aggregation {
+	case "mean", "max", "sum":
+	default:
+		if !t.warned {
+			log.Printf("E! [aggregators.topk] unknown aggregation %q, must be "+
+				"mean, max or sum", t.Aggregation)
+			t.warned = true
+		}
+		return
+	}
+
+	groups := make(map[string][]*series)
+	for _, s := range t.cache {
+		if st, ok := s.fields[t.Field]; !ok || !st.numeric {
+			continue
+		}
+		key := t.groupKey(s)
+		groups[key] = append(groups[key], s)
+	}
+
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool {
+			vi := t.aggregate(group[i].fields[t.Field])
+			vj := t.aggregate(group[j].fields[t.Field])
+			if vi != vj {
+				return vi > vj
+			}
+			// keep the order stable between periods
+			return tagsKey(group[i].tags) < tagsKey(group[j].tags)
+		})
+		if len(group) > t.K {
+			group = group[:t.K]
+		}
+
+		for rank, s := range group {
+			fields := make(map[string]interface{}, len(s.fields)+1)
+			for k, st := range s.fields {
+				if st.numeric {
+					fields[k] = t.aggregate(st)
+				} else if st.last != nil {
+					fields[k] = st.last
+				}
+			}
+			if t.RankField != "" {
+				fields[t.RankField] = int64(rank + 1)
+			}
+			acc.AddFields(s.name, fields, s.tags)
+		}
+	}
+}
+
+func (t *TopK) Reset() {
+	t.cache = make(map[uint64]*series)
+}
+
+// groupKey returns the key of the ranking group of a series: its
+// measurement and the values of the group_by tags.
+func (t *TopK) groupKey(s *series) string {
+	key := s.name
+	for _, k := range t.GroupBy {
+		key += "\x00" + s.tags[k]
+	}
+	return key
+}
+
+func (t *TopK) aggregate(st *stat) float64 {
+	switch t.Aggregation {
+	case "max":
+		return st.max
+	case "sum":
+		return st.sum
+	default:
+		return st.sum / float64(st.count)
+	}
+}
+
+func tagsKey(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		keys = append(keys, k+"="+v)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func convert(in interface{}) (float64, bool) {
+	switch v := in.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	aggregators.Add("topk", func() telegraf.Aggregator {
+		return NewTopK()
+	})
+}
@@ -0,0 +1,140 @@
+package topk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMetric(host, process string, cpu float64) telegraf.Metric {
+	m, _ := metric.New("procstat",
+		map[string]string{"host": host, "process": process},
+		map[string]interface{}{"cpu_usage": cpu, "state": "running"},
+		time.Now(),
+	)
+	return m
+}
+
+func newTopK(k int, aggregation string) *TopK {
+	t := NewTopK().(*TopK)
+	t.K = k
+	t.Field = "cpu_usage"
+	t.Aggregation = aggregation
+	return t
+}
+
+// processes returns the process tags of the metrics, in order.
+func processes(acc *testutil.Accumulator) []string {
+	var out []string
+	for _, m := range acc.Metrics {
+		out = append(out, m.Tags["host"]+"/"+m.Tags["process"])
+	}
+	return out
+}
+
+// Test that only the K series with the highest mean are emitted
+func TestTopKMean(t *testing.T) {
+	acc := testutil.Accumulator{}
+	tk := newTopK(2, "mean")
+	tk.RankField = "rank"
+
+	tk.Add(newMetric("a", "nginx", 10))
+	tk.Add(newMetric("a", "nginx", 30))
+	tk.Add(newMetric("a", "java", 50))
+	tk.Add(newMetric("a", "cron", 1))
+	tk.Add(newMetric("a", "sshd", 5))
+	tk.Add(newMetric("a", "sshd", 40))
+	tk.Push(&acc)
+	tk.Reset()
+
+	require.Len(t, acc.Metrics, 2)
+	assert.Equal(t, []string{"a/java", "a/sshd"}, processes(&acc))
+	acc.AssertContainsTaggedFields(t, "procstat",
+		map[string]interface{}{"cpu_usage": 22.5, "state": "running", "rank": int64(2)},
+		map[string]string{"host": "a", "process": "sshd"})
+
+	acc.ClearMetrics()
+	tk.Push(&acc)
+	assert.Len(t, acc.Metrics, 0)
+}
+
+// Test the max and sum aggregations
+func TestTopKAggregations(t *testing.T) {
+	for _, tt := range []struct {
+		aggregation string
+		expected    []string
+		value       float64
+	}{
+		{"max", []string{"a/sshd"}, 40},
+		{"sum", []string{"a/nginx"}, 60},
+	} {
+		acc := testutil.Accumulator{}
+		tk := newTopK(1, tt.aggregation)
+		tk.Add(newMetric("a", "nginx", 20))
+		tk.Add(newMetric("a", "nginx", 20))
+		tk.Add(newMetric("a", "nginx", 20))
+		tk.Add(newMetric("a", "sshd", 40))
+		tk.Add(newMetric("a", "sshd", 1))
+		tk.Push(&acc)
+
+		assert.Equal(t, tt.expected, processes(&acc), tt.aggregation)
+		assert.Equal(t, tt.value, acc.Metrics[0].Fields["cpu_usage"], tt.aggregation)
+	}
+}
+
+// Test that the series are ranked per group
+func TestTopKGroupBy(t *testing.T) {
+	acc := testutil.Accumulator{}
+	tk := newTopK(1, "mean")
+	tk.GroupBy = []string{"host"}
+
+	tk.Add(newMetric("a", "nginx", 10))
+	tk.Add(newMetric("a", "java", 50))
+	tk.Add(newMetric("b", "nginx", 30))
+	tk.Add(newMetric("b", "java", 20))
+	tk.Push(&acc)
+
+	assert.ElementsMatch(t, []string{"a/java", "b/nginx"}, processes(&acc))
+}
+
+// Test that the series without the ranking field are dropped
+func TestTopKMissingField(t *testing.T) {
+	acc := testutil.Accumulator{}
+	tk := newTopK(10, "mean")
+
+	m, _ := metric.New("procstat",
+		map[string]string{"host": "a", "process": "zombie"},
+		map[string]interface{}{"state": "zombie"},
+		time.Now(),
+	)
+	tk.Add(m)
+	tk.Add(newMetric("a", "nginx", 10))
+	tk.Push(&acc)
+
+	assert.Equal(t, []string{"a/nginx"}, processes(&acc))
+}
+
+// Test that the series are ranked by their unsigned integer field
+func TestTopKUnsigned(t *testing.T) {
+	acc := testutil.Accumulator{}
+	tk := newTopK(1, "max")
+	tk.Field = "read_bytes"
+
+	for process, v := range map[string]uint64{"nginx": 1 << 40, "java": 1 << 63} {
+		m, _ := metric.New("procstat",
+			map[string]string{"host": "a", "process": process},
+			map[string]interface{}{"read_bytes": v},
+			time.Now(),
+		)
+		tk.Add(m)
+	}
+	tk.Push(&acc)
+
+	assert.Equal(t, []string{"a/java"}, processes(&acc))
+	assert.Equal(t, float64(1<<63), acc.Metrics[0].Fields["read_bytes"])
+}
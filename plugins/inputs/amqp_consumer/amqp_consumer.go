@@ -29,6 +29,12 @@ type AMQPConsumer struct {
 	// for consumers before receiving delivery acks.
 	PrefetchCount int
 
+	// Exchange the queue routes the messages that cannot be parsed to, they
+	// are acknowledged and dropped when empty.
+	DeadLetterExchange string `toml:"dead_letter_exchange"`
+	// Routing key of the dead-lettered messages, their own when empty.
+	DeadLetterRoutingKey string `toml:"dead_letter_routing_key"`
+
 	// AMQP Auth method
 	AuthMethod string
 	// Path to CA file
@@ -73,6 +79,14 @@ func (a *AMQPConsumer) SampleConfig() string {
   ## Maximum number of messages server should give to the worker.
   prefetch_count = 50
 
+  ## Exchange the messages that cannot be parsed are routed to, by setting
+  ## the x-dead-letter-exchange argument of the queue. The exchange must
+  ## exist, and a queue already declared without the argument must be
+  ## deleted first. When empty, these messages are dropped.
+  # dead_letter_exchange = ""
+  ## Routing key of the dead-lettered messages, their own when empty.
+  # dead_letter_routing_key = ""
+
   ## Auth method. PLAIN and EXTERNAL are supported
   ## Using EXTERNAL requires enabling the rabbitmq_auth_mechanism_ssl plugin as
   ## described here: https://www.rabbitmq.com/plugins.html
@@ -193,13 +207,21 @@ func (a *AMQPConsumer) connect(amqpConf *amqp.Config) (<-chan amqp.Delivery, err
 		return nil, fmt.Errorf("Failed to declare an exchange: %s", err)
 	}
 
+	var args amqp.Table
+	if a.DeadLetterExchange != "" {
+		args = amqp.Table{"x-dead-letter-exchange": a.DeadLetterExchange}
+		if a.DeadLetterRoutingKey != "" {
+			args["x-dead-letter-routing-key"] = a.DeadLetterRoutingKey
+		}
+	}
+
 	q, err := ch.QueueDeclare(
 		a.Queue, // queue
 		true,    // durable
 		false,   // delete when unused
 		false,   // exclusive
 		false,   // no-wait
-		nil,     // arguments
+		args,    // arguments
 	)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to declare a queue: %s", err)
@@ -249,6 +271,12 @@ func (a *AMQPConsumer) process(msgs <-chan amqp.Delivery, acc telegraf.Accumulat
 		metrics, err := a.parser.Parse(d.Body)
 		if err != nil {
 			log.Printf("E! %v: error parsing metric - %v", err, string(d.Body))
+			if a.DeadLetterExchange != "" {
+				// the broker routes rejected messages to the dead letter
+				// exchange of the queue
+				d.Reject(false)
+				continue
+			}
 		} else {
 			for _, m := range metrics {
 				acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
@@ -0,0 +1,72 @@
+package amqp_consumer
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/streadway/amqp"
+
+	"github.com/influxdata/telegraf/plugins/parsers"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// acknowledger records the acknowledgements of the deliveries.
+type acknowledger struct {
+	acked    []uint64
+	rejected []uint64
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked = append(a.acked, tag)
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.rejected = append(a.rejected, tag)
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	a.rejected = append(a.rejected, tag)
+	return nil
+}
+
+func consume(t *testing.T, a *AMQPConsumer, bodies ...string) (*acknowledger, *testutil.Accumulator) {
+	parser, err := parsers.NewInfluxParser()
+	assert.NoError(t, err)
+	a.SetParser(parser)
+	a.wg = &sync.WaitGroup{}
+
+	ack := &acknowledger{}
+	msgs := make(chan amqp.Delivery, len(bodies))
+	for i, body := range bodies {
+		msgs <- amqp.Delivery{
+			Acknowledger: ack,
+			DeliveryTag:  uint64(i + 1),
+			Body:         []byte(body),
+		}
+	}
+	close(msgs)
+
+	acc := &testutil.Accumulator{}
+	a.wg.Add(1)
+	a.process(msgs, acc)
+	return ack, acc
+}
+
+func TestProcess(t *testing.T) {
+	ack, acc := consume(t, &AMQPConsumer{},
+		"cpu value=1 1500000000000000000\n", "invalid", "mem value=2\n")
+	assert.Equal(t, []uint64{1, 2, 3}, ack.acked)
+	assert.Empty(t, ack.rejected)
+	assert.Equal(t, 2, len(acc.Metrics))
+}
+
+func TestProcessDeadLetter(t *testing.T) {
+	a := &AMQPConsumer{DeadLetterExchange: "telegraf-dlx"}
+	ack, acc := consume(t, a, "cpu value=1\n", "invalid", "mem value=2\n")
+	assert.Equal(t, []uint64{1, 3}, ack.acked)
+	assert.Equal(t, []uint64{2}, ack.rejected)
+	assert.Equal(t, 2, len(acc.Metrics))
+}
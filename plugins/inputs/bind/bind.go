@@ -0,0 +1,214 @@
+package bind
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// Bind gathers the statistics of BIND servers from their statistics channel,
+// in the JSON (v1) or XML (v3) format.
+type Bind struct {
+	Urls            []string
+	GatherViews     bool `toml:"gather_views"`
+	GatherZones     bool `toml:"gather_zones"`
+	ResponseTimeout internal.Duration
+
+	client *http.Client
+}
+
+// counters are the counters of a server, view or zone by type and name, ie
+// counters["rcode"]["NOERROR"].
+type counters map[string]map[string]int64
+
+func (c counters) add(typ, name string, value int64) {
+	if c[typ] == nil {
+		c[typ] = make(map[string]int64)
+	}
+	c[typ][name] = value
+}
+
+// stats are the statistics of a server, decoded from either format. The
+// counter types are the ones of the XML format.
+type stats struct {
+	server counters
+	views  []view
+}
+
+type view struct {
+	name     string
+	counters counters
+	zones    []zone
+}
+
+type zone struct {
+	name     string
+	class    string
+	serial   int64
+	counters counters
+}
+
+var sampleConfig = `
+  ## URLs of the statistics channels of the servers, their path selects the
+  ## format: /json/v1 (the default) or /xml/v3.
+  urls = ["http://localhost:8053/json/v1"]
+
+  ## Report the resolver and cache statistics of the views, and the
+  ## statistics of the zones, which requires zone-statistics in named.conf.
+  # gather_views = true
+  # gather_zones = false
+
+  ## HTTP response timeout
+  # response_timeout = "5s"
+`
+
+func (b *Bind) SampleConfig() string {
+	return sampleConfig
+}
+
+func (b *Bind) Description() string {
+	return "Read BIND statistics from its statistics channel"
+}
+
+func (b *Bind) Gather(acc telegraf.Accumulator) error {
+	if b.client == nil {
+		timeout := b.ResponseTimeout.Duration
+		if timeout < time.Second {
+			timeout = 5 * time.Second
+		}
+		b.client = &http.Client{Timeout: timeout}
+	}
+
+	var wg sync.WaitGroup
+	for _, u := range b.Urls {
+		addr, err := url.Parse(u)
+		if err != nil {
+			acc.AddError(fmt.Errorf("Unable to parse address '%s': %s", u, err))
+			continue
+		}
+		if addr.Path == "" || addr.Path == "/" {
+			addr.Path = "/json/v1"
+		}
+
+		wg.Add(1)
+		go func(addr *url.URL) {
+			defer wg.Done()
+			acc.AddError(b.gatherURL(addr, acc))
+		}(addr)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (b *Bind) gatherURL(addr *url.URL, acc telegraf.Accumulator) error {
+	var decode func(*http.Response) (*stats, error)
+	switch {
+	case strings.HasSuffix(addr.Path, "/json/v1"):
+		decode = decodeJSON
+	case strings.HasSuffix(addr.Path, "/xml/v3"):
+		decode = decodeXML
+	default:
+		return fmt.Errorf("unsupported statistics URL %s, the path must end "+
+			"with /json/v1 or /xml/v3", addr)
+	}
+
+	resp, err := b.client.Get(addr.String())
+	if err != nil {
+		return fmt.Errorf("error making HTTP request to %s: %s", addr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP status %s", addr, resp.Status)
+	}
+	s, err := decode(resp)
+	if err != nil {
+		return fmt.Errorf("unable to decode the statistics of %s: %s", addr, err)
+	}
+
+	tags := map[string]string{"url": addr.Host}
+	b.addStats(acc, s, tags)
+	return nil
+}
+
+// addStats adds the counters of the server, views and zones as bind_counter
+// metrics with a field per counter, the cache statistics of the views as
+// bind_cache and the serials of the zones as bind_zone.
+func (b *Bind) addStats(acc telegraf.Accumulator, s *stats, tags map[string]string) {
+	now := time.Now()
+	addCounters(acc, s.server, tags, now)
+	if !b.GatherViews {
+		return
+	}
+
+	for _, v := range s.views {
+		viewTags := copyTags(tags)
+		viewTags["view"] = v.name
+		addCounters(acc, v.counters, viewTags, now)
+
+		if cs, ok := v.counters["cachestats"]; ok {
+			hits, misses := cs["QueryHits"], cs["QueryMisses"]
+			fields := map[string]interface{}{
+				"query_hits":   hits,
+				"query_misses": misses,
+				"cache_hits":   cs["CacheHits"],
+				"cache_misses": cs["CacheMisses"],
+			}
+			if hits+misses > 0 {
+				fields["hit_ratio"] = float64(hits) / float64(hits+misses)
+			}
+			acc.AddFields("bind_cache", fields, viewTags, now)
+		}
+
+		if !b.GatherZones {
+			continue
+		}
+		for _, z := range v.zones {
+			zoneTags := copyTags(viewTags)
+			zoneTags["zone"] = z.name
+			if z.class != "" {
+				zoneTags["class"] = z.class
+			}
+			addCounters(acc, z.counters, zoneTags, now)
+			if z.serial > 0 {
+				acc.AddFields("bind_zone",
+					map[string]interface{}{"serial": z.serial}, zoneTags, now)
+			}
+		}
+	}
+}
+
+func addCounters(acc telegraf.Accumulator, c counters, tags map[string]string, now time.Time) {
+	for typ, values := range c {
+		if len(values) == 0 {
+			continue
+		}
+		fields := make(map[string]interface{}, len(values))
+		for name, value := range values {
+			fields[name] = value
+		}
+		counterTags := copyTags(tags)
+		counterTags["type"] = typ
+		acc.AddCounter("bind_counter", fields, counterTags, now)
+	}
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	c := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		c[k] = v
+	}
+	return c
+}
+
+func init() {
+	inputs.Add("bind", func() telegraf.Input {
+		return &Bind{GatherViews: true}
+	})
+}
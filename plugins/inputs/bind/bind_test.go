@@ -0,0 +1,103 @@
+package bind
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindJSON(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	b := &Bind{Urls: []string{ts.URL}, GatherViews: true, GatherZones: true}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	acc.AssertContainsTaggedFields(t, "bind_counter",
+		map[string]interface{}{"NOERROR": int64(1732), "SERVFAIL": int64(6), "NXDOMAIN": int64(200)},
+		map[string]string{"url": u.Host, "type": "rcode"})
+	acc.AssertContainsTaggedFields(t, "bind_counter",
+		map[string]interface{}{"A": int64(140), "!AAAA": int64(37)},
+		map[string]string{"url": u.Host, "type": "cache", "view": "_default"})
+	acc.AssertContainsTaggedFields(t, "bind_cache",
+		map[string]interface{}{
+			"query_hits":   int64(750),
+			"query_misses": int64(250),
+			"cache_hits":   int64(4620),
+			"cache_misses": int64(1240),
+			"hit_ratio":    0.75,
+		},
+		map[string]string{"url": u.Host, "view": "_default"})
+	zoneTags := map[string]string{"url": u.Host, "view": "_default",
+		"zone": "example.com", "class": "IN"}
+	acc.AssertContainsTaggedFields(t, "bind_zone",
+		map[string]interface{}{"serial": int64(2018011001)}, zoneTags)
+	zoneTags["type"] = "qtype"
+	acc.AssertContainsTaggedFields(t, "bind_counter",
+		map[string]interface{}{"A": int64(100), "MX": int64(20)}, zoneTags)
+
+	// the serial of zones which are not loaded is "-"
+	for _, m := range acc.Metrics {
+		if m.Measurement == "bind_zone" {
+			assert.NotEqual(t, "broken.example", m.Tags["zone"])
+		}
+	}
+}
+
+func TestBindXML(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	b := &Bind{Urls: []string{ts.URL + "/xml/v3"}, GatherViews: true, GatherZones: true}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	acc.AssertContainsTaggedFields(t, "bind_counter",
+		map[string]interface{}{"QUERY": int64(1276), "IQUERY": int64(0)},
+		map[string]string{"url": u.Host, "type": "opcode"})
+	acc.AssertContainsTaggedFields(t, "bind_counter",
+		map[string]interface{}{"A": int64(140), "!AAAA": int64(37)},
+		map[string]string{"url": u.Host, "type": "cache", "view": "_default"})
+	acc.AssertContainsTaggedFields(t, "bind_cache",
+		map[string]interface{}{
+			"query_hits":   int64(750),
+			"query_misses": int64(250),
+			"cache_hits":   int64(4620),
+			"cache_misses": int64(1240),
+			"hit_ratio":    0.75,
+		},
+		map[string]string{"url": u.Host, "view": "_default"})
+	acc.AssertContainsTaggedFields(t, "bind_counter",
+		map[string]interface{}{"NOERROR": int64(120)},
+		map[string]string{"url": u.Host, "view": "_default", "zone": "example.com",
+			"class": "IN", "type": "rcode"})
+}
+
+func TestBindServerOnly(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+
+	b := &Bind{Urls: []string{ts.URL + "/json/v1"}}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	assert.True(t, acc.HasMeasurement("bind_counter"))
+	assert.False(t, acc.HasMeasurement("bind_cache"))
+	assert.False(t, acc.HasMeasurement("bind_zone"))
+}
+
+func TestBindUnsupportedURL(t *testing.T) {
+	b := &Bind{Urls: []string{"http://localhost:8053/xml/v2"}}
+	var acc testutil.Accumulator
+	require.Error(t, acc.GatherError(b.Gather))
+}
@@ -0,0 +1,75 @@
+package bind
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// jsonStats is the JSON (v1) format of the statistics channel.
+type jsonStats struct {
+	OpCodes   map[string]int64 `json:"opcodes"`
+	RCodes    map[string]int64 `json:"rcodes"`
+	QTypes    map[string]int64 `json:"qtypes"`
+	NSStats   map[string]int64 `json:"nsstats"`
+	ZoneStats map[string]int64 `json:"zonestats"`
+	ResStats  map[string]int64 `json:"resstats"`
+	SockStats map[string]int64 `json:"sockstats"`
+	Views     map[string]struct {
+		Resolver struct {
+			Stats      map[string]int64 `json:"stats"`
+			QTypes     map[string]int64 `json:"qtypes"`
+			Cache      map[string]int64 `json:"cache"`
+			CacheStats map[string]int64 `json:"cachestats"`
+		} `json:"resolver"`
+		Zones []struct {
+			Name   string           `json:"name"`
+			Class  string           `json:"class"`
+			Serial interface{}      `json:"serial"`
+			RCodes map[string]int64 `json:"rcodes"`
+			QTypes map[string]int64 `json:"qtypes"`
+		} `json:"zones"`
+	} `json:"views"`
+}
+
+func decodeJSON(resp *http.Response) (*stats, error) {
+	var js jsonStats
+	if err := json.NewDecoder(resp.Body).Decode(&js); err != nil {
+		return nil, err
+	}
+
+	s := &stats{server: counters{}}
+	addMap(s.server, "opcode", js.OpCodes)
+	addMap(s.server, "rcode", js.RCodes)
+	addMap(s.server, "qtype", js.QTypes)
+	addMap(s.server, "nsstat", js.NSStats)
+	addMap(s.server, "zonestat", js.ZoneStats)
+	addMap(s.server, "resstat", js.ResStats)
+	addMap(s.server, "sockstat", js.SockStats)
+
+	for name, jv := range js.Views {
+		v := view{name: name, counters: counters{}}
+		addMap(v.counters, "resstats", jv.Resolver.Stats)
+		addMap(v.counters, "resqtype", jv.Resolver.QTypes)
+		addMap(v.counters, "cache", jv.Resolver.Cache)
+		addMap(v.counters, "cachestats", jv.Resolver.CacheStats)
+
+		for _, jz := range jv.Zones {
+			z := zone{name: jz.Name, class: jz.Class, counters: counters{}}
+			// the serial is "-" for zones which are not loaded
+			if serial, ok := jz.Serial.(float64); ok {
+				z.serial = int64(serial)
+			}
+			addMap(z.counters, "rcode", jz.RCodes)
+			addMap(z.counters, "qtype", jz.QTypes)
+			v.zones = append(v.zones, z)
+		}
+		s.views = append(s.views, v)
+	}
+	return s, nil
+}
+
+func addMap(c counters, typ string, values map[string]int64) {
+	for name, value := range values {
+		c.add(typ, name, value)
+	}
+}
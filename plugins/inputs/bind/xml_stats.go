@@ -0,0 +1,76 @@
+package bind
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+)
+
+// xmlStats is the XML (v3) format of the statistics channel.
+type xmlStats struct {
+	Server struct {
+		Counters []xmlCounters `xml:"counters"`
+	} `xml:"server"`
+	Views []struct {
+		Name     string        `xml:"name,attr"`
+		Counters []xmlCounters `xml:"counters"`
+		Cache    []struct {
+			RRSets []struct {
+				Name    string `xml:"name"`
+				Counter int64  `xml:"counter"`
+			} `xml:"rrset"`
+		} `xml:"cache"`
+		Zones []struct {
+			Name     string        `xml:"name,attr"`
+			Class    string        `xml:"rdataclass,attr"`
+			Serial   string        `xml:"serial"`
+			Counters []xmlCounters `xml:"counters"`
+		} `xml:"zones>zone"`
+	} `xml:"views>view"`
+}
+
+type xmlCounters struct {
+	Type     string `xml:"type,attr"`
+	Counters []struct {
+		Name  string `xml:"name,attr"`
+		Value int64  `xml:",chardata"`
+	} `xml:"counter"`
+}
+
+func decodeXML(resp *http.Response) (*stats, error) {
+	var xs xmlStats
+	if err := xml.NewDecoder(resp.Body).Decode(&xs); err != nil {
+		return nil, err
+	}
+
+	s := &stats{server: counters{}}
+	addXMLCounters(s.server, xs.Server.Counters)
+
+	for _, xv := range xs.Views {
+		v := view{name: xv.Name, counters: counters{}}
+		addXMLCounters(v.counters, xv.Counters)
+		for _, cache := range xv.Cache {
+			for _, rrset := range cache.RRSets {
+				v.counters.add("cache", rrset.Name, rrset.Counter)
+			}
+		}
+
+		for _, xz := range xv.Zones {
+			z := zone{name: xz.Name, class: xz.Class, counters: counters{}}
+			// the serial is "-" for zones which are not loaded
+			z.serial, _ = strconv.ParseInt(xz.Serial, 10, 64)
+			addXMLCounters(z.counters, xz.Counters)
+			v.zones = append(v.zones, z)
+		}
+		s.views = append(s.views, v)
+	}
+	return s, nil
+}
+
+func addXMLCounters(c counters, groups []xmlCounters) {
+	for _, group := range groups {
+		for _, counter := range group.Counters {
+			c.add(group.Type, counter.Name, counter.Value)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package cgroup2
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// CGroup2 reads the resource usage of cgroups of the unified (v2)
+// hierarchy.
+type CGroup2 struct {
+	Paths        []string `toml:"paths"`
+	TagTemplates []string `toml:"tag_templates"`
+
+	templates []*regexp.Regexp
+}
+
+var sampleConfig = `
+  ## Directories of the cgroups to monitor, globs are supported.
+  ## Consider restricting paths to the set of cgroups you really
+  ## want to monitor if you have a large number of cgroups, to avoid
+  ## any cardinality issues.
+  paths = ["/sys/fs/cgroup/system.slice/*.service"]
+
+  ## Templates turning parts of the cgroup path into tags, "{name}" matches
+  ## a part of a path segment and becomes the tag "name", "*" matches
+  ## anything within a segment. The first template matching the whole path
+  ## is used.
+  # tag_templates = [
+  #   "/sys/fs/cgroup/system.slice/{unit}.service",
+  #   "/sys/fs/cgroup/kubepods.slice/*/*-pod{pod}.slice/*-{container}.scope",
+  # ]
+`
+
+func (g *CGroup2) SampleConfig() string {
+	return sampleConfig
+}
+
+func (g *CGroup2) Description() string {
+	return "Read resource usage of cgroup v2 hierarchies"
+}
+
+var templateVar = regexp.MustCompile(`\{(\w+)\}|\*`)
+
+// compileTemplate converts a tag template to a regular expression with a
+// named group per tag.
+func compileTemplate(tmpl string) (*regexp.Regexp, error) {
+	var expr bytes.Buffer
+	expr.WriteString("^")
+	last := 0
+	names := make(map[string]bool)
+	for _, loc := range templateVar.FindAllStringSubmatchIndex(tmpl, -1) {
+		expr.WriteString(regexp.QuoteMeta(tmpl[last:loc[0]]))
+		if loc[2] >= 0 {
+			name := tmpl[loc[2]:loc[3]]
+			if names[name] {
+				return nil, fmt.Errorf("duplicate tag %s", name)
+			}
+			names[name] = true
+			fmt.Fprintf(&expr, "(?P<%s>[^/]+?)", name)
+		} else {
+			expr.WriteString("[^/]*")
+		}
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(tmpl[last:]))
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// tags returns the tags of the cgroup at path.
+func (g *CGroup2) tags(path string) (map[string]string, error) {
+	if g.templates == nil {
+		templates := make([]*regexp.Regexp, 0, len(g.TagTemplates))
+		for _, tmpl := range g.TagTemplates {
+			re, err := compileTemplate(tmpl)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tag template %q: %s", tmpl, err)
+			}
+			templates = append(templates, re)
+		}
+		g.templates = templates
+	}
+
+	tags := map[string]string{"path": path}
+	for _, re := range g.templates {
+		match := re.FindStringSubmatch(path)
+		if match == nil {
+			continue
+		}
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				tags[name] = match[i]
+			}
+		}
+		break
+	}
+	return tags, nil
+}
+
+func init() {
+	inputs.Add("cgroup2", func() telegraf.Input { return &CGroup2{} })
+}
@@ -0,0 +1,151 @@
+// +build linux
+
+package cgroup2
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+)
+
+// flatKeyedFiles are the "KEY VALUE" files, their fields are prefixed by the
+// name of the file with the dot replaced by an underscore.
+var flatKeyedFiles = []string{"cpu.stat", "memory.events", "pids.events"}
+
+// singleValueFiles are the files with a single value, "max" meaning no
+// limit is skipped.
+var singleValueFiles = []string{
+	"memory.current", "memory.max", "memory.high", "memory.swap.current",
+	"memory.swap.max", "pids.current", "pids.max", "cpu.weight",
+}
+
+func (g *CGroup2) Gather(acc telegraf.Accumulator) error {
+	for _, pattern := range g.Paths {
+		dirs, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		for _, dir := range dirs {
+			fi, err := os.Stat(dir)
+			if err != nil {
+				acc.AddError(err)
+				continue
+			}
+			if !fi.IsDir() {
+				continue
+			}
+			if err := g.gatherDir(dir, acc); err != nil {
+				acc.AddError(err)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *CGroup2) gatherDir(dir string, acc telegraf.Accumulator) error {
+	tags, err := g.tags(dir)
+	if err != nil {
+		return err
+	}
+
+	// a file is missing when its controller is not enabled for the cgroup
+	fields := make(map[string]interface{})
+	for _, file := range singleValueFiles {
+		buf, err := readFile(dir, file)
+		if err != nil {
+			return err
+		}
+		s := strings.TrimSpace(string(buf))
+		if buf == nil || s == "max" {
+			continue
+		}
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value in %s: %q", filepath.Join(dir, file), s)
+		}
+		fields[fieldName(file)] = v
+	}
+
+	for _, file := range flatKeyedFiles {
+		buf, err := readFile(dir, file)
+		if err != nil {
+			return err
+		}
+		prefix := fieldName(file) + "_"
+		scnr := bufio.NewScanner(bytes.NewReader(buf))
+		for scnr.Scan() {
+			parts := strings.Fields(scnr.Text())
+			if len(parts) != 2 {
+				continue
+			}
+			v, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value in %s: %q",
+					filepath.Join(dir, file), scnr.Text())
+			}
+			fields[prefix+parts[0]] = v
+		}
+	}
+
+	if len(fields) > 0 {
+		acc.AddFields("cgroup2", fields, tags)
+	}
+	return g.gatherIO(dir, tags, acc)
+}
+
+// gatherIO reads io.stat, a line per device of "MAJ:MIN KEY=VALUE ...".
+func (g *CGroup2) gatherIO(dir string, tags map[string]string, acc telegraf.Accumulator) error {
+	buf, err := readFile(dir, "io.stat")
+	if err != nil {
+		return err
+	}
+	scnr := bufio.NewScanner(bytes.NewReader(buf))
+	for scnr.Scan() {
+		parts := strings.Fields(scnr.Text())
+		if len(parts) < 2 {
+			continue
+		}
+		fields := make(map[string]interface{}, len(parts)-1)
+		for _, kv := range parts[1:] {
+			i := strings.IndexByte(kv, '=')
+			if i < 0 {
+				continue
+			}
+			v, err := strconv.ParseInt(kv[i+1:], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value in %s: %q",
+					filepath.Join(dir, "io.stat"), scnr.Text())
+			}
+			fields[kv[:i]] = v
+		}
+
+		ioTags := make(map[string]string, len(tags)+1)
+		for k, v := range tags {
+			ioTags[k] = v
+		}
+		ioTags["device"] = parts[0]
+		acc.AddFields("cgroup2_io", fields, ioTags)
+	}
+	return nil
+}
+
+// readFile returns the content of a file of the cgroup, nil if it does not
+// exist.
+func readFile(dir, file string) ([]byte, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, file))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return buf, err
+}
+
+func fieldName(file string) string {
+	return strings.Replace(file, ".", "_", -1)
+}
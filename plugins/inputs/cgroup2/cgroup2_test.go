@@ -0,0 +1,109 @@
+// +build linux
+
+package cgroup2
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGather(t *testing.T) {
+	g := &CGroup2{
+		Paths:        []string{"testdata/system.slice/*.service"},
+		TagTemplates: []string{"testdata/{slice}.slice/{unit}.service"},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(g.Gather))
+
+	nginx := map[string]string{
+		"path":  "testdata/system.slice/nginx.service",
+		"slice": "system",
+		"unit":  "nginx",
+	}
+	acc.AssertContainsTaggedFields(t, "cgroup2", map[string]interface{}{
+		"cpu_stat_usage_usec":     int64(1500000),
+		"cpu_stat_user_usec":      int64(1000000),
+		"cpu_stat_system_usec":    int64(500000),
+		"cpu_stat_nr_periods":     int64(10),
+		"cpu_stat_nr_throttled":   int64(2),
+		"cpu_stat_throttled_usec": int64(3000),
+		"memory_current":          int64(104857600),
+		"memory_swap_current":     int64(0),
+		"memory_events_low":       int64(0),
+		"memory_events_high":      int64(0),
+		"memory_events_max":       int64(1),
+		"memory_events_oom":       int64(1),
+		"memory_events_oom_kill":  int64(1),
+		"pids_current":            int64(12),
+		"pids_max":                int64(4915),
+	}, nginx)
+
+	nginx["device"] = "8:0"
+	acc.AssertContainsTaggedFields(t, "cgroup2_io", map[string]interface{}{
+		"rbytes": int64(1048576),
+		"wbytes": int64(2097152),
+		"rios":   int64(100),
+		"wios":   int64(200),
+		"dbytes": int64(0),
+		"dios":   int64(0),
+	}, nginx)
+	nginx["device"] = "8:16"
+	acc.AssertContainsTaggedFields(t, "cgroup2_io", map[string]interface{}{
+		"rbytes": int64(4096),
+		"wbytes": int64(0),
+		"rios":   int64(1),
+		"wios":   int64(0),
+		"dbytes": int64(0),
+		"dios":   int64(0),
+	}, nginx)
+
+	acc.AssertContainsTaggedFields(t, "cgroup2", map[string]interface{}{
+		"cpu_stat_usage_usec":  int64(100),
+		"cpu_stat_user_usec":   int64(60),
+		"cpu_stat_system_usec": int64(40),
+		"pids_current":         int64(2),
+	}, map[string]string{
+		"path":  "testdata/system.slice/cron.service",
+		"slice": "system",
+		"unit":  "cron",
+	})
+
+	// init.scope does not match and notadir.service is a file
+	assert.Len(t, acc.Metrics, 4)
+}
+
+func TestTags(t *testing.T) {
+	g := &CGroup2{
+		TagTemplates: []string{
+			"/sys/fs/cgroup/kubepods.slice/*/*-pod{pod}.slice/*-{container}.scope",
+			"/sys/fs/cgroup/{slice}.slice/*",
+		},
+	}
+
+	tags, err := g.tags("/sys/fs/cgroup/kubepods.slice/kubepods-burstable.slice/" +
+		"kubepods-burstable-pod1234.slice/cri-containerd-abcd.scope")
+	require.NoError(t, err)
+	assert.Equal(t, "1234", tags["pod"])
+	assert.Equal(t, "abcd", tags["container"])
+
+	tags, err = g.tags("/sys/fs/cgroup/user.slice/user-1000.slice")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"path":  "/sys/fs/cgroup/user.slice/user-1000.slice",
+		"slice": "user",
+	}, tags)
+
+	tags, err = g.tags("/sys/fs/cgroup/init.scope")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"path": "/sys/fs/cgroup/init.scope"}, tags)
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	g := &CGroup2{TagTemplates: []string{"/sys/fs/cgroup/{a}/{a}"}}
+	_, err := g.tags("/sys/fs/cgroup/x/y")
+	assert.Error(t, err)
+}
@@ -0,0 +1,183 @@
+package collectd
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"collectd.org/api"
+	"collectd.org/network"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	parser "github.com/influxdata/telegraf/plugins/parsers/collectd"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// maxPacketSize is the maximum size of an UDP packet.
+const maxPacketSize = 64 * 1024
+
+// Collectd listens to the packets of the collectd network plugin.
+type Collectd struct {
+	ServiceAddress string   `toml:"service_address"`
+	AuthFile       string   `toml:"auth_file"`
+	SecurityLevel  string   `toml:"security_level"`
+	TypesDB        []string `toml:"typesdb"`
+	ReadBufferSize int      `toml:"read_buffer_size"`
+
+	popts *network.ParseOpts
+	acc   telegraf.Accumulator
+	conn  *net.UDPConn
+	wg    sync.WaitGroup
+
+	PacketsReceived selfstat.Stat
+	MetricsReceived selfstat.Stat
+	Malformed       selfstat.Stat
+}
+
+var sampleConfig = `
+  ## Address to listen on for the packets of the collectd network plugin.
+  service_address = ":25826"
+
+  ## Minimal security level of the packets, "none" (default), "sign" or
+  ## "encrypt", and the file of the users and passwords of the signed and
+  ## encrypted packets.
+  # security_level = "none"
+  # auth_file = "/etc/collectd/auth_file"
+
+  ## The types.db files describing the data sources of the collectd types.
+  typesdb = ["/usr/share/collectd/types.db"]
+
+  ## Size of the socket receive buffer, 0 (default) is the system default.
+  # read_buffer_size = 0
+`
+
+func (c *Collectd) SampleConfig() string {
+	return sampleConfig
+}
+
+func (c *Collectd) Description() string {
+	return "Listener of the collectd binary network protocol"
+}
+
+func (c *Collectd) Gather(_ telegraf.Accumulator) error {
+	return nil
+}
+
+func (c *Collectd) Start(acc telegraf.Accumulator) error {
+	switch c.SecurityLevel {
+	case "", "none", "sign", "encrypt":
+	default:
+		return fmt.Errorf("invalid security_level %q, must be none, sign or encrypt",
+			c.SecurityLevel)
+	}
+	popts, err := parser.NewParseOpts(c.AuthFile, c.SecurityLevel, c.TypesDB)
+	if err != nil {
+		return fmt.Errorf("unable to load typesdb: %s", err)
+	}
+	c.popts = popts
+	c.acc = acc
+
+	tags := map[string]string{"address": c.ServiceAddress}
+	c.PacketsReceived = selfstat.Register("collectd", "packets_received", tags)
+	c.MetricsReceived = selfstat.Register("collectd", "metrics_received", tags)
+	c.Malformed = selfstat.Register("collectd", "malformed", tags)
+
+	addr, err := net.ResolveUDPAddr("udp", c.ServiceAddress)
+	if err != nil {
+		return err
+	}
+	c.conn, err = net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	if c.ReadBufferSize > 0 {
+		if err := c.conn.SetReadBuffer(c.ReadBufferSize); err != nil {
+			c.conn.Close()
+			return fmt.Errorf("unable to set the read buffer to %d: %s",
+				c.ReadBufferSize, err)
+		}
+	}
+
+	c.wg.Add(1)
+	go c.listen()
+	log.Printf("I! [inputs.collectd] Listening on %s", c.conn.LocalAddr())
+	return nil
+}
+
+func (c *Collectd) Stop() {
+	c.conn.Close()
+	c.wg.Wait()
+}
+
+func (c *Collectd) listen() {
+	defer c.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := c.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !strings.HasSuffix(err.Error(), ": use of closed network connection") {
+				c.acc.AddError(err)
+			}
+			return
+		}
+		c.PacketsReceived.Incr(1)
+
+		vls, err := network.Parse(buf[:n], *c.popts)
+		if err != nil {
+			// the packets of an unknown user or below the security level
+			// are logged in debug mode only since a sender may send many
+			c.Malformed.Incr(1)
+			log.Printf("D! [inputs.collectd] Malformed packet: %s", err)
+			continue
+		}
+		for _, vl := range vls {
+			c.add(vl)
+		}
+	}
+}
+
+// add adds the metric of the value list vl, whose fields are the values
+// named by their data source, tagged with the identifier of vl.
+func (c *Collectd) add(vl *api.ValueList) {
+	fields := make(map[string]interface{}, len(vl.Values))
+	for i, v := range vl.Values {
+		switch v := v.(type) {
+		case api.Gauge:
+			fields[vl.DSName(i)] = float64(v)
+		case api.Derive:
+			fields[vl.DSName(i)] = int64(v)
+		case api.Counter:
+			fields[vl.DSName(i)] = int64(v)
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+
+	tags := make(map[string]string)
+	for k, v := range map[string]string{
+		"host":            vl.Host,
+		"plugin":          vl.Plugin,
+		"plugin_instance": vl.PluginInstance,
+		"type":            vl.Type,
+		"type_instance":   vl.TypeInstance,
+	} {
+		if v != "" {
+			tags[k] = v
+		}
+	}
+	c.MetricsReceived.Incr(1)
+	c.acc.AddFields("collectd", fields, tags, vl.Time.UTC())
+}
+
+func init() {
+	inputs.Add("collectd", func() telegraf.Input {
+		return &Collectd{
+			ServiceAddress: ":25826",
+			SecurityLevel:  "none",
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package collectd
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"collectd.org/api"
+	"collectd.org/network"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testVL = api.ValueList{
+	Identifier: api.Identifier{
+		Host:           "xyzzy",
+		Plugin:         "interface",
+		PluginInstance: "eth0",
+		Type:           "if_octets",
+	},
+	Time:    time.Unix(1500000000, 0),
+	Values:  []api.Value{api.Derive(1024), api.Derive(2048)},
+	DSNames: []string{"rx", "tx"},
+}
+
+func newTestCollectd(t *testing.T, acc *testutil.Accumulator) (*Collectd, net.Conn) {
+	c := &Collectd{ServiceAddress: "127.0.0.1:0", SecurityLevel: "none"}
+	require.NoError(t, c.Start(acc))
+	conn, err := net.Dial("udp", c.conn.LocalAddr().String())
+	require.NoError(t, err)
+	return c, conn
+}
+
+func packet(t *testing.T, user string, vls ...api.ValueList) []byte {
+	buf := network.NewBuffer(0)
+	if user != "" {
+		buf.Sign(user, "secret")
+	}
+	for i := range vls {
+		require.NoError(t, buf.Write(context.Background(), &vls[i]))
+	}
+	b, err := buf.Bytes()
+	require.NoError(t, err)
+	return b
+}
+
+func TestListen(t *testing.T) {
+	var acc testutil.Accumulator
+	c, conn := newTestCollectd(t, &acc)
+	defer c.Stop()
+	defer conn.Close()
+
+	load := api.ValueList{
+		Identifier: api.Identifier{Host: "xyzzy", Plugin: "load", Type: "load"},
+		Time:       time.Unix(1500000000, 0),
+		Values:     []api.Value{api.Gauge(0.5)},
+	}
+	_, err := conn.Write(packet(t, "", testVL, load))
+	require.NoError(t, err)
+
+	acc.Wait(2)
+	acc.AssertContainsTaggedFields(t, "collectd",
+		map[string]interface{}{"rx": int64(1024), "tx": int64(2048)},
+		map[string]string{
+			"host":            "xyzzy",
+			"plugin":          "interface",
+			"plugin_instance": "eth0",
+			"type":            "if_octets",
+		})
+	acc.AssertContainsTaggedFields(t, "collectd",
+		map[string]interface{}{"value": 0.5},
+		map[string]string{"host": "xyzzy", "plugin": "load", "type": "load"})
+}
+
+func TestListenMalformed(t *testing.T) {
+	var acc testutil.Accumulator
+	c, conn := newTestCollectd(t, &acc)
+	defer c.Stop()
+	defer conn.Close()
+
+	// the malformed packets are dropped, the next ones are read
+	_, err := conn.Write([]byte("garbage"))
+	require.NoError(t, err)
+	_, err = conn.Write(packet(t, "", testVL))
+	require.NoError(t, err)
+
+	acc.Wait(1)
+	assert.Len(t, acc.Metrics, 1)
+	assert.Empty(t, acc.Errors)
+}
+
+func TestListenSigned(t *testing.T) {
+	f, err := ioutil.TempFile("", "collectd-auth")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("user0: secret\n")
+	require.NoError(t, err)
+	f.Close()
+
+	var acc testutil.Accumulator
+	c := &Collectd{
+		ServiceAddress: "127.0.0.1:0",
+		SecurityLevel:  "sign",
+		AuthFile:       f.Name(),
+	}
+	require.NoError(t, c.Start(&acc))
+	defer c.Stop()
+	conn, err := net.Dial("udp", c.conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the packets which are not signed are dropped
+	_, err = conn.Write(packet(t, "", testVL))
+	require.NoError(t, err)
+	_, err = conn.Write(packet(t, "user0", testVL))
+	require.NoError(t, err)
+
+	acc.Wait(1)
+	assert.Len(t, acc.Metrics, 1)
+}
+
+func TestInvalidSecurityLevel(t *testing.T) {
+	c := &Collectd{ServiceAddress: "127.0.0.1:0", SecurityLevel: "paranoid"}
+	require.Error(t, c.Start(&testutil.Accumulator{}))
+}
@@ -1,7 +1,10 @@
 package consul
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/influxdata/telegraf"
@@ -26,8 +29,15 @@ type Consul struct {
 	// Use SSL but skip chain & host verification
 	InsecureSkipVerify bool
 
+	// Gather the number of services, nodes and instances per service
+	GatherCatalog bool
+	// Gather the numeric values of the keys under these prefixes
+	KVPrefixes []string `toml:"kv_prefixes"`
+
 	// client used to connect to Consul agnet
 	client *api.Client
+	// datacenter the metrics are tagged with
+	datacenter string
 }
 
 var sampleConfig = `
@@ -44,6 +54,21 @@ var sampleConfig = `
   # password = ""
   ## Optional data centre to query the health checks from (default: "")
   # datacentre = ""
+
+  ## Optional SSL Config
+  # ssl_ca = "/etc/telegraf/ca.pem"
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+  ## Use SSL but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Gather the number of services and nodes in the catalog, and the number
+  ## of instances of every service (default: false)
+  # gather_catalog = false
+
+  ## Gather the values of the keys under these prefixes of the KV store,
+  ## values that are not numbers are ignored (default: none)
+  # kv_prefixes = ["telegraf/"]
 `
 
 func (c *Consul) Description() string {
@@ -90,6 +115,27 @@ func (c *Consul) createAPIClient() (*api.Client, error) {
 	return api.NewClient(config)
 }
 
+// lookupDatacenter returns the configured datacenter, or the datacenter of
+// the agent if none is configured.
+func (c *Consul) lookupDatacenter() (string, error) {
+	if c.Datacentre != "" {
+		return c.Datacentre, nil
+	}
+
+	self, err := c.client.Agent().Self()
+	if err != nil {
+		return "", err
+	}
+	dc, _ := self["Config"]["Datacenter"].(string)
+	return dc, nil
+}
+
+func (c *Consul) addDatacenter(tags map[string]string) {
+	if c.datacenter != "" {
+		tags["datacenter"] = c.datacenter
+	}
+}
+
 func (c *Consul) GatherHealthCheck(acc telegraf.Accumulator, checks []*api.HealthCheck) {
 	for _, check := range checks {
 		record := make(map[string]interface{})
@@ -107,11 +153,65 @@ func (c *Consul) GatherHealthCheck(acc telegraf.Accumulator, checks []*api.Healt
 		tags["node"] = check.Node
 		tags["service_name"] = check.ServiceName
 		tags["check_id"] = check.CheckID
+		c.addDatacenter(tags)
 
 		acc.AddFields("consul_health_checks", record, tags)
 	}
 }
 
+func (c *Consul) GatherCatalogServices(acc telegraf.Accumulator) error {
+	services, _, err := c.client.Catalog().Services(nil)
+	if err != nil {
+		return err
+	}
+	nodes, _, err := c.client.Catalog().Nodes(nil)
+	if err != nil {
+		return err
+	}
+
+	tags := make(map[string]string)
+	c.addDatacenter(tags)
+	acc.AddFields("consul_catalog", map[string]interface{}{
+		"services": len(services),
+		"nodes":    len(nodes),
+	}, tags)
+
+	for name := range services {
+		instances, _, err := c.client.Catalog().Service(name, "", nil)
+		if err != nil {
+			acc.AddError(fmt.Errorf("unable to list the instances of service %s: %s",
+				name, err))
+			continue
+		}
+
+		tags := map[string]string{"service_name": name}
+		c.addDatacenter(tags)
+		acc.AddFields("consul_catalog_services", map[string]interface{}{
+			"instances": len(instances),
+		}, tags)
+	}
+	return nil
+}
+
+func (c *Consul) GatherKV(acc telegraf.Accumulator, prefix string) error {
+	pairs, _, err := c.client.KV().List(prefix, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, pair := range pairs {
+		value, err := strconv.ParseFloat(strings.TrimSpace(string(pair.Value)), 64)
+		if err != nil {
+			continue
+		}
+
+		tags := map[string]string{"key": pair.Key}
+		c.addDatacenter(tags)
+		acc.AddFields("consul_kv", map[string]interface{}{"value": value}, tags)
+	}
+	return nil
+}
+
 func (c *Consul) Gather(acc telegraf.Accumulator) error {
 	if c.client == nil {
 		newClient, err := c.createAPIClient()
@@ -121,6 +221,11 @@ func (c *Consul) Gather(acc telegraf.Accumulator) error {
 		}
 
 		c.client = newClient
+
+		c.datacenter, err = c.lookupDatacenter()
+		if err != nil {
+			acc.AddError(fmt.Errorf("unable to find the datacenter of the agent: %s", err))
+		}
 	}
 
 	checks, _, err := c.client.Health().State("any", nil)
@@ -131,6 +236,18 @@ func (c *Consul) Gather(acc telegraf.Accumulator) error {
 
 	c.GatherHealthCheck(acc, checks)
 
+	if c.GatherCatalog {
+		if err := c.GatherCatalogServices(acc); err != nil {
+			acc.AddError(err)
+		}
+	}
+
+	for _, prefix := range c.KVPrefixes {
+		if err := c.GatherKV(acc, prefix); err != nil {
+			acc.AddError(fmt.Errorf("unable to list the keys under %s: %s", prefix, err))
+		}
+	}
+
 	return nil
 }
 
@@ -1,10 +1,14 @@
 package consul
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
 )
 
 var sampleChecks = []*api.HealthCheck{
@@ -43,3 +47,80 @@ func TestGatherHealtCheck(t *testing.T) {
 
 	acc.AssertContainsTaggedFields(t, "consul_health_checks", expectedFields, expectedTags)
 }
+
+var consulResponses = map[string]string{
+	"/v1/agent/self": `{"Config": {"Datacenter": "dc1"}}`,
+	"/v1/health/state/any": `[{"Node": "node1", "CheckID": "service:web1",
+		"Name": "web check", "Status": "critical", "ServiceID": "web1",
+		"ServiceName": "web"}]`,
+	"/v1/catalog/services":       `{"consul": [], "web": ["v1"]}`,
+	"/v1/catalog/nodes":          `[{"Node": "node1"}, {"Node": "node2"}]`,
+	"/v1/catalog/service/consul": `[{"Node": "node1"}]`,
+	"/v1/catalog/service/web":    `[{"Node": "node1"}, {"Node": "node2"}]`,
+	// "12" and " 3.5\n" base64 encoded, and a value that is not a number
+	"/v1/kv/limits/": `[{"Key": "limits/max", "Value": "MTI="},
+		{"Key": "limits/ratio", "Value": "IDMuNQo="},
+		{"Key": "limits/name", "Value": "Zm9v"}]`,
+}
+
+func TestGather(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := consulResponses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+
+	consul := &Consul{
+		Address:       ts.Listener.Addr().String(),
+		GatherCatalog: true,
+		KVPrefixes:    []string{"limits/"},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, consul.Gather(&acc))
+	require.Empty(t, acc.Errors)
+
+	acc.AssertContainsTaggedFields(t, "consul_health_checks",
+		map[string]interface{}{
+			"check_name": "web check",
+			"status":     "critical",
+			"passing":    0,
+			"critical":   1,
+			"warning":    0,
+			"service_id": "web1",
+		},
+		map[string]string{
+			"node":         "node1",
+			"service_name": "web",
+			"check_id":     "service:web1",
+			"datacenter":   "dc1",
+		})
+	acc.AssertContainsTaggedFields(t, "consul_catalog",
+		map[string]interface{}{"services": 2, "nodes": 2},
+		map[string]string{"datacenter": "dc1"})
+	acc.AssertContainsTaggedFields(t, "consul_catalog_services",
+		map[string]interface{}{"instances": 2},
+		map[string]string{"service_name": "web", "datacenter": "dc1"})
+	acc.AssertContainsTaggedFields(t, "consul_catalog_services",
+		map[string]interface{}{"instances": 1},
+		map[string]string{"service_name": "consul", "datacenter": "dc1"})
+	acc.AssertContainsTaggedFields(t, "consul_kv",
+		map[string]interface{}{"value": float64(12)},
+		map[string]string{"key": "limits/max", "datacenter": "dc1"})
+	acc.AssertContainsTaggedFields(t, "consul_kv",
+		map[string]interface{}{"value": 3.5},
+		map[string]string{"key": "limits/ratio", "datacenter": "dc1"})
+
+	var kv int
+	for _, m := range acc.Metrics {
+		if m.Measurement == "consul_kv" {
+			kv++
+		}
+	}
+	require.Equal(t, 2, kv, "non numeric values must be ignored")
+}
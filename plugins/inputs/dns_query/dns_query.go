@@ -25,6 +25,8 @@ type DnsQuery struct {
 
 	// Record type
 	RecordType string `toml:"record_type"`
+	// Record types to query, record_type is used when empty
+	RecordTypes []string `toml:"record_types"`
 
 	// DNS server port number
 	Port int
@@ -46,6 +48,8 @@ var sampleConfig = `
   ## Query record type.
   ## Posible values: A, AAAA, CNAME, MX, NS, PTR, TXT, SOA, SPF, SRV.
   # record_type = "A"
+  ## Query several record types, overrides record_type.
+  # record_types = ["A", "AAAA"]
 
   ## Dns server port.
   # port = 53
@@ -64,24 +68,80 @@ func (d *DnsQuery) Description() string {
 func (d *DnsQuery) Gather(acc telegraf.Accumulator) error {
 	d.setDefaultValues()
 
+	recordTypes := d.RecordTypes
+	if len(recordTypes) == 0 {
+		recordTypes = []string{d.RecordType}
+	}
 	for _, domain := range d.Domains {
-		for _, server := range d.Servers {
-			dnsQueryTime, err := d.getDnsQueryTime(domain, server)
-			acc.AddError(err)
-			tags := map[string]string{
-				"server":      server,
-				"domain":      domain,
-				"record_type": d.RecordType,
+		for _, recordType := range recordTypes {
+			for _, server := range d.Servers {
+				d.gatherQuery(acc, domain, recordType, server)
 			}
-
-			fields := map[string]interface{}{"query_time_ms": dnsQueryTime}
-			acc.AddFields("dns_query", fields, tags)
 		}
 	}
 
 	return nil
 }
 
+// gatherQuery reports the response time and code of a query, or the reason
+// no response was received in the result tag.
+func (d *DnsQuery) gatherQuery(
+	acc telegraf.Accumulator,
+	domain string,
+	recordType string,
+	server string,
+) {
+	tags := map[string]string{
+		"server":      server,
+		"domain":      domain,
+		"record_type": recordType,
+	}
+	fields := make(map[string]interface{})
+
+	r, dnsQueryTime, err := d.query(domain, recordType, server)
+	switch {
+	case err == nil:
+		tags["rcode"] = rcodeName(r.Rcode)
+		fields["rcode_value"] = int64(r.Rcode)
+		fields["query_time_ms"] = dnsQueryTime
+		if r.Rcode == dns.RcodeSuccess {
+			tags["result"] = "success"
+			fields["result_code"] = resultSuccess
+		} else {
+			tags["result"] = "error"
+			fields["result_code"] = resultError
+		}
+	case isTimeout(err):
+		acc.AddError(err)
+		tags["result"] = "timeout"
+		fields["result_code"] = resultTimeout
+	default:
+		acc.AddError(err)
+		tags["result"] = "error"
+		fields["result_code"] = resultError
+	}
+	acc.AddFields("dns_query", fields, tags)
+}
+
+// values of the result_code field
+const (
+	resultSuccess = int64(0)
+	resultTimeout = int64(1)
+	resultError   = int64(2)
+)
+
+func rcodeName(rcode int) string {
+	if name, ok := dns.RcodeToString[rcode]; ok {
+		return name
+	}
+	return strconv.Itoa(rcode)
+}
+
+func isTimeout(err error) bool {
+	nerr, ok := err.(net.Error)
+	return ok && nerr.Timeout()
+}
+
 func (d *DnsQuery) setDefaultValues() {
 	if d.Network == "" {
 		d.Network = "udp"
@@ -105,37 +165,37 @@ func (d *DnsQuery) setDefaultValues() {
 	}
 }
 
-func (d *DnsQuery) getDnsQueryTime(domain string, server string) (float64, error) {
-	dnsQueryTime := float64(0)
-
+// query sends a query to server and returns the response along with the
+// time it took in milliseconds.
+func (d *DnsQuery) query(domain, recordType, server string) (*dns.Msg, float64, error) {
 	c := new(dns.Client)
 	c.ReadTimeout = time.Duration(d.Timeout) * time.Second
 	c.Net = d.Network
 
 	m := new(dns.Msg)
-	recordType, err := d.parseRecordType()
+	qtype, err := parseRecordType(recordType)
 	if err != nil {
-		return dnsQueryTime, err
+		return nil, 0, err
 	}
-	m.SetQuestion(dns.Fqdn(domain), recordType)
+	m.SetQuestion(dns.Fqdn(domain), qtype)
 	m.RecursionDesired = true
 
 	r, rtt, err := c.Exchange(m, net.JoinHostPort(server, strconv.Itoa(d.Port)))
 	if err != nil {
-		return dnsQueryTime, err
-	}
-	if r.Rcode != dns.RcodeSuccess {
-		return dnsQueryTime, errors.New(fmt.Sprintf("Invalid answer name %s after %s query for %s\n", domain, d.RecordType, domain))
+		return nil, 0, err
 	}
-	dnsQueryTime = float64(rtt.Nanoseconds()) / 1e6
-	return dnsQueryTime, nil
+	return r, float64(rtt.Nanoseconds()) / 1e6, nil
 }
 
 func (d *DnsQuery) parseRecordType() (uint16, error) {
+	return parseRecordType(d.RecordType)
+}
+
+func parseRecordType(name string) (uint16, error) {
 	var recordType uint16
 	var error error
 
-	switch d.RecordType {
+	switch name {
 	case "A":
 		recordType = dns.TypeA
 	case "AAAA":
@@ -159,7 +219,7 @@ func (d *DnsQuery) parseRecordType() (uint16, error) {
 	case "TXT":
 		recordType = dns.TypeTXT
 	default:
-		error = errors.New(fmt.Sprintf("Record type %s not recognized", d.RecordType))
+		error = errors.New(fmt.Sprintf("Record type %s not recognized", name))
 	}
 
 	return recordType, error
@@ -1,6 +1,7 @@
 package dns_query
 
 import (
+	"net"
 	"testing"
 	"time"
 
@@ -67,8 +68,13 @@ func TestGatheringRootDomain(t *testing.T) {
 		"server":      "8.8.8.8",
 		"domain":      ".",
 		"record_type": "MX",
+		"rcode":       "NOERROR",
+		"result":      "success",
+	}
+	fields := map[string]interface{}{
+		"rcode_value": int64(0),
+		"result_code": int64(0),
 	}
-	fields := map[string]interface{}{}
 
 	err := acc.GatherError(dnsConfig.Gather)
 	assert.NoError(t, err)
@@ -93,8 +99,13 @@ func TestMetricContainsServerAndDomainAndRecordTypeTags(t *testing.T) {
 		"server":      "8.8.8.8",
 		"domain":      "google.com",
 		"record_type": "NS",
+		"rcode":       "NOERROR",
+		"result":      "success",
+	}
+	fields := map[string]interface{}{
+		"rcode_value": int64(0),
+		"result_code": int64(0),
 	}
-	fields := map[string]interface{}{}
 
 	err := acc.GatherError(dnsConfig.Gather)
 	assert.NoError(t, err)
@@ -208,3 +219,54 @@ func TestRecordTypeParserError(t *testing.T) {
 	_, err = dnsConfig.parseRecordType()
 	assert.Error(t, err)
 }
+
+// fakeServer answers every query on a local udp port with the given rcode and
+// no records, it returns its port.
+func fakeServer(t *testing.T, rcode byte) int {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		defer pc.Close()
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 12 {
+				continue
+			}
+			// QR flag and response code, the question is kept
+			buf[2] |= 0x80
+			buf[3] = buf[3]&0xf0 | rcode
+			pc.WriteTo(buf[:n], addr)
+		}
+	}()
+	return pc.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestGatheringRcode(t *testing.T) {
+	dnsConfig := DnsQuery{
+		Servers:     []string{"127.0.0.1"},
+		Domains:     []string{"example.com"},
+		RecordTypes: []string{"A", "AAAA"},
+		Port:        fakeServer(t, 3),
+	}
+	var acc testutil.Accumulator
+
+	require.NoError(t, acc.GatherError(dnsConfig.Gather))
+	require.Len(t, acc.Metrics, 2)
+	for i, recordType := range []string{"A", "AAAA"} {
+		m := acc.Metrics[i]
+		assert.Equal(t, map[string]string{
+			"server":      "127.0.0.1",
+			"domain":      "example.com",
+			"record_type": recordType,
+			"rcode":       "NXDOMAIN",
+			"result":      "error",
+		}, m.Tags)
+		assert.Equal(t, int64(3), m.Fields["rcode_value"])
+		assert.Equal(t, int64(2), m.Fields["result_code"])
+		assert.Contains(t, m.Fields, "query_time_ms")
+	}
+}
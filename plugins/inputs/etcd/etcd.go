@@ -0,0 +1,257 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Etcd gathers the health and the main server metrics of etcd members from
+// their /health and /metrics endpoints.
+type Etcd struct {
+	Servers         []string
+	ResponseTimeout internal.Duration
+	// Path to CA file
+	SSLCA string `toml:"ssl_ca"`
+	// Path to host cert file
+	SSLCert string `toml:"ssl_cert"`
+	// Path to cert key file
+	SSLKey string `toml:"ssl_key"`
+	// Use SSL but skip chain & host verification
+	InsecureSkipVerify bool
+
+	client *http.Client
+
+	// counters of the previous Gather per server, to compute rates
+	mu   sync.Mutex
+	last map[string]sample
+}
+
+// sample holds the counters rates are computed from.
+type sample struct {
+	time            time.Time
+	proposalsFailed float64
+	walFsyncCount   float64
+	walFsyncSum     float64
+}
+
+// etcdFields maps etcd metrics to fields, the first metric found is used
+// when several map to the same field.
+var etcdFields = []struct {
+	name  string
+	field string
+}{
+	{"etcd_server_has_leader", "has_leader"},
+	{"etcd_server_is_leader", "is_leader"},
+	{"etcd_server_leader_changes_seen_total", "leader_changes"},
+	{"etcd_server_proposals_committed_total", "proposals_committed"},
+	{"etcd_server_proposals_applied_total", "proposals_applied"},
+	{"etcd_server_proposals_pending", "proposals_pending"},
+	{"etcd_server_proposals_failed_total", "proposals_failed"},
+	// renamed in etcd 3.4
+	{"etcd_mvcc_db_total_size_in_bytes", "db_size_bytes"},
+	{"etcd_debugging_mvcc_db_total_size_in_bytes", "db_size_bytes"},
+}
+
+var sampleConfig = `
+  ## Client URLs of the etcd members to gather from.
+  servers = ["http://localhost:2379"]
+
+  ## Maximum time to receive a response.
+  # response_timeout = "5s"
+
+  ## Optional SSL Config, etcd members started with --client-cert-auth
+  ## require a client certificate.
+  # ssl_ca = "/etc/telegraf/ca.pem"
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+  ## Use SSL but skip chain & host verification
+  # insecure_skip_verify = false
+`
+
+func (e *Etcd) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *Etcd) Description() string {
+	return "Read the health and server metrics of etcd members"
+}
+
+func (e *Etcd) Gather(acc telegraf.Accumulator) error {
+	if e.client == nil {
+		client, err := e.createHttpClient()
+		if err != nil {
+			return err
+		}
+		e.client = client
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(e.Servers))
+	for _, server := range e.Servers {
+		go func(server string) {
+			defer wg.Done()
+			acc.AddError(e.gatherServer(strings.TrimRight(server, "/"), acc))
+		}(server)
+	}
+
+	wg.Wait()
+	return nil
+}
+
+func (e *Etcd) createHttpClient() (*http.Client, error) {
+	tlsCfg, err := internal.GetTLSConfig(
+		e.SSLCert, e.SSLKey, e.SSLCA, e.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsCfg,
+		},
+		Timeout: e.ResponseTimeout.Duration,
+	}
+
+	return client, nil
+}
+
+func (e *Etcd) gatherServer(server string, acc telegraf.Accumulator) error {
+	healthy, err := e.health(server)
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Get(server + "/metrics")
+	if err != nil {
+		return fmt.Errorf("error on request to %s/metrics: %s", server, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s/metrics returned HTTP status %s", server, resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to parse the metrics of %s: %s", server, err)
+	}
+
+	now := time.Now()
+	fields := map[string]interface{}{
+		"healthy": boolToInt(healthy),
+	}
+	for _, f := range etcdFields {
+		if _, ok := fields[f.field]; ok {
+			continue
+		}
+		if mf, ok := families[f.name]; ok {
+			fields[f.field] = value(mf)
+		}
+	}
+
+	cur := sample{time: now}
+	cur.proposalsFailed, _ = fields["proposals_failed"].(float64)
+	if mf, ok := families["etcd_disk_wal_fsync_duration_seconds"]; ok {
+		for _, m := range mf.Metric {
+			cur.walFsyncCount += float64(m.GetHistogram().GetSampleCount())
+			cur.walFsyncSum += m.GetHistogram().GetSampleSum()
+		}
+		fields["wal_fsync_count"] = cur.walFsyncCount
+		fields["wal_fsync_sum_seconds"] = cur.walFsyncSum
+	}
+
+	e.mu.Lock()
+	prev, ok := e.last[server]
+	if e.last == nil {
+		e.last = make(map[string]sample)
+	}
+	e.last[server] = cur
+	e.mu.Unlock()
+
+	// the counters restart from 0 when the member restarts
+	if ok && cur.proposalsFailed >= prev.proposalsFailed &&
+		cur.walFsyncCount >= prev.walFsyncCount {
+		if elapsed := cur.time.Sub(prev.time).Seconds(); elapsed > 0 {
+			fields["proposals_failed_rate"] =
+				(cur.proposalsFailed - prev.proposalsFailed) / elapsed
+		}
+		if n := cur.walFsyncCount - prev.walFsyncCount; n > 0 {
+			fields["wal_fsync_mean_seconds"] =
+				(cur.walFsyncSum - prev.walFsyncSum) / n
+		}
+	}
+
+	acc.AddFields("etcd", fields, map[string]string{"server": server}, now)
+	return nil
+}
+
+// health returns whether the /health endpoint of the server reports it as
+// healthy. Unhealthy members answer with a 503 status and a JSON body.
+func (e *Etcd) health(server string) (bool, error) {
+	resp, err := e.client.Get(server + "/health")
+	if err != nil {
+		return false, fmt.Errorf("error on request to %s/health: %s", server, err)
+	}
+	defer resp.Body.Close()
+
+	var health struct {
+		// a string in etcd 3, a boolean in etcd 2
+		Health interface{} `json:"health"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return false, fmt.Errorf("unable to decode the health of %s (HTTP status %s): %s",
+			server, resp.Status, err)
+	}
+	switch h := health.Health.(type) {
+	case bool:
+		return h, nil
+	case string:
+		return h == "true", nil
+	}
+	return false, nil
+}
+
+// value returns the sum of the values of the metrics of a counter, gauge or
+// untyped family.
+func value(mf *dto.MetricFamily) float64 {
+	var v float64
+	for _, m := range mf.Metric {
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			v += m.GetCounter().GetValue()
+		case dto.MetricType_GAUGE:
+			v += m.GetGauge().GetValue()
+		default:
+			v += m.GetUntyped().GetValue()
+		}
+	}
+	return v
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func init() {
+	inputs.Add("etcd", func() telegraf.Input {
+		return &Etcd{
+			Servers:         []string{"http://localhost:2379"},
+			ResponseTimeout: internal.Duration{Duration: 5 * time.Second},
+		}
+	})
+}
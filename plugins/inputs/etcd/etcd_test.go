@@ -0,0 +1,107 @@
+package etcd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const etcdMetrics = `# HELP etcd_server_has_leader Whether or not a leader exists. 1 is existence, 0 is not.
+# TYPE etcd_server_has_leader gauge
+etcd_server_has_leader 1
+# HELP etcd_server_leader_changes_seen_total The number of leader changes seen.
+# TYPE etcd_server_leader_changes_seen_total counter
+etcd_server_leader_changes_seen_total 2
+# HELP etcd_server_proposals_failed_total The total number of failed proposals seen.
+# TYPE etcd_server_proposals_failed_total counter
+etcd_server_proposals_failed_total %d
+# HELP etcd_server_proposals_pending The current number of pending proposals to commit.
+# TYPE etcd_server_proposals_pending gauge
+etcd_server_proposals_pending 0
+# HELP etcd_debugging_mvcc_db_total_size_in_bytes Total size of the underlying database in bytes.
+# TYPE etcd_debugging_mvcc_db_total_size_in_bytes gauge
+etcd_debugging_mvcc_db_total_size_in_bytes 2.4576e+06
+# HELP etcd_disk_wal_fsync_duration_seconds The latency distributions of fsync called by wal.
+# TYPE etcd_disk_wal_fsync_duration_seconds histogram
+etcd_disk_wal_fsync_duration_seconds_bucket{le="0.001"} 0
+etcd_disk_wal_fsync_duration_seconds_bucket{le="+Inf"} %d
+etcd_disk_wal_fsync_duration_seconds_sum %g
+etcd_disk_wal_fsync_duration_seconds_count %d
+`
+
+func TestGather(t *testing.T) {
+	failed, fsyncs, fsyncSum := 3, 10, 0.05
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			fmt.Fprint(w, `{"health": "true"}`)
+		case "/metrics":
+			fmt.Fprintf(w, etcdMetrics, failed, fsyncs, fsyncSum, fsyncs)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	e := &Etcd{Servers: []string{ts.URL + "/"}}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(e.Gather))
+	acc.AssertContainsTaggedFields(t, "etcd",
+		map[string]interface{}{
+			"healthy":               int64(1),
+			"has_leader":            float64(1),
+			"leader_changes":        float64(2),
+			"proposals_pending":     float64(0),
+			"proposals_failed":      float64(3),
+			"db_size_bytes":         float64(2457600),
+			"wal_fsync_count":       float64(10),
+			"wal_fsync_sum_seconds": 0.05,
+		},
+		map[string]string{"server": ts.URL})
+
+	// rates are computed from the second Gather on
+	e.last[ts.URL] = sample{
+		time:            e.last[ts.URL].time.Add(-10 * time.Second),
+		proposalsFailed: 3,
+		walFsyncCount:   10,
+		walFsyncSum:     0.05,
+	}
+	failed, fsyncs, fsyncSum = 8, 20, 0.25
+	acc.ClearMetrics()
+	require.NoError(t, acc.GatherError(e.Gather))
+	require.Len(t, acc.Metrics, 1)
+	fields := acc.Metrics[0].Fields
+	assert.InDelta(t, 0.5, fields["proposals_failed_rate"], 0.01)
+	assert.InDelta(t, 0.02, fields["wal_fsync_mean_seconds"], 0.0001)
+}
+
+func TestGatherUnhealthy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"health": "false"}`)
+		case "/metrics":
+			fmt.Fprint(w, "etcd_server_has_leader 0\n")
+		}
+	}))
+	defer ts.Close()
+
+	e := &Etcd{Servers: []string{ts.URL}}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(e.Gather))
+	acc.AssertContainsTaggedFields(t, "etcd",
+		map[string]interface{}{
+			"healthy":    int64(0),
+			"has_leader": float64(0),
+		},
+		map[string]string{"server": ts.URL})
+}
@@ -1,8 +1,11 @@
 package exec
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"log"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
@@ -31,6 +34,11 @@ const sampleConfig = `
   ## Timeout for each command to complete.
   timeout = "5s"
 
+  ## Environment variables of the commands, in addition to those of telegraf,
+  ## and their working directory.
+  # environment = ["LANG=C"]
+  # dir = "/var/lib/telegraf"
+
   ## measurement name suffix (for separating different commands)
   name_suffix = "_mycollector"
 
@@ -39,18 +47,41 @@ const sampleConfig = `
   ## more about them here:
   ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_INPUT.md
   data_format = "influx"
+
+  ## Commands run with their own options, the options left unset are those
+  ## of the plugin. The environment variables are added to the plugin's.
+  # [[inputs.exec.program]]
+  #   command = "/usr/local/bin/collect_queues.py --json"
+  #   timeout = "30s"
+  #   environment = ["PYTHONUNBUFFERED=1"]
+  #   dir = "/var/lib/queues"
+  #   data_format = "json"
 `
 
 type Exec struct {
-	Commands []string
-	Command  string
-	Timeout  internal.Duration
+	Commands    []string
+	Command     string
+	Timeout     internal.Duration
+	Environment []string
+	Dir         string
+	Programs    []*Program `toml:"program"`
 
 	parser parsers.Parser
 
 	runner Runner
 }
 
+// Program is a command with its own options, the parser being built from
+// its data_format.
+type Program struct {
+	Command     string
+	Timeout     internal.Duration
+	Environment []string
+	Dir         string
+
+	parser parsers.Parser
+}
+
 func NewExec() *Exec {
 	return &Exec{
 		runner:  CommandRunner{},
@@ -59,7 +90,7 @@ func NewExec() *Exec {
 }
 
 type Runner interface {
-	Run(*Exec, string, telegraf.Accumulator) ([]byte, error)
+	Run(*Exec, Program, telegraf.Accumulator) ([]byte, error)
 }
 
 type CommandRunner struct{}
@@ -86,28 +117,35 @@ func AddNagiosState(exitCode error, acc telegraf.Accumulator) error {
 
 func (c CommandRunner) Run(
 	e *Exec,
-	command string,
+	p Program,
 	acc telegraf.Accumulator,
 ) ([]byte, error) {
-	split_cmd, err := shellquote.Split(command)
+	split_cmd, err := shellquote.Split(p.Command)
 	if err != nil || len(split_cmd) == 0 {
 		return nil, fmt.Errorf("exec: unable to parse command, %s", err)
 	}
 
 	cmd := exec.Command(split_cmd[0], split_cmd[1:]...)
+	if len(p.Environment) > 0 {
+		cmd.Env = append(os.Environ(), p.Environment...)
+	}
+	cmd.Dir = p.Dir
 
-	var out bytes.Buffer
+	var out, stderr bytes.Buffer
 	cmd.Stdout = &out
+	cmd.Stderr = &stderr
 
-	if err := internal.RunTimeout(cmd, e.Timeout.Duration); err != nil {
-		switch e.parser.(type) {
+	err = internal.RunTimeout(cmd, p.Timeout.Duration)
+	logStderr(p.Command, &stderr)
+	if err != nil {
+		switch p.parser.(type) {
 		case *nagios.NagiosParser:
 			AddNagiosState(err, acc)
 		default:
-			return nil, fmt.Errorf("exec: %s for command '%s'", err, command)
+			return nil, fmt.Errorf("exec: %s for command '%s'", err, p.Command)
 		}
 	} else {
-		switch e.parser.(type) {
+		switch p.parser.(type) {
 		case *nagios.NagiosParser:
 			AddNagiosState(nil, acc)
 		}
@@ -117,6 +155,17 @@ func (c CommandRunner) Run(
 	return out.Bytes(), nil
 }
 
+// logStderr logs the lines written to stderr by a command, prefixed with
+// the command.
+func logStderr(command string, stderr *bytes.Buffer) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			log.Printf("W! exec: [%s] %s\n", command, line)
+		}
+	}
+}
+
 // removeCarriageReturns removes all carriage returns from the input if the
 // OS is Windows. It does not return any errors.
 func removeCarriageReturns(b bytes.Buffer) bytes.Buffer {
@@ -143,16 +192,16 @@ func removeCarriageReturns(b bytes.Buffer) bytes.Buffer {
 
 }
 
-func (e *Exec) ProcessCommand(command string, acc telegraf.Accumulator, wg *sync.WaitGroup) {
+func (e *Exec) ProcessCommand(p Program, acc telegraf.Accumulator, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	out, err := e.runner.Run(e, command, acc)
+	out, err := e.runner.Run(e, p, acc)
 	if err != nil {
 		acc.AddError(err)
 		return
 	}
 
-	metrics, err := e.parser.Parse(out)
+	metrics, err := p.parser.Parse(out)
 	if err != nil {
 		acc.AddError(err)
 	} else {
@@ -174,6 +223,35 @@ func (e *Exec) SetParser(parser parsers.Parser) {
 	e.parser = parser
 }
 
+func (e *Exec) ParserTable() string {
+	return "program"
+}
+
+func (e *Exec) SetSubParsers(subParsers []parsers.Parser) {
+	for i, parser := range subParsers {
+		if i < len(e.Programs) {
+			e.Programs[i].parser = parser
+		}
+	}
+}
+
+// program returns the program running command, with the options of p, or
+// those of the plugin when unset.
+func (e *Exec) program(p Program, command string) Program {
+	p.Command = command
+	if p.Timeout.Duration == 0 {
+		p.Timeout = e.Timeout
+	}
+	if p.Dir == "" {
+		p.Dir = e.Dir
+	}
+	p.Environment = append(append([]string{}, e.Environment...), p.Environment...)
+	if p.parser == nil {
+		p.parser = e.parser
+	}
+	return p
+}
+
 func (e *Exec) Gather(acc telegraf.Accumulator) error {
 	var wg sync.WaitGroup
 	// Legacy single command support
@@ -182,45 +260,54 @@ func (e *Exec) Gather(acc telegraf.Accumulator) error {
 		e.Command = ""
 	}
 
-	commands := make([]string, 0, len(e.Commands))
+	programs := make([]Program, 0, len(e.Commands)+len(e.Programs))
 	for _, pattern := range e.Commands {
-		cmdAndArgs := strings.SplitN(pattern, " ", 2)
-		if len(cmdAndArgs) == 0 {
-			continue
-		}
-
-		matches, err := filepath.Glob(cmdAndArgs[0])
-		if err != nil {
-			acc.AddError(err)
-			continue
-		}
-
-		if len(matches) == 0 {
-			// There were no matches with the glob pattern, so let's assume
-			// that the command is in PATH and just run it as it is
-			commands = append(commands, pattern)
-		} else {
-			// There were matches, so we'll append each match together with
-			// the arguments to the commands slice
-			for _, match := range matches {
-				if len(cmdAndArgs) == 1 {
-					commands = append(commands, match)
-				} else {
-					commands = append(commands,
-						strings.Join([]string{match, cmdAndArgs[1]}, " "))
-				}
-			}
-		}
+		programs = e.expand(programs, Program{Command: pattern}, acc)
+	}
+	for _, p := range e.Programs {
+		programs = e.expand(programs, *p, acc)
 	}
 
-	wg.Add(len(commands))
-	for _, command := range commands {
-		go e.ProcessCommand(command, acc, &wg)
+	wg.Add(len(programs))
+	for _, p := range programs {
+		go e.ProcessCommand(p, acc, &wg)
 	}
 	wg.Wait()
 	return nil
 }
 
+// expand appends the programs running the commands matching the glob
+// pattern of the command of p.
+func (e *Exec) expand(programs []Program, p Program, acc telegraf.Accumulator) []Program {
+	cmdAndArgs := strings.SplitN(p.Command, " ", 2)
+	if len(cmdAndArgs) == 0 {
+		return programs
+	}
+
+	matches, err := filepath.Glob(cmdAndArgs[0])
+	if err != nil {
+		acc.AddError(err)
+		return programs
+	}
+
+	if len(matches) == 0 {
+		// There were no matches with the glob pattern, so let's assume
+		// that the command is in PATH and just run it as it is
+		return append(programs, e.program(p, p.Command))
+	}
+	// There were matches, so we'll append each match together with
+	// the arguments to the programs
+	for _, match := range matches {
+		if len(cmdAndArgs) == 1 {
+			programs = append(programs, e.program(p, match))
+		} else {
+			programs = append(programs, e.program(p,
+				strings.Join([]string{match, cmdAndArgs[1]}, " ")))
+		}
+	}
+	return programs
+}
+
 func init() {
 	inputs.Add("exec", func() telegraf.Input {
 		return NewExec()
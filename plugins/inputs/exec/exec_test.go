@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/parsers"
 
 	"github.com/influxdata/telegraf/testutil"
@@ -85,7 +87,7 @@ func newRunnerMock(out []byte, err error) Runner {
 	}
 }
 
-func (r runnerMock) Run(e *Exec, command string, acc telegraf.Accumulator) ([]byte, error) {
+func (r runnerMock) Run(e *Exec, p Program, acc telegraf.Accumulator) ([]byte, error) {
 	if r.err != nil {
 		return nil, r.err
 	}
@@ -286,3 +288,44 @@ func TestRemoveCarriageReturns(t *testing.T) {
 		}
 	}
 }
+
+func TestExecProgram(t *testing.T) {
+	valueParser, _ := parsers.NewValueParser("metric", "string", nil)
+	influxParser, _ := parsers.NewInfluxParser()
+	e := NewExec()
+	e.SetParser(valueParser)
+	e.Environment = []string{"FOO=1"}
+	e.Programs = []*Program{
+		{
+			Command:     `sh -c 'echo "env foo=$FOO,bar=$BAR"'`,
+			Environment: []string{"BAR=2"},
+		},
+		{Command: "pwd", Dir: "/"},
+	}
+	e.SetSubParsers([]parsers.Parser{influxParser, nil})
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(e.Gather))
+	acc.AssertContainsFields(t, "env", map[string]interface{}{
+		"foo": float64(1),
+		"bar": float64(2),
+	})
+	acc.AssertContainsFields(t, "metric", map[string]interface{}{"value": "/"})
+}
+
+func TestExecProgramTimeout(t *testing.T) {
+	parser, _ := parsers.NewValueParser("metric", "string", nil)
+	e := NewExec()
+	e.SetParser(parser)
+	e.Programs = []*Program{{
+		Command: "sleep 5",
+		Timeout: internal.Duration{Duration: 100 * time.Millisecond},
+	}}
+
+	var acc testutil.Accumulator
+	start := time.Now()
+	err := acc.GatherError(e.Gather)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sleep 5")
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
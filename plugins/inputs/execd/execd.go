@@ -0,0 +1,308 @@
+package execd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/plugins/parsers"
+)
+
+const (
+	defaultRestartDelay    = 10 * time.Second
+	defaultMaxRestartDelay = 5 * time.Minute
+	// time given to the process to exit on Stop before it is killed
+	killTimeout = 5 * time.Second
+	// maximum length of a line of the output
+	maxLineSize = 1024 * 1024
+)
+
+const sampleConfig = `
+  ## Program to run and its arguments, it is expected to run until telegraf
+  ## stops and to write its metrics to stdout, a metric per line.
+  command = ["/usr/local/bin/collector", "--interval", "10s"]
+
+  ## Environment variables of the program, in addition to those of telegraf.
+  # environment = ["LANG=C"]
+
+  ## Signal sent to the program on each collection interval:
+  ##   "none"    : the program writes its metrics on its own schedule
+  ##   "STDIN"   : a newline is written to its stdin
+  ##   "SIGHUP"  : the SIGHUP signal is sent, SIGUSR1 and SIGUSR2 also work
+  signal = "none"
+
+  ## Delay before restarting the program after it exited, doubled after each
+  ## restart up to max_restart_delay. It is reset once the program ran for
+  ## max_restart_delay.
+  # restart_delay = "10s"
+  # max_restart_delay = "5m"
+
+  ## Data format to consume.
+  ## Each data format has its own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_INPUT.md
+  data_format = "influx"
+`
+
+// Execd runs a long-lived program and reads the metrics it writes to
+// stdout, so that plugins can be written in any language.
+type Execd struct {
+	Command         []string
+	Environment     []string
+	Signal          string
+	RestartDelay    internal.Duration
+	MaxRestartDelay internal.Duration
+
+	parser parsers.Parser
+	acc    telegraf.Accumulator
+
+	mu sync.Mutex
+	// cmd is the running process and stdin its input, nil between runs
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (e *Execd) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *Execd) Description() string {
+	return "Run a long-lived program and read the metrics it writes to stdout"
+}
+
+func (e *Execd) SetParser(parser parsers.Parser) {
+	e.parser = parser
+}
+
+// Start starts the program, it is restarted each time it exits until Stop.
+func (e *Execd) Start(acc telegraf.Accumulator) error {
+	if len(e.Command) == 0 {
+		return fmt.Errorf("execd: command is required")
+	}
+	switch e.Signal {
+	case "", "none", "STDIN":
+	default:
+		if _, ok := signals[e.Signal]; !ok {
+			return fmt.Errorf("execd: unsupported signal %q", e.Signal)
+		}
+	}
+	if e.RestartDelay.Duration <= 0 {
+		e.RestartDelay.Duration = defaultRestartDelay
+	}
+	if e.MaxRestartDelay.Duration < e.RestartDelay.Duration {
+		e.MaxRestartDelay.Duration = e.RestartDelay.Duration
+	}
+
+	e.acc = acc
+	e.done = make(chan struct{})
+	e.wg.Add(1)
+	go e.run()
+
+	log.Printf("I! Started execd of %s\n", e.Command[0])
+	return nil
+}
+
+// Gather signals the program to write its metrics.
+func (e *Execd) Gather(_ telegraf.Accumulator) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cmd == nil {
+		// the program is restarting
+		return nil
+	}
+
+	switch e.Signal {
+	case "", "none":
+		return nil
+	case "STDIN":
+		if _, err := io.WriteString(e.stdin, "\n"); err != nil {
+			return fmt.Errorf("execd: unable to write to the stdin of %s: %s",
+				e.Command[0], err)
+		}
+		return nil
+	default:
+		if err := e.cmd.Process.Signal(signals[e.Signal]); err != nil {
+			return fmt.Errorf("execd: unable to signal %s: %s", e.Command[0], err)
+		}
+		return nil
+	}
+}
+
+// Stop asks the program to exit, it is killed if it is still running after
+// killTimeout.
+func (e *Execd) Stop() {
+	close(e.done)
+	e.mu.Lock()
+	if e.cmd != nil {
+		if e.stdin != nil {
+			e.stdin.Close()
+		}
+		terminate(e.cmd.Process)
+	}
+	e.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(killTimeout):
+		log.Printf("W! execd: %s did not exit after %s, killing it\n",
+			e.Command[0], killTimeout)
+		e.mu.Lock()
+		if e.cmd != nil {
+			e.cmd.Process.Kill()
+		}
+		e.mu.Unlock()
+		<-stopped
+	}
+	log.Printf("I! Stopped execd of %s\n", e.Command[0])
+}
+
+// run runs the program until Stop, restarting it with backoff.
+func (e *Execd) run() {
+	defer e.wg.Done()
+	delay := e.RestartDelay.Duration
+	for {
+		start := time.Now()
+		err := e.runProcess()
+		select {
+		case <-e.done:
+			return
+		default:
+		}
+
+		if err != nil {
+			e.acc.AddError(fmt.Errorf("execd: %s: %s", e.Command[0], err))
+		}
+		if time.Since(start) >= e.MaxRestartDelay.Duration {
+			delay = e.RestartDelay.Duration
+		}
+		log.Printf("W! execd: %s exited, restarting it in %s\n", e.Command[0], delay)
+		internal.Sleep(delay, e.done)
+
+		delay *= 2
+		if delay > e.MaxRestartDelay.Duration {
+			delay = e.MaxRestartDelay.Duration
+		}
+	}
+}
+
+// runProcess runs the program once and reads its output until it exits.
+func (e *Execd) runProcess() error {
+	cmd := exec.Command(e.Command[0], e.Command[1:]...)
+	if len(e.Environment) > 0 {
+		cmd.Env = append(os.Environ(), e.Environment...)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	var stdin io.WriteCloser
+	if e.Signal == "STDIN" {
+		if stdin, err = cmd.StdinPipe(); err != nil {
+			return err
+		}
+	}
+
+	// the process must not be started once Stop looked for it
+	e.mu.Lock()
+	select {
+	case <-e.done:
+		e.mu.Unlock()
+		return nil
+	default:
+	}
+	if err := cmd.Start(); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	e.cmd, e.stdin = cmd, stdin
+	e.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		e.readStdout(stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		e.readStderr(stderr)
+	}()
+	// the pipes must be read until the end before waiting for the process
+	wg.Wait()
+	err = cmd.Wait()
+
+	e.mu.Lock()
+	e.cmd, e.stdin = nil, nil
+	e.mu.Unlock()
+	return err
+}
+
+// readStdout parses each line of the output of the program.
+func (e *Execd) readStdout(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		metrics, err := e.parser.Parse([]byte(line + "\n"))
+		if err != nil {
+			e.acc.AddError(fmt.Errorf("execd: unable to parse the output of %s: %s",
+				e.Command[0], err))
+			continue
+		}
+		for _, m := range metrics {
+			e.acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		e.acc.AddError(fmt.Errorf("execd: unable to read the output of %s: %s",
+			e.Command[0], err))
+		// keep draining the pipe so that the program does not block
+		io.Copy(ioutil.Discard, r)
+	}
+}
+
+// readStderr logs the lines the program writes to stderr.
+func (e *Execd) readStderr(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			log.Printf("W! execd: [%s] %s\n", e.Command[0], line)
+		}
+	}
+	io.Copy(ioutil.Discard, r)
+}
+
+func init() {
+	inputs.Add("execd", func() telegraf.Input {
+		return &Execd{
+			Signal:          "none",
+			RestartDelay:    internal.Duration{Duration: defaultRestartDelay},
+			MaxRestartDelay: internal.Duration{Duration: defaultMaxRestartDelay},
+		}
+	})
+}
@@ -0,0 +1,20 @@
+// +build !windows
+
+package execd
+
+import (
+	"os"
+	"syscall"
+)
+
+// signals are the signals which can be sent on each collection interval.
+var signals = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+// terminate asks the process to exit.
+func terminate(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,96 @@
+// +build !windows
+
+package execd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/parsers"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newExecd(signal string, command ...string) *Execd {
+	parser, _ := parsers.NewInfluxParser()
+	e := &Execd{
+		Command:      command,
+		Signal:       signal,
+		RestartDelay: internal.Duration{Duration: 10 * time.Millisecond},
+	}
+	e.SetParser(parser)
+	return e
+}
+
+func TestExecdOutput(t *testing.T) {
+	e := newExecd("none", "sh", "-c",
+		`echo "cpu,host=$HOST value=1"; echo "cpu,host=b value=2"; exec sleep 30`)
+	e.Environment = []string{"HOST=a"}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	acc.Wait(2)
+	acc.AssertContainsTaggedFields(t, "cpu",
+		map[string]interface{}{"value": float64(1)}, map[string]string{"host": "a"})
+	acc.AssertContainsTaggedFields(t, "cpu",
+		map[string]interface{}{"value": float64(2)}, map[string]string{"host": "b"})
+}
+
+func TestExecdSignalStdin(t *testing.T) {
+	e := newExecd("STDIN", "sh", "-c",
+		`echo "ready value=1"; while read line; do echo "tick value=1"; done`)
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	acc.Wait(1)
+	require.NoError(t, e.Gather(acc))
+	require.NoError(t, e.Gather(acc))
+	acc.Wait(3)
+	assert.True(t, acc.HasMeasurement("tick"))
+}
+
+func TestExecdSignal(t *testing.T) {
+	e := newExecd("SIGUSR1", "sh", "-c",
+		`trap 'echo "usr1 value=1"' USR1; echo "ready value=1"; `+
+			`while true; do sleep 0.01; done`)
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	acc.Wait(1)
+	require.NoError(t, e.Gather(acc))
+	acc.Wait(2)
+	assert.True(t, acc.HasMeasurement("usr1"))
+}
+
+func TestExecdRestart(t *testing.T) {
+	e := newExecd("none", "sh", "-c", `echo "run value=1"`)
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	// the restarts are delayed by 10, 20 and 40ms
+	acc.Wait(4)
+}
+
+func TestExecdParseError(t *testing.T) {
+	e := newExecd("none", "sh", "-c", `echo "not line protocol"; exec sleep 30`)
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	acc.WaitError(1)
+	acc.Lock()
+	defer acc.Unlock()
+	assert.Contains(t, acc.Errors[0].Error(), "unable to parse the output of sh")
+}
+
+func TestExecdInvalidConfig(t *testing.T) {
+	acc := &testutil.Accumulator{}
+	assert.Error(t, newExecd("none").Start(acc))
+	assert.Error(t, newExecd("SIGKILL", "true").Start(acc))
+}
@@ -0,0 +1,14 @@
+// +build windows
+
+package execd
+
+import "os"
+
+// signals are the signals which can be sent on each collection interval,
+// Windows has none.
+var signals = map[string]os.Signal{}
+
+// terminate kills the process, Windows processes cannot be asked to exit.
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
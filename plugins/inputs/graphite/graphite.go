@@ -0,0 +1,352 @@
+package graphite
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/plugins/parsers/graphite"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// maxPickleSize is the maximum size of a pickle message, carbon relays send
+// at most a few hundred datapoints per message.
+const maxPickleSize = 16 * 1024 * 1024
+
+// Graphite is a carbon compatible listener, receiving the plaintext and the
+// pickle protocols.
+type Graphite struct {
+	ServiceAddress string `toml:"service_address"`
+	PickleAddress  string `toml:"pickle_address"`
+	MaxConnections int    `toml:"max_connections"`
+	ReadTimeout    internal.Duration
+
+	// Separator joins the parts of the names used as measurement by the
+	// templates.
+	Separator string
+	Templates []string
+
+	parser *graphite.GraphiteParser
+	acc    telegraf.Accumulator
+
+	sync.Mutex
+	wg        sync.WaitGroup
+	listeners []net.Listener
+	conns     map[net.Conn]bool
+
+	CurrentConnections selfstat.Stat
+	MetricsReceived    selfstat.Stat
+	Malformed          selfstat.Stat
+}
+
+var sampleConfig = `
+  ## Address to listen on for the plaintext protocol, "name value timestamp"
+  ## lines, and for the pickle protocol of carbon relays, empty to disable it.
+  service_address = ":2003"
+  pickle_address = ":2004"
+
+  ## Maximum number of concurrent connections per address, 0 (default) is
+  ## unlimited.
+  # max_connections = 0
+
+  ## Connections idle for read_timeout are closed, 0 (default) never closes
+  ## them.
+  # read_timeout = "0s"
+
+  ## Templates translating the names to measurements, tags and fields, as for
+  ## the statsd input and the graphite data format, more info can be read here:
+  ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_INPUT.md#graphite
+  # separator = "_"
+  # templates = [
+  #   "cpu.* measurement.host.field",
+  #   "measurement*"
+  # ]
+`
+
+func (g *Graphite) SampleConfig() string {
+	return sampleConfig
+}
+
+func (g *Graphite) Description() string {
+	return "Carbon compatible listener of the Graphite plaintext and pickle protocols"
+}
+
+func (g *Graphite) Gather(_ telegraf.Accumulator) error {
+	return nil
+}
+
+func (g *Graphite) Start(acc telegraf.Accumulator) error {
+	g.Lock()
+	defer g.Unlock()
+
+	parser, err := graphite.NewGraphiteParser(g.Separator, g.Templates, nil)
+	if err != nil {
+		return fmt.Errorf("invalid templates: %s", err)
+	}
+	g.parser = parser
+	g.acc = acc
+	g.conns = make(map[net.Conn]bool)
+
+	tags := map[string]string{"address": g.ServiceAddress}
+	g.CurrentConnections = selfstat.Register("graphite", "current_connections", tags)
+	g.MetricsReceived = selfstat.Register("graphite", "metrics_received", tags)
+	g.Malformed = selfstat.Register("graphite", "malformed", tags)
+
+	for _, l := range []struct {
+		address string
+		read    func(net.Conn)
+	}{
+		{g.ServiceAddress, g.readPlaintext},
+		{g.PickleAddress, g.readPickle},
+	} {
+		if l.address == "" {
+			continue
+		}
+		listener, err := net.Listen("tcp", l.address)
+		if err != nil {
+			g.closeListeners()
+			return err
+		}
+		g.listeners = append(g.listeners, listener)
+		g.wg.Add(1)
+		go g.listen(listener, l.read)
+		log.Printf("I! [inputs.graphite] Listening on %s", listener.Addr())
+	}
+	return nil
+}
+
+func (g *Graphite) Stop() {
+	g.Lock()
+	g.closeListeners()
+	for conn := range g.conns {
+		conn.Close()
+	}
+	g.Unlock()
+	g.wg.Wait()
+}
+
+func (g *Graphite) closeListeners() {
+	for _, listener := range g.listeners {
+		listener.Close()
+	}
+	g.listeners = nil
+}
+
+// listen accepts the connections of listener, read reads the metrics of a
+// connection until it is closed.
+func (g *Graphite) listen(listener net.Listener, read func(net.Conn)) {
+	defer g.wg.Done()
+	var active int
+	var activeMu sync.Mutex
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !strings.HasSuffix(err.Error(), ": use of closed network connection") {
+				g.acc.AddError(err)
+			}
+			return
+		}
+
+		activeMu.Lock()
+		if g.MaxConnections > 0 && active >= g.MaxConnections {
+			activeMu.Unlock()
+			log.Printf("W! [inputs.graphite] Refused connection from %s, "+
+				"max_connections reached", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		active++
+		activeMu.Unlock()
+
+		g.Lock()
+		if g.listeners == nil {
+			// stopped while accepting
+			g.Unlock()
+			conn.Close()
+			return
+		}
+		g.conns[conn] = true
+		g.Unlock()
+		g.CurrentConnections.Incr(1)
+		g.wg.Add(1)
+		go func() {
+			defer func() {
+				g.Lock()
+				delete(g.conns, conn)
+				g.Unlock()
+				conn.Close()
+				g.CurrentConnections.Incr(-1)
+				activeMu.Lock()
+				active--
+				activeMu.Unlock()
+				g.wg.Done()
+			}()
+			read(conn)
+		}()
+	}
+}
+
+func (g *Graphite) setDeadline(conn net.Conn) {
+	if g.ReadTimeout.Duration > 0 {
+		conn.SetReadDeadline(time.Now().Add(g.ReadTimeout.Duration))
+	}
+}
+
+// readPlaintext reads the "name value [timestamp]" lines of conn.
+func (g *Graphite) readPlaintext(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	for {
+		g.setDeadline(conn)
+		if !scanner.Scan() {
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		m, err := g.parser.ParseLine(line)
+		if err != nil {
+			g.malformed(err)
+			continue
+		}
+		g.add(m)
+	}
+	g.readError(scanner.Err())
+}
+
+// readPickle reads the pickle messages of conn, each prefixed by its length
+// as a 4 bytes big endian integer, whose payload is a list of
+// (name, (timestamp, value)) tuples.
+func (g *Graphite) readPickle(conn net.Conn) {
+	header := make([]byte, 4)
+	for {
+		g.setDeadline(conn)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			if err != io.EOF {
+				g.readError(err)
+			}
+			return
+		}
+		size := binary.BigEndian.Uint32(header)
+		if size > maxPickleSize {
+			g.acc.AddError(fmt.Errorf("pickle message of %d bytes from %s is "+
+				"too large, closing the connection", size, conn.RemoteAddr()))
+			return
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			g.readError(err)
+			return
+		}
+
+		v, err := unpickle(payload)
+		if err != nil {
+			g.malformed(err)
+			continue
+		}
+		datapoints, ok := items(v)
+		if !ok {
+			g.malformed(fmt.Errorf("pickle message is not a list"))
+			continue
+		}
+		for _, dp := range datapoints {
+			m, err := g.parseDatapoint(dp)
+			if err != nil {
+				g.malformed(err)
+				continue
+			}
+			g.add(m)
+		}
+	}
+}
+
+// parseDatapoint returns the metric of a (name, (timestamp, value)) tuple.
+func (g *Graphite) parseDatapoint(dp interface{}) (telegraf.Metric, error) {
+	tuple, ok := items(dp)
+	if !ok || len(tuple) != 2 {
+		return nil, fmt.Errorf("invalid pickle datapoint %v", dp)
+	}
+	name, ok := tuple[0].(string)
+	point, ok2 := items(tuple[1])
+	if !ok || !ok2 || len(point) != 2 {
+		return nil, fmt.Errorf("invalid pickle datapoint %v", dp)
+	}
+	ts, err := toFloat(point[0])
+	if err != nil {
+		return nil, fmt.Errorf("datapoint %s time: %s", name, err)
+	}
+	value, err := toFloat(point[1])
+	if err != nil {
+		return nil, fmt.Errorf("datapoint %s value: %s", name, err)
+	}
+
+	t := time.Now().UTC()
+	if ts != -1 {
+		t = time.Unix(int64(ts), int64((ts-math.Floor(ts))*float64(time.Second)))
+		if t.Before(graphite.MinDate) || t.After(graphite.MaxDate) {
+			return nil, fmt.Errorf("datapoint %s timestamp out of range", name)
+		}
+	}
+	return g.parser.ParseValue(name, value, t)
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("invalid number %v", v)
+}
+
+func (g *Graphite) add(m telegraf.Metric) {
+	g.MetricsReceived.Incr(1)
+	g.acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+}
+
+// malformed counts a malformed metric, which is logged in debug mode only
+// since a sender may send many.
+func (g *Graphite) malformed(err error) {
+	g.Malformed.Incr(1)
+	log.Printf("D! [inputs.graphite] Malformed metric: %s", err)
+}
+
+func (g *Graphite) readError(err error) {
+	if err == nil {
+		return
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		log.Printf("D! [inputs.graphite] Closing idle connection: %s", err)
+	} else if !strings.HasSuffix(err.Error(), ": use of closed network connection") {
+		g.acc.AddError(err)
+	}
+}
+
+func init() {
+	inputs.Add("graphite", func() telegraf.Input {
+		return &Graphite{
+			ServiceAddress: ":2003",
+			PickleAddress:  ":2004",
+			Separator:      "_",
+		}
+	})
+}
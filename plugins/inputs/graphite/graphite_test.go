@@ -0,0 +1,103 @@
+package graphite
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/plugins/parsers/graphite"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pickles of [("servers.web01.cpu.user", (1500000000, 12.5)),
+// ("servers.web01.cpu.idle", (1500000000.5, 80)), ("big", (1500000000, 2**40))]
+// by the protocols 0, 2 and 4 of Python.
+var pickles = map[string]string{
+	"protocol 0": "(lp0\x0a(Vservers.web01.cpu.user\x0ap1\x0a(I1500000000\x0aF12.5\x0atp2\x0atp3\x0aa(Vservers.web01.cpu.idle\x0ap4\x0a(F1500000000.5\x0aI80\x0atp5\x0atp6\x0aa(Vbig\x0ap7\x0a(I1500000000\x0aL1099511627776L\x0atp8\x0atp9\x0aa.",
+	"protocol 2": "\x80\x02]q\x00(X\x16\x00\x00\x00servers.web01.cpu.userq\x01J\x00/hYG@)\x00\x00\x00\x00\x00\x00\x86q\x02\x86q\x03X\x16\x00\x00\x00servers.web01.cpu.idleq\x04GA\xd6Z\x0b\xc0 \x00\x00KP\x86q\x05\x86q\x06X\x03\x00\x00\x00bigq\x07J\x00/hY\x8a\x06\x00\x00\x00\x00\x00\x01\x86q\x08\x86q\x09e.",
+	"protocol 4": "\x80\x04\x95o\x00\x00\x00\x00\x00\x00\x00]\x94(\x8c\x16servers.web01.cpu.user\x94J\x00/hYG@)\x00\x00\x00\x00\x00\x00\x86\x94\x86\x94\x8c\x16servers.web01.cpu.idle\x94GA\xd6Z\x0b\xc0 \x00\x00KP\x86\x94\x86\x94\x8c\x03big\x94J\x00/hY\x8a\x06\x00\x00\x00\x00\x00\x01\x86\x94\x86\x94e.",
+}
+
+func TestUnpickle(t *testing.T) {
+	p, err := graphite.NewGraphiteParser("_", []string{"servers.* .host.measurement.field"}, nil)
+	require.NoError(t, err)
+	g := &Graphite{parser: p}
+
+	for name, pickle := range pickles {
+		v, err := unpickle([]byte(pickle))
+		require.NoError(t, err, name)
+		datapoints, ok := items(v)
+		require.True(t, ok, name)
+		require.Len(t, datapoints, 3, name)
+
+		m, err := g.parseDatapoint(datapoints[0])
+		require.NoError(t, err, name)
+		assert.Equal(t, "cpu", m.Name(), name)
+		assert.Equal(t, map[string]string{"host": "web01"}, m.Tags(), name)
+		assert.Equal(t, map[string]interface{}{"user": 12.5}, m.Fields(), name)
+		assert.Equal(t, time.Unix(1500000000, 0), m.Time(), name)
+
+		m, err = g.parseDatapoint(datapoints[1])
+		require.NoError(t, err, name)
+		assert.Equal(t, map[string]interface{}{"idle": float64(80)}, m.Fields(), name)
+		assert.Equal(t, time.Unix(1500000000, 500000000), m.Time(), name)
+
+		m, err = g.parseDatapoint(datapoints[2])
+		require.NoError(t, err, name)
+		assert.Equal(t, "big", m.Name(), name)
+		assert.Equal(t, map[string]interface{}{"value": float64(1 << 40)}, m.Fields(), name)
+	}
+}
+
+func TestUnpickleRejectsGlobals(t *testing.T) {
+	// pickle of os.system
+	_, err := unpickle([]byte("\x80\x02cposix\nsystem\nq\x00."))
+	assert.Error(t, err)
+
+	_, err = unpickle([]byte("\x80\x02X\xff\xff\xff\x7fa."))
+	assert.Error(t, err)
+	_, err = unpickle([]byte("\x80\x02]q\x00"))
+	assert.Error(t, err)
+}
+
+func TestGraphiteListener(t *testing.T) {
+	g := &Graphite{
+		ServiceAddress: "127.0.0.1:0",
+		PickleAddress:  "127.0.0.1:0",
+		Separator:      "_",
+		Templates:      []string{"servers.* .host.measurement.field"},
+	}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, g.Start(acc))
+	defer g.Stop()
+	require.Len(t, g.listeners, 2)
+
+	conn, err := net.Dial("tcp", g.listeners[0].Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("servers.web02.mem.free 42 1500000000\nmalformed\n"))
+	require.NoError(t, err)
+	conn.Close()
+
+	conn, err = net.Dial("tcp", g.listeners[1].Addr().String())
+	require.NoError(t, err)
+	pickle := pickles["protocol 2"]
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(pickle)))
+	_, err = conn.Write(append(header, pickle...))
+	require.NoError(t, err)
+	conn.Close()
+
+	acc.Wait(4)
+	acc.AssertContainsTaggedFields(t, "mem",
+		map[string]interface{}{"free": float64(42)},
+		map[string]string{"host": "web02"})
+	acc.AssertContainsTaggedFields(t, "cpu",
+		map[string]interface{}{"user": 12.5},
+		map[string]string{"host": "web01"})
+	acc.AssertContainsTaggedFields(t, "big",
+		map[string]interface{}{"value": float64(1 << 40)},
+		map[string]string{})
+}
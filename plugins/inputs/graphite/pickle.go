@@ -0,0 +1,327 @@
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// list is a Python list, a pointer since it can be appended to after it is
+// memoized.
+type list struct {
+	items []interface{}
+}
+
+// mark is the position of a MARK opcode on the stack.
+type mark struct{}
+
+// unpickle decodes the Python objects of the data pickle which are used by
+// carbon, lists and tuples of strings and numbers, up to the protocol 4. The
+// opcodes which build objects or call functions are rejected. Tuples are
+// []interface{} and lists *list, see items.
+func unpickle(data []byte) (interface{}, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	var stack []interface{}
+	memo := make(map[int]interface{})
+
+	pop := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, errors.New("pickle stack underflow")
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v, nil
+	}
+	// popMark pops the items up to the last mark
+	popMark := func() ([]interface{}, error) {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if _, ok := stack[i].(mark); ok {
+				items := append([]interface{}{}, stack[i+1:]...)
+				stack = stack[:i]
+				return items, nil
+			}
+		}
+		return nil, errors.New("pickle mark not found")
+	}
+	top := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, errors.New("pickle stack underflow")
+		}
+		return stack[len(stack)-1], nil
+	}
+	readN := func(n int) ([]byte, error) {
+		if n < 0 || n > len(data) {
+			return nil, errors.New("invalid pickle length")
+		}
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	readUint := func(n int) (int, error) {
+		b, err := readN(n)
+		if err != nil {
+			return 0, err
+		}
+		var v uint64
+		for i := n - 1; i >= 0; i-- {
+			v = v<<8 | uint64(b[i])
+		}
+		if v > uint64(len(data)) && n > 2 {
+			return 0, errors.New("invalid pickle length")
+		}
+		return int(v), nil
+	}
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.New("unexpected end of pickle")
+		}
+
+		var v interface{}
+		push := true
+		switch op {
+		case '.': // STOP
+			return pop()
+		case '\x80': // PROTO
+			_, err = r.ReadByte()
+			push = false
+		case '\x95': // FRAME
+			_, err = readN(8)
+			push = false
+		case '(': // MARK
+			v = mark{}
+		case '0': // POP
+			_, err = pop()
+			push = false
+		case '1': // POP_MARK
+			_, err = popMark()
+			push = false
+		case '2': // DUP
+			v, err = top()
+		case 'N': // NONE
+			v = nil
+		case '\x88': // NEWTRUE
+			v = true
+		case '\x89': // NEWFALSE
+			v = false
+		case 'I': // INT
+			var line string
+			if line, err = readLine(); err == nil {
+				switch line {
+				case "00":
+					v = false
+				case "01":
+					v = true
+				default:
+					v, err = strconv.ParseInt(line, 10, 64)
+				}
+			}
+		case 'L': // LONG
+			var line string
+			if line, err = readLine(); err == nil {
+				v, err = strconv.ParseInt(strings.TrimSuffix(line, "L"), 10, 64)
+			}
+		case 'J': // BININT
+			var b []byte
+			if b, err = readN(4); err == nil {
+				v = int64(int32(binary.LittleEndian.Uint32(b)))
+			}
+		case 'K': // BININT1
+			var n int
+			n, err = readUint(1)
+			v = int64(n)
+		case 'M': // BININT2
+			var n int
+			n, err = readUint(2)
+			v = int64(n)
+		case '\x8a': // LONG1
+			var n int
+			var b []byte
+			if n, err = readUint(1); err == nil {
+				if b, err = readN(n); err == nil {
+					v, err = decodeLong(b)
+				}
+			}
+		case 'F': // FLOAT
+			var line string
+			if line, err = readLine(); err == nil {
+				v, err = strconv.ParseFloat(line, 64)
+			}
+		case 'G': // BINFLOAT
+			var b []byte
+			if b, err = readN(8); err == nil {
+				v = math.Float64frombits(binary.BigEndian.Uint64(b))
+			}
+		case 'S': // STRING
+			var line string
+			if line, err = readLine(); err == nil {
+				v, err = unquote(line)
+			}
+		case 'V': // UNICODE
+			v, err = readLine()
+		case 'T', 'X', 'B': // BINSTRING, BINUNICODE, BINBYTES
+			var n int
+			var b []byte
+			if n, err = readUint(4); err == nil {
+				b, err = readN(n)
+				v = string(b)
+			}
+		case 'U', '\x8c', 'C': // SHORT_BINSTRING, SHORT_BINUNICODE, SHORT_BINBYTES
+			var n int
+			var b []byte
+			if n, err = readUint(1); err == nil {
+				b, err = readN(n)
+				v = string(b)
+			}
+		case '\x8d', '\x8e': // BINUNICODE8, BINBYTES8
+			var n int
+			var b []byte
+			if n, err = readUint(8); err == nil {
+				b, err = readN(n)
+				v = string(b)
+			}
+		case ']': // EMPTY_LIST
+			v = &list{}
+		case 'l': // LIST
+			var items []interface{}
+			items, err = popMark()
+			v = &list{items: items}
+		case ')': // EMPTY_TUPLE
+			v = []interface{}{}
+		case 't': // TUPLE
+			v, err = popMark()
+		case '\x85', '\x86', '\x87': // TUPLE1, TUPLE2, TUPLE3
+			n := int(op-'\x85') + 1
+			if len(stack) < n {
+				err = errors.New("pickle stack underflow")
+				break
+			}
+			v = append([]interface{}{}, stack[len(stack)-n:]...)
+			stack = stack[:len(stack)-n]
+		case 'a': // APPEND
+			var item, l interface{}
+			if item, err = pop(); err == nil {
+				if l, err = top(); err == nil {
+					err = appendItems(l, item)
+				}
+			}
+			push = false
+		case 'e': // APPENDS
+			var items []interface{}
+			var l interface{}
+			if items, err = popMark(); err == nil {
+				if l, err = top(); err == nil {
+					err = appendItems(l, items...)
+				}
+			}
+			push = false
+		case 'p': // PUT
+			var line string
+			var n int
+			if line, err = readLine(); err == nil {
+				if n, err = strconv.Atoi(line); err == nil {
+					memo[n], err = top()
+				}
+			}
+			push = false
+		case 'q', 'r': // BINPUT, LONG_BINPUT
+			var n int
+			if n, err = readUint(map[byte]int{'q': 1, 'r': 4}[op]); err == nil {
+				memo[n], err = top()
+			}
+			push = false
+		case '\x94': // MEMOIZE
+			memo[len(memo)], err = top()
+			push = false
+		case 'g': // GET
+			var line string
+			var n int
+			if line, err = readLine(); err == nil {
+				if n, err = strconv.Atoi(line); err == nil {
+					v, err = memoGet(memo, n)
+				}
+			}
+		case 'h', 'j': // BINGET, LONG_BINGET
+			var n int
+			if n, err = readUint(map[byte]int{'h': 1, 'j': 4}[op]); err == nil {
+				v, err = memoGet(memo, n)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported pickle opcode %q", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if push {
+			stack = append(stack, v)
+		}
+	}
+}
+
+func appendItems(l interface{}, items ...interface{}) error {
+	lst, ok := l.(*list)
+	if !ok {
+		return errors.New("pickle append to a non list")
+	}
+	lst.items = append(lst.items, items...)
+	return nil
+}
+
+func memoGet(memo map[int]interface{}, n int) (interface{}, error) {
+	v, ok := memo[n]
+	if !ok {
+		return nil, fmt.Errorf("pickle memo %d not found", n)
+	}
+	return v, nil
+}
+
+// decodeLong decodes the little endian two's complement integer of LONG1.
+func decodeLong(b []byte) (int64, error) {
+	if len(b) > 8 {
+		return 0, errors.New("pickle long out of range")
+	}
+	var v int64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | int64(b[i])
+	}
+	if len(b) > 0 && len(b) < 8 && b[len(b)-1]&0x80 != 0 {
+		v -= 1 << uint(8*len(b))
+	}
+	return v, nil
+}
+
+// unquote returns the string of the Python repr s of a string of the protocol
+// 0, quoted with single or double quotes.
+func unquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != s[len(s)-1] || (s[0] != '\'' && s[0] != '"') {
+		return "", fmt.Errorf("invalid pickle string %s", s)
+	}
+	inner := strings.Replace(s[1:len(s)-1], `\'`, `'`, -1)
+	inner = strings.Replace(inner, `"`, `\"`, -1)
+	return strconv.Unquote(`"` + inner + `"`)
+}
+
+// items returns the items of a list or tuple.
+func items(v interface{}) ([]interface{}, bool) {
+	switch v := v.(type) {
+	case *list:
+		return v.items, true
+	case []interface{}:
+		return v, true
+	}
+	return nil, false
+}
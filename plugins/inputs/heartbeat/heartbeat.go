@@ -0,0 +1,271 @@
+package heartbeat
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// maxPayloadSize is the maximum size of a heartbeat, sent in a request body
+// or a datagram.
+const maxPayloadSize = 64 * 1024
+
+// Heartbeat receives the heartbeats of applications over HTTP or UDP and
+// reports, for every service, its uptime, the time since its last heartbeat
+// and whether it is stale.
+type Heartbeat struct {
+	ServiceAddress string            `toml:"service_address"`
+	UDPAddress     string            `toml:"udp_address"`
+	Timeout        internal.Duration `toml:"timeout"`
+	Expiration     internal.Duration `toml:"expiration"`
+
+	sync.Mutex
+	wg sync.WaitGroup
+
+	listener net.Listener
+	conn     net.PacketConn
+
+	services map[string]*service
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// payload is a heartbeat, as sent by the applications.
+type payload struct {
+	Service string `json:"service"`
+	Version string `json:"version"`
+	Status  string `json:"status"`
+}
+
+// service is the state of an application, built from its heartbeats.
+type service struct {
+	version string
+	status  string
+	// since is the time of the first heartbeat since the application
+	// restarted, ie with its current version or after it was stale.
+	since    time.Time
+	lastSeen time.Time
+	count    int64
+}
+
+var sampleConfig = `
+  ## Address and port the heartbeats are POSTed to, on any path, as a JSON
+  ## object or form values with the keys service, version and status.
+  service_address = ":8187"
+
+  ## If set, heartbeats are also received as JSON objects in UDP datagrams.
+  # udp_address = ":8187"
+
+  ## A service is stale if no heartbeat was received for this long, its
+  ## uptime restarts with its next heartbeat.
+  timeout = "1m"
+
+  ## Services without heartbeat for this long are no longer reported,
+  ## 0 reports them until telegraf restarts.
+  expiration = "24h"
+`
+
+func (h *Heartbeat) SampleConfig() string {
+	return sampleConfig
+}
+
+func (h *Heartbeat) Description() string {
+	return "Receive application heartbeats and report their uptime and staleness"
+}
+
+func (h *Heartbeat) Gather(acc telegraf.Accumulator) error {
+	h.Lock()
+	defer h.Unlock()
+
+	now := h.now()
+	for name, s := range h.services {
+		idle := now.Sub(s.lastSeen)
+		if h.Expiration.Duration > 0 && idle > h.Expiration.Duration {
+			delete(h.services, name)
+			continue
+		}
+		stale := idle > h.Timeout.Duration
+		uptime := s.lastSeen.Sub(s.since)
+		if !stale {
+			uptime = now.Sub(s.since)
+		}
+
+		fields := map[string]interface{}{
+			"uptime":     int64(uptime.Seconds()),
+			"last_seen":  int64(idle.Seconds()),
+			"heartbeats": s.count,
+			"stale":      stale,
+		}
+		if s.status != "" {
+			fields["status"] = s.status
+		}
+		tags := map[string]string{"service": name}
+		if s.version != "" {
+			tags["version"] = s.version
+		}
+		acc.AddFields("heartbeat", fields, tags, now)
+	}
+	return nil
+}
+
+// Start starts the HTTP and UDP listeners.
+func (h *Heartbeat) Start(_ telegraf.Accumulator) error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.services = make(map[string]*service)
+	if h.now == nil {
+		h.now = time.Now
+	}
+
+	if h.ServiceAddress != "" {
+		listener, err := net.Listen("tcp", h.ServiceAddress)
+		if err != nil {
+			return err
+		}
+		h.listener = listener
+
+		server := &http.Server{
+			Handler:      h,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			server.Serve(listener)
+		}()
+		log.Printf("I! Started heartbeat receiver on %s", listener.Addr())
+	}
+
+	if h.UDPAddress != "" {
+		conn, err := net.ListenPacket("udp", h.UDPAddress)
+		if err != nil {
+			if h.listener != nil {
+				h.listener.Close()
+				h.wg.Wait()
+			}
+			return err
+		}
+		h.conn = conn
+
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.udpListen()
+		}()
+		log.Printf("I! Started heartbeat receiver on udp %s", conn.LocalAddr())
+	}
+	return nil
+}
+
+// Stop closes the listeners.
+func (h *Heartbeat) Stop() {
+	h.Lock()
+	if h.listener != nil {
+		h.listener.Close()
+	}
+	if h.conn != nil {
+		h.conn.Close()
+	}
+	h.Unlock()
+	h.wg.Wait()
+}
+
+func (h *Heartbeat) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		res.Header().Set("Allow", "POST")
+		http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var p payload
+	body := http.MaxBytesReader(res, req.Body, maxPayloadSize)
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		if err := json.NewDecoder(body).Decode(&p); err != nil && err != io.EOF {
+			http.Error(res, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		req.Body = body
+		if err := req.ParseForm(); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p.Service = req.Form.Get("service")
+		p.Version = req.Form.Get("version")
+		p.Status = req.Form.Get("status")
+	}
+
+	if err := h.beat(p); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Heartbeat) udpListen() {
+	buf := make([]byte, maxPayloadSize)
+	for {
+		n, _, err := h.conn.ReadFrom(buf)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Temporary() {
+				continue
+			}
+			return
+		}
+
+		var p payload
+		if err := json.Unmarshal(buf[:n], &p); err != nil {
+			log.Printf("E! [inputs.heartbeat] invalid heartbeat: %s", err)
+			continue
+		}
+		if err := h.beat(p); err != nil {
+			log.Printf("E! [inputs.heartbeat] %s", err)
+		}
+	}
+}
+
+// beat records a heartbeat of a service.
+func (h *Heartbeat) beat(p payload) error {
+	if p.Service == "" {
+		return errors.New("heartbeat without service")
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	now := h.now()
+	s, ok := h.services[p.Service]
+	if !ok || s.version != p.Version || now.Sub(s.lastSeen) > h.Timeout.Duration {
+		s = &service{since: now}
+		h.services[p.Service] = s
+	}
+	s.version = p.Version
+	s.status = p.Status
+	s.lastSeen = now
+	s.count++
+	return nil
+}
+
+func init() {
+	inputs.Add("heartbeat", func() telegraf.Input {
+		return &Heartbeat{
+			ServiceAddress: ":8187",
+			Timeout:        internal.Duration{Duration: time.Minute},
+			Expiration:     internal.Duration{Duration: 24 * time.Hour},
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package heartbeat
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clock is a settable time source.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func newTestHeartbeat(c *clock) *Heartbeat {
+	return &Heartbeat{
+		ServiceAddress: "127.0.0.1:0",
+		Timeout:        internal.Duration{Duration: time.Minute},
+		Expiration:     internal.Duration{Duration: time.Hour},
+		now:            c.now,
+	}
+}
+
+func TestHeartbeatHTTP(t *testing.T) {
+	c := &clock{t: time.Unix(1000, 0)}
+	h := newTestHeartbeat(c)
+	acc := &testutil.Accumulator{}
+	require.NoError(t, h.Start(acc))
+	defer h.Stop()
+
+	addr := "http://" + h.listener.Addr().String() + "/heartbeat"
+	resp, err := http.Post(addr, "application/json",
+		strings.NewReader(`{"service":"api","version":"1.2","status":"ok"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	c.t = c.t.Add(30 * time.Second)
+	resp, err = http.PostForm(addr, url.Values{"service": {"api"}, "version": {"1.2"}, "status": {"degraded"}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, err = http.Post(addr, "application/json", strings.NewReader(`{"status":"ok"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(addr)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	c.t = c.t.Add(10 * time.Second)
+	require.NoError(t, h.Gather(acc))
+	acc.AssertContainsTaggedFields(t, "heartbeat",
+		map[string]interface{}{
+			"uptime":     int64(40),
+			"last_seen":  int64(10),
+			"heartbeats": int64(2),
+			"stale":      false,
+			"status":     "degraded",
+		},
+		map[string]string{"service": "api", "version": "1.2"})
+}
+
+// Test that a service is stale after the timeout, and that its uptime
+// restarts with its next heartbeat or a new version
+func TestHeartbeatStale(t *testing.T) {
+	c := &clock{t: time.Unix(1000, 0)}
+	h := newTestHeartbeat(c)
+	acc := &testutil.Accumulator{}
+	require.NoError(t, h.Start(acc))
+	defer h.Stop()
+
+	require.NoError(t, h.beat(payload{Service: "api", Version: "1"}))
+	c.t = c.t.Add(30 * time.Second)
+	require.NoError(t, h.beat(payload{Service: "api", Version: "1"}))
+
+	c.t = c.t.Add(2 * time.Minute)
+	require.NoError(t, h.Gather(acc))
+	acc.AssertContainsTaggedFields(t, "heartbeat",
+		map[string]interface{}{
+			"uptime":     int64(30),
+			"last_seen":  int64(120),
+			"heartbeats": int64(2),
+			"stale":      true,
+		},
+		map[string]string{"service": "api", "version": "1"})
+
+	require.NoError(t, h.beat(payload{Service: "api", Version: "1"}))
+	c.t = c.t.Add(10 * time.Second)
+	require.NoError(t, h.beat(payload{Service: "api", Version: "2"}))
+	c.t = c.t.Add(5 * time.Second)
+	acc.ClearMetrics()
+	require.NoError(t, h.Gather(acc))
+	acc.AssertContainsTaggedFields(t, "heartbeat",
+		map[string]interface{}{
+			"uptime":     int64(5),
+			"last_seen":  int64(5),
+			"heartbeats": int64(1),
+			"stale":      false,
+		},
+		map[string]string{"service": "api", "version": "2"})
+
+	// expired services are no longer reported
+	c.t = c.t.Add(2 * time.Hour)
+	acc.ClearMetrics()
+	require.NoError(t, h.Gather(acc))
+	assert.Len(t, acc.Metrics, 0)
+}
+
+func TestHeartbeatUDP(t *testing.T) {
+	c := &clock{t: time.Unix(1000, 0)}
+	h := newTestHeartbeat(c)
+	h.ServiceAddress = ""
+	h.UDPAddress = "127.0.0.1:0"
+	acc := &testutil.Accumulator{}
+	require.NoError(t, h.Start(acc))
+	defer h.Stop()
+
+	conn, err := net.Dial("udp", h.conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte(`{"service":"worker","status":"ok"}`))
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		acc.ClearMetrics()
+		require.NoError(t, h.Gather(acc))
+		if len(acc.Metrics) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	acc.AssertContainsTaggedFields(t, "heartbeat",
+		map[string]interface{}{
+			"uptime":     int64(0),
+			"last_seen":  int64(0),
+			"heartbeats": int64(1),
+			"stale":      false,
+			"status":     "ok",
+		},
+		map[string]string{"service": "worker"})
+}
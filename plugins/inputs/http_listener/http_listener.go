@@ -3,10 +3,13 @@ package http_listener
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/subtle"
+	"crypto/tls"
 	"io"
 	"log"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -37,6 +40,25 @@ type HTTPListener struct {
 	MaxLineSize    int
 	Port           int
 
+	// Path to the TLS certificate and key of the listener and to the CAs
+	// client certificates must be signed by.
+	SSLCert             string   `toml:"ssl_cert"`
+	SSLKey              string   `toml:"ssl_key"`
+	SSLAllowedClientCAs []string `toml:"ssl_allowed_client_ca"`
+
+	// AuthTokens are the tokens accepted in the Authorization header of the
+	// /write and /query requests, and BasicUsername and BasicPassword the
+	// credentials accepted with basic authentication or the u and p query
+	// parameters. Any request is accepted if none are set.
+	AuthTokens    []string `toml:"auth_tokens"`
+	BasicUsername string   `toml:"basic_username"`
+	BasicPassword string   `toml:"basic_password"`
+
+	// DatabaseTag and RetentionPolicyTag are the tags set to the db and rp
+	// query parameters of the writes, if not empty.
+	DatabaseTag        string `toml:"database_tag"`
+	RetentionPolicyTag string `toml:"retention_policy_tag"`
+
 	mu sync.Mutex
 	wg sync.WaitGroup
 
@@ -57,6 +79,7 @@ type HTTPListener struct {
 	PingsRecv       selfstat.Stat
 	NotFoundsServed selfstat.Stat
 	BuffersCreated  selfstat.Stat
+	AuthFailures    selfstat.Stat
 }
 
 const sampleConfig = `
@@ -75,6 +98,28 @@ const sampleConfig = `
   ## Maximum line size allowed to be sent in bytes.
   ## 0 means to use the default of 65536 bytes (64 kibibytes)
   max_line_size = 0
+
+  ## TLS certificate and key, enables HTTPS.
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+
+  ## If set, clients must present a certificate signed by one of these CAs.
+  # ssl_allowed_client_ca = ["/etc/telegraf/clientca.pem"]
+
+  ## If set, the /write and /query requests must present one of these tokens
+  ## in their Authorization header, as "Token <token>" or "Bearer <token>".
+  # auth_tokens = ["change-me"]
+
+  ## If set, the /write and /query requests can also authenticate with these
+  ## credentials, with basic authentication or the u and p query parameters
+  ## of the Influx client libraries.
+  # basic_username = "telegraf"
+  # basic_password = "change-me"
+
+  ## Tags set to the database and retention policy of the writes, the db and
+  ## rp query parameters, unless the metrics have them already.
+  # database_tag = "database"
+  # retention_policy_tag = "retention_policy"
 `
 
 func (h *HTTPListener) SampleConfig() string {
@@ -109,6 +154,7 @@ func (h *HTTPListener) Start(acc telegraf.Accumulator) error {
 	h.PingsRecv = selfstat.Register("http_listener", "pings_received", tags)
 	h.NotFoundsServed = selfstat.Register("http_listener", "not_founds_served", tags)
 	h.BuffersCreated = selfstat.Register("http_listener", "buffers_created", tags)
+	h.AuthFailures = selfstat.Register("http_listener", "auth_failures", tags)
 
 	if h.MaxBodySize == 0 {
 		h.MaxBodySize = DEFAULT_MAX_BODY_SIZE
@@ -120,10 +166,18 @@ func (h *HTTPListener) Start(acc telegraf.Accumulator) error {
 	h.acc = acc
 	h.pool = NewPool(200, h.MaxLineSize)
 
-	var listener, err = net.Listen("tcp", h.ServiceAddress)
+	tlsConfig, err := internal.GetServerTLSConfig(h.SSLCert, h.SSLKey, h.SSLAllowedClientCAs)
 	if err != nil {
 		return err
 	}
+
+	listener, err := net.Listen("tcp", h.ServiceAddress)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
 	h.listener = listener
 	h.Port = listener.Addr().(*net.TCPAddr).Port
 
@@ -173,6 +227,18 @@ func (h *HTTPListener) httpListen() error {
 func (h *HTTPListener) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	h.RequestsRecv.Incr(1)
 	defer h.RequestsServed.Incr(1)
+	switch req.URL.Path {
+	case "/write", "/query":
+		if !h.authorized(req) {
+			h.AuthFailures.Incr(1)
+			if h.BasicUsername != "" {
+				res.Header().Set("WWW-Authenticate", `Basic realm="telegraf"`)
+			}
+			unauthorized(res)
+			return
+		}
+	}
+
 	switch req.URL.Path {
 	case "/write":
 		h.WritesRecv.Incr(1)
@@ -207,7 +273,15 @@ func (h *HTTPListener) serveWrite(res http.ResponseWriter, req *http.Request) {
 	}
 	now := time.Now()
 
-	precision := req.URL.Query().Get("precision")
+	query := req.URL.Query()
+	precision := query.Get("precision")
+	tags := make(map[string]string)
+	if db := query.Get("db"); db != "" && h.DatabaseTag != "" {
+		tags[h.DatabaseTag] = db
+	}
+	if rp := query.Get("rp"); rp != "" && h.RetentionPolicyTag != "" {
+		tags[h.RetentionPolicyTag] = rp
+	}
 
 	// Handle gzip request bodies
 	body := req.Body
@@ -265,7 +339,7 @@ func (h *HTTPListener) serveWrite(res http.ResponseWriter, req *http.Request) {
 
 		if err == io.ErrUnexpectedEOF {
 			// finished reading the request body
-			if err := h.parse(buf[:n+bufStart], now, precision); err != nil {
+			if err := h.parse(buf[:n+bufStart], now, precision, tags); err != nil {
 				log.Println("E! " + err.Error())
 				return400 = true
 			}
@@ -290,7 +364,7 @@ func (h *HTTPListener) serveWrite(res http.ResponseWriter, req *http.Request) {
 			bufStart = 0
 			continue
 		}
-		if err := h.parse(buf[:i+1], now, precision); err != nil {
+		if err := h.parse(buf[:i+1], now, precision, tags); err != nil {
 			log.Println("E! " + err.Error())
 			return400 = true
 		}
@@ -303,16 +377,60 @@ func (h *HTTPListener) serveWrite(res http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (h *HTTPListener) parse(b []byte, t time.Time, precision string) error {
+// parse adds the metrics of b, with the tags they do not have.
+func (h *HTTPListener) parse(b []byte, t time.Time, precision string, tags map[string]string) error {
 	metrics, err := h.parser.ParseWithDefaultTimePrecision(b, t, precision)
 
 	for _, m := range metrics {
-		h.acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+		mTags := m.Tags()
+		for k, v := range tags {
+			if _, ok := mTags[k]; !ok {
+				mTags[k] = v
+			}
+		}
+		h.acc.AddFields(m.Name(), m.Fields(), mTags, m.Time())
 	}
 
 	return err
 }
 
+// authorized returns whether the request presents one of the tokens or the
+// basic credentials, or true if none is configured.
+func (h *HTTPListener) authorized(req *http.Request) bool {
+	if len(h.AuthTokens) == 0 && h.BasicUsername == "" {
+		return true
+	}
+	if h.BasicUsername != "" {
+		username, password, ok := req.BasicAuth()
+		if !ok {
+			query := req.URL.Query()
+			username, password = query.Get("u"), query.Get("p")
+		}
+		if subtle.ConstantTimeCompare([]byte(username), []byte(h.BasicUsername)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(h.BasicPassword)) == 1 {
+			return true
+		}
+	}
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || (parts[0] != "Token" && parts[0] != "Bearer") {
+		return false
+	}
+	token := []byte(strings.TrimSpace(parts[1]))
+	for _, t := range h.AuthTokens {
+		if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func unauthorized(res http.ResponseWriter) {
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("X-Influxdb-Version", "1.0")
+	res.WriteHeader(http.StatusUnauthorized)
+	res.Write([]byte(`{"error":"authorization failed"}`))
+}
+
 func tooLarge(res http.ResponseWriter) {
 	res.Header().Set("Content-Type", "application/json")
 	res.Header().Set("X-Influxdb-Version", "1.0")
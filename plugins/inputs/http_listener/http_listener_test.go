@@ -2,9 +2,12 @@ package http_listener
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"sync"
 	"testing"
@@ -96,6 +99,153 @@ func TestWriteHTTP(t *testing.T) {
 	)
 }
 
+func TestWriteHTTPS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "http_listener")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile, cert, err := testutil.WriteTLSCert(dir)
+	require.NoError(t, err)
+
+	listener := newTestHTTPListener()
+	listener.SSLCert = certFile
+	listener.SSLKey = keyFile
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, listener.Start(acc))
+	defer listener.Stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}}
+	u := "https://127.0.0.1:" + strconv.Itoa(listener.Port) + "/write"
+	resp, err := client.Post(u, "", bytes.NewBuffer([]byte(testMsg)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.EqualValues(t, 204, resp.StatusCode)
+
+	acc.Wait(1)
+	acc.AssertContainsTaggedFields(t, "cpu_load_short",
+		map[string]interface{}{"value": float64(12)},
+		map[string]string{"host": "server01"},
+	)
+}
+
+func TestWriteHTTPAuthTokens(t *testing.T) {
+	listener := newTestHTTPListener()
+	listener.AuthTokens = []string{"secret", "other"}
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, listener.Start(acc))
+	defer listener.Stop()
+
+	for _, tt := range []struct {
+		path          string
+		authorization string
+		status        int
+	}{
+		{"/write", "", 401},
+		{"/write", "Token wrong", 401},
+		{"/write", "Basic c2VjcmV0", 401},
+		{"/write", "Token secret", 204},
+		{"/write", "Bearer other", 204},
+		{"/query", "", 401},
+		{"/query", "Token secret", 200},
+		{"/ping", "", 204},
+	} {
+		req, err := http.NewRequest("POST", createURL(listener, tt.path, "db=mydb"),
+			bytes.NewBuffer([]byte(testMsg)))
+		require.NoError(t, err)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.EqualValues(t, tt.status, resp.StatusCode, tt.authorization)
+	}
+
+	acc.Wait(2)
+	require.Equal(t, 2, len(acc.Metrics))
+}
+
+func TestWriteHTTPBasicAuth(t *testing.T) {
+	listener := newTestHTTPListener()
+	listener.AuthTokens = []string{"secret"}
+	listener.BasicUsername = "telegraf"
+	listener.BasicPassword = "pass"
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, listener.Start(acc))
+	defer listener.Stop()
+
+	for _, tt := range []struct {
+		query    string
+		username string
+		password string
+		status   int
+	}{
+		{"db=mydb", "", "", 401},
+		{"db=mydb", "telegraf", "wrong", 401},
+		{"db=mydb", "telegraf", "pass", 204},
+		{"db=mydb&u=telegraf&p=wrong", "", "", 401},
+		{"db=mydb&u=telegraf&p=pass", "", "", 204},
+	} {
+		req, err := http.NewRequest("POST", createURL(listener, "/write", tt.query),
+			bytes.NewBuffer([]byte(testMsg)))
+		require.NoError(t, err)
+		if tt.username != "" {
+			req.SetBasicAuth(tt.username, tt.password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.EqualValues(t, tt.status, resp.StatusCode, tt.query)
+		if tt.status == 401 {
+			require.Equal(t, `Basic realm="telegraf"`, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+
+	// the tokens are still accepted
+	req, err := http.NewRequest("POST", createURL(listener, "/write", "db=mydb"),
+		bytes.NewBuffer([]byte(testMsg)))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Token secret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.EqualValues(t, 204, resp.StatusCode)
+
+	acc.Wait(3)
+	require.Equal(t, 3, len(acc.Metrics))
+}
+
+func TestWriteHTTPDatabaseTag(t *testing.T) {
+	listener := newTestHTTPListener()
+	listener.DatabaseTag = "database"
+	listener.RetentionPolicyTag = "retention_policy"
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, listener.Start(acc))
+	defer listener.Stop()
+
+	msg := "cpu,host=a value=1\ncpu,host=b,database=other value=2\n"
+	resp, err := http.Post(createURL(listener, "/write", "db=mydb&rp=week"), "",
+		bytes.NewBuffer([]byte(msg)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.EqualValues(t, 204, resp.StatusCode)
+
+	acc.Wait(2)
+	acc.AssertContainsTaggedFields(t, "cpu",
+		map[string]interface{}{"value": float64(1)},
+		map[string]string{"host": "a", "database": "mydb", "retention_policy": "week"})
+	acc.AssertContainsTaggedFields(t, "cpu",
+		map[string]interface{}{"value": float64(2)},
+		map[string]string{"host": "b", "database": "other", "retention_policy": "week"})
+}
+
 // http listener should add a newline at the end of the buffer if it's not there
 func TestWriteHTTPNoNewline(t *testing.T) {
 	listener := newTestHTTPListener()
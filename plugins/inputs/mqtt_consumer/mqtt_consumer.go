@@ -22,6 +22,11 @@ type MQTTConsumer struct {
 	Password string
 	QoS      int `toml:"qos"`
 
+	// TopicTag is the tag holding the topic of the messages, "topic" when
+	// unset, the topic is not kept when empty.
+	TopicTag     *string         `toml:"topic_tag"`
+	TopicParsing []*TopicParsing `toml:"topic_parsing"`
+
 	parser parsers.Parser
 
 	// Legacy metric buffer support
@@ -51,6 +56,65 @@ type MQTTConsumer struct {
 	started bool
 }
 
+// TopicParsing extracts tags from the levels of the topics matching Topic.
+type TopicParsing struct {
+	// Topic is a topic filter, with the + and # wildcards
+	Topic string `toml:"topic"`
+	// Tags names the tag of each level of the topic, separated by /
+	Tags string `toml:"tags"`
+
+	topic []string
+	tags  []string
+}
+
+// compile splits the topic filter and the tags in levels.
+func (p *TopicParsing) compile() error {
+	p.topic = strings.Split(p.Topic, "/")
+	p.tags = strings.Split(p.Tags, "/")
+	last := len(p.topic) - 1
+	for i, level := range p.topic {
+		if level == "#" && i != last {
+			return fmt.Errorf("invalid topic filter %q, # must be the last level",
+				p.Topic)
+		}
+	}
+	if len(p.tags) > len(p.topic) && p.topic[last] != "#" {
+		return fmt.Errorf("tags %q have more levels than topic %q", p.Tags, p.Topic)
+	}
+	return nil
+}
+
+// match reports whether the topic levels match the filter.
+func (p *TopicParsing) match(levels []string) bool {
+	for i, f := range p.topic {
+		if f == "#" {
+			return true
+		}
+		if i >= len(levels) || (f != "+" && f != levels[i]) {
+			return false
+		}
+	}
+	return len(levels) == len(p.topic)
+}
+
+// apply adds the tags extracted from the topic levels and returns the name of
+// the metric, which the "measurement" level overrides.
+func (p *TopicParsing) apply(levels []string, name string, tags map[string]string) string {
+	for i, tag := range p.tags {
+		if i >= len(levels) {
+			break
+		}
+		switch tag {
+		case "", "_":
+		case "measurement":
+			name = levels[i]
+		default:
+			tags[tag] = levels[i]
+		}
+	}
+	return name
+}
+
 var sampleConfig = `
   servers = ["localhost:1883"]
   ## MQTT QoS, must be 0, 1, or 2
@@ -63,6 +127,9 @@ var sampleConfig = `
     "sensors/#",
   ]
 
+  ## Tag holding the topic of the messages, set to "" to not keep the topic.
+  # topic_tag = "topic"
+
   # if true, messages that can't be delivered while the subscriber is offline
   # will be delivered when it comes back (such as on service restart).
   # NOTE: if true, client_id MUST be set
@@ -81,6 +148,14 @@ var sampleConfig = `
   ## Use SSL but skip chain & host verification
   # insecure_skip_verify = false
 
+  ## Extract tags from the levels of the topics. The first entry whose topic
+  ## filter matches the topic of a message applies: each level of tags names
+  ## the tag holding the corresponding level of the topic, "_" skips it and
+  ## "measurement" names the metrics after it.
+  # [[inputs.mqtt_consumer.topic_parsing]]
+  #   topic = "sensors/+/+/#"
+  #   tags = "_/site/measurement/device"
+
   ## Data format to consume.
   ## Each data format has its own unique set of configuration options, read
   ## more about them here:
@@ -114,6 +189,11 @@ func (m *MQTTConsumer) Start(acc telegraf.Accumulator) error {
 	if m.QoS > 2 || m.QoS < 0 {
 		return fmt.Errorf("MQTT Consumer, invalid QoS value: %d", m.QoS)
 	}
+	for _, p := range m.TopicParsing {
+		if err := p.compile(); err != nil {
+			return fmt.Errorf("MQTT Consumer, invalid topic_parsing: %s", err)
+		}
+	}
 
 	opts, err := m.createOpts()
 	if err != nil {
@@ -170,10 +250,29 @@ func (m *MQTTConsumer) receiver() {
 					string(msg.Payload()), err.Error()))
 			}
 
+			topicTag := "topic"
+			if m.TopicTag != nil {
+				topicTag = *m.TopicTag
+			}
+			var parsing *TopicParsing
+			levels := strings.Split(topic, "/")
+			for _, p := range m.TopicParsing {
+				if p.match(levels) {
+					parsing = p
+					break
+				}
+			}
+
 			for _, metric := range metrics {
+				name := metric.Name()
 				tags := metric.Tags()
-				tags["topic"] = topic
-				m.acc.AddFields(metric.Name(), metric.Fields(), tags, metric.Time())
+				if topicTag != "" {
+					tags[topicTag] = topic
+				}
+				if parsing != nil {
+					name = parsing.apply(levels, name, tags)
+				}
+				m.acc.AddFields(name, metric.Fields(), tags, metric.Time())
 			}
 		}
 	}
@@ -1,6 +1,7 @@
 package mqtt_consumer
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/influxdata/telegraf/plugins/parsers"
@@ -184,6 +185,82 @@ func TestRunParserAndGatherJSON(t *testing.T) {
 		})
 }
 
+func TestTopicParsingMatch(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		match  bool
+	}{
+		{"sensors/+/temp", "sensors/paris/temp", true},
+		{"sensors/+/temp", "sensors/paris/hum", false},
+		{"sensors/+/temp", "sensors/paris/temp/raw", false},
+		{"sensors/#", "sensors/paris/temp", true},
+		{"sensors/#", "sensors", true},
+		{"sensors/#", "actuators/paris", false},
+		{"#", "sensors/paris", true},
+	}
+	for _, tt := range tests {
+		p := &TopicParsing{Topic: tt.filter}
+		assert.NoError(t, p.compile())
+		assert.Equal(t, tt.match, p.match(strings.Split(tt.topic, "/")),
+			"%s on %s", tt.filter, tt.topic)
+	}
+
+	p := &TopicParsing{Topic: "sensors/#/temp"}
+	assert.Error(t, p.compile())
+	p = &TopicParsing{Topic: "sensors/+", Tags: "_/room/sensor"}
+	assert.Error(t, p.compile())
+}
+
+// Test that Start() fails on an invalid topic filter
+func TestStartInvalidTopicParsing(t *testing.T) {
+	m := &MQTTConsumer{
+		Servers:      []string{"localhost:1883"},
+		TopicParsing: []*TopicParsing{{Topic: "a/#/b"}},
+	}
+	acc := testutil.Accumulator{}
+	assert.Error(t, m.Start(&acc))
+}
+
+func TestRunParserTopicParsing(t *testing.T) {
+	n, in := newTestMQTTConsumer()
+	acc := testutil.Accumulator{}
+	n.acc = &acc
+	defer close(n.done)
+
+	topicTag := "mqtt_topic"
+	n.TopicTag = &topicTag
+	n.TopicParsing = []*TopicParsing{
+		{Topic: "sensors/+/+/#", Tags: "_/site/measurement/device"},
+		{Topic: "sensors/#", Tags: "_/site"},
+	}
+	for _, p := range n.TopicParsing {
+		assert.NoError(t, p.compile())
+	}
+	n.parser, _ = parsers.NewValueParser("value", "float", nil)
+	go n.receiver()
+
+	msg := &message{topic: "sensors/paris/temperature/probe1/raw", payload: []byte("21.5")}
+	in <- msg
+	acc.Wait(1)
+	acc.AssertContainsTaggedFields(t, "temperature",
+		map[string]interface{}{"value": 21.5},
+		map[string]string{
+			"mqtt_topic": "sensors/paris/temperature/probe1/raw",
+			"site":       "paris",
+			"device":     "probe1",
+		})
+
+	// only the first matching entry applies
+	noTag := ""
+	n.TopicTag = &noTag
+	in <- &message{topic: "sensors/lyon", payload: []byte("3")}
+	acc.Wait(2)
+	acc.AssertContainsTaggedFields(t, "value",
+		map[string]interface{}{"value": float64(3)},
+		map[string]string{"site": "lyon"})
+}
+
 func mqttMsg(val string) mqtt.Message {
 	return &message{
 		topic:   "telegraf/unit_test",
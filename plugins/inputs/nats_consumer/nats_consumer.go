@@ -3,9 +3,11 @@ package natsconsumer
 import (
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
 	"github.com/nats-io/nats"
@@ -28,6 +30,24 @@ type natsConsumer struct {
 	Servers    []string
 	Secure     bool
 
+	// Credentials
+	Username string
+	Password string
+
+	// Path to CA file
+	SSLCA string `toml:"ssl_ca"`
+	// Path to host cert file
+	SSLCert string `toml:"ssl_cert"`
+	// Path to cert key file
+	SSLKey string `toml:"ssl_key"`
+	// Use SSL but skip chain & host verification
+	InsecureSkipVerify bool
+
+	// JetStreamAck acknowledges the messages delivered by a JetStream
+	// consumer once parsed, and terminates the delivery of the messages
+	// that cannot be parsed.
+	JetStreamAck bool `toml:"jetstream_ack"`
+
 	// Client pending limits:
 	PendingMessageLimit int
 	PendingBytesLimit   int
@@ -41,6 +61,8 @@ type natsConsumer struct {
 	wg   sync.WaitGroup
 	Conn *nats.Conn
 	Subs []*nats.Subscription
+	// publish sends the acknowledgements, replaced by the tests
+	publish func(subject string, data []byte) error
 
 	// channel for all incoming NATS messages
 	in chan *nats.Msg
@@ -55,11 +77,27 @@ var sampleConfig = `
   # servers = ["nats://localhost:4222"]
   ## Use Transport Layer Security
   # secure = false
+  ## Optional credentials
+  # username = ""
+  # password = ""
+
+  ## Optional SSL Config, enables secure
+  # ssl_ca = "/etc/telegraf/ca.pem"
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+  ## Use SSL but skip chain & host verification
+  # insecure_skip_verify = false
+
   ## subject(s) to consume
   # subjects = ["telegraf"]
   ## name a queue group
   # queue_group = "telegraf_consumers"
 
+  ## Acknowledge the messages delivered by a JetStream push consumer once
+  ## parsed, the messages that cannot be parsed are terminated and not
+  ## redelivered. The subjects are the deliver subjects of the consumers.
+  # jetstream_ack = false
+
   ## Sets the limits for pending msgs and bytes for each subscription
   ## These shouldn't need to be adjusted except in very high throughput scenarios
   # pending_message_limit = 65536
@@ -112,11 +150,28 @@ func (n *natsConsumer) Start(acc telegraf.Accumulator) error {
 
 	opts.Secure = n.Secure
 
+	// override authentication, if any was specified
+	if n.Username != "" {
+		opts.User = n.Username
+		opts.Password = n.Password
+	}
+
+	tlsConfig, err := internal.GetTLSConfig(
+		n.SSLCert, n.SSLKey, n.SSLCA, n.InsecureSkipVerify)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		opts.Secure = true
+		opts.TLSConfig = tlsConfig
+	}
+
 	if n.Conn == nil || n.Conn.IsClosed() {
 		n.Conn, connectErr = opts.Connect()
 		if connectErr != nil {
 			return connectErr
 		}
+		n.publish = n.Conn.Publish
 
 		// Setup message and error channels
 		n.errs = make(chan error)
@@ -172,10 +227,30 @@ func (n *natsConsumer) receiver() {
 			for _, metric := range metrics {
 				n.acc.AddFields(metric.Name(), metric.Fields(), metric.Tags(), metric.Time())
 			}
+			if n.JetStreamAck {
+				n.ack(msg, err == nil)
+			}
 		}
 	}
 }
 
+// ack acknowledges a message delivered by JetStream, or terminates its
+// delivery if it could not be parsed. The other messages have no
+// acknowledgement subject.
+func (n *natsConsumer) ack(msg *nats.Msg, parsed bool) {
+	if !strings.HasPrefix(msg.Reply, "$JS.ACK.") {
+		return
+	}
+	ack := "+ACK"
+	if !parsed {
+		ack = "+TERM"
+	}
+	if err := n.publish(msg.Reply, []byte(ack)); err != nil {
+		n.acc.AddError(fmt.Errorf("E! subject: %s, error acknowledging: %s",
+			msg.Subject, err.Error()))
+	}
+}
+
 func (n *natsConsumer) clean() {
 	for _, sub := range n.Subs {
 		if err := sub.Unsubscribe(); err != nil {
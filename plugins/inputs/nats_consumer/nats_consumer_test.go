@@ -63,6 +63,41 @@ func TestRunParserInvalidMsg(t *testing.T) {
 	assert.EqualValues(t, 0, acc.NMetrics())
 }
 
+// Test that the JetStream messages are acknowledged once parsed
+func TestRunParserJetStreamAck(t *testing.T) {
+	n, in := newTestNatsConsumer()
+	acc := testutil.Accumulator{}
+	n.acc = &acc
+	defer close(n.done)
+
+	acks := make(chan string, 3)
+	n.JetStreamAck = true
+	n.publish = func(subject string, data []byte) error {
+		acks <- subject + " " + string(data)
+		return nil
+	}
+	n.parser, _ = parsers.NewInfluxParser()
+	n.wg.Add(1)
+	go n.receiver()
+
+	msg := natsMsg(testMsg)
+	msg.Reply = "$JS.ACK.metrics.telegraf.1.1.1.1500000000000000000.0"
+	in <- msg
+	assert.Equal(t, msg.Reply+" +ACK", <-acks)
+
+	msg = natsMsg(invalidMsg)
+	msg.Reply = "$JS.ACK.metrics.telegraf.1.2.2.1500000000000000000.0"
+	in <- msg
+	assert.Equal(t, msg.Reply+" +TERM", <-acks)
+
+	// core NATS requests are not acknowledged
+	msg = natsMsg(testMsg)
+	msg.Reply = "_INBOX.reply"
+	in <- msg
+	acc.Wait(2)
+	assert.Empty(t, acks)
+}
+
 // Test that the parser parses line format messages into metrics
 func TestRunParserAndGather(t *testing.T) {
 	n, in := newTestNatsConsumer()
@@ -0,0 +1,216 @@
+package nvidia_smi
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+var (
+	execCommand = exec.Command // execCommand is used to mock commands in tests.
+)
+
+const (
+	measurement        = "nvidia_smi"
+	processMeasurement = "nvidia_smi_process"
+)
+
+// query is a property queried from nvidia-smi, reported as a tag or as a
+// field of the given kind.
+type query struct {
+	name  string
+	key   string
+	isTag bool
+	kind  string // "int" or "float"
+}
+
+// gpuQueries are the properties of the GPUs, in the order of the columns of
+// the output of nvidia-smi. The first two columns are the index and the UUID.
+var gpuQueries = []query{
+	{name: "index", key: "index", isTag: true},
+	{name: "uuid", key: "uuid", isTag: true},
+	{name: "name", key: "name", isTag: true},
+	{name: "pstate", key: "pstate", isTag: true},
+	{name: "fan.speed", key: "fan_speed", kind: "int"},
+	{name: "memory.total", key: "memory_total", kind: "int"},
+	{name: "memory.used", key: "memory_used", kind: "int"},
+	{name: "memory.free", key: "memory_free", kind: "int"},
+	{name: "temperature.gpu", key: "temperature_gpu", kind: "int"},
+	{name: "utilization.gpu", key: "utilization_gpu", kind: "int"},
+	{name: "utilization.memory", key: "utilization_memory", kind: "int"},
+	{name: "power.draw", key: "power_draw", kind: "float"},
+	{name: "power.limit", key: "power_limit", kind: "float"},
+	{name: "clocks.sm", key: "clocks_current_sm", kind: "int"},
+	{name: "clocks.mem", key: "clocks_current_memory", kind: "int"},
+}
+
+// processQueries are the properties of the compute processes. The first
+// column is the UUID of the GPU the process runs on.
+var processQueries = []query{
+	{name: "gpu_uuid", key: "uuid", isTag: true},
+	{name: "pid", key: "pid", isTag: true},
+	{name: "process_name", key: "process_name", isTag: true},
+	{name: "used_memory", key: "used_memory", kind: "int"},
+}
+
+type NvidiaSMI struct {
+	BinPath        string `toml:"bin_path"`
+	Timeout        internal.Duration
+	ProcessMetrics bool `toml:"process_metrics"`
+}
+
+var sampleConfig = `
+  ## Path to the nvidia-smi binary.
+  # bin_path = "/usr/bin/nvidia-smi"
+
+  ## Timeout of each run of nvidia-smi.
+  # timeout = "5s"
+
+  ## Report the GPU memory used by each compute process, in the
+  ## nvidia_smi_process measurement tagged with the pid of the process.
+  # process_metrics = true
+`
+
+func (n *NvidiaSMI) SampleConfig() string {
+	return sampleConfig
+}
+
+func (n *NvidiaSMI) Description() string {
+	return "Read metrics of the NVIDIA GPUs with nvidia-smi"
+}
+
+func (n *NvidiaSMI) Gather(acc telegraf.Accumulator) error {
+	gpus, err := n.query("--query-gpu", gpuQueries)
+	if err != nil {
+		return err
+	}
+
+	// index of the GPUs by UUID, to tag the processes
+	indexes := make(map[string]string, len(gpus))
+	for _, gpu := range gpus {
+		indexes[gpu.tags["uuid"]] = gpu.tags["index"]
+		acc.AddFields(measurement, gpu.fields, gpu.tags)
+	}
+
+	if !n.ProcessMetrics {
+		return nil
+	}
+	processes, err := n.query("--query-compute-apps", processQueries)
+	if err != nil {
+		return err
+	}
+	for _, p := range processes {
+		if index, ok := indexes[p.tags["uuid"]]; ok {
+			p.tags["index"] = index
+		}
+		acc.AddFields(processMeasurement, p.fields, p.tags)
+	}
+	return nil
+}
+
+type row struct {
+	tags   map[string]string
+	fields map[string]interface{}
+}
+
+// query runs nvidia-smi with the properties of queries and parses its
+// output, one row per line.
+func (n *NvidiaSMI) query(flag string, queries []query) ([]row, error) {
+	names := make([]string, len(queries))
+	for i, q := range queries {
+		names[i] = q.name
+	}
+	cmd := execCommand(n.BinPath, flag+"="+strings.Join(names, ","),
+		"--format=csv,noheader,nounits")
+	out, err := internal.CombinedOutputTimeout(cmd, n.Timeout.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run command %s: %s - %s",
+			strings.Join(cmd.Args, " "), err, string(out))
+	}
+	return parse(out, queries)
+}
+
+func parse(out []byte, queries []query) ([]row, error) {
+	r := csv.NewReader(bytes.NewReader(out))
+	r.TrimLeadingSpace = true
+	r.FieldsPerRecord = len(queries)
+
+	var rows []row
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse the output of nvidia-smi: %s", err)
+		}
+
+		rw := row{
+			tags:   make(map[string]string),
+			fields: make(map[string]interface{}),
+		}
+		for i, q := range queries {
+			value := strings.TrimSpace(record[i])
+			if !available(value) {
+				continue
+			}
+			if q.isTag {
+				rw.tags[q.key] = value
+				continue
+			}
+			if v, ok := convert(value, q.kind); ok {
+				rw.fields[q.key] = v
+			}
+		}
+		if len(rw.fields) > 0 {
+			rows = append(rows, rw)
+		}
+	}
+}
+
+// available returns false for the values nvidia-smi reports for properties
+// the GPU does not support.
+func available(value string) bool {
+	switch value {
+	case "", "N/A", "[N/A]", "[Not Supported]":
+		return false
+	}
+	return true
+}
+
+func convert(value, kind string) (interface{}, bool) {
+	switch kind {
+	case "int":
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v, true
+		}
+		// some drivers report decimals for integer properties
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return int64(v), true
+		}
+	case "float":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func init() {
+	inputs.Add("nvidia_smi", func() telegraf.Input {
+		return &NvidiaSMI{
+			BinPath:        "/usr/bin/nvidia-smi",
+			Timeout:        internal.Duration{Duration: 5 * time.Second},
+			ProcessMetrics: true,
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package nvidia_smi
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newNvidiaSMI() *NvidiaSMI {
+	return &NvidiaSMI{
+		BinPath:        "nvidia-smi",
+		Timeout:        internal.Duration{Duration: 5 * time.Second},
+		ProcessMetrics: true,
+	}
+}
+
+func TestGather(t *testing.T) {
+	execCommand = fakeExecCommand
+	defer func() { execCommand = exec.Command }()
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(newNvidiaSMI().Gather))
+
+	acc.AssertContainsTaggedFields(t, "nvidia_smi",
+		map[string]interface{}{
+			"fan_speed":             int64(32),
+			"memory_total":          int64(16160),
+			"memory_used":           int64(7510),
+			"memory_free":           int64(8650),
+			"temperature_gpu":       int64(61),
+			"utilization_gpu":       int64(87),
+			"utilization_memory":    int64(45),
+			"power_draw":            float64(210.35),
+			"power_limit":           float64(250),
+			"clocks_current_sm":     int64(1530),
+			"clocks_current_memory": int64(877),
+		},
+		map[string]string{
+			"index":  "0",
+			"uuid":   "GPU-b1a2c3d4",
+			"name":   "Tesla V100-PCIE-16GB",
+			"pstate": "P0",
+		})
+
+	// the unsupported properties are skipped
+	acc.AssertContainsTaggedFields(t, "nvidia_smi",
+		map[string]interface{}{
+			"memory_total":          int64(15079),
+			"memory_used":           int64(0),
+			"memory_free":           int64(15079),
+			"temperature_gpu":       int64(38),
+			"utilization_gpu":       int64(0),
+			"utilization_memory":    int64(0),
+			"power_draw":            float64(26.1),
+			"power_limit":           float64(70),
+			"clocks_current_sm":     int64(300),
+			"clocks_current_memory": int64(405),
+		},
+		map[string]string{
+			"index":  "1",
+			"uuid":   "GPU-e5f6a7b8",
+			"name":   "Tesla T4",
+			"pstate": "P8",
+		})
+
+	acc.AssertContainsTaggedFields(t, "nvidia_smi_process",
+		map[string]interface{}{"used_memory": int64(7500)},
+		map[string]string{
+			"index":        "0",
+			"uuid":         "GPU-b1a2c3d4",
+			"pid":          "4242",
+			"process_name": "python3",
+		})
+	assert.Len(t, acc.Metrics, 3)
+}
+
+func TestGatherNoProcesses(t *testing.T) {
+	execCommand = fakeExecCommand
+	defer func() { execCommand = exec.Command }()
+
+	n := newNvidiaSMI()
+	n.ProcessMetrics = false
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.False(t, acc.HasMeasurement("nvidia_smi_process"))
+	assert.Len(t, acc.Metrics, 2)
+}
+
+func TestGatherError(t *testing.T) {
+	execCommand = fakeExecCommand
+	defer func() { execCommand = exec.Command }()
+
+	n := newNvidiaSMI()
+	n.BinPath = "missing"
+	var acc testutil.Accumulator
+	assert.Error(t, acc.GatherError(n.Gather))
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := parse([]byte("0, GPU-1\n"), gpuQueries)
+	assert.Error(t, err)
+}
+
+func fakeExecCommand(command string, args ...string) *exec.Cmd {
+	cs := []string{"-test.run=TestHelperProcess", "--", command}
+	cs = append(cs, args...)
+	cmd := exec.Command(os.Args[0], cs...)
+	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+	return cmd
+}
+
+// TestHelperProcess isn't a real test. It's used to mock exec.Command
+// For example, if you run:
+// GO_WANT_HELPER_PROCESS=1 go test -test.run=TestHelperProcess -- nvidia-smi --query-gpu=...
+// it returns below mockGPUs.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+
+	mockGPUs := `0, GPU-b1a2c3d4, Tesla V100-PCIE-16GB, P0, 32, 16160, 7510, 8650, 61, 87, 45, 210.35, 250.00, 1530, 877
+1, GPU-e5f6a7b8, Tesla T4, P8, [Not Supported], 15079, 0, 15079, 38, 0, 0, 26.10, 70.00, 300, 405
+`
+	mockProcesses := `GPU-b1a2c3d4, 4242, python3, 7500
+`
+
+	args := os.Args
+	cmd, args := args[3], args[4:]
+	if cmd != "nvidia-smi" || len(args) == 0 {
+		fmt.Fprint(os.Stdout, "command not found")
+		os.Exit(1)
+	}
+
+	switch {
+	case strings.HasPrefix(args[0], "--query-gpu="):
+		fmt.Fprint(os.Stdout, mockGPUs)
+	case strings.HasPrefix(args[0], "--query-compute-apps="):
+		fmt.Fprint(os.Stdout, mockProcesses)
+	default:
+		fmt.Fprint(os.Stdout, "invalid query")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
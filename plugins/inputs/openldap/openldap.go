@@ -1,9 +1,12 @@
 package openldap
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/ldap.v2"
 
@@ -20,6 +23,16 @@ type Openldap struct {
 	SslCa              string
 	BindDn             string
 	BindPassword       string
+
+	// SkipMonitor disables the gathering of the cn=Monitor statistics
+	SkipMonitor bool
+	// Probe reports the time taken to connect, bind and search in the
+	// openldap_probe measurement.
+	Probe             bool
+	ProbeSearchBase   string
+	ProbeSearchFilter string
+	ProbeSearchScope  string
+	Timeout           internal.Duration
 }
 
 const sampleConfig string = `
@@ -40,6 +53,22 @@ const sampleConfig string = `
   # dn/password to bind with. If bind_dn is empty, an anonymous bind is performed.
   bind_dn = ""
   bind_password = ""
+
+  ## Do not gather the statistics of the cn=Monitor backend, for instance when
+  ## only probing a server.
+  # skip_monitor = false
+
+  ## Report the time taken to connect, bind and run a search in the
+  ## openldap_probe measurement. The search is skipped when
+  ## probe_search_base is empty. probe_search_scope is one of "base", "one"
+  ## or "sub".
+  # probe = false
+  # probe_search_base = "dc=example,dc=com"
+  # probe_search_filter = "(objectClass=*)"
+  # probe_search_scope = "base"
+
+  ## Timeout of the connection and of each request.
+  # timeout = "5s"
 `
 
 var searchBase = "cn=Monitor"
@@ -69,54 +98,72 @@ func NewOpenldap() *Openldap {
 		SslCa:              "",
 		BindDn:             "",
 		BindPassword:       "",
+		ProbeSearchFilter:  "(objectClass=*)",
+		ProbeSearchScope:   "base",
+		Timeout:            internal.Duration{Duration: 5 * time.Second},
 	}
 }
 
 // gather metrics
 func (o *Openldap) Gather(acc telegraf.Accumulator) error {
-	var err error
-	var l *ldap.Conn
-	if o.Ssl != "" {
-		// build tls config
-		tlsConfig, err := internal.GetTLSConfig("", "", o.SslCa, o.InsecureSkipVerify)
-		if err != nil {
-			acc.AddError(err)
-			return nil
-		}
-		if o.Ssl == "ldaps" {
-			l, err = ldap.DialTLS("tcp", fmt.Sprintf("%s:%d", o.Host, o.Port), tlsConfig)
-			if err != nil {
-				acc.AddError(err)
-				return nil
-			}
-		} else if o.Ssl == "starttls" {
-			l, err = ldap.Dial("tcp", fmt.Sprintf("%s:%d", o.Host, o.Port))
-			if err != nil {
-				acc.AddError(err)
-				return nil
-			}
-			err = l.StartTLS(tlsConfig)
-		} else {
-			acc.AddError(fmt.Errorf("Invalid setting for ssl: %s", o.Ssl))
-			return nil
-		}
-	} else {
-		l, err = ldap.Dial("tcp", fmt.Sprintf("%s:%d", o.Host, o.Port))
-	}
+	p := newProbe(o)
+	defer p.report(acc)
 
+	start := time.Now()
+	l, err := o.connect()
 	if err != nil {
+		p.fail("connection_error", err)
 		acc.AddError(err)
 		return nil
 	}
 	defer l.Close()
+	p.fields["connect_time_ms"] = sinceMs(start)
+	if o.Timeout.Duration > 0 {
+		l.SetTimeout(o.Timeout.Duration)
+	}
 
 	// username/password bind
 	if o.BindDn != "" && o.BindPassword != "" {
+		start = time.Now()
 		err = l.Bind(o.BindDn, o.BindPassword)
 		if err != nil {
+			p.fail("bind_error", err)
 			acc.AddError(err)
 			return nil
 		}
+		p.fields["bind_time_ms"] = sinceMs(start)
+	}
+
+	if o.Probe && o.ProbeSearchBase != "" {
+		scope, err := searchScope(o.ProbeSearchScope)
+		if err != nil {
+			p.fail("search_error", err)
+			acc.AddError(err)
+			return nil
+		}
+		start = time.Now()
+		sr, err := l.Search(ldap.NewSearchRequest(
+			o.ProbeSearchBase,
+			scope,
+			ldap.NeverDerefAliases,
+			0,
+			0,
+			false,
+			o.ProbeSearchFilter,
+			[]string{"1.1"}, // no attributes
+			nil,
+		))
+		if err != nil {
+			p.fail("search_error", err)
+			acc.AddError(err)
+			return nil
+		}
+		p.fields["search_time_ms"] = sinceMs(start)
+		p.fields["search_entries"] = int64(len(sr.Entries))
+	}
+
+	if o.SkipMonitor {
+		return nil
 	}
 
 	searchRequest := ldap.NewSearchRequest(
@@ -142,6 +189,107 @@ func (o *Openldap) Gather(acc telegraf.Accumulator) error {
 	return nil
 }
 
+// connect opens a connection to the server, with the configured encryption.
+func (o *Openldap) connect() (*ldap.Conn, error) {
+	address := net.JoinHostPort(o.Host, strconv.Itoa(o.Port))
+	dialer := &net.Dialer{Timeout: o.Timeout.Duration}
+
+	var tlsConfig *tls.Config
+	if o.Ssl != "" {
+		// build tls config
+		var err error
+		tlsConfig, err = internal.GetTLSConfig("", "", o.SslCa, o.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch o.Ssl {
+	case "":
+		conn, err := dialer.Dial("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		l := ldap.NewConn(conn, false)
+		l.Start()
+		return l, nil
+	case "ldaps":
+		conn, err := tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		l := ldap.NewConn(conn, true)
+		l.Start()
+		return l, nil
+	case "starttls":
+		conn, err := dialer.Dial("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		l := ldap.NewConn(conn, false)
+		l.Start()
+		if err := l.StartTLS(tlsConfig); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	default:
+		return nil, fmt.Errorf("Invalid setting for ssl: %s", o.Ssl)
+	}
+}
+
+// probe holds the openldap_probe metric of a Gather.
+type probe struct {
+	enabled bool
+	tags    map[string]string
+	fields  map[string]interface{}
+}
+
+func newProbe(o *Openldap) *probe {
+	return &probe{
+		enabled: o.Probe,
+		tags: map[string]string{
+			"server": o.Host,
+			"port":   strconv.Itoa(o.Port),
+			"result": "success",
+		},
+		fields: map[string]interface{}{"result_code": int64(0)},
+	}
+}
+
+// fail records the step that failed and the LDAP result code of err, -1 if
+// it is not an LDAP error.
+func (p *probe) fail(result string, err error) {
+	p.tags["result"] = result
+	code := int64(-1)
+	if lerr, ok := err.(*ldap.Error); ok {
+		code = int64(lerr.ResultCode)
+	}
+	p.fields["result_code"] = code
+}
+
+func (p *probe) report(acc telegraf.Accumulator) {
+	if p.enabled {
+		acc.AddFields("openldap_probe", p.fields, p.tags)
+	}
+}
+
+func searchScope(scope string) (int, error) {
+	switch scope {
+	case "", "base":
+		return ldap.ScopeBaseObject, nil
+	case "one":
+		return ldap.ScopeSingleLevel, nil
+	case "sub":
+		return ldap.ScopeWholeSubtree, nil
+	}
+	return 0, fmt.Errorf("Invalid probe_search_scope: %s", scope)
+}
+
+func sinceMs(start time.Time) float64 {
+	return float64(time.Since(start).Nanoseconds()) / 1e6
+}
+
 func gatherSearchResult(sr *ldap.SearchResult, o *Openldap, acc telegraf.Accumulator) {
 	fields := map[string]interface{}{}
 	tags := map[string]string{
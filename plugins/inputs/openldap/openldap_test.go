@@ -2,6 +2,7 @@ package openldap
 
 import (
 	"gopkg.in/ldap.v2"
+	"net"
 	"strconv"
 	"testing"
 
@@ -141,6 +142,70 @@ func TestOpenldapBind(t *testing.T) {
 	commonTests(t, o, &acc)
 }
 
+func TestOpenldapProbeNoConnection(t *testing.T) {
+	// a port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	o := NewOpenldap()
+	o.Host = "127.0.0.1"
+	o.Port = port
+	o.Probe = true
+
+	var acc testutil.Accumulator
+	require.NoError(t, o.Gather(&acc))
+	assert.NotEmpty(t, acc.Errors)
+	acc.AssertContainsTaggedFields(t, "openldap_probe",
+		map[string]interface{}{"result_code": int64(-1)},
+		map[string]string{
+			"server": "127.0.0.1",
+			"port":   strconv.Itoa(port),
+			"result": "connection_error",
+		})
+	assert.False(t, acc.HasMeasurement("openldap"))
+}
+
+func TestOpenldapProbe(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	o := NewOpenldap()
+	o.Host = testutil.GetLocalHost()
+	o.BindDn = "cn=manager,cn=config"
+	o.BindPassword = "secret"
+	o.SkipMonitor = true
+	o.Probe = true
+	o.ProbeSearchBase = "cn=config"
+
+	var acc testutil.Accumulator
+	require.NoError(t, o.Gather(&acc))
+	assert.Empty(t, acc.Errors)
+	assert.False(t, acc.HasMeasurement("openldap"))
+	assert.Equal(t, "success", acc.TagValue("openldap_probe", "result"))
+	for _, field := range []string{"connect_time_ms", "bind_time_ms", "search_time_ms"} {
+		assert.True(t, acc.HasFloatField("openldap_probe", field), field)
+	}
+	assert.True(t, acc.HasInt64Field("openldap_probe", "search_entries"))
+}
+
+func TestSearchScope(t *testing.T) {
+	for name, scope := range map[string]int{
+		"":     ldap.ScopeBaseObject,
+		"base": ldap.ScopeBaseObject,
+		"one":  ldap.ScopeSingleLevel,
+		"sub":  ldap.ScopeWholeSubtree,
+	} {
+		s, err := searchScope(name)
+		require.NoError(t, err)
+		assert.Equal(t, scope, s)
+	}
+	_, err := searchScope("subtree")
+	assert.Error(t, err)
+}
+
 func commonTests(t *testing.T, o *Openldap, acc *testutil.Accumulator) {
 	assert.Empty(t, acc.Errors, "accumulator had no errors")
 	assert.True(t, acc.HasMeasurement("openldap"), "Has a measurement called 'openldap'")
@@ -0,0 +1,379 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+const (
+	defaultMaxMessageSize = 4 * 1024 * 1024
+
+	exportPath = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	httpPath   = "/v1/metrics"
+)
+
+// gRPC status codes
+const (
+	codeOK                = 0
+	codeInvalidArgument   = 3
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeInternal          = 13
+)
+
+// OpenTelemetry receives the metrics of OpenTelemetry SDKs and collectors
+// exported with the OTLP protocol, over gRPC and HTTP.
+type OpenTelemetry struct {
+	ServiceAddress string `toml:"service_address"`
+	HTTPAddress    string `toml:"http_address"`
+	MaxMessageSize int    `toml:"max_message_size"`
+
+	// Path to the TLS certificate and key of the listeners and to the CAs
+	// client certificates must be signed by.
+	SSLCert             string   `toml:"ssl_cert"`
+	SSLKey              string   `toml:"ssl_key"`
+	SSLAllowedClientCAs []string `toml:"ssl_allowed_client_ca"`
+
+	mu sync.Mutex
+	wg sync.WaitGroup
+
+	acc          telegraf.Accumulator
+	grpcListener net.Listener
+	// servers of the TLS gRPC listener and of the HTTP one
+	servers []*http.Server
+	// connections of the cleartext gRPC listener
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+
+	RequestsRecv selfstat.Stat
+	MetricsRecv  selfstat.Stat
+	ParseErrors  selfstat.Stat
+}
+
+const sampleConfig = `
+  ## Address and port of the OTLP/gRPC receiver.
+  service_address = ":4317"
+
+  ## Address and port of the OTLP/HTTP receiver, which accepts the protobuf
+  ## encoding only. Empty disables it.
+  # http_address = ":4318"
+
+  ## Maximum size of a request, in bytes, once uncompressed.
+  # max_message_size = 4194304
+
+  ## TLS certificate and key, enables TLS on both receivers.
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+
+  ## If set, clients must present a certificate signed by one of these CAs.
+  # ssl_allowed_client_ca = ["/etc/telegraf/clientca.pem"]
+`
+
+func (o *OpenTelemetry) SampleConfig() string {
+	return sampleConfig
+}
+
+func (o *OpenTelemetry) Description() string {
+	return "Receive OpenTelemetry metrics over OTLP/gRPC and OTLP/HTTP"
+}
+
+func (o *OpenTelemetry) Gather(_ telegraf.Accumulator) error {
+	return nil
+}
+
+// Start starts the receivers.
+func (o *OpenTelemetry) Start(acc telegraf.Accumulator) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	tags := map[string]string{
+		"address": o.ServiceAddress,
+	}
+	o.RequestsRecv = selfstat.Register("opentelemetry", "requests_received", tags)
+	o.MetricsRecv = selfstat.Register("opentelemetry", "metrics_received", tags)
+	o.ParseErrors = selfstat.Register("opentelemetry", "parse_errors", tags)
+
+	if o.MaxMessageSize == 0 {
+		o.MaxMessageSize = defaultMaxMessageSize
+	}
+	o.acc = acc
+	o.conns = make(map[net.Conn]struct{})
+	o.servers = nil
+
+	tlsConfig, err := internal.GetServerTLSConfig(o.SSLCert, o.SSLKey, o.SSLAllowedClientCAs)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", o.ServiceAddress)
+	if err != nil {
+		return err
+	}
+	grpcHandler := http.HandlerFunc(o.serveGRPC)
+	if tlsConfig != nil {
+		cfg := tlsConfig.Clone()
+		cfg.NextProtos = []string{"h2"}
+		o.serve(tls.NewListener(listener, cfg), grpcHandler)
+	} else {
+		// gRPC without TLS is HTTP/2 without the upgrade from HTTP/1.1
+		o.grpcListener = listener
+		o.wg.Add(1)
+		go func() {
+			defer o.wg.Done()
+			o.serveH2C(listener, grpcHandler)
+		}()
+	}
+
+	if o.HTTPAddress != "" {
+		listener, err := net.Listen("tcp", o.HTTPAddress)
+		if err != nil {
+			o.stop()
+			return err
+		}
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
+		o.serve(listener, http.HandlerFunc(o.serveHTTP))
+	}
+
+	log.Printf("I! Started the OpenTelemetry receiver on %s\n", o.ServiceAddress)
+	return nil
+}
+
+// Stop closes the listeners and their connections.
+func (o *OpenTelemetry) Stop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.stop()
+	log.Printf("I! Stopped the OpenTelemetry receiver on %s\n", o.ServiceAddress)
+}
+
+func (o *OpenTelemetry) stop() {
+	if o.grpcListener != nil {
+		o.grpcListener.Close()
+		o.grpcListener = nil
+	}
+	for _, server := range o.servers {
+		server.Close()
+	}
+	o.connsMu.Lock()
+	for conn := range o.conns {
+		conn.Close()
+	}
+	o.connsMu.Unlock()
+	o.wg.Wait()
+}
+
+// serve serves the listener with an http.Server, closed on Stop.
+func (o *OpenTelemetry) serve(listener net.Listener, handler http.Handler) {
+	server := &http.Server{Handler: handler}
+	o.servers = append(o.servers, server)
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		server.Serve(listener)
+	}()
+}
+
+// serveH2C serves the connections of the listener with HTTP/2, without TLS.
+func (o *OpenTelemetry) serveH2C(listener net.Listener, handler http.Handler) {
+	server := &http2.Server{}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !strings.HasSuffix(err.Error(), ": use of closed network connection") {
+				log.Printf("E! OpenTelemetry receiver: %s\n", err)
+			}
+			return
+		}
+
+		o.connsMu.Lock()
+		o.conns[conn] = struct{}{}
+		o.connsMu.Unlock()
+
+		o.wg.Add(1)
+		go func() {
+			defer o.wg.Done()
+			server.ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+			conn.Close()
+			o.connsMu.Lock()
+			delete(o.conns, conn)
+			o.connsMu.Unlock()
+		}()
+	}
+}
+
+// serveGRPC serves the Export method of the OTLP metrics service.
+func (o *OpenTelemetry) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" ||
+		!strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.URL.Path != exportPath {
+		grpcStatus(w, codeUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+	o.RequestsRecv.Incr(1)
+
+	var header [5]byte
+	if _, err := io.ReadFull(r.Body, header[:]); err != nil {
+		grpcStatus(w, codeInternal, "unable to read the message: "+err.Error())
+		return
+	}
+	size := int(binary.BigEndian.Uint32(header[1:]))
+	if size > o.MaxMessageSize {
+		grpcStatus(w, codeResourceExhausted,
+			fmt.Sprintf("message of %d bytes over the limit of %d", size, o.MaxMessageSize))
+		return
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r.Body, msg); err != nil {
+		grpcStatus(w, codeInternal, "unable to read the message: "+err.Error())
+		return
+	}
+	if header[0] == 1 {
+		if r.Header.Get("Grpc-Encoding") != "gzip" {
+			grpcStatus(w, codeUnimplemented,
+				"unsupported compression "+r.Header.Get("Grpc-Encoding"))
+			return
+		}
+		var err error
+		if msg, err = o.gunzip(bytes.NewReader(msg)); err != nil {
+			grpcStatus(w, codeInvalidArgument, err.Error())
+			return
+		}
+	}
+
+	if err := o.receive(msg); err != nil {
+		grpcStatus(w, codeInvalidArgument, err.Error())
+		return
+	}
+
+	// an empty ExportMetricsServiceResponse, followed by the status
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{0, 0, 0, 0, 0})
+	w.Header().Set("Grpc-Status", fmt.Sprint(codeOK))
+	w.Header().Set("Grpc-Message", "")
+}
+
+// grpcStatus replies to a failed gRPC call with its status only.
+func grpcStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", fmt.Sprint(code))
+	w.Header().Set("Grpc-Message", url.QueryEscape(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveHTTP serves the OTLP/HTTP requests, encoded with protobuf.
+func (o *OpenTelemetry) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != httpPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/x-protobuf" {
+		http.Error(w, "only application/x-protobuf is supported",
+			http.StatusUnsupportedMediaType)
+		return
+	}
+	o.RequestsRecv.Incr(1)
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, int64(o.MaxMessageSize))
+	var msg []byte
+	var err error
+	switch r.Header.Get("Content-Encoding") {
+	case "gzip":
+		msg, err = o.gunzip(body)
+	case "", "identity":
+		msg, err = ioutil.ReadAll(body)
+	default:
+		http.Error(w, "unsupported Content-Encoding", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := o.receive(msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+// gunzip returns the uncompressed content of r, up to MaxMessageSize bytes.
+func (o *OpenTelemetry) gunzip(r io.Reader) ([]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	msg, err := ioutil.ReadAll(io.LimitReader(gz, int64(o.MaxMessageSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) > o.MaxMessageSize {
+		return nil, fmt.Errorf("uncompressed message over the limit of %d bytes",
+			o.MaxMessageSize)
+	}
+	return msg, nil
+}
+
+// receive adds the metrics of an ExportMetricsServiceRequest, none are
+// added if it is invalid.
+func (o *OpenTelemetry) receive(msg []byte) error {
+	metrics, err := parseRequest(msg)
+	if err != nil {
+		o.ParseErrors.Incr(1)
+		return fmt.Errorf("unable to decode the request: %s", err)
+	}
+	o.MetricsRecv.Incr(int64(len(metrics)))
+	for _, m := range metrics {
+		switch m.Type() {
+		case telegraf.Counter:
+			o.acc.AddCounter(m.Name(), m.Fields(), m.Tags(), m.Time())
+		case telegraf.Gauge:
+			o.acc.AddGauge(m.Name(), m.Fields(), m.Tags(), m.Time())
+		default:
+			o.acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+		}
+	}
+	return nil
+}
+
+func init() {
+	inputs.Add("opentelemetry", func() telegraf.Input {
+		return &OpenTelemetry{
+			ServiceAddress: ":4317",
+			MaxMessageSize: defaultMaxMessageSize,
+		}
+	})
+}
@@ -0,0 +1,265 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pb encodes a protobuf message.
+type pb []byte
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func (m pb) key(num, wire int) pb {
+	return appendUvarint(m, uint64(num<<3|wire))
+}
+
+func (m pb) varint(num int, v uint64) pb {
+	return appendUvarint(m.key(num, wireVarint), v)
+}
+
+func (m pb) fixed(num int, v uint64) pb {
+	return appendFixed64(m.key(num, wireFixed64), v)
+}
+
+func (m pb) double(num int, f float64) pb {
+	return m.fixed(num, math.Float64bits(f))
+}
+
+func (m pb) bytes(num int, b []byte) pb {
+	m = appendUvarint(m.key(num, wireBytes), uint64(len(b)))
+	return append(m, b...)
+}
+
+func (m pb) str(num int, s string) pb {
+	return m.bytes(num, []byte(s))
+}
+
+func (m pb) msg(num int, sub pb) pb {
+	return m.bytes(num, sub)
+}
+
+func attr(key, value string) pb {
+	return pb{}.str(1, key).msg(2, pb{}.str(1, value))
+}
+
+var ts = time.Unix(1500000000, 0)
+
+// request returns an ExportMetricsServiceRequest with a metric of each type.
+func request() pb {
+	gauge := pb{}.str(1, "temperature").msg(5, pb{}.msg(1, pb{}.
+		msg(7, attr("room", "kitchen")).
+		fixed(3, uint64(ts.UnixNano())).
+		fixed(6, uint64(21))))
+	sum := pb{}.str(1, "requests").msg(7, pb{}.
+		msg(1, pb{}.
+			msg(7, attr("host", "web1")).
+			msg(7, pb{}.str(1, "code").msg(2, pb{}.varint(3, 200))).
+			fixed(3, uint64(ts.UnixNano())).
+			double(4, 42)).
+		varint(2, 2).
+		varint(3, 1))
+	var bounds, counts []byte
+	for _, b := range []float64{0.1, 1} {
+		bounds = appendFixed64(bounds, math.Float64bits(b))
+	}
+	for _, c := range []uint64{1, 2, 3} {
+		counts = appendFixed64(counts, c)
+	}
+	histogram := pb{}.str(1, "latency").msg(9, pb{}.msg(1, pb{}.
+		fixed(3, uint64(ts.UnixNano())).
+		fixed(4, 6).
+		double(5, 12.5).
+		bytes(6, counts).
+		bytes(7, bounds)))
+	summary := pb{}.str(1, "duration").msg(11, pb{}.msg(1, pb{}.
+		fixed(3, uint64(ts.UnixNano())).
+		fixed(4, 10).
+		double(5, 5).
+		msg(6, pb{}.double(1, 0.5).double(2, 0.4)).
+		msg(6, pb{}.double(1, 0.99).double(2, 1.2))))
+
+	scope := pb{}.msg(1, pb{}.str(1, "meter")).
+		msg(2, gauge).msg(2, sum).msg(2, histogram).msg(2, summary)
+	resource := pb{}.
+		msg(1, attr("service.name", "checkout")).
+		msg(1, attr("host", "agent"))
+	return pb{}.msg(1, pb{}.msg(1, resource).msg(2, scope))
+}
+
+func TestParseRequest(t *testing.T) {
+	metrics, err := parseRequest(request())
+	require.NoError(t, err)
+	require.Len(t, metrics, 4)
+
+	m := metrics[0]
+	assert.Equal(t, "temperature", m.Name())
+	assert.Equal(t, telegraf.Gauge, m.Type())
+	assert.Equal(t, map[string]string{
+		"service.name": "checkout",
+		"host":         "agent",
+		"room":         "kitchen",
+	}, m.Tags())
+	assert.Equal(t, map[string]interface{}{"gauge": int64(21)}, m.Fields())
+	assert.True(t, ts.Equal(m.Time()))
+
+	// the attributes of the data points override those of the resource
+	m = metrics[1]
+	assert.Equal(t, "requests", m.Name())
+	assert.Equal(t, telegraf.Counter, m.Type())
+	assert.Equal(t, map[string]string{
+		"service.name": "checkout",
+		"host":         "web1",
+		"code":         "200",
+	}, m.Tags())
+	assert.Equal(t, map[string]interface{}{"counter": float64(42)}, m.Fields())
+
+	m = metrics[2]
+	assert.Equal(t, "latency", m.Name())
+	assert.Equal(t, map[string]interface{}{
+		"0.1":   float64(1),
+		"1":     float64(3),
+		"+Inf":  float64(6),
+		"count": float64(6),
+		"sum":   12.5,
+	}, m.Fields())
+
+	m = metrics[3]
+	assert.Equal(t, "duration", m.Name())
+	assert.Equal(t, map[string]interface{}{
+		"0.5":   0.4,
+		"0.99":  1.2,
+		"count": float64(10),
+		"sum":   float64(5),
+	}, m.Fields())
+}
+
+func TestParseInvalidRequest(t *testing.T) {
+	req := request()
+	_, err := parseRequest(req[:len(req)-3])
+	assert.Error(t, err)
+
+	// more bucket counts than bounds allow
+	histogram := pb{}.str(1, "latency").msg(9, pb{}.msg(1, pb{}.
+		fixed(6, 1).fixed(6, 2).fixed(7, math.Float64bits(1)).fixed(6, 3)))
+	scope := pb{}.msg(2, histogram)
+	_, err = parseRequest(pb{}.msg(1, pb{}.msg(2, scope)))
+	assert.Error(t, err)
+}
+
+func newTestReceiver(t *testing.T, acc *testutil.Accumulator) *OpenTelemetry {
+	o := &OpenTelemetry{
+		ServiceAddress: "localhost:14317",
+		HTTPAddress:    "localhost:14318",
+	}
+	require.NoError(t, o.Start(acc))
+	return o
+}
+
+func TestReceiveHTTP(t *testing.T) {
+	acc := &testutil.Accumulator{}
+	o := newTestReceiver(t, acc)
+	defer o.Stop()
+
+	parseErrors := o.ParseErrors.Get()
+	url := "http://localhost:14318/v1/metrics"
+	resp, err := http.Post(url, "application/x-protobuf", bytes.NewReader(request()))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-protobuf", resp.Header.Get("Content-Type"))
+	acc.Wait(4)
+	assert.True(t, acc.HasTag("temperature", "room"))
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(request())
+	gz.Close()
+	req, err := http.NewRequest("POST", url, &buf)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	acc.Wait(8)
+
+	resp, err = http.Post(url, "application/json", bytes.NewReader([]byte("{}")))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	resp, err = http.Post(url, "application/x-protobuf", bytes.NewReader([]byte{0x0a, 0xff}))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, parseErrors+1, o.ParseErrors.Get())
+}
+
+// export calls the gRPC method with msg and returns the response status.
+func export(t *testing.T, client *http.Client, method string, msg []byte) string {
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	body = append(body, msg...)
+	req, err := http.NewRequest("POST", "http://localhost:14317"+method, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	if status := resp.Trailer.Get("Grpc-Status"); status != "" {
+		return status
+	}
+	return resp.Header.Get("Grpc-Status")
+}
+
+func TestReceiveGRPC(t *testing.T) {
+	acc := &testutil.Accumulator{}
+	o := newTestReceiver(t, acc)
+	defer o.Stop()
+
+	requests := o.RequestsRecv.Get()
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	assert.Equal(t, "0", export(t, client, exportPath, request()))
+	acc.Wait(4)
+	acc.AssertContainsTaggedFields(t, "requests",
+		map[string]interface{}{"counter": float64(42)},
+		map[string]string{"service.name": "checkout", "host": "web1", "code": "200"})
+
+	assert.Equal(t, "3", export(t, client, exportPath, []byte{0x0a, 0xff}))
+	assert.Equal(t, "12", export(t, client, "/grpc.health.v1.Health/Check", nil))
+	assert.Equal(t, requests+2, o.RequestsRecv.Get())
+}
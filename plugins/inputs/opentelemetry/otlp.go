@@ -0,0 +1,400 @@
+package opentelemetry
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// field is a field of a protobuf message, v holds the varint and fixed
+// values and b the length-delimited ones.
+type field struct {
+	num  int
+	wire int
+	v    uint64
+	b    []byte
+}
+
+// eachField calls fn with the fields of the protobuf message b, in order.
+func eachField(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		f := field{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.v, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			f.v = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			f.v = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return errTruncated
+			}
+			f.b = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", f.wire)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fixed64s returns the values of a repeated fixed64 or double field, packed
+// or not.
+func fixed64s(f field, values []uint64) ([]uint64, error) {
+	if f.wire == wireFixed64 {
+		return append(values, f.v), nil
+	}
+	if f.wire != wireBytes || len(f.b)%8 != 0 {
+		return nil, fmt.Errorf("invalid repeated fixed64 field %d", f.num)
+	}
+	for b := f.b; len(b) > 0; b = b[8:] {
+		values = append(values, binary.LittleEndian.Uint64(b))
+	}
+	return values, nil
+}
+
+// converter converts the OTLP metrics of an ExportMetricsServiceRequest to
+// telegraf metrics, their attributes being the tags.
+type converter struct {
+	metrics []telegraf.Metric
+}
+
+// parseRequest returns the metrics of an encoded ExportMetricsServiceRequest.
+func parseRequest(b []byte) ([]telegraf.Metric, error) {
+	c := &converter{}
+	err := eachField(b, func(f field) error {
+		if f.num == 1 && f.wire == wireBytes {
+			return c.resourceMetrics(f.b)
+		}
+		return nil
+	})
+	return c.metrics, err
+}
+
+func (c *converter) resourceMetrics(b []byte) error {
+	resource := make(map[string]string)
+	var scopes [][]byte
+	err := eachField(b, func(f field) error {
+		if f.wire != wireBytes {
+			return nil
+		}
+		switch f.num {
+		case 1: // Resource
+			return eachField(f.b, func(f field) error {
+				if f.num == 1 && f.wire == wireBytes {
+					return attribute(f.b, resource)
+				}
+				return nil
+			})
+		case 2, 1000: // ScopeMetrics, the deprecated InstrumentationLibraryMetrics
+			scopes = append(scopes, f.b)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// the resource may follow the metrics
+	for _, scope := range scopes {
+		err := eachField(scope, func(f field) error {
+			if f.num == 2 && f.wire == wireBytes {
+				return c.metric(f.b, resource)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metric converts a Metric to telegraf metrics named after it, a metric
+// per data point.
+func (c *converter) metric(b []byte, resource map[string]string) error {
+	var name string
+	var kind int
+	var data []byte
+	err := eachField(b, func(f field) error {
+		if f.wire != wireBytes {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			name = string(f.b)
+		case 5, 7, 9, 11: // Gauge, Sum, Histogram, Summary
+			kind, data = f.num, f.b
+		}
+		return nil
+	})
+	if err != nil || data == nil {
+		return err
+	}
+
+	monotonic := false
+	var points [][]byte
+	err = eachField(data, func(f field) error {
+		switch {
+		case f.num == 1 && f.wire == wireBytes:
+			points = append(points, f.b)
+		case f.num == 3 && kind == 7 && f.wire == wireVarint:
+			monotonic = f.v != 0
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range points {
+		var err error
+		switch kind {
+		case 5:
+			err = c.numberPoint(name, p, resource, "gauge", telegraf.Gauge)
+		case 7:
+			if monotonic {
+				err = c.numberPoint(name, p, resource, "counter", telegraf.Counter)
+			} else {
+				err = c.numberPoint(name, p, resource, "gauge", telegraf.Gauge)
+			}
+		case 9:
+			err = c.histogramPoint(name, p, resource)
+		case 11:
+			err = c.summaryPoint(name, p, resource)
+		}
+		if err != nil {
+			return fmt.Errorf("metric %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func (c *converter) add(
+	name string,
+	tags map[string]string,
+	fields map[string]interface{},
+	ts uint64,
+	tp telegraf.ValueType,
+) error {
+	t := time.Now()
+	if ts != 0 {
+		t = time.Unix(0, int64(ts))
+	}
+	m, err := metric.New(name, tags, fields, t, tp)
+	if err != nil {
+		return err
+	}
+	c.metrics = append(c.metrics, m)
+	return nil
+}
+
+// tags returns the resource attributes overridden by the attributes of a
+// data point.
+func tags(resource map[string]string) map[string]string {
+	t := make(map[string]string, len(resource))
+	for k, v := range resource {
+		t[k] = v
+	}
+	return t
+}
+
+// numberPoint converts a NumberDataPoint to a metric whose field is key.
+func (c *converter) numberPoint(
+	name string,
+	b []byte,
+	resource map[string]string,
+	key string,
+	tp telegraf.ValueType,
+) error {
+	t := tags(resource)
+	var ts uint64
+	var value interface{}
+	err := eachField(b, func(f field) error {
+		switch {
+		case f.num == 7 && f.wire == wireBytes:
+			return attribute(f.b, t)
+		case f.num == 3 && f.wire == wireFixed64:
+			ts = f.v
+		case f.num == 4 && f.wire == wireFixed64:
+			value = math.Float64frombits(f.v)
+		case f.num == 6 && f.wire == wireFixed64:
+			value = int64(f.v)
+		}
+		return nil
+	})
+	if err != nil || value == nil {
+		return err
+	}
+	return c.add(name, t, map[string]interface{}{key: value}, ts, tp)
+}
+
+// histogramPoint converts a HistogramDataPoint to a metric in the format of
+// the prometheus input: the cumulative count of each bucket in a field
+// named after its upper bound, and the count and sum fields.
+func (c *converter) histogramPoint(name string, b []byte, resource map[string]string) error {
+	t := tags(resource)
+	var ts, count uint64
+	var sum float64
+	var hasSum bool
+	var counts, bounds []uint64
+	err := eachField(b, func(f field) error {
+		var err error
+		switch {
+		case f.num == 9 && f.wire == wireBytes:
+			err = attribute(f.b, t)
+		case f.num == 3 && f.wire == wireFixed64:
+			ts = f.v
+		case f.num == 4 && f.wire == wireFixed64:
+			count = f.v
+		case f.num == 5 && f.wire == wireFixed64:
+			sum, hasSum = math.Float64frombits(f.v), true
+		case f.num == 6:
+			counts, err = fixed64s(f, counts)
+		case f.num == 7:
+			bounds, err = fixed64s(f, bounds)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(counts) > 0 && len(counts) != len(bounds)+1 {
+		return fmt.Errorf("%d bucket counts for %d bounds", len(counts), len(bounds))
+	}
+
+	fields := map[string]interface{}{"count": float64(count)}
+	if hasSum {
+		fields["sum"] = sum
+	}
+	var cumulative uint64
+	for i, bound := range bounds {
+		cumulative += counts[i]
+		fields[fmt.Sprint(math.Float64frombits(bound))] = float64(cumulative)
+	}
+	fields[fmt.Sprint(math.Inf(1))] = float64(count)
+	return c.add(name, t, fields, ts, telegraf.Untyped)
+}
+
+// summaryPoint converts a SummaryDataPoint to a metric in the format of the
+// prometheus input: a field per quantile, and the count and sum fields.
+func (c *converter) summaryPoint(name string, b []byte, resource map[string]string) error {
+	t := tags(resource)
+	var ts uint64
+	fields := make(map[string]interface{})
+	err := eachField(b, func(f field) error {
+		switch {
+		case f.num == 7 && f.wire == wireBytes:
+			return attribute(f.b, t)
+		case f.num == 3 && f.wire == wireFixed64:
+			ts = f.v
+		case f.num == 4 && f.wire == wireFixed64:
+			fields["count"] = float64(f.v)
+		case f.num == 5 && f.wire == wireFixed64:
+			fields["sum"] = math.Float64frombits(f.v)
+		case f.num == 6 && f.wire == wireBytes:
+			return quantile(f.b, fields)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.add(name, t, fields, ts, telegraf.Untyped)
+}
+
+// quantile adds the value of a ValueAtQuantile to the fields.
+func quantile(b []byte, fields map[string]interface{}) error {
+	var q, v float64
+	err := eachField(b, func(f field) error {
+		switch {
+		case f.num == 1 && f.wire == wireFixed64:
+			q = math.Float64frombits(f.v)
+		case f.num == 2 && f.wire == wireFixed64:
+			v = math.Float64frombits(f.v)
+		}
+		return nil
+	})
+	if err == nil && !math.IsNaN(v) {
+		fields[fmt.Sprint(q)] = v
+	}
+	return err
+}
+
+// attribute adds the KeyValue b to the tags, the arrays and key-value lists
+// are ignored.
+func attribute(b []byte, tags map[string]string) error {
+	var key string
+	var value []byte
+	err := eachField(b, func(f field) error {
+		if f.wire == wireBytes {
+			switch f.num {
+			case 1:
+				key = string(f.b)
+			case 2:
+				value = f.b
+			}
+		}
+		return nil
+	})
+	if err != nil || key == "" {
+		return err
+	}
+
+	var s string
+	var ok bool
+	err = eachField(value, func(f field) error {
+		switch {
+		case (f.num == 1 || f.num == 7) && f.wire == wireBytes: // string, bytes
+			s, ok = string(f.b), true
+		case f.num == 2 && f.wire == wireVarint: // bool
+			s, ok = strconv.FormatBool(f.v != 0), true
+		case f.num == 3 && f.wire == wireVarint: // int
+			s, ok = strconv.FormatInt(int64(f.v), 10), true
+		case f.num == 4 && f.wire == wireFixed64: // double
+			s, ok = strconv.FormatFloat(math.Float64frombits(f.v), 'f', -1, 64), true
+		}
+		return nil
+	})
+	if err == nil && ok {
+		tags[key] = s
+	}
+	return err
+}
@@ -2,6 +2,7 @@ package socket_listener
 
 import (
 	"bufio"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log"
@@ -28,6 +29,8 @@ type streamSocketListener struct {
 
 	connections    map[string]net.Conn
 	connectionsMtx sync.Mutex
+	// tlsConfig is set if the connections must be TLS terminated
+	tlsConfig *tls.Config
 }
 
 func (ssl *streamSocketListener) listen() {
@@ -54,6 +57,10 @@ func (ssl *streamSocketListener) listen() {
 		if err := ssl.setKeepAlive(c); err != nil {
 			ssl.AddError(fmt.Errorf("unable to configure keep alive (%s): %s", ssl.ServiceAddress, err))
 		}
+		if ssl.tlsConfig != nil {
+			// the handshake is done by the first read of the connection
+			c = tls.Server(c, ssl.tlsConfig)
+		}
 
 		go ssl.read(c)
 	}
@@ -93,6 +100,9 @@ func (ssl *streamSocketListener) read(c net.Conn) {
 	defer c.Close()
 
 	scnr := bufio.NewScanner(c)
+	if s, ok := ssl.Parser.(parsers.Splitter); ok {
+		scnr.Split(s.Split)
+	}
 	for {
 		if ssl.ReadTimeout != nil && ssl.ReadTimeout.Duration > 0 {
 			c.SetReadDeadline(time.Now().Add(ssl.ReadTimeout.Duration))
@@ -112,7 +122,7 @@ func (ssl *streamSocketListener) read(c net.Conn) {
 	}
 
 	if err := scnr.Err(); err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
 			log.Printf("D! Timeout in plugin [input.socket_listener]: %s", err)
 		} else if !strings.HasSuffix(err.Error(), ": use of closed network connection") {
 			ssl.AddError(err)
@@ -155,6 +165,12 @@ type SocketListener struct {
 	ReadTimeout     *internal.Duration
 	KeepAlivePeriod *internal.Duration
 
+	// Path to the TLS certificate and key of the listener and to the CAs
+	// client certificates must be signed by.
+	SSLCert             string   `toml:"ssl_cert"`
+	SSLKey              string   `toml:"ssl_key"`
+	SSLAllowedClientCAs []string `toml:"ssl_allowed_client_ca"`
+
 	parsers.Parser
 	telegraf.Accumulator
 	io.Closer
@@ -200,6 +216,13 @@ func (sl *SocketListener) SampleConfig() string {
   ## Defaults to the OS configuration.
   # keep_alive_period = "5m"
 
+  ## TLS certificate and key, enables TLS on stream sockets (e.g. TCP).
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+
+  ## If set, clients must present a certificate signed by one of these CAs.
+  # ssl_allowed_client_ca = ["/etc/telegraf/clientca.pem"]
+
   ## Data format to consume.
   ## Each data format has its own unique set of configuration options, read
   ## more about them here:
@@ -230,6 +253,11 @@ func (sl *SocketListener) Start(acc telegraf.Accumulator) error {
 		os.Remove(spl[1])
 	}
 
+	tlsConfig, err := internal.GetServerTLSConfig(sl.SSLCert, sl.SSLKey, sl.SSLAllowedClientCAs)
+	if err != nil {
+		return err
+	}
+
 	switch spl[0] {
 	case "tcp", "tcp4", "tcp6", "unix", "unixpacket":
 		l, err := net.Listen(spl[0], spl[1])
@@ -248,11 +276,16 @@ func (sl *SocketListener) Start(acc telegraf.Accumulator) error {
 		ssl := &streamSocketListener{
 			Listener:       l,
 			SocketListener: sl,
+			tlsConfig:      tlsConfig,
 		}
 
 		sl.Closer = ssl
 		go ssl.listen()
 	case "udp", "udp4", "udp6", "ip", "ip4", "ip6", "unixgram":
+		if tlsConfig != nil {
+			return fmt.Errorf("TLS is not supported on %s sockets", spl[0])
+		}
+
 		pc, err := net.ListenPacket(spl[0], spl[1])
 		if err != nil {
 			return err
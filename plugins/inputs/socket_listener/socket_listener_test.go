@@ -1,11 +1,18 @@
 package socket_listener
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
 	"net"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/parsers"
+	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -26,6 +33,58 @@ func TestSocketListener_tcp(t *testing.T) {
 	testSocketListener(t, sl, client)
 }
 
+func TestSocketListener_tls(t *testing.T) {
+	dir, err := ioutil.TempDir("", "socket_listener")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile, cert, err := testutil.WriteTLSCert(dir)
+	require.NoError(t, err)
+
+	sl := newSocketListener()
+	sl.ServiceAddress = "tcp://127.0.0.1:0"
+	sl.SSLCert = certFile
+	sl.SSLKey = keyFile
+	sl.SSLAllowedClientCAs = []string{certFile}
+
+	acc := &testutil.Accumulator{}
+	err = sl.Start(acc)
+	require.NoError(t, err)
+	defer sl.Stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	addr := sl.Closer.(net.Listener).Addr().String()
+
+	// the client certificate is required
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots})
+	if err == nil {
+		// TLS 1.3 clients only learn about the rejection on read
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	assert.Error(t, err)
+
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	client, err := tls.Dial("tcp", addr, &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert},
+	})
+	require.NoError(t, err)
+
+	testSocketListener(t, sl, client)
+}
+
+func TestSocketListener_udpTLS(t *testing.T) {
+	sl := newSocketListener()
+	sl.ServiceAddress = "udp://127.0.0.1:0"
+	sl.SSLCert = "/etc/telegraf/cert.pem"
+
+	err := sl.Start(&testutil.Accumulator{})
+	assert.Error(t, err)
+}
+
 func TestSocketListener_udp(t *testing.T) {
 	sl := newSocketListener()
 	sl.ServiceAddress = "udp://127.0.0.1:0"
@@ -73,6 +132,41 @@ func TestSocketListener_unixgram(t *testing.T) {
 	testSocketListener(t, sl, client)
 }
 
+func TestSocketListener_tcpMsgpack(t *testing.T) {
+	sl := newSocketListener()
+	sl.ServiceAddress = "tcp://127.0.0.1:0"
+	sl.Parser, _ = parsers.NewMsgpackParser(nil)
+
+	acc := &testutil.Accumulator{}
+	err := sl.Start(acc)
+	require.NoError(t, err)
+	defer sl.Stop()
+
+	client, err := net.Dial("tcp", sl.Closer.(net.Listener).Addr().String())
+	require.NoError(t, err)
+
+	m1, _ := metric.New("test", map[string]string{"foo": "bar"},
+		map[string]interface{}{"v": int64(1)}, time.Unix(0, 123456789))
+	// a newline in a value must not split the message
+	m2, _ := metric.New("test", map[string]string{"foo": "b\naz"},
+		map[string]interface{}{"v": int64(10)}, time.Unix(0, 123456790))
+	s, _ := serializers.NewMsgpackSerializer()
+	for _, m := range []telegraf.Metric{m1, m2} {
+		buf, err := s.Serialize(m)
+		require.NoError(t, err)
+		// send the metrics in two writes to exercise the framing
+		client.Write(buf[:5])
+		time.Sleep(10 * time.Millisecond)
+		client.Write(buf[5:])
+	}
+
+	acc.Wait(2)
+	acc.AssertContainsTaggedFields(t, "test",
+		map[string]interface{}{"v": int64(1)}, map[string]string{"foo": "bar"})
+	acc.AssertContainsTaggedFields(t, "test",
+		map[string]interface{}{"v": int64(10)}, map[string]string{"foo": "b\naz"})
+}
+
 func testSocketListener(t *testing.T, sl *SocketListener, client net.Conn) {
 	mstr12 := "test,foo=bar v=1i 123456789\ntest,foo=baz v=2i 123456790\n"
 	mstr3 := "test,foo=zab v=3i 123456791"
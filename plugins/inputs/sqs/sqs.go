@@ -0,0 +1,259 @@
+package sqs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/influxdata/telegraf"
+	internalaws "github.com/influxdata/telegraf/internal/config/aws"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// attributeFields maps the queue attributes to the fields they are reported
+// as.
+var attributeFields = map[string]string{
+	sqs.QueueAttributeNameApproximateNumberOfMessages:           "messages_visible",
+	sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible: "messages_in_flight",
+	sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed:    "messages_delayed",
+}
+
+// SQS reports the depth of SQS queues, and optionally the age of their oldest
+// message, which is only published by CloudWatch.
+type SQS struct {
+	Region    string `toml:"region"`
+	AccessKey string `toml:"access_key"`
+	SecretKey string `toml:"secret_key"`
+	RoleARN   string `toml:"role_arn"`
+	Profile   string `toml:"profile"`
+	Filename  string `toml:"shared_credential_file"`
+	Token     string `toml:"token"`
+
+	Queues           []string `toml:"queues"`
+	OldestMessageAge bool     `toml:"oldest_message_age"`
+
+	sqs        sqsClient
+	cloudwatch cloudwatchClient
+
+	mu sync.Mutex
+	// urls caches the URLs of the queues configured by name
+	urls map[string]string
+}
+
+type sqsClient interface {
+	GetQueueUrl(*sqs.GetQueueUrlInput) (*sqs.GetQueueUrlOutput, error)
+	GetQueueAttributes(*sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error)
+}
+
+type cloudwatchClient interface {
+	GetMetricStatistics(*cloudwatch.GetMetricStatisticsInput) (*cloudwatch.GetMetricStatisticsOutput, error)
+}
+
+var sampleConfig = `
+  ## Amazon Region (required)
+  region = "us-east-1"
+
+  ## Amazon Credentials
+  ## Credentials are loaded in the following order
+  ## 1) Assumed credentials via STS if role_arn is specified
+  ## 2) explicit credentials from 'access_key' and 'secret_key'
+  ## 3) shared profile from 'profile'
+  ## 4) environment variables
+  ## 5) shared credentials file
+  ## 6) EC2 Instance Profile
+  #access_key = ""
+  #secret_key = ""
+  #token = ""
+  #role_arn = ""
+  #profile = ""
+  #shared_credential_file = ""
+
+  ## Queues to monitor, by name or by URL. The URL is required for the
+  ## queues of other accounts.
+  queues = ["jobs"]
+
+  ## Report the age of the oldest message in seconds. SQS only publishes it
+  ## to CloudWatch, at a one minute resolution and with a few minutes of
+  ## delay, and reading it requires the cloudwatch:GetMetricStatistics
+  ## permission.
+  # oldest_message_age = false
+`
+
+func (s *SQS) SampleConfig() string {
+	return sampleConfig
+}
+
+func (s *SQS) Description() string {
+	return "Read the depth of Amazon SQS queues"
+}
+
+func (s *SQS) Gather(acc telegraf.Accumulator) error {
+	if s.sqs == nil {
+		s.initializeClients()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(s.Queues))
+	for _, queue := range s.Queues {
+		go func(queue string) {
+			defer wg.Done()
+			acc.AddError(s.gatherQueue(acc, queue))
+		}(queue)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (s *SQS) initializeClients() {
+	credentialConfig := &internalaws.CredentialConfig{
+		Region:    s.Region,
+		AccessKey: s.AccessKey,
+		SecretKey: s.SecretKey,
+		RoleARN:   s.RoleARN,
+		Profile:   s.Profile,
+		Filename:  s.Filename,
+		Token:     s.Token,
+	}
+	configProvider := credentialConfig.Credentials()
+
+	s.sqs = sqs.New(configProvider)
+	if s.OldestMessageAge {
+		s.cloudwatch = cloudwatch.New(configProvider)
+	}
+}
+
+func (s *SQS) gatherQueue(acc telegraf.Accumulator, queue string) error {
+	name, url, err := s.queueURL(queue)
+	if err != nil {
+		return fmt.Errorf("could not find the SQS queue %s: %s", queue, err)
+	}
+
+	names := make([]*string, 0, len(attributeFields))
+	for attribute := range attributeFields {
+		names = append(names, aws.String(attribute))
+	}
+	resp, err := s.sqs.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(url),
+		AttributeNames: names,
+	})
+	if err != nil {
+		return fmt.Errorf("could not read the attributes of the SQS queue %s: %s", queue, err)
+	}
+
+	fields := make(map[string]interface{}, len(attributeFields)+1)
+	for attribute, field := range attributeFields {
+		value, ok := resp.Attributes[attribute]
+		if !ok || value == nil {
+			continue
+		}
+		n, err := strconv.ParseInt(*value, 10, 64)
+		if err != nil {
+			acc.AddError(fmt.Errorf("invalid %s of the SQS queue %s: %q",
+				attribute, queue, *value))
+			continue
+		}
+		fields[field] = n
+	}
+
+	if s.cloudwatch != nil {
+		age, ok, err := s.oldestMessageAge(name)
+		if err != nil {
+			acc.AddError(fmt.Errorf("could not read the age of the oldest message of the SQS queue %s: %s", queue, err))
+		} else if ok {
+			fields["oldest_message_age"] = age
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	tags := map[string]string{
+		"region": s.Region,
+		"queue":  name,
+	}
+	acc.AddFields("sqs", fields, tags)
+	return nil
+}
+
+// queueURL returns the name and the URL of a queue configured by name or by
+// URL, the URL of a name is looked up once.
+func (s *SQS) queueURL(queue string) (string, string, error) {
+	if strings.HasPrefix(queue, "https://") || strings.HasPrefix(queue, "http://") {
+		return queue[strings.LastIndex(queue, "/")+1:], queue, nil
+	}
+
+	s.mu.Lock()
+	url, ok := s.urls[queue]
+	s.mu.Unlock()
+	if ok {
+		return queue, url, nil
+	}
+
+	resp, err := s.sqs.GetQueueUrl(&sqs.GetQueueUrlInput{
+		QueueName: aws.String(queue),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if resp.QueueUrl == nil {
+		return "", "", fmt.Errorf("no URL returned")
+	}
+
+	s.mu.Lock()
+	if s.urls == nil {
+		s.urls = make(map[string]string)
+	}
+	s.urls[queue] = *resp.QueueUrl
+	s.mu.Unlock()
+	return queue, *resp.QueueUrl, nil
+}
+
+// oldestMessageAge returns the latest age of the oldest message of the queue
+// published to CloudWatch. ok is false when no value was published in the
+// last minutes, which is the case for the inactive queues.
+func (s *SQS) oldestMessageAge(name string) (age int64, ok bool, err error) {
+	now := time.Now()
+	resp, err := s.cloudwatch.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/SQS"),
+		MetricName: aws.String("ApproximateAgeOfOldestMessage"),
+		Dimensions: []*cloudwatch.Dimension{
+			{
+				Name:  aws.String("QueueName"),
+				Value: aws.String(name),
+			},
+		},
+		StartTime:  aws.Time(now.Add(-10 * time.Minute)),
+		EndTime:    aws.Time(now),
+		Period:     aws.Int64(60),
+		Statistics: []*string{aws.String(cloudwatch.StatisticMaximum)},
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	var latest *cloudwatch.Datapoint
+	for _, point := range resp.Datapoints {
+		if point.Maximum == nil || point.Timestamp == nil {
+			continue
+		}
+		if latest == nil || point.Timestamp.After(*latest.Timestamp) {
+			latest = point
+		}
+	}
+	if latest == nil {
+		return 0, false, nil
+	}
+	return int64(*latest.Maximum), true, nil
+}
+
+func init() {
+	inputs.Add("sqs", func() telegraf.Input {
+		return &SQS{}
+	})
+}
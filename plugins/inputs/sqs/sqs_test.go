@@ -0,0 +1,116 @@
+package sqs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockSQSClient struct {
+	lookups int
+}
+
+func (m *mockSQSClient) GetQueueUrl(params *sqs.GetQueueUrlInput) (*sqs.GetQueueUrlOutput, error) {
+	m.lookups++
+	if *params.QueueName != "jobs" {
+		return nil, fmt.Errorf("AWS.SimpleQueueService.NonExistentQueue")
+	}
+	return &sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://sqs.us-east-1.amazonaws.com/123456789012/jobs"),
+	}, nil
+}
+
+func (m *mockSQSClient) GetQueueAttributes(params *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error) {
+	return &sqs.GetQueueAttributesOutput{
+		Attributes: map[string]*string{
+			sqs.QueueAttributeNameApproximateNumberOfMessages:           aws.String("42"),
+			sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible: aws.String("3"),
+			sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed:    aws.String("0"),
+		},
+	}, nil
+}
+
+type mockCloudWatchClient struct{}
+
+func (m *mockCloudWatchClient) GetMetricStatistics(params *cloudwatch.GetMetricStatisticsInput) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	if *params.Dimensions[0].Value != "jobs" {
+		return &cloudwatch.GetMetricStatisticsOutput{}, nil
+	}
+	return &cloudwatch.GetMetricStatisticsOutput{
+		Datapoints: []*cloudwatch.Datapoint{
+			{
+				Timestamp: aws.Time(params.EndTime.Add(-3 * time.Minute)),
+				Maximum:   aws.Float64(120),
+			},
+			{
+				Timestamp: aws.Time(params.EndTime.Add(-2 * time.Minute)),
+				Maximum:   aws.Float64(180),
+			},
+			{
+				Timestamp: aws.Time(params.EndTime.Add(-4 * time.Minute)),
+				Maximum:   aws.Float64(60),
+			},
+		},
+	}, nil
+}
+
+func TestGather(t *testing.T) {
+	client := &mockSQSClient{}
+	s := &SQS{
+		Region: "us-east-1",
+		Queues: []string{
+			"jobs",
+			"https://sqs.us-east-1.amazonaws.com/210987654321/events",
+		},
+		OldestMessageAge: true,
+		sqs:              client,
+		cloudwatch:       &mockCloudWatchClient{},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(s.Gather))
+
+	acc.AssertContainsTaggedFields(t, "sqs", map[string]interface{}{
+		"messages_visible":   int64(42),
+		"messages_in_flight": int64(3),
+		"messages_delayed":   int64(0),
+		"oldest_message_age": int64(180),
+	}, map[string]string{
+		"region": "us-east-1",
+		"queue":  "jobs",
+	})
+	// no age is published for the inactive queues
+	acc.AssertContainsTaggedFields(t, "sqs", map[string]interface{}{
+		"messages_visible":   int64(42),
+		"messages_in_flight": int64(3),
+		"messages_delayed":   int64(0),
+	}, map[string]string{
+		"region": "us-east-1",
+		"queue":  "events",
+	})
+
+	// the URL of a queue is looked up once
+	require.NoError(t, acc.GatherError(s.Gather))
+	assert.Equal(t, 1, client.lookups)
+}
+
+func TestGatherUnknownQueue(t *testing.T) {
+	s := &SQS{
+		Region: "us-east-1",
+		Queues: []string{"missing"},
+		sqs:    &mockSQSClient{},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, s.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	assert.Contains(t, acc.Errors[0].Error(), "missing")
+	assert.Empty(t, acc.Metrics)
+}
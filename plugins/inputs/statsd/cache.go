@@ -0,0 +1,249 @@
+package statsd
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/parsers/graphite"
+)
+
+// maxCachedBuckets is the maximum number of parsed buckets of a cache.
+const maxCachedBuckets = 10000
+
+// cache holds the metrics aggregated between two calls to Gather.
+// gauges and counters map measurement/tags hash -> field name -> metrics,
+// sets and timings map measurement/tags hash -> metrics.
+type cache struct {
+	gauges   map[string]cachedgauge
+	counters map[string]cachedcounter
+	sets     map[string]cachedset
+	timings  map[string]cachedtimings
+
+	// sample rates observed per measurement/metric type since last Gather
+	sampleRates map[string]cachedsamplerate
+
+	// raw timing observations since last Gather, and the number of
+	// observations dropped because of the raw timings limit
+	rawTimings        []rawtiming
+	rawTimingsDropped int
+
+	// metrics received in the line protocol since last Gather, only with
+	// influx_passthrough
+	passthrough []telegraf.Metric
+
+	// number of lines per first bucket component since last Gather whose
+	// bucket matched none of the templates, only with report_unmatched
+	unmatched map[string]int64
+
+	// time of the last Gather, counter rates are computed over the time
+	// elapsed since
+	lastGather time.Time
+
+	// the template parser is not safe for concurrent use, so every cache
+	// has its own
+	graphiteParser *graphite.GraphiteParser
+
+	// parsed buckets, kept across calls to Gather and emptied when they
+	// reach maxCachedBuckets
+	buckets map[string]*bucket
+}
+
+// reset empties the cache.
+func (c *cache) reset() {
+	c.gauges = make(map[string]cachedgauge)
+	c.counters = make(map[string]cachedcounter)
+	c.sets = make(map[string]cachedset)
+	c.timings = make(map[string]cachedtimings)
+	c.sampleRates = make(map[string]cachedsamplerate)
+	c.rawTimings = nil
+	c.rawTimingsDropped = 0
+	c.unmatched = make(map[string]int64)
+	c.passthrough = nil
+}
+
+// empty returns whether the cache holds nothing to report.
+func (c *cache) empty() bool {
+	return len(c.gauges) == 0 && len(c.counters) == 0 &&
+		len(c.sets) == 0 && len(c.timings) == 0 &&
+		len(c.sampleRates) == 0 && len(c.rawTimings) == 0 &&
+		c.rawTimingsDropped == 0 && len(c.passthrough) == 0 &&
+		len(c.unmatched) == 0
+}
+
+// countUnmatched counts a line whose bucket matched none of the templates,
+// by the first component of the bucket.
+func (c *cache) countUnmatched(bucket string) {
+	if c.unmatched == nil {
+		c.unmatched = make(map[string]int64)
+	}
+	prefix := strings.SplitN(bucket, ".", 2)[0]
+	c.unmatched[prefix]++
+}
+
+// addRawTiming records a timing observation to be reported as is, unless
+// the cache already holds limit of them.
+func (c *cache) addRawTiming(limit int, m metric) {
+	if limit > 0 && len(c.rawTimings) >= limit {
+		c.rawTimingsDropped++
+		return
+	}
+	tags := tagMap(m.tags)
+	tags["bucket"] = m.name
+	c.rawTimings = append(c.rawTimings, rawtiming{
+		field:      m.field,
+		value:      m.floatvalue,
+		samplerate: m.samplerate,
+		tags:       tags,
+		t:          time.Now(),
+	})
+}
+
+// merge adds the metrics of o to the cache. The lines of a bucket are always
+// parsed by the same worker, so o holds everything received for its buckets
+// since the last merge: counters, sets and timings are added, gauges are
+// replaced if they were set in o and incremented otherwise. The gauge stats
+// of o are offset by the previous value of gauges that were only
+// incremented.
+func (c *cache) merge(o *cache) {
+	for hash, og := range o.gauges {
+		g, ok := c.gauges[hash]
+		if !ok {
+			c.gauges[hash] = og
+			continue
+		}
+		for field, v := range og.fields {
+			prev, ok := g.fields[field].(float64)
+			if og.set[field] || !ok {
+				g.fields[field] = v
+				prev = 0
+			} else {
+				g.fields[field] = prev + v.(float64)
+			}
+
+			ost, ok := og.stats[field]
+			if !ok {
+				continue
+			}
+			st, ok := g.stats[field]
+			if !ok {
+				g.stats[field] = &gaugestats{
+					min:   ost.min + prev,
+					max:   ost.max + prev,
+					count: ost.count,
+				}
+				continue
+			}
+			if ost.min+prev < st.min {
+				st.min = ost.min + prev
+			}
+			if ost.max+prev > st.max {
+				st.max = ost.max + prev
+			}
+			st.count += ost.count
+		}
+	}
+
+	for hash, oc := range o.counters {
+		cc, ok := c.counters[hash]
+		if !ok {
+			c.counters[hash] = oc
+			continue
+		}
+		for field, v := range oc.fields {
+			prev, _ := cc.fields[field].(int64)
+			cc.fields[field] = prev + v.(int64)
+		}
+	}
+
+	for hash, os := range o.sets {
+		cs, ok := c.sets[hash]
+		if !ok {
+			c.sets[hash] = os
+			continue
+		}
+		for field, values := range os.fields {
+			if _, ok := cs.fields[field]; !ok {
+				cs.fields[field] = values
+				continue
+			}
+			for v := range values {
+				cs.fields[field][v] = true
+			}
+		}
+	}
+
+	for hash, ot := range o.timings {
+		ct, ok := c.timings[hash]
+		if !ok {
+			c.timings[hash] = ot
+			continue
+		}
+		for field, stats := range ot.fields {
+			cstats := ct.fields[field]
+			cstats.Merge(&stats)
+			ct.fields[field] = cstats
+		}
+	}
+
+	for key, or := range o.sampleRates {
+		cr, ok := c.sampleRates[key]
+		if !ok {
+			c.sampleRates[key] = or
+			continue
+		}
+		cr.count += or.count
+		cr.sum += or.sum
+		if or.min < cr.min {
+			cr.min = or.min
+		}
+		if or.max > cr.max {
+			cr.max = or.max
+		}
+		cr.clamped += or.clamped
+		cr.rejected += or.rejected
+		c.sampleRates[key] = cr
+	}
+
+	for prefix, count := range o.unmatched {
+		if c.unmatched == nil {
+			c.unmatched = make(map[string]int64)
+		}
+		c.unmatched[prefix] += count
+	}
+
+	c.passthrough = append(c.passthrough, o.passthrough...)
+	c.rawTimings = append(c.rawTimings, o.rawTimings...)
+	c.rawTimingsDropped += o.rawTimingsDropped
+}
+
+// shard is the cache of a parser worker.
+type shard struct {
+	sync.Mutex
+	cache
+}
+
+// take empties the shard and returns the metrics it held. Only the maps are
+// swapped under the lock, the worker goes on parsing while they are merged.
+// The parsed buckets and the template parser stay with the shard.
+func (sh *shard) take() *cache {
+	sh.Lock()
+	defer sh.Unlock()
+	c := sh.cache
+	sh.reset()
+	return &c
+}
+
+// shardOf returns the worker that parses the given line, the lines of a
+// bucket always go to the same worker.
+func shardOf(line string, n int) int {
+	bucket := line
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		bucket = line[:i]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(bucket))
+	return int(h.Sum32() % uint32(n))
+}
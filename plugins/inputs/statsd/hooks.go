@@ -0,0 +1,145 @@
+package statsd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultFlushWebhookTimeout = 5 * time.Second
+
+// FlushStats summarizes a Gather, it is passed to the flush hooks so that
+// the ingest tier can be scaled on the load reported by the agents.
+type FlushStats struct {
+	Time time.Time `json:"time"`
+	// Address is the service address of the input.
+	Address string `json:"address"`
+	// Number of series gathered, per statsd type.
+	Counters int `json:"counters"`
+	Gauges   int `json:"gauges"`
+	Sets     int `json:"sets"`
+	Timings  int `json:"timings"`
+	// Passthrough is the number of line protocol metrics passed through.
+	Passthrough int `json:"passthrough"`
+	// Lines that could not be parsed, and packets dropped because the queue
+	// was full or over the rate limit, since the previous Gather.
+	ParseErrors    int64 `json:"parse_errors"`
+	PacketsDropped int64 `json:"packets_dropped"`
+	PacketsLimited int64 `json:"packets_rate_limited"`
+	// PendingMessages is the number of packets waiting to be parsed.
+	PendingMessages int `json:"pending_messages"`
+}
+
+// FlushHook is called after each Gather, it must not block.
+type FlushHook func(FlushStats)
+
+// flushHooks are the hooks of an input, they can be added and removed while
+// it is running.
+type flushHooks struct {
+	sync.Mutex
+	next  int
+	hooks map[int]FlushHook
+
+	parseErrors int64
+	// totals of the previous Gather, to report the increases
+	dropped int64
+	limited int64
+}
+
+// AddFlushHook adds a hook called after each Gather, the returned function
+// removes it.
+func (s *Statsd) AddFlushHook(hook FlushHook) (remove func()) {
+	s.flushHooks.Lock()
+	defer s.flushHooks.Unlock()
+	if s.flushHooks.hooks == nil {
+		s.flushHooks.hooks = make(map[int]FlushHook)
+	}
+	id := s.flushHooks.next
+	s.flushHooks.next++
+	s.flushHooks.hooks[id] = hook
+	return func() {
+		s.flushHooks.Lock()
+		defer s.flushHooks.Unlock()
+		delete(s.flushHooks.hooks, id)
+	}
+}
+
+// countParseError counts a line that could not be parsed.
+func (s *Statsd) countParseError(err error) {
+	if err != nil {
+		s.flushHooks.Lock()
+		s.flushHooks.parseErrors++
+		s.flushHooks.Unlock()
+	}
+}
+
+// flushed completes the stats of a Gather and calls the hooks.
+func (s *Statsd) flushed(stats FlushStats) {
+	h := &s.flushHooks
+	h.Lock()
+	stats.Address = s.ServiceAddress.String()
+	stats.ParseErrors = h.parseErrors
+	h.parseErrors = 0
+	if s.PacketsDropped != nil {
+		dropped, limited := s.PacketsDropped.Get(), s.PacketsLimited.Get()
+		stats.PacketsDropped = dropped - h.dropped
+		stats.PacketsLimited = limited - h.limited
+		h.dropped, h.limited = dropped, limited
+	}
+	stats.PendingMessages = len(s.in)
+	hooks := make([]FlushHook, 0, len(h.hooks))
+	for _, hook := range h.hooks {
+		hooks = append(hooks, hook)
+	}
+	h.Unlock()
+
+	for _, hook := range hooks {
+		hook(stats)
+	}
+}
+
+// webhook returns the hook posting the stats to the FlushWebhook as JSON.
+// A post still in progress when the next Gather completes is not waited
+// for, that Gather is not posted.
+func (s *Statsd) webhook() FlushHook {
+	timeout := s.FlushWebhookTimeout.Duration
+	if timeout == 0 {
+		timeout = defaultFlushWebhookTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	var posting int32
+	return func(stats FlushStats) {
+		if !atomic.CompareAndSwapInt32(&posting, 0, 1) {
+			log.Printf("W! Statsd flush webhook %s is still in progress, "+
+				"skipping the stats of %s\n", s.FlushWebhook, stats.Time)
+			return
+		}
+		go func() {
+			defer atomic.StoreInt32(&posting, 0)
+			if err := postStats(client, s.FlushWebhook, stats); err != nil {
+				log.Printf("E! Statsd flush webhook: %s\n", err)
+			}
+		}()
+	}
+}
+
+func postStats(client *http.Client, url string, stats FlushStats) error {
+	body, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned HTTP status %s", url, resp.Status)
+	}
+	return nil
+}
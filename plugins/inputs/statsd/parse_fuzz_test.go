@@ -0,0 +1,373 @@
+package statsd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The line parser was rewritten to slice the line rather than split it,
+// these tests compare it to the previous implementation on random lines.
+
+// fuzzTokens are the pieces the random lines are made of.
+var fuzzTokens = []string{
+	"cpu", "a.b", "x-y", "foo.bar.baz", ":", ":", "|", "|", "|", ",", ",", "=",
+	"#", "@", "1", "-2", "+3", "0.5", "1e3", "abc", "c", "g", "ms", "h", "s",
+	"@0.1", "@2", "@x", "|#", "host:a", "env=prod", " ", "\\", "", "é",
+}
+
+// fuzzLine returns a random line, mostly valid.
+func fuzzLine(r *rand.Rand) string {
+	if r.Intn(3) == 0 {
+		var b bytes.Buffer
+		for i := r.Intn(12); i >= 0; i-- {
+			b.WriteString(fuzzTokens[r.Intn(len(fuzzTokens))])
+		}
+		return b.String()
+	}
+
+	pick := func(list ...string) string {
+		return list[r.Intn(len(list))]
+	}
+	line := pick("cpu", "a.b.c", "mem-free.x", "a.b,host=x", "a,x=1,y=2=3,,z", "#a")
+	for i := r.Intn(2); i >= 0; i-- {
+		line += ":" + pick("1", "-1", "+2.5", "3.7", "abc", "", "10") +
+			"|" + pick("c", "g", "ms", "h", "s", "x", "")
+		if r.Intn(2) == 0 {
+			line += "|" + pick("@0.5", "@0.01", "@2", "@", "0.5", "@abc", "#t:v")
+		}
+	}
+	if r.Intn(2) == 0 {
+		line += "|#" + pick("country:china,env:prod", "novalue", "a:b:c", ",k:", ":v")
+	}
+	return line
+}
+
+func TestParseLineFuzz(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	configs := []func(s *Statsd){
+		func(s *Statsd) {},
+		func(s *Statsd) { s.ParseDataDogTags = true },
+		func(s *Statsd) {
+			s.ParseDataDogTags = true
+			s.Templates = []string{"measurement.field", "a.* measurement.host.field"}
+		},
+		func(s *Statsd) {
+			s.ConvertNames = true
+			s.SampleRateStats = true
+			s.MinSampleRate = 0.05
+			s.SampleRatePolicy = sampleRateReject
+		},
+		func(s *Statsd) { s.ReportUnmatched = true; s.Templates = []string{"cpu measurement"} },
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for ci, configure := range configs {
+		actual, expected := NewTestStatsd(), NewTestStatsd()
+		configure(actual)
+		configure(expected)
+		for i := 0; i < 5000; i++ {
+			line := fuzzLine(r)
+			err := actual.parseLine(&actual.cache, line)
+			expectedErr := expected.legacyParseLine(&expected.cache, line)
+			require.Equal(t, expectedErr != nil, err != nil,
+				"config %d, line %q: %v, expected %v", ci, line, err, expectedErr)
+		}
+
+		actualAcc, expectedAcc := &testutil.Accumulator{}, &testutil.Accumulator{}
+		require.NoError(t, actual.Gather(actualAcc))
+		require.NoError(t, expected.Gather(expectedAcc))
+		assert.Equal(t, sortedMetrics(expectedAcc), sortedMetrics(actualAcc),
+			"config %d", ci)
+	}
+}
+
+func BenchmarkParseLine(b *testing.B) {
+	benchmarkParseLine(b, (*Statsd).parseLine)
+}
+
+func BenchmarkLegacyParseLine(b *testing.B) {
+	benchmarkParseLine(b, (*Statsd).legacyParseLine)
+}
+
+func benchmarkParseLine(b *testing.B, parse func(*Statsd, *cache, string) error) {
+	s := NewTestStatsd()
+	s.ParseDataDogTags = true
+	lines := []string{
+		"test.timing.success:1|ms",
+		"test.counter,host=a,region=eu:11|c|@0.5",
+		"users.online:1|c|@0.5|#country:china,environment:production",
+		"test.gauge:+3.5|g",
+		"test.set,host=b:user42|s",
+	}
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		for _, line := range lines {
+			if err := parse(s, &s.cache, line); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// sortedMetrics returns the gathered metrics as sorted strings.
+func sortedMetrics(acc *testutil.Accumulator) []string {
+	var out []string
+	for _, m := range acc.Metrics {
+		out = append(out, fmt.Sprintf("%s %v %v", m.Measurement, m.Tags, m.Fields))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *Statsd) legacyParseLine(c *cache, line string) error {
+	if s.InfluxPassthrough && isInfluxLine(line) {
+		m, err := s.influxParser.ParseLine(line)
+		if err != nil {
+			log.Printf("E! Error: parsing line protocol: %s: %s\n", err, line)
+			return errors.New("Error Parsing statsd line")
+		}
+		c.passthrough = append(c.passthrough, m)
+		return nil
+	}
+
+	lineTags := make(map[string]string)
+	if s.ParseDataDogTags {
+		recombinedSegments := make([]string, 0)
+		// datadog tags look like this:
+		// users.online:1|c|@0.5|#country:china,environment:production
+		// users.online:1|c|#sometagwithnovalue
+		// we will split on the pipe and remove any elements that are datadog
+		// tags, parse them, and rebuild the line sans the datadog tags
+		pipesplit := strings.Split(line, "|")
+		for _, segment := range pipesplit {
+			if len(segment) > 0 && segment[0] == '#' {
+				// we have ourselves a tag; they are comma separated
+				tagstr := segment[1:]
+				tags := strings.Split(tagstr, ",")
+				for _, tag := range tags {
+					ts := strings.SplitN(tag, ":", 2)
+					var k, v string
+					switch len(ts) {
+					case 1:
+						// just a tag
+						k = ts[0]
+						v = ""
+					case 2:
+						k = ts[0]
+						v = ts[1]
+					}
+					if k != "" {
+						lineTags[k] = v
+					}
+				}
+			} else {
+				recombinedSegments = append(recombinedSegments, segment)
+			}
+		}
+		line = strings.Join(recombinedSegments, "|")
+	}
+
+	// Validate splitting the line on ":"
+	bits := strings.Split(line, ":")
+	if len(bits) < 2 {
+		log.Printf("E! Error: splitting ':', Unable to parse metric: %s\n", line)
+		return errors.New("Error Parsing statsd line")
+	}
+
+	// Extract bucket name from individual metric bits
+	bucketName, bits := bits[0], bits[1:]
+
+	if s.ReportUnmatched {
+		name := strings.SplitN(bucketName, ",", 2)[0]
+		if p := s.templateParser(c); p != nil && !p.Matches(name) {
+			c.countUnmatched(name)
+			return nil
+		}
+	}
+
+	// Add a metric for each bit available
+	for _, bit := range bits {
+		m := metric{}
+		var observedRate float64
+		var clamped, rejected bool
+
+		m.bucket = bucketName
+
+		// Validate splitting the bit on "|"
+		pipesplit := strings.Split(bit, "|")
+		if len(pipesplit) < 2 {
+			log.Printf("E! Error: splitting '|', Unable to parse metric: %s\n", line)
+			return errors.New("Error Parsing statsd line")
+		} else if len(pipesplit) > 2 {
+			sr := pipesplit[2]
+			errmsg := "E! Error: parsing sample rate, %s, it must be in format like: " +
+				"@0.1, @0.5, etc. Ignoring sample rate for line: %s\n"
+			if strings.Contains(sr, "@") && len(sr) > 1 {
+				samplerate, err := strconv.ParseFloat(sr[1:], 64)
+				if err != nil {
+					log.Printf(errmsg, err.Error(), line)
+				} else {
+					// sample rate successfully parsed
+					observedRate = samplerate
+					m.samplerate, clamped, rejected = s.checkSampleRate(samplerate)
+				}
+			} else {
+				log.Printf(errmsg, "", line)
+			}
+		}
+
+		// Validate metric type
+		switch pipesplit[1] {
+		case "g", "c", "s", "ms", "h":
+			m.mtype = pipesplit[1]
+		default:
+			log.Printf("E! Error: Statsd Metric type %s unsupported", pipesplit[1])
+			return errors.New("Error Parsing statsd line")
+		}
+
+		// Parse the value
+		if strings.HasPrefix(pipesplit[0], "-") || strings.HasPrefix(pipesplit[0], "+") {
+			if m.mtype != "g" && m.mtype != "c" {
+				log.Printf("E! Error: +- values are only supported for gauges & counters: %s\n", line)
+				return errors.New("Error Parsing statsd line")
+			}
+			m.additive = true
+		}
+
+		switch m.mtype {
+		case "g", "ms", "h":
+			v, err := strconv.ParseFloat(pipesplit[0], 64)
+			if err != nil {
+				log.Printf("E! Error: parsing value to float64: %s\n", line)
+				return errors.New("Error Parsing statsd line")
+			}
+			m.floatvalue = v
+		case "c":
+			var v int64
+			v, err := strconv.ParseInt(pipesplit[0], 10, 64)
+			if err != nil {
+				v2, err2 := strconv.ParseFloat(pipesplit[0], 64)
+				if err2 != nil {
+					log.Printf("E! Error: parsing value to int64: %s\n", line)
+					return errors.New("Error Parsing statsd line")
+				}
+				v = int64(v2)
+			}
+			// If a sample rate is given with a counter, divide value by the rate
+			if m.samplerate != 0 && m.mtype == "c" {
+				v = int64(float64(v) / m.samplerate)
+			}
+			m.intvalue = v
+		case "s":
+			m.strvalue = pipesplit[0]
+		}
+
+		// Parse the name & tags from bucket
+		var tags map[string]string
+		m.name, m.field, tags = s.legacyParseBucket(c, m.bucket)
+		if !s.OmitMetricTypeTag {
+			tag := s.MetricTypeTag
+			if tag == "" {
+				tag = defaultMetricTypeTag
+			}
+			tags[tag] = metricTypes[m.mtype]
+		}
+
+		if len(lineTags) > 0 {
+			for k, v := range lineTags {
+				tags[k] = v
+			}
+		}
+		for k, v := range tags {
+			m.tags = append(m.tags, tag{key: k, value: v})
+		}
+		sortTags(m.tags)
+
+		if observedRate != 0 && s.SampleRateStats {
+			c.recordSampleRate(m, observedRate, clamped, rejected)
+		}
+		if rejected {
+			log.Printf("E! Error: implausible sample rate %v, dropping metric %s "+
+				"of line: %s\n", observedRate, bit, line)
+			continue
+		}
+
+		// Make a unique key for the measurement name/tags
+		var tg []string
+		for k, v := range tags {
+			tg = append(tg, k+"="+v)
+		}
+		sort.Strings(tg)
+		tg = append(tg, m.name)
+		m.hash = strings.Join(tg, "")
+
+		s.aggregate(c, m)
+	}
+
+	return nil
+}
+func (s *Statsd) legacyParseBucket(c *cache, bucket string) (string, string, map[string]string) {
+	tags := make(map[string]string)
+
+	bucketparts := strings.Split(bucket, ",")
+	// Parse out any tags in the bucket
+	if len(bucketparts) > 1 {
+		for _, btag := range bucketparts[1:] {
+			k, v := legacyParseKeyValue(btag)
+			if k != "" {
+				tags[k] = v
+			}
+		}
+	}
+
+	var field string
+	name := bucketparts[0]
+
+	if p := s.templateParser(c); p != nil {
+		p.DefaultTags = tags
+		name, tags, field, _ = p.ApplyTemplate(name)
+	}
+
+	if s.ConvertNames {
+		dash := s.ConvertNamesDash
+		if dash == "" {
+			dash = defaultConvertNamesDash
+		}
+		name = strings.Replace(name, ".", "_", -1)
+		name = strings.Replace(name, "-", dash, -1)
+	}
+	if field == "" {
+		field = defaultFieldName
+	}
+
+	return name, field, tags
+}
+func legacyParseKeyValue(keyvalue string) (string, string) {
+	var key, val string
+
+	split := strings.Split(keyvalue, "=")
+	// Must be exactly 2 to get anything meaningful out of them
+	if len(split) == 2 {
+		key = split[0]
+		val = split[1]
+	} else if len(split) == 1 {
+		val = split[0]
+	}
+
+	return key, val
+}
@@ -0,0 +1,84 @@
+package statsd
+
+import (
+	"sync"
+	"time"
+)
+
+// On SIGHUP telegraf stops every input and starts the ones of the new
+// configuration. The aggregation caches of a stopped statsd input are kept
+// in a handoff registry, keyed by protocol and service address, so that the
+// input replacing it picks them up: counters keep counting and values
+// received since the last Gather are not lost. Only the templates and
+// options of the new configuration are used.
+//
+// A stopped input cannot tell a reload from a shutdown, so the caches of
+// an input that no other input replaces expire after handoffTimeout.
+const handoffTimeout = time.Minute
+
+// handoffRegistry holds the caches handed off by the stopped inputs.
+type handoffRegistry struct {
+	sync.Mutex
+	caches map[string]handoff
+}
+
+type handoff struct {
+	cache
+	stopped time.Time
+}
+
+// defaultHandoffs is the registry of the inputs of the configurations, the
+// inputs created without a registry do not hand off their caches.
+var defaultHandoffs = &handoffRegistry{caches: make(map[string]handoff)}
+
+// expire removes the caches handed off for longer than handoffTimeout.
+func (r *handoffRegistry) expire(now time.Time) {
+	for key, h := range r.caches {
+		if now.Sub(h.stopped) > handoffTimeout {
+			delete(r.caches, key)
+		}
+	}
+}
+
+func (s *Statsd) handoffKey() string {
+	return s.Protocol + "://" + s.ServiceAddress.String()
+}
+
+// handOff stores the caches of the input for the next input started on the
+// same addresses. Empty caches are not stored.
+func (s *Statsd) handOff() {
+	if s.handoffs == nil || s.cache.empty() {
+		return
+	}
+	s.handoffs.Lock()
+	defer s.handoffs.Unlock()
+	now := time.Now()
+	s.handoffs.expire(now)
+	c := s.cache
+	// the template parser belongs to the configuration being replaced
+	c.graphiteParser = nil
+	s.handoffs.caches[s.handoffKey()] = handoff{cache: c, stopped: now}
+}
+
+// takeOver adopts the caches handed off by a previous input on the same
+// addresses, if any.
+func (s *Statsd) takeOver() bool {
+	if s.handoffs == nil {
+		return false
+	}
+	s.handoffs.Lock()
+	defer s.handoffs.Unlock()
+	s.handoffs.expire(time.Now())
+	key := s.handoffKey()
+	h, ok := s.handoffs.caches[key]
+	if !ok {
+		return false
+	}
+	delete(s.handoffs.caches, key)
+	c := h.cache
+	c.graphiteParser = s.graphiteParser
+	// the buckets were parsed with the previous templates
+	c.buckets = nil
+	s.cache = c
+	return true
+}
@@ -14,7 +14,7 @@ const defaultPercentileLimit = 1000
 //    https://en.wikipedia.org/wiki/Algorithms_for_calculating_variance
 type RunningStats struct {
 	k   float64
-	n   int64
+	n   float64
 	ex  float64
 	ex2 float64
 
@@ -24,6 +24,10 @@ type RunningStats struct {
 	perc      []float64
 	PercLimit int
 
+	// weights of the values in perc, only allocated once a value with a
+	// weight other than 1 has been added.
+	weights []float64
+
 	upper float64
 	lower float64
 
@@ -33,6 +37,13 @@ type RunningStats struct {
 }
 
 func (rs *RunningStats) AddValue(v float64) {
+	rs.AddWeightedValue(v, 1)
+}
+
+// AddWeightedValue adds a value that stands for w observations, ie a timing
+// sampled at a rate of 0.1 can be added once with a weight of 10 instead of
+// being added 10 times.
+func (rs *RunningStats) AddWeightedValue(v float64, w float64) {
 	// Whenever a value is added, the list is no longer sorted.
 	rs.sorted = false
 
@@ -47,9 +58,9 @@ func (rs *RunningStats) AddValue(v float64) {
 	}
 
 	// These are used for the running mean and variance
-	rs.n += 1
-	rs.ex += v - rs.k
-	rs.ex2 += (v - rs.k) * (v - rs.k)
+	rs.n += w
+	rs.ex += w * (v - rs.k)
+	rs.ex2 += w * (v - rs.k) * (v - rs.k)
 
 	// track upper and lower bounds
 	if v > rs.upper {
@@ -58,20 +69,79 @@ func (rs *RunningStats) AddValue(v float64) {
 		rs.lower = v
 	}
 
+	rs.addPercentile(v, w)
+}
+
+func (rs *RunningStats) addPercentile(v float64, w float64) {
+	if w != 1 && rs.weights == nil {
+		rs.weights = make([]float64, len(rs.perc), cap(rs.perc))
+		for i := range rs.weights {
+			rs.weights[i] = 1
+		}
+	}
+
 	if len(rs.perc) < rs.PercLimit {
 		rs.perc = append(rs.perc, v)
+		if rs.weights != nil {
+			rs.weights = append(rs.weights, w)
+		}
 	} else {
 		// Reached limit, choose random index to overwrite in the percentile array
-		rs.perc[rand.Intn(len(rs.perc))] = v
+		i := rand.Intn(len(rs.perc))
+		rs.perc[i] = v
+		if rs.weights != nil {
+			rs.weights[i] = w
+		}
+	}
+}
+
+// Merge adds the values of o, as if they had been added to rs.
+func (rs *RunningStats) Merge(o *RunningStats) {
+	if o.n == 0 {
+		return
+	}
+	if rs.n == 0 {
+		limit := rs.PercLimit
+		*rs = *o
+		rs.perc = append([]float64(nil), o.perc...)
+		if o.weights != nil {
+			rs.weights = append([]float64(nil), o.weights...)
+		}
+		if limit != 0 {
+			rs.PercLimit = limit
+		}
+		return
+	}
+	rs.sorted = false
+
+	// shift the sums of o to the reference value of rs
+	d := o.k - rs.k
+	rs.ex2 += o.ex2 + 2*d*o.ex + o.n*d*d
+	rs.ex += o.ex + o.n*d
+	rs.n += o.n
+
+	if o.upper > rs.upper {
+		rs.upper = o.upper
+	}
+	if o.lower < rs.lower {
+		rs.lower = o.lower
+	}
+
+	for i, v := range o.perc {
+		w := 1.0
+		if o.weights != nil {
+			w = o.weights[i]
+		}
+		rs.addPercentile(v, w)
 	}
 }
 
 func (rs *RunningStats) Mean() float64 {
-	return rs.k + rs.ex/float64(rs.n)
+	return rs.k + rs.ex/rs.n
 }
 
 func (rs *RunningStats) Variance() float64 {
-	return (rs.ex2 - (rs.ex*rs.ex)/float64(rs.n)) / float64(rs.n)
+	return (rs.ex2 - (rs.ex*rs.ex)/rs.n) / rs.n
 }
 
 func (rs *RunningStats) Stddev() float64 {
@@ -86,8 +156,10 @@ func (rs *RunningStats) Lower() float64 {
 	return rs.lower
 }
 
+// Count returns the number of observations, when weighted values have been
+// added this is the sum of the weights rounded to the nearest integer.
 func (rs *RunningStats) Count() int64 {
-	return rs.n
+	return int64(rs.n + 0.5)
 }
 
 func (rs *RunningStats) Percentile(n int) float64 {
@@ -95,6 +167,10 @@ func (rs *RunningStats) Percentile(n int) float64 {
 		n = 100
 	}
 
+	if rs.weights != nil {
+		return rs.weightedPercentile(n)
+	}
+
 	if !rs.sorted {
 		sort.Float64s(rs.perc)
 		rs.sorted = true
@@ -106,3 +182,39 @@ func (rs *RunningStats) Percentile(n int) float64 {
 	}
 	return rs.perc[i]
 }
+
+// weightedPercentile returns the smallest value for which the weights of all
+// values lower or equal to it make up at least n% of the total weight.
+func (rs *RunningStats) weightedPercentile(n int) float64 {
+	if !rs.sorted {
+		sort.Sort(byValue{rs})
+		rs.sorted = true
+	}
+
+	var total float64
+	for _, w := range rs.weights {
+		total += w
+	}
+
+	target := total * float64(n) / float64(100)
+	var cum float64
+	for i, w := range rs.weights {
+		cum += w
+		if cum > target {
+			return rs.perc[i]
+		}
+	}
+	return rs.perc[len(rs.perc)-1]
+}
+
+// byValue sorts the percentile values and their weights together.
+type byValue struct {
+	rs *RunningStats
+}
+
+func (b byValue) Len() int           { return len(b.rs.perc) }
+func (b byValue) Less(i, j int) bool { return b.rs.perc[i] < b.rs.perc[j] }
+func (b byValue) Swap(i, j int) {
+	b.rs.perc[i], b.rs.perc[j] = b.rs.perc[j], b.rs.perc[i]
+	b.rs.weights[i], b.rs.weights[j] = b.rs.weights[j], b.rs.weights[i]
+}
@@ -128,6 +128,32 @@ func TestRunningStats_PercentileLimit(t *testing.T) {
 	}
 }
 
+// Test that a weighted value counts as many times as its weight.
+func TestRunningStats_Weighted(t *testing.T) {
+	rs := RunningStats{}
+	rs.AddWeightedValue(10, 3)
+	rs.AddValue(2)
+
+	if rs.Count() != 4 {
+		t.Errorf("Expected %v, got %v", 4, rs.Count())
+	}
+	if rs.Mean() != 8 {
+		t.Errorf("Expected %v, got %v", 8, rs.Mean())
+	}
+	if rs.Variance() != 12 {
+		t.Errorf("Expected %v, got %v", 12, rs.Variance())
+	}
+	if rs.Percentile(50) != 10 {
+		t.Errorf("Expected %v, got %v", 10, rs.Percentile(50))
+	}
+	if rs.Percentile(20) != 2 {
+		t.Errorf("Expected %v, got %v", 2, rs.Percentile(20))
+	}
+	if len(rs.perc) != 2 {
+		t.Errorf("Expected %v, got %v", 2, len(rs.perc))
+	}
+}
+
 func fuzzyEqual(a, b, epsilon float64) bool {
 	if math.Abs(a-b) > epsilon {
 		return false
@@ -6,15 +6,20 @@ import (
 	"fmt"
 	"log"
 	"net"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/influxdata/toml"
+	"github.com/influxdata/toml/ast"
+
 	"github.com/influxdata/telegraf/plugins/parsers/graphite"
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/selfstat"
@@ -29,7 +34,21 @@ const (
 
 	defaultProtocol = "udp"
 
+	sampleRateAccept = "accept"
+	sampleRateClamp  = "clamp"
+	sampleRateReject = "reject"
+
+	overflowDropNewest = "drop_newest"
+	overflowDropOldest = "drop_oldest"
+	overflowBlock      = "block"
+
+	defaultRawTimingsMeasurement = "statsd_timing_raw"
+	defaultRawTimingsLimit       = 10000
+	defaultMinSampleRate         = 0.01
+
 	defaultSeparator           = "_"
+	defaultMetricTypeTag       = "metric_type"
+	defaultConvertNamesDash    = "__"
 	defaultAllowPendingMessage = 10000
 	MaxTCPConnections          = 250
 )
@@ -42,32 +61,96 @@ var malformedwarn = "E! Statsd over TCP has received %d malformed packets" +
 	" thus far."
 
 type Statsd struct {
+	// drops tracks the number of dropped metrics, updated atomically as
+	// the listeners drop packets concurrently. It comes first to be 64-bit
+	// aligned on 32-bit platforms.
+	drops int64
+
 	// Protocol used on listener - udp or tcp
 	Protocol string `toml:"protocol"`
 
-	// Address & Port to serve from
-	ServiceAddress string
+	// Addresses & Ports to serve from, each address gets its own listener
+	// but all of them feed the same parser and caches.
+	ServiceAddress AddressList
 
 	// Number of messages allowed to queue up in between calls to Gather. If this
 	// fills up, packets will get dropped until the next Gather interval is ran.
 	AllowedPendingMessages int
 
+	// MaxPacketsPerSecond limits the packets accepted by all listeners, 0 is
+	// unlimited.
+	MaxPacketsPerSecond int `toml:"max_packets_per_second"`
+	// OverflowPolicy is what to do with a packet when the queue is full or
+	// the rate limit is reached, one of "drop_newest", "drop_oldest" or
+	// "block".
+	OverflowPolicy string `toml:"overflow_policy"`
+
 	// Percentiles specifies the percentiles that will be calculated for timing
 	// and histogram stats.
 	Percentiles     []int
 	PercentileLimit int
 
+	// TimingSampleRateWeighting adds a sampled timing once, weighted by the
+	// inverse of its sample rate, instead of adding it 1/rate times.
+	TimingSampleRateWeighting bool
+
+	// MinSampleRate is the lowest sample rate that is considered plausible,
+	// rates below it (or above 1) are handled according to SampleRatePolicy.
+	MinSampleRate float64
+	// SampleRatePolicy is one of "accept", "clamp" or "reject"
+	SampleRatePolicy string
+	// SampleRateStats reports the sample rates observed for each bucket in
+	// the statsd_sample_rate measurement.
+	SampleRateStats bool
+
+	// RawTimings are glob patterns of the timing & histogram measurements
+	// whose observations are also reported one by one, in the
+	// RawTimingsMeasurement measurement.
+	RawTimings            []string `toml:"raw_timings"`
+	RawTimingsMeasurement string   `toml:"raw_timings_measurement"`
+	// RawTimingsLimit is the maximum number of raw observations reported
+	// per interval, 0 is unlimited.
+	RawTimingsLimit  int `toml:"raw_timings_limit"`
+	rawTimingsFilter filter.Filter
+
+	// FlushWebhook is the URL the FlushStats are posted to after each
+	// Gather, see AddFlushHook for the other hooks.
+	FlushWebhook        string            `toml:"flush_webhook"`
+	FlushWebhookTimeout internal.Duration `toml:"flush_webhook_timeout"`
+	flushHooks          flushHooks
+	removeWebhook       func()
+
 	DeleteGauges   bool
 	DeleteCounters bool
 	DeleteSets     bool
 	DeleteTimings  bool
-	ConvertNames   bool
+
+	// ConvertNames replaces the dots of the measurement names by
+	// underscores, and their dashes by ConvertNamesDash, as older versions
+	// did.
+	ConvertNames     bool   `toml:"convert_names"`
+	ConvertNamesDash string `toml:"convert_names_dash"`
+	// MetricTypeTag is the tag holding the statsd type of the metrics,
+	// "metric_type" if empty, OmitMetricTypeTag removes it.
+	MetricTypeTag     string `toml:"metric_type_tag"`
+	OmitMetricTypeTag bool   `toml:"omit_metric_type_tag"`
+
+	// GaugeStats adds the min, max and number of updates of every gauge
+	// field since the last Gather.
+	GaugeStats bool
+	// ReportCounterRate adds the increase per second of every counter field
+	// since the last Gather.
+	ReportCounterRate bool
 
 	// MetricSeparator is the separator between parts of the metric name.
 	MetricSeparator string
 	// This flag enables parsing of tags in the dogstatsd extention to the
 	// statsd protocol (http://docs.datadoghq.com/guides/dogstatsd/)
 	ParseDataDogTags bool
+	// InfluxPassthrough parses the lines in the InfluxDB line protocol and
+	// passes their metrics through as is, instead of rejecting them.
+	InfluxPassthrough bool `toml:"influx_passthrough"`
+	influxParser      influx.InfluxParser
 
 	// UDPPacketSize is deprecated, it's only here for legacy support
 	// we now always create 1 max size buffer and then copy only what we need
@@ -83,8 +166,10 @@ type Statsd struct {
 	// is an available bool in accept, then we are below the maximum and can
 	// accept the connection
 	accept chan bool
-	// drops tracks the number of dropped metrics.
-	drops int
+	// limiter enforces MaxPacketsPerSecond
+	limiter *packetLimiter
+	// shardIn feeds the lines of a packet to the parser workers
+	shardIn []chan []string
 	// malformed tracks the number of malformed packets
 	malformed int
 
@@ -92,28 +177,34 @@ type Statsd struct {
 	in   chan []byte
 	done chan struct{}
 
-	// Cache gauges, counters & sets so they can be aggregated as they arrive
-	// gauges and counters map measurement/tags hash -> field name -> metrics
-	// sets and timings map measurement/tags hash -> metrics
-	gauges   map[string]cachedgauge
-	counters map[string]cachedcounter
-	sets     map[string]cachedset
-	timings  map[string]cachedtimings
+	// Cache gauges, counters & sets so they can be aggregated as they arrive,
+	// the caches of the parser workers are merged into it on Gather.
+	cache
+
+	// handoffs keeps the caches across reloads, see handOff
+	handoffs *handoffRegistry
+
+	// ParserWorkers is the number of goroutines parsing lines, each with its
+	// own cache.
+	ParserWorkers int `toml:"parser_workers"`
+	shards        []*shard
 
 	// bucket -> influx templates
 	Templates []string
+	// ReportUnmatched counts the lines whose bucket matches none of the
+	// templates in the statsd_unmatched measurement, per first component of
+	// the bucket, instead of parsing them with the default template.
+	ReportUnmatched bool `toml:"report_unmatched"`
 
-	// Protocol listeners
-	UDPlistener *net.UDPConn
-	TCPlistener *net.TCPListener
+	// Protocol listeners, one per service address
+	UDPlisteners []*net.UDPConn
+	TCPlisteners []*net.TCPListener
 
 	// track current connections so we can close them in Stop()
 	conns map[string]*net.TCPConn
 
 	MaxTCPConnections int `toml:"max_tcp_connections"`
 
-	graphiteParser *graphite.GraphiteParser
-
 	acc telegraf.Accumulator
 
 	MaxConnections     selfstat.Stat
@@ -121,9 +212,20 @@ type Statsd struct {
 	TotalConnections   selfstat.Stat
 	PacketsRecv        selfstat.Stat
 	BytesRecv          selfstat.Stat
+	PacketsDropped     selfstat.Stat
+	PacketsLimited     selfstat.Stat
 }
 
 // One statsd metric, form is <bucket>:<value>|<mtype>|@<samplerate>
+// metricTypes maps the statsd types to the value of the metric type tag.
+var metricTypes = map[string]string{
+	"c":  "counter",
+	"g":  "gauge",
+	"s":  "set",
+	"ms": "timing",
+	"h":  "histogram",
+}
+
 type metric struct {
 	name       string
 	field      string
@@ -135,7 +237,8 @@ type metric struct {
 	mtype      string
 	additive   bool
 	samplerate float64
-	tags       map[string]string
+	// tags are sorted by key
+	tags []tag
 }
 
 type cachedset struct {
@@ -148,12 +251,44 @@ type cachedgauge struct {
 	name   string
 	fields map[string]interface{}
 	tags   map[string]string
+	// set tracks the fields that were set, rather than only incremented or
+	// decremented, since the gauge was cached.
+	set map[string]bool
+	// stats tracks the values the fields took since the last Gather, only
+	// with GaugeStats.
+	stats map[string]*gaugestats
+}
+
+type gaugestats struct {
+	min   float64
+	max   float64
+	count int64
+}
+
+// observe records the current value of field in the stats of the gauge.
+func (g cachedgauge) observe(field string) {
+	v := g.fields[field].(float64)
+	st, ok := g.stats[field]
+	if !ok {
+		g.stats[field] = &gaugestats{min: v, max: v, count: 1}
+		return
+	}
+	if v < st.min {
+		st.min = v
+	}
+	if v > st.max {
+		st.max = v
+	}
+	st.count++
 }
 
 type cachedcounter struct {
 	name   string
 	fields map[string]interface{}
 	tags   map[string]string
+	// reported holds the values of the fields at the last Gather, only used
+	// to compute rates when counters are not deleted.
+	reported map[string]int64
 }
 
 type cachedtimings struct {
@@ -162,6 +297,25 @@ type cachedtimings struct {
 	tags   map[string]string
 }
 
+// rawtiming is a single timing or histogram observation.
+type rawtiming struct {
+	field      string
+	value      float64
+	samplerate float64
+	tags       map[string]string
+	t          time.Time
+}
+
+type cachedsamplerate struct {
+	tags     map[string]string
+	count    int64
+	sum      float64
+	min      float64
+	max      float64
+	clamped  int64
+	rejected int64
+}
+
 func (_ *Statsd) Description() string {
 	return "Statsd UDP/TCP Server"
 }
@@ -173,7 +327,8 @@ const sampleConfig = `
   ## MaxTCPConnection - applicable when protocol is set to tcp (default=250)
   max_tcp_connections = 250
 
-  ## Address and port to host UDP listener on
+  ## Address and port to host UDP listener on, can also be a list of
+  ## addresses to listen on several ports at once, ie [":8125", ":8126"]
   service_address = ":8125"
 
   ## The following configuration options control when telegraf clears it's cache
@@ -181,8 +336,14 @@ const sampleConfig = `
   ## cache when the daemon is restarted.
   ## Reset gauges every interval (default=true)
   delete_gauges = true
+  ## Add the min and max values of gauges, and their number of updates,
+  ## during the interval (default=false)
+  # gauge_stats = false
   ## Reset counters every interval (default=true)
   delete_counters = true
+  ## Add a rate field to counters, their increase per second since the
+  ## previous interval (default=false)
+  # report_counter_rate = false
   ## Reset sets every interval (default=true)
   delete_sets = true
   ## Reset timings & histograms every interval (default=true)
@@ -194,24 +355,96 @@ const sampleConfig = `
   ## separator to use between elements of a statsd metric
   metric_separator = "_"
 
+  ## Compatibility with older versions, to keep the names of the series
+  ## when upgrading:
+  ## Replace the dots of the measurement names by underscores, and their
+  ## dashes by convert_names_dash, after the templates are applied.
+  # convert_names = false
+  # convert_names_dash = "__"
+  ## Tag holding the statsd type of the metrics: counter, gauge, set, timing
+  ## or histogram. omit_metric_type_tag removes it.
+  # metric_type_tag = "metric_type"
+  # omit_metric_type_tag = false
+
   ## Parses tags in the datadog statsd format
   ## http://docs.datadoghq.com/guides/dogstatsd/
   parse_data_dog_tags = false
 
+  ## Accept lines in the InfluxDB line protocol, recognized by their field
+  ## set after a space, and pass their metrics through unaggregated.
+  # influx_passthrough = false
+
   ## Statsd data translation templates, more info can be read here:
   ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_INPUT.md#graphite
   # templates = [
   #     "cpu.* measurement*"
   # ]
+  ## Do not parse the buckets matching none of the templates, only count
+  ## their lines in the statsd_unmatched measurement, tagged with the first
+  ## component of the bucket (default=false)
+  # report_unmatched = false
 
   ## Number of UDP messages allowed to queue up, once filled,
   ## the statsd server will start dropping packets
   allowed_pending_messages = 10000
 
+  ## Maximum number of packets per second accepted by all the listeners
+  ## together, 0 (default) is unlimited.
+  # max_packets_per_second = 0
+  ## What to do with a packet that is over the rate limit, or when the queue
+  ## of pending messages is full:
+  ##   drop_newest: drop the packet (default)
+  ##   drop_oldest: drop the oldest pending packet to make room, does not
+  ##                apply to the rate limit
+  ##   block:       wait, tcp clients are slowed down and udp packets pile up
+  ##                in the OS receive buffer
+  # overflow_policy = "drop_newest"
+
+  ## Number of goroutines parsing the received lines, each keeps its own
+  ## cache of metrics which are merged on every collection interval. The
+  ## lines of a bucket are always parsed by the same goroutine.
+  # parser_workers = 1
+
   ## Number of timing/histogram values to track per-measurement in the
   ## calculation of percentiles. Raising this limit increases the accuracy
   ## of percentiles but also increases the memory usage and cpu time.
   percentile_limit = 1000
+
+  ## Add sampled timings & histograms once, weighted by 1/sample_rate, rather
+  ## than repeating the value 1/sample_rate times. The count and percentiles
+  ## are computed from the weights, which greatly reduces the memory used by
+  ## heavily sampled timers.
+  timing_sample_rate_weighting = false
+
+  ## Sample rates below min_sample_rate or above 1 are implausible and can
+  ## inflate counters by orders of magnitude. sample_rate_policy decides what
+  ## to do with them:
+  ##   accept: use the sample rate as sent by the client (default)
+  ##   clamp:  use the nearest plausible sample rate instead
+  ##   reject: drop the metric
+  # min_sample_rate = 0.01
+  # sample_rate_policy = "accept"
+
+  ## Report the distribution of sample rates received for each bucket in the
+  ## statsd_sample_rate measurement.
+  # sample_rate_stats = false
+
+  ## Also report every observation of the timing & histogram measurements
+  ## matching these glob patterns, as its own metric in the
+  ## raw_timings_measurement measurement. Sampled observations are reported
+  ## once, with their sample rate, so that exact percentiles can be computed
+  ## downstream.
+  # raw_timings = ["api_*"]
+  # raw_timings_measurement = "statsd_timing_raw"
+  ## Maximum number of raw observations reported per interval, the others
+  ## are dropped. 0 is unlimited.
+  # raw_timings_limit = 10000
+
+  ## URL the summary of every collection is posted to as JSON: the number of
+  ## series gathered, of parse errors and of dropped packets, for instance to
+  ## scale the ingest tier on the load reported by the agents.
+  # flush_webhook = "http://localhost:8080/statsd"
+  # flush_webhook_timeout = "5s"
 `
 
 func (_ *Statsd) SampleConfig() string {
@@ -219,10 +452,28 @@ func (_ *Statsd) SampleConfig() string {
 }
 
 func (s *Statsd) Gather(acc telegraf.Accumulator) error {
+	stats := s.gather(acc)
+	s.flushed(stats)
+	return nil
+}
+
+func (s *Statsd) gather(acc telegraf.Accumulator) FlushStats {
 	s.Lock()
 	defer s.Unlock()
 	now := time.Now()
 
+	for _, sh := range s.shards {
+		s.cache.merge(sh.take())
+	}
+	stats := FlushStats{
+		Time:        now,
+		Counters:    len(s.counters),
+		Gauges:      len(s.gauges),
+		Sets:        len(s.sets),
+		Timings:     len(s.timings),
+		Passthrough: len(s.passthrough),
+	}
+
 	for _, metric := range s.timings {
 		// Defining a template to parse field names for timers allows us to split
 		// out multiple fields per timer. In this case we prefix each stat with the
@@ -251,18 +502,31 @@ func (s *Statsd) Gather(acc telegraf.Accumulator) error {
 	}
 
 	for _, metric := range s.gauges {
-		acc.AddFields(metric.name, metric.fields, metric.tags, now)
+		fields := metric.fields
+		if s.GaugeStats {
+			fields = metric.withStats()
+		}
+		acc.AddFields(metric.name, fields, metric.tags, now)
 	}
 	if s.DeleteGauges {
 		s.gauges = make(map[string]cachedgauge)
 	}
 
-	for _, metric := range s.counters {
-		acc.AddFields(metric.name, metric.fields, metric.tags, now)
+	var elapsed float64
+	if !s.lastGather.IsZero() {
+		elapsed = now.Sub(s.lastGather).Seconds()
+	}
+	for hash, metric := range s.counters {
+		fields := metric.fields
+		if s.ReportCounterRate && elapsed > 0 {
+			fields = s.counterRates(hash, metric, elapsed)
+		}
+		acc.AddFields(metric.name, fields, metric.tags, now)
 	}
 	if s.DeleteCounters {
 		s.counters = make(map[string]cachedcounter)
 	}
+	s.lastGather = now
 
 	for _, metric := range s.sets {
 		fields := make(map[string]interface{})
@@ -275,7 +539,120 @@ func (s *Statsd) Gather(acc telegraf.Accumulator) error {
 		s.sets = make(map[string]cachedset)
 	}
 
-	return nil
+	for _, rate := range s.sampleRates {
+		fields := map[string]interface{}{
+			"count":    rate.count,
+			"mean":     rate.sum / float64(rate.count),
+			"min":      rate.min,
+			"max":      rate.max,
+			"clamped":  rate.clamped,
+			"rejected": rate.rejected,
+		}
+		acc.AddFields("statsd_sample_rate", fields, rate.tags, now)
+	}
+	s.sampleRates = make(map[string]cachedsamplerate)
+
+	for prefix, count := range s.unmatched {
+		acc.AddFields("statsd_unmatched",
+			map[string]interface{}{"count": count},
+			map[string]string{"prefix": prefix}, now)
+	}
+	s.unmatched = make(map[string]int64)
+
+	s.gatherRawTimings(acc)
+
+	for _, m := range s.passthrough {
+		acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+	}
+	s.passthrough = nil
+
+	return stats
+}
+
+// gatherRawTimings adds the raw timing observations received since the last
+// Gather, up to RawTimingsLimit of them.
+func (s *Statsd) gatherRawTimings(acc telegraf.Accumulator) {
+	raw := s.rawTimings
+	dropped := s.rawTimingsDropped
+	if s.RawTimingsLimit > 0 && len(raw) > s.RawTimingsLimit {
+		dropped += len(raw) - s.RawTimingsLimit
+		raw = raw[:s.RawTimingsLimit]
+	}
+	for _, r := range raw {
+		rate := r.samplerate
+		if rate == 0 {
+			rate = 1
+		}
+		fields := map[string]interface{}{
+			r.field:       r.value,
+			"sample_rate": rate,
+		}
+		acc.AddFields(s.RawTimingsMeasurement, fields, r.tags, r.t)
+	}
+	if dropped > 0 {
+		log.Printf("W! Statsd dropped %d raw timings over raw_timings_limit "+
+			"during the last interval\n", dropped)
+	}
+	s.rawTimings = nil
+	s.rawTimingsDropped = 0
+}
+
+// counterRates returns the fields of a counter along with their increase per
+// second over elapsed seconds, in a "rate" field for the default field and a
+// "<field>_rate" field for the others.
+func (s *Statsd) counterRates(
+	hash string,
+	metric cachedcounter,
+	elapsed float64,
+) map[string]interface{} {
+	if !s.DeleteCounters && metric.reported == nil {
+		metric.reported = make(map[string]int64)
+		s.counters[hash] = metric
+	}
+
+	fields := make(map[string]interface{}, 2*len(metric.fields))
+	for name, v := range metric.fields {
+		value := v.(int64)
+		fields[name] = value
+
+		rateName := "rate"
+		if name != defaultFieldName {
+			rateName = name + "_rate"
+		}
+		// deleted counters have no reported values, their value is the
+		// increase since the last Gather
+		fields[rateName] = float64(value-metric.reported[name]) / elapsed
+		if metric.reported != nil {
+			metric.reported[name] = value
+		}
+	}
+	return fields
+}
+
+// withStats returns the fields of the gauge along with their min, max and
+// count since the last Gather, and starts a new interval from the current
+// values. Fields that were not updated have a count of 0.
+func (g cachedgauge) withStats() map[string]interface{} {
+	fields := make(map[string]interface{}, 4*len(g.fields))
+	for name, v := range g.fields {
+		fields[name] = v
+		value := v.(float64)
+
+		st, ok := g.stats[name]
+		if !ok {
+			st = &gaugestats{min: value, max: value}
+		}
+		var prefix string
+		if name != defaultFieldName {
+			prefix = name + "_"
+		}
+		fields[prefix+"min"] = st.min
+		fields[prefix+"max"] = st.max
+		fields[prefix+"count"] = st.count
+
+		g.stats[name] = &gaugestats{min: value, max: value}
+	}
+	return fields
 }
 
 func (s *Statsd) Start(_ telegraf.Accumulator) error {
@@ -283,16 +660,14 @@ func (s *Statsd) Start(_ telegraf.Accumulator) error {
 	s.done = make(chan struct{})
 	s.in = make(chan []byte, s.AllowedPendingMessages)
 
-	s.gauges = make(map[string]cachedgauge)
-	s.counters = make(map[string]cachedcounter)
-	s.sets = make(map[string]cachedset)
-	s.timings = make(map[string]cachedtimings)
-
 	s.Lock()
 	defer s.Unlock()
+
+	s.cache.reset()
+	s.lastGather = time.Now()
 	//
 	tags := map[string]string{
-		"address": s.ServiceAddress,
+		"address": s.ServiceAddress.String(),
 	}
 	s.MaxConnections = selfstat.Register("statsd", "tcp_max_connections", tags)
 	s.MaxConnections.Set(int64(s.MaxTCPConnections))
@@ -300,6 +675,8 @@ func (s *Statsd) Start(_ telegraf.Accumulator) error {
 	s.TotalConnections = selfstat.Register("statsd", "tcp_total_connections", tags)
 	s.PacketsRecv = selfstat.Register("statsd", "tcp_packets_received", tags)
 	s.BytesRecv = selfstat.Register("statsd", "tcp_bytes_received", tags)
+	s.PacketsDropped = selfstat.Register("statsd", "packets_dropped", tags)
+	s.PacketsLimited = selfstat.Register("statsd", "packets_rate_limited", tags)
 
 	s.in = make(chan []byte, s.AllowedPendingMessages)
 	s.done = make(chan struct{})
@@ -309,48 +686,162 @@ func (s *Statsd) Start(_ telegraf.Accumulator) error {
 		s.accept <- true
 	}
 
-	if s.ConvertNames {
-		log.Printf("I! WARNING statsd: convert_names config option is deprecated," +
-			" please use metric_separator instead")
-	}
-
 	if s.MetricSeparator == "" {
 		s.MetricSeparator = defaultSeparator
 	}
 
-	s.wg.Add(2)
-	// Start the UDP listener
-	switch s.Protocol {
-	case "udp":
-		go s.udpListen()
-	case "tcp":
-		go s.tcpListen()
+	switch s.OverflowPolicy {
+	case "":
+		s.OverflowPolicy = overflowDropNewest
+	case overflowDropNewest, overflowDropOldest, overflowBlock:
+	default:
+		return fmt.Errorf("statsd: invalid overflow_policy %q, must be one "+
+			"of drop_newest, drop_oldest or block", s.OverflowPolicy)
+	}
+	s.limiter = nil
+	if s.MaxPacketsPerSecond > 0 {
+		s.limiter = &packetLimiter{max: s.MaxPacketsPerSecond}
+	}
+
+	// Build the template parser now so that a bad template in a reloaded
+	// configuration is reported before any packet is parsed.
+	p, err := graphite.NewGraphiteParser(s.MetricSeparator, s.Templates, nil)
+	if err != nil {
+		return fmt.Errorf("statsd: invalid templates: %s", err)
+	}
+	s.graphiteParser = p
+
+	s.shards = nil
+	if s.ParserWorkers > 1 {
+		s.shards = make([]*shard, s.ParserWorkers)
+		s.shardIn = make([]chan []string, s.ParserWorkers)
+		for i := range s.shards {
+			s.shards[i] = &shard{}
+			s.shards[i].reset()
+			s.shardIn[i] = make(chan []string, 1)
+		}
+	}
+
+	s.rawTimingsFilter, err = filter.Compile(s.RawTimings)
+	if err != nil {
+		return fmt.Errorf("statsd: invalid raw_timings: %s", err)
+	}
+	if s.RawTimingsMeasurement == "" {
+		s.RawTimingsMeasurement = defaultRawTimingsMeasurement
+	}
+
+	if s.MinSampleRate <= 0 || s.MinSampleRate > 1 {
+		return fmt.Errorf("statsd: invalid min_sample_rate %v, must be "+
+			"greater than 0 and at most 1", s.MinSampleRate)
+	}
+	switch s.SampleRatePolicy {
+	case "":
+		s.SampleRatePolicy = sampleRateAccept
+	case sampleRateAccept, sampleRateClamp, sampleRateReject:
+	default:
+		return fmt.Errorf("statsd: invalid sample_rate_policy %q, must be one "+
+			"of accept, clamp or reject", s.SampleRatePolicy)
+	}
+
+	// the stats are shared by the inputs on the same addresses, the hooks
+	// get the increases since this input started
+	s.flushHooks.Lock()
+	s.flushHooks.dropped = s.PacketsDropped.Get()
+	s.flushHooks.limited = s.PacketsLimited.Get()
+	s.flushHooks.Unlock()
+	if s.FlushWebhook != "" && s.removeWebhook == nil {
+		s.removeWebhook = s.AddFlushHook(s.webhook())
+	}
+
+	// the caches are taken over once the options are valid, and handed
+	// back by abortStart if a listener cannot be bound
+	if s.takeOver() {
+		log.Printf("I! Statsd picked up the cached metrics of the previous "+
+			"configuration on %s\n", s.ServiceAddress)
 	}
-	// Start the line parser
+
+	// Bind every listener before starting any goroutine, so that a bad
+	// address is reported back to the agent.
+	for _, addr := range s.ServiceAddress {
+		switch s.Protocol {
+		case "tcp":
+			address, err := net.ResolveTCPAddr("tcp", addr)
+			if err != nil {
+				s.abortStart()
+				return fmt.Errorf("ResolveTCPAddr - %s", err)
+			}
+			listener, err := net.ListenTCP("tcp", address)
+			if err != nil {
+				s.abortStart()
+				return fmt.Errorf("ListenTCP - %s", err)
+			}
+			log.Println("I! TCP Statsd listening on: ", listener.Addr().String())
+			s.TCPlisteners = append(s.TCPlisteners, listener)
+		default:
+			address, err := net.ResolveUDPAddr("udp", addr)
+			if err != nil {
+				s.abortStart()
+				return fmt.Errorf("ResolveUDPAddr - %s", err)
+			}
+			listener, err := net.ListenUDP("udp", address)
+			if err != nil {
+				s.abortStart()
+				return fmt.Errorf("ListenUDP - %s", err)
+			}
+			log.Println("I! Statsd UDP listener listening on: ", listener.LocalAddr().String())
+			s.UDPlisteners = append(s.UDPlisteners, listener)
+		}
+	}
+
+	s.wg.Add(len(s.TCPlisteners) + len(s.UDPlisteners) + 1 + len(s.shards))
+	for _, listener := range s.TCPlisteners {
+		go s.tcpListen(listener)
+	}
+	for _, listener := range s.UDPlisteners {
+		go s.udpListen(listener)
+	}
+	// Start the line parser and its workers
 	go s.parser()
+	for i, sh := range s.shards {
+		go s.worker(sh, s.shardIn[i])
+	}
 	log.Printf("I! Started the statsd service on %s\n", s.ServiceAddress)
 	return nil
 }
 
-// tcpListen() starts listening for udp packets on the configured port.
-func (s *Statsd) tcpListen() error {
-	defer s.wg.Done()
-	// Start listener
-	var err error
-	address, _ := net.ResolveTCPAddr("tcp", s.ServiceAddress)
-	s.TCPlistener, err = net.ListenTCP("tcp", address)
-	if err != nil {
-		log.Fatalf("ERROR: ListenTCP - %s", err)
-		return err
+// abortStart releases what a failed Start acquired: the listeners already
+// bound, the flush webhook and the caches taken over.
+func (s *Statsd) abortStart() {
+	s.closeListeners()
+	s.TCPlisteners = nil
+	s.UDPlisteners = nil
+	if s.removeWebhook != nil {
+		s.removeWebhook()
+		s.removeWebhook = nil
 	}
-	log.Println("I! TCP Statsd listening on: ", s.TCPlistener.Addr().String())
+	s.handOff()
+}
+
+// closeListeners closes all of the protocol listeners.
+func (s *Statsd) closeListeners() {
+	for _, listener := range s.TCPlisteners {
+		listener.Close()
+	}
+	for _, listener := range s.UDPlisteners {
+		listener.Close()
+	}
+}
+
+// tcpListen accepts connections from the given listener.
+func (s *Statsd) tcpListen(listener *net.TCPListener) error {
+	defer s.wg.Done()
 	for {
 		select {
 		case <-s.done:
 			return nil
 		default:
 			// Accept connection:
-			conn, err := s.TCPlistener.AcceptTCP()
+			conn, err := listener.AcceptTCP()
 			if err != nil {
 				return err
 			}
@@ -371,46 +862,115 @@ func (s *Statsd) tcpListen() error {
 	}
 }
 
-// udpListen starts listening for udp packets on the configured port.
-func (s *Statsd) udpListen() error {
+// udpListen reads udp packets from the given listener.
+func (s *Statsd) udpListen(listener *net.UDPConn) error {
 	defer s.wg.Done()
-	var err error
-	address, _ := net.ResolveUDPAddr("udp", s.ServiceAddress)
-	s.UDPlistener, err = net.ListenUDP("udp", address)
-	if err != nil {
-		log.Fatalf("ERROR: ListenUDP - %s", err)
-	}
-	log.Println("I! Statsd UDP listener listening on: ", s.UDPlistener.LocalAddr().String())
-
 	buf := make([]byte, UDP_MAX_PACKET_SIZE)
 	for {
 		select {
 		case <-s.done:
 			return nil
 		default:
-			n, _, err := s.UDPlistener.ReadFromUDP(buf)
+			n, _, err := listener.ReadFromUDP(buf)
 			if err != nil && !strings.Contains(err.Error(), "closed network") {
 				log.Printf("E! Error READ: %s\n", err.Error())
 				continue
 			}
 			bufCopy := make([]byte, n)
 			copy(bufCopy, buf[:n])
+			s.enqueue(bufCopy)
+		}
+	}
+}
 
+// enqueue hands a packet over to the parser, applying the rate limit and
+// the overflow policy.
+func (s *Statsd) enqueue(packet []byte) {
+	if s.limiter != nil {
+		for {
+			ok, wait := s.limiter.allow()
+			if ok {
+				break
+			}
+			if s.OverflowPolicy != overflowBlock {
+				s.PacketsLimited.Incr(1)
+				return
+			}
 			select {
-			case s.in <- bufCopy:
+			case <-time.After(wait):
+			case <-s.done:
+				return
+			}
+		}
+	}
+
+	switch s.OverflowPolicy {
+	case overflowBlock:
+		select {
+		case s.in <- packet:
+		case <-s.done:
+		}
+	case overflowDropOldest:
+		for {
+			select {
+			case s.in <- packet:
+				return
+			default:
+			}
+			// make room, unless the parser just did
+			select {
+			case <-s.in:
+				s.drop()
 			default:
-				s.drops++
-				if s.drops == 1 || s.AllowedPendingMessages == 0 || s.drops%s.AllowedPendingMessages == 0 {
-					log.Printf(dropwarn, s.drops)
-				}
 			}
 		}
+	default:
+		select {
+		case s.in <- packet:
+		default:
+			s.drop()
+		}
 	}
 }
 
+func (s *Statsd) drop() {
+	drops := atomic.AddInt64(&s.drops, 1)
+	s.PacketsDropped.Incr(1)
+	if drops == 1 || s.AllowedPendingMessages == 0 || drops%int64(s.AllowedPendingMessages) == 0 {
+		log.Printf(dropwarn, drops)
+	}
+}
+
+// packetLimiter allows at most max packets per second.
+type packetLimiter struct {
+	sync.Mutex
+	max    int
+	window time.Time
+	count  int
+}
+
+// allow returns true if one more packet fits in the current second,
+// otherwise it returns how long to wait for the next one.
+func (l *packetLimiter) allow() (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	if now.Sub(l.window) >= time.Second {
+		l.window = now
+		l.count = 0
+	}
+	if l.count < l.max {
+		l.count++
+		return true, 0
+	}
+	return false, l.window.Add(time.Second).Sub(now)
+}
+
 // parser monitors the s.in channel, if there is a packet ready, it parses the
 // packet into statsd strings and then calls parseStatsdLine, which parses a
-// single statsd metric into a struct.
+// single statsd metric into a struct. With parser workers, the lines are
+// handed to the workers instead, the lines of a bucket always go to the same
+// worker.
 func (s *Statsd) parser() error {
 	defer s.wg.Done()
 	var packet []byte
@@ -420,12 +980,51 @@ func (s *Statsd) parser() error {
 			return nil
 		case packet = <-s.in:
 			lines := strings.Split(string(packet), "\n")
+			if len(s.shards) == 0 {
+				for _, line := range lines {
+					line = strings.TrimSpace(line)
+					if line != "" {
+						s.countParseError(s.parseStatsdLine(line))
+					}
+				}
+				continue
+			}
+
+			batches := make([][]string, len(s.shards))
 			for _, line := range lines {
 				line = strings.TrimSpace(line)
 				if line != "" {
-					s.parseStatsdLine(line)
+					i := shardOf(line, len(s.shards))
+					batches[i] = append(batches[i], line)
 				}
 			}
+			for i, batch := range batches {
+				if len(batch) == 0 {
+					continue
+				}
+				select {
+				case s.shardIn[i] <- batch:
+				case <-s.done:
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// worker parses the lines handed to it by the parser into its own cache.
+func (s *Statsd) worker(sh *shard, in chan []string) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.done:
+			return
+		case lines := <-in:
+			sh.Lock()
+			for _, line := range lines {
+				s.countParseError(s.parseLine(&sh.cache, line))
+			}
+			sh.Unlock()
 		}
 	}
 }
@@ -435,76 +1034,95 @@ func (s *Statsd) parser() error {
 func (s *Statsd) parseStatsdLine(line string) error {
 	s.Lock()
 	defer s.Unlock()
+	return s.parseLine(&s.cache, line)
+}
 
-	lineTags := make(map[string]string)
-	if s.ParseDataDogTags {
-		recombinedSegments := make([]string, 0)
-		// datadog tags look like this:
-		// users.online:1|c|@0.5|#country:china,environment:production
-		// users.online:1|c|#sometagwithnovalue
-		// we will split on the pipe and remove any elements that are datadog
-		// tags, parse them, and rebuild the line sans the datadog tags
-		pipesplit := strings.Split(line, "|")
-		for _, segment := range pipesplit {
-			if len(segment) > 0 && segment[0] == '#' {
-				// we have ourselves a tag; they are comma separated
-				tagstr := segment[1:]
-				tags := strings.Split(tagstr, ",")
-				for _, tag := range tags {
-					ts := strings.SplitN(tag, ":", 2)
-					var k, v string
-					switch len(ts) {
-					case 1:
-						// just a tag
-						k = ts[0]
-						v = ""
-					case 2:
-						k = ts[0]
-						v = ts[1]
-					}
-					if k != "" {
-						lineTags[k] = v
-					}
-				}
-			} else {
-				recombinedSegments = append(recombinedSegments, segment)
-			}
+// parseLine parses a statsd line into the given cache. The line is only
+// sliced, the strings of the metric share its memory.
+func (s *Statsd) parseLine(c *cache, line string) error {
+	if s.InfluxPassthrough && isInfluxLine(line) {
+		m, err := s.influxParser.ParseLine(line)
+		if err != nil {
+			log.Printf("E! Error: parsing line protocol: %s: %s\n", err, line)
+			return errors.New("Error Parsing statsd line")
 		}
-		line = strings.Join(recombinedSegments, "|")
+		c.passthrough = append(c.passthrough, m)
+		return nil
+	}
+
+	// datadog tags look like this:
+	// users.online:1|c|@0.5|#country:china,environment:production
+	// users.online:1|c|#sometagwithnovalue
+	// the segments of the line which are datadog tags are parsed and the
+	// line is rebuilt without them
+	var lineTagsArray [8]tag
+	lineTags := lineTagsArray[:0]
+	if s.ParseDataDogTags && (strings.HasPrefix(line, "#") || strings.Contains(line, "|#")) {
+		lineTags, line = parseDataDogTags(line, lineTags)
 	}
 
 	// Validate splitting the line on ":"
-	bits := strings.Split(line, ":")
-	if len(bits) < 2 {
+	i := strings.IndexByte(line, ':')
+	if i < 0 {
 		log.Printf("E! Error: splitting ':', Unable to parse metric: %s\n", line)
 		return errors.New("Error Parsing statsd line")
 	}
 
 	// Extract bucket name from individual metric bits
-	bucketName, bits := bits[0], bits[1:]
+	bucketName, bits := line[:i], line[i+1:]
+
+	if s.ReportUnmatched {
+		name := bucketName
+		if i := strings.IndexByte(name, ','); i >= 0 {
+			name = name[:i]
+		}
+		if p := s.templateParser(c); p != nil && !p.Matches(name) {
+			c.countUnmatched(name)
+			return nil
+		}
+	}
+
+	// Add a metric for each bit available, their tags are only copied to
+	// the heap for new entries of the cache
+	var tagsArray [16]tag
+	for more := true; more; {
+		var bit string
+		if i := strings.IndexByte(bits, ':'); i >= 0 {
+			bit, bits = bits[:i], bits[i+1:]
+		} else {
+			bit, more = bits, false
+		}
 
-	// Add a metric for each bit available
-	for _, bit := range bits {
 		m := metric{}
+		var observedRate float64
+		var clamped, rejected bool
 
 		m.bucket = bucketName
 
-		// Validate splitting the bit on "|"
-		pipesplit := strings.Split(bit, "|")
-		if len(pipesplit) < 2 {
+		// Validate splitting the bit on "|": the value, the type and the
+		// sample rate, any other segment is ignored
+		i := strings.IndexByte(bit, '|')
+		if i < 0 {
 			log.Printf("E! Error: splitting '|', Unable to parse metric: %s\n", line)
 			return errors.New("Error Parsing statsd line")
-		} else if len(pipesplit) > 2 {
-			sr := pipesplit[2]
+		}
+		value, mtype := bit[:i], bit[i+1:]
+		if i := strings.IndexByte(mtype, '|'); i >= 0 {
+			sr := mtype[i+1:]
+			mtype = mtype[:i]
+			if i := strings.IndexByte(sr, '|'); i >= 0 {
+				sr = sr[:i]
+			}
 			errmsg := "E! Error: parsing sample rate, %s, it must be in format like: " +
 				"@0.1, @0.5, etc. Ignoring sample rate for line: %s\n"
-			if strings.Contains(sr, "@") && len(sr) > 1 {
+			if strings.IndexByte(sr, '@') >= 0 && len(sr) > 1 {
 				samplerate, err := strconv.ParseFloat(sr[1:], 64)
 				if err != nil {
 					log.Printf(errmsg, err.Error(), line)
 				} else {
 					// sample rate successfully parsed
-					m.samplerate = samplerate
+					observedRate = samplerate
+					m.samplerate, clamped, rejected = s.checkSampleRate(samplerate)
 				}
 			} else {
 				log.Printf(errmsg, "", line)
@@ -512,16 +1130,16 @@ func (s *Statsd) parseStatsdLine(line string) error {
 		}
 
 		// Validate metric type
-		switch pipesplit[1] {
+		switch mtype {
 		case "g", "c", "s", "ms", "h":
-			m.mtype = pipesplit[1]
+			m.mtype = mtype
 		default:
-			log.Printf("E! Error: Statsd Metric type %s unsupported", pipesplit[1])
+			log.Printf("E! Error: Statsd Metric type %s unsupported", mtype)
 			return errors.New("Error Parsing statsd line")
 		}
 
 		// Parse the value
-		if strings.HasPrefix(pipesplit[0], "-") || strings.HasPrefix(pipesplit[0], "+") {
+		if len(value) > 0 && (value[0] == '-' || value[0] == '+') {
 			if m.mtype != "g" && m.mtype != "c" {
 				log.Printf("E! Error: +- values are only supported for gauges & counters: %s\n", line)
 				return errors.New("Error Parsing statsd line")
@@ -531,7 +1149,7 @@ func (s *Statsd) parseStatsdLine(line string) error {
 
 		switch m.mtype {
 		case "g", "ms", "h":
-			v, err := strconv.ParseFloat(pipesplit[0], 64)
+			v, err := strconv.ParseFloat(value, 64)
 			if err != nil {
 				log.Printf("E! Error: parsing value to float64: %s\n", line)
 				return errors.New("Error Parsing statsd line")
@@ -539,9 +1157,9 @@ func (s *Statsd) parseStatsdLine(line string) error {
 			m.floatvalue = v
 		case "c":
 			var v int64
-			v, err := strconv.ParseInt(pipesplit[0], 10, 64)
+			v, err := strconv.ParseInt(value, 10, 64)
 			if err != nil {
-				v2, err2 := strconv.ParseFloat(pipesplit[0], 64)
+				v2, err2 := strconv.ParseFloat(value, 64)
 				if err2 != nil {
 					log.Printf("E! Error: parsing value to int64: %s\n", line)
 					return errors.New("Error Parsing statsd line")
@@ -554,56 +1172,239 @@ func (s *Statsd) parseStatsdLine(line string) error {
 			}
 			m.intvalue = v
 		case "s":
-			m.strvalue = pipesplit[0]
+			m.strvalue = value
 		}
 
 		// Parse the name & tags from bucket
-		m.name, m.field, m.tags = s.parseName(m.bucket)
-		switch m.mtype {
-		case "c":
-			m.tags["metric_type"] = "counter"
-		case "g":
-			m.tags["metric_type"] = "gauge"
-		case "s":
-			m.tags["metric_type"] = "set"
-		case "ms":
-			m.tags["metric_type"] = "timing"
-		case "h":
-			m.tags["metric_type"] = "histogram"
+		b := s.bucket(c, m.bucket)
+		m.name, m.field = b.name, b.field
+		m.tags = append(tagsArray[:0], b.tags...)
+		if !s.OmitMetricTypeTag {
+			key := s.MetricTypeTag
+			if key == "" {
+				key = defaultMetricTypeTag
+			}
+			m.tags = setTag(m.tags, key, metricTypes[m.mtype])
+		}
+		for _, t := range lineTags {
+			m.tags = setTag(m.tags, t.key, t.value)
 		}
+		sortTags(m.tags)
 
-		if len(lineTags) > 0 {
-			for k, v := range lineTags {
-				m.tags[k] = v
-			}
+		if observedRate != 0 && s.SampleRateStats {
+			c.recordSampleRate(m, observedRate, clamped, rejected)
+		}
+		if rejected {
+			// only this bit is dropped, the next ones of the line are kept
+			log.Printf("E! Error: implausible sample rate %v, dropping metric %s "+
+				"of line: %s\n", observedRate, bit, line)
+			continue
 		}
 
 		// Make a unique key for the measurement name/tags
-		var tg []string
-		for k, v := range m.tags {
-			tg = append(tg, k+"="+v)
-		}
-		sort.Strings(tg)
-		tg = append(tg, m.name)
-		m.hash = strings.Join(tg, "")
+		m.hash = hashKey(m.name, m.tags)
 
-		s.aggregate(m)
+		s.aggregate(c, m)
 	}
 
 	return nil
 }
 
+// bucket is a parsed bucket, its tags are sorted by key.
+type bucket struct {
+	name  string
+	field string
+	tags  []tag
+}
+
+// tag is a tag of a line, in the order of the line.
+type tag struct {
+	key   string
+	value string
+}
+
+// parseDataDogTags appends the tags of the segments of the line starting
+// with '#' to tags, and returns them with the line without these segments.
+func parseDataDogTags(line string, tags []tag) ([]tag, string) {
+	rest := make([]byte, 0, len(line))
+	first := true
+	for more := true; more; {
+		var segment string
+		if i := strings.IndexByte(line, '|'); i >= 0 {
+			segment, line = line[:i], line[i+1:]
+		} else {
+			segment, more = line, false
+		}
+
+		if len(segment) == 0 || segment[0] != '#' {
+			if !first {
+				rest = append(rest, '|')
+			}
+			first = false
+			rest = append(rest, segment...)
+			continue
+		}
+
+		// we have ourselves a tag; they are comma separated
+		for tagstr, moreTags := segment[1:], true; moreTags; {
+			var t string
+			if i := strings.IndexByte(tagstr, ','); i >= 0 {
+				t, tagstr = tagstr[:i], tagstr[i+1:]
+			} else {
+				t, moreTags = tagstr, false
+			}
+			k, v := t, ""
+			if i := strings.IndexByte(t, ':'); i >= 0 {
+				k, v = t[:i], t[i+1:]
+			}
+			if k != "" {
+				tags = append(tags, tag{key: k, value: v})
+			}
+		}
+	}
+	return tags, string(rest)
+}
+
+// hashKey returns the key of the series of the measurement name and tags in
+// the cache, the tags are sorted by key.
+func hashKey(name string, tags []tag) string {
+	n := len(name)
+	for _, t := range tags {
+		n += len(t.key) + len(t.value) + 1
+	}
+	b := make([]byte, 0, n)
+	for _, t := range tags {
+		b = append(b, t.key...)
+		b = append(b, '=')
+		b = append(b, t.value...)
+	}
+	b = append(b, name...)
+	return string(b)
+}
+
+// setTag sets the tag key of tags to value.
+func setTag(tags []tag, key, value string) []tag {
+	for i := range tags {
+		if tags[i].key == key {
+			tags[i].value = value
+			return tags
+		}
+	}
+	return append(tags, tag{key: key, value: value})
+}
+
+// sortTags sorts tags by key with an insertion sort, there are usually only
+// a few tags.
+func sortTags(tags []tag) {
+	for i := 1; i < len(tags); i++ {
+		for j := i; j > 0 && tags[j].key < tags[j-1].key; j-- {
+			tags[j], tags[j-1] = tags[j-1], tags[j]
+		}
+	}
+}
+
+// tagMap returns the tags as a map.
+func tagMap(tags []tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, t := range tags {
+		m[t.key] = t.value
+	}
+	return m
+}
+
+// isInfluxLine returns whether the line is in the InfluxDB line protocol
+// rather than a statsd line: its first unescaped space is followed by a
+// field set.
+func isInfluxLine(line string) bool {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case ' ':
+			return strings.Contains(line[i+1:], "=")
+		}
+	}
+	return false
+}
+
+// checkSampleRate applies the sample rate policy to the given rate, and
+// returns the rate to use and whether it was clamped or should be rejected.
+func (s *Statsd) checkSampleRate(rate float64) (float64, bool, bool) {
+	if rate >= s.MinSampleRate && rate <= 1 {
+		return rate, false, false
+	}
+
+	switch s.SampleRatePolicy {
+	case sampleRateClamp:
+		if rate > 1 {
+			return 1, true, false
+		}
+		return s.MinSampleRate, true, false
+	case sampleRateReject:
+		return rate, false, true
+	default:
+		return rate, false, false
+	}
+}
+
+// recordSampleRate tracks the sample rate a metric was sent with, so that the
+// distribution of sample rates per bucket can be reported at Gather.
+func (c *cache) recordSampleRate(m metric, rate float64, clamped, rejected bool) {
+	if c.sampleRates == nil {
+		c.sampleRates = make(map[string]cachedsamplerate)
+	}
+	key := m.mtype + m.name
+	cached, ok := c.sampleRates[key]
+	if !ok {
+		cached = cachedsamplerate{
+			tags: map[string]string{
+				"bucket":      m.name,
+				"metric_type": metricTypes[m.mtype],
+			},
+			min: rate,
+			max: rate,
+		}
+	}
+	cached.count++
+	cached.sum += rate
+	if rate < cached.min {
+		cached.min = rate
+	}
+	if rate > cached.max {
+		cached.max = rate
+	}
+	if clamped {
+		cached.clamped++
+	}
+	if rejected {
+		cached.rejected++
+	}
+	c.sampleRates[key] = cached
+}
+
 // parseName parses the given bucket name with the list of bucket maps in the
 // config file. If there is a match, it will parse the name of the metric and
 // map of tags.
 // Return values are (<name>, <field>, <tags>)
 func (s *Statsd) parseName(bucket string) (string, string, map[string]string) {
+	return s.parseBucket(&s.cache, bucket)
+}
+
+// parseBucket is parseName using the template parser of the given cache.
+func (s *Statsd) parseBucket(c *cache, bucket string) (string, string, map[string]string) {
 	tags := make(map[string]string)
 
-	bucketparts := strings.Split(bucket, ",")
+	name := bucket
 	// Parse out any tags in the bucket
-	if len(bucketparts) > 1 {
-		for _, btag := range bucketparts[1:] {
+	if i := strings.IndexByte(bucket, ','); i >= 0 {
+		name = bucket[:i]
+		for rest, more := bucket[i+1:], true; more; {
+			var btag string
+			if i := strings.IndexByte(rest, ','); i >= 0 {
+				btag, rest = rest[:i], rest[i+1:]
+			} else {
+				btag, more = rest, false
+			}
 			k, v := parseKeyValue(btag)
 			if k != "" {
 				tags[k] = v
@@ -612,24 +1413,19 @@ func (s *Statsd) parseName(bucket string) (string, string, map[string]string) {
 	}
 
 	var field string
-	name := bucketparts[0]
 
-	p := s.graphiteParser
-	var err error
-
-	if p == nil || s.graphiteParser.Separator != s.MetricSeparator {
-		p, err = graphite.NewGraphiteParser(s.MetricSeparator, s.Templates, nil)
-		s.graphiteParser = p
-	}
-
-	if err == nil {
+	if p := s.templateParser(c); p != nil {
 		p.DefaultTags = tags
 		name, tags, field, _ = p.ApplyTemplate(name)
 	}
 
 	if s.ConvertNames {
+		dash := s.ConvertNamesDash
+		if dash == "" {
+			dash = defaultConvertNamesDash
+		}
 		name = strings.Replace(name, ".", "_", -1)
-		name = strings.Replace(name, "-", "__", -1)
+		name = strings.Replace(name, "-", dash, -1)
 	}
 	if field == "" {
 		field = defaultFieldName
@@ -638,35 +1434,106 @@ func (s *Statsd) parseName(bucket string) (string, string, map[string]string) {
 	return name, field, tags
 }
 
+// bucket returns the measurement name, field and sorted tags of the bucket,
+// which are parsed once for all the lines of the bucket.
+func (s *Statsd) bucket(c *cache, name string) *bucket {
+	if b, ok := c.buckets[name]; ok {
+		return b
+	}
+	if c.buckets == nil || len(c.buckets) >= maxCachedBuckets {
+		c.buckets = make(map[string]*bucket)
+	}
+
+	b := &bucket{}
+	var tags map[string]string
+	b.name, b.field, tags = s.parseBucket(c, name)
+	for k, v := range tags {
+		b.tags = append(b.tags, tag{key: k, value: v})
+	}
+	sortTags(b.tags)
+	c.buckets[name] = b
+	return b
+}
+
+// templateParser returns the template parser of the given cache, or nil if
+// the templates are invalid.
+func (s *Statsd) templateParser(c *cache) *graphite.GraphiteParser {
+	if c.graphiteParser == nil || c.graphiteParser.Separator != s.MetricSeparator {
+		p, err := graphite.NewGraphiteParser(s.MetricSeparator, s.Templates, nil)
+		if err != nil {
+			return nil
+		}
+		c.graphiteParser = p
+	}
+	return c.graphiteParser
+}
+
+// AddressList is a list of service addresses, in the config file it can be
+// given either as a single string or as an array of strings.
+type AddressList []string
+
+// UnmarshalTOML parses either a string or an array of strings
+func (a *AddressList) UnmarshalTOML(b []byte) error {
+	// parse the value on its own to get its AST
+	tbl, err := toml.Parse(append([]byte("v = "), b...))
+	if err != nil {
+		return err
+	}
+	kv, ok := tbl.Fields["v"].(*ast.KeyValue)
+	if !ok {
+		return fmt.Errorf("invalid address list %s", b)
+	}
+
+	switch v := kv.Value.(type) {
+	case *ast.String:
+		*a = AddressList{v.Value}
+	case *ast.Array:
+		list := make(AddressList, 0, len(v.Value))
+		for _, elem := range v.Value {
+			str, ok := elem.(*ast.String)
+			if !ok {
+				return fmt.Errorf("invalid address %s, must be a string", elem.Source())
+			}
+			list = append(list, str.Value)
+		}
+		*a = list
+	default:
+		return fmt.Errorf("invalid address list %s, must be a string or an "+
+			"array of strings", kv.Value.Source())
+	}
+	return nil
+}
+
+func (a AddressList) String() string {
+	return strings.Join(a, ",")
+}
+
 // Parse the key,value out of a string that looks like "key=value"
 func parseKeyValue(keyvalue string) (string, string) {
-	var key, val string
-
-	split := strings.Split(keyvalue, "=")
+	i := strings.IndexByte(keyvalue, '=')
+	if i < 0 {
+		return "", keyvalue
+	}
 	// Must be exactly 2 to get anything meaningful out of them
-	if len(split) == 2 {
-		key = split[0]
-		val = split[1]
-	} else if len(split) == 1 {
-		val = split[0]
+	if strings.IndexByte(keyvalue[i+1:], '=') >= 0 {
+		return "", ""
 	}
-
-	return key, val
+	return keyvalue[:i], keyvalue[i+1:]
 }
 
 // aggregate takes in a metric. It then
 // aggregates and caches the current value(s). It does not deal with the
 // Delete* options, because those are dealt with in the Gather function.
-func (s *Statsd) aggregate(m metric) {
+func (s *Statsd) aggregate(c *cache, m metric) {
 	switch m.mtype {
 	case "ms", "h":
 		// Check if the measurement exists
-		cached, ok := s.timings[m.hash]
+		cached, ok := c.timings[m.hash]
 		if !ok {
 			cached = cachedtimings{
 				name:   m.name,
 				fields: make(map[string]RunningStats),
-				tags:   m.tags,
+				tags:   tagMap(m.tags),
 			}
 		}
 		// Check if the field exists. If we've not enabled multiple fields per timer
@@ -677,7 +1544,9 @@ func (s *Statsd) aggregate(m metric) {
 				PercLimit: s.PercentileLimit,
 			}
 		}
-		if m.samplerate > 0 {
+		if m.samplerate > 0 && s.TimingSampleRateWeighting {
+			field.AddWeightedValue(m.floatvalue, 1.0/m.samplerate)
+		} else if m.samplerate > 0 {
 			for i := 0; i < int(1.0/m.samplerate); i++ {
 				field.AddValue(m.floatvalue)
 			}
@@ -685,61 +1554,71 @@ func (s *Statsd) aggregate(m metric) {
 			field.AddValue(m.floatvalue)
 		}
 		cached.fields[m.field] = field
-		s.timings[m.hash] = cached
+		c.timings[m.hash] = cached
+
+		if s.rawTimingsFilter != nil && s.rawTimingsFilter.Match(m.name) {
+			c.addRawTiming(s.RawTimingsLimit, m)
+		}
 	case "c":
 		// check if the measurement exists
-		_, ok := s.counters[m.hash]
+		_, ok := c.counters[m.hash]
 		if !ok {
-			s.counters[m.hash] = cachedcounter{
+			c.counters[m.hash] = cachedcounter{
 				name:   m.name,
 				fields: make(map[string]interface{}),
-				tags:   m.tags,
+				tags:   tagMap(m.tags),
 			}
 		}
 		// check if the field exists
-		_, ok = s.counters[m.hash].fields[m.field]
+		_, ok = c.counters[m.hash].fields[m.field]
 		if !ok {
-			s.counters[m.hash].fields[m.field] = int64(0)
+			c.counters[m.hash].fields[m.field] = int64(0)
 		}
-		s.counters[m.hash].fields[m.field] =
-			s.counters[m.hash].fields[m.field].(int64) + m.intvalue
+		c.counters[m.hash].fields[m.field] =
+			c.counters[m.hash].fields[m.field].(int64) + m.intvalue
 	case "g":
 		// check if the measurement exists
-		_, ok := s.gauges[m.hash]
+		_, ok := c.gauges[m.hash]
 		if !ok {
-			s.gauges[m.hash] = cachedgauge{
+			c.gauges[m.hash] = cachedgauge{
 				name:   m.name,
 				fields: make(map[string]interface{}),
-				tags:   m.tags,
+				tags:   tagMap(m.tags),
+				set:    make(map[string]bool),
+				stats:  make(map[string]*gaugestats),
 			}
 		}
 		// check if the field exists
-		_, ok = s.gauges[m.hash].fields[m.field]
+		_, ok = c.gauges[m.hash].fields[m.field]
 		if !ok {
-			s.gauges[m.hash].fields[m.field] = float64(0)
+			c.gauges[m.hash].fields[m.field] = float64(0)
 		}
 		if m.additive {
-			s.gauges[m.hash].fields[m.field] =
-				s.gauges[m.hash].fields[m.field].(float64) + m.floatvalue
+			c.gauges[m.hash].fields[m.field] =
+				c.gauges[m.hash].fields[m.field].(float64) + m.floatvalue
 		} else {
-			s.gauges[m.hash].fields[m.field] = m.floatvalue
+			c.gauges[m.hash].fields[m.field] = m.floatvalue
+			c.gauges[m.hash].set[m.field] = true
+		}
+		if s.GaugeStats {
+			c.gauges[m.hash].observe(m.field)
 		}
 	case "s":
 		// check if the measurement exists
-		_, ok := s.sets[m.hash]
+		_, ok := c.sets[m.hash]
 		if !ok {
-			s.sets[m.hash] = cachedset{
+			c.sets[m.hash] = cachedset{
 				name:   m.name,
 				fields: make(map[string]map[string]bool),
-				tags:   m.tags,
+				tags:   tagMap(m.tags),
 			}
 		}
 		// check if the field exists
-		_, ok = s.sets[m.hash].fields[m.field]
+		_, ok = c.sets[m.hash].fields[m.field]
 		if !ok {
-			s.sets[m.hash].fields[m.field] = make(map[string]bool)
+			c.sets[m.hash].fields[m.field] = make(map[string]bool)
 		}
-		s.sets[m.hash].fields[m.field][m.strvalue] = true
+		c.sets[m.hash].fields[m.field][m.strvalue] = true
 	}
 }
 
@@ -776,15 +1655,7 @@ func (s *Statsd) handler(conn *net.TCPConn, id string) {
 			bufCopy := make([]byte, n+1)
 			copy(bufCopy, scanner.Bytes())
 			bufCopy[n] = '\n'
-
-			select {
-			case s.in <- bufCopy:
-			default:
-				s.drops++
-				if s.drops == 1 || s.drops%s.AllowedPendingMessages == 0 {
-					log.Printf(dropwarn, s.drops)
-				}
-			}
+			s.enqueue(bufCopy)
 		}
 	}
 }
@@ -816,29 +1687,33 @@ func (s *Statsd) Stop() {
 	defer s.Unlock()
 	log.Println("I! Stopping the statsd service")
 	close(s.done)
-	switch s.Protocol {
-	case "udp":
-		s.UDPlistener.Close()
-	case "tcp":
-		s.TCPlistener.Close()
-		// Close all open TCP connections
-		//  - get all conns from the s.conns map and put into slice
-		//  - this is so the forget() function doesnt conflict with looping
-		//    over the s.conns map
-		var conns []*net.TCPConn
-		s.cleanup.Lock()
-		for _, conn := range s.conns {
-			conns = append(conns, conn)
-		}
-		s.cleanup.Unlock()
-		for _, conn := range conns {
-			conn.Close()
-		}
-	default:
-		s.UDPlistener.Close()
+	s.closeListeners()
+	// Close all open TCP connections
+	//  - get all conns from the s.conns map and put into slice
+	//  - this is so the forget() function doesnt conflict with looping
+	//    over the s.conns map
+	var conns []*net.TCPConn
+	s.cleanup.Lock()
+	for _, conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.cleanup.Unlock()
+	for _, conn := range conns {
+		conn.Close()
 	}
 	s.wg.Wait()
+	s.TCPlisteners = nil
+	s.UDPlisteners = nil
 	close(s.in)
+	for _, sh := range s.shards {
+		s.cache.merge(&sh.cache)
+	}
+	s.shards = nil
+	s.handOff()
+	if s.removeWebhook != nil {
+		s.removeWebhook()
+		s.removeWebhook = nil
+	}
 	log.Println("I! Stopped Statsd listener service on ", s.ServiceAddress)
 }
 
@@ -846,7 +1721,7 @@ func init() {
 	inputs.Add("statsd", func() telegraf.Input {
 		return &Statsd{
 			Protocol:               defaultProtocol,
-			ServiceAddress:         ":8125",
+			ServiceAddress:         AddressList{":8125"},
 			MaxTCPConnections:      250,
 			MetricSeparator:        "_",
 			AllowedPendingMessages: defaultAllowPendingMessage,
@@ -854,6 +1729,10 @@ func init() {
 			DeleteGauges:           true,
 			DeleteSets:             true,
 			DeleteTimings:          true,
+			RawTimingsMeasurement:  defaultRawTimingsMeasurement,
+			RawTimingsLimit:        defaultRawTimingsLimit,
+			MinSampleRate:          defaultMinSampleRate,
+			handoffs:               defaultHandoffs,
 		}
 	})
 }
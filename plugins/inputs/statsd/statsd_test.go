@@ -1,12 +1,19 @@
 package statsd
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/selfstat"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -20,9 +27,10 @@ func newTestTcpListener() (*Statsd, chan []byte) {
 	in := make(chan []byte, 1500)
 	listener := &Statsd{
 		Protocol:               "tcp",
-		ServiceAddress:         ":8125",
+		ServiceAddress:         AddressList{":8125"},
 		AllowedPendingMessages: 10000,
 		MaxTCPConnections:      250,
+		MinSampleRate:          defaultMinSampleRate,
 		in:                     in,
 		done:                   make(chan struct{}),
 	}
@@ -49,9 +57,10 @@ func NewTestStatsd() *Statsd {
 func TestConcurrentConns(t *testing.T) {
 	listener := Statsd{
 		Protocol:               "tcp",
-		ServiceAddress:         ":8125",
+		ServiceAddress:         AddressList{":8125"},
 		AllowedPendingMessages: 10000,
 		MaxTCPConnections:      2,
+		MinSampleRate:          defaultMinSampleRate,
 	}
 
 	acc := &testutil.Accumulator{}
@@ -79,9 +88,10 @@ func TestConcurrentConns(t *testing.T) {
 func TestConcurrentConns1(t *testing.T) {
 	listener := Statsd{
 		Protocol:               "tcp",
-		ServiceAddress:         ":8125",
+		ServiceAddress:         AddressList{":8125"},
 		AllowedPendingMessages: 10000,
 		MaxTCPConnections:      1,
+		MinSampleRate:          defaultMinSampleRate,
 	}
 
 	acc := &testutil.Accumulator{}
@@ -107,9 +117,10 @@ func TestConcurrentConns1(t *testing.T) {
 func TestCloseConcurrentConns(t *testing.T) {
 	listener := Statsd{
 		Protocol:               "tcp",
-		ServiceAddress:         ":8125",
+		ServiceAddress:         AddressList{":8125"},
 		AllowedPendingMessages: 10000,
 		MaxTCPConnections:      2,
+		MinSampleRate:          defaultMinSampleRate,
 	}
 
 	acc := &testutil.Accumulator{}
@@ -128,9 +139,10 @@ func TestCloseConcurrentConns(t *testing.T) {
 func BenchmarkTCP(b *testing.B) {
 	listener := Statsd{
 		Protocol:               "tcp",
-		ServiceAddress:         ":8125",
+		ServiceAddress:         AddressList{":8125"},
 		AllowedPendingMessages: 250000,
 		MaxTCPConnections:      250,
+		MinSampleRate:          defaultMinSampleRate,
 	}
 	acc := &testutil.Accumulator{Discard: true}
 
@@ -156,6 +168,57 @@ func BenchmarkTCP(b *testing.B) {
 }
 
 // Valid lines should be parsed and their values should be cached
+// Test that all service addresses feed the same cache
+func TestMultipleServiceAddresses(t *testing.T) {
+	listener := Statsd{
+		Protocol:               "udp",
+		ServiceAddress:         AddressList{"127.0.0.1:18126", "127.0.0.1:18127"},
+		AllowedPendingMessages: 10000,
+		DeleteCounters:         true,
+		MinSampleRate:          defaultMinSampleRate,
+	}
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, listener.Start(acc))
+	defer listener.Stop()
+
+	for _, addr := range listener.ServiceAddress {
+		conn, err := net.Dial("udp", addr)
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("multi.address:1|c\n"))
+		require.NoError(t, err)
+		conn.Close()
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	require.NoError(t, listener.Gather(acc))
+	acc.AssertContainsFields(t, "multi_address",
+		map[string]interface{}{"value": int64(2)})
+}
+
+func TestAddressList_UnmarshalTOML(t *testing.T) {
+	var a AddressList
+	require.NoError(t, a.UnmarshalTOML([]byte(`":8125"`)))
+	assert.Equal(t, AddressList{":8125"}, a)
+
+	require.NoError(t, a.UnmarshalTOML([]byte(`[":8125", ':8126',
+  "127.0.0.1:8127",
+]`)))
+	assert.Equal(t, AddressList{":8125", ":8126", "127.0.0.1:8127"}, a)
+	assert.Equal(t, ":8125,:8126,127.0.0.1:8127", a.String())
+
+	// escapes, commas and comments are handled by the TOML parser
+	require.NoError(t, a.UnmarshalTOML([]byte(`[
+  "\u003a8125", # the default port
+  "[::1]:8126",
+]`)))
+	assert.Equal(t, AddressList{":8125", "[::1]:8126"}, a)
+
+	assert.Error(t, a.UnmarshalTOML([]byte(`8125`)))
+	assert.Error(t, a.UnmarshalTOML([]byte(`[8125]`)))
+	assert.Error(t, a.UnmarshalTOML([]byte(`":8125`)))
+}
+
 func TestParse_ValidLines(t *testing.T) {
 	s := NewTestStatsd()
 	valid_lines := []string{
@@ -413,6 +476,45 @@ func TestParse_Timings(t *testing.T) {
 	acc.AssertContainsFields(t, "test_timing", valid)
 }
 
+// Test that sampled timings are weighted rather than duplicated when
+// timing_sample_rate_weighting is enabled.
+func TestParse_Timings_SampleRateWeighting(t *testing.T) {
+	s := NewTestStatsd()
+	s.Percentiles = []int{90}
+	s.TimingSampleRateWeighting = true
+	acc := &testutil.Accumulator{}
+
+	valid_lines := []string{
+		"test.timing:1|ms|@0.1",
+		"test.timing:12|ms",
+	}
+
+	for _, line := range valid_lines {
+		err := s.parseStatsdLine(line)
+		if err != nil {
+			t.Errorf("Parsing line %s should not have resulted in an error\n", line)
+		}
+	}
+
+	cached := s.timings["metric_type=timingtest_timing"].fields[defaultFieldName]
+	if len(cached.perc) != 2 {
+		t.Errorf("Expected 2 stored values, got %d", len(cached.perc))
+	}
+
+	s.Gather(acc)
+
+	valid := map[string]interface{}{
+		"90_percentile": float64(1),
+		"count":         int64(11),
+		"lower":         float64(1),
+		"mean":          float64(2),
+		"stddev":        float64(math.Sqrt(10)),
+		"upper":         float64(12),
+	}
+
+	acc.AssertContainsFields(t, "test_timing", valid)
+}
+
 func TestParseScientificNotation(t *testing.T) {
 	s := NewTestStatsd()
 	sciNotationLines := []string{
@@ -430,6 +532,159 @@ func TestParseScientificNotation(t *testing.T) {
 }
 
 // Invalid lines should return an error
+// Test that implausible sample rates are clamped or rejected
+func TestParse_SampleRatePolicy(t *testing.T) {
+	s := NewTestStatsd()
+	s.MinSampleRate = 0.01
+	s.SampleRatePolicy = "clamp"
+
+	valid_lines := []string{
+		"clamped.counter:1|c|@0.0001",
+		"clamped.high.counter:1|c|@2",
+		"plausible.counter:1|c|@0.5",
+	}
+	for _, line := range valid_lines {
+		err := s.parseStatsdLine(line)
+		if err != nil {
+			t.Errorf("Parsing line %s should not have resulted in an error\n", line)
+		}
+	}
+
+	if err := test_validate_counter("clamped_counter", 100, s.counters); err != nil {
+		t.Error(err.Error())
+	}
+	if err := test_validate_counter("clamped_high_counter", 1, s.counters); err != nil {
+		t.Error(err.Error())
+	}
+	if err := test_validate_counter("plausible_counter", 2, s.counters); err != nil {
+		t.Error(err.Error())
+	}
+
+	s = NewTestStatsd()
+	s.MinSampleRate = 0.01
+	s.SampleRatePolicy = "reject"
+
+	if err := s.parseStatsdLine("rejected.counter:1|c|@0.0001"); err != nil {
+		t.Errorf("Parsing line with sample rate below minimum should not have resulted in an error")
+	}
+	if len(s.counters) != 0 {
+		t.Errorf("Expected no counters, found %d", len(s.counters))
+	}
+
+	// only the rejected bit of a line is dropped
+	if err := s.parseStatsdLine("rejected.counter:1|c|@0.0001:2|c|@0.5:4|c|@3"); err != nil {
+		t.Errorf("Parsing line with sample rate below minimum should not have resulted in an error")
+	}
+	if err := test_validate_counter("rejected_counter", 4, s.counters); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+// Test that an implausible min_sample_rate is refused
+func TestStartMinSampleRate(t *testing.T) {
+	for _, rate := range []float64{0, -0.5, 1.5} {
+		listener := Statsd{
+			Protocol:       "udp",
+			ServiceAddress: AddressList{"localhost:0"},
+			MinSampleRate:  rate,
+		}
+		err := listener.Start(&testutil.Accumulator{})
+		require.Error(t, err, "min_sample_rate = %v", rate)
+		assert.Contains(t, err.Error(), "min_sample_rate")
+	}
+}
+
+// Test that the observed sample rates are reported per bucket
+func TestParse_SampleRateStats(t *testing.T) {
+	s := NewTestStatsd()
+	s.MinSampleRate = 0.01
+	s.SampleRatePolicy = "clamp"
+	s.SampleRateStats = true
+	acc := &testutil.Accumulator{}
+
+	valid_lines := []string{
+		"sampled.counter:1|c|@0.5",
+		"sampled.counter:1|c|@0.1",
+		"sampled.counter:1|c|@0.001",
+		"unsampled.counter:1|c",
+	}
+	for _, line := range valid_lines {
+		err := s.parseStatsdLine(line)
+		if err != nil {
+			t.Errorf("Parsing line %s should not have resulted in an error\n", line)
+		}
+	}
+
+	s.Gather(acc)
+
+	acc.AssertContainsTaggedFields(t, "statsd_sample_rate",
+		map[string]interface{}{
+			"count":    int64(3),
+			"mean":     float64(0.601) / 3,
+			"min":      float64(0.001),
+			"max":      float64(0.5),
+			"clamped":  int64(1),
+			"rejected": int64(0),
+		},
+		map[string]string{
+			"bucket":      "sampled_counter",
+			"metric_type": "counter",
+		},
+	)
+	if acc.NMetrics() != 3 {
+		t.Errorf("Expected 3 metrics, got %d", acc.NMetrics())
+	}
+}
+
+func TestParse_RawTimings(t *testing.T) {
+	s := NewTestStatsd()
+	s.PercentileLimit = 10
+	s.RawTimingsMeasurement = "statsd_timing_raw"
+	s.RawTimingsLimit = 3
+	s.DeleteTimings = true
+	var err error
+	s.rawTimingsFilter, err = filter.Compile([]string{"api_*"})
+	require.NoError(t, err)
+
+	for _, line := range []string{
+		"api.get:10|ms",
+		"api.get:20|ms|@0.1",
+		"api.get:30|ms",
+		"api.get:40|ms",
+		"db.query:5|ms",
+	} {
+		require.NoError(t, s.parseStatsdLine(line))
+	}
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, s.Gather(acc))
+
+	var raw []map[string]interface{}
+	for _, m := range acc.Metrics {
+		if m.Measurement != "statsd_timing_raw" {
+			continue
+		}
+		require.Equal(t, map[string]string{
+			"bucket":      "api_get",
+			"metric_type": "timing",
+		}, m.Tags)
+		raw = append(raw, m.Fields)
+	}
+	require.Equal(t, []map[string]interface{}{
+		{"value": float64(10), "sample_rate": float64(1)},
+		{"value": float64(20), "sample_rate": float64(0.1)},
+		{"value": float64(30), "sample_rate": float64(1)},
+	}, raw)
+	// the aggregated stats are still reported
+	require.True(t, acc.HasMeasurement("api_get"))
+	// 3 raw timings over the limit, and the api_get and db_query stats
+	require.Equal(t, 5, int(acc.NMetrics()))
+
+	acc = &testutil.Accumulator{}
+	require.NoError(t, s.Gather(acc))
+	require.Equal(t, 0, int(acc.NMetrics()))
+}
+
 func TestParse_InvalidLines(t *testing.T) {
 	s := NewTestStatsd()
 	invalid_lines := []string{
@@ -582,6 +837,82 @@ func TestParse_Template(t *testing.T) {
 	}
 }
 
+// Test that the buckets matching no template are only counted
+func TestParse_ReportUnmatched(t *testing.T) {
+	s := NewTestStatsd()
+	s.ReportUnmatched = true
+	s.Templates = []string{
+		"cpu.* measurement.host",
+	}
+
+	lines := []string{
+		"cpu.host01:1|c",
+		"mem.used:10|g",
+		"mem.free:20|g",
+		"disk.sda.used,fs=ext4:30|g",
+	}
+	for _, line := range lines {
+		require.NoError(t, s.parseStatsdLine(line))
+	}
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, s.Gather(acc))
+	acc.AssertContainsTaggedFields(t, "cpu",
+		map[string]interface{}{"value": int64(1)},
+		map[string]string{"host": "host01", "metric_type": "counter"})
+	acc.AssertContainsTaggedFields(t, "statsd_unmatched",
+		map[string]interface{}{"count": int64(2)},
+		map[string]string{"prefix": "mem"})
+	acc.AssertContainsTaggedFields(t, "statsd_unmatched",
+		map[string]interface{}{"count": int64(1)},
+		map[string]string{"prefix": "disk"})
+	assert.Equal(t, 3, len(acc.Metrics))
+
+	acc.ClearMetrics()
+	require.NoError(t, s.Gather(acc))
+	assert.False(t, acc.HasMeasurement("statsd_unmatched"))
+}
+
+// Test that line protocol lines are passed through with influx_passthrough
+func TestParse_InfluxPassthrough(t *testing.T) {
+	s := NewTestStatsd()
+	s.InfluxPassthrough = true
+
+	lines := []string{
+		"cpu,host=a usage_idle=90,usage_user=2.5 1500000000000000000",
+		`disk,path=/mnt/my\ disk used=10i`,
+		"requests:1|c",
+		"requests:2|c",
+	}
+	for _, line := range lines {
+		require.NoError(t, s.parseStatsdLine(line))
+	}
+	assert.Error(t, s.parseStatsdLine("cpu usage_idle=,"))
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, s.Gather(acc))
+	acc.AssertContainsTaggedFields(t, "cpu",
+		map[string]interface{}{"usage_idle": float64(90), "usage_user": 2.5},
+		map[string]string{"host": "a"})
+	assert.True(t, acc.HasTimestamp("cpu", time.Unix(1500000000, 0)))
+	acc.AssertContainsTaggedFields(t, "disk",
+		map[string]interface{}{"used": int64(10)},
+		map[string]string{"path": "/mnt/my disk"})
+	acc.AssertContainsTaggedFields(t, "requests",
+		map[string]interface{}{"value": int64(3)},
+		map[string]string{"metric_type": "counter"})
+
+	acc.ClearMetrics()
+	require.NoError(t, s.Gather(acc))
+	assert.False(t, acc.HasMeasurement("cpu"))
+}
+
+// Test that line protocol lines are refused by default
+func TestParse_InfluxPassthroughDisabled(t *testing.T) {
+	s := NewTestStatsd()
+	assert.Error(t, s.parseStatsdLine("cpu,host=a usage_idle=90"))
+}
+
 // Test that template filters properly
 func TestParse_TemplateFilter(t *testing.T) {
 	s := NewTestStatsd()
@@ -1060,7 +1391,7 @@ func TestParse_MeasurementsWithMultipleValues(t *testing.T) {
 		// plus the last bit of value 1
 		// which adds up to 12 individual datapoints to be cached
 		if cachedtiming.fields[defaultFieldName].n != 12 {
-			t.Errorf("Expected 12 additions, got %d", cachedtiming.fields[defaultFieldName].n)
+			t.Errorf("Expected 12 additions, got %v", cachedtiming.fields[defaultFieldName].n)
 		}
 
 		if cachedtiming.fields[defaultFieldName].upper != 1 {
@@ -1449,6 +1780,82 @@ func TestParse_Counters_Delete(t *testing.T) {
 	}
 }
 
+func TestGaugeStats(t *testing.T) {
+	s := NewTestStatsd()
+	s.GaugeStats = true
+	s.DeleteGauges = false
+
+	for _, line := range []string{
+		"queue.depth:10|g", "queue.depth:+30|g", "queue.depth:5|g",
+	} {
+		require.NoError(t, s.parseStatsdLine(line))
+	}
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, s.Gather(acc))
+	acc.AssertContainsFields(t, "queue_depth", map[string]interface{}{
+		"value": float64(5),
+		"min":   float64(5),
+		"max":   float64(40),
+		"count": int64(3),
+	})
+
+	// the gauge kept its value during the next interval
+	acc.ClearMetrics()
+	require.NoError(t, s.Gather(acc))
+	acc.AssertContainsFields(t, "queue_depth", map[string]interface{}{
+		"value": float64(5),
+		"min":   float64(5),
+		"max":   float64(5),
+		"count": int64(0),
+	})
+
+	// increments from a parser worker are offset by the current value
+	other := &cache{}
+	other.reset()
+	require.NoError(t, s.parseLine(other, "queue.depth:-2|g"))
+	require.NoError(t, s.parseLine(other, "queue.depth:+4|g"))
+	s.cache.merge(other)
+
+	acc.ClearMetrics()
+	require.NoError(t, s.Gather(acc))
+	acc.AssertContainsFields(t, "queue_depth", map[string]interface{}{
+		"value": float64(7),
+		"min":   float64(3),
+		"max":   float64(7),
+		"count": int64(2),
+	})
+}
+
+func TestCounterRate(t *testing.T) {
+	for _, deleteCounters := range []bool{true, false} {
+		s := NewTestStatsd()
+		s.ReportCounterRate = true
+		s.DeleteCounters = deleteCounters
+
+		// the counter increases by 10 then 4 over two periods of 2s
+		var values []int64
+		var rates []float64
+		for _, line := range []string{"total.users:10|c", "total.users:4|c"} {
+			require.NoError(t, s.parseStatsdLine(line))
+			s.lastGather = time.Now().Add(-2 * time.Second)
+
+			acc := &testutil.Accumulator{}
+			require.NoError(t, s.Gather(acc))
+			require.Len(t, acc.Metrics, 1)
+			values = append(values, acc.Metrics[0].Fields["value"].(int64))
+			rates = append(rates, acc.Metrics[0].Fields["rate"].(float64))
+		}
+		assert.InDelta(t, 5, rates[0], 0.1)
+		assert.InDelta(t, 2, rates[1], 0.1)
+		if deleteCounters {
+			assert.Equal(t, []int64{10, 4}, values)
+		} else {
+			assert.Equal(t, []int64{10, 14}, values)
+		}
+	}
+}
+
 func TestParseKeyValue(t *testing.T) {
 	k, v := parseKeyValue("foo=bar")
 	if k != "foo" {
@@ -1564,3 +1971,468 @@ func test_validate_gauge(
 	}
 	return nil
 }
+
+// Test that the caches survive a configuration reload while the new
+// templates are used for the metrics received after it
+func TestReloadPreservesCaches(t *testing.T) {
+	registry := &handoffRegistry{caches: make(map[string]handoff)}
+	before := Statsd{
+		Protocol:               "udp",
+		ServiceAddress:         AddressList{"127.0.0.1:18128"},
+		AllowedPendingMessages: 10000,
+		MinSampleRate:          defaultMinSampleRate,
+		handoffs:               registry,
+	}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, before.Start(acc))
+	require.NoError(t, before.parseStatsdLine("cpu.load.us-west:10|c"))
+	before.Stop()
+
+	after := Statsd{
+		Protocol:               "udp",
+		ServiceAddress:         AddressList{"127.0.0.1:18128"},
+		AllowedPendingMessages: 10000,
+		MetricSeparator:        "_",
+		Templates:              []string{"measurement.measurement.region"},
+		MinSampleRate:          defaultMinSampleRate,
+		handoffs:               registry,
+	}
+	require.NoError(t, after.Start(acc))
+	defer after.Stop()
+	require.NoError(t, after.parseStatsdLine("cpu.load.us-west:5|c"))
+	require.NoError(t, after.parseStatsdLine("cpu.load.us-west:1|g"))
+
+	require.NoError(t, after.Gather(acc))
+	acc.AssertContainsTaggedFields(t, "cpu_load_us-west",
+		map[string]interface{}{"value": int64(10)},
+		map[string]string{"metric_type": "counter"})
+	acc.AssertContainsTaggedFields(t, "cpu_load",
+		map[string]interface{}{"value": int64(5)},
+		map[string]string{"metric_type": "counter", "region": "us-west"})
+}
+
+// Test that the caches holding only sample rates, raw timings or
+// passthrough metrics are handed off, that a failed Start hands them back
+// and that they expire
+func TestReloadHandoff(t *testing.T) {
+	registry := &handoffRegistry{caches: make(map[string]handoff)}
+	before := Statsd{
+		Protocol:               "udp",
+		ServiceAddress:         AddressList{"127.0.0.1:18134"},
+		AllowedPendingMessages: 10000,
+		MinSampleRate:          defaultMinSampleRate,
+		InfluxPassthrough:      true,
+		handoffs:               registry,
+	}
+	require.NoError(t, before.Start(&testutil.Accumulator{}))
+	require.NoError(t, before.parseStatsdLine("cpu value=1 0"))
+	before.Stop()
+	require.Len(t, registry.caches, 1)
+
+	// the listener of the failed input is still bound
+	busy := Statsd{
+		Protocol:               "udp",
+		ServiceAddress:         AddressList{"127.0.0.1:18135"},
+		AllowedPendingMessages: 10000,
+		MinSampleRate:          defaultMinSampleRate,
+	}
+	require.NoError(t, busy.Start(&testutil.Accumulator{}))
+	defer busy.Stop()
+	failed := Statsd{
+		Protocol:               "udp",
+		ServiceAddress:         AddressList{"127.0.0.1:18134", "127.0.0.1:18135"},
+		AllowedPendingMessages: 10000,
+		MinSampleRate:          defaultMinSampleRate,
+		handoffs:               registry,
+	}
+	registry.caches[failed.handoffKey()] = registry.caches[before.handoffKey()]
+	require.Error(t, failed.Start(&testutil.Accumulator{}))
+	assert.Contains(t, registry.caches, failed.handoffKey())
+
+	h := registry.caches[before.handoffKey()]
+	h.stopped = time.Now().Add(-2 * handoffTimeout)
+	registry.caches[before.handoffKey()] = h
+	after := Statsd{
+		Protocol:               "udp",
+		ServiceAddress:         AddressList{"127.0.0.1:18134"},
+		AllowedPendingMessages: 10000,
+		MinSampleRate:          defaultMinSampleRate,
+		handoffs:               registry,
+	}
+	require.NoError(t, after.Start(&testutil.Accumulator{}))
+	defer after.Stop()
+	assert.Empty(t, after.passthrough)
+	assert.NotContains(t, registry.caches, before.handoffKey())
+}
+
+// Test that a failed Start releases the listeners it already bound
+func TestStartReleasesListeners(t *testing.T) {
+	for _, protocol := range []string{"udp", "tcp"} {
+		listener := Statsd{
+			Protocol:               protocol,
+			ServiceAddress:         AddressList{"127.0.0.1:18136", "127.0.0.1:invalid"},
+			AllowedPendingMessages: 10000,
+			MaxTCPConnections:      10,
+			MinSampleRate:          defaultMinSampleRate,
+		}
+		require.Error(t, listener.Start(&testutil.Accumulator{}), protocol)
+		assert.Empty(t, listener.UDPlisteners)
+		assert.Empty(t, listener.TCPlisteners)
+
+		listener.ServiceAddress = AddressList{"127.0.0.1:18136"}
+		require.NoError(t, listener.Start(&testutil.Accumulator{}), protocol)
+		listener.Stop()
+	}
+}
+
+// Test that a bad template is reported by Start
+func TestStartInvalidTemplate(t *testing.T) {
+	listener := Statsd{
+		Protocol:               "udp",
+		ServiceAddress:         AddressList{"127.0.0.1:18129"},
+		AllowedPendingMessages: 10000,
+		Templates:              []string{"host.region"},
+		MinSampleRate:          defaultMinSampleRate,
+	}
+	require.Error(t, listener.Start(&testutil.Accumulator{}))
+}
+
+func newTestQueue(size int, policy string) *Statsd {
+	s := NewTestStatsd()
+	s.in = make(chan []byte, size)
+	s.AllowedPendingMessages = size
+	s.OverflowPolicy = policy
+	s.PacketsDropped = selfstat.Register("statsd", "packets_dropped", map[string]string{})
+	s.PacketsLimited = selfstat.Register("statsd", "packets_rate_limited", map[string]string{})
+	return s
+}
+
+func drain(s *Statsd) []string {
+	var packets []string
+	for len(s.in) > 0 {
+		packets = append(packets, string(<-s.in))
+	}
+	return packets
+}
+
+// Test the overflow policies when the queue is full
+func TestEnqueueOverflowPolicy(t *testing.T) {
+	s := newTestQueue(2, overflowDropNewest)
+	for _, p := range []string{"a", "b", "c"} {
+		s.enqueue([]byte(p))
+	}
+	assert.Equal(t, []string{"a", "b"}, drain(s))
+
+	s = newTestQueue(2, overflowDropOldest)
+	for _, p := range []string{"a", "b", "c"} {
+		s.enqueue([]byte(p))
+	}
+	assert.Equal(t, []string{"b", "c"}, drain(s))
+
+	s = newTestQueue(1, overflowBlock)
+	s.enqueue([]byte("a"))
+	enqueued := make(chan struct{})
+	go func() {
+		s.enqueue([]byte("b"))
+		close(enqueued)
+	}()
+	select {
+	case <-enqueued:
+		t.Fatal("enqueue did not block on a full queue")
+	case <-time.After(10 * time.Millisecond):
+	}
+	assert.Equal(t, "a", string(<-s.in))
+	<-enqueued
+	assert.Equal(t, []string{"b"}, drain(s))
+}
+
+// Test that packets over max_packets_per_second are dropped
+func TestEnqueueRateLimit(t *testing.T) {
+	s := newTestQueue(10, overflowDropNewest)
+	s.limiter = &packetLimiter{max: 3}
+	// the stat is shared by the tests
+	limited := s.PacketsLimited.Get()
+	for i := 0; i < 5; i++ {
+		s.enqueue([]byte(fmt.Sprint(i)))
+	}
+	assert.Equal(t, []string{"0", "1", "2"}, drain(s))
+	assert.Equal(t, int64(2), s.PacketsLimited.Get()-limited)
+}
+
+// Test that an unknown overflow policy is reported by Start
+func TestStartInvalidOverflowPolicy(t *testing.T) {
+	listener := Statsd{
+		Protocol:               "udp",
+		ServiceAddress:         AddressList{"127.0.0.1:18130"},
+		AllowedPendingMessages: 10000,
+		OverflowPolicy:         "drop_all",
+		MinSampleRate:          defaultMinSampleRate,
+	}
+	require.Error(t, listener.Start(&testutil.Accumulator{}))
+}
+
+// Test that the caches of the parser workers are merged on Gather
+func TestParserWorkers(t *testing.T) {
+	listener := Statsd{
+		Protocol:               "udp",
+		ServiceAddress:         AddressList{"127.0.0.1:18131"},
+		AllowedPendingMessages: 10000,
+		MetricSeparator:        "_",
+		ParserWorkers:          4,
+		DeleteCounters:         true,
+		MinSampleRate:          defaultMinSampleRate,
+	}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, listener.Start(acc))
+	defer listener.Stop()
+
+	conn, err := net.Dial("udp", "127.0.0.1:18131")
+	require.NoError(t, err)
+	defer conn.Close()
+	for i := 0; i < 10; i++ {
+		_, err = conn.Write([]byte("workers.a:1|c\nworkers.b:2|c\nworkers.c:3|c\n"))
+		require.NoError(t, err)
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	require.NoError(t, listener.Gather(acc))
+	for bucket, v := range map[string]int64{"a": 10, "b": 20, "c": 30} {
+		acc.AssertContainsTaggedFields(t, "workers_"+bucket,
+			map[string]interface{}{"value": v},
+			map[string]string{"metric_type": "counter"})
+	}
+}
+
+// Test merging the cache of a worker into the cache of the input
+func TestCacheMerge(t *testing.T) {
+	s := NewTestStatsd()
+	s.PercentileLimit = 10
+	other := &cache{}
+	other.reset()
+	s.cache.reset()
+
+	for _, line := range []string{
+		"cpu.set:10|g", "cpu.inc:10|g", "hits:1|c", "users:a|s", "t:1|ms",
+	} {
+		require.NoError(t, s.parseLine(&s.cache, line))
+	}
+	for _, line := range []string{
+		"cpu.set:3|g", "cpu.inc:+5|g", "hits:2|c", "users:b|s", "t:3|ms", "new:1|c",
+	} {
+		require.NoError(t, s.parseLine(other, line))
+	}
+
+	s.cache.merge(other)
+
+	require.NoError(t, test_validate_gauge("cpu_set", 3, s.gauges))
+	require.NoError(t, test_validate_gauge("cpu_inc", 15, s.gauges))
+	require.NoError(t, test_validate_counter("hits", 3, s.counters))
+	require.NoError(t, test_validate_counter("new", 1, s.counters))
+	require.NoError(t, test_validate_set("users", 2, s.sets))
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, s.Gather(acc))
+	acc.AssertContainsFields(t, "t", map[string]interface{}{
+		"mean":   float64(2),
+		"stddev": float64(1),
+		"upper":  float64(3),
+		"lower":  float64(1),
+		"count":  int64(2),
+	})
+}
+
+// Test the switches reproducing the names of older versions
+func TestCompatibilitySwitches(t *testing.T) {
+	s := NewTestStatsd()
+	s.MetricSeparator = "."
+	s.ConvertNames = true
+
+	name, _, _ := s.parseName("my-app.requests")
+	assert.Equal(t, "my__app_requests", name)
+
+	s.ConvertNamesDash = "_"
+	name, _, _ = s.parseName("my-app.requests")
+	assert.Equal(t, "my_app_requests", name)
+
+	acc := &testutil.Accumulator{}
+	s = NewTestStatsd()
+	s.MetricTypeTag = "type"
+	require.NoError(t, s.parseStatsdLine("requests:1|c"))
+	require.NoError(t, s.Gather(acc))
+	acc.AssertContainsTaggedFields(t, "requests",
+		map[string]interface{}{"value": int64(1)},
+		map[string]string{"type": "counter"})
+
+	acc = &testutil.Accumulator{}
+	s = NewTestStatsd()
+	s.OmitMetricTypeTag = true
+	require.NoError(t, s.parseStatsdLine("requests:1|c"))
+	require.NoError(t, s.parseStatsdLine("requests:2|g"))
+	require.NoError(t, s.Gather(acc))
+	// the counter and the gauge are in the same series
+	require.Len(t, acc.Metrics, 2)
+	for _, m := range acc.Metrics {
+		assert.Equal(t, "requests", m.Measurement)
+		assert.Empty(t, m.Tags)
+	}
+}
+
+// Test that the flush hooks get the summary of every Gather
+func TestFlushHook(t *testing.T) {
+	listener := Statsd{
+		Protocol:               "udp",
+		ServiceAddress:         AddressList{"127.0.0.1:18132"},
+		AllowedPendingMessages: 10000,
+		MetricSeparator:        "_",
+		ParserWorkers:          2,
+		DeleteCounters:         true,
+		DeleteGauges:           true,
+		MinSampleRate:          defaultMinSampleRate,
+	}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, listener.Start(acc))
+	defer listener.Stop()
+
+	var flushed []FlushStats
+	remove := listener.AddFlushHook(func(stats FlushStats) {
+		flushed = append(flushed, stats)
+	})
+
+	conn, err := net.Dial("udp", "127.0.0.1:18132")
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hook.a:1|c\nhook.b:2|c\nhook.c:3|g\nhook.d:4|ms\n" +
+		"invalid\nhook.e:x|c\n"))
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 50)
+
+	require.NoError(t, listener.Gather(acc))
+	require.Len(t, flushed, 1)
+	assert.Equal(t, "127.0.0.1:18132", flushed[0].Address)
+	assert.Equal(t, 2, flushed[0].Counters)
+	assert.Equal(t, 1, flushed[0].Gauges)
+	assert.Equal(t, 1, flushed[0].Timings)
+	assert.Equal(t, 0, flushed[0].Sets)
+	assert.Equal(t, int64(2), flushed[0].ParseErrors)
+
+	// the counters are reset
+	require.NoError(t, listener.Gather(acc))
+	require.Len(t, flushed, 2)
+	assert.Equal(t, 0, flushed[1].Counters)
+	assert.Equal(t, int64(0), flushed[1].ParseErrors)
+
+	remove()
+	require.NoError(t, listener.Gather(acc))
+	assert.Len(t, flushed, 2)
+}
+
+// Test that the summary of every Gather is posted to the flush webhook
+func TestFlushWebhook(t *testing.T) {
+	posted := make(chan FlushStats, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var stats FlushStats
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&stats))
+		posted <- stats
+	}))
+	defer ts.Close()
+
+	listener := Statsd{
+		Protocol:               "udp",
+		ServiceAddress:         AddressList{"127.0.0.1:18133"},
+		AllowedPendingMessages: 10000,
+		MetricSeparator:        "_",
+		FlushWebhook:           ts.URL,
+		MinSampleRate:          defaultMinSampleRate,
+	}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, listener.Start(acc))
+	defer listener.Stop()
+	require.NoError(t, listener.parseStatsdLine("webhook.a:1|s"))
+
+	require.NoError(t, listener.Gather(acc))
+	select {
+	case stats := <-posted:
+		assert.Equal(t, 1, stats.Sets)
+	case <-time.After(time.Second):
+		t.Fatal("the stats were not posted")
+	}
+}
+
+// benchmarkParallel parses lines from every goroutine of the benchmark while
+// Gather runs every millisecond. Without shards the lines are parsed under
+// the lock of the input, as without parser workers, otherwise each line is
+// parsed under the lock of its shard, as the parser workers do. Run it with
+// -cpu 8,32 to measure the contention on larger hosts.
+func benchmarkParallel(b *testing.B, shards int) {
+	s := NewTestStatsd()
+	s.PercentileLimit = 100
+	s.DeleteCounters = true
+	s.DeleteGauges = true
+	s.DeleteSets = true
+	s.DeleteTimings = true
+	s.cache.reset()
+	for i := 0; i < shards; i++ {
+		sh := &shard{}
+		sh.reset()
+		s.shards = append(s.shards, sh)
+	}
+
+	var lines []string
+	for i := 0; i < 64; i++ {
+		lines = append(lines,
+			fmt.Sprintf("bench.counter.%d:1|c", i),
+			fmt.Sprintf("bench.gauge.%d:%d|g", i, i),
+			fmt.Sprintf("bench.set.%d:%d|s", i, i),
+			fmt.Sprintf("bench.timing.%d:%d|ms", i, i))
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		acc := &testutil.Accumulator{}
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.Gather(acc)
+				acc.ClearMetrics()
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			line := lines[i%len(lines)]
+			if shards == 0 {
+				s.parseStatsdLine(line)
+				continue
+			}
+			sh := s.shards[shardOf(line, shards)]
+			sh.Lock()
+			s.parseLine(&sh.cache, line)
+			sh.Unlock()
+		}
+	})
+	b.StopTimer()
+	close(done)
+	wg.Wait()
+}
+
+func BenchmarkParallelUnsharded(b *testing.B) {
+	benchmarkParallel(b, 0)
+}
+
+func BenchmarkParallel8Shards(b *testing.B) {
+	benchmarkParallel(b, 8)
+}
+
+func BenchmarkParallel32Shards(b *testing.B) {
+	benchmarkParallel(b, 32)
+}
@@ -0,0 +1,253 @@
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var severityNames = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console",
+	"solaris-cron", "local0", "local1", "local2", "local3", "local4",
+	"local5", "local6", "local7",
+}
+
+// message is a syslog message in either the RFC3164 (version 0) or the
+// RFC5424 format. Nil values of RFC5424 ("-") are empty strings.
+type message struct {
+	facility int
+	severity int
+	version  int
+
+	timestamp time.Time
+	hostname  string
+	appname   string
+	procid    string
+	msgid     string
+	// structured data, sd-id -> param name -> param value
+	structuredData map[string]map[string]string
+	message        string
+}
+
+// parse parses a single syslog message. now is used to complete RFC3164
+// timestamps, which do not have a year.
+func parse(buf []byte, now time.Time) (*message, error) {
+	buf = bytes.TrimRight(buf, "\r\n\x00")
+	m := &message{}
+
+	rest, err := m.parsePri(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	// RFC5424 messages have a version right after the priority
+	i := 0
+	for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+		i++
+	}
+	if i > 0 && i < len(rest) && rest[i] == ' ' {
+		m.version, _ = strconv.Atoi(string(rest[:i]))
+		if err := m.parse5424(rest[i+1:]); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	m.parse3164(rest, now)
+	return m, nil
+}
+
+func (m *message) parsePri(buf []byte) ([]byte, error) {
+	if len(buf) < 3 || buf[0] != '<' {
+		return nil, fmt.Errorf("message does not start with a priority: %q",
+			truncate(buf))
+	}
+	end := bytes.IndexByte(buf, '>')
+	if end < 2 || end > 4 {
+		return nil, fmt.Errorf("invalid priority in message: %q", truncate(buf))
+	}
+	pri, err := strconv.Atoi(string(buf[1:end]))
+	if err != nil || pri > 191 {
+		return nil, fmt.Errorf("invalid priority in message: %q", truncate(buf))
+	}
+	m.facility = pri / 8
+	m.severity = pri % 8
+	return buf[end+1:], nil
+}
+
+// parse5424 parses the header, structured data and message of RFC5424,
+// "TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP SD [SP MSG]".
+func (m *message) parse5424(buf []byte) error {
+	var headers [5]string
+	for i := range headers {
+		end := bytes.IndexByte(buf, ' ')
+		if end < 0 {
+			return fmt.Errorf("truncated RFC5424 header")
+		}
+		if v := string(buf[:end]); v != "-" {
+			headers[i] = v
+		}
+		buf = buf[end+1:]
+	}
+
+	if headers[0] != "" {
+		ts, err := time.Parse(time.RFC3339Nano, headers[0])
+		if err != nil {
+			return fmt.Errorf("invalid RFC5424 timestamp %q", headers[0])
+		}
+		m.timestamp = ts
+	}
+	m.hostname = headers[1]
+	m.appname = headers[2]
+	m.procid = headers[3]
+	m.msgid = headers[4]
+
+	rest, err := m.parseStructuredData(buf)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		if rest[0] != ' ' {
+			return fmt.Errorf("missing space after RFC5424 structured data")
+		}
+		rest = bytes.TrimPrefix(rest[1:], []byte("\xef\xbb\xbf"))
+		m.message = string(rest)
+	}
+	return nil
+}
+
+// parseStructuredData parses "-" or a list of [id param="value" ...]
+// elements and returns what follows them.
+func (m *message) parseStructuredData(buf []byte) ([]byte, error) {
+	if len(buf) == 0 {
+		return nil, fmt.Errorf("missing RFC5424 structured data")
+	}
+	if buf[0] == '-' {
+		return buf[1:], nil
+	}
+
+	m.structuredData = make(map[string]map[string]string)
+	for len(buf) > 0 && buf[0] == '[' {
+		buf = buf[1:]
+		end := bytes.IndexAny(buf, " ]")
+		if end <= 0 {
+			return nil, fmt.Errorf("invalid structured data element")
+		}
+		id := string(buf[:end])
+		params := make(map[string]string)
+		m.structuredData[id] = params
+		buf = buf[end:]
+
+		for {
+			if len(buf) == 0 {
+				return nil, fmt.Errorf("unterminated structured data element %q", id)
+			}
+			if buf[0] == ']' {
+				buf = buf[1:]
+				break
+			}
+			// SP PARAM-NAME "=" %d34 PARAM-VALUE %d34
+			buf = buf[1:]
+			eq := bytes.Index(buf, []byte(`="`))
+			if eq <= 0 {
+				return nil, fmt.Errorf("invalid parameter in structured data element %q", id)
+			}
+			name := string(buf[:eq])
+			buf = buf[eq+2:]
+
+			var value []byte
+			closed := false
+			for i := 0; i < len(buf); i++ {
+				c := buf[i]
+				if c == '\\' && i+1 < len(buf) &&
+					(buf[i+1] == '"' || buf[i+1] == '\\' || buf[i+1] == ']') {
+					value = append(value, buf[i+1])
+					i++
+					continue
+				}
+				if c == '"' {
+					buf = buf[i+1:]
+					closed = true
+					break
+				}
+				value = append(value, c)
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated parameter %q in structured data element %q",
+					name, id)
+			}
+			params[name] = string(value)
+		}
+	}
+	return buf, nil
+}
+
+// parse3164 parses the BSD syslog format, "TIMESTAMP SP HOSTNAME SP
+// TAG[PID]: MSG". RFC3164 is only a description of existing practice,
+// anything that does not look like a header is kept in the message.
+func (m *message) parse3164(buf []byte, now time.Time) {
+	if len(buf) >= len(time.Stamp) {
+		ts, err := time.ParseInLocation(time.Stamp, string(buf[:len(time.Stamp)]),
+			now.Location())
+		if err == nil {
+			m.timestamp = ts.AddDate(now.Year(), 0, 0)
+			// a message from december received in january
+			if m.timestamp.After(now.AddDate(0, 1, 0)) {
+				m.timestamp = m.timestamp.AddDate(-1, 0, 0)
+			}
+			buf = bytes.TrimLeft(buf[len(time.Stamp):], " ")
+
+			if end := bytes.IndexByte(buf, ' '); end > 0 {
+				m.hostname = string(buf[:end])
+				buf = buf[end+1:]
+			}
+		}
+	}
+
+	// The TAG is alphanumeric and at most 32 characters, it is usually
+	// followed by the pid in brackets and a colon.
+	end := bytes.IndexAny(buf, "[: ")
+	if end > 0 && end <= 32 {
+		tag := buf[:end]
+		rest := buf[end:]
+		var pid []byte
+		if rest[0] == '[' {
+			if pidEnd := bytes.IndexByte(rest, ']'); pidEnd > 0 {
+				pid = rest[1:pidEnd]
+				rest = rest[pidEnd+1:]
+			}
+		}
+		if len(rest) > 0 && rest[0] == ':' {
+			m.appname = string(tag)
+			m.procid = string(pid)
+			buf = bytes.TrimLeft(rest[1:], " ")
+		}
+	}
+	m.message = string(buf)
+}
+
+func (m *message) severityName() string {
+	return severityNames[m.severity]
+}
+
+func (m *message) facilityName() string {
+	if m.facility < len(facilityNames) {
+		return facilityNames[m.facility]
+	}
+	return strconv.Itoa(m.facility)
+}
+
+func truncate(buf []byte) string {
+	s := string(buf)
+	if len(s) > 64 {
+		return s[:64] + "..."
+	}
+	return strings.TrimSpace(s)
+}
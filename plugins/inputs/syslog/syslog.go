@@ -0,0 +1,366 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+const defaultMaxMessageLength = 8192
+
+// Syslog is a syslog server receiving RFC3164 and RFC5424 messages over
+// UDP, TCP or TLS.
+type Syslog struct {
+	ServiceAddress   string
+	MaxConnections   int
+	ReadTimeout      *internal.Duration
+	KeepAlivePeriod  *internal.Duration
+	MaxMessageLength int
+
+	// Path to the server certificate and key, setting them enables TLS on
+	// tcp addresses
+	TLSCert string `toml:"tls_cert"`
+	TLSKey  string `toml:"tls_key"`
+	// CAs used to verify the certificate of the clients
+	TLSAllowedCACerts []string `toml:"tls_allowed_cacerts"`
+
+	now func() time.Time
+
+	acc        telegraf.Accumulator
+	listener   net.Listener
+	packetConn net.PacketConn
+
+	connections    map[string]net.Conn
+	connectionsMtx sync.Mutex
+	wg             sync.WaitGroup
+}
+
+var sampleConfig = `
+  ## URL to listen on, udp, tcp or tls (tcp with tls_cert and tls_key)
+  # service_address = "udp://:6514"
+  # service_address = "tcp://:6514"
+  # service_address = "tcp4://127.0.0.1:6514"
+
+  ## Server certificate and key, setting them makes tcp addresses accept
+  ## TLS connections only (RFC5425).
+  # tls_cert = "/etc/telegraf/cert.pem"
+  # tls_key = "/etc/telegraf/key.pem"
+  ## Require the clients to present a certificate signed by one of these CAs.
+  # tls_allowed_cacerts = ["/etc/telegraf/clientca.pem"]
+
+  ## Maximum number of concurrent connections, only applies to tcp.
+  ## 0 (default) is unlimited.
+  # max_connections = 1024
+
+  ## Read timeout, only applies to tcp.
+  ## 0 (default) is unlimited.
+  # read_timeout = "30s"
+
+  ## Period between keep alive probes, only applies to tcp.
+  ## 0 disables keep alive probes.
+  ## Defaults to the OS configuration.
+  # keep_alive_period = "5m"
+
+  ## Maximum length of a message, longer messages are dropped.
+  # max_message_length = 8192
+`
+
+func (s *Syslog) SampleConfig() string {
+	return sampleConfig
+}
+
+func (s *Syslog) Description() string {
+	return "Accepts syslog messages over UDP, TCP or TLS"
+}
+
+func (s *Syslog) Gather(_ telegraf.Accumulator) error {
+	return nil
+}
+
+func (s *Syslog) Start(acc telegraf.Accumulator) error {
+	s.acc = acc
+	if s.MaxMessageLength == 0 {
+		s.MaxMessageLength = defaultMaxMessageLength
+	}
+
+	spl := strings.SplitN(s.ServiceAddress, "://", 2)
+	if len(spl) != 2 {
+		return fmt.Errorf("invalid service address: %s", s.ServiceAddress)
+	}
+
+	switch spl[0] {
+	case "tcp", "tcp4", "tcp6":
+		l, err := net.Listen(spl[0], spl[1])
+		if err != nil {
+			return err
+		}
+		tlsConfig, err := s.tlsConfig()
+		if err != nil {
+			l.Close()
+			return err
+		}
+		if tlsConfig != nil {
+			l = tls.NewListener(l, tlsConfig)
+		}
+		s.listener = l
+		s.connections = make(map[string]net.Conn)
+		s.wg.Add(1)
+		go s.listenStream()
+		log.Printf("I! Started the syslog service on %s", l.Addr())
+	case "udp", "udp4", "udp6":
+		pc, err := net.ListenPacket(spl[0], spl[1])
+		if err != nil {
+			return err
+		}
+		s.packetConn = pc
+		s.wg.Add(1)
+		go s.listenPacket()
+		log.Printf("I! Started the syslog service on %s", pc.LocalAddr())
+	default:
+		return fmt.Errorf("unknown protocol '%s' in '%s'", spl[0], s.ServiceAddress)
+	}
+	return nil
+}
+
+func (s *Syslog) Stop() {
+	if s.listener != nil {
+		s.listener.Close()
+		s.connectionsMtx.Lock()
+		for _, c := range s.connections {
+			c.Close()
+		}
+		s.connectionsMtx.Unlock()
+	}
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+	s.wg.Wait()
+	s.listener = nil
+	s.packetConn = nil
+}
+
+func (s *Syslog) tlsConfig() (*tls.Config, error) {
+	if s.TLSCert == "" && s.TLSKey == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(s.TLSCert, s.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS key/certificate from %s:%s: %s",
+			s.TLSKey, s.TLSCert, err)
+	}
+	t := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if len(s.TLSAllowedCACerts) > 0 {
+		pool := x509.NewCertPool()
+		for _, ca := range s.TLSAllowedCACerts {
+			pem, err := ioutil.ReadFile(ca)
+			if err != nil {
+				return nil, fmt.Errorf("could not load TLS CA: %s", err)
+			}
+			pool.AppendCertsFromPEM(pem)
+		}
+		t.ClientCAs = pool
+		t.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return t, nil
+}
+
+func (s *Syslog) listenPacket() {
+	defer s.wg.Done()
+	buf := make([]byte, 64*1024) // 64kb - maximum size of IP packet
+	for {
+		n, _, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			if !strings.HasSuffix(err.Error(), ": use of closed network connection") {
+				s.acc.AddError(err)
+			}
+			return
+		}
+		s.handle(buf[:n])
+	}
+}
+
+func (s *Syslog) listenStream() {
+	defer s.wg.Done()
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			if !strings.HasSuffix(err.Error(), ": use of closed network connection") {
+				s.acc.AddError(err)
+			}
+			return
+		}
+
+		s.connectionsMtx.Lock()
+		if s.MaxConnections > 0 && len(s.connections) >= s.MaxConnections {
+			s.connectionsMtx.Unlock()
+			c.Close()
+			continue
+		}
+		s.connections[c.RemoteAddr().String()] = c
+		s.connectionsMtx.Unlock()
+
+		if err := s.setKeepAlive(c); err != nil {
+			s.acc.AddError(fmt.Errorf("unable to configure keep alive (%s): %s",
+				s.ServiceAddress, err))
+		}
+
+		s.wg.Add(1)
+		go s.read(c)
+	}
+}
+
+func (s *Syslog) setKeepAlive(c net.Conn) error {
+	if s.KeepAlivePeriod == nil {
+		return nil
+	}
+	tcpc, ok := c.(*net.TCPConn)
+	if !ok {
+		// tls connections keep alive through their underlying connection
+		return nil
+	}
+	if s.KeepAlivePeriod.Duration == 0 {
+		return tcpc.SetKeepAlive(false)
+	}
+	if err := tcpc.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return tcpc.SetKeepAlivePeriod(s.KeepAlivePeriod.Duration)
+}
+
+// read reads the messages of a stream, framed either by octet counting or
+// by a trailing newline (RFC6587).
+func (s *Syslog) read(c net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.connectionsMtx.Lock()
+		delete(s.connections, c.RemoteAddr().String())
+		s.connectionsMtx.Unlock()
+	}()
+	defer c.Close()
+
+	scnr := bufio.NewScanner(c)
+	scnr.Buffer(make([]byte, 0, 4096), s.MaxMessageLength+16)
+	scnr.Split(splitFrames)
+	for {
+		if s.ReadTimeout != nil && s.ReadTimeout.Duration > 0 {
+			c.SetReadDeadline(time.Now().Add(s.ReadTimeout.Duration))
+		}
+		if !scnr.Scan() {
+			break
+		}
+		s.handle(scnr.Bytes())
+	}
+
+	if err := scnr.Err(); err != nil {
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			log.Printf("D! Timeout in plugin [input.syslog]: %s", err)
+		} else if !strings.HasSuffix(err.Error(), ": use of closed network connection") {
+			s.acc.AddError(err)
+		}
+	}
+}
+
+// splitFrames is a bufio.SplitFunc for octet counted ("LEN SP MSG") and
+// newline terminated syslog frames.
+func splitFrames(data []byte, atEOF bool) (int, []byte, error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+	if data[0] >= '1' && data[0] <= '9' {
+		sp := bytes.IndexByte(data, ' ')
+		if sp < 0 {
+			if atEOF {
+				return len(data), nil, fmt.Errorf("truncated frame length")
+			}
+			return 0, nil, nil
+		}
+		n, err := strconv.Atoi(string(data[:sp]))
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid frame length %q", data[:sp])
+		}
+		if len(data) < sp+1+n {
+			if atEOF {
+				return len(data), nil, fmt.Errorf("truncated frame")
+			}
+			return 0, nil, nil
+		}
+		return sp + 1 + n, data[sp+1 : sp+1+n], nil
+	}
+	return bufio.ScanLines(data, atEOF)
+}
+
+func (s *Syslog) handle(buf []byte) {
+	if len(bytes.TrimSpace(buf)) == 0 {
+		return
+	}
+	if len(buf) > s.MaxMessageLength {
+		s.acc.AddError(fmt.Errorf("dropped syslog message of %d bytes, "+
+			"max_message_length is %d", len(buf), s.MaxMessageLength))
+		return
+	}
+
+	now := time.Now()
+	if s.now != nil {
+		now = s.now()
+	}
+	m, err := parse(buf, now)
+	if err != nil {
+		s.acc.AddError(fmt.Errorf("unable to parse syslog message: %s", err))
+		return
+	}
+
+	tags := map[string]string{
+		"severity": m.severityName(),
+		"facility": m.facilityName(),
+	}
+	if m.hostname != "" {
+		tags["hostname"] = m.hostname
+	}
+	if m.appname != "" {
+		tags["appname"] = m.appname
+	}
+
+	fields := map[string]interface{}{
+		"version":       int64(m.version),
+		"severity_code": int64(m.severity),
+		"facility_code": int64(m.facility),
+		"message":       m.message,
+	}
+	if !m.timestamp.IsZero() {
+		fields["timestamp"] = m.timestamp.UnixNano()
+	}
+	if m.procid != "" {
+		fields["procid"] = m.procid
+	}
+	if m.msgid != "" {
+		fields["msgid"] = m.msgid
+	}
+	for id, params := range m.structuredData {
+		for name, value := range params {
+			fields[id+"_"+name] = value
+		}
+	}
+
+	s.acc.AddFields("syslog", fields, tags, now)
+}
+
+func init() {
+	inputs.Add("syslog", func() telegraf.Input {
+		return &Syslog{
+			ServiceAddress: "udp://:6514",
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2017, 10, 11, 22, 14, 15, 0, time.UTC)
+
+func TestParse_RFC5424(t *testing.T) {
+	msg := `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 ` +
+		`[exampleSDID@32473 iut="3" eventSource="App\"lication" eventID="1011"]` +
+		`[examplePriority@32473 class="high"] An application event log entry...`
+
+	m, err := parse([]byte(msg), now)
+	require.NoError(t, err)
+
+	assert.Equal(t, 20, m.facility)
+	assert.Equal(t, 5, m.severity)
+	assert.Equal(t, 1, m.version)
+	assert.Equal(t, time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC), m.timestamp.UTC())
+	assert.Equal(t, "mymachine.example.com", m.hostname)
+	assert.Equal(t, "evntslog", m.appname)
+	assert.Equal(t, "", m.procid)
+	assert.Equal(t, "ID47", m.msgid)
+	assert.Equal(t, map[string]map[string]string{
+		"exampleSDID@32473": {
+			"iut":         "3",
+			"eventSource": `App"lication`,
+			"eventID":     "1011",
+		},
+		"examplePriority@32473": {"class": "high"},
+	}, m.structuredData)
+	assert.Equal(t, "An application event log entry...", m.message)
+}
+
+func TestParse_RFC5424NilValues(t *testing.T) {
+	m, err := parse([]byte("<34>1 - - - - - -"), now)
+	require.NoError(t, err)
+	assert.True(t, m.timestamp.IsZero())
+	assert.Equal(t, "", m.hostname)
+	assert.Nil(t, m.structuredData)
+	assert.Equal(t, "", m.message)
+}
+
+func TestParse_RFC3164(t *testing.T) {
+	m, err := parse([]byte("<34>Oct 11 22:14:15 mymachine su[1234]: 'su root' failed for lonvick on /dev/pts/8"), now)
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, m.facility)
+	assert.Equal(t, 2, m.severity)
+	assert.Equal(t, 0, m.version)
+	assert.Equal(t, now, m.timestamp)
+	assert.Equal(t, "mymachine", m.hostname)
+	assert.Equal(t, "su", m.appname)
+	assert.Equal(t, "1234", m.procid)
+	assert.Equal(t, "'su root' failed for lonvick on /dev/pts/8", m.message)
+}
+
+func TestParse_RFC3164NoHeader(t *testing.T) {
+	m, err := parse([]byte("<13>just a message"), now)
+	require.NoError(t, err)
+	assert.True(t, m.timestamp.IsZero())
+	assert.Equal(t, "", m.appname)
+	assert.Equal(t, "just a message", m.message)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, msg := range []string{
+		"",
+		"no priority",
+		"<192>1 - - - - - -",
+		"<abc>message",
+		"<34>1 2003-10-11",
+		"<34>1 bad-time - - - - -",
+		`<34>1 - - - - - [id a="1"`,
+	} {
+		_, err := parse([]byte(msg), now)
+		assert.Error(t, err, msg)
+	}
+}
+
+func TestSyslog_udp(t *testing.T) {
+	s := &Syslog{ServiceAddress: "udp://127.0.0.1:0"}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, s.Start(acc))
+	defer s.Stop()
+
+	client, err := net.Dial("udp", s.packetConn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte(`<165>1 2003-10-11T22:14:15.003Z host app 42 ID47 [origin ip="10.0.0.1"] hello`))
+	require.NoError(t, err)
+
+	acc.Wait(1)
+	acc.AssertContainsTaggedFields(t, "syslog",
+		map[string]interface{}{
+			"version":       int64(1),
+			"severity_code": int64(5),
+			"facility_code": int64(20),
+			"timestamp":     time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC).UnixNano(),
+			"procid":        "42",
+			"msgid":         "ID47",
+			"origin_ip":     "10.0.0.1",
+			"message":       "hello",
+		},
+		map[string]string{
+			"severity": "notice",
+			"facility": "local4",
+			"hostname": "host",
+			"appname":  "app",
+		})
+}
+
+func TestSyslog_tcp(t *testing.T) {
+	s := &Syslog{ServiceAddress: "tcp://127.0.0.1:0"}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, s.Start(acc))
+	defer s.Stop()
+
+	client, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	// octet counted and newline terminated frames
+	msg := "<13>1 - - - - - - first"
+	fmt.Fprintf(client, "%d %s", len(msg), msg)
+	fmt.Fprint(client, "<13>1 - - - - - - second\n")
+
+	acc.Wait(2)
+	acc.Lock()
+	defer acc.Unlock()
+	var messages []string
+	for _, m := range acc.Metrics {
+		messages = append(messages, m.Fields["message"].(string))
+	}
+	assert.Equal(t, []string{"first", "second"}, messages)
+}
+
+func TestSyslog_MaxMessageLength(t *testing.T) {
+	s := &Syslog{MaxMessageLength: 10}
+	acc := &testutil.Accumulator{}
+	s.acc = acc
+	s.handle([]byte("<13>1 - - - - - - too long"))
+	assert.Equal(t, uint64(0), acc.NMetrics())
+	assert.Len(t, acc.Errors, 1)
+}
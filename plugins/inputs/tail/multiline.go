@@ -0,0 +1,40 @@
+package tail
+
+import (
+	"regexp"
+	"strings"
+)
+
+// multiline joins the lines of the messages spanning several lines, a
+// message starts with a line matching start and goes on until the next one.
+type multiline struct {
+	start *regexp.Regexp
+	lines []string
+}
+
+// add adds a line to the pending message. If the line starts a new message,
+// the previous one is returned.
+func (m *multiline) add(line string) (string, bool) {
+	var msg string
+	var ok bool
+	if m.start.MatchString(line) {
+		msg, ok = m.flush()
+	}
+	m.lines = append(m.lines, line)
+	return msg, ok
+}
+
+// flush returns the pending message, if any.
+func (m *multiline) flush() (string, bool) {
+	if len(m.lines) == 0 {
+		return "", false
+	}
+	msg := strings.Join(m.lines, "\n")
+	m.lines = m.lines[:0]
+	return msg, true
+}
+
+// pending returns whether a message is pending.
+func (m *multiline) pending() bool {
+	return len(m.lines) > 0
+}
@@ -4,12 +4,15 @@ package tail
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/influxdata/tail"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/internal/globpath"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
@@ -20,7 +23,15 @@ type Tail struct {
 	FromBeginning bool
 	Pipe          bool
 
-	tailers []*tail.Tail
+	// MultilineStart is the pattern of the first line of the messages
+	// spanning several lines, the next lines are joined to it. The pending
+	// message is parsed after MultilineTimeout without new lines.
+	MultilineStart   string            `toml:"multiline_start"`
+	MultilineTimeout internal.Duration `toml:"multiline_timeout"`
+	multilineStart   *regexp.Regexp
+
+	// tailers are the tailers by file name
+	tailers map[string]*tail.Tail
 	parser  parsers.Parser
 	wg      sync.WaitGroup
 	acc     telegraf.Accumulator
@@ -30,7 +41,8 @@ type Tail struct {
 
 func NewTail() *Tail {
 	return &Tail{
-		FromBeginning: false,
+		FromBeginning:    false,
+		MultilineTimeout: internal.Duration{Duration: 5 * time.Second},
 	}
 }
 
@@ -50,6 +62,13 @@ const sampleConfig = `
   ## Whether file is a named pipe
   pipe = false
 
+  ## Messages spanning several lines, such as stack traces or pretty printed
+  ## JSON, start with a line matching the multiline_start regular
+  ## expression, the next lines are joined to it until the next match. The
+  ## pending message is parsed after multiline_timeout without new lines.
+  # multiline_start = '^\d{4}-\d{2}-\d{2}'
+  # multiline_timeout = "5s"
+
   ## Data format to consume.
   ## Each data format has its own unique set of configuration options, read
   ## more about them here:
@@ -65,7 +84,12 @@ func (t *Tail) Description() string {
 	return "Stream a log file, like the tail -f command"
 }
 
+// Gather starts tailing the files matching the patterns which were created
+// since the previous Gather.
 func (t *Tail) Gather(acc telegraf.Accumulator) error {
+	t.Lock()
+	defer t.Unlock()
+	t.tailNewFiles(true)
 	return nil
 }
 
@@ -74,9 +98,28 @@ func (t *Tail) Start(acc telegraf.Accumulator) error {
 	defer t.Unlock()
 
 	t.acc = acc
+	t.tailers = make(map[string]*tail.Tail)
+
+	t.multilineStart = nil
+	if t.MultilineStart != "" {
+		var err error
+		t.multilineStart, err = regexp.Compile(t.MultilineStart)
+		if err != nil {
+			return fmt.Errorf("E! Error multiline_start %s failed to compile, %s",
+				t.MultilineStart, err)
+		}
+	}
 
+	t.tailNewFiles(t.FromBeginning)
+	return nil
+}
+
+// tailNewFiles starts a tailer for each file matching the patterns which is
+// not tailed yet. The files are tailed from their end unless fromBeginning
+// is set.
+func (t *Tail) tailNewFiles(fromBeginning bool) {
 	var seek *tail.SeekInfo
-	if !t.Pipe && !t.FromBeginning {
+	if !t.Pipe && !fromBeginning {
 		seek = &tail.SeekInfo{
 			Whence: 2,
 			Offset: 0,
@@ -88,8 +131,13 @@ func (t *Tail) Start(acc telegraf.Accumulator) error {
 		g, err := globpath.Compile(filepath)
 		if err != nil {
 			t.acc.AddError(fmt.Errorf("E! Error Glob %s failed to compile, %s", filepath, err))
+			continue
 		}
 		for file, _ := range g.Match() {
+			if _, ok := t.tailers[file]; ok {
+				// the file is tailed, and reopened when it is rotated
+				continue
+			}
 			tailer, err := tail.TailFile(file,
 				tail.Config{
 					ReOpen:    true,
@@ -100,17 +148,15 @@ func (t *Tail) Start(acc telegraf.Accumulator) error {
 					Logger:    tail.DiscardingLogger,
 				})
 			if err != nil {
-				acc.AddError(err)
+				t.acc.AddError(err)
 				continue
 			}
 			// create a goroutine for each "tailer"
 			t.wg.Add(1)
 			go t.receiver(tailer)
-			t.tailers = append(t.tailers, tailer)
+			t.tailers[file] = tailer
 		}
 	}
-
-	return nil
 }
 
 // this is launched as a goroutine to continuously watch a tailed logfile
@@ -118,29 +164,87 @@ func (t *Tail) Start(acc telegraf.Accumulator) error {
 func (t *Tail) receiver(tailer *tail.Tail) {
 	defer t.wg.Done()
 
-	var m telegraf.Metric
-	var err error
-	var line *tail.Line
-	for line = range tailer.Lines {
-		if line.Err != nil {
-			t.acc.AddError(fmt.Errorf("E! Error tailing file %s, Error: %s\n",
-				tailer.Filename, err))
-			continue
+	var ml *multiline
+	timer := time.NewTimer(time.Hour)
+	stopTimer(timer)
+	defer timer.Stop()
+	if t.multilineStart != nil {
+		ml = &multiline{start: t.multilineStart}
+	}
+
+	for {
+		select {
+		case line, ok := <-tailer.Lines:
+			if !ok {
+				if ml != nil {
+					if msg, ok := ml.flush(); ok {
+						t.parseMessage(tailer, msg)
+					}
+				}
+				if err := tailer.Err(); err != nil {
+					t.acc.AddError(fmt.Errorf("E! Error tailing file %s, Error: %s\n",
+						tailer.Filename, err))
+				}
+				return
+			}
+			if line.Err != nil {
+				t.acc.AddError(fmt.Errorf("E! Error tailing file %s, Error: %s\n",
+					tailer.Filename, line.Err))
+				continue
+			}
+			// Fix up files with Windows line endings.
+			text := strings.TrimRight(line.Text, "\r")
+
+			if ml == nil {
+				t.parseLine(tailer, text)
+				continue
+			}
+			if msg, ok := ml.add(text); ok {
+				t.parseMessage(tailer, msg)
+			}
+			if t.MultilineTimeout.Duration > 0 {
+				stopTimer(timer)
+				timer.Reset(t.MultilineTimeout.Duration)
+			}
+		case <-timer.C:
+			if msg, ok := ml.flush(); ok {
+				t.parseMessage(tailer, msg)
+			}
 		}
-		// Fix up files with Windows line endings.
-		text := strings.TrimRight(line.Text, "\r")
-
-		m, err = t.parser.ParseLine(text)
-		if err == nil {
-			t.acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
-		} else {
-			t.acc.AddError(fmt.Errorf("E! Malformed log line in %s: [%s], Error: %s\n",
-				tailer.Filename, line.Text, err))
+	}
+}
+
+// stopTimer stops the timer and drains its channel, so that it can be reset.
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
 		}
 	}
-	if err := tailer.Err(); err != nil {
-		t.acc.AddError(fmt.Errorf("E! Error tailing file %s, Error: %s\n",
-			tailer.Filename, err))
+}
+
+func (t *Tail) parseLine(tailer *tail.Tail, text string) {
+	m, err := t.parser.ParseLine(text)
+	if err == nil {
+		t.acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+	} else {
+		t.acc.AddError(fmt.Errorf("E! Malformed log line in %s: [%s], Error: %s\n",
+			tailer.Filename, text, err))
+	}
+}
+
+// parseMessage parses the joined lines of a multiline message, which may
+// hold several metrics.
+func (t *Tail) parseMessage(tailer *tail.Tail, msg string) {
+	metrics, err := t.parser.Parse([]byte(msg))
+	if err != nil {
+		t.acc.AddError(fmt.Errorf("E! Malformed log message in %s: [%s], Error: %s\n",
+			tailer.Filename, msg, err))
+		return
+	}
+	for _, m := range metrics {
+		t.acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
 	}
 }
 
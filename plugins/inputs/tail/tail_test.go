@@ -3,9 +3,13 @@ package tail
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"testing"
+	"time"
 
+	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/parsers"
 	"github.com/influxdata/telegraf/testutil"
 
@@ -133,3 +137,88 @@ func TestTailDosLineendings(t *testing.T) {
 			"usage_idle": float64(200),
 		})
 }
+
+func TestTailMultiline(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+	_, err = tmpfile.WriteString("{\n  \"a\": 1,\n  \"b\": {\"c\": 2}\n}\n" +
+		"{\n  \"a\": 3\n}\n")
+	require.NoError(t, err)
+
+	tt := NewTail()
+	tt.FromBeginning = true
+	tt.Files = []string{tmpfile.Name()}
+	tt.MultilineStart = "^{"
+	tt.MultilineTimeout = internal.Duration{Duration: 50 * time.Millisecond}
+	p, _ := parsers.NewJSONParser("json", nil, nil)
+	tt.SetParser(p)
+	defer tt.Stop()
+	defer tmpfile.Close()
+
+	acc := testutil.Accumulator{}
+	require.NoError(t, tt.Start(&acc))
+
+	// the last message is parsed after the timeout
+	acc.Wait(2)
+	require.Len(t, acc.Metrics, 2)
+	assert.Equal(t, map[string]interface{}{"a": float64(1), "b_c": float64(2)},
+		acc.Metrics[0].Fields)
+	assert.Equal(t, map[string]interface{}{"a": float64(3)},
+		acc.Metrics[1].Fields)
+	assert.Empty(t, acc.Errors)
+}
+
+func TestTailInvalidMultilineStart(t *testing.T) {
+	tt := NewTail()
+	tt.MultilineStart = "("
+	assert.Error(t, tt.Start(&testutil.Accumulator{}))
+}
+
+func TestTailNewFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tail")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tt := NewTail()
+	tt.Files = []string{filepath.Join(dir, "*.log")}
+	p, _ := parsers.NewInfluxParser()
+	tt.SetParser(p)
+	defer tt.Stop()
+
+	acc := testutil.Accumulator{}
+	require.NoError(t, tt.Start(&acc))
+	assert.Empty(t, tt.tailers)
+
+	// a file created after Start is tailed from its beginning
+	err = ioutil.WriteFile(filepath.Join(dir, "a.log"),
+		[]byte("cpu usage_idle=100\n"), 0644)
+	require.NoError(t, err)
+	require.NoError(t, acc.GatherError(tt.Gather))
+	assert.Len(t, tt.tailers, 1)
+
+	acc.Wait(1)
+	acc.AssertContainsFields(t, "cpu",
+		map[string]interface{}{"usage_idle": float64(100)})
+
+	// the file is not tailed twice
+	require.NoError(t, acc.GatherError(tt.Gather))
+	assert.Len(t, tt.tailers, 1)
+}
+
+func TestMultiline(t *testing.T) {
+	ml := &multiline{start: regexp.MustCompile(`^\S`)}
+	_, ok := ml.add("Exception: boom")
+	assert.False(t, ok)
+	_, ok = ml.add("  at main.go:1")
+	assert.False(t, ok)
+	msg, ok := ml.add("next")
+	assert.True(t, ok)
+	assert.Equal(t, "Exception: boom\n  at main.go:1", msg)
+	assert.True(t, ml.pending())
+	msg, ok = ml.flush()
+	assert.True(t, ok)
+	assert.Equal(t, "next", msg)
+	_, ok = ml.flush()
+	assert.False(t, ok)
+}
@@ -0,0 +1,230 @@
+// +build linux
+
+package temp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+var (
+	// hwmon temperature attributes, ie temp1_input
+	hwmonAttr = regexp.MustCompile(`^temp([0-9]+)_([a-z_]+)$`)
+	// thermal zone trip points, ie trip_point_0_type
+	tripPointType = regexp.MustCompile(`^trip_point_([0-9]+)_type$`)
+)
+
+// hwmonFields are the fields of the hwmon temperature attributes, in degrees
+// Celsius except the alarm.
+var hwmonFields = map[string]string{
+	"input":      "temp",
+	"max":        "max",
+	"max_hyst":   "max_hyst",
+	"crit":       "crit",
+	"crit_hyst":  "crit_hyst",
+	"crit_alarm": "crit_alarm",
+}
+
+// Temp gathers the temperatures of the hwmon devices and of the thermal
+// zones from sysfs.
+type Temp struct {
+	SysPath      string `toml:"sys_path"`
+	Hwmon        bool   `toml:"hwmon"`
+	ThermalZones bool   `toml:"thermal_zones"`
+}
+
+var sampleConfig = `
+  ## Path of sysfs, by default $HOST_SYS or else /sys.
+  # sys_path = "/sys"
+
+  ## Gather the temperatures of the hwmon devices, the chips known to
+  ## lm-sensors.
+  # hwmon = true
+
+  ## Gather the temperatures of the ACPI and platform thermal zones.
+  # thermal_zones = true
+`
+
+func (t *Temp) SampleConfig() string {
+	return sampleConfig
+}
+
+func (t *Temp) Description() string {
+	return "Gather the temperatures of the hwmon chips and thermal zones from sysfs"
+}
+
+func (t *Temp) Gather(acc telegraf.Accumulator) error {
+	sys := t.SysPath
+	if sys == "" {
+		sys = os.Getenv("HOST_SYS")
+	}
+	if sys == "" {
+		sys = "/sys"
+	}
+
+	if t.Hwmon {
+		t.gatherHwmon(acc, filepath.Join(sys, "class", "hwmon"))
+	}
+	if t.ThermalZones {
+		t.gatherThermalZones(acc, filepath.Join(sys, "class", "thermal"))
+	}
+	return nil
+}
+
+// gatherHwmon adds a metric per temperature sensor of each hwmon device,
+// tagged with the name of the chip and the label of the sensor.
+func (t *Temp) gatherHwmon(acc telegraf.Accumulator, dir string) {
+	devices, _ := filepath.Glob(filepath.Join(dir, "hwmon*"))
+	for _, dev := range devices {
+		// the attributes are in the directory of the device on older kernels
+		attrDir := dev
+		if _, err := os.Stat(filepath.Join(dev, "name")); err != nil {
+			attrDir = filepath.Join(dev, "device")
+		}
+		chip, err := readString(filepath.Join(attrDir, "name"))
+		if err != nil {
+			acc.AddError(err)
+			continue
+		}
+		tags := map[string]string{"chip": chip}
+		if link, err := os.Readlink(filepath.Join(dev, "device")); err == nil {
+			tags["device"] = filepath.Base(link)
+		}
+
+		files, err := ioutil.ReadDir(attrDir)
+		if err != nil {
+			acc.AddError(err)
+			continue
+		}
+		sensors := make(map[string]map[string]interface{})
+		for _, f := range files {
+			m := hwmonAttr.FindStringSubmatch(f.Name())
+			if m == nil {
+				continue
+			}
+			field, ok := hwmonFields[m[2]]
+			if !ok {
+				continue
+			}
+			v, err := readInt(filepath.Join(attrDir, f.Name()))
+			if err != nil {
+				// ie the sensor is not connected
+				continue
+			}
+			if sensors[m[1]] == nil {
+				sensors[m[1]] = make(map[string]interface{})
+			}
+			if field == "crit_alarm" {
+				sensors[m[1]][field] = v
+			} else {
+				sensors[m[1]][field] = float64(v) / 1000
+			}
+		}
+
+		for _, n := range sortedKeys(sensors) {
+			fields := sensors[n]
+			if _, ok := fields["temp"]; !ok {
+				continue
+			}
+			feature := "temp" + n
+			if label, err := readString(filepath.Join(attrDir, "temp"+n+"_label")); err == nil && label != "" {
+				feature = snake(label)
+			}
+			sensorTags := map[string]string{"source": "hwmon", "feature": feature}
+			for k, v := range tags {
+				sensorTags[k] = v
+			}
+			acc.AddFields("temp", fields, sensorTags)
+		}
+	}
+}
+
+// gatherThermalZones adds a metric per thermal zone, with the temperatures
+// of its critical and hot trip points.
+func (t *Temp) gatherThermalZones(acc telegraf.Accumulator, dir string) {
+	zones, _ := filepath.Glob(filepath.Join(dir, "thermal_zone*"))
+	for _, zone := range zones {
+		v, err := readInt(filepath.Join(zone, "temp"))
+		if err != nil {
+			// ie the zone is disabled
+			continue
+		}
+		fields := map[string]interface{}{"temp": float64(v) / 1000}
+
+		files, _ := ioutil.ReadDir(zone)
+		for _, f := range files {
+			m := tripPointType.FindStringSubmatch(f.Name())
+			if m == nil {
+				continue
+			}
+			typ, err := readString(filepath.Join(zone, f.Name()))
+			if err != nil || (typ != "critical" && typ != "hot") {
+				continue
+			}
+			trip, err := readInt(filepath.Join(zone, "trip_point_"+m[1]+"_temp"))
+			if err != nil {
+				continue
+			}
+			field := "crit"
+			if typ == "hot" {
+				field = "hot"
+			}
+			fields[field] = float64(trip) / 1000
+		}
+
+		feature, _ := readString(filepath.Join(zone, "type"))
+		tags := map[string]string{
+			"source":  "thermal_zone",
+			"chip":    filepath.Base(zone),
+			"feature": feature,
+		}
+		acc.AddFields("temp", fields, tags)
+	}
+}
+
+func readString(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func readInt(path string) (int64, error) {
+	s, err := readString(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func sortedKeys(m map[string]map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// snake converts string to snake case
+func snake(input string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(input), " ", "_", -1))
+}
+
+func init() {
+	inputs.Add("temp", func() telegraf.Input {
+		return &Temp{
+			Hwmon:        true,
+			ThermalZones: true,
+		}
+	})
+}
@@ -0,0 +1,120 @@
+// +build linux
+
+package temp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSysfs returns a sysfs tree with a hwmon chip and two thermal zones,
+// removed by the returned function.
+func newSysfs(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "temp")
+	require.NoError(t, err)
+
+	files := map[string]string{
+		"devices/platform/coretemp.0/hwmon/hwmon1/name":             "coretemp\n",
+		"devices/platform/coretemp.0/hwmon/hwmon1/temp1_input":      "45000\n",
+		"devices/platform/coretemp.0/hwmon/hwmon1/temp1_label":      "Package id 0\n",
+		"devices/platform/coretemp.0/hwmon/hwmon1/temp1_max":        "80000\n",
+		"devices/platform/coretemp.0/hwmon/hwmon1/temp1_crit":       "100000\n",
+		"devices/platform/coretemp.0/hwmon/hwmon1/temp1_crit_alarm": "0\n",
+		"devices/platform/coretemp.0/hwmon/hwmon1/temp2_input":      "42500\n",
+		"devices/platform/coretemp.0/hwmon/hwmon1/temp2_crit":       "100000\n",
+		"devices/platform/coretemp.0/hwmon/hwmon1/temp2_offset":     "0\n",
+		// a sensor without input is not connected
+		"devices/platform/coretemp.0/hwmon/hwmon1/temp3_max": "80000\n",
+
+		"class/thermal/thermal_zone0/type":              "acpitz\n",
+		"class/thermal/thermal_zone0/temp":              "27800\n",
+		"class/thermal/thermal_zone0/trip_point_0_type": "critical\n",
+		"class/thermal/thermal_zone0/trip_point_0_temp": "105000\n",
+		"class/thermal/thermal_zone0/trip_point_1_type": "passive\n",
+		"class/thermal/thermal_zone0/trip_point_1_temp": "95000\n",
+		"class/thermal/thermal_zone1/type":              "x86_pkg_temp\n",
+		"class/thermal/thermal_zone1/temp":              "46000\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	// the class directory and the device are symlinks, like in sysfs
+	hwmon := filepath.Join(dir, "class/hwmon")
+	require.NoError(t, os.MkdirAll(hwmon, 0755))
+	require.NoError(t, os.Symlink(
+		filepath.Join(dir, "devices/platform/coretemp.0/hwmon/hwmon1"),
+		filepath.Join(hwmon, "hwmon1")))
+	require.NoError(t, os.Symlink("../../../coretemp.0",
+		filepath.Join(dir, "devices/platform/coretemp.0/hwmon/hwmon1/device")))
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestGather(t *testing.T) {
+	dir, cleanup := newSysfs(t)
+	defer cleanup()
+
+	var acc testutil.Accumulator
+	temp := &Temp{SysPath: dir, Hwmon: true, ThermalZones: true}
+	require.NoError(t, temp.Gather(&acc))
+	assert.Empty(t, acc.Errors)
+	assert.Len(t, acc.Metrics, 4)
+
+	acc.AssertContainsTaggedFields(t, "temp",
+		map[string]interface{}{
+			"temp":       45.0,
+			"max":        80.0,
+			"crit":       100.0,
+			"crit_alarm": int64(0),
+		},
+		map[string]string{
+			"source":  "hwmon",
+			"chip":    "coretemp",
+			"device":  "coretemp.0",
+			"feature": "package_id_0",
+		})
+	acc.AssertContainsTaggedFields(t, "temp",
+		map[string]interface{}{"temp": 42.5, "crit": 100.0},
+		map[string]string{
+			"source":  "hwmon",
+			"chip":    "coretemp",
+			"device":  "coretemp.0",
+			"feature": "temp2",
+		})
+	acc.AssertContainsTaggedFields(t, "temp",
+		map[string]interface{}{"temp": 27.8, "crit": 105.0},
+		map[string]string{
+			"source":  "thermal_zone",
+			"chip":    "thermal_zone0",
+			"feature": "acpitz",
+		})
+	acc.AssertContainsTaggedFields(t, "temp",
+		map[string]interface{}{"temp": 46.0},
+		map[string]string{
+			"source":  "thermal_zone",
+			"chip":    "thermal_zone1",
+			"feature": "x86_pkg_temp",
+		})
+}
+
+func TestGatherHwmonOnly(t *testing.T) {
+	dir, cleanup := newSysfs(t)
+	defer cleanup()
+
+	var acc testutil.Accumulator
+	temp := &Temp{SysPath: dir, Hwmon: true}
+	require.NoError(t, temp.Gather(&acc))
+	assert.Len(t, acc.Metrics, 2)
+	for _, m := range acc.Metrics {
+		assert.Equal(t, "hwmon", m.Tags["source"])
+	}
+}
@@ -0,0 +1,157 @@
+package unbound
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+type runner func(u *Unbound) (*bytes.Buffer, error)
+
+// Unbound gathers the statistics of an unbound server with unbound-control.
+type Unbound struct {
+	Binary      string
+	UseSudo     bool
+	Server      string
+	ConfigFile  string `toml:"config_file"`
+	Timeout     internal.Duration
+	ThreadAsTag bool `toml:"thread_as_tag"`
+
+	run runner
+}
+
+var defaultBinary = "/usr/sbin/unbound-control"
+
+var sampleConfig = `
+  ## If running as a restricted user you can prepend sudo for additional access:
+  # use_sudo = false
+
+  ## The default location of the unbound-control binary can be overridden with:
+  # binary = "/usr/sbin/unbound-control"
+
+  ## The address of the server, and the configuration file of unbound-control
+  ## if it is not the default one.
+  # server = "127.0.0.1@8953"
+  # config_file = "/etc/unbound/unbound.conf"
+
+  ## The default timeout of 1s can be overridden with:
+  # timeout = "1s"
+
+  ## Report the statistics of each thread as the unbound_threads measurement
+  ## with a thread tag, instead of as fields of the unbound measurement.
+  # thread_as_tag = false
+`
+
+func (u *Unbound) Description() string {
+	return "A plugin to collect stats from the Unbound DNS resolver"
+}
+
+func (u *Unbound) SampleConfig() string {
+	return sampleConfig
+}
+
+// unboundRunner runs unbound-control stats_noreset, which does not reset the
+// counters, and returns its output.
+func unboundRunner(u *Unbound) (*bytes.Buffer, error) {
+	var args []string
+	if u.Server != "" {
+		args = append(args, "-s", u.Server)
+	}
+	if u.ConfigFile != "" {
+		args = append(args, "-c", u.ConfigFile)
+	}
+	args = append(args, "stats_noreset")
+
+	cmd := exec.Command(u.Binary, args...)
+	if u.UseSudo {
+		cmd = exec.Command("sudo", append([]string{"-n", u.Binary}, args...)...)
+	}
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err := internal.RunTimeout(cmd, u.Timeout.Duration)
+	if err != nil {
+		return &out, fmt.Errorf("error running unbound-control: %s (%s %v)",
+			err, u.Binary, args)
+	}
+	return &out, nil
+}
+
+// Gather adds the statistics, name=value lines such as total.num.queries=12,
+// as fields with the dots replaced by underscores, and the cache hit ratio of
+// the server.
+func (u *Unbound) Gather(acc telegraf.Accumulator) error {
+	out, err := u.run(u)
+	if err != nil {
+		return fmt.Errorf("error gathering metrics: %s", err)
+	}
+
+	fields := make(map[string]interface{})
+	threads := make(map[string]map[string]interface{})
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		cols := strings.SplitN(scanner.Text(), "=", 2)
+		if len(cols) != 2 {
+			continue
+		}
+		stat, value := strings.TrimSpace(cols[0]), strings.TrimSpace(cols[1])
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			acc.AddError(fmt.Errorf("Expected a numeric value for %s = %v",
+				stat, value))
+			continue
+		}
+
+		if u.ThreadAsTag && strings.HasPrefix(stat, "thread") {
+			parts := strings.SplitN(stat, ".", 2)
+			if len(parts) == 2 {
+				thread := strings.TrimPrefix(parts[0], "thread")
+				if threads[thread] == nil {
+					threads[thread] = make(map[string]interface{})
+				}
+				threads[thread][fieldName(parts[1])] = v
+				continue
+			}
+		}
+		fields[fieldName(stat)] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading unbound-control output: %s", err)
+	}
+
+	hits, _ := fields["total_num_cachehits"].(float64)
+	misses, _ := fields["total_num_cachemiss"].(float64)
+	if hits+misses > 0 {
+		fields["cache_hit_ratio"] = hits / (hits + misses)
+	}
+	if len(fields) > 0 {
+		acc.AddFields("unbound", fields, nil)
+	}
+	for thread, fields := range threads {
+		acc.AddFields("unbound_threads", fields,
+			map[string]string{"thread": thread})
+	}
+	return nil
+}
+
+func fieldName(stat string) string {
+	return strings.Replace(stat, ".", "_", -1)
+}
+
+func init() {
+	inputs.Add("unbound", func() telegraf.Input {
+		return &Unbound{
+			run:     unboundRunner,
+			Binary:  defaultBinary,
+			Timeout: internal.Duration{Duration: time.Second},
+		}
+	})
+}
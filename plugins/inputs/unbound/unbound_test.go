@@ -0,0 +1,75 @@
+package unbound
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeUnboundControl(output string) runner {
+	return func(*Unbound) (*bytes.Buffer, error) {
+		return bytes.NewBufferString(output), nil
+	}
+}
+
+func TestGather(t *testing.T) {
+	acc := &testutil.Accumulator{}
+	u := &Unbound{run: fakeUnboundControl(statsOutput)}
+	require.NoError(t, u.Gather(acc))
+
+	require.Len(t, acc.Metrics, 1)
+	acc.AssertContainsFields(t, "unbound", map[string]interface{}{
+		"thread0_num_queries":       float64(11),
+		"thread0_num_cachehits":     float64(9),
+		"thread0_num_cachemiss":     float64(2),
+		"total_num_queries":         float64(11),
+		"total_num_cachehits":       float64(9),
+		"total_num_cachemiss":       float64(2),
+		"total_recursion_time_avg":  0.015,
+		"time_up":                   288.5,
+		"num_query_type_A":          float64(7),
+		"num_query_type_AAAA":       float64(4),
+		"num_answer_rcode_NOERROR":  float64(10),
+		"num_answer_rcode_NXDOMAIN": float64(1),
+		"cache_hit_ratio":           9.0 / 11.0,
+	})
+}
+
+func TestGatherThreadAsTag(t *testing.T) {
+	acc := &testutil.Accumulator{}
+	u := &Unbound{run: fakeUnboundControl(statsOutput), ThreadAsTag: true}
+	require.NoError(t, u.Gather(acc))
+
+	acc.AssertContainsTaggedFields(t, "unbound_threads", map[string]interface{}{
+		"num_queries":   float64(11),
+		"num_cachehits": float64(9),
+		"num_cachemiss": float64(2),
+	}, map[string]string{"thread": "0"})
+	assert.False(t, acc.HasFloatField("unbound", "thread0_num_queries"))
+	assert.True(t, acc.HasFloatField("unbound", "total_num_queries"))
+}
+
+func TestGatherInvalidValue(t *testing.T) {
+	acc := &testutil.Accumulator{}
+	u := &Unbound{run: fakeUnboundControl("total.num.queries=abc\n")}
+	require.NoError(t, u.Gather(acc))
+	assert.Len(t, acc.Errors, 1)
+	assert.False(t, acc.HasMeasurement("unbound"))
+}
+
+var statsOutput = `thread0.num.queries=11
+thread0.num.cachehits=9
+thread0.num.cachemiss=2
+total.num.queries=11
+total.num.cachehits=9
+total.num.cachemiss=2
+total.recursion.time.avg=0.015000
+time.up=288.500000
+num.query.type.A=7
+num.query.type.AAAA=4
+num.answer.rcode.NOERROR=10
+num.answer.rcode.NXDOMAIN=1
+`
@@ -0,0 +1,206 @@
+package bigquery
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const scope = "https://www.googleapis.com/auth/bigquery"
+
+// metadataURL is the endpoint of the GCE metadata server returning the
+// access tokens of the service account of the instance.
+var metadataURL = "http://metadata.google.internal/computeMetadata/v1/" +
+	"instance/service-accounts/default/token"
+
+// credentials returns OAuth2 access tokens, cached until shortly before
+// they expire.
+type credentials struct {
+	fetch func() (*accessToken, error)
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+type accessToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (c *credentials) accessToken() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expiry) {
+		return c.token, nil
+	}
+
+	t, err := c.fetch()
+	if err != nil {
+		return "", fmt.Errorf("unable to get an access token: %s", err)
+	}
+	c.token = t.AccessToken
+	// renewed a minute early, so that it does not expire during a request
+	c.expiry = time.Now().Add(time.Duration(t.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+// serviceAccount is a service account key file.
+type serviceAccount struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// newCredentials returns the credentials of the service account key file,
+// or of $GOOGLE_APPLICATION_CREDENTIALS if file is empty, or else the ones
+// of the instance given by the metadata server.
+func newCredentials(file string, client *http.Client) (*credentials, error) {
+	if file == "" {
+		file = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if file == "" {
+		return &credentials{fetch: func() (*accessToken, error) {
+			return metadataToken(client)
+		}}, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var sa serviceAccount
+	if err := json.Unmarshal(b, &sa); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %s", file, err)
+	}
+	if sa.Type != "service_account" {
+		return nil, fmt.Errorf("invalid credentials file %s: type %q is not "+
+			"supported, only service_account is", file, sa.Type)
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	if sa.key, err = parseKey(sa.PrivateKey); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %s", file, err)
+	}
+	return &credentials{fetch: func() (*accessToken, error) {
+		return sa.token(client)
+	}}, nil
+}
+
+func parseKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not a RSA key")
+	}
+	return rsaKey, nil
+}
+
+// token exchanges a JWT signed by the key of the service account for an
+// access token.
+func (sa *serviceAccount) token(client *http.Client) (*accessToken, error) {
+	assertion, err := sa.assertion(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	resp, err := client.PostForm(sa.TokenURI, form)
+	if err != nil {
+		return nil, err
+	}
+	return decodeToken(resp)
+}
+
+func (sa *serviceAccount) assertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": sa.PrivateKeyID,
+	})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   sa.ClientEmail,
+		"scope": scope,
+		"aud":   sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, sa.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+func metadataToken(client *http.Client) (*accessToken, error) {
+	req, err := http.NewRequest("GET", metadataURL+"?scopes="+url.QueryEscape(scope), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return decodeToken(resp)
+}
+
+func decodeToken(resp *http.Response) (*accessToken, error) {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received status code %d: %s", resp.StatusCode,
+			strings.TrimSpace(string(body)))
+	}
+	var t accessToken
+	if err := json.Unmarshal(body, &t); err != nil {
+		return nil, err
+	}
+	if t.AccessToken == "" {
+		return nil, fmt.Errorf("response without access token")
+	}
+	return &t, nil
+}
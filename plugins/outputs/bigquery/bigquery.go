@@ -0,0 +1,467 @@
+package bigquery
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/outputs"
+)
+
+// appendRowsPath is the gRPC method of the Storage Write API.
+const appendRowsPath = "/google.cloud.bigquery.storage.v1.BigQueryWrite/AppendRows"
+
+// maxRequestSize is the size over which the rows are split in several
+// requests, the API rejects the requests over 10MB.
+const maxRequestSize = 9 * 1024 * 1024
+
+// gRPC status codes
+const (
+	codeResourceExhausted = 8
+)
+
+// BigQuery streams metrics into BigQuery tables with the Storage Write API.
+type BigQuery struct {
+	Project           string
+	Dataset           string
+	Table             string
+	MeasurementColumn string
+	TimestampColumn   string
+	CredentialsFile   string
+	Endpoint          string
+	Timeout           internal.Duration
+	MaxRetries        int
+	RetryBackoff      internal.Duration
+	QuotaPause        internal.Duration
+
+	url         string
+	transport   *http2.Transport
+	client      *http.Client
+	credentials *credentials
+	mapping     *mapping
+	// pausedUntil is the end of the pause of the writes after the quotas
+	// were exceeded
+	pausedUntil time.Time
+}
+
+var sampleConfig = `
+  ## Project and dataset of the tables.
+  project = "my-project"
+  dataset = "telegraf"
+
+  ## Table of the metrics, by default each measurement is written to the
+  ## table of the same name. The tables must exist, with a TIMESTAMP column
+  ## for the time of the metrics, a STRING column for each tag and a column
+  ## for each field: FLOAT64, INT64, BOOL or STRING. The characters of the
+  ## names not allowed in column names are replaced by underscores.
+  # table = "metrics"
+
+  ## Column of the name of the measurement, useful when all the measurements
+  ## are written to the same table.
+  # measurement_column = "measurement"
+
+  ## Column of the time of the metrics.
+  # timestamp_column = "timestamp"
+
+  ## Service account key file, by default the one of
+  ## $GOOGLE_APPLICATION_CREDENTIALS or else the service account of the
+  ## instance given by the metadata server.
+  # credentials_file = "/etc/telegraf/bigquery.json"
+
+  ## Endpoint of the Storage Write API.
+  # endpoint = "https://bigquerystorage.googleapis.com"
+
+  ## Timeout of a request.
+  # timeout = "10s"
+
+  ## Number of retries of a request after a network error or a retryable
+  ## gRPC status (UNAVAILABLE, RESOURCE_EXHAUSTED...), the wait between
+  ## retries starts at retry_backoff and doubles each time.
+  # max_retries = 3
+  # retry_backoff = "1s"
+
+  ## When the quotas are still exceeded after the retries, the writes are
+  ## paused for quota_pause, the metrics are kept in the buffer.
+  # quota_pause = "1m"
+`
+
+func (b *BigQuery) SampleConfig() string {
+	return sampleConfig
+}
+
+func (b *BigQuery) Description() string {
+	return "Stream metrics into BigQuery tables with the Storage Write API"
+}
+
+func (b *BigQuery) Connect() error {
+	if b.Project == "" || b.Dataset == "" {
+		return fmt.Errorf("project and dataset are required fields for bigquery output")
+	}
+	if b.TimestampColumn == "" {
+		return fmt.Errorf("timestamp_column cannot be empty")
+	}
+	u, err := url.Parse(b.Endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %s", b.Endpoint, err)
+	}
+	b.mapping = &mapping{
+		timestampColumn:   b.TimestampColumn,
+		measurementColumn: b.MeasurementColumn,
+	}
+
+	switch u.Scheme {
+	case "https":
+		b.transport = &http2.Transport{TLSClientConfig: &tls.Config{}}
+	case "http":
+		// gRPC without TLS is HTTP/2 over cleartext, ie for an emulator
+		timeout := b.Timeout.Duration
+		b.transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.DialTimeout(network, addr, timeout)
+			},
+		}
+	default:
+		return fmt.Errorf("invalid endpoint %q: scheme must be http or https",
+			b.Endpoint)
+	}
+	b.client = &http.Client{
+		Transport: b.transport,
+		Timeout:   b.Timeout.Duration,
+	}
+	b.url = strings.TrimSuffix(b.Endpoint, "/") + appendRowsPath
+
+	b.credentials, err = newCredentials(b.CredentialsFile,
+		&http.Client{Timeout: b.Timeout.Duration})
+	return err
+}
+
+func (b *BigQuery) Close() error {
+	if b.transport != nil {
+		b.transport.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (b *BigQuery) Write(metrics []telegraf.Metric) error {
+	if now := time.Now(); now.Before(b.pausedUntil) {
+		return fmt.Errorf("quotas exceeded, writes paused for %s",
+			b.pausedUntil.Sub(now))
+	}
+
+	tables := make(map[string][]telegraf.Metric)
+	for _, m := range metrics {
+		table := b.Table
+		if table == "" {
+			table = columnName(m.Name())
+		}
+		tables[table] = append(tables[table], m)
+	}
+	names := make([]string, 0, len(tables))
+	for table := range tables {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+
+	for _, table := range names {
+		t := b.mapping.tableRows(tables[table])
+		for _, req := range b.appendRowsRequests(table, t) {
+			if err := b.send(table, req); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeStream returns the default stream of a table, whose rows are
+// committed as soon as they are written.
+func (b *BigQuery) writeStream(table string) string {
+	return fmt.Sprintf("projects/%s/datasets/%s/tables/%s/streams/_default",
+		b.Project, b.Dataset, table)
+}
+
+// appendRowsRequests returns the AppendRowsRequest messages of the rows,
+// split so that each is under maxRequestSize. Every request is sent in its
+// own stream, so they all hold the schema of the rows.
+func (b *BigQuery) appendRowsRequests(table string, t *tableRows) [][]byte {
+	stream := b.writeStream(table)
+	schema := appendBytes(nil, 1, t.descriptor())
+	overhead := len(stream) + len(schema) + 32
+
+	var reqs [][]byte
+	var rows []byte
+	for i, r := range t.rows {
+		rows = appendBytes(rows, 1, r)
+		last := i == len(t.rows)-1
+		if !last && overhead+len(rows)+len(t.rows[i+1])+16 < maxRequestSize {
+			continue
+		}
+
+		data := appendBytes(nil, 1, schema)
+		data = appendBytes(data, 2, rows)
+		req := appendString(nil, 1, stream)
+		req = appendBytes(req, 4, data)
+		reqs = append(reqs, req)
+		rows = nil
+	}
+	return reqs
+}
+
+// send sends an AppendRows request, retrying the retryable failures. The
+// writes are paused when the quotas are still exceeded after the retries.
+func (b *BigQuery) send(table string, req []byte) error {
+	body := make([]byte, 5, 5+len(req))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(req)))
+	body = append(body, req...)
+
+	backoff := b.RetryBackoff.Duration
+	for attempt := 0; ; attempt++ {
+		err := b.appendRows(table, body)
+		if err == nil {
+			return nil
+		}
+		if !err.retry || attempt >= b.MaxRetries {
+			if err.code == codeResourceExhausted && b.QuotaPause.Duration > 0 {
+				log.Printf("W! BigQuery quotas exceeded, pausing the writes for %s",
+					b.QuotaPause.Duration)
+				b.pausedUntil = time.Now().Add(b.QuotaPause.Duration)
+			}
+			return fmt.Errorf("unable to write to bigquery table %s: %s", table, err)
+		}
+		log.Printf("W! Failed to write to bigquery table %s, retrying in %s: %s",
+			table, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// gRPC status codes worth a retry
+var retryableCodes = map[int]bool{
+	1:                     true, // CANCELLED
+	4:                     true, // DEADLINE_EXCEEDED
+	codeResourceExhausted: true, // RESOURCE_EXHAUSTED
+	10:                    true, // ABORTED
+	13:                    true, // INTERNAL
+	14:                    true, // UNAVAILABLE
+}
+
+// appendError is a failure of an AppendRows call, code is its gRPC status
+// code if any.
+type appendError struct {
+	code  int
+	retry bool
+	msg   string
+}
+
+func (e *appendError) Error() string {
+	return e.msg
+}
+
+func statusError(code int, message string) *appendError {
+	return &appendError{
+		code:  code,
+		retry: retryableCodes[code],
+		msg:   fmt.Sprintf("received gRPC status %d: %s", code, message),
+	}
+}
+
+func (b *BigQuery) appendRows(table string, body []byte) *appendError {
+	token, err := b.credentials.accessToken()
+	if err != nil {
+		return &appendError{retry: true, msg: err.Error()}
+	}
+
+	req, err := http.NewRequest("POST", b.url, bytes.NewReader(body))
+	if err != nil {
+		return &appendError{msg: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("User-Agent", "telegraf")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Goog-Request-Params",
+		"write_stream="+url.QueryEscape(b.writeStream(table)))
+	if b.Timeout.Duration > 0 {
+		req.Header.Set("Grpc-Timeout",
+			strconv.FormatInt(int64(b.Timeout.Duration/time.Millisecond), 10)+"m")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return &appendError{retry: true, msg: err.Error()}
+	}
+	defer resp.Body.Close()
+	// the trailers are only available once the body is read
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &appendError{retry: true, msg: err.Error()}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode == http.StatusTooManyRequests ||
+			resp.StatusCode == http.StatusBadGateway ||
+			resp.StatusCode == http.StatusServiceUnavailable ||
+			resp.StatusCode == http.StatusGatewayTimeout
+		e := &appendError{
+			retry: retry,
+			msg:   fmt.Sprintf("received HTTP status code %d", resp.StatusCode),
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			e.code = codeResourceExhausted
+		}
+		return e
+	}
+
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// trailers-only response
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	if status == "" {
+		return &appendError{retry: true, msg: "response without gRPC status"}
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return &appendError{msg: fmt.Sprintf("invalid gRPC status %q", status)}
+	}
+	if code != 0 {
+		if m, err := url.QueryUnescape(message); err == nil {
+			message = m
+		}
+		return statusError(code, message)
+	}
+
+	// the errors of a stream are reported in its responses
+	for len(respBody) >= 5 {
+		n := int(binary.BigEndian.Uint32(respBody[1:5]))
+		if len(respBody) < 5+n {
+			break
+		}
+		if e := responseError(respBody[5 : 5+n]); e != nil {
+			return e
+		}
+		respBody = respBody[5+n:]
+	}
+	return nil
+}
+
+// responseError returns the error of an AppendRowsResponse, if any: either
+// its status or the first of its row errors, which reject the whole request.
+func responseError(msg []byte) *appendError {
+	var e *appendError
+	var rowErrors int
+	walkFields(msg, func(field int, v uint64, data []byte) {
+		switch field {
+		case 2: // error
+			var code uint64
+			var message string
+			walkFields(data, func(field int, v uint64, data []byte) {
+				switch field {
+				case 1:
+					code = v
+				case 2:
+					message = string(data)
+				}
+			})
+			if code != 0 {
+				e = statusError(int(code), message)
+			}
+		case 4: // row_errors
+			rowErrors++
+			if rowErrors > 1 {
+				return
+			}
+			var index uint64
+			var message string
+			walkFields(data, func(field int, v uint64, data []byte) {
+				switch field {
+				case 1:
+					index = v
+				case 3:
+					message = string(data)
+				}
+			})
+			if e == nil {
+				e = &appendError{msg: fmt.Sprintf("invalid row %d: %s", index, message)}
+			}
+		}
+	})
+	if e != nil && rowErrors > 1 {
+		e.msg += fmt.Sprintf(" (and %d other rows)", rowErrors-1)
+	}
+	return e
+}
+
+// walkFields calls fn for each field of a protobuf message: v is the value
+// of the varint fields, data the one of the length-delimited fields. It
+// stops at the first malformed field.
+func walkFields(b []byte, fn func(field int, v uint64, data []byte)) {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return
+		}
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return
+			}
+			b = b[n:]
+			fn(field, v, nil)
+		case wireFixed64:
+			if len(b) < 8 {
+				return
+			}
+			fn(field, binary.LittleEndian.Uint64(b), nil)
+			b = b[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return
+			}
+			fn(field, 0, b[n:n+int(l)])
+			b = b[n+int(l):]
+		case 5: // fixed32
+			if len(b) < 4 {
+				return
+			}
+			fn(field, uint64(binary.LittleEndian.Uint32(b)), nil)
+			b = b[4:]
+		default:
+			return
+		}
+	}
+}
+
+func init() {
+	outputs.Add("bigquery", func() telegraf.Output {
+		return &BigQuery{
+			TimestampColumn: "timestamp",
+			Endpoint:        "https://bigquerystorage.googleapis.com",
+			Timeout:         internal.Duration{Duration: 10 * time.Second},
+			MaxRetries:      3,
+			RetryBackoff:    internal.Duration{Duration: time.Second},
+			QuotaPause:      internal.Duration{Duration: time.Minute},
+		}
+	})
+}
@@ -0,0 +1,339 @@
+package bigquery
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Unix(1500000000, 0)
+
+func mustMetric(t *testing.T, name string, tags map[string]string, fields map[string]interface{}) telegraf.Metric {
+	m, err := metric.New(name, tags, fields, now)
+	require.NoError(t, err)
+	return m
+}
+
+// message is a decoded protobuf message.
+type message map[int][]interface{}
+
+func decode(b []byte) message {
+	msg := make(message)
+	walkFields(b, func(field int, v uint64, data []byte) {
+		if data != nil {
+			msg[field] = append(msg[field], data)
+		} else {
+			msg[field] = append(msg[field], v)
+		}
+	})
+	return msg
+}
+
+func (m message) sub(field int) []message {
+	var out []message
+	for _, v := range m[field] {
+		out = append(out, decode(v.([]byte)))
+	}
+	return out
+}
+
+func (m message) str(field int) string {
+	return string(m[field][0].([]byte))
+}
+
+// columns returns the columns of a DescriptorProto, by field number.
+func columns(t *testing.T, descriptor message) map[uint64]*column {
+	assert.Equal(t, "Row", descriptor.str(1))
+	cols := make(map[uint64]*column)
+	for _, f := range descriptor.sub(2) {
+		number := f[3][0].(uint64)
+		cols[number] = &column{
+			name:   f.str(1),
+			number: int(number),
+			typ:    int(f[5][0].(uint64)),
+		}
+	}
+	return cols
+}
+
+func TestTableRows(t *testing.T) {
+	mp := &mapping{timestampColumn: "timestamp", measurementColumn: "measurement"}
+	tr := mp.tableRows([]telegraf.Metric{
+		mustMetric(t, "cpu",
+			map[string]string{"host": "a", "cpu-id": "0"},
+			map[string]interface{}{"usage": int64(42), "idle": true}),
+		mustMetric(t, "cpu",
+			map[string]string{"host": "b"},
+			map[string]interface{}{"usage": 12.5, "host": "c"}),
+	})
+
+	cols := columns(t, decode(tr.descriptor()))
+	types := make(map[string]int)
+	for _, c := range cols {
+		types[c.name] = c.typ
+	}
+	assert.Equal(t, map[string]int{
+		"timestamp":   typeInt64,
+		"measurement": typeString,
+		"cpu_id":      typeString,
+		"host":        typeString,
+		"idle":        typeBool,
+		"usage":       typeDouble,
+	}, types)
+
+	require.Len(t, tr.rows, 2)
+	values := func(b []byte) map[string]interface{} {
+		out := make(map[string]interface{})
+		for number, vs := range decode(b) {
+			c := cols[uint64(number)]
+			switch v := vs[0].(type) {
+			case []byte:
+				out[c.name] = string(v)
+			case uint64:
+				if c.typ == typeDouble {
+					out[c.name] = math.Float64frombits(v)
+				} else {
+					out[c.name] = v
+				}
+			}
+		}
+		return out
+	}
+	assert.Equal(t, map[string]interface{}{
+		"timestamp":   uint64(now.UnixNano() / 1000),
+		"measurement": "cpu",
+		"cpu_id":      "0",
+		"host":        "a",
+		"idle":        uint64(1),
+		"usage":       42.0,
+	}, values(tr.rows[0]))
+	// the field takes precedence over the tag
+	assert.Equal(t, "c", values(tr.rows[1])["host"])
+	assert.Equal(t, 12.5, values(tr.rows[1])["usage"])
+}
+
+func TestColumnName(t *testing.T) {
+	assert.Equal(t, "usage_idle", columnName("usage_idle"))
+	assert.Equal(t, "_5m_load", columnName("5m.load"))
+	assert.Equal(t, "http_requests_total", columnName("http-requests total"))
+}
+
+// newServer returns a HTTP/2 server answering the AppendRows calls with the
+// gRPC status and the response messages returned by reply, the
+// AppendRowsRequest messages are sent to reqs.
+func newServer(t *testing.T, reqs chan<- message, reply func() (string, []byte)) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, appendRowsPath, r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Contains(t, r.Header.Get("X-Goog-Request-Params"), "write_stream=projects%2F")
+
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		if assert.True(t, len(body) >= 5) {
+			reqs <- decode(body[5:])
+		}
+
+		status, resp := reply()
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		if resp != nil {
+			frame := make([]byte, 5)
+			binary.BigEndian.PutUint32(frame[1:], uint32(len(resp)))
+			w.Write(append(frame, resp...))
+		}
+		w.Header().Set("Grpc-Status", status)
+		w.Header().Set("Grpc-Message", "quota%20exceeded")
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	return ts
+}
+
+// newBigQuery returns a connected output writing to the server at url, with
+// the tokens of a fake metadata server stopped by the returned function.
+func newBigQuery(t *testing.T, url string) (*BigQuery, func()) {
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+		w.Write([]byte(`{"access_token": "token", "expires_in": 3600}`))
+	}))
+	defaultURL := metadataURL
+	metadataURL = metadata.URL
+	os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+
+	b := &BigQuery{
+		Project:         "my-project",
+		Dataset:         "telegraf",
+		TimestampColumn: "timestamp",
+		Endpoint:        url,
+		Timeout:         internal.Duration{Duration: 5 * time.Second},
+		MaxRetries:      2,
+		RetryBackoff:    internal.Duration{Duration: time.Millisecond},
+		QuotaPause:      internal.Duration{Duration: time.Minute},
+	}
+	require.NoError(t, b.Connect())
+	b.transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return b, func() {
+		b.Close()
+		metadata.Close()
+		metadataURL = defaultURL
+	}
+}
+
+func TestWrite(t *testing.T) {
+	reqs := make(chan message, 10)
+	statuses := []string{"14", "0", "0"}
+	ts := newServer(t, reqs, func() (string, []byte) {
+		s := statuses[0]
+		statuses = statuses[1:]
+		return s, nil
+	})
+	defer ts.Close()
+
+	b, stop := newBigQuery(t, ts.URL)
+	defer stop()
+
+	require.NoError(t, b.Write([]telegraf.Metric{
+		mustMetric(t, "cpu", map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 42.5}),
+		mustMetric(t, "mem", map[string]string{"host": "a"},
+			map[string]interface{}{"used": int64(1024)}),
+		mustMetric(t, "cpu", map[string]string{"host": "b"},
+			map[string]interface{}{"usage": 12.5}),
+	}))
+
+	// UNAVAILABLE then OK for cpu, then mem
+	require.Len(t, reqs, 3)
+	<-reqs
+	for _, table := range []string{"cpu", "mem"} {
+		req := <-reqs
+		assert.Equal(t, "projects/my-project/datasets/telegraf/tables/"+table+
+			"/streams/_default", req.str(1))
+		data := req.sub(4)[0]
+		descriptor := data.sub(1)[0].sub(1)[0]
+		assert.Len(t, columns(t, descriptor), 3)
+		rows := data.sub(2)[0]
+		if table == "cpu" {
+			assert.Len(t, rows[1], 2)
+		} else {
+			assert.Len(t, rows[1], 1)
+		}
+	}
+}
+
+func TestWriteQuotaPause(t *testing.T) {
+	reqs := make(chan message, 10)
+	ts := newServer(t, reqs, func() (string, []byte) { return "8", nil })
+	defer ts.Close()
+
+	b, stop := newBigQuery(t, ts.URL)
+	defer stop()
+
+	metrics := []telegraf.Metric{
+		mustMetric(t, "cpu", nil, map[string]interface{}{"usage": 42.5}),
+	}
+	err := b.Write(metrics)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "received gRPC status 8: quota exceeded")
+	assert.Len(t, reqs, 3)
+
+	// the writes are paused without requests
+	err = b.Write(metrics)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "writes paused")
+	assert.Len(t, reqs, 3)
+}
+
+func TestWriteRowErrors(t *testing.T) {
+	rowError := appendVarintField(nil, 1, 1)
+	rowError = appendString(rowError, 3, "no such field: usage")
+	resp := appendBytes(nil, 4, rowError)
+	resp = appendBytes(resp, 4, rowError)
+
+	reqs := make(chan message, 10)
+	ts := newServer(t, reqs, func() (string, []byte) { return "0", resp })
+	defer ts.Close()
+
+	b, stop := newBigQuery(t, ts.URL)
+	defer stop()
+
+	err := b.Write([]telegraf.Metric{
+		mustMetric(t, "cpu", nil, map[string]interface{}{"usage": 42.5}),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid row 1: no such field: usage (and 1 other rows)")
+	// invalid rows are not retried
+	assert.Len(t, reqs, 1)
+}
+
+func TestServiceAccountToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer",
+			r.FormValue("grant_type"))
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		require.Len(t, parts, 3)
+
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig))
+
+		b, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		var claims map[string]interface{}
+		require.NoError(t, json.Unmarshal(b, &claims))
+		assert.Equal(t, "telegraf@my-project.iam.gserviceaccount.com", claims["iss"])
+		assert.Equal(t, scope, claims["scope"])
+
+		w.Write([]byte(`{"access_token": "token", "expires_in": 3600}`))
+	}))
+	defer ts.Close()
+
+	pemKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	sa, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "telegraf@my-project.iam.gserviceaccount.com",
+		"private_key":  string(pemKey),
+		"token_uri":    ts.URL,
+	})
+	require.NoError(t, err)
+	f, err := ioutil.TempFile("", "bigquery")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(sa)
+	require.NoError(t, err)
+	f.Close()
+
+	c, err := newCredentials(f.Name(), http.DefaultClient)
+	require.NoError(t, err)
+	token, err := c.accessToken()
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+}
@@ -0,0 +1,271 @@
+package bigquery
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// types of the FieldDescriptorProto of the columns
+const (
+	typeDouble = 1
+	typeInt64  = 3
+	typeBool   = 8
+	typeString = 9
+)
+
+// labelOptional is the label of every field of the row descriptor
+const labelOptional = 1
+
+// column is a column of a table, and the field of the row messages holding
+// its values.
+type column struct {
+	name   string
+	number int
+	typ    int
+}
+
+// tableRows holds the rows of the metrics written to a table, encoded as
+// protobuf messages described by the descriptor of their columns.
+type tableRows struct {
+	columns []*column
+	rows    [][]byte
+}
+
+// row is a metric as the values of its columns.
+type row map[string]interface{}
+
+// mapping turns metrics into the rows of the tables.
+type mapping struct {
+	timestampColumn   string
+	measurementColumn string
+}
+
+// tableRows maps the metrics to rows: the time in the timestamp column, the
+// measurement in the measurement column if any, and a column for each tag
+// and each field, named after its key with the characters not allowed in
+// column names replaced by underscores. A field takes precedence over a tag
+// of the same column.
+//
+// The type of a column is the type of its first value, or FLOAT64 for
+// columns holding both integers and floats. The values that do not match
+// the type of their column are dropped.
+func (mp *mapping) tableRows(metrics []telegraf.Metric) *tableRows {
+	rows := make([]row, 0, len(metrics))
+	byName := make(map[string]*column)
+	t := &tableRows{}
+	add := func(name string, v interface{}) {
+		typ, ok := valueType(v)
+		if !ok {
+			return
+		}
+		c, ok := byName[name]
+		if !ok {
+			c = &column{name: name, number: len(t.columns) + 1, typ: typ}
+			byName[name] = c
+			t.columns = append(t.columns, c)
+			return
+		}
+		if c.typ == typeInt64 && typ == typeDouble {
+			c.typ = typeDouble
+		}
+	}
+
+	for _, m := range metrics {
+		r := make(row)
+		var names []string
+		set := func(name string, v interface{}) {
+			if _, ok := r[name]; !ok {
+				names = append(names, name)
+			}
+			r[name] = v
+		}
+
+		set(mp.timestampColumn, m.Time().UnixNano()/int64(time.Microsecond))
+		if mp.measurementColumn != "" {
+			set(mp.measurementColumn, m.Name())
+		}
+		tags := m.Tags()
+		for _, k := range sortedKeys(tags) {
+			set(columnName(k), tags[k])
+		}
+		fields := m.Fields()
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			set(columnName(k), fields[k])
+		}
+
+		for _, name := range names {
+			add(name, r[name])
+		}
+		rows = append(rows, r)
+	}
+
+	for _, r := range rows {
+		t.rows = append(t.rows, t.encodeRow(r))
+	}
+	return t
+}
+
+// encodeRow returns the row as a protobuf message described by the
+// descriptor of the columns.
+func (t *tableRows) encodeRow(r row) []byte {
+	var b []byte
+	for _, c := range t.columns {
+		v, ok := r[c.name]
+		if !ok {
+			continue
+		}
+		switch c.typ {
+		case typeDouble:
+			f, ok := toFloat(v)
+			if !ok {
+				continue
+			}
+			b = appendFixed64Field(b, c.number, math.Float64bits(f))
+		case typeInt64:
+			i, ok := toInt(v)
+			if !ok {
+				continue
+			}
+			b = appendVarintField(b, c.number, uint64(i))
+		case typeBool:
+			bv, ok := v.(bool)
+			if !ok {
+				continue
+			}
+			var i uint64
+			if bv {
+				i = 1
+			}
+			b = appendVarintField(b, c.number, i)
+		case typeString:
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			b = appendString(b, c.number, s)
+		}
+	}
+	return b
+}
+
+// descriptor returns the DescriptorProto of the rows.
+func (t *tableRows) descriptor() []byte {
+	b := appendString(nil, 1, "Row")
+	for _, c := range t.columns {
+		f := appendString(nil, 1, c.name)
+		f = appendVarintField(f, 3, uint64(c.number))
+		f = appendVarintField(f, 4, labelOptional)
+		f = appendVarintField(f, 5, uint64(c.typ))
+		b = appendBytes(b, 2, f)
+	}
+	return b
+}
+
+func valueType(v interface{}) (int, bool) {
+	switch v.(type) {
+	case float64:
+		return typeDouble, true
+	case int64, uint64:
+		return typeInt64, true
+	case bool:
+		return typeBool, true
+	case string:
+		return typeString, true
+	}
+	return 0, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func toInt(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// columnName returns key with the characters not allowed in column names
+// replaced by underscores, prefixed by an underscore if it starts with a
+// digit.
+func columnName(key string) string {
+	b := []byte(key)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	if len(b) > 0 && b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// protobuf wire format
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, field int, wire int) []byte {
+	return appendVarint(b, uint64(field)<<3|uint64(wire))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	return appendVarint(appendTag(b, field, wireVarint), v)
+}
+
+func appendFixed64Field(b []byte, field int, v uint64) []byte {
+	b = appendTag(b, field, wireFixed64)
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24),
+		byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56))
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, s string) []byte {
+	return appendBytes(b, field, []byte(s))
+}
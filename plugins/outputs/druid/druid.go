@@ -0,0 +1,569 @@
+package druid
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// Druid posts metrics as rows of JSON events to a Druid ingestion endpoint,
+// either as a plain array of rows (Tranquility server) or wrapped in an
+// ingestion spec rendered from a template (Overlord tasks).
+type Druid struct {
+	URL           string
+	Datasource    string
+	DatasourceTag string
+	SpecTemplate  string
+
+	// DimensionsInclude and DimensionsExclude select the tags sent as
+	// dimensions
+	DimensionsInclude []string
+	DimensionsExclude []string
+	// Layout is "wide", a row per metric, or "narrow", a row per field
+	Layout string
+	// BodyFormat is the format of the body without SpecTemplate, "array"
+	// or "lines"
+	BodyFormat string
+
+	// KeyTranslation maps strings of the dimension and metric names to
+	// their replacement
+	KeyTranslation map[string]string
+	// EventIDColumn is the column of the event ID of the rows, if set
+	EventIDColumn string `toml:"event_id_column"`
+	// Feeds maps the measurements to the feed of their rows, the others
+	// have the DefaultFeed
+	Feeds       map[string]string
+	DefaultFeed string
+	// CollisionPrefix prefixes the tags colliding with another column
+	CollisionPrefix string
+	// SanitizeKeys replaces the characters of the keys other than letters,
+	// digits and '_' by '_'
+	SanitizeKeys bool
+	Timeout      internal.Duration
+	Username     string
+	Password     string
+
+	ContentEncoding string
+	MaxRetries      int
+	RetryBackoff    internal.Duration
+
+	// Path to CA file
+	SSLCA string `toml:"ssl_ca"`
+	// Path to host cert file
+	SSLCert string `toml:"ssl_cert"`
+	// Path to cert key file
+	SSLKey string `toml:"ssl_key"`
+	// Use SSL but skip chain & host verification
+	InsecureSkipVerify bool
+
+	client   *http.Client
+	spec     *template.Template
+	replacer *strings.Replacer
+	include  filter.Filter
+	exclude  filter.Filter
+
+	// collisions counts the columns renamed, collided holds the keys
+	// already logged.
+	collisions selfstat.Stat
+	collided   map[string]bool
+}
+
+var sampleConfig = `
+  ## URL the rows are posted to, "{datasource}" is replaced by the name of
+  ## the datasource.
+  ##   Tranquility server: "http://localhost:8200/v1/post/{datasource}"
+  ##   Overlord, with spec_template: "http://localhost:8090/druid/indexer/v1/task"
+  url = "http://localhost:8200/v1/post/{datasource}"
+
+  ## Datasource of the rows.
+  datasource = "telegraf"
+  ## If set, the datasource is the value of this tag and the metrics without
+  ## it go to the datasource above.
+  # datasource_tag = "datasource"
+
+  ## Tags sent as dimensions, by glob of their key, before the key
+  ## translation. The tags matching dimensions_exclude, or not matching a
+  ## non empty dimensions_include, are dropped, to keep high cardinality
+  ## tags out of the datasource.
+  # dimensions_include = []
+  # dimensions_exclude = ["container_id", "request_*"]
+
+  ## Layout of the rows: "wide", a row per metric with a column per field,
+  ## or "narrow", a row per field with its name in the "metric" column and
+  ## its value in the "value" column, as the metrics emitted by Druid.
+  # layout = "wide"
+
+  ## Format of the request body: "array", a JSON array of the rows, or
+  ## "lines", the rows one JSON object per line. Ignored with spec_template.
+  # body_format = "array"
+
+  ## Path to a go template of the request body, by default the body is a
+  ## JSON array of the rows. The template is executed with:
+  ##   .Datasource  name of the datasource
+  ##   .Rows        JSON array of the rows
+  ##   .Lines       the rows, one JSON object per line
+  ##   .Dimensions  JSON array of the dimension names, the tags
+  ##   .Metrics     JSON array of the metric names, the fields
+  ## and the json function encodes its argument, ie {{json .Lines}}.
+  # spec_template = "/etc/telegraf/druid-index-task.json.tmpl"
+
+  ## Column of the event ID of the rows, a hash of the name, tags, fields and
+  ## timestamp of their metric, the same as the message key of the kafka
+  ## output with event_id_key. Retried rows having the same ID, it allows to
+  ## drop the duplicates in the ingestion layer. Empty (default) to omit it.
+  # event_id_column = "event_id"
+
+  ## Prefix of the tags whose key is already used by another column, the
+  ## name, timestamp, feed and event ID columns or another tag after the
+  ## translation.
+  # collision_prefix = "tag_"
+
+  ## Replace the characters of the dimension and metric names other than
+  ## letters, digits and "_" by "_", after the key translation.
+  # sanitize_keys = false
+
+  ## Strings replaced in the dimension and metric names, to avoid quoting
+  ## exotic names in Druid SQL. Longer strings are replaced first.
+  # [outputs.druid.key_translation]
+  #   "." = "_"
+  #   "-" = "_"
+
+  ## Request timeout.
+  # timeout = "5s"
+
+  ## Number of retries of a batch after a network error or a 5xx or 429
+  ## response, the wait between retries starts at retry_backoff and doubles
+  ## each time.
+  # max_retries = 3
+  # retry_backoff = "1s"
+
+  ## Compress the request body, "gzip" or "" for none.
+  # content_encoding = "gzip"
+
+  ## HTTP basic authentication.
+  # username = "telegraf"
+  # password = "metricsmetricsmetricsmetrics"
+
+  ## Optional SSL Config
+  # ssl_ca = "/etc/telegraf/ca.pem"
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+  ## Use SSL but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Feed of the rows, written in their "feed" column as in the events
+  ## emitted by Druid, by measurement. The rows of the other measurements
+  ## have the default_feed, or no feed column if it is empty.
+  # default_feed = "metrics"
+  # [outputs.druid.feeds]
+  #   druid_query = "query"
+`
+
+// spec is the data the spec template is executed with.
+type spec struct {
+	Datasource string
+	Rows       string
+	Lines      string
+	Dimensions string
+	Metrics    string
+}
+
+func (d *Druid) SampleConfig() string {
+	return sampleConfig
+}
+
+func (d *Druid) Description() string {
+	return "Send metrics to a Druid ingestion endpoint over HTTP"
+}
+
+func (d *Druid) Connect() error {
+	if d.URL == "" {
+		return fmt.Errorf("url is a required field for druid output")
+	}
+	if d.ContentEncoding != "" && d.ContentEncoding != "gzip" {
+		return fmt.Errorf("unsupported content_encoding %q", d.ContentEncoding)
+	}
+	switch d.Layout {
+	case "", "wide", "narrow":
+	default:
+		return fmt.Errorf("unsupported layout %q", d.Layout)
+	}
+	switch d.BodyFormat {
+	case "", "array", "lines":
+	default:
+		return fmt.Errorf("unsupported body_format %q", d.BodyFormat)
+	}
+	if d.SpecTemplate != "" {
+		buf, err := ioutil.ReadFile(d.SpecTemplate)
+		if err != nil {
+			return fmt.Errorf("unable to read spec_template: %s", err)
+		}
+		t, err := template.New("spec").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				buf, err := json.Marshal(v)
+				return string(buf), err
+			},
+		}).Parse(string(buf))
+		if err != nil {
+			return fmt.Errorf("unable to parse spec_template: %s", err)
+		}
+		d.spec = t
+	}
+	d.replacer = keyReplacer(d.KeyTranslation)
+	var err error
+	if d.include, err = filter.Compile(d.DimensionsInclude); err != nil {
+		return fmt.Errorf("invalid dimensions_include: %s", err)
+	}
+	if d.exclude, err = filter.Compile(d.DimensionsExclude); err != nil {
+		return fmt.Errorf("invalid dimensions_exclude: %s", err)
+	}
+	d.collisions = selfstat.Register("druid", "key_collisions",
+		map[string]string{"url": d.URL})
+	d.collided = make(map[string]bool)
+
+	tlsCfg, err := internal.GetTLSConfig(
+		d.SSLCert, d.SSLKey, d.SSLCA, d.InsecureSkipVerify)
+	if err != nil {
+		return err
+	}
+	d.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsCfg,
+		},
+		Timeout: d.Timeout.Duration,
+	}
+	return nil
+}
+
+func (d *Druid) Close() error {
+	return nil
+}
+
+func (d *Druid) Write(metrics []telegraf.Metric) error {
+	batches := make(map[string][]telegraf.Metric)
+	for _, m := range metrics {
+		ds := d.Datasource
+		if d.DatasourceTag != "" {
+			if v, ok := m.Tags()[d.DatasourceTag]; ok {
+				ds = v
+			}
+		}
+		batches[ds] = append(batches[ds], m)
+	}
+
+	datasources := make([]string, 0, len(batches))
+	for ds := range batches {
+		datasources = append(datasources, ds)
+	}
+	sort.Strings(datasources)
+
+	for _, ds := range datasources {
+		body, err := d.body(ds, batches[ds])
+		if err != nil {
+			return err
+		}
+		if err := d.post(ds, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// body returns the request body of the rows of a datasource.
+func (d *Druid) body(ds string, metrics []telegraf.Metric) ([]byte, error) {
+	rows := make([]json.RawMessage, 0, len(metrics))
+	dimensions := make(map[string]bool)
+	metricNames := make(map[string]bool)
+	for _, m := range metrics {
+		row := map[string]interface{}{
+			"name":      m.Name(),
+			"timestamp": m.Time().UnixNano() / int64(time.Millisecond),
+		}
+		if d.EventIDColumn != "" {
+			row[d.EventIDColumn] = metric.EventID(m)
+		}
+		if feed := d.feed(m.Name()); feed != "" {
+			row["feed"] = feed
+			dimensions["feed"] = true
+		}
+		if d.Layout == "narrow" {
+			// set for each field below
+			row["metric"] = nil
+			row["value"] = nil
+		}
+		// the keys are taken in order, so that the same ones are renamed
+		// whatever the order of the map
+		tags := m.Tags()
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if k == d.DatasourceTag || !d.dimension(k) {
+				continue
+			}
+			dimensions[d.put(row, d.translate(k), d.CollisionPrefix, tags[k])] = true
+		}
+		// fields are prefixed by the measurement so that they seldom
+		// collide with the dimensions
+		fields := m.Fields()
+		keys = keys[:0]
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		if d.Layout != "narrow" {
+			for _, k := range keys {
+				name := d.put(row, d.translate(m.Name()+"_"+k), "", fields[k])
+				metricNames[name] = true
+			}
+			buf, err := json.Marshal(row)
+			if err != nil {
+				return nil, fmt.Errorf("unable to marshal row: %s", err)
+			}
+			rows = append(rows, buf)
+			continue
+		}
+
+		dimensions["metric"] = true
+		metricNames["value"] = true
+		for _, k := range keys {
+			row["metric"] = d.translate(m.Name() + "_" + k)
+			row["value"] = fields[k]
+			if d.EventIDColumn != "" {
+				// the rows of a metric must not be deduplicated
+				row[d.EventIDColumn] = metric.EventID(m) + "/" + k
+			}
+			buf, err := json.Marshal(row)
+			if err != nil {
+				return nil, fmt.Errorf("unable to marshal row: %s", err)
+			}
+			rows = append(rows, buf)
+		}
+	}
+
+	lines := make([][]byte, len(rows))
+	for i, row := range rows {
+		lines[i] = row
+	}
+	if d.spec == nil && d.BodyFormat == "lines" {
+		return bytes.Join(lines, []byte("\n")), nil
+	}
+
+	buf, err := json.Marshal(rows)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal rows: %s", err)
+	}
+	if d.spec == nil {
+		return buf, nil
+	}
+
+	dimensions["name"] = true
+	if d.EventIDColumn != "" {
+		dimensions[d.EventIDColumn] = true
+	}
+	var out bytes.Buffer
+	err = d.spec.Execute(&out, spec{
+		Datasource: ds,
+		Rows:       string(buf),
+		Lines:      string(bytes.Join(lines, []byte("\n"))),
+		Dimensions: jsonKeys(dimensions),
+		Metrics:    jsonKeys(metricNames),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to execute spec_template: %s", err)
+	}
+	return out.Bytes(), nil
+}
+
+// post sends body, retrying with an exponential backoff while the error is
+// temporary.
+func (d *Druid) post(ds string, body []byte) error {
+	if d.ContentEncoding == "gzip" {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	url := strings.Replace(d.URL, "{datasource}", ds, -1)
+	backoff := d.RetryBackoff.Duration
+	for attempt := 0; ; attempt++ {
+		retry, err := d.send(url, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= d.MaxRetries {
+			return fmt.Errorf("unable to write to druid datasource %s: %s", ds, err)
+		}
+		log.Printf("W! Failed to write to druid datasource %s, retrying in %s: %s",
+			ds, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// send posts body to url, it returns whether a failure is worth a retry.
+func (d *Druid) send(url string, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.ContentEncoding == "gzip" {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if d.Username != "" || d.Password != "" {
+		req.SetBasicAuth(d.Username, d.Password)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	msg, _ := ioutil.ReadAll(resp.Body)
+	err = fmt.Errorf("received status code %d: %s", resp.StatusCode,
+		strings.TrimSpace(string(msg)))
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, err
+}
+
+// dimension reports whether a tag is sent as a dimension.
+func (d *Druid) dimension(key string) bool {
+	if d.include != nil && !d.include.Match(key) {
+		return false
+	}
+	return d.exclude == nil || !d.exclude.Match(key)
+}
+
+// feed returns the feed of the rows of a measurement.
+func (d *Druid) feed(name string) string {
+	if feed, ok := d.Feeds[name]; ok {
+		return feed
+	}
+	return d.DefaultFeed
+}
+
+// put sets a column of the row and returns its key. A key already used, by
+// the name, timestamp, event ID, feed, metric or value columns or by another tag or field whose
+// key was the same after the translation, is prefixed then suffixed by a
+// number until it is free.
+func (d *Druid) put(row map[string]interface{}, key, prefix string, v interface{}) string {
+	if _, ok := row[key]; !ok {
+		row[key] = v
+		return key
+	}
+
+	renamed := prefix + key
+	for i := 2; ; i++ {
+		if _, ok := row[renamed]; !ok {
+			break
+		}
+		renamed = fmt.Sprintf("%s%s_%d", prefix, key, i)
+	}
+	row[renamed] = v
+	d.collisions.Incr(1)
+	if !d.collided[renamed] {
+		d.collided[renamed] = true
+		log.Printf("W! [outputs.druid] The column %s is already used, "+
+			"written as %s", key, renamed)
+	}
+	return renamed
+}
+
+// translate applies the key translation and sanitization to a dimension or
+// metric name.
+func (d *Druid) translate(key string) string {
+	if d.replacer != nil {
+		key = d.replacer.Replace(key)
+	}
+	if d.SanitizeKeys {
+		key = strings.Map(sanitize, key)
+	}
+	return key
+}
+
+func sanitize(r rune) rune {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return r
+	}
+	return '_'
+}
+
+// keyReplacer returns a replacer of the translation, longer strings first,
+// or nil if there is nothing to replace.
+func keyReplacer(translation map[string]string) *strings.Replacer {
+	olds := make([]string, 0, len(translation))
+	for old := range translation {
+		if old != "" {
+			olds = append(olds, old)
+		}
+	}
+	if len(olds) == 0 {
+		return nil
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		if len(olds[i]) != len(olds[j]) {
+			return len(olds[i]) > len(olds[j])
+		}
+		return olds[i] < olds[j]
+	})
+	pairs := make([]string, 0, 2*len(olds))
+	for _, old := range olds {
+		pairs = append(pairs, old, translation[old])
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+func jsonKeys(m map[string]bool) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf, _ := json.Marshal(keys)
+	return string(buf)
+}
+
+func init() {
+	outputs.Add("druid", func() telegraf.Output {
+		return &Druid{
+			Datasource:      "telegraf",
+			Layout:          "wide",
+			BodyFormat:      "array",
+			CollisionPrefix: "tag_",
+			Timeout:         internal.Duration{Duration: 5 * time.Second},
+			MaxRetries:      3,
+			RetryBackoff:    internal.Duration{Duration: time.Second},
+		}
+	})
+}
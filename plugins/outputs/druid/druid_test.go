@@ -0,0 +1,421 @@
+package druid
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMetrics(t *testing.T) []telegraf.Metric {
+	now := time.Unix(1500000000, 0)
+	m1, err := metric.New("cpu",
+		map[string]string{"host": "a", "datasource": "infra"},
+		map[string]interface{}{"usage": 42.5},
+		now)
+	require.NoError(t, err)
+	m2, err := metric.New("requests",
+		map[string]string{"host": "b"},
+		map[string]interface{}{"count": int64(3)},
+		now)
+	require.NoError(t, err)
+	return []telegraf.Metric{m1, m2}
+}
+
+func newDruid(url string) *Druid {
+	return &Druid{
+		URL:             url + "/v1/post/{datasource}",
+		Datasource:      "telegraf",
+		CollisionPrefix: "tag_",
+	}
+}
+
+func TestWrite(t *testing.T) {
+	bodies := make(map[string][]map[string]interface{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var rows []map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&rows))
+		bodies[r.URL.Path] = rows
+	}))
+	defer ts.Close()
+
+	d := newDruid(ts.URL)
+	d.DatasourceTag = "datasource"
+	require.NoError(t, d.Connect())
+	require.NoError(t, d.Write(testMetrics(t)))
+
+	assert.Equal(t, map[string][]map[string]interface{}{
+		"/v1/post/infra": {{
+			"timestamp": float64(1500000000000),
+			"name":      "cpu",
+			"host":      "a",
+			"cpu_usage": 42.5,
+		}},
+		"/v1/post/telegraf": {{
+			"timestamp":      float64(1500000000000),
+			"name":           "requests",
+			"host":           "b",
+			"requests_count": float64(3),
+		}},
+	}, bodies)
+}
+
+func TestWriteKeyTranslation(t *testing.T) {
+	var rows []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&rows))
+	}))
+	defer ts.Close()
+
+	m, err := metric.New("disk.io",
+		map[string]string{"kube.pod-name": "web-1", "host": "a"},
+		map[string]interface{}{"read-bytes": int64(4096)},
+		time.Unix(1500000000, 0))
+	require.NoError(t, err)
+
+	d := newDruid(ts.URL)
+	d.KeyTranslation = map[string]string{".": "_", "-": "_", "pod-name": "pod"}
+	require.NoError(t, d.Connect())
+	require.NoError(t, d.Write([]telegraf.Metric{m}))
+
+	assert.Equal(t, []map[string]interface{}{{
+		"timestamp":          float64(1500000000000),
+		"name":               "disk.io",
+		"host":               "a",
+		"kube_pod":           "web-1",
+		"disk_io_read_bytes": float64(4096),
+	}}, rows)
+}
+
+func TestWriteKeyCollisions(t *testing.T) {
+	var rows []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&rows))
+	}))
+	defer ts.Close()
+
+	m, err := metric.New("cpu",
+		map[string]string{
+			"name":      "x",
+			"timestamp": "y",
+			"event_id":  "z",
+			"a.b":       "1",
+			"a_b":       "2",
+			"cpu_usage": "3",
+		},
+		map[string]interface{}{"usage": 42.5},
+		time.Unix(1500000000, 0))
+	require.NoError(t, err)
+
+	d := newDruid(ts.URL)
+	d.EventIDColumn = "event_id"
+	d.KeyTranslation = map[string]string{".": "_"}
+	require.NoError(t, d.Connect())
+	for i := 0; i < 2; i++ {
+		require.NoError(t, d.Write([]telegraf.Metric{m}))
+		assert.Equal(t, []map[string]interface{}{{
+			"timestamp":     float64(1500000000000),
+			"name":          "cpu",
+			"event_id":      metric.EventID(m),
+			"tag_name":      "x",
+			"tag_timestamp": "y",
+			"tag_event_id":  "z",
+			"a_b":           "1",
+			"tag_a_b":       "2",
+			"cpu_usage":     "3",
+			"cpu_usage_2":   42.5,
+		}}, rows)
+	}
+	assert.Equal(t, int64(10), d.collisions.Get())
+}
+
+func TestWriteSanitizeKeys(t *testing.T) {
+	var rows []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&rows))
+	}))
+	defer ts.Close()
+
+	m, err := metric.New("disk.io",
+		map[string]string{"kube/pod name": "web-1", "kube_pod_name": "web-2", "name": "sda"},
+		map[string]interface{}{"read-bytes": int64(4096)},
+		time.Unix(1500000000, 0))
+	require.NoError(t, err)
+
+	d := newDruid(ts.URL)
+	d.SanitizeKeys = true
+	d.CollisionPrefix = "dim_"
+	d.KeyTranslation = map[string]string{"-": ""}
+	require.NoError(t, d.Connect())
+	require.NoError(t, d.Write([]telegraf.Metric{m}))
+
+	assert.Equal(t, []map[string]interface{}{{
+		"timestamp":         float64(1500000000000),
+		"name":              "disk.io",
+		"dim_name":          "sda",
+		"kube_pod_name":     "web-1",
+		"dim_kube_pod_name": "web-2",
+		"disk_io_readbytes": float64(4096),
+	}}, rows)
+}
+
+func TestWriteDimensionsFilter(t *testing.T) {
+	var rows []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rows = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&rows))
+	}))
+	defer ts.Close()
+
+	m, err := metric.New("http",
+		map[string]string{
+			"host":         "a",
+			"region":       "eu",
+			"container_id": "3f2a",
+			"request_id":   "7c1e",
+		},
+		map[string]interface{}{"latency": 0.25},
+		time.Unix(1500000000, 0))
+	require.NoError(t, err)
+
+	d := newDruid(ts.URL)
+	d.DimensionsExclude = []string{"container_id", "request_*"}
+	require.NoError(t, d.Connect())
+	require.NoError(t, d.Write([]telegraf.Metric{m}))
+	assert.Equal(t, []map[string]interface{}{{
+		"timestamp":    float64(1500000000000),
+		"name":         "http",
+		"host":         "a",
+		"region":       "eu",
+		"http_latency": 0.25,
+	}}, rows)
+
+	d.DimensionsInclude = []string{"h*", "request_id"}
+	require.NoError(t, d.Connect())
+	require.NoError(t, d.Write([]telegraf.Metric{m}))
+	assert.Equal(t, []map[string]interface{}{{
+		"timestamp":    float64(1500000000000),
+		"name":         "http",
+		"host":         "a",
+		"http_latency": 0.25,
+	}}, rows)
+}
+
+func TestWriteFeeds(t *testing.T) {
+	var rows []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&rows))
+	}))
+	defer ts.Close()
+
+	m, err := metric.New("druid_query",
+		map[string]string{"feed": "x"},
+		map[string]interface{}{"time": int64(12)},
+		time.Unix(1500000000, 0))
+	require.NoError(t, err)
+
+	d := newDruid(ts.URL)
+	d.Feeds = map[string]string{"druid_query": "query"}
+	require.NoError(t, d.Connect())
+	require.NoError(t, d.Write(append(testMetrics(t), m)))
+
+	require.Len(t, rows, 3)
+	// no default feed
+	assert.NotContains(t, rows[0], "feed")
+	assert.Equal(t, "query", rows[2]["feed"])
+	assert.Equal(t, "x", rows[2]["tag_feed"])
+
+	d.DefaultFeed = "metrics"
+	require.NoError(t, d.Write(append(testMetrics(t), m)))
+	require.Len(t, rows, 3)
+	assert.Equal(t, "metrics", rows[0]["feed"])
+	assert.Equal(t, "metrics", rows[1]["feed"])
+	assert.Equal(t, "query", rows[2]["feed"])
+}
+
+func TestWriteEventID(t *testing.T) {
+	var rows []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&rows))
+	}))
+	defer ts.Close()
+
+	d := newDruid(ts.URL)
+	d.EventIDColumn = "event_id"
+	require.NoError(t, d.Connect())
+	metrics := testMetrics(t)
+	require.NoError(t, d.Write(metrics))
+
+	require.Len(t, rows, 2)
+	for i, m := range metrics {
+		assert.Equal(t, metric.EventID(m), rows[i]["event_id"])
+	}
+	assert.NotEqual(t, rows[0]["event_id"], rows[1]["event_id"])
+}
+
+func TestWriteNarrow(t *testing.T) {
+	var rows []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&rows))
+	}))
+	defer ts.Close()
+
+	m, err := metric.New("cpu",
+		map[string]string{"host": "a", "metric": "x"},
+		map[string]interface{}{"usage_idle": 98.5, "usage_user": 1.5},
+		time.Unix(1500000000, 0))
+	require.NoError(t, err)
+
+	d := newDruid(ts.URL)
+	d.Layout = "narrow"
+	d.EventIDColumn = "event_id"
+	require.NoError(t, d.Connect())
+	require.NoError(t, d.Write([]telegraf.Metric{m}))
+
+	id := metric.EventID(m)
+	assert.Equal(t, []map[string]interface{}{{
+		"timestamp":  float64(1500000000000),
+		"name":       "cpu",
+		"host":       "a",
+		"tag_metric": "x",
+		"metric":     "cpu_usage_idle",
+		"value":      98.5,
+		"event_id":   id + "/usage_idle",
+	}, {
+		"timestamp":  float64(1500000000000),
+		"name":       "cpu",
+		"host":       "a",
+		"tag_metric": "x",
+		"metric":     "cpu_usage_user",
+		"value":      1.5,
+		"event_id":   id + "/usage_user",
+	}}, rows)
+
+	d.Layout = "tall"
+	assert.Error(t, d.Connect())
+}
+
+func TestWriteBodyFormatLines(t *testing.T) {
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	d := newDruid(ts.URL)
+	d.BodyFormat = "lines"
+	require.NoError(t, d.Connect())
+	require.NoError(t, d.Write(testMetrics(t)))
+	assert.Equal(t, `{"cpu_usage":42.5,"datasource":"infra","host":"a","name":"cpu","timestamp":1500000000000}
+{"host":"b","name":"requests","requests_count":3,"timestamp":1500000000000}`, string(body))
+
+	d.BodyFormat = "csv"
+	assert.Error(t, d.Connect())
+}
+
+func TestWriteGzipBasicAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "telegraf" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		var rows []map[string]interface{}
+		assert.NoError(t, json.NewDecoder(gz).Decode(&rows))
+		assert.Len(t, rows, 2)
+	}))
+	defer ts.Close()
+
+	d := newDruid(ts.URL)
+	d.ContentEncoding = "gzip"
+	require.NoError(t, d.Connect())
+	assert.Error(t, d.Write(testMetrics(t)))
+
+	d.Username = "telegraf"
+	d.Password = "secret"
+	assert.NoError(t, d.Write(testMetrics(t)))
+}
+
+func TestWriteRetry(t *testing.T) {
+	var requests, failures int
+	status := http.StatusServiceUnavailable
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if failures > 0 {
+			failures--
+			w.WriteHeader(status)
+		}
+	}))
+	defer ts.Close()
+
+	d := newDruid(ts.URL)
+	d.MaxRetries = 2
+	d.RetryBackoff.Duration = time.Millisecond
+	require.NoError(t, d.Connect())
+
+	failures = 2
+	require.NoError(t, d.Write(testMetrics(t)))
+	assert.Equal(t, 3, requests)
+
+	// give up after max_retries
+	requests, failures = 0, 10
+	require.Error(t, d.Write(testMetrics(t)))
+	assert.Equal(t, 3, requests)
+
+	// client errors are not retried
+	requests, failures = 0, 10
+	status = http.StatusBadRequest
+	require.Error(t, d.Write(testMetrics(t)))
+	assert.Equal(t, 1, requests)
+}
+
+func TestWriteSpecTemplate(t *testing.T) {
+	f, err := ioutil.TempFile("", "druid-spec")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{"type": "index", "spec": {` +
+		`"dataSchema": {"dataSource": "{{.Datasource}}", ` +
+		`"dimensions": {{.Dimensions}}, "metrics": {{.Metrics}}}, ` +
+		`"rows": {{.Rows}}, "lines": {{json .Lines}}}}`)
+	require.NoError(t, err)
+	f.Close()
+
+	var body map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/druid/indexer/v1/task", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer ts.Close()
+
+	d := &Druid{
+		URL:          ts.URL + "/druid/indexer/v1/task",
+		Datasource:   "telegraf",
+		SpecTemplate: f.Name(),
+	}
+	require.NoError(t, d.Connect())
+	require.NoError(t, d.Write(testMetrics(t)))
+
+	spec := body["spec"].(map[string]interface{})
+	schema := spec["dataSchema"].(map[string]interface{})
+	assert.Equal(t, "telegraf", schema["dataSource"])
+	assert.Equal(t, []interface{}{"datasource", "host", "name"}, schema["dimensions"])
+	assert.Equal(t, []interface{}{"cpu_usage", "requests_count"}, schema["metrics"])
+	assert.Len(t, spec["rows"], 2)
+	assert.Equal(t, `{"cpu_usage":42.5,"datasource":"infra","host":"a","name":"cpu","timestamp":1500000000000}
+{"host":"b","name":"requests","requests_count":3,"timestamp":1500000000000}`, spec["lines"])
+}
@@ -1,9 +1,14 @@
 package file
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/plugins/outputs"
@@ -11,18 +16,60 @@ import (
 )
 
 type File struct {
-	Files []string
+	Files        []string
+	FileTemplate string
+	ArrayFraming string
 
+	// files is the destination of the metrics when there is no
+	// file_template, templated are the files opened by the template
+	files     *destination
+	template  *template.Template
+	templated map[string]*destination
+
+	serializer serializers.Serializer
+}
+
+// destination is one or more files receiving the same metrics.
+type destination struct {
 	writer  io.Writer
 	closers []io.Closer
 
-	serializer serializers.Serializer
+	// elements is the number of metrics in the current JSON array, written
+	// is the part of them that is already written
+	elements int
+	written  int
+	buf      bytes.Buffer
+}
+
+// fileData is the data the file_template is executed with.
+type fileData struct {
+	metric telegraf.Metric
+}
+
+func (d fileData) Name() string {
+	return sanitizePath(d.metric.Name())
+}
+
+func (d fileData) Tag(key string) string {
+	return sanitizePath(d.metric.Tags()[key])
 }
 
 var sampleConfig = `
   ## Files to write to, "stdout" is a specially handled file.
   files = ["stdout", "/tmp/metrics.out"]
 
+  ## Write each metric to the file named by this go template instead of the
+  ## files above, ie one file per datasource. .Name is the measurement and
+  ## .Tag returns the value of a tag. Directories are created as needed.
+  # file_template = '/tmp/metrics/{{.Tag "datasource"}}.out'
+
+  ## Wrap the metrics in JSON arrays, for the json data format:
+  ##   "batch"  an array per line for each batch of metrics
+  ##   "stream" a single array per file, closed when telegraf stops. Files
+  ##            are truncated when telegraf starts.
+  ## By default the metrics are written one after the other.
+  # array_framing = "batch"
+
   ## Data format to output.
   ## Each data format has its own unique set of configuration options, read
   ## more about them here:
@@ -35,44 +82,75 @@ func (f *File) SetSerializer(serializer serializers.Serializer) {
 }
 
 func (f *File) Connect() error {
-	writers := []io.Writer{}
+	switch f.ArrayFraming {
+	case "", "batch", "stream":
+	default:
+		return fmt.Errorf("invalid array_framing %q", f.ArrayFraming)
+	}
+
+	if f.FileTemplate != "" {
+		t, err := template.New("file").Parse(f.FileTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid file_template: %s", err)
+		}
+		f.template = t
+		f.templated = make(map[string]*destination)
+		if len(f.Files) == 0 {
+			return nil
+		}
+	}
 
 	if len(f.Files) == 0 {
 		f.Files = []string{"stdout"}
 	}
 
+	writers := []io.Writer{}
+	f.files = &destination{}
 	for _, file := range f.Files {
 		if file == "stdout" {
 			writers = append(writers, os.Stdout)
 		} else {
-			var of *os.File
-			var err error
-			if _, err := os.Stat(file); os.IsNotExist(err) {
-				of, err = os.Create(file)
-			} else {
-				of, err = os.OpenFile(file, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
-			}
-
+			of, err := f.open(file)
 			if err != nil {
 				return err
 			}
 			writers = append(writers, of)
-			f.closers = append(f.closers, of)
+			f.files.closers = append(f.files.closers, of)
 		}
 	}
-	f.writer = io.MultiWriter(writers...)
+	f.files.writer = io.MultiWriter(writers...)
 	return nil
 }
 
+// open opens file for appending, or truncates it for the stream framing
+// which writes a single JSON document per file.
+func (f *File) open(file string) (*os.File, error) {
+	if f.ArrayFraming == "stream" {
+		return os.Create(file)
+	}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return os.Create(file)
+	}
+	return os.OpenFile(file, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
+}
+
 func (f *File) Close() error {
 	var errS string
-	for _, c := range f.closers {
-		if err := c.Close(); err != nil {
+	dests := []*destination{}
+	if f.files != nil {
+		dests = append(dests, f.files)
+	}
+	for _, d := range f.templated {
+		dests = append(dests, d)
+	}
+	for _, d := range dests {
+		if err := d.close(f.ArrayFraming); err != nil {
 			errS += err.Error() + "\n"
 		}
 	}
+	f.templated = nil
 	if errS != "" {
-		return fmt.Errorf(errS)
+		return errors.New(errS)
 	}
 	return nil
 }
@@ -90,19 +168,131 @@ func (f *File) Write(metrics []telegraf.Metric) error {
 		return nil
 	}
 
+	// serialize everything first so that a bad metric or file does not
+	// leave a batch half written
+	var dests []*destination
 	for _, metric := range metrics {
-		b, err := f.serializer.Serialize(metric)
-		if err != nil {
-			return fmt.Errorf("failed to serialize message: %s", err)
+		d, err := f.destination(metric)
+		if err == nil {
+			var b []byte
+			b, err = f.serializer.Serialize(metric)
+			if err != nil {
+				err = fmt.Errorf("failed to serialize message: %s", err)
+			} else {
+				if d.buf.Len() == 0 {
+					dests = append(dests, d)
+				}
+				d.add(b, f.ArrayFraming)
+			}
 		}
-		_, err = f.writer.Write(b)
 		if err != nil {
-			return fmt.Errorf("failed to write message: %s, %s", metric.Serialize(), err)
+			for _, d := range dests {
+				d.discard()
+			}
+			return err
+		}
+	}
+
+	for _, d := range dests {
+		if err := d.flush(f.ArrayFraming); err != nil {
+			return fmt.Errorf("failed to write messages: %s", err)
 		}
 	}
 	return nil
 }
 
+// destination returns where metric is written, opening the templated file
+// if needed.
+func (f *File) destination(metric telegraf.Metric) (*destination, error) {
+	if f.template == nil {
+		return f.files, nil
+	}
+
+	var buf bytes.Buffer
+	if err := f.template.Execute(&buf, fileData{metric}); err != nil {
+		return nil, fmt.Errorf("failed to execute file_template: %s", err)
+	}
+	file := buf.String()
+	if d, ok := f.templated[file]; ok {
+		return d, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	of, err := f.open(file)
+	if err != nil {
+		return nil, err
+	}
+	d := &destination{writer: of, closers: []io.Closer{of}}
+	f.templated[file] = d
+	return d, nil
+}
+
+func (d *destination) add(b []byte, framing string) {
+	if framing == "" {
+		d.buf.Write(b)
+		return
+	}
+
+	switch {
+	case d.elements == 0:
+		d.buf.WriteString("[")
+	case framing == "stream":
+		d.buf.WriteString(",\n")
+	default:
+		d.buf.WriteString(",")
+	}
+	d.buf.Write(bytes.TrimSpace(b))
+	d.elements++
+}
+
+func (d *destination) flush(framing string) error {
+	if framing == "batch" {
+		d.buf.WriteString("]\n")
+		d.elements = 0
+	}
+	d.written = d.elements
+	_, err := d.writer.Write(d.buf.Bytes())
+	d.buf.Reset()
+	return err
+}
+
+func (d *destination) discard() {
+	d.buf.Reset()
+	d.elements = d.written
+}
+
+func (d *destination) close(framing string) error {
+	var errS string
+	if framing == "stream" && d.elements > 0 {
+		if _, err := d.writer.Write([]byte("]\n")); err != nil {
+			errS += err.Error() + "\n"
+		}
+		d.elements = 0
+	}
+	for _, c := range d.closers {
+		if err := c.Close(); err != nil {
+			errS += err.Error() + "\n"
+		}
+	}
+	if errS != "" {
+		return errors.New(errS)
+	}
+	return nil
+}
+
+// sanitizePath prevents tag values from escaping the directory of the
+// file_template.
+func sanitizePath(s string) string {
+	s = strings.Replace(s, "/", "_", -1)
+	s = strings.Replace(s, string(os.PathSeparator), "_", -1)
+	if s == ".." {
+		return "_"
+	}
+	return s
+}
+
 func init() {
 	outputs.Add("file", func() telegraf.Output {
 		return &File{}
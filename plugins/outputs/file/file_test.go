@@ -6,10 +6,13 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/influxdata/telegraf/testutil"
 )
@@ -170,6 +173,59 @@ func TestFileStdout(t *testing.T) {
 	assert.Equal(t, expNewFile, out)
 }
 
+func TestFileTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, _ := serializers.NewInfluxSerializer()
+	f := File{
+		FileTemplate: dir + `/{{.Name}}/{{or (.Tag "tag1") "none"}}.out`,
+		serializer:   s,
+	}
+	assert.NoError(t, f.Connect())
+
+	m1, _ := metric.New("test1", map[string]string{"tag1": "value1"},
+		map[string]interface{}{"value": 1.0}, time.Unix(0, 0))
+	m2, _ := metric.New("test1", map[string]string{"tag1": "../value2"},
+		map[string]interface{}{"value": 2.0}, time.Unix(0, 0))
+	m3, _ := metric.New("test1", map[string]string{},
+		map[string]interface{}{"value": 3.0}, time.Unix(0, 0))
+	assert.NoError(t, f.Write([]telegraf.Metric{m1, m2, m3, m1}))
+	assert.NoError(t, f.Close())
+
+	validateFile(dir+"/test1/value1.out", "test1,tag1=value1 value=1 0\n"+
+		"test1,tag1=value1 value=1 0\n", t)
+	validateFile(dir+"/test1/.._value2.out", "test1,tag1=../value2 value=2 0\n", t)
+	validateFile(dir+"/test1/none.out", "test1 value=3 0\n", t)
+}
+
+func TestFileArrayFraming(t *testing.T) {
+	s, _ := serializers.NewJsonSerializer(time.Second)
+	m, _ := metric.New("test1", map[string]string{"tag1": "value1"},
+		map[string]interface{}{"value": 1.0}, time.Unix(1, 0))
+	exp := `{"fields":{"value":1},"name":"test1","tags":{"tag1":"value1"},"timestamp":1}`
+
+	fh := tmpFile()
+	f := File{
+		Files:        []string{fh},
+		ArrayFraming: "batch",
+		serializer:   s,
+	}
+	assert.NoError(t, f.Connect())
+	assert.NoError(t, f.Write([]telegraf.Metric{m, m}))
+	assert.NoError(t, f.Write([]telegraf.Metric{m}))
+	assert.NoError(t, f.Close())
+	validateFile(fh, "["+exp+","+exp+"]\n["+exp+"]\n", t)
+
+	f.ArrayFraming = "stream"
+	assert.NoError(t, f.Connect())
+	assert.NoError(t, f.Write([]telegraf.Metric{m, m}))
+	assert.NoError(t, f.Write([]telegraf.Metric{m}))
+	assert.NoError(t, f.Close())
+	validateFile(fh, "["+exp+",\n"+exp+",\n"+exp+"]\n", t)
+}
+
 func createFile() *os.File {
 	f, err := ioutil.TempFile("", "")
 	if err != nil {
@@ -0,0 +1,351 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"github.com/influxdata/telegraf/plugins/serializers"
+	jsonserializer "github.com/influxdata/telegraf/plugins/serializers/json"
+	"github.com/influxdata/telegraf/plugins/serializers/msgpack"
+)
+
+// HTTP sends batches of serialized metrics to an HTTP endpoint.
+type HTTP struct {
+	URL             string
+	Method          string
+	Headers         map[string]string
+	ContentType     string
+	Timeout         internal.Duration
+	Username        string
+	Password        string
+	BearerToken     string `toml:"bearer_token"`
+	ContentEncoding string
+	MaxBatchSize    int
+	BatchFormat     string
+	BodyTemplate    string
+	MaxRetries      int
+	RetryBackoff    internal.Duration
+
+	// Path to CA file
+	SSLCA string `toml:"ssl_ca"`
+	// Path to host cert file
+	SSLCert string `toml:"ssl_cert"`
+	// Path to cert key file
+	SSLKey string `toml:"ssl_key"`
+	// Use SSL but skip chain & host verification
+	InsecureSkipVerify bool
+
+	client     *http.Client
+	serializer serializers.Serializer
+	template   *template.Template
+}
+
+var sampleConfig = `
+  ## URL the batches are sent to.
+  url = "http://127.0.0.1:8080/metrics"
+
+  ## HTTP method, POST or PUT.
+  # method = "POST"
+
+  ## Additional HTTP headers.
+  # [outputs.http.headers]
+  #   X-Source = "telegraf"
+
+  ## Content type of the requests, by default application/json for the json
+  ## data format, application/msgpack for msgpack, else text/plain.
+  # content_type = "text/plain; charset=utf-8"
+
+  ## Request timeout.
+  # timeout = "5s"
+
+  ## HTTP basic authentication.
+  # username = "telegraf"
+  # password = "metricsmetricsmetricsmetrics"
+  ## Path of a file holding a bearer token, read before each request.
+  # bearer_token = "/path/to/bearer/token"
+
+  ## Compress the request body, "gzip" or "" for none.
+  # content_encoding = "gzip"
+
+  ## Max number of metrics per request, the batches of the output are split
+  ## in several requests over it, 0 for no limit.
+  # max_batch_size = 1000
+
+  ## Format of the batches:
+  ##   lines       the serialized metrics one after the other
+  ##   json_array  a JSON array of the serialized metrics, for the json data
+  ##               format
+  # batch_format = "lines"
+
+  ## Go template of the request body, executed with:
+  ##   .Body     the batch in batch_format
+  ##   .Metrics  the list of the serialized metrics
+  ##   .Count    the number of metrics
+  ## and the json function encodes its argument, ie {{json .Body}}.
+  # body_template = '{"source": "telegraf", "events": {{.Body}}}'
+
+  ## Number of retries of a batch after a network error or a 5xx or 429
+  ## response, the wait between retries starts at retry_backoff and doubles
+  ## each time. The Retry-After header of the 429 and 503 responses takes
+  ## precedence when longer.
+  # max_retries = 3
+  # retry_backoff = "1s"
+
+  ## Optional SSL Config
+  # ssl_ca = "/etc/telegraf/ca.pem"
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+  ## Use SSL but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Data format to output.
+  ## Each data format has its own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_OUTPUT.md
+  data_format = "influx"
+`
+
+// body is the data the body template is executed with.
+type body struct {
+	Body    string
+	Metrics []string
+	Count   int
+}
+
+func (h *HTTP) SetSerializer(serializer serializers.Serializer) {
+	h.serializer = serializer
+}
+
+func (h *HTTP) SampleConfig() string {
+	return sampleConfig
+}
+
+func (h *HTTP) Description() string {
+	return "Send batches of serialized metrics to an HTTP endpoint"
+}
+
+func (h *HTTP) Connect() error {
+	if h.URL == "" {
+		return fmt.Errorf("url is a required field for http output")
+	}
+	switch h.Method {
+	case "POST", "PUT":
+	default:
+		return fmt.Errorf("invalid method %q, must be POST or PUT", h.Method)
+	}
+	if h.ContentEncoding != "" && h.ContentEncoding != "gzip" {
+		return fmt.Errorf("unsupported content_encoding %q", h.ContentEncoding)
+	}
+	switch h.BatchFormat {
+	case "lines", "json_array":
+	default:
+		return fmt.Errorf("invalid batch_format %q, must be lines or json_array",
+			h.BatchFormat)
+	}
+	if h.BodyTemplate != "" {
+		t, err := template.New("body").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				buf, err := json.Marshal(v)
+				return string(buf), err
+			},
+		}).Parse(h.BodyTemplate)
+		if err != nil {
+			return fmt.Errorf("unable to parse body_template: %s", err)
+		}
+		h.template = t
+	}
+	if h.ContentType == "" {
+		switch h.serializer.(type) {
+		case *jsonserializer.JsonSerializer:
+			h.ContentType = "application/json"
+		case *msgpack.MsgpackSerializer:
+			h.ContentType = "application/msgpack"
+		default:
+			h.ContentType = "text/plain; charset=utf-8"
+		}
+	}
+
+	tlsCfg, err := internal.GetTLSConfig(
+		h.SSLCert, h.SSLKey, h.SSLCA, h.InsecureSkipVerify)
+	if err != nil {
+		return err
+	}
+	h.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsCfg,
+		},
+		Timeout: h.Timeout.Duration,
+	}
+	return nil
+}
+
+func (h *HTTP) Close() error {
+	return nil
+}
+
+func (h *HTTP) Write(metrics []telegraf.Metric) error {
+	for len(metrics) > 0 {
+		batch := metrics
+		if h.MaxBatchSize > 0 && len(batch) > h.MaxBatchSize {
+			batch = batch[:h.MaxBatchSize]
+		}
+		metrics = metrics[len(batch):]
+
+		reqBody, err := h.body(batch)
+		if err != nil {
+			return err
+		}
+		if err := h.post(reqBody); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// body returns the request body of a batch.
+func (h *HTTP) body(metrics []telegraf.Metric) ([]byte, error) {
+	serialized := make([][]byte, 0, len(metrics))
+	for _, m := range metrics {
+		buf, err := h.serializer.Serialize(m)
+		if err != nil {
+			return nil, err
+		}
+		serialized = append(serialized, buf)
+	}
+
+	var batch []byte
+	if h.BatchFormat == "json_array" {
+		elems := make([][]byte, len(serialized))
+		for i, buf := range serialized {
+			elems[i] = bytes.TrimRight(buf, "\n")
+		}
+		batch = append([]byte("["), bytes.Join(elems, []byte(","))...)
+		batch = append(batch, ']')
+	} else {
+		batch = bytes.Join(serialized, nil)
+	}
+	if h.template == nil {
+		return batch, nil
+	}
+
+	lines := make([]string, len(serialized))
+	for i, buf := range serialized {
+		lines[i] = string(bytes.TrimRight(buf, "\n"))
+	}
+	var out bytes.Buffer
+	err := h.template.Execute(&out, body{
+		Body:    string(batch),
+		Metrics: lines,
+		Count:   len(metrics),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to execute body_template: %s", err)
+	}
+	return out.Bytes(), nil
+}
+
+// post sends body, retrying with an exponential backoff while the error is
+// temporary.
+func (h *HTTP) post(body []byte) error {
+	if h.ContentEncoding == "gzip" {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	backoff := h.RetryBackoff.Duration
+	for attempt := 0; ; attempt++ {
+		retryAfter, retry, err := h.send(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= h.MaxRetries {
+			return fmt.Errorf("unable to write to %s: %s", h.URL, err)
+		}
+		wait := backoff
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		log.Printf("W! Failed to write to %s, retrying in %s: %s", h.URL, wait, err)
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+// send sends body to the url, it returns whether a failure is worth a retry
+// and how long the server asked to wait before.
+func (h *HTTP) send(body []byte) (time.Duration, bool, error) {
+	req, err := http.NewRequest(h.Method, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("User-Agent", "telegraf")
+	req.Header.Set("Content-Type", h.ContentType)
+	if h.ContentEncoding == "gzip" {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	if h.Username != "" || h.Password != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+	if h.BearerToken != "" {
+		token, err := ioutil.ReadFile(h.BearerToken)
+		if err != nil {
+			return 0, false, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		ioutil.ReadAll(resp.Body)
+		return 0, false, nil
+	}
+
+	msg, _ := ioutil.ReadAll(resp.Body)
+	err = fmt.Errorf("received status code %d: %s", resp.StatusCode,
+		strings.TrimSpace(string(msg)))
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	var retryAfter time.Duration
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+		retryAfter = time.Duration(s) * time.Second
+	}
+	return retryAfter, retry, err
+}
+
+func init() {
+	outputs.Add("http", func() telegraf.Output {
+		return &HTTP{
+			Method:       "POST",
+			Timeout:      internal.Duration{Duration: 5 * time.Second},
+			BatchFormat:  "lines",
+			MaxRetries:   3,
+			RetryBackoff: internal.Duration{Duration: time.Second},
+		}
+	})
+}
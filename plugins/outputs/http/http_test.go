@@ -0,0 +1,171 @@
+package http
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/serializers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMetrics(t *testing.T) []telegraf.Metric {
+	now := time.Unix(1500000000, 0)
+	m1, err := metric.New("cpu",
+		map[string]string{"host": "a"},
+		map[string]interface{}{"usage": 42.5},
+		now)
+	require.NoError(t, err)
+	m2, err := metric.New("requests",
+		map[string]string{"host": "b"},
+		map[string]interface{}{"count": int64(3)},
+		now)
+	require.NoError(t, err)
+	return []telegraf.Metric{m1, m2}
+}
+
+func newHTTP(url string) *HTTP {
+	s, _ := serializers.NewInfluxSerializer()
+	return &HTTP{
+		URL:         url,
+		Method:      "POST",
+		BatchFormat: "lines",
+		serializer:  s,
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/plain; charset=utf-8", r.Header.Get("Content-Type"))
+		assert.Equal(t, "telegraf", r.Header.Get("X-Source"))
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "telegraf", user)
+		assert.Equal(t, "secret", password)
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(body))
+	}))
+	defer ts.Close()
+
+	h := newHTTP(ts.URL)
+	h.Headers = map[string]string{"X-Source": "telegraf"}
+	h.Username = "telegraf"
+	h.Password = "secret"
+	require.NoError(t, h.Connect())
+	require.NoError(t, h.Write(testMetrics(t)))
+
+	assert.Equal(t, []string{
+		"cpu,host=a usage=42.5 1500000000000000000\n" +
+			"requests,host=b count=3i 1500000000000000000\n",
+	}, bodies)
+}
+
+func TestWriteBatchSize(t *testing.T) {
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(body))
+	}))
+	defer ts.Close()
+
+	h := newHTTP(ts.URL)
+	h.MaxBatchSize = 1
+	require.NoError(t, h.Connect())
+	require.NoError(t, h.Write(testMetrics(t)))
+
+	assert.Equal(t, []string{
+		"cpu,host=a usage=42.5 1500000000000000000\n",
+		"requests,host=b count=3i 1500000000000000000\n",
+	}, bodies)
+}
+
+func TestWriteTemplate(t *testing.T) {
+	var body map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		assert.NoError(t, json.NewDecoder(gz).Decode(&body))
+	}))
+	defer ts.Close()
+
+	token, err := ioutil.TempFile("", "token")
+	require.NoError(t, err)
+	defer os.Remove(token.Name())
+	token.WriteString("token\n")
+	token.Close()
+
+	h := newHTTP(ts.URL)
+	h.serializer, _ = serializers.NewJsonSerializer(time.Second)
+	h.BatchFormat = "json_array"
+	h.BodyTemplate = `{"count": {{.Count}}, "events": {{.Body}}}`
+	h.ContentEncoding = "gzip"
+	h.BearerToken = token.Name()
+	require.NoError(t, h.Connect())
+	require.NoError(t, h.Write(testMetrics(t)))
+
+	require.Len(t, body["events"], 2)
+	assert.Equal(t, float64(2), body["count"])
+	event := body["events"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "cpu", event["name"])
+}
+
+func TestWriteRetry(t *testing.T) {
+	statuses := []int{http.StatusServiceUnavailable, http.StatusOK}
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(statuses[0])
+		statuses = statuses[1:]
+	}))
+	defer ts.Close()
+
+	h := newHTTP(ts.URL)
+	h.MaxRetries = 2
+	h.RetryBackoff = internal.Duration{Duration: time.Millisecond}
+	require.NoError(t, h.Connect())
+	require.NoError(t, h.Write(testMetrics(t)))
+	assert.Equal(t, 2, requests)
+}
+
+func TestWriteClientError(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "invalid line", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	h := newHTTP(ts.URL)
+	h.MaxRetries = 2
+	require.NoError(t, h.Connect())
+	err := h.Write(testMetrics(t))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "received status code 400: invalid line")
+	// client errors are not retried
+	assert.Equal(t, 1, requests)
+}
+
+func TestConnectInvalid(t *testing.T) {
+	h := newHTTP("http://localhost:8080")
+	h.Method = "GET"
+	assert.Error(t, h.Connect())
+
+	h = newHTTP("http://localhost:8080")
+	h.BatchFormat = "xml"
+	assert.Error(t, h.Connect())
+}
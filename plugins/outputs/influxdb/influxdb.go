@@ -36,6 +36,9 @@ type InfluxDB struct {
 	HTTPProxy        string            `toml:"http_proxy"`
 	HTTPHeaders      map[string]string `toml:"http_headers"`
 	ContentEncoding  string            `toml:"content_encoding"`
+	// InfluxUintSupport writes unsigned integers as such, which requires
+	// InfluxDB 1.4 or later, rather than as integers.
+	InfluxUintSupport bool `toml:"influx_uint_support"`
 
 	// Path to CA file
 	SSLCA string `toml:"ssl_ca"`
@@ -95,6 +98,11 @@ var sampleConfig = `
 
   ## Compress each HTTP request payload using GZIP.
   # content_encoding = "gzip"
+
+  ## Write unsigned integer fields as unsigned integers, InfluxDB supports
+  ## them since 1.4. They are written as integers capped to the maximum
+  ## integer otherwise.
+  # influx_uint_support = false
 `
 
 // Connect initiates the primary connection to the range of provided URLs
@@ -186,6 +194,14 @@ func (i *InfluxDB) Description() string {
 // occurs, logging each unsuccessful. If all servers fail, return error.
 func (i *InfluxDB) Write(metrics []telegraf.Metric) error {
 
+	if !i.InfluxUintSupport {
+		converted := make([]telegraf.Metric, len(metrics))
+		for n, m := range metrics {
+			converted[n] = metric.UintToInt(m)
+		}
+		metrics = converted
+	}
+
 	bufsize := 0
 	for _, m := range metrics {
 		bufsize += m.Len()
@@ -3,11 +3,18 @@ package kafka
 import (
 	"crypto/tls"
 	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers"
+	"github.com/influxdata/telegraf/selfstat"
 
 	"github.com/Shopify/sarama"
 )
@@ -17,14 +24,31 @@ type Kafka struct {
 	Brokers []string
 	// Kafka topic
 	Topic string
+	// TopicTag is the tag whose value is the topic of the metrics having it
+	TopicTag string `toml:"topic_tag"`
+	// ExcludeTopicTag removes the topic tag from the metrics sent
+	ExcludeTopicTag bool `toml:"exclude_topic_tag"`
 	// Routing Key Tag
 	RoutingTag string `toml:"routing_tag"`
+	// EventIDKey uses the event ID of the metrics as message key
+	EventIDKey bool `toml:"event_id_key"`
 	// Compression Codec Tag
-	CompressionCodec int
+	CompressionCodec CompressionCodec
 	// RequiredAcks Tag
 	RequiredAcks int
 	// MaxRetry Tag
 	MaxRetry int
+	// MaxMessageBytes is the max size of a message, 0 for the default
+	MaxMessageBytes int
+	// IdempotentWrites enables the idempotent producer
+	IdempotentWrites bool
+	// Version is the version of the brokers, ie "2.1.0"
+	Version string
+
+	// TopicPause is how long a topic is paused after its partitions failed
+	TopicPause internal.Duration
+	// TopicBacklogLimit is the max number of messages kept per paused topic
+	TopicBacklogLimit int
 
 	// Legacy SSL config options
 	// TLS client certificate
@@ -52,6 +76,8 @@ type Kafka struct {
 	tlsConfig tls.Config
 	producer  sarama.SyncProducer
 
+	topics map[string]*topicQueue
+
 	serializer serializers.Serializer
 }
 
@@ -60,15 +86,34 @@ var sampleConfig = `
   brokers = ["localhost:9092"]
   ## Kafka topic for producer messages
   topic = "telegraf"
+  ## If set, the value of this tag is the topic of the metrics having it,
+  ## the other metrics are sent to the topic above. Useful to feed several
+  ## Druid datasources, ie with topic_tag = "datasource".
+  # topic_tag = ""
+  ## Remove the topic tag from the metrics sent.
+  # exclude_topic_tag = false
   ## Telegraf tag to use as a routing key
   ##  ie, if this tag exists, its value will be used as the routing key
   routing_tag = "host"
+  ## Use the event ID of the metrics as message key instead of the routing
+  ## tag, a hash of their name, tags, fields and timestamp. A message sent
+  ## again when a write is retried has the same key, so that the consumers
+  ## can drop the duplicates. The druid output adds the same ID to its rows
+  ## with event_id_column.
+  # event_id_key = false
+
+  ## Version of the brokers, the oldest one when they are being upgraded.
+  ## Defaults to the oldest version supporting the compression codec and
+  ## idempotent writes.
+  # version = "2.1.0"
 
   ## CompressionCodec represents the various compression codecs recognized by
-  ## Kafka in messages.
-  ##  0 : No compression
-  ##  1 : Gzip compression
-  ##  2 : Snappy compression
+  ## Kafka in messages, by name or number.
+  ##  "none" or 0   : No compression
+  ##  "gzip" or 1   : Gzip compression
+  ##  "snappy" or 2 : Snappy compression
+  ##  "lz4" or 3    : LZ4 compression, requires Kafka 0.10.0 or later
+  ##  "zstd" or 4   : Zstandard compression, requires Kafka 2.1.0 or later
   compression_codec = 0
 
   ##  RequiredAcks is used in Produce Requests to tell the broker how many
@@ -90,6 +135,25 @@ var sampleConfig = `
   ##  The total number of times to retry sending a message
   max_retry = 3
 
+  ## Max size of a message in bytes, it should not be larger than the
+  ## message.max.bytes of the brokers.
+  # max_message_bytes = 1000000
+
+  ## Idempotent writes: the brokers discard the duplicates of the messages
+  ## retried by the producer, so that a message is written once per
+  ## partition. Requires Kafka 0.11.0 or later and required_acks = -1, only
+  ## one request is in flight per broker.
+  # idempotent_writes = false
+
+  ## When the partitions of a topic are unavailable (no leader, unknown
+  ## topic, not enough replicas...), only this topic is paused for
+  ## topic_pause and its messages are kept in a backlog of up to
+  ## topic_backlog_limit messages, the oldest being dropped, while the other
+  ## topics keep being written. The backlog is sent first once the pause is
+  ## over. Other errors fail the whole write.
+  # topic_pause = "30s"
+  # topic_backlog_limit = 10000
+
   ## Optional SSL Config
   # ssl_ca = "/etc/telegraf/ca.pem"
   # ssl_cert = "/etc/telegraf/cert.pem"
@@ -112,13 +176,97 @@ func (k *Kafka) SetSerializer(serializer serializers.Serializer) {
 	k.serializer = serializer
 }
 
+// CompressionCodec is a compression codec of the producer, it is set in
+// the config file by name or by number.
+type CompressionCodec int
+
+var compressionCodecs = map[string]sarama.CompressionCodec{
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+	"zstd":   sarama.CompressionZSTD,
+}
+
+// UnmarshalTOML parses either the name or the number of a codec
+func (c *CompressionCodec) UnmarshalTOML(b []byte) error {
+	str := strings.TrimSpace(string(b))
+	if n, err := strconv.Atoi(str); err == nil {
+		*c = CompressionCodec(n)
+		return nil
+	}
+
+	name, err := strconv.Unquote(str)
+	if err != nil {
+		return fmt.Errorf("invalid compression_codec %s", str)
+	}
+	codec, ok := compressionCodecs[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown compression_codec %q, must be none, gzip, "+
+			"snappy, lz4 or zstd", name)
+	}
+	*c = CompressionCodec(codec)
+	return nil
+}
+
 func (k *Kafka) Connect() error {
+	config, err := k.producerConfig()
+	if err != nil {
+		return err
+	}
+
+	producer, err := sarama.NewSyncProducer(k.Brokers, config)
+	if err != nil {
+		return err
+	}
+	k.producer = producer
+	return nil
+}
+
+func (k *Kafka) producerConfig() (*sarama.Config, error) {
 	config := sarama.NewConfig()
 
 	config.Producer.RequiredAcks = sarama.RequiredAcks(k.RequiredAcks)
 	config.Producer.Compression = sarama.CompressionCodec(k.CompressionCodec)
 	config.Producer.Retry.Max = k.MaxRetry
 	config.Producer.Return.Successes = true
+	if k.MaxMessageBytes > 0 {
+		config.Producer.MaxMessageBytes = k.MaxMessageBytes
+	}
+
+	// the features of the newer brokers are only used by the producer if
+	// the version is at least the one introducing them
+	minVersion := config.Version
+	switch config.Producer.Compression {
+	case sarama.CompressionLZ4:
+		minVersion = sarama.V0_10_0_0
+	case sarama.CompressionZSTD:
+		minVersion = sarama.V2_1_0_0
+	}
+
+	if k.IdempotentWrites {
+		if config.Producer.RequiredAcks != sarama.WaitForAll {
+			return nil, fmt.Errorf("idempotent_writes requires required_acks = -1")
+		}
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1
+		if !minVersion.IsAtLeast(sarama.V0_11_0_0) {
+			minVersion = sarama.V0_11_0_0
+		}
+	}
+
+	config.Version = minVersion
+	if k.Version != "" {
+		version, err := sarama.ParseKafkaVersion(k.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %s", k.Version, err)
+		}
+		if !version.IsAtLeast(minVersion) {
+			return nil, fmt.Errorf("version %s is too old for the compression "+
+				"codec or idempotent writes, requires %s", version, minVersion)
+		}
+		config.Version = version
+	}
 
 	// Legacy support ssl config
 	if k.Certificate != "" {
@@ -130,7 +278,7 @@ func (k *Kafka) Connect() error {
 	tlsConfig, err := internal.GetTLSConfig(
 		k.SSLCert, k.SSLKey, k.SSLCA, k.InsecureSkipVerify)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if tlsConfig != nil {
@@ -143,13 +291,7 @@ func (k *Kafka) Connect() error {
 		config.Net.SASL.Password = k.SASLPassword
 		config.Net.SASL.Enable = true
 	}
-
-	producer, err := sarama.NewSyncProducer(k.Brokers, config)
-	if err != nil {
-		return err
-	}
-	k.producer = producer
-	return nil
+	return config, nil
 }
 
 func (k *Kafka) Close() error {
@@ -164,39 +306,210 @@ func (k *Kafka) Description() string {
 	return "Configuration for the Kafka server to send metrics to"
 }
 
-func (k *Kafka) Write(metrics []telegraf.Metric) error {
-	if len(metrics) == 0 {
-		return nil
+// topicQueue holds the messages of a paused topic.
+type topicQueue struct {
+	backlog     []*sarama.ProducerMessage
+	pausedUntil time.Time
+
+	backlogSize selfstat.Stat
+	dropped     selfstat.Stat
+	paused      selfstat.Stat
+}
+
+func (k *Kafka) queue(topic string) *topicQueue {
+	if k.topics == nil {
+		k.topics = make(map[string]*topicQueue)
+	}
+	q, ok := k.topics[topic]
+	if !ok {
+		tags := map[string]string{"topic": topic}
+		q = &topicQueue{
+			backlogSize: selfstat.Register("kafka", "topic_backlog", tags),
+			dropped:     selfstat.Register("kafka", "topic_messages_dropped", tags),
+			paused:      selfstat.Register("kafka", "topic_paused", tags),
+		}
+		k.topics[topic] = q
+	}
+	return q
+}
+
+// push appends messages to the backlog, dropping the oldest ones over limit.
+func (q *topicQueue) push(msgs []*sarama.ProducerMessage, limit int) {
+	q.backlog = append(q.backlog, msgs...)
+	if limit > 0 && len(q.backlog) > limit {
+		n := len(q.backlog) - limit
+		q.dropped.Incr(int64(n))
+		q.backlog = append([]*sarama.ProducerMessage(nil), q.backlog[n:]...)
 	}
+	q.backlogSize.Set(int64(len(q.backlog)))
+}
 
+func (k *Kafka) Write(metrics []telegraf.Metric) error {
+	msgs := make(map[string][]*sarama.ProducerMessage)
 	for _, metric := range metrics {
+		topic := k.Topic
+		if k.TopicTag != "" {
+			if t, ok := metric.Tags()[k.TopicTag]; ok && t != "" {
+				topic = t
+				if k.ExcludeTopicTag {
+					metric = withoutTag(metric, k.TopicTag)
+				}
+			}
+		}
+
 		buf, err := k.serializer.Serialize(metric)
 		if err != nil {
 			return err
 		}
 
 		m := &sarama.ProducerMessage{
-			Topic: k.Topic,
+			Topic: topic,
+			Key:   k.key(metric),
 			Value: sarama.ByteEncoder(buf),
 		}
-		if h, ok := metric.Tags()[k.RoutingTag]; ok {
-			m.Key = sarama.StringEncoder(h)
+		msgs[topic] = append(msgs[topic], m)
+	}
+
+	// the topics with a backlog are drained first, even without new messages
+	var backlogged, fresh []string
+	for topic, q := range k.topics {
+		if len(q.backlog) > 0 {
+			backlogged = append(backlogged, topic)
+		}
+	}
+	for topic := range msgs {
+		if q, ok := k.topics[topic]; !ok || len(q.backlog) == 0 {
+			fresh = append(fresh, topic)
+		}
+	}
+	sort.Strings(backlogged)
+	sort.Strings(fresh)
+
+	now := time.Now()
+	var errs []string
+	for _, topic := range append(backlogged, fresh...) {
+		q := k.queue(topic)
+		if now.Before(q.pausedUntil) {
+			q.push(msgs[topic], k.TopicBacklogLimit)
+			continue
+		}
+		q.paused.Set(0)
+
+		// the backlog is older than the new messages, it is sent first
+		backlog := q.backlog
+		batch := append(backlog[:len(backlog):len(backlog)], msgs[topic]...)
+		q.backlog = nil
+		q.backlogSize.Set(0)
+		if len(batch) == 0 {
+			continue
 		}
 
-		_, _, err = k.producer.SendMessage(m)
+		err := k.producer.SendMessages(batch)
+		if err == nil {
+			continue
+		}
+		failed := failedMessages(batch, err)
+		if isTopicFailure(err) {
+			log.Printf("W! Kafka topic %s is unavailable, pausing it for %s "+
+				"with %d messages in backlog: %s",
+				topic, k.TopicPause.Duration, len(failed), err)
+			q.pausedUntil = now.Add(k.TopicPause.Duration)
+			q.paused.Set(1)
+			q.push(failed, k.TopicBacklogLimit)
+			continue
+		}
 
-		if err != nil {
-			return fmt.Errorf("FAILED to send kafka message: %s\n", err)
+		// the failure is not specific to the topic: the new messages are
+		// retried with the whole write, the backlog is kept
+		inBacklog := make(map[*sarama.ProducerMessage]bool, len(backlog))
+		for _, m := range backlog {
+			inBacklog[m] = true
+		}
+		var keep []*sarama.ProducerMessage
+		for _, m := range failed {
+			if inBacklog[m] {
+				keep = append(keep, m)
+			}
 		}
+		q.push(keep, k.TopicBacklogLimit)
+		errs = append(errs, fmt.Sprintf("topic %s: %s", topic, err))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("FAILED to send kafka messages: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// key returns the message key of m, its event ID with event_id_key or else
+// the value of its routing tag, if any.
+func (k *Kafka) key(m telegraf.Metric) sarama.Encoder {
+	if k.EventIDKey {
+		return sarama.StringEncoder(metric.EventID(m))
+	}
+	if h, ok := m.Tags()[k.RoutingTag]; ok {
+		return sarama.StringEncoder(h)
 	}
 	return nil
 }
 
+// withoutTag returns a copy of m without the tag key.
+func withoutTag(m telegraf.Metric, key string) telegraf.Metric {
+	tags := m.Tags()
+	delete(tags, key)
+	out, err := metric.New(m.Name(), tags, m.Fields(), m.Time(), m.Type())
+	if err != nil {
+		return m
+	}
+	return out
+}
+
+// failedMessages returns the messages of batch that were not delivered.
+func failedMessages(batch []*sarama.ProducerMessage, err error) []*sarama.ProducerMessage {
+	perrs, ok := err.(sarama.ProducerErrors)
+	if !ok {
+		return batch
+	}
+	failed := make([]*sarama.ProducerMessage, 0, len(perrs))
+	for _, perr := range perrs {
+		failed = append(failed, perr.Msg)
+	}
+	return failed
+}
+
+// isTopicFailure returns whether err only concerns the partitions of a
+// topic, as opposed to the brokers or the connection.
+func isTopicFailure(err error) bool {
+	if perrs, ok := err.(sarama.ProducerErrors); ok {
+		if len(perrs) == 0 {
+			return false
+		}
+		for _, perr := range perrs {
+			if !isTopicFailure(perr.Err) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch err {
+	case sarama.ErrUnknownTopicOrPartition,
+		sarama.ErrLeaderNotAvailable,
+		sarama.ErrNotLeaderForPartition,
+		sarama.ErrNotEnoughReplicas,
+		sarama.ErrNotEnoughReplicasAfterAppend,
+		sarama.ErrTopicAuthorizationFailed:
+		return true
+	}
+	return false
+}
+
 func init() {
 	outputs.Add("kafka", func() telegraf.Output {
 		return &Kafka{
-			MaxRetry:     3,
-			RequiredAcks: -1,
+			MaxRetry:          3,
+			RequiredAcks:      -1,
+			TopicPause:        internal.Duration{Duration: 30 * time.Second},
+			TopicBacklogLimit: 10000,
 		}
 	})
 }
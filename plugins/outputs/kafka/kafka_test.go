@@ -1,10 +1,18 @@
 package kafka
 
 import (
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,3 +37,162 @@ func TestConnectAndWrite(t *testing.T) {
 	err = k.Write(testutil.MockMetrics())
 	require.NoError(t, err)
 }
+
+func newMockKafka(t *testing.T) (*Kafka, *mocks.SyncProducer) {
+	s, _ := serializers.NewInfluxSerializer()
+	producer := mocks.NewSyncProducer(t, nil)
+	k := &Kafka{
+		Topic:             "telegraf",
+		TopicPause:        internal.Duration{Duration: time.Minute},
+		TopicBacklogLimit: 3,
+		serializer:        s,
+		producer:          producer,
+	}
+	return k, producer
+}
+
+func TestWriteTopicPause(t *testing.T) {
+	k, producer := newMockKafka(t)
+	defer k.Close()
+
+	// the topic has no leader: it is paused, the write succeeds
+	producer.ExpectSendMessageAndFail(sarama.ErrLeaderNotAvailable)
+	require.NoError(t, k.Write(testutil.MockMetrics()))
+	q := k.topics["telegraf"]
+	require.NotNil(t, q)
+	assert.Len(t, q.backlog, 1)
+
+	// while paused, the messages go to the backlog, the oldest are dropped
+	require.NoError(t, k.Write(testutil.MockMetrics()))
+	assert.Len(t, q.backlog, 2)
+	require.NoError(t, k.Write(append(testutil.MockMetrics(), testutil.MockMetrics()...)))
+	assert.Len(t, q.backlog, 3)
+
+	// once the pause is over, the backlog is sent before the new messages
+	q.pausedUntil = time.Now()
+	for i := 0; i < 4; i++ {
+		producer.ExpectSendMessageAndSucceed()
+	}
+	require.NoError(t, k.Write(testutil.MockMetrics()))
+	assert.Len(t, q.backlog, 0)
+}
+
+func TestWriteBrokerFailure(t *testing.T) {
+	k, producer := newMockKafka(t)
+	defer k.Close()
+
+	// failures that are not specific to a topic fail the write
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	require.Error(t, k.Write(testutil.MockMetrics()))
+	assert.Len(t, k.topics["telegraf"].backlog, 0)
+	assert.True(t, k.topics["telegraf"].pausedUntil.IsZero())
+}
+
+func TestWriteTopicTag(t *testing.T) {
+	k, producer := newMockKafka(t)
+	defer k.Close()
+	k.TopicTag = "datasource"
+	k.ExcludeTopicTag = true
+
+	metrics := []telegraf.Metric{
+		testutil.TestMetric(1, "a"),
+		testutil.TestMetric(2, "b"),
+		testutil.TestMetric(3, "c"),
+	}
+	metrics[0].AddTag("datasource", "cpu")
+	metrics[1].AddTag("datasource", "mem")
+
+	// the topics are paused to keep their messages
+	for i := 0; i < 3; i++ {
+		producer.ExpectSendMessageAndFail(sarama.ErrLeaderNotAvailable)
+	}
+	require.NoError(t, k.Write(metrics))
+
+	for topic, name := range map[string]string{"cpu": "a", "mem": "b", "telegraf": "c"} {
+		q := k.topics[topic]
+		require.NotNil(t, q, topic)
+		require.Len(t, q.backlog, 1, topic)
+		value, err := q.backlog[0].Value.Encode()
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(value), name+","), topic)
+		assert.NotContains(t, string(value), "datasource", topic)
+	}
+	// the tag is not removed from the metrics of the other outputs
+	assert.True(t, metrics[0].HasTag("datasource"))
+}
+
+func TestWriteEventIDKey(t *testing.T) {
+	k, producer := newMockKafka(t)
+	defer k.Close()
+	k.RoutingTag = "host"
+
+	m := testutil.TestMetric(1, "a")
+	m.AddTag("host", "server01")
+	assert.Equal(t, sarama.StringEncoder("server01"), k.key(m))
+
+	// the event ID replaces the routing tag, it is the same for the
+	// messages of a metric written again
+	k.EventIDKey = true
+	producer.ExpectSendMessageAndFail(sarama.ErrLeaderNotAvailable)
+	require.NoError(t, k.Write([]telegraf.Metric{m}))
+	q := k.topics["telegraf"]
+	require.Len(t, q.backlog, 1)
+	assert.Equal(t, sarama.StringEncoder(metric.EventID(m)), q.backlog[0].Key)
+	assert.Equal(t, k.key(m), k.key(m.Copy()))
+}
+
+func TestIsTopicFailure(t *testing.T) {
+	msg := &sarama.ProducerMessage{Topic: "telegraf"}
+	assert.True(t, isTopicFailure(sarama.ErrNotLeaderForPartition))
+	assert.False(t, isTopicFailure(sarama.ErrOutOfBrokers))
+	assert.True(t, isTopicFailure(sarama.ProducerErrors{
+		{Msg: msg, Err: sarama.ErrUnknownTopicOrPartition},
+		{Msg: msg, Err: sarama.ErrLeaderNotAvailable},
+	}))
+	assert.False(t, isTopicFailure(sarama.ProducerErrors{
+		{Msg: msg, Err: sarama.ErrLeaderNotAvailable},
+		{Msg: msg, Err: sarama.ErrOutOfBrokers},
+	}))
+}
+
+func TestCompressionCodecUnmarshal(t *testing.T) {
+	for in, expected := range map[string]sarama.CompressionCodec{
+		`2`:      sarama.CompressionSnappy,
+		`"zstd"`: sarama.CompressionZSTD,
+		`"LZ4"`:  sarama.CompressionLZ4,
+	} {
+		var c CompressionCodec
+		require.NoError(t, c.UnmarshalTOML([]byte(in)), in)
+		assert.Equal(t, CompressionCodec(expected), c, in)
+	}
+
+	var c CompressionCodec
+	assert.Error(t, c.UnmarshalTOML([]byte(`"brotli"`)))
+}
+
+func TestProducerConfig(t *testing.T) {
+	k := &Kafka{
+		RequiredAcks:     -1,
+		MaxRetry:         3,
+		MaxMessageBytes:  4000000,
+		CompressionCodec: CompressionCodec(sarama.CompressionZSTD),
+		IdempotentWrites: true,
+	}
+	config, err := k.producerConfig()
+	require.NoError(t, err)
+	assert.Equal(t, sarama.CompressionZSTD, config.Producer.Compression)
+	assert.Equal(t, 4000000, config.Producer.MaxMessageBytes)
+	assert.True(t, config.Producer.Idempotent)
+	assert.Equal(t, 1, config.Net.MaxOpenRequests)
+	// the version defaults to the oldest one supporting zstd
+	assert.Equal(t, sarama.V2_1_0_0, config.Version)
+
+	k.Version = "1.0.0"
+	_, err = k.producerConfig()
+	assert.Error(t, err)
+
+	k.Version = ""
+	k.RequiredAcks = 1
+	_, err = k.producerConfig()
+	assert.Error(t, err)
+}
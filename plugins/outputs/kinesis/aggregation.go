@@ -0,0 +1,98 @@
+package kinesis
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+)
+
+// kplMagic prefixes the records aggregated by the Kinesis Producer Library,
+// the consumers unpack the records starting with it.
+var kplMagic = []byte{0xF3, 0x89, 0x9A, 0xC2}
+
+// aggregator packs user records sharing a partition key in a single Kinesis
+// record, in the AggregatedRecord protobuf message of the Kinesis Producer
+// Library:
+//
+//	message AggregatedRecord {
+//	  repeated string partition_key_table = 1;
+//	  repeated string explicit_hash_key_table = 2;
+//	  repeated Record records = 3;
+//	}
+//	message Record {
+//	  required uint64 partition_key_index = 1;
+//	  optional uint64 explicit_hash_key_index = 2;
+//	  required bytes data = 3;
+//	}
+//
+// The message is preceded by kplMagic and followed by its MD5 checksum.
+type aggregator struct {
+	partitionKey string
+	records      [][]byte
+	size         int
+}
+
+func newAggregator(partitionKey string) *aggregator {
+	a := &aggregator{partitionKey: partitionKey}
+	a.reset()
+	return a
+}
+
+// reset empties the aggregator.
+func (a *aggregator) reset() {
+	a.records = nil
+	a.size = len(kplMagic) + fieldSize(len(a.partitionKey)) + md5.Size
+}
+
+// add appends a user record.
+func (a *aggregator) add(data []byte) {
+	a.records = append(a.records, data)
+	a.size += fieldSize(recordSize(len(data)))
+}
+
+// sizeWith returns the size of the aggregated record with one more user
+// record of n bytes.
+func (a *aggregator) sizeWith(n int) int {
+	return a.size + fieldSize(recordSize(n))
+}
+
+func (a *aggregator) empty() bool {
+	return len(a.records) == 0
+}
+
+// encode returns the aggregated record.
+func (a *aggregator) encode() []byte {
+	buf := make([]byte, 0, a.size)
+	buf = append(buf, kplMagic...)
+
+	// partition_key_table, the only key of index 0
+	buf = appendField(buf, 1, []byte(a.partitionKey))
+	for _, data := range a.records {
+		record := make([]byte, 0, recordSize(len(data)))
+		// partition_key_index
+		record = append(record, 1<<3, 0)
+		record = appendField(record, 3, data)
+		buf = appendField(buf, 3, record)
+	}
+
+	sum := md5.Sum(buf[len(kplMagic):])
+	return append(buf, sum[:]...)
+}
+
+// appendField appends a length-delimited protobuf field.
+func appendField(buf []byte, field int, data []byte) []byte {
+	var n [binary.MaxVarintLen64]byte
+	buf = append(buf, byte(field<<3|2))
+	buf = append(buf, n[:binary.PutUvarint(n[:], uint64(len(data)))]...)
+	return append(buf, data...)
+}
+
+// fieldSize returns the encoded size of a length-delimited field of n bytes.
+func fieldSize(n int) int {
+	var buf [binary.MaxVarintLen64]byte
+	return 1 + binary.PutUvarint(buf[:], uint64(n)) + n
+}
+
+// recordSize returns the encoded size of a Record of n bytes of data.
+func recordSize(n int) int {
+	return 2 + fieldSize(n)
+}
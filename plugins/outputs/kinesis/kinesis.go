@@ -15,6 +15,19 @@ import (
 	"github.com/influxdata/telegraf/plugins/serializers"
 )
 
+const (
+	// maxRecordsPerRequest is the largest number of records of a
+	// PutRecords request.
+	maxRecordsPerRequest = 500
+	// maxRequestSize is the largest size of a PutRecords request.
+	maxRequestSize = 5 * 1024 * 1024
+	// maxRecordSize is the largest size of a record.
+	maxRecordSize = 1024 * 1024
+	// defaultAggregateMaxSize is the default size of the aggregated records,
+	// as in the Kinesis Producer Library.
+	defaultAggregateMaxSize = 51200
+)
+
 type (
 	KinesisOutput struct {
 		Region    string `toml:"region"`
@@ -29,6 +42,8 @@ type (
 		PartitionKey       string     `toml:"partitionkey"`
 		RandomPartitionKey bool       `toml:"use_random_partitionkey"`
 		Partition          *Partition `toml:"partition"`
+		Aggregate          bool       `toml:"aggregate"`
+		AggregateMaxSize   int        `toml:"aggregate_max_size"`
 		Debug              bool       `toml:"debug"`
 		svc                *kinesis.Kinesis
 
@@ -89,6 +104,15 @@ var sampleConfig = `
   #    method = "tag"
   #    key = "host"
 
+  ## Aggregate the metrics sharing a partition key in a single record, in
+  ## the format of the Kinesis Producer Library. The consumers using the
+  ## Kinesis Client Library, or the Druid Kinesis ingestion with
+  ## deaggregate = true, unpack the metrics. With the random partition key,
+  ## each aggregated record gets its own key.
+  # aggregate = false
+  ## Maximum size of an aggregated record in bytes, Kinesis accepts up to
+  ## 1 MiB.
+  # aggregate_max_size = 51200
 
   ## Data format to output.
   ## Each data format has its own unique set of configuration options, read
@@ -221,50 +245,129 @@ func (k *KinesisOutput) getPartitionKey(metric telegraf.Metric) string {
 }
 
 func (k *KinesisOutput) Write(metrics []telegraf.Metric) error {
-	var sz uint32
-
 	if len(metrics) == 0 {
 		return nil
 	}
 
-	r := []*kinesis.PutRecordsRequestEntry{}
+	var records []*kinesis.PutRecordsRequestEntry
+	var err error
+	if k.Aggregate {
+		records, err = k.aggregatedRecords(metrics)
+	} else {
+		records, err = k.records(metrics)
+	}
+	if err != nil {
+		return err
+	}
 
-	for _, metric := range metrics {
-		sz++
+	var r []*kinesis.PutRecordsRequestEntry
+	size := 0
+	for _, record := range records {
+		recordSize := len(record.Data) + len(*record.PartitionKey)
+		// Max Records Per PutRecordRequest is 500, Max Size is 5 MiB
+		if len(r) == maxRecordsPerRequest || (len(r) > 0 && size+recordSize > maxRequestSize) {
+			elapsed := writekinesis(k, r)
+			log.Printf("E! Wrote a %+v point batch to Kinesis in %+v.\n", len(r), elapsed)
+			r, size = nil, 0
+		}
+		r = append(r, record)
+		size += recordSize
+	}
+	if len(r) > 0 {
+		elapsed := writekinesis(k, r)
+		log.Printf("E! Wrote a %+v point batch to Kinesis in %+v.\n", len(r), elapsed)
+	}
+
+	return nil
+}
 
+// records returns a record per metric.
+func (k *KinesisOutput) records(metrics []telegraf.Metric) ([]*kinesis.PutRecordsRequestEntry, error) {
+	r := make([]*kinesis.PutRecordsRequestEntry, 0, len(metrics))
+	for _, metric := range metrics {
 		values, err := k.serializer.Serialize(metric)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		partitionKey := k.getPartitionKey(metric)
-
-		d := kinesis.PutRecordsRequestEntry{
+		r = append(r, &kinesis.PutRecordsRequestEntry{
 			Data:         values,
-			PartitionKey: aws.String(partitionKey),
-		}
+			PartitionKey: aws.String(k.getPartitionKey(metric)),
+		})
+	}
+	return r, nil
+}
 
-		r = append(r, &d)
+// aggregatedRecords returns the metrics aggregated by partition key in
+// records of up to aggregate_max_size.
+func (k *KinesisOutput) aggregatedRecords(metrics []telegraf.Metric) ([]*kinesis.PutRecordsRequestEntry, error) {
+	maxSize := k.AggregateMaxSize
+	if maxSize <= 0 || maxSize > maxRecordSize {
+		maxSize = maxRecordSize
+	}
+	random := k.randomPartitionKey()
+
+	var r []*kinesis.PutRecordsRequestEntry
+	flush := func(a *aggregator) {
+		r = append(r, &kinesis.PutRecordsRequestEntry{
+			Data:         a.encode(),
+			PartitionKey: aws.String(a.partitionKey),
+		})
+		if random {
+			a.partitionKey = uuid.NewV4().String()
+		}
+		a.reset()
+	}
 
-		if sz == 500 {
-			// Max Messages Per PutRecordRequest is 500
-			elapsed := writekinesis(k, r)
-			log.Printf("E! Wrote a %+v point batch to Kinesis in %+v.\n", sz, elapsed)
-			sz = 0
-			r = nil
+	var aggregators []*aggregator
+	byKey := make(map[string]*aggregator)
+	for _, metric := range metrics {
+		values, err := k.serializer.Serialize(metric)
+		if err != nil {
+			return nil, err
 		}
 
+		// the metrics share a single aggregator with the random key, which
+		// changes with each record
+		var partitionKey string
+		if !random {
+			partitionKey = k.getPartitionKey(metric)
+		}
+		a, ok := byKey[partitionKey]
+		if !ok {
+			if random {
+				a = newAggregator(uuid.NewV4().String())
+			} else {
+				a = newAggregator(partitionKey)
+			}
+			byKey[partitionKey] = a
+			aggregators = append(aggregators, a)
+		}
+		if !a.empty() && a.sizeWith(len(values)) > maxSize {
+			flush(a)
+		}
+		a.add(values)
 	}
-	if sz > 0 {
-		elapsed := writekinesis(k, r)
-		log.Printf("E! Wrote a %+v point batch to Kinesis in %+v.\n", sz, elapsed)
+	for _, a := range aggregators {
+		if !a.empty() {
+			flush(a)
+		}
 	}
+	return r, nil
+}
 
-	return nil
+// randomPartitionKey reports whether the partition keys are random.
+func (k *KinesisOutput) randomPartitionKey() bool {
+	if k.Partition != nil {
+		return k.Partition.Method == "random"
+	}
+	return k.RandomPartitionKey
 }
 
 func init() {
 	outputs.Add("kinesis", func() telegraf.Output {
-		return &KinesisOutput{}
+		return &KinesisOutput{
+			AggregateMaxSize: defaultAggregateMaxSize,
+		}
 	})
 }
@@ -1,11 +1,20 @@
 package kinesis
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/influxdata/telegraf/testutil"
 	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPartitionKey(t *testing.T) {
@@ -75,3 +84,148 @@ func TestPartitionKey(t *testing.T) {
 	assert.Equal(uint(4), u.Version(), "PartitionKey should be UUIDv4")
 
 }
+
+// deaggregate returns the partition keys and the user records of an
+// aggregated record.
+func deaggregate(t *testing.T, data []byte) ([]string, [][]byte) {
+	require.True(t, bytes.HasPrefix(data, kplMagic))
+	message := data[len(kplMagic) : len(data)-md5.Size]
+	sum := md5.Sum(message)
+	require.Equal(t, sum[:], data[len(data)-md5.Size:])
+
+	var keys []string
+	var records [][]byte
+	for len(message) > 0 {
+		field, value := readField(t, message)
+		message = message[len(message)-len(value.rest):]
+		switch field {
+		case 1:
+			keys = append(keys, string(value.data))
+		case 3:
+			record := value.data
+			require.Equal(t, []byte{1 << 3, 0}, record[:2])
+			field, value := readField(t, record[2:])
+			require.Equal(t, 3, field)
+			require.Empty(t, value.rest)
+			records = append(records, value.data)
+		default:
+			t.Fatalf("unexpected field %d", field)
+		}
+	}
+	return keys, records
+}
+
+type fieldValue struct {
+	data []byte
+	rest []byte
+}
+
+// readField reads a length-delimited protobuf field.
+func readField(t *testing.T, buf []byte) (int, fieldValue) {
+	require.Equal(t, byte(2), buf[0]&7)
+	n, l := binary.Uvarint(buf[1:])
+	require.True(t, l > 0)
+	start := 1 + l
+	end := start + int(n)
+	require.True(t, end <= len(buf))
+	return int(buf[0] >> 3), fieldValue{data: buf[start:end], rest: buf[end:]}
+}
+
+func newKinesisOutput(t *testing.T) *KinesisOutput {
+	serializer, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+	k := &KinesisOutput{
+		Aggregate:        true,
+		AggregateMaxSize: defaultAggregateMaxSize,
+		Partition: &Partition{
+			Method: "tag",
+			Key:    "host",
+		},
+	}
+	k.SetSerializer(serializer)
+	return k
+}
+
+func hostMetric(t *testing.T, host string, value int64) telegraf.Metric {
+	m, err := metric.New("cpu", map[string]string{"host": host},
+		map[string]interface{}{"value": value}, time.Unix(0, 0))
+	require.NoError(t, err)
+	return m
+}
+
+func TestAggregatedRecords(t *testing.T) {
+	k := newKinesisOutput(t)
+	records, err := k.aggregatedRecords([]telegraf.Metric{
+		hostMetric(t, "a", 1),
+		hostMetric(t, "b", 2),
+		hostMetric(t, "a", 3),
+	})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	assert.Equal(t, "a", *records[0].PartitionKey)
+	keys, data := deaggregate(t, records[0].Data)
+	assert.Equal(t, []string{"a"}, keys)
+	assert.Equal(t, [][]byte{
+		[]byte("cpu,host=a value=1i 0\n"),
+		[]byte("cpu,host=a value=3i 0\n"),
+	}, data)
+
+	assert.Equal(t, "b", *records[1].PartitionKey)
+	keys, data = deaggregate(t, records[1].Data)
+	assert.Equal(t, []string{"b"}, keys)
+	assert.Equal(t, [][]byte{[]byte("cpu,host=b value=2i 0\n")}, data)
+}
+
+func TestAggregatedRecordsMaxSize(t *testing.T) {
+	k := newKinesisOutput(t)
+	k.AggregateMaxSize = 100
+
+	var metrics []telegraf.Metric
+	for i := 0; i < 20; i++ {
+		metrics = append(metrics, hostMetric(t, "a", int64(i)))
+	}
+	records, err := k.aggregatedRecords(metrics)
+	require.NoError(t, err)
+	require.True(t, len(records) > 1)
+
+	var values []string
+	for _, record := range records {
+		assert.True(t, len(record.Data) <= k.AggregateMaxSize,
+			"record of %d bytes", len(record.Data))
+		_, data := deaggregate(t, record.Data)
+		for _, d := range data {
+			values = append(values, string(d))
+		}
+	}
+	require.Len(t, values, 20)
+	for i, v := range values {
+		assert.Equal(t, fmt.Sprintf("cpu,host=a value=%di 0\n", i), v)
+	}
+}
+
+func TestAggregatedRecordsRandomKey(t *testing.T) {
+	k := newKinesisOutput(t)
+	k.Partition.Method = "random"
+	k.AggregateMaxSize = 200
+
+	var metrics []telegraf.Metric
+	for i := 0; i < 10; i++ {
+		metrics = append(metrics, hostMetric(t, fmt.Sprintf("host%d", i), int64(i)))
+	}
+	records, err := k.aggregatedRecords(metrics)
+	require.NoError(t, err)
+	require.True(t, len(records) > 1)
+
+	// the metrics are aggregated regardless of their tags, with a key per
+	// record
+	assert.NotEqual(t, *records[0].PartitionKey, *records[1].PartitionKey)
+	for _, record := range records {
+		_, err := uuid.FromString(*record.PartitionKey)
+		assert.NoError(t, err)
+		keys, data := deaggregate(t, record.Data)
+		assert.Equal(t, []string{*record.PartitionKey}, keys)
+		assert.True(t, len(data) > 1)
+		assert.True(t, len(record.Data) <= k.AggregateMaxSize)
+	}
+}
@@ -239,6 +239,14 @@ func (g *Gauge) setValue(v interface{}) error {
 		g.Value = float64(int32(d))
 	case int64:
 		g.Value = float64(int64(d))
+	case uint64:
+		g.Value = float64(d)
+	case bool:
+		if d {
+			g.Value = 1
+		} else {
+			g.Value = 0
+		}
 	case float32:
 		g.Value = float64(d)
 	case float64:
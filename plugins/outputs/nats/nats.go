@@ -1,7 +1,9 @@
 package nats
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
 	nats_client "github.com/nats-io/nats"
 
@@ -29,6 +31,11 @@ type NATS struct {
 	// Use SSL but skip chain & host verification
 	InsecureSkipVerify bool
 
+	// JetStream waits for the acknowledgement of the stream of the subject
+	// for each message, up to JetStreamTimeout.
+	JetStream        bool              `toml:"jetstream"`
+	JetStreamTimeout internal.Duration `toml:"jetstream_timeout"`
+
 	conn       *nats_client.Conn
 	serializer serializers.Serializer
 }
@@ -42,6 +49,11 @@ var sampleConfig = `
   ## NATS subject for producer messages
   subject = "telegraf"
 
+  ## Wait for the acknowledgement of the JetStream stream capturing the
+  ## subject for each message, a write fails if one is not stored.
+  # jetstream = false
+  # jetstream_timeout = "5s"
+
   ## Optional SSL Config
   # ssl_ca = "/etc/telegraf/ca.pem"
   # ssl_cert = "/etc/telegraf/cert.pem"
@@ -120,7 +132,11 @@ func (n *NATS) Write(metrics []telegraf.Metric) error {
 			return err
 		}
 
-		err = n.conn.Publish(n.Subject, buf)
+		if n.JetStream {
+			err = n.publishJetStream(buf)
+		} else {
+			err = n.conn.Publish(n.Subject, buf)
+		}
 		if err != nil {
 			return fmt.Errorf("FAILED to send NATS message: %s", err)
 		}
@@ -128,6 +144,45 @@ func (n *NATS) Write(metrics []telegraf.Metric) error {
 	return nil
 }
 
+// pubAck is the reply of JetStream to a message published to a stream.
+type pubAck struct {
+	Stream string `json:"stream"`
+	Error  *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// publishJetStream publishes a message and waits for the acknowledgement of
+// the stream storing it.
+func (n *NATS) publishJetStream(buf []byte) error {
+	timeout := n.JetStreamTimeout.Duration
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	reply, err := n.conn.Request(n.Subject, buf, timeout)
+	if err != nil {
+		return err
+	}
+	return checkPubAck(reply.Data)
+}
+
+// checkPubAck returns the error of a JetStream acknowledgement.
+func checkPubAck(data []byte) error {
+	var ack pubAck
+	if err := json.Unmarshal(data, &ack); err != nil {
+		return fmt.Errorf("invalid JetStream acknowledgement %q: %s", data, err)
+	}
+	if ack.Error != nil {
+		return fmt.Errorf("JetStream error %d: %s", ack.Error.Code,
+			ack.Error.Description)
+	}
+	if ack.Stream == "" {
+		return fmt.Errorf("invalid JetStream acknowledgement %q", data)
+	}
+	return nil
+}
+
 func init() {
 	outputs.Add("nats", func() telegraf.Output {
 		return &NATS{}
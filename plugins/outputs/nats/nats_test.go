@@ -29,3 +29,10 @@ func TestConnectAndWrite(t *testing.T) {
 	err = n.Write(testutil.MockMetrics())
 	require.NoError(t, err)
 }
+
+func TestCheckPubAck(t *testing.T) {
+	require.NoError(t, checkPubAck([]byte(`{"stream":"metrics","seq":42}`)))
+	require.Error(t, checkPubAck([]byte(`{"error":{"code":503,"description":"no responders"}}`)))
+	require.Error(t, checkPubAck([]byte(`{}`)))
+	require.Error(t, checkPubAck([]byte(`+OK`)))
+}
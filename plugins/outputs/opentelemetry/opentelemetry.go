@@ -0,0 +1,331 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/outputs"
+)
+
+// exportPath is the gRPC method of the OTLP metrics service.
+const exportPath = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+// OpenTelemetry exports metrics to an OpenTelemetry collector with the OTLP
+// protocol over gRPC.
+type OpenTelemetry struct {
+	ServiceAddress string
+	Timeout        internal.Duration
+	Compression    string
+	Headers        map[string]string
+	MaxRetries     int
+	RetryBackoff   internal.Duration
+
+	MetricNameSeparator   string
+	GaugeFields           []string
+	SumFields             []string
+	HistogramMeasurements []string
+	Temporality           string
+	// GlobalTagsAsResource exports the global tags as the attributes of the
+	// resource rather than of the data points.
+	GlobalTagsAsResource bool `toml:"global_tags_as_resource"`
+
+	// Path to CA file
+	SSLCA string `toml:"ssl_ca"`
+	// Path to host cert file
+	SSLCert string `toml:"ssl_cert"`
+	// Path to cert key file
+	SSLKey string `toml:"ssl_key"`
+	// Use SSL but skip chain & host verification
+	InsecureSkipVerify bool
+
+	url        string
+	transport  *http2.Transport
+	client     *http.Client
+	mapping    *mapping
+	globalTags map[string]string
+}
+
+var sampleConfig = `
+  ## Address of the OTLP gRPC receiver, https enables TLS.
+  service_address = "http://localhost:4317"
+
+  ## Timeout of an export request.
+  # timeout = "5s"
+
+  ## Compression of the requests, "gzip" or "" for none.
+  # compression = "gzip"
+
+  ## Number of retries of a batch after a network error or a retryable gRPC
+  ## status (UNAVAILABLE, RESOURCE_EXHAUSTED...), the wait between retries
+  ## starts at retry_backoff and doubles each time.
+  # max_retries = 3
+  # retry_backoff = "1s"
+
+  ## Every numeric field is exported as a data point of the metric named
+  ## <measurement><metric_name_separator><field>, with the tags as
+  ## attributes. Fields of counter metrics are exported as monotonic sums and
+  ## the others as gauges, the following glob patterns of metric names
+  ## override this.
+  # metric_name_separator = "_"
+  # gauge_fields = []
+  # sum_fields = ["*_total", "*_count"]
+  ## Measurements exported as histograms, in the format of the prometheus
+  ## input: a field per bucket, named after its upper bound, holding its
+  ## cumulative count, and the count and sum fields.
+  # histogram_measurements = ["*_seconds"]
+  ## Aggregation temporality of the sums and histograms, "cumulative" or
+  ## "delta".
+  # temporality = "cumulative"
+
+  ## Export the global tags as the attributes of the resource, the other
+  ## tags are the attributes of the data points. A metric whose global tags
+  ## were removed or modified is exported with the resource of the remaining
+  ## ones.
+  # global_tags_as_resource = true
+
+  ## Additional gRPC metadata sent with every request.
+  # [outputs.opentelemetry.headers]
+  #   authorization = "Bearer xxx"
+
+  ## Optional SSL Config
+  # ssl_ca = "/etc/telegraf/ca.pem"
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+  ## Use SSL but skip chain & host verification
+  # insecure_skip_verify = false
+`
+
+func (o *OpenTelemetry) SampleConfig() string {
+	return sampleConfig
+}
+
+func (o *OpenTelemetry) Description() string {
+	return "Send metrics to an OpenTelemetry collector over OTLP/gRPC"
+}
+
+func (o *OpenTelemetry) SetGlobalTags(tags map[string]string) {
+	o.globalTags = tags
+}
+
+func (o *OpenTelemetry) Connect() error {
+	u, err := url.Parse(o.ServiceAddress)
+	if err != nil {
+		return fmt.Errorf("invalid service_address %q: %s", o.ServiceAddress, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid service_address %q: scheme must be http or https",
+			o.ServiceAddress)
+	}
+	if o.Compression != "" && o.Compression != "gzip" {
+		return fmt.Errorf("unsupported compression %q", o.Compression)
+	}
+
+	mp := &mapping{
+		separator: o.MetricNameSeparator,
+		start:     time.Now(),
+	}
+	switch o.Temporality {
+	case "", "cumulative":
+		mp.temporality = temporalityCumulative
+	case "delta":
+		mp.temporality = temporalityDelta
+	default:
+		return fmt.Errorf("invalid temporality %q, must be cumulative or delta",
+			o.Temporality)
+	}
+	if mp.gauges, err = filter.Compile(o.GaugeFields); err != nil {
+		return fmt.Errorf("invalid gauge_fields: %s", err)
+	}
+	if mp.sums, err = filter.Compile(o.SumFields); err != nil {
+		return fmt.Errorf("invalid sum_fields: %s", err)
+	}
+	if mp.histograms, err = filter.Compile(o.HistogramMeasurements); err != nil {
+		return fmt.Errorf("invalid histogram_measurements: %s", err)
+	}
+	if o.GlobalTagsAsResource {
+		mp.resource = o.globalTags
+	}
+	o.mapping = mp
+
+	if u.Scheme == "https" {
+		tlsCfg, err := internal.GetTLSConfig(
+			o.SSLCert, o.SSLKey, o.SSLCA, o.InsecureSkipVerify)
+		if err != nil {
+			return err
+		}
+		if tlsCfg == nil {
+			tlsCfg = &tls.Config{}
+		}
+		o.transport = &http2.Transport{TLSClientConfig: tlsCfg}
+	} else {
+		// gRPC without TLS is HTTP/2 over cleartext
+		timeout := o.Timeout.Duration
+		o.transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.DialTimeout(network, addr, timeout)
+			},
+		}
+	}
+	o.client = &http.Client{
+		Transport: o.transport,
+		Timeout:   o.Timeout.Duration,
+	}
+	o.url = strings.TrimSuffix(o.ServiceAddress, "/") + exportPath
+	return nil
+}
+
+func (o *OpenTelemetry) Close() error {
+	if o.transport != nil {
+		o.transport.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (o *OpenTelemetry) Write(metrics []telegraf.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	msg := o.mapping.exportRequest(metrics)
+	body, err := o.frame(msg)
+	if err != nil {
+		return err
+	}
+
+	backoff := o.RetryBackoff.Duration
+	for attempt := 0; ; attempt++ {
+		retry, err := o.export(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= o.MaxRetries {
+			return fmt.Errorf("unable to export to %s: %s", o.ServiceAddress, err)
+		}
+		log.Printf("W! Failed to export to %s, retrying in %s: %s",
+			o.ServiceAddress, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// frame returns msg as a gRPC length-prefixed message.
+func (o *OpenTelemetry) frame(msg []byte) ([]byte, error) {
+	var compressed byte
+	if o.Compression == "gzip" {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(msg); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		msg = buf.Bytes()
+		compressed = 1
+	}
+	body := make([]byte, 5, 5+len(msg))
+	body[0] = compressed
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	return append(body, msg...), nil
+}
+
+// gRPC status codes worth a retry
+var retryableCodes = map[int]bool{
+	1:  true, // CANCELLED
+	4:  true, // DEADLINE_EXCEEDED
+	8:  true, // RESOURCE_EXHAUSTED
+	10: true, // ABORTED
+	11: true, // OUT_OF_RANGE
+	14: true, // UNAVAILABLE
+	15: true, // DATA_LOSS
+}
+
+// export calls the Export method with body, it returns whether a failure is
+// worth a retry.
+func (o *OpenTelemetry) export(body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", o.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("User-Agent", "telegraf")
+	if o.Compression == "gzip" {
+		req.Header.Set("Grpc-Encoding", "gzip")
+	}
+	if o.Timeout.Duration > 0 {
+		req.Header.Set("Grpc-Timeout",
+			strconv.FormatInt(int64(o.Timeout.Duration/time.Millisecond), 10)+"m")
+	}
+	for k, v := range o.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	// the trailers are only available once the body is read
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode == http.StatusTooManyRequests ||
+			resp.StatusCode == http.StatusBadGateway ||
+			resp.StatusCode == http.StatusServiceUnavailable ||
+			resp.StatusCode == http.StatusGatewayTimeout
+		return retry, fmt.Errorf("received HTTP status code %d", resp.StatusCode)
+	}
+
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// trailers-only response
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	if status == "" {
+		return true, fmt.Errorf("response without gRPC status")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return false, fmt.Errorf("invalid gRPC status %q", status)
+	}
+	if code == 0 {
+		return false, nil
+	}
+	if m, err := url.QueryUnescape(message); err == nil {
+		message = m
+	}
+	return retryableCodes[code], fmt.Errorf("received gRPC status %d: %s", code, message)
+}
+
+func init() {
+	outputs.Add("opentelemetry", func() telegraf.Output {
+		return &OpenTelemetry{
+			ServiceAddress:       "http://localhost:4317",
+			Timeout:              internal.Duration{Duration: 5 * time.Second},
+			Compression:          "gzip",
+			MaxRetries:           3,
+			RetryBackoff:         internal.Duration{Duration: time.Second},
+			MetricNameSeparator:  "_",
+			GlobalTagsAsResource: true,
+		}
+	})
+}
@@ -0,0 +1,361 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// message is a decoded protobuf message, the values of each field are
+// either uint64, for varint and fixed64 fields, or []byte.
+type message map[int][]interface{}
+
+func decode(t *testing.T, b []byte) message {
+	msg := make(message)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		require.True(t, n > 0, "invalid tag")
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			require.True(t, n > 0, "invalid varint")
+			b = b[n:]
+			msg[field] = append(msg[field], v)
+		case wireFixed64:
+			require.True(t, len(b) >= 8, "truncated fixed64")
+			msg[field] = append(msg[field], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			require.True(t, n > 0 && uint64(len(b)-n) >= l, "truncated bytes")
+			msg[field] = append(msg[field], b[n:n+int(l)])
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return msg
+}
+
+func (m message) sub(t *testing.T, field int) []message {
+	var out []message
+	for _, v := range m[field] {
+		out = append(out, decode(t, v.([]byte)))
+	}
+	return out
+}
+
+func (m message) str(field int) string {
+	if len(m[field]) == 0 {
+		return ""
+	}
+	return string(m[field][0].([]byte))
+}
+
+func (m message) num(field int) uint64 {
+	if len(m[field]) == 0 {
+		return 0
+	}
+	return m[field][0].(uint64)
+}
+
+// otlpMetrics decodes an ExportMetricsServiceRequest and returns its
+// metrics by name.
+func otlpMetrics(t *testing.T, req []byte) map[string]message {
+	rms := decode(t, req).sub(t, 1)
+	require.Len(t, rms, 1)
+	sms := rms[0].sub(t, 2)
+	require.Len(t, sms, 1)
+	assert.Equal(t, "telegraf", sms[0].sub(t, 1)[0].str(1))
+
+	out := make(map[string]message)
+	for _, m := range sms[0].sub(t, 2) {
+		out[m.str(1)] = m
+	}
+	return out
+}
+
+func pointAttributes(t *testing.T, p message, field int) map[string]string {
+	attrs := make(map[string]string)
+	for _, kv := range p.sub(t, field) {
+		attrs[kv.str(1)] = kv.sub(t, 2)[0].str(1)
+	}
+	return attrs
+}
+
+func mustMetric(
+	t *testing.T,
+	name string,
+	tags map[string]string,
+	fields map[string]interface{},
+	tp ...telegraf.ValueType,
+) telegraf.Metric {
+	m, err := metric.New(name, tags, fields, time.Unix(1500000000, 0), tp...)
+	require.NoError(t, err)
+	return m
+}
+
+func newMapping(t *testing.T) *mapping {
+	sums, err := filter.Compile([]string{"*_total"})
+	require.NoError(t, err)
+	gauges, err := filter.Compile([]string{"net_errors"})
+	require.NoError(t, err)
+	histograms, err := filter.Compile([]string{"*_seconds"})
+	require.NoError(t, err)
+	return &mapping{
+		separator:   "_",
+		sums:        sums,
+		gauges:      gauges,
+		histograms:  histograms,
+		temporality: temporalityCumulative,
+		start:       time.Unix(1400000000, 0),
+	}
+}
+
+func TestExportRequest(t *testing.T) {
+	metrics := []telegraf.Metric{
+		mustMetric(t, "cpu",
+			map[string]string{"host": "a", "cpu": "cpu0"},
+			map[string]interface{}{"usage": 42.5, "state": "ok", "up": true}),
+		mustMetric(t, "cpu",
+			map[string]string{"host": "b", "cpu": "cpu0"},
+			map[string]interface{}{"usage": 12.5}),
+		mustMetric(t, "requests",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"total": int64(3)}),
+		mustMetric(t, "net",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"errors": int64(5), "packets": uint64(7)},
+			telegraf.Counter),
+	}
+	ms := otlpMetrics(t, newMapping(t).exportRequest(metrics))
+	require.Len(t, ms, 5)
+
+	// gauges
+	usage := ms["cpu_usage"].sub(t, 5)
+	require.Len(t, usage, 1)
+	points := usage[0].sub(t, 1)
+	require.Len(t, points, 2)
+	assert.Equal(t, uint64(time.Unix(1500000000, 0).UnixNano()), points[0].num(3))
+	assert.Nil(t, points[0][2])
+	assert.Equal(t, 42.5, math.Float64frombits(points[0].num(4)))
+	assert.Equal(t, map[string]string{"host": "a", "cpu": "cpu0"},
+		pointAttributes(t, points[0], 7))
+	assert.Equal(t, 12.5, math.Float64frombits(points[1].num(4)))
+	assert.Equal(t, "b", pointAttributes(t, points[1], 7)["host"])
+
+	up := ms["cpu_up"].sub(t, 5)[0].sub(t, 1)
+	assert.Equal(t, uint64(1), up[0].num(6))
+	assert.NotContains(t, ms, "cpu_state")
+
+	// net_errors is a counter but gauge_fields wins
+	assert.Len(t, ms["net_errors"].sub(t, 5), 1)
+
+	// sums
+	for _, name := range []string{"requests_total", "net_packets"} {
+		sums := ms[name].sub(t, 7)
+		require.Len(t, sums, 1, name)
+		assert.Equal(t, uint64(temporalityCumulative), sums[0].num(2))
+		assert.Equal(t, uint64(1), sums[0].num(3))
+		p := sums[0].sub(t, 1)[0]
+		assert.Equal(t, uint64(time.Unix(1400000000, 0).UnixNano()), p.num(2))
+	}
+	assert.Equal(t, uint64(3), ms["requests_total"].sub(t, 7)[0].sub(t, 1)[0].num(6))
+	assert.Equal(t, uint64(7), ms["net_packets"].sub(t, 7)[0].sub(t, 1)[0].num(6))
+}
+
+func TestExportRequestHistogram(t *testing.T) {
+	metrics := []telegraf.Metric{
+		mustMetric(t, "latency_seconds",
+			map[string]string{"host": "a"},
+			map[string]interface{}{
+				"0.1":   float64(2),
+				"0.5":   float64(5),
+				"1":     float64(9),
+				"+Inf":  float64(10),
+				"count": float64(10),
+				"sum":   float64(4.5),
+			}),
+	}
+	mp := newMapping(t)
+	mp.temporality = temporalityDelta
+	ms := otlpMetrics(t, mp.exportRequest(metrics))
+	require.Len(t, ms, 1)
+
+	hist := ms["latency_seconds"].sub(t, 9)
+	require.Len(t, hist, 1)
+	assert.Equal(t, uint64(temporalityDelta), hist[0].num(2))
+	points := hist[0].sub(t, 1)
+	require.Len(t, points, 1)
+	p := points[0]
+	assert.Nil(t, p[2])
+	assert.Equal(t, uint64(10), p.num(4))
+	assert.Equal(t, 4.5, math.Float64frombits(p.num(5)))
+
+	var counts []uint64
+	packed := p[6][0].([]byte)
+	for i := 0; i < len(packed); i += 8 {
+		counts = append(counts, binary.LittleEndian.Uint64(packed[i:]))
+	}
+	assert.Equal(t, []uint64{2, 3, 4, 1}, counts)
+
+	var bounds []float64
+	packed = p[7][0].([]byte)
+	for i := 0; i < len(packed); i += 8 {
+		bounds = append(bounds, math.Float64frombits(binary.LittleEndian.Uint64(packed[i:])))
+	}
+	assert.Equal(t, []float64{0.1, 0.5, 1}, bounds)
+	assert.Equal(t, map[string]string{"host": "a"}, pointAttributes(t, p, 9))
+}
+
+// newCollector returns a TLS HTTP/2 server answering the Export calls with
+// the gRPC status returned by status, the decoded requests are sent to reqs.
+func newCollector(t *testing.T, reqs chan<- []byte, status func() string) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, exportPath, r.URL.Path)
+		assert.Equal(t, "application/grpc+proto", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		if assert.True(t, len(body) >= 5) {
+			msg := body[5:]
+			assert.Equal(t, uint32(len(msg)), binary.BigEndian.Uint32(body[1:5]))
+			if body[0] == 1 {
+				assert.Equal(t, "gzip", r.Header.Get("Grpc-Encoding"))
+				gz, err := gzip.NewReader(bytes.NewReader(msg))
+				assert.NoError(t, err)
+				msg, err = ioutil.ReadAll(gz)
+				assert.NoError(t, err)
+			}
+			reqs <- msg
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Grpc-Status", status())
+		w.Header().Set("Grpc-Message", "try%20again")
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	return ts
+}
+
+func newOpenTelemetry(url string) *OpenTelemetry {
+	return &OpenTelemetry{
+		ServiceAddress:      url,
+		Timeout:             internal.Duration{Duration: 5 * time.Second},
+		Compression:         "gzip",
+		Headers:             map[string]string{"Authorization": "Bearer secret"},
+		MaxRetries:          2,
+		MetricNameSeparator: "_",
+		InsecureSkipVerify:  true,
+	}
+}
+
+func TestWrite(t *testing.T) {
+	reqs := make(chan []byte, 10)
+	statuses := []string{"14", "0"}
+	ts := newCollector(t, reqs, func() string {
+		s := statuses[0]
+		statuses = statuses[1:]
+		return s
+	})
+	defer ts.Close()
+
+	o := newOpenTelemetry(ts.URL)
+	require.NoError(t, o.Connect())
+	defer o.Close()
+
+	metrics := []telegraf.Metric{
+		mustMetric(t, "cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 42.5}),
+	}
+	require.NoError(t, o.Write(metrics))
+
+	// UNAVAILABLE then OK
+	require.Len(t, reqs, 2)
+	<-reqs
+	ms := otlpMetrics(t, <-reqs)
+	assert.Contains(t, ms, "cpu_usage")
+}
+
+func TestWriteError(t *testing.T) {
+	reqs := make(chan []byte, 10)
+	ts := newCollector(t, reqs, func() string { return "3" })
+	defer ts.Close()
+
+	o := newOpenTelemetry(ts.URL)
+	require.NoError(t, o.Connect())
+	defer o.Close()
+
+	err := o.Write([]telegraf.Metric{
+		mustMetric(t, "cpu", nil, map[string]interface{}{"usage": 42.5}),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "received gRPC status 3: try again")
+	// INVALID_ARGUMENT is not retried
+	assert.Len(t, reqs, 1)
+}
+
+func TestConnectInvalid(t *testing.T) {
+	o := newOpenTelemetry("localhost:4317")
+	assert.Error(t, o.Connect())
+
+	o = newOpenTelemetry("http://localhost:4317")
+	o.Temporality = "sometimes"
+	assert.Error(t, o.Connect())
+}
+
+func TestExportRequestResource(t *testing.T) {
+	mp := newMapping(t)
+	mp.resource = map[string]string{"dc": "eu", "host": "a"}
+	metrics := []telegraf.Metric{
+		mustMetric(t, "cpu",
+			map[string]string{"dc": "eu", "host": "a", "cpu": "cpu0"},
+			map[string]interface{}{"usage": 42.5}),
+		mustMetric(t, "mem",
+			map[string]string{"dc": "eu", "host": "a"},
+			map[string]interface{}{"used": 10.5}),
+		// a global tag overridden by the input
+		mustMetric(t, "cpu",
+			map[string]string{"dc": "eu", "host": "b", "cpu": "cpu0"},
+			map[string]interface{}{"usage": 12.5}),
+	}
+	rms := decode(t, mp.exportRequest(metrics)).sub(t, 1)
+	require.Len(t, rms, 2)
+
+	assert.Equal(t, map[string]string{"dc": "eu", "host": "a"},
+		pointAttributes(t, rms[0].sub(t, 1)[0], 1))
+	ms := rms[0].sub(t, 2)[0].sub(t, 2)
+	require.Len(t, ms, 2)
+	assert.Equal(t, "cpu_usage", ms[0].str(1))
+	assert.Equal(t, map[string]string{"cpu": "cpu0"},
+		pointAttributes(t, ms[0].sub(t, 5)[0].sub(t, 1)[0], 7))
+	assert.Equal(t, "mem_used", ms[1].str(1))
+	assert.Empty(t, ms[1].sub(t, 5)[0].sub(t, 1)[0][7])
+
+	assert.Equal(t, map[string]string{"dc": "eu"},
+		pointAttributes(t, rms[1].sub(t, 1)[0], 1))
+	ms = rms[1].sub(t, 2)[0].sub(t, 2)
+	require.Len(t, ms, 1)
+	assert.Equal(t, map[string]string{"cpu": "cpu0", "host": "b"},
+		pointAttributes(t, ms[0].sub(t, 5)[0].sub(t, 1)[0], 7))
+}
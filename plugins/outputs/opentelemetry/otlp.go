@@ -0,0 +1,359 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+)
+
+// kinds of OTLP metrics
+const (
+	kindGauge = iota
+	kindSum
+	kindHistogram
+)
+
+// values of the AggregationTemporality enum
+const (
+	temporalityDelta      = 1
+	temporalityCumulative = 2
+)
+
+// mapping holds the rules deciding how telegraf fields become OTLP metrics.
+type mapping struct {
+	separator   string
+	gauges      filter.Filter
+	sums        filter.Filter
+	histograms  filter.Filter
+	temporality uint64
+	// start time of the cumulative sums and histograms
+	start time.Time
+	// resource tags, the global tags
+	resource map[string]string
+}
+
+// otlpMetric is an OTLP metric and its encoded data points.
+type otlpMetric struct {
+	name   string
+	kind   int
+	points [][]byte
+}
+
+// resourceMetrics are the OTLP metrics of a resource.
+type resourceMetrics struct {
+	attrs  [][]byte
+	order  []*otlpMetric
+	byName map[string]*otlpMetric
+}
+
+func (rm *resourceMetrics) add(name string, kind int, point []byte) {
+	key := strconv.Itoa(kind) + name
+	om, ok := rm.byName[key]
+	if !ok {
+		om = &otlpMetric{name: name, kind: kind}
+		rm.byName[key] = om
+		rm.order = append(rm.order, om)
+	}
+	om.points = append(om.points, point)
+}
+
+// exportRequest returns an encoded ExportMetricsServiceRequest of the
+// metrics. Every numeric field is a data point of the OTLP metric named
+// <measurement><separator><field>, with the tags as attributes, except for
+// the histogram measurements whose fields are the buckets of a single data
+// point. String fields are not exported. The tags of the metrics which are
+// resource tags are the attributes of the resource of their metrics instead.
+func (mp *mapping) exportRequest(metrics []telegraf.Metric) []byte {
+	var resources []*resourceMetrics
+	byResource := make(map[string]*resourceMetrics)
+
+	for _, m := range metrics {
+		resourceTags, tags := mp.splitTags(m.Tags())
+		resourceAttrs := attributes(resourceTags)
+		key := string(bytes.Join(resourceAttrs, nil))
+		rm, ok := byResource[key]
+		if !ok {
+			rm = &resourceMetrics{
+				attrs:  resourceAttrs,
+				byName: make(map[string]*otlpMetric),
+			}
+			byResource[key] = rm
+			resources = append(resources, rm)
+		}
+
+		attrs := attributes(tags)
+		if mp.histograms != nil && mp.histograms.Match(m.Name()) {
+			if point, ok := mp.histogramPoint(m, attrs); ok {
+				rm.add(m.Name(), kindHistogram, point)
+			}
+			continue
+		}
+
+		fields := m.Fields()
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			name := m.Name() + mp.separator + k
+			kind := mp.kind(name, m.Type())
+			if point, ok := mp.numberPoint(fields[k], kind, m.Time(), attrs); ok {
+				rm.add(name, kind, point)
+			}
+		}
+	}
+
+	var req []byte
+	for _, rm := range resources {
+		var resource []byte
+		for _, a := range rm.attrs {
+			resource = appendBytes(resource, 1, a)
+		}
+		var scope []byte
+		// InstrumentationScope
+		scope = appendBytes(scope, 1, appendString(nil, 1, "telegraf"))
+		for _, om := range rm.order {
+			scope = appendBytes(scope, 2, mp.encodeMetric(om))
+		}
+		// ResourceMetrics with a single ScopeMetrics
+		b := appendBytes(nil, 1, resource)
+		b = appendBytes(b, 2, scope)
+		req = appendBytes(req, 1, b)
+	}
+	return req
+}
+
+// splitTags splits the tags into the resource tags, the tags having the
+// value of a resource tag of the mapping, and the others.
+func (mp *mapping) splitTags(tags map[string]string) (map[string]string, map[string]string) {
+	if len(mp.resource) == 0 {
+		return nil, tags
+	}
+	resource := make(map[string]string)
+	others := make(map[string]string, len(tags))
+	for k, v := range tags {
+		if rv, ok := mp.resource[k]; ok && rv == v {
+			resource[k] = v
+		} else {
+			others[k] = v
+		}
+	}
+	return resource, others
+}
+
+func (mp *mapping) kind(name string, t telegraf.ValueType) int {
+	if mp.gauges != nil && mp.gauges.Match(name) {
+		return kindGauge
+	}
+	if t == telegraf.Counter || (mp.sums != nil && mp.sums.Match(name)) {
+		return kindSum
+	}
+	return kindGauge
+}
+
+func (mp *mapping) encodeMetric(om *otlpMetric) []byte {
+	var data []byte
+	for _, p := range om.points {
+		data = appendBytes(data, 1, p)
+	}
+
+	b := appendString(nil, 1, om.name)
+	switch om.kind {
+	case kindGauge:
+		b = appendBytes(b, 5, data)
+	case kindSum:
+		data = appendVarintField(data, 2, mp.temporality)
+		data = appendVarintField(data, 3, 1) // is_monotonic
+		b = appendBytes(b, 7, data)
+	case kindHistogram:
+		data = appendVarintField(data, 2, mp.temporality)
+		b = appendBytes(b, 9, data)
+	}
+	return b
+}
+
+// numberPoint encodes a NumberDataPoint, it returns false for values that
+// can not be exported.
+func (mp *mapping) numberPoint(
+	v interface{},
+	kind int,
+	t time.Time,
+	attrs [][]byte,
+) ([]byte, bool) {
+	var b []byte
+	if kind == kindSum && mp.temporality == temporalityCumulative {
+		b = appendFixed64Field(b, 2, uint64(mp.start.UnixNano()))
+	}
+	b = appendFixed64Field(b, 3, uint64(t.UnixNano()))
+	switch v := v.(type) {
+	case float64:
+		b = appendFixed64Field(b, 4, math.Float64bits(v))
+	case int64:
+		b = appendFixed64Field(b, 6, uint64(v))
+	case uint64:
+		if v <= math.MaxInt64 {
+			b = appendFixed64Field(b, 6, v)
+		} else {
+			b = appendFixed64Field(b, 4, math.Float64bits(float64(v)))
+		}
+	case bool:
+		var i uint64
+		if v {
+			i = 1
+		}
+		b = appendFixed64Field(b, 6, i)
+	default:
+		return nil, false
+	}
+	for _, a := range attrs {
+		b = appendBytes(b, 7, a)
+	}
+	return b, true
+}
+
+// histogramPoint encodes a HistogramDataPoint from the fields of a
+// histogram in the format of the prometheus input: the cumulative count of
+// each bucket in a field named after its upper bound, and the count and sum
+// fields. It returns false if the metric has no count.
+func (mp *mapping) histogramPoint(m telegraf.Metric, attrs [][]byte) ([]byte, bool) {
+	type bucket struct {
+		bound float64
+		count float64
+	}
+	var buckets []bucket
+	var count, sum float64
+	var hasCount, hasSum bool
+	for k, v := range m.Fields() {
+		f, ok := toFloat(v)
+		if !ok {
+			continue
+		}
+		switch k {
+		case "count":
+			count, hasCount = f, true
+		case "sum":
+			sum, hasSum = f, true
+		default:
+			bound, err := strconv.ParseFloat(k, 64)
+			if err != nil {
+				continue
+			}
+			buckets = append(buckets, bucket{bound, f})
+		}
+	}
+	if !hasCount {
+		return nil, false
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].bound < buckets[j].bound })
+
+	var bounds, counts []byte
+	var prev float64
+	for _, bk := range buckets {
+		if math.IsInf(bk.bound, 1) {
+			break
+		}
+		bounds = appendFixed64(bounds, math.Float64bits(bk.bound))
+		counts = appendFixed64(counts, uint64(bk.count-prev))
+		prev = bk.count
+	}
+	// the +Inf bucket
+	counts = appendFixed64(counts, uint64(count-prev))
+
+	var b []byte
+	if mp.temporality == temporalityCumulative {
+		b = appendFixed64Field(b, 2, uint64(mp.start.UnixNano()))
+	}
+	b = appendFixed64Field(b, 3, uint64(m.Time().UnixNano()))
+	b = appendFixed64Field(b, 4, uint64(count))
+	if hasSum {
+		b = appendFixed64Field(b, 5, math.Float64bits(sum))
+	}
+	b = appendBytes(b, 6, counts)
+	if len(bounds) > 0 {
+		b = appendBytes(b, 7, bounds)
+	}
+	for _, a := range attrs {
+		b = appendBytes(b, 9, a)
+	}
+	return b, true
+}
+
+// attributes returns the tags as encoded KeyValues with string values,
+// sorted by key.
+func attributes(tags map[string]string) [][]byte {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		kv := appendString(nil, 1, k)
+		kv = appendBytes(kv, 2, appendString(nil, 1, tags[k]))
+		attrs = append(attrs, kv)
+	}
+	return attrs
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// protobuf wire format
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, field int, wire int) []byte {
+	return appendVarint(b, uint64(field)<<3|uint64(wire))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	return appendVarint(appendTag(b, field, wireVarint), v)
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24),
+		byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56))
+}
+
+func appendFixed64Field(b []byte, field int, v uint64) []byte {
+	return appendFixed64(appendTag(b, field, wireFixed64), v)
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, s string) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
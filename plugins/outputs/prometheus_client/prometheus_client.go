@@ -1,9 +1,12 @@
 package prometheus_client
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"regexp"
 	"sort"
@@ -46,6 +49,12 @@ type PrometheusClient struct {
 	Listen             string
 	ExpirationInterval internal.Duration `toml:"expiration_interval"`
 
+	// Path to the TLS certificate and key of the listener and to the CAs
+	// client certificates must be signed by.
+	SSLCert             string   `toml:"ssl_cert"`
+	SSLKey              string   `toml:"ssl_key"`
+	SSLAllowedClientCAs []string `toml:"ssl_allowed_client_ca"`
+
 	server *http.Server
 
 	sync.Mutex
@@ -60,16 +69,37 @@ var sampleConfig = `
   # listen = ":9273"
 
   ## Interval to expire metrics and not deliver to prometheus, 0 == no expiration
+  ## Set it to a few collection intervals to drop the series which are no
+  ## longer updated.
   # expiration_interval = "60s"
+
+  ## TLS certificate and key, enables HTTPS.
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+
+  ## If set, clients must present a certificate signed by one of these CAs.
+  # ssl_allowed_client_ca = ["/etc/telegraf/clientca.pem"]
 `
 
 func (p *PrometheusClient) Start() error {
-	prometheus.Register(p)
-
 	if p.Listen == "" {
 		p.Listen = "localhost:9273"
 	}
 
+	tlsConfig, err := internal.GetServerTLSConfig(p.SSLCert, p.SSLKey, p.SSLAllowedClientCAs)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", p.Listen)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	prometheus.Register(p)
+
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", prometheus.Handler())
 
@@ -79,9 +109,9 @@ func (p *PrometheusClient) Start() error {
 	}
 
 	go func() {
-		if err := p.server.ListenAndServe(); err != nil {
+		if err := p.server.Serve(listener); err != nil {
 			if err != http.ErrServerClosed {
-				log.Printf("E! Error creating prometheus metric endpoint, err: %s\n",
+				log.Printf("E! Error serving prometheus metric endpoint, err: %s\n",
 					err.Error())
 			}
 		}
@@ -169,6 +199,7 @@ func (p *PrometheusClient) Collect(ch chan<- prometheus.Metric) {
 				log.Printf("E! Error creating prometheus metric, "+
 					"key: %s, labels: %v,\nerr: %s\n",
 					name, labels, err.Error())
+				continue
 			}
 
 			ch <- metric
@@ -177,7 +208,72 @@ func (p *PrometheusClient) Collect(ch chan<- prometheus.Metric) {
 }
 
 func sanitize(value string) string {
-	return invalidNameCharRE.ReplaceAllString(value, "_")
+	value = invalidNameCharRE.ReplaceAllString(value, "_")
+	if value != "" && value[0] >= '0' && value[0] <= '9' {
+		return "_" + value
+	}
+	return value
+}
+
+// sanitizeLabel returns the label of the tag key, whose invalid characters
+// are replaced with underscores. The labels starting with "__" are reserved
+// to Prometheus, they start with a single one.
+func sanitizeLabel(key string) string {
+	label := sanitize(key)
+	if strings.HasPrefix(label, "__") {
+		return "_" + strings.TrimLeft(label, "_")
+	}
+	return label
+}
+
+// escapeLabel returns the label of the tag key whose sanitized label
+// collides with the one of another tag: its characters other than letters
+// and digits are escaped as "_" followed by their hexadecimal code and "_".
+func escapeLabel(key string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "_%02x_", c)
+		}
+	}
+	return sanitizeLabel(buf.String())
+}
+
+// sampleLabels returns the Prometheus labels of the tags. The tags whose
+// keys only differ by invalid characters, ie "a.b" and "a-b", would have the
+// same sanitized label: the keys which are not already valid labels are
+// escaped instead, see escapeLabel.
+func sampleLabels(tags map[string]string) map[string]string {
+	keys := make(map[string][]string, len(tags))
+	for k := range tags {
+		label := sanitizeLabel(k)
+		keys[label] = append(keys[label], k)
+	}
+
+	labels := make(map[string]string, len(tags))
+	for label, ks := range keys {
+		if len(ks) == 1 {
+			labels[label] = tags[ks[0]]
+			continue
+		}
+		for _, k := range ks {
+			if k == label {
+				labels[label] = tags[k]
+				continue
+			}
+			escaped := escapeLabel(k)
+			if _, ok := keys[escaped]; ok {
+				log.Printf("W! Tag %q collides with another tag as prometheus "+
+					"label; dropping it", k)
+				continue
+			}
+			labels[escaped] = tags[k]
+		}
+	}
+	return labels
 }
 
 func valueType(tt telegraf.ValueType) prometheus.ValueType {
@@ -212,19 +308,22 @@ func (p *PrometheusClient) Write(metrics []telegraf.Metric) error {
 		vt := valueType(point.Type())
 		sampleID := CreateSampleID(tags)
 
-		labels := make(map[string]string)
-		for k, v := range tags {
-			labels[sanitize(k)] = v
-		}
+		labels := sampleLabels(tags)
 
 		for fn, fv := range point.Fields() {
-			// Ignore string and bool fields.
+			// Ignore string fields, bool fields are 1 or 0.
 			var value float64
 			switch fv := fv.(type) {
 			case int64:
 				value = float64(fv)
+			case uint64:
+				value = float64(fv)
 			case float64:
 				value = fv
+			case bool:
+				if fv {
+					value = 1
+				}
 			default:
 				continue
 			}
@@ -271,6 +370,11 @@ func (p *PrometheusClient) Write(metrics []telegraf.Metric) error {
 				}
 			}
 
+			if old, ok := fam.Samples[sampleID]; ok {
+				for k := range old.Labels {
+					fam.LabelSet[k]--
+				}
+			}
 			for k, _ := range sample.Labels {
 				fam.LabelSet[k]++
 			}
@@ -1,6 +1,11 @@
 package prometheus_client
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"testing"
 	"time"
 
@@ -147,6 +152,55 @@ func TestWrite_Sanitize(t *testing.T) {
 		"tag_with_dash": "localhost.local"}, sample1.Labels)
 }
 
+func TestWrite_LabelCollision(t *testing.T) {
+	client := NewClient()
+
+	p1, err := metric.New(
+		"foo",
+		map[string]string{
+			"a_b":     "valid",
+			"a.b":     "dot",
+			"a-b":     "dash",
+			"__name":  "reserved",
+			"1st":     "digit",
+			"kube.io": "unique",
+		},
+		map[string]interface{}{"value": 42.0},
+		time.Now())
+	require.NoError(t, err)
+	require.NoError(t, client.Write([]telegraf.Metric{p1}))
+
+	fam, ok := client.fam["foo"]
+	require.True(t, ok)
+	sample, ok := fam.Samples[CreateSampleID(p1.Tags())]
+	require.True(t, ok)
+	require.Equal(t, map[string]string{
+		"a_b":     "valid",
+		"a_2e_b":  "dot",
+		"a_2d_b":  "dash",
+		"_name":   "reserved",
+		"_1st":    "digit",
+		"kube_io": "unique",
+	}, sample.Labels)
+}
+
+func TestWrite_LabelSetReplace(t *testing.T) {
+	client := NewClient()
+
+	p1, err := metric.New(
+		"foo",
+		map[string]string{"host": "localhost"},
+		map[string]interface{}{"value": 1.0},
+		time.Now())
+	require.NoError(t, err)
+	require.NoError(t, client.Write([]telegraf.Metric{p1, p1}))
+
+	// the labels of a replaced sample are counted once
+	fam, ok := client.fam["foo"]
+	require.True(t, ok)
+	require.Equal(t, map[string]int{"host": 1}, fam.LabelSet)
+}
+
 func TestWrite_Gauge(t *testing.T) {
 	client := NewClient()
 
@@ -364,6 +418,38 @@ func TestExpire_TagsWithDecrement(t *testing.T) {
 
 var pTesting *PrometheusClient
 
+func TestStartTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prometheus_client")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile, cert, err := testutil.WriteTLSCert(dir)
+	require.NoError(t, err)
+
+	client := NewClient()
+	client.Listen = "127.0.0.1:9128"
+	client.SSLCert = certFile
+	client.SSLKey = keyFile
+	require.NoError(t, client.Start())
+	defer client.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	c := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}}
+	resp, err := c.Get("https://127.0.0.1:9128/metrics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the plain HTTP requests are refused
+	resp, err = http.Get("http://127.0.0.1:9128/metrics")
+	if err == nil {
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
 func TestPrometheusWritePointEmptyTag(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test in short mode")
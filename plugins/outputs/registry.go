@@ -6,6 +6,13 @@ import (
 
 type Creator func() telegraf.Output
 
+// GlobalTagsOutput is implemented by the outputs which handle the global
+// tags of the configuration apart from the other tags of the metrics.
+type GlobalTagsOutput interface {
+	// SetGlobalTags sets the global tags, the map must not be modified.
+	SetGlobalTags(tags map[string]string)
+}
+
 var Outputs = map[string]Creator{}
 
 func Add(name string, creator Creator) {
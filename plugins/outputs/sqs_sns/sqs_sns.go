@@ -0,0 +1,326 @@
+package sqs_sns
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/influxdata/telegraf"
+	internalaws "github.com/influxdata/telegraf/internal/config/aws"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"github.com/influxdata/telegraf/plugins/serializers"
+)
+
+const (
+	// maxMessageSize is the largest message accepted by SQS and SNS, the
+	// message attributes included. It is also the largest SQS batch.
+	maxMessageSize = 256 * 1024
+	// maxBatchMessages is the largest number of messages of an SQS batch.
+	maxBatchMessages = 10
+	// maxAttributes is the largest number of attributes of a message.
+	maxAttributes = 10
+)
+
+// SQSSNS publishes batches of serialized metrics to an SQS queue or to an
+// SNS topic, with message attributes from the tags of the metrics.
+type SQSSNS struct {
+	Region    string `toml:"region"`
+	AccessKey string `toml:"access_key"`
+	SecretKey string `toml:"secret_key"`
+	RoleARN   string `toml:"role_arn"`
+	Profile   string `toml:"profile"`
+	Filename  string `toml:"shared_credential_file"`
+	Token     string `toml:"token"`
+
+	QueueURL       string   `toml:"queue_url"`
+	TopicARN       string   `toml:"topic_arn"`
+	AttributeTags  []string `toml:"attribute_tags"`
+	MaxMessageSize int      `toml:"max_message_size"`
+	MessageGroupID string   `toml:"message_group_id"`
+
+	sqs        sqsClient
+	sns        snsClient
+	serializer serializers.Serializer
+}
+
+type sqsClient interface {
+	SendMessageBatch(*sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error)
+}
+
+type snsClient interface {
+	Publish(*sns.PublishInput) (*sns.PublishOutput, error)
+}
+
+// message is the body of a message and the attributes shared by the metrics
+// it holds.
+type message struct {
+	body       []byte
+	attributes map[string]string
+}
+
+var sampleConfig = `
+  ## Amazon Region
+  region = "us-east-1"
+
+  ## Amazon Credentials
+  ## Credentials are loaded in the following order
+  ## 1) Assumed credentials via STS if role_arn is specified
+  ## 2) explicit credentials from 'access_key' and 'secret_key'
+  ## 3) shared profile from 'profile'
+  ## 4) environment variables
+  ## 5) shared credentials file
+  ## 6) EC2 Instance Profile
+  #access_key = ""
+  #secret_key = ""
+  #token = ""
+  #role_arn = ""
+  #profile = ""
+  #shared_credential_file = ""
+
+  ## The SQS queue or the SNS topic the metrics are published to, only one
+  ## of them is set.
+  queue_url = "https://sqs.us-east-1.amazonaws.com/123456789012/metrics"
+  # topic_arn = "arn:aws:sns:us-east-1:123456789012:metrics"
+
+  ## Tags copied to the string attributes of the messages, up to 10. The
+  ## metrics are grouped by the values of these tags, so that the attributes
+  ## of a message hold for all of its metrics.
+  # attribute_tags = ["host"]
+
+  ## Maximum size of a message in bytes, the attributes included. SQS and
+  ## SNS accept up to 256 KiB.
+  # max_message_size = 262144
+
+  ## Message group of the messages sent to a FIFO queue, which must have
+  ## content-based deduplication enabled.
+  # message_group_id = "telegraf"
+
+  ## Data format to output.
+  ## Each data format has its own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_OUTPUT.md
+  data_format = "influx"
+`
+
+func (s *SQSSNS) SampleConfig() string {
+	return sampleConfig
+}
+
+func (s *SQSSNS) Description() string {
+	return "Publish metrics to an Amazon SQS queue or SNS topic"
+}
+
+func (s *SQSSNS) SetSerializer(serializer serializers.Serializer) {
+	s.serializer = serializer
+}
+
+func (s *SQSSNS) Connect() error {
+	if (s.QueueURL == "") == (s.TopicARN == "") {
+		return fmt.Errorf("sqs_sns: exactly one of queue_url and topic_arn is required")
+	}
+	if len(s.AttributeTags) > maxAttributes {
+		return fmt.Errorf("sqs_sns: at most %d attribute_tags are supported", maxAttributes)
+	}
+	if s.MessageGroupID != "" && s.TopicARN != "" {
+		return fmt.Errorf("sqs_sns: message_group_id is only supported by the SQS queues")
+	}
+	if s.MaxMessageSize <= 0 || s.MaxMessageSize > maxMessageSize {
+		s.MaxMessageSize = maxMessageSize
+	}
+
+	credentialConfig := &internalaws.CredentialConfig{
+		Region:    s.Region,
+		AccessKey: s.AccessKey,
+		SecretKey: s.SecretKey,
+		RoleARN:   s.RoleARN,
+		Profile:   s.Profile,
+		Filename:  s.Filename,
+		Token:     s.Token,
+	}
+	configProvider := credentialConfig.Credentials()
+
+	if s.QueueURL != "" {
+		s.sqs = sqs.New(configProvider)
+	} else {
+		s.sns = sns.New(configProvider)
+	}
+	return nil
+}
+
+func (s *SQSSNS) Close() error {
+	return nil
+}
+
+func (s *SQSSNS) Write(metrics []telegraf.Metric) error {
+	messages, err := s.messages(metrics)
+	if err != nil {
+		return err
+	}
+	if s.sqs != nil {
+		return s.sendMessages(messages)
+	}
+	return s.publishMessages(messages)
+}
+
+// messages groups the metrics by the values of their attribute tags and
+// packs the serialized metrics of each group in messages of up to
+// max_message_size.
+func (s *SQSSNS) messages(metrics []telegraf.Metric) ([]*message, error) {
+	var groups []string
+	grouped := make(map[string][]telegraf.Metric)
+	attributes := make(map[string]map[string]string)
+	for _, m := range metrics {
+		tags := m.Tags()
+		attrs := make(map[string]string, len(s.AttributeTags))
+		var key []string
+		for _, tag := range s.AttributeTags {
+			value := tags[tag]
+			if value != "" {
+				attrs[tag] = value
+			}
+			key = append(key, strconv.Quote(value))
+		}
+		k := strings.Join(key, ",")
+		if _, ok := grouped[k]; !ok {
+			groups = append(groups, k)
+			attributes[k] = attrs
+		}
+		grouped[k] = append(grouped[k], m)
+	}
+
+	var messages []*message
+	for _, k := range groups {
+		attrs := attributes[k]
+		limit := s.MaxMessageSize - attributesSize(attrs)
+
+		var body []byte
+		for _, m := range grouped[k] {
+			b, err := s.serializer.Serialize(m)
+			if err != nil {
+				return nil, err
+			}
+			if len(b) > limit {
+				log.Printf("W! [outputs.sqs_sns] Dropping the metric %s of %d bytes, "+
+					"larger than a message", m.Name(), len(b))
+				continue
+			}
+			if len(body)+len(b) > limit {
+				messages = append(messages, &message{body: body, attributes: attrs})
+				body = nil
+			}
+			body = append(body, b...)
+		}
+		if len(body) > 0 {
+			messages = append(messages, &message{body: body, attributes: attrs})
+		}
+	}
+	return messages, nil
+}
+
+// attributesSize returns the size the attributes of a message count for in
+// the size of the message.
+func attributesSize(attrs map[string]string) int {
+	size := 0
+	for k, v := range attrs {
+		size += len(k) + len("String") + len(v)
+	}
+	return size
+}
+
+// size returns the size of the message, the attributes included.
+func (m *message) size() int {
+	return len(m.body) + attributesSize(m.attributes)
+}
+
+// sendMessages sends the messages to the SQS queue, in batches of up to 10
+// messages and 256 KiB.
+func (s *SQSSNS) sendMessages(messages []*message) error {
+	var entries []*sqs.SendMessageBatchRequestEntry
+	size := 0
+	for _, m := range messages {
+		if len(entries) == maxBatchMessages || size+m.size() > maxMessageSize {
+			if err := s.sendBatch(entries); err != nil {
+				return err
+			}
+			entries, size = nil, 0
+		}
+
+		entry := &sqs.SendMessageBatchRequestEntry{
+			Id:          aws.String(strconv.Itoa(len(entries))),
+			MessageBody: aws.String(string(m.body)),
+		}
+		if len(m.attributes) > 0 {
+			entry.MessageAttributes = make(map[string]*sqs.MessageAttributeValue, len(m.attributes))
+			for k, v := range m.attributes {
+				entry.MessageAttributes[k] = &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String(v),
+				}
+			}
+		}
+		if s.MessageGroupID != "" {
+			entry.MessageGroupId = aws.String(s.MessageGroupID)
+		}
+		entries = append(entries, entry)
+		size += m.size()
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.sendBatch(entries)
+}
+
+func (s *SQSSNS) sendBatch(entries []*sqs.SendMessageBatchRequestEntry) error {
+	resp, err := s.sqs.SendMessageBatch(&sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(s.QueueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		return fmt.Errorf("sqs_sns: unable to send to %s: %s", s.QueueURL, err)
+	}
+	if len(resp.Failed) > 0 {
+		// the whole write is retried, the messages already sent are sent
+		// again
+		failed := resp.Failed[0]
+		return fmt.Errorf("sqs_sns: unable to send %d of %d messages to %s: %s: %s",
+			len(resp.Failed), len(entries), s.QueueURL,
+			aws.StringValue(failed.Code), aws.StringValue(failed.Message))
+	}
+	return nil
+}
+
+// publishMessages publishes the messages to the SNS topic one by one.
+func (s *SQSSNS) publishMessages(messages []*message) error {
+	for _, m := range messages {
+		input := &sns.PublishInput{
+			TopicArn: aws.String(s.TopicARN),
+			Message:  aws.String(string(m.body)),
+		}
+		if len(m.attributes) > 0 {
+			input.MessageAttributes = make(map[string]*sns.MessageAttributeValue, len(m.attributes))
+			for k, v := range m.attributes {
+				input.MessageAttributes[k] = &sns.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String(v),
+				}
+			}
+		}
+		if _, err := s.sns.Publish(input); err != nil {
+			return fmt.Errorf("sqs_sns: unable to publish to %s: %s", s.TopicARN, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	outputs.Add("sqs_sns", func() telegraf.Output {
+		return &SQSSNS{
+			MaxMessageSize: maxMessageSize,
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package sqs_sns
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/serializers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockSQSClient struct {
+	batches [][]*sqs.SendMessageBatchRequestEntry
+	failed  []*sqs.BatchResultErrorEntry
+}
+
+func (m *mockSQSClient) SendMessageBatch(params *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error) {
+	m.batches = append(m.batches, params.Entries)
+	return &sqs.SendMessageBatchOutput{Failed: m.failed}, nil
+}
+
+type mockSNSClient struct {
+	published []*sns.PublishInput
+	err       error
+}
+
+func (m *mockSNSClient) Publish(params *sns.PublishInput) (*sns.PublishOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.published = append(m.published, params)
+	return &sns.PublishOutput{}, nil
+}
+
+func newMetric(t *testing.T, host string, value int64) telegraf.Metric {
+	tags := map[string]string{}
+	if host != "" {
+		tags["host"] = host
+	}
+	m, err := metric.New("cpu", tags,
+		map[string]interface{}{"value": value}, time.Unix(0, 0))
+	require.NoError(t, err)
+	return m
+}
+
+func newSQSSNS(t *testing.T) *SQSSNS {
+	serializer, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+	s := &SQSSNS{
+		AttributeTags:  []string{"host"},
+		MaxMessageSize: maxMessageSize,
+	}
+	s.SetSerializer(serializer)
+	return s
+}
+
+func TestWriteSQS(t *testing.T) {
+	client := &mockSQSClient{}
+	s := newSQSSNS(t)
+	s.QueueURL = "https://sqs.us-east-1.amazonaws.com/123456789012/metrics"
+	s.MessageGroupID = "telegraf"
+	s.sqs = client
+
+	require.NoError(t, s.Write([]telegraf.Metric{
+		newMetric(t, "a", 1),
+		newMetric(t, "b", 2),
+		newMetric(t, "a", 3),
+		newMetric(t, "", 4),
+	}))
+
+	require.Len(t, client.batches, 1)
+	entries := client.batches[0]
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, "0", *entries[0].Id)
+	assert.Equal(t, "cpu,host=a value=1i 0\ncpu,host=a value=3i 0\n",
+		*entries[0].MessageBody)
+	assert.Equal(t, "a", *entries[0].MessageAttributes["host"].StringValue)
+	assert.Equal(t, "String", *entries[0].MessageAttributes["host"].DataType)
+	assert.Equal(t, "telegraf", *entries[0].MessageGroupId)
+
+	assert.Equal(t, "cpu,host=b value=2i 0\n", *entries[1].MessageBody)
+	assert.Equal(t, "b", *entries[1].MessageAttributes["host"].StringValue)
+
+	// no attribute for the metrics without the tag
+	assert.Equal(t, "cpu value=4i 0\n", *entries[2].MessageBody)
+	assert.Empty(t, entries[2].MessageAttributes)
+}
+
+func TestWriteSQSBatches(t *testing.T) {
+	client := &mockSQSClient{}
+	s := newSQSSNS(t)
+	s.QueueURL = "https://sqs.us-east-1.amazonaws.com/123456789012/metrics"
+	s.sqs = client
+
+	var metrics []telegraf.Metric
+	for i := 0; i < 25; i++ {
+		metrics = append(metrics, newMetric(t, fmt.Sprintf("host%02d", i), int64(i)))
+	}
+	require.NoError(t, s.Write(metrics))
+
+	require.Len(t, client.batches, 3)
+	assert.Len(t, client.batches[0], 10)
+	assert.Len(t, client.batches[1], 10)
+	assert.Len(t, client.batches[2], 5)
+	assert.Equal(t, "host20", *client.batches[2][0].MessageAttributes["host"].StringValue)
+}
+
+func TestWriteSQSFailed(t *testing.T) {
+	client := &mockSQSClient{
+		failed: []*sqs.BatchResultErrorEntry{{
+			Id:      aws.String("0"),
+			Code:    aws.String("InternalError"),
+			Message: aws.String("try again"),
+		}},
+	}
+	s := newSQSSNS(t)
+	s.QueueURL = "https://sqs.us-east-1.amazonaws.com/123456789012/metrics"
+	s.sqs = client
+
+	err := s.Write([]telegraf.Metric{newMetric(t, "a", 1)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "InternalError")
+}
+
+func TestWriteSNS(t *testing.T) {
+	client := &mockSNSClient{}
+	s := newSQSSNS(t)
+	s.TopicARN = "arn:aws:sns:us-east-1:123456789012:metrics"
+	s.sns = client
+
+	require.NoError(t, s.Write([]telegraf.Metric{
+		newMetric(t, "a", 1),
+		newMetric(t, "b", 2),
+	}))
+	require.Len(t, client.published, 2)
+	assert.Equal(t, s.TopicARN, *client.published[0].TopicArn)
+	assert.Equal(t, "cpu,host=a value=1i 0\n", *client.published[0].Message)
+	assert.Equal(t, "a", *client.published[0].MessageAttributes["host"].StringValue)
+
+	client.err = fmt.Errorf("throttled")
+	assert.Error(t, s.Write([]telegraf.Metric{newMetric(t, "a", 1)}))
+}
+
+func TestMessagesSize(t *testing.T) {
+	s := newSQSSNS(t)
+	line := "cpu,host=a value=1i 0\n"
+	// room for three metrics, the attribute included
+	s.MaxMessageSize = 3*len(line) + len("host") + len("String") + len("a")
+
+	var metrics []telegraf.Metric
+	for i := 0; i < 7; i++ {
+		metrics = append(metrics, newMetric(t, "a", 1))
+	}
+	messages, err := s.messages(metrics)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.Equal(t, strings.Repeat(line, 3), string(messages[0].body))
+	assert.Equal(t, strings.Repeat(line, 3), string(messages[1].body))
+	assert.Equal(t, line, string(messages[2].body))
+	assert.Equal(t, s.MaxMessageSize, messages[0].size())
+
+	// the metrics larger than a message are dropped
+	s.MaxMessageSize = len(line)
+	messages, err = s.messages(metrics[:1])
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+}
+
+func TestConnect(t *testing.T) {
+	s := &SQSSNS{}
+	assert.Error(t, s.Connect())
+
+	s = &SQSSNS{
+		QueueURL: "https://sqs.us-east-1.amazonaws.com/123456789012/metrics",
+		TopicARN: "arn:aws:sns:us-east-1:123456789012:metrics",
+	}
+	assert.Error(t, s.Connect())
+
+	s = &SQSSNS{
+		TopicARN:       "arn:aws:sns:us-east-1:123456789012:metrics",
+		MessageGroupID: "telegraf",
+	}
+	assert.Error(t, s.Connect())
+
+	s = &SQSSNS{
+		TopicARN: "arn:aws:sns:us-east-1:123456789012:metrics",
+	}
+	require.NoError(t, s.Connect())
+	assert.NotNil(t, s.sns)
+	assert.Nil(t, s.sqs)
+	assert.Equal(t, maxMessageSize, s.MaxMessageSize)
+}
@@ -0,0 +1,326 @@
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/outputs"
+)
+
+// defaultFieldName is the field of the statsd input holding the value of a
+// bucket without field template, it is not appended to the bucket name.
+const defaultFieldName = "value"
+
+// Statsd forwards metrics to a statsd server.
+type Statsd struct {
+	Address        string
+	Prefix         string
+	Separator      string
+	TagFormat      string
+	MaxPacketSize  int
+	Timeout        internal.Duration
+	RawTimingsName string `toml:"raw_timings_measurement"`
+
+	conn net.Conn
+	// udp is true when every write of conn is a datagram
+	udp bool
+}
+
+var sampleConfig = `
+  ## Address of the statsd server, "udp://host:port" or "tcp://host:port".
+  address = "udp://localhost:8125"
+
+  ## The bucket of a field is <prefix><separator><measurement><separator><field>,
+  ## the "value" field of the statsd input is not appended.
+  # prefix = ""
+  # separator = "."
+
+  ## Format of the tags:
+  ##   ""        tags are not sent
+  ##   "influx"  in the bucket name, ie "cpu,host=a:1|g", as read by the
+  ##             statsd input of telegraf
+  ##   "datadog" in a DogStatsD tag section, ie "cpu:1|g|#host:a"
+  # tag_format = ""
+
+  ## Maximum size of a UDP packet, several lines are sent in a packet up to
+  ## this size.
+  # max_packet_size = 1432
+
+  ## Timeout of the connection and writes.
+  # timeout = "5s"
+
+  ## Measurement of the raw timings of the statsd input, its observations
+  ## are forwarded as timings of the bucket of their "bucket" tag.
+  # raw_timings_measurement = "statsd_timing_raw"
+`
+
+func (s *Statsd) SampleConfig() string {
+	return sampleConfig
+}
+
+func (s *Statsd) Description() string {
+	return "Forward metrics to a statsd server"
+}
+
+func (s *Statsd) Connect() error {
+	switch s.TagFormat {
+	case "", "influx", "datadog":
+	default:
+		return fmt.Errorf("invalid tag_format %q, must be \"\", influx or datadog",
+			s.TagFormat)
+	}
+
+	spl := strings.SplitN(s.Address, "://", 2)
+	if len(spl) != 2 {
+		return fmt.Errorf("invalid address: %s", s.Address)
+	}
+	switch spl[0] {
+	case "udp", "udp4", "udp6":
+		s.udp = true
+	case "tcp", "tcp4", "tcp6":
+		s.udp = false
+	default:
+		return fmt.Errorf("invalid address %s: unsupported protocol %s",
+			s.Address, spl[0])
+	}
+
+	c, err := net.DialTimeout(spl[0], spl[1], s.Timeout.Duration)
+	if err != nil {
+		return err
+	}
+	s.conn = c
+	return nil
+}
+
+func (s *Statsd) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *Statsd) Write(metrics []telegraf.Metric) error {
+	if s.conn == nil {
+		// previous write failed and the connection was closed
+		if err := s.Connect(); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	var line []byte
+	for _, m := range metrics {
+		for _, l := range s.lines(m) {
+			line = append(line[:0], l...)
+			line = append(line, '\n')
+			if s.udp && buf.Len() > 0 && buf.Len()+len(line) > s.MaxPacketSize {
+				if err := s.send(buf.Bytes()); err != nil {
+					return err
+				}
+				buf.Reset()
+			}
+			buf.Write(line)
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return s.send(buf.Bytes())
+}
+
+func (s *Statsd) send(b []byte) error {
+	if s.Timeout.Duration > 0 {
+		s.conn.SetWriteDeadline(time.Now().Add(s.Timeout.Duration))
+	}
+	if _, err := s.conn.Write(b); err != nil {
+		if err, ok := err.(net.Error); !ok || !err.Temporary() {
+			s.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// lines returns the statsd lines of a metric, without trailing newline.
+func (s *Statsd) lines(m telegraf.Metric) []string {
+	tags := m.Tags()
+	mtype := "g"
+	if tags["metric_type"] == "counter" {
+		mtype = "c"
+	}
+
+	if m.Name() == s.RawTimingsName && tags["bucket"] != "" {
+		return s.rawTimingLines(m)
+	}
+
+	var lines []string
+	fields := m.Fields()
+	for _, k := range sortedKeys(fields) {
+		value, ok := formatValue(fields[k])
+		if !ok {
+			continue
+		}
+		name := m.Name()
+		if k != defaultFieldName {
+			name += s.Separator + k
+		}
+		if mtype == "g" && value[0] == '-' {
+			// a signed gauge value is a change of the gauge, reset it first
+			lines = append(lines, s.line(name, "0", "g", "", tags))
+		}
+		lines = append(lines, s.line(name, value, mtype, "", tags))
+	}
+	return lines
+}
+
+// rawTimingLines returns the lines of a raw timing observation of the statsd
+// input, with its sample rate.
+func (s *Statsd) rawTimingLines(m telegraf.Metric) []string {
+	tags := m.Tags()
+	var rate string
+	if r, ok := m.Fields()["sample_rate"].(float64); ok && r > 0 && r < 1 {
+		rate = strconv.FormatFloat(r, 'f', -1, 64)
+	}
+
+	var lines []string
+	fields := m.Fields()
+	for _, k := range sortedKeys(fields) {
+		if k == "sample_rate" {
+			continue
+		}
+		value, ok := formatValue(fields[k])
+		if !ok {
+			continue
+		}
+		name := tags["bucket"]
+		if k != defaultFieldName {
+			name += s.Separator + k
+		}
+		lines = append(lines, s.line(name, value, "ms", rate, tags))
+	}
+	return lines
+}
+
+// line formats a statsd line, the metric_type and bucket tags of the statsd
+// input are not sent.
+func (s *Statsd) line(name, value, mtype, rate string, tags map[string]string) string {
+	var b bytes.Buffer
+	if s.Prefix != "" {
+		b.WriteString(sanitize(s.Prefix))
+		b.WriteString(s.Separator)
+	}
+	b.WriteString(sanitize(name))
+
+	keys := make([]string, 0, len(tags))
+	if s.TagFormat != "" {
+		for k := range tags {
+			if k != "metric_type" && k != "bucket" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+	}
+	if s.TagFormat == "influx" {
+		for _, k := range keys {
+			b.WriteByte(',')
+			b.WriteString(sanitizeTag(k))
+			b.WriteByte('=')
+			b.WriteString(sanitizeTag(tags[k]))
+		}
+	}
+
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(mtype)
+	if rate != "" {
+		b.WriteString("|@")
+		b.WriteString(rate)
+	}
+
+	if s.TagFormat == "datadog" && len(keys) > 0 {
+		b.WriteString("|#")
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(sanitizeTag(k))
+			b.WriteByte(':')
+			b.WriteString(sanitizeTag(tags[k]))
+		}
+	}
+	return b.String()
+}
+
+func sortedKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatValue returns the statsd value of a field, strings, NaN and
+// infinities can not be sent.
+func formatValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case bool:
+		if v {
+			return "1", true
+		}
+		return "0", true
+	}
+	return "", false
+}
+
+var nameReplacer = strings.NewReplacer(
+	":", "_", "|", "_", "@", "_", ",", "_", "#", "_",
+	" ", "_", "\n", "_", "\r", "_", "\t", "_",
+)
+
+var tagReplacer = strings.NewReplacer(
+	":", "_", "|", "_", "@", "_", ",", "_", "=", "_", "#", "_",
+	" ", "_", "\n", "_", "\r", "_", "\t", "_",
+)
+
+// sanitize replaces the characters of a bucket name that have a meaning in
+// the statsd protocol.
+func sanitize(s string) string {
+	return nameReplacer.Replace(s)
+}
+
+func sanitizeTag(s string) string {
+	return tagReplacer.Replace(s)
+}
+
+func init() {
+	outputs.Add("statsd", func() telegraf.Output {
+		return &Statsd{
+			Address:        "udp://localhost:8125",
+			Separator:      ".",
+			MaxPacketSize:  1432,
+			Timeout:        internal.Duration{Duration: 5 * time.Second},
+			RawTimingsName: "statsd_timing_raw",
+		}
+	})
+}
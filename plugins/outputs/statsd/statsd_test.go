@@ -0,0 +1,152 @@
+package statsd
+
+import (
+	"bufio"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStatsd() *Statsd {
+	return &Statsd{
+		Separator:      ".",
+		MaxPacketSize:  1432,
+		Timeout:        internal.Duration{Duration: time.Second},
+		RawTimingsName: "statsd_timing_raw",
+	}
+}
+
+func mustMetric(
+	t *testing.T,
+	name string,
+	tags map[string]string,
+	fields map[string]interface{},
+) telegraf.Metric {
+	m, err := metric.New(name, tags, fields, time.Unix(1500000000, 0))
+	require.NoError(t, err)
+	return m
+}
+
+func TestLines(t *testing.T) {
+	s := newStatsd()
+	s.Prefix = "relay"
+
+	assert.Equal(t, []string{"relay.requests:3|c"}, s.lines(mustMetric(t, "requests",
+		map[string]string{"metric_type": "counter", "host": "a"},
+		map[string]interface{}{"value": int64(3)})))
+
+	assert.Equal(t, []string{
+		"relay.cpu.idle:98.5|g",
+		"relay.cpu.up:1|g",
+	}, s.lines(mustMetric(t, "cpu",
+		map[string]string{"host": "a"},
+		map[string]interface{}{
+			"idle":  98.5,
+			"up":    true,
+			"state": "ok",
+			"nan":   math.NaN(),
+		})))
+
+	// a negative gauge is reset first so that it is not read as a decrement
+	assert.Equal(t, []string{"relay.temp:0|g", "relay.temp:-4|g"},
+		s.lines(mustMetric(t, "temp", nil,
+			map[string]interface{}{"value": int64(-4)})))
+
+	// raw timings are forwarded to their bucket
+	assert.Equal(t, []string{"relay.api.latency:12.5|ms|@0.1"},
+		s.lines(mustMetric(t, "statsd_timing_raw",
+			map[string]string{"bucket": "api.latency", "metric_type": "timing"},
+			map[string]interface{}{"value": 12.5, "sample_rate": 0.1})))
+}
+
+func TestLinesTags(t *testing.T) {
+	m := mustMetric(t, "cpu",
+		map[string]string{"metric_type": "gauge", "host": "a", "dc": "eu west"},
+		map[string]interface{}{"value": 1.5})
+
+	s := newStatsd()
+	assert.Equal(t, []string{"cpu:1.5|g"}, s.lines(m))
+
+	s.TagFormat = "influx"
+	assert.Equal(t, []string{"cpu,dc=eu_west,host=a:1.5|g"}, s.lines(m))
+
+	s.TagFormat = "datadog"
+	assert.Equal(t, []string{"cpu:1.5|g|#dc:eu_west,host:a"}, s.lines(m))
+}
+
+func TestWriteUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	s := newStatsd()
+	s.Address = "udp://" + conn.LocalAddr().String()
+	s.MaxPacketSize = 15
+	require.NoError(t, s.Connect())
+	defer s.Close()
+
+	require.NoError(t, s.Write([]telegraf.Metric{
+		mustMetric(t, "a", nil, map[string]interface{}{"value": int64(1)}),
+		mustMetric(t, "b", nil, map[string]interface{}{"value": int64(2)}),
+		mustMetric(t, "c", nil, map[string]interface{}{"value": int64(3)}),
+	}))
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "a:1|g\nb:2|g\n", string(buf[:n]))
+	n, _, err = conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "c:3|g\n", string(buf[:n]))
+}
+
+func TestWriteTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	s := newStatsd()
+	s.Address = "tcp://" + ln.Addr().String()
+	require.NoError(t, s.Connect())
+	defer s.Close()
+
+	conn, err := ln.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, s.Write([]telegraf.Metric{
+		mustMetric(t, "a", nil, map[string]interface{}{"value": int64(1)}),
+		mustMetric(t, "b", nil, map[string]interface{}{"value": int64(2)}),
+	}))
+
+	r := bufio.NewReader(conn)
+	var lines []string
+	for i := 0; i < 2; i++ {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	assert.Equal(t, []string{"a:1|g", "b:2|g"}, lines)
+}
+
+func TestConnectInvalid(t *testing.T) {
+	s := newStatsd()
+	s.Address = "localhost:8125"
+	assert.Error(t, s.Connect())
+
+	s.Address = "unix:///tmp/statsd.sock"
+	assert.Error(t, s.Connect())
+
+	s.Address = "udp://localhost:8125"
+	s.TagFormat = "graphite"
+	assert.Error(t, s.Connect())
+}
@@ -0,0 +1,396 @@
+package whisper
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The whisper files start with a header of metadata and of the infos of
+// their archives, followed by the archives. Each archive is a ring of points
+// of the same precision, addressed from the interval of its first point.
+// Everything is big endian.
+const (
+	metadataSize    = 16
+	archiveInfoSize = 12
+	pointSize       = 12
+)
+
+var aggregationMethods = map[string]uint32{
+	"average": 1,
+	"sum":     2,
+	"last":    3,
+	"max":     4,
+	"min":     5,
+}
+
+// errNotCovered is returned for the points older than the retention of a
+// file or in the future.
+var errNotCovered = errors.New("timestamp not covered by the archives")
+
+type archive struct {
+	offset          uint32
+	secondsPerPoint uint32
+	points          uint32
+}
+
+func (a archive) retention() uint32 {
+	return a.secondsPerPoint * a.points
+}
+
+type point struct {
+	interval uint32
+	value    float64
+}
+
+// schema is the archives and the aggregation of the files created.
+type schema struct {
+	archives     []archive
+	aggregation  uint32
+	xFilesFactor float32
+}
+
+// parseRetentions parses the archives of retentions such as "10s:1d,1m:30d",
+// as in the storage-schemas.conf of carbon: the precision and duration of
+// each archive, with the units s, m, h, d, w and y, a duration without unit
+// being a number of points.
+func parseRetentions(retentions string) ([]archive, error) {
+	var archives []archive
+	for _, r := range strings.Split(retentions, ",") {
+		parts := strings.Split(strings.TrimSpace(r), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid retention %q, must be precision:duration", r)
+		}
+		precision, err := parseSeconds(parts[0])
+		if err != nil || precision == 0 {
+			return nil, fmt.Errorf("invalid precision in retention %q", r)
+		}
+		var points uint64
+		if n, err := strconv.ParseUint(parts[1], 10, 32); err == nil {
+			points = n
+		} else {
+			duration, err := parseSeconds(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration in retention %q", r)
+			}
+			points = duration / precision
+		}
+		if points == 0 || precision*points > math.MaxUint32 {
+			return nil, fmt.Errorf("invalid duration in retention %q", r)
+		}
+		archives = append(archives, archive{
+			secondsPerPoint: uint32(precision),
+			points:          uint32(points),
+		})
+	}
+
+	for i := 1; i < len(archives); i++ {
+		higher, lower := archives[i-1], archives[i]
+		switch {
+		case lower.secondsPerPoint <= higher.secondsPerPoint:
+			return nil, fmt.Errorf("invalid retentions %q, the precisions must "+
+				"be decreasing", retentions)
+		case lower.secondsPerPoint%higher.secondsPerPoint != 0:
+			return nil, fmt.Errorf("invalid retentions %q, each precision must "+
+				"be a multiple of the previous one", retentions)
+		case lower.retention() <= higher.retention():
+			return nil, fmt.Errorf("invalid retentions %q, the durations must "+
+				"be increasing", retentions)
+		case higher.points < lower.secondsPerPoint/higher.secondsPerPoint:
+			return nil, fmt.Errorf("invalid retentions %q, each archive must "+
+				"cover a point of the next one", retentions)
+		}
+	}
+	return archives, nil
+}
+
+var units = map[string]uint64{
+	"s": 1,
+	"m": 60,
+	"h": 60 * 60,
+	"d": 24 * 60 * 60,
+	"w": 7 * 24 * 60 * 60,
+	"y": 365 * 24 * 60 * 60,
+}
+
+func parseSeconds(s string) (uint64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		return strconv.ParseUint(s, 10, 32)
+	}
+	unit, ok := units[s[i:]]
+	if !ok {
+		return 0, fmt.Errorf("invalid unit %q", s[i:])
+	}
+	n, err := strconv.ParseUint(s[:i], 10, 32)
+	return n * unit, err
+}
+
+// invalidFileError is returned by open for the files which are not whisper
+// files.
+type invalidFileError struct {
+	path string
+	err  error
+}
+
+func (e *invalidFileError) Error() string {
+	return fmt.Sprintf("invalid whisper file %s: %s", e.path, e.err)
+}
+
+// file is an open whisper file.
+type file struct {
+	f            *os.File
+	aggregation  uint32
+	maxRetention uint32
+	xFilesFactor float32
+	archives     []archive
+}
+
+// create creates the whisper file path with the schema s, and the
+// directories of path as needed.
+func create(path string, s *schema) (*file, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &file{
+		f:            f,
+		aggregation:  s.aggregation,
+		xFilesFactor: s.xFilesFactor,
+	}
+	offset := uint32(metadataSize + archiveInfoSize*len(s.archives))
+	header := make([]byte, offset)
+	binary.BigEndian.PutUint32(header[0:], s.aggregation)
+	binary.BigEndian.PutUint32(header[8:], math.Float32bits(s.xFilesFactor))
+	binary.BigEndian.PutUint32(header[12:], uint32(len(s.archives)))
+	for i, a := range s.archives {
+		a.offset = offset
+		b := header[metadataSize+archiveInfoSize*i:]
+		binary.BigEndian.PutUint32(b[0:], a.offset)
+		binary.BigEndian.PutUint32(b[4:], a.secondsPerPoint)
+		binary.BigEndian.PutUint32(b[8:], a.points)
+		offset += a.points * pointSize
+		if a.retention() > w.maxRetention {
+			w.maxRetention = a.retention()
+		}
+		w.archives = append(w.archives, a)
+	}
+	binary.BigEndian.PutUint32(header[4:], w.maxRetention)
+
+	// the archives are left sparse, their points being zero until written
+	if _, err = f.Write(header); err == nil {
+		err = f.Truncate(int64(offset))
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return w, nil
+}
+
+// open opens the whisper file path.
+func open(path string) (*file, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	w, err := readHeader(f)
+	if err != nil {
+		f.Close()
+		return nil, &invalidFileError{path: path, err: err}
+	}
+	return w, nil
+}
+
+func readHeader(f *os.File) (*file, error) {
+	metadata := make([]byte, metadataSize)
+	if _, err := io.ReadFull(f, metadata); err != nil {
+		return nil, err
+	}
+	w := &file{
+		f:            f,
+		aggregation:  binary.BigEndian.Uint32(metadata[0:]),
+		maxRetention: binary.BigEndian.Uint32(metadata[4:]),
+		xFilesFactor: math.Float32frombits(binary.BigEndian.Uint32(metadata[8:])),
+	}
+	count := binary.BigEndian.Uint32(metadata[12:])
+	if count == 0 || count > 64 {
+		return nil, fmt.Errorf("invalid number of archives %d", count)
+	}
+
+	infos := make([]byte, archiveInfoSize*count)
+	if _, err := io.ReadFull(f, infos); err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < count; i++ {
+		b := infos[archiveInfoSize*i:]
+		a := archive{
+			offset:          binary.BigEndian.Uint32(b[0:]),
+			secondsPerPoint: binary.BigEndian.Uint32(b[4:]),
+			points:          binary.BigEndian.Uint32(b[8:]),
+		}
+		if a.secondsPerPoint == 0 || a.points == 0 {
+			return nil, fmt.Errorf("invalid archive %d", i)
+		}
+		w.archives = append(w.archives, a)
+	}
+	return w, nil
+}
+
+func (w *file) Close() error {
+	return w.f.Close()
+}
+
+// update writes the point p to the most precise archive covering it at the
+// time now, and propagates it to the less precise archives.
+func (w *file) update(p point, now uint32) error {
+	if p.interval > now || now-p.interval >= w.maxRetention {
+		return errNotCovered
+	}
+	age := now - p.interval
+
+	i := 0
+	for i < len(w.archives) && w.archives[i].retention() <= age {
+		i++
+	}
+	if i == len(w.archives) {
+		return errNotCovered
+	}
+
+	a := w.archives[i]
+	interval := p.interval - p.interval%a.secondsPerPoint
+	if err := w.write(a, interval, p.value); err != nil {
+		return err
+	}
+	for _, lower := range w.archives[i+1:] {
+		ok, err := w.propagate(interval, a, lower)
+		if err != nil || !ok {
+			return err
+		}
+		a = lower
+	}
+	return nil
+}
+
+// pointOffset returns the offset of the point of the interval in the archive a
+// whose first point is of the interval base.
+func (a archive) pointOffset(base, interval uint32) int64 {
+	distance := (int64(interval) - int64(base)) / int64(a.secondsPerPoint)
+	i := distance % int64(a.points)
+	if i < 0 {
+		i += int64(a.points)
+	}
+	return int64(a.offset) + i*pointSize
+}
+
+func (w *file) readPoints(offset int64, n uint32) ([]point, error) {
+	b := make([]byte, pointSize*n)
+	if _, err := w.f.ReadAt(b, offset); err != nil {
+		return nil, err
+	}
+	points := make([]point, n)
+	for i := range points {
+		points[i].interval = binary.BigEndian.Uint32(b[pointSize*i:])
+		points[i].value = math.Float64frombits(binary.BigEndian.Uint64(b[pointSize*i+4:]))
+	}
+	return points, nil
+}
+
+func (w *file) write(a archive, interval uint32, value float64) error {
+	base, err := w.readPoints(int64(a.offset), 1)
+	if err != nil {
+		return err
+	}
+	offset := int64(a.offset)
+	if base[0].interval != 0 {
+		offset = a.pointOffset(base[0].interval, interval)
+	}
+
+	b := make([]byte, pointSize)
+	binary.BigEndian.PutUint32(b, interval)
+	binary.BigEndian.PutUint64(b[4:], math.Float64bits(value))
+	_, err = w.f.WriteAt(b, offset)
+	return err
+}
+
+// propagate aggregates the points of the archive higher in the point of the
+// archive lower holding the interval, if enough of them are known.
+func (w *file) propagate(interval uint32, higher, lower archive) (bool, error) {
+	start := interval - interval%lower.secondsPerPoint
+	n := lower.secondsPerPoint / higher.secondsPerPoint
+
+	base, err := w.readPoints(int64(higher.offset), 1)
+	if err != nil {
+		return false, err
+	}
+	// the points may wrap around the end of the archive
+	offset := higher.pointOffset(base[0].interval, start)
+	first := (int64(higher.offset) + int64(higher.points)*pointSize - offset) / pointSize
+	if first > int64(n) {
+		first = int64(n)
+	}
+	points, err := w.readPoints(offset, uint32(first))
+	if err != nil {
+		return false, err
+	}
+	if rest := n - uint32(first); rest > 0 {
+		wrapped, err := w.readPoints(int64(higher.offset), rest)
+		if err != nil {
+			return false, err
+		}
+		points = append(points, wrapped...)
+	}
+
+	var values []float64
+	for i, p := range points {
+		if p.interval == start+uint32(i)*higher.secondsPerPoint {
+			values = append(values, p.value)
+		}
+	}
+	if len(values) == 0 || float32(len(values))/float32(n) < w.xFilesFactor {
+		return false, nil
+	}
+	return true, w.write(lower, start, aggregate(w.aggregation, values))
+}
+
+func aggregate(method uint32, values []float64) float64 {
+	switch method {
+	case aggregationMethods["sum"]:
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	case aggregationMethods["last"]:
+		return values[len(values)-1]
+	case aggregationMethods["max"]:
+		max := values[0]
+		for _, v := range values[1:] {
+			max = math.Max(max, v)
+		}
+		return max
+	case aggregationMethods["min"]:
+		min := values[0]
+		for _, v := range values[1:] {
+			min = math.Min(min, v)
+		}
+		return min
+	default:
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	}
+}
@@ -0,0 +1,249 @@
+package whisper
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"github.com/influxdata/telegraf/plugins/serializers/graphite"
+)
+
+// Whisper writes the metrics to local whisper files, one per field, so that
+// sites without connectivity keep their history.
+type Whisper struct {
+	Path         string
+	Prefix       string
+	Template     string
+	Retentions   string
+	Aggregation  string
+	XFilesFactor float64 `toml:"x_files_factor"`
+	Retention    []*Retention
+
+	schema *schema
+}
+
+// Retention is the schema of the files of some measurements.
+type Retention struct {
+	Measurements []string
+	Retentions   string
+	Aggregation  string
+	XFilesFactor *float64 `toml:"x_files_factor"`
+
+	filter filter.Filter
+	schema *schema
+}
+
+var sampleConfig = `
+  ## Directory of the whisper files, one file per field named after the
+  ## graphite template, ie <path>/web01/cpu0/cpu/usage_user.wsp.
+  path = "/var/lib/telegraf/whisper"
+  # prefix = ""
+  template = "host.tags.measurement.field"
+
+  ## Archives of the files created, as "precision:duration" from the most
+  ## precise, as in the storage-schemas.conf of carbon. The durations without
+  ## unit are a number of points.
+  retentions = "10s:1d,1m:30d,1h:1y"
+
+  ## Aggregation of the points of an archive into the next one: average, sum,
+  ## last, max or min, and the fraction of the points which must be known.
+  aggregation = "average"
+  x_files_factor = 0.5
+
+  ## Archives and aggregation of the files of some measurements, glob
+  ## patterns are supported, the first matching one is used. The files
+  ## already created are not changed.
+  # [[outputs.whisper.retention]]
+  #   measurements = ["statsd_*"]
+  #   retentions = "10s:7d,1m:90d"
+  #   aggregation = "sum"
+  #   x_files_factor = 0.0
+`
+
+func (w *Whisper) SampleConfig() string {
+	return sampleConfig
+}
+
+func (w *Whisper) Description() string {
+	return "Write metrics to local whisper files"
+}
+
+func (w *Whisper) Connect() error {
+	var err error
+	w.schema, err = newSchema(w.Retentions, w.Aggregation, w.XFilesFactor)
+	if err != nil {
+		return err
+	}
+	for _, r := range w.Retention {
+		aggregation := r.Aggregation
+		if aggregation == "" {
+			aggregation = w.Aggregation
+		}
+		xFilesFactor := w.XFilesFactor
+		if r.XFilesFactor != nil {
+			xFilesFactor = *r.XFilesFactor
+		}
+		r.schema, err = newSchema(r.Retentions, aggregation, xFilesFactor)
+		if err != nil {
+			return fmt.Errorf("retention %v: %s", r.Measurements, err)
+		}
+		r.filter, err = filter.Compile(r.Measurements)
+		if err != nil {
+			return fmt.Errorf("retention %v: %s", r.Measurements, err)
+		}
+	}
+	return os.MkdirAll(w.Path, 0755)
+}
+
+func newSchema(retentions, aggregation string, xFilesFactor float64) (*schema, error) {
+	archives, err := parseRetentions(retentions)
+	if err != nil {
+		return nil, err
+	}
+	method, ok := aggregationMethods[aggregation]
+	if !ok {
+		return nil, fmt.Errorf("invalid aggregation %q", aggregation)
+	}
+	if xFilesFactor < 0 || xFilesFactor > 1 {
+		return nil, fmt.Errorf("invalid x_files_factor %v, must be between 0 and 1",
+			xFilesFactor)
+	}
+	return &schema{
+		archives:     archives,
+		aggregation:  method,
+		xFilesFactor: float32(xFilesFactor),
+	}, nil
+}
+
+func (w *Whisper) Close() error {
+	return nil
+}
+
+// Write writes the values of the fields to their files, the files created
+// have the schema of the first retention matching their measurement.
+func (w *Whisper) Write(metrics []telegraf.Metric) error {
+	points := make(map[string][]point)
+	schemas := make(map[string]*schema)
+	for _, m := range metrics {
+		bucket := graphite.SerializeBucketName(m.Name(), m.Tags(), w.Template, w.Prefix)
+		if bucket == "" {
+			continue
+		}
+		for k, v := range m.Fields() {
+			value, ok := toFloat(v)
+			if !ok {
+				continue
+			}
+			path := w.path(graphite.InsertField(bucket, k))
+			points[path] = append(points[path], point{
+				interval: uint32(m.Time().Unix()),
+				value:    value,
+			})
+			schemas[path] = w.schemaOf(m.Name())
+		}
+	}
+
+	now := uint32(time.Now().Unix())
+	for path, p := range points {
+		if err := update(path, schemas[path], p, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Whisper) schemaOf(measurement string) *schema {
+	for _, r := range w.Retention {
+		if r.filter != nil && r.filter.Match(measurement) {
+			return r.schema
+		}
+	}
+	return w.schema
+}
+
+var sanitizedChars = strings.NewReplacer("/", "-", `\`, "-", " ", "_", "\x00", "")
+
+// path returns the path of the file of the graphite name.
+func (w *Whisper) path(name string) string {
+	parts := []string{w.Path}
+	for _, part := range strings.Split(sanitizedChars.Replace(name), ".") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return filepath.Join(parts...) + ".wsp"
+}
+
+// update writes the points to the file path, which is created with the
+// schema s if needed. The points out of the archives of the file are
+// skipped, as are the files which are not valid whisper files.
+func update(path string, s *schema, points []point, now uint32) error {
+	w, err := open(path)
+	if os.IsNotExist(err) {
+		w, err = create(path, s)
+	}
+	if _, ok := err.(*invalidFileError); ok {
+		log.Printf("E! [outputs.whisper] Skipping points: %s", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].interval < points[j].interval
+	})
+	var skipped int
+	for _, p := range points {
+		err := w.update(p, now)
+		if err == errNotCovered {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to write %s: %s", path, err)
+		}
+	}
+	if skipped > 0 {
+		log.Printf("D! [outputs.whisper] Skipped %d points out of the archives of %s",
+			skipped, path)
+	}
+	return nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func init() {
+	outputs.Add("whisper", func() telegraf.Output {
+		return &Whisper{
+			Path:         "/var/lib/telegraf/whisper",
+			Template:     "host.tags.measurement.field",
+			Retentions:   "10s:1d,1m:30d,1h:1y",
+			Aggregation:  "average",
+			XFilesFactor: 0.5,
+		}
+	})
+}
@@ -0,0 +1,195 @@
+package whisper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fetch returns the value of the point of the interval in the archive i of
+// the file path, and whether it is known.
+func fetch(t *testing.T, path string, i int, interval uint32) (float64, bool) {
+	w, err := open(path)
+	require.NoError(t, err)
+	defer w.Close()
+
+	a := w.archives[i]
+	base, err := w.readPoints(int64(a.offset), 1)
+	require.NoError(t, err)
+	if base[0].interval == 0 {
+		return 0, false
+	}
+	p, err := w.readPoints(a.pointOffset(base[0].interval, interval), 1)
+	require.NoError(t, err)
+	return p[0].value, p[0].interval == interval
+}
+
+func TestParseRetentions(t *testing.T) {
+	archives, err := parseRetentions("10s:1d, 1m:30d,3600:8760")
+	require.NoError(t, err)
+	assert.Equal(t, []archive{
+		{secondsPerPoint: 10, points: 8640},
+		{secondsPerPoint: 60, points: 43200},
+		{secondsPerPoint: 3600, points: 8760},
+	}, archives)
+
+	for _, retentions := range []string{
+		"",
+		"10s",
+		"0s:1d",
+		"10x:1d",
+		"1m:1d,10s:30d",
+		"10s:1d,15s:30d",
+		"10s:1d,1m:1h",
+		"10s:30s,1m:1d",
+	} {
+		_, err := parseRetentions(retentions)
+		assert.Error(t, err, retentions)
+	}
+}
+
+func newTestFile(t *testing.T, retentions, aggregation string, xff float64) (string, *file) {
+	dir, err := ioutil.TempDir("", "whisper")
+	require.NoError(t, err)
+	s, err := newSchema(retentions, aggregation, xff)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "test.wsp")
+	w, err := create(path, s)
+	require.NoError(t, err)
+	return path, w
+}
+
+func TestUpdatePropagate(t *testing.T) {
+	path, w := newTestFile(t, "1s:10s,5s:1m", "average", 0.5)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	now := uint32(1500000005)
+	for i, v := range []float64{1, 2, 3} {
+		require.NoError(t, w.update(point{1500000000 + uint32(i), v}, now))
+	}
+	require.NoError(t, w.Close())
+
+	v, ok := fetch(t, path, 0, 1500000002)
+	assert.True(t, ok)
+	assert.Equal(t, 3.0, v)
+	// 3 points out of 5 are known, more than the x_files_factor
+	v, ok = fetch(t, path, 1, 1500000000)
+	assert.True(t, ok)
+	assert.Equal(t, 2.0, v)
+
+	// too few points are known
+	w, err := open(path)
+	require.NoError(t, err)
+	require.NoError(t, w.update(point{1500000005, 6}, now))
+	w.Close()
+	_, ok = fetch(t, path, 1, 1500000005)
+	assert.False(t, ok)
+
+	// the points older than the first archive go to the next one, the
+	// points out of the file are skipped
+	w, err = open(path)
+	require.NoError(t, err)
+	assert.NoError(t, w.update(point{1500000000, 10}, now+20))
+	assert.Equal(t, errNotCovered, w.update(point{1500000000, 10}, now+60))
+	assert.Equal(t, errNotCovered, w.update(point{now + 1, 10}, now))
+	w.Close()
+	v, _ = fetch(t, path, 1, 1500000000)
+	assert.Equal(t, 10.0, v)
+}
+
+func TestUpdateWrap(t *testing.T) {
+	path, w := newTestFile(t, "1s:10s,5s:1m", "max", 0)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	// the archive of 10 points wraps around
+	for i := uint32(0); i < 15; i++ {
+		require.NoError(t, w.update(point{1500000000 + i, float64(i)}, 1500000014))
+	}
+	require.NoError(t, w.Close())
+
+	for i := uint32(5); i < 15; i++ {
+		v, ok := fetch(t, path, 0, 1500000000+i)
+		assert.True(t, ok)
+		assert.Equal(t, float64(i), v)
+	}
+	v, ok := fetch(t, path, 1, 1500000010)
+	assert.True(t, ok)
+	assert.Equal(t, 14.0, v)
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whisper")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	statsXFF := 0.0
+	w := &Whisper{
+		Path:         dir,
+		Template:     "host.tags.measurement.field",
+		Retentions:   "10s:1d,1m:30d",
+		Aggregation:  "average",
+		XFilesFactor: 0.5,
+		Retention: []*Retention{{
+			Measurements: []string{"statsd_*"},
+			Retentions:   "1m:7d",
+			Aggregation:  "sum",
+			XFilesFactor: &statsXFF,
+		}},
+	}
+	require.NoError(t, w.Connect())
+
+	now := time.Now().Truncate(time.Minute)
+	cpu, err := metric.New("cpu",
+		map[string]string{"host": "web.01", "cpu": "cpu0"},
+		map[string]interface{}{"usage_user": 42.5, "state": "up"},
+		now)
+	require.NoError(t, err)
+	requests, err := metric.New("statsd_requests",
+		map[string]string{"host": "web.01"},
+		map[string]interface{}{"value": int64(3)},
+		now)
+	require.NoError(t, err)
+	require.NoError(t, w.Write([]telegraf.Metric{cpu, requests}))
+
+	path := filepath.Join(dir, "web_01", "cpu0", "cpu", "usage_user.wsp")
+	v, ok := fetch(t, path, 0, uint32(now.Unix()))
+	assert.True(t, ok)
+	assert.Equal(t, 42.5, v)
+	_, err = os.Stat(filepath.Join(dir, "web_01", "cpu0", "cpu", "state.wsp"))
+	assert.True(t, os.IsNotExist(err))
+
+	path = filepath.Join(dir, "web_01", "statsd_requests.wsp")
+	f, err := open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, []archive{{offset: 28, secondsPerPoint: 60, points: 10080}}, f.archives)
+	assert.Equal(t, aggregationMethods["sum"], f.aggregation)
+	assert.Equal(t, float32(0), f.xFilesFactor)
+}
+
+func TestWriteInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whisper")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cpu.wsp"), []byte("garbage"), 0644))
+
+	w := &Whisper{
+		Path:         dir,
+		Template:     "measurement.field",
+		Retentions:   "10s:1d",
+		Aggregation:  "average",
+		XFilesFactor: 0.5,
+	}
+	require.NoError(t, w.Connect())
+	m, err := metric.New("cpu", nil, map[string]interface{}{"value": 1.0}, time.Now())
+	require.NoError(t, err)
+	// the invalid files are skipped, not retried
+	assert.NoError(t, w.Write([]telegraf.Metric{m}))
+}
@@ -33,6 +33,23 @@ func NewCollectdParser(
 	securityLevel string,
 	typesDB []string,
 ) (*CollectdParser, error) {
+	popts, err := NewParseOpts(authFile, securityLevel, typesDB)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := CollectdParser{popts: *popts}
+	return &parser, nil
+}
+
+// NewParseOpts returns the options to parse the network protocol with the
+// authFile of the signed and encrypted packets, the minimal securityLevel of
+// the packets and the types.db files typesDB.
+func NewParseOpts(
+	authFile string,
+	securityLevel string,
+	typesDB []string,
+) (*network.ParseOpts, error) {
 	popts := network.ParseOpts{}
 
 	switch securityLevel {
@@ -63,9 +80,7 @@ func NewCollectdParser(
 			popts.TypesDB = db
 		}
 	}
-
-	parser := CollectdParser{popts: popts}
-	return &parser, nil
+	return &popts, nil
 }
 
 func (p *CollectdParser) Parse(buf []byte) ([]telegraf.Metric, error) {
@@ -0,0 +1,275 @@
+package csv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// CSVParser parses CSV data, a metric per record. The values of the columns
+// are the fields of the metrics, except the tag, measurement and timestamp
+// columns.
+type CSVParser struct {
+	MetricName  string
+	DefaultTags map[string]string
+
+	// Delimiter separates the columns, "," if empty, and the lines starting
+	// with Comment are ignored.
+	Delimiter string
+	Comment   string
+	// TrimSpace trims the leading and trailing spaces of the values.
+	TrimSpace bool
+
+	// SkipRows lines are skipped before the HeaderRowCount rows naming the
+	// columns, the names of the header rows are concatenated. ColumnNames
+	// name the columns instead, they are required to parse single lines.
+	SkipRows       int
+	HeaderRowCount int
+	ColumnNames    []string
+	// SkipColumns columns are skipped at the start of the records.
+	SkipColumns int
+	// ColumnTypes are the types of the columns, "int", "float", "bool" or
+	// "string", in order. The types of the other columns are guessed.
+	ColumnTypes []string
+
+	TagColumns        []string
+	MeasurementColumn string
+	// TimestampColumn is the column of the timestamp of the metrics, in the
+	// TimestampFormat: unix, unix_ms, unix_us, unix_ns or a Go time layout.
+	// The metrics are timestamped with the current time if empty.
+	TimestampColumn string
+	TimestampFormat string
+
+	tagColumns map[string]bool
+}
+
+// Compile checks the options, it must be called once they are set.
+func (p *CSVParser) Compile() error {
+	if p.Delimiter != "" && utf8.RuneCountInString(p.Delimiter) != 1 {
+		return fmt.Errorf("csv_delimiter must be a single character, got %q", p.Delimiter)
+	}
+	if p.Comment != "" && utf8.RuneCountInString(p.Comment) != 1 {
+		return fmt.Errorf("csv_comment must be a single character, got %q", p.Comment)
+	}
+	if p.SkipRows < 0 || p.SkipColumns < 0 || p.HeaderRowCount < 0 {
+		return fmt.Errorf("csv_skip_rows, csv_skip_columns and " +
+			"csv_header_row_count must not be negative")
+	}
+	for _, t := range p.ColumnTypes {
+		switch t {
+		case "int", "float", "bool", "string":
+		default:
+			return fmt.Errorf("invalid csv_column_types %q, must be int, "+
+				"float, bool or string", t)
+		}
+	}
+	if p.TimestampColumn != "" && p.TimestampFormat == "" {
+		return fmt.Errorf("csv_timestamp_format must be set with csv_timestamp_column")
+	}
+	p.tagColumns = make(map[string]bool, len(p.TagColumns))
+	for _, c := range p.TagColumns {
+		p.tagColumns[c] = true
+	}
+	return nil
+}
+
+func (p *CSVParser) reader(buf []byte) *csv.Reader {
+	r := csv.NewReader(bytes.NewReader(buf))
+	if p.Delimiter != "" {
+		r.Comma, _ = utf8.DecodeRuneInString(p.Delimiter)
+	}
+	if p.Comment != "" {
+		r.Comment, _ = utf8.DecodeRuneInString(p.Comment)
+	}
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	return r
+}
+
+// Parse parses the records of buf, after its skipped and header rows.
+func (p *CSVParser) Parse(buf []byte) ([]telegraf.Metric, error) {
+	for i := 0; i < p.SkipRows; i++ {
+		n := bytes.IndexByte(buf, '\n')
+		if n < 0 {
+			return []telegraf.Metric{}, nil
+		}
+		buf = buf[n+1:]
+	}
+
+	r := p.reader(buf)
+	var header []string
+	for i := 0; i < p.HeaderRowCount; i++ {
+		record, err := r.Read()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the csv header: %s", err)
+		}
+		record = p.skipColumns(record)
+		for j, name := range record {
+			if j < len(header) {
+				header[j] += p.trim(name)
+			} else {
+				header = append(header, p.trim(name))
+			}
+		}
+	}
+	columns := p.ColumnNames
+	if len(columns) == 0 {
+		columns = header
+	}
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]telegraf.Metric, 0, len(records))
+	for _, record := range records {
+		m, err := p.parseRecord(columns, p.skipColumns(record))
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// ParseLine parses a single record, the columns must be named by the
+// ColumnNames.
+func (p *CSVParser) ParseLine(line string) (telegraf.Metric, error) {
+	if len(p.ColumnNames) == 0 {
+		return nil, fmt.Errorf("csv_column_names must be set to parse single lines")
+	}
+	record, err := p.reader([]byte(line)).Read()
+	if err != nil {
+		return nil, err
+	}
+	return p.parseRecord(p.ColumnNames, p.skipColumns(record))
+}
+
+func (p *CSVParser) SetDefaultTags(tags map[string]string) {
+	p.DefaultTags = tags
+}
+
+func (p *CSVParser) skipColumns(record []string) []string {
+	if p.SkipColumns >= len(record) {
+		return nil
+	}
+	return record[p.SkipColumns:]
+}
+
+func (p *CSVParser) trim(s string) string {
+	if p.TrimSpace {
+		return strings.TrimSpace(s)
+	}
+	return s
+}
+
+// parseRecord returns the metric of a record, the values of the columns
+// which are not named are ignored.
+func (p *CSVParser) parseRecord(columns, record []string) (telegraf.Metric, error) {
+	name := p.MetricName
+	tags := make(map[string]string)
+	for k, v := range p.DefaultTags {
+		tags[k] = v
+	}
+	fields := make(map[string]interface{})
+	t := time.Now().UTC()
+
+	for i, value := range record {
+		if i >= len(columns) {
+			break
+		}
+		column := columns[i]
+		value = p.trim(value)
+		if value == "" || column == "" {
+			continue
+		}
+
+		switch {
+		case column == p.MeasurementColumn:
+			name = value
+		case column == p.TimestampColumn:
+			var err error
+			t, err = parseTime(value, p.TimestampFormat)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp column %s: %s", column, err)
+			}
+		case p.tagColumns[column]:
+			tags[column] = value
+		default:
+			v, err := p.convert(i, value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %s", column, err)
+			}
+			fields[column] = v
+		}
+	}
+	return metric.New(name, tags, fields, t)
+}
+
+// convert converts the value of the column i to its type, or to the first
+// of an integer, a float or a boolean it is, or a string.
+func (p *CSVParser) convert(i int, value string) (interface{}, error) {
+	if i < len(p.ColumnTypes) {
+		switch p.ColumnTypes[i] {
+		case "int":
+			return strconv.ParseInt(value, 10, 64)
+		case "float":
+			return strconv.ParseFloat(value, 64)
+		case "bool":
+			return strconv.ParseBool(value)
+		case "string":
+			return value, nil
+		}
+	}
+
+	if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return v, nil
+	}
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		return v, nil
+	}
+	switch strings.ToLower(value) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return value, nil
+}
+
+// parseTime parses the timestamp s in the format.
+func parseTime(s string, format string) (time.Time, error) {
+	var unit time.Duration
+	switch format {
+	case "unix":
+		unit = time.Second
+	case "unix_ms":
+		unit = time.Millisecond
+	case "unix_us":
+		unit = time.Microsecond
+	case "unix_ns":
+		unit = time.Nanosecond
+	default:
+		return time.Parse(format, s)
+	}
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, n*int64(unit)).UTC(), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// the integer and fractional parts are converted separately not to
+	// lose precision
+	i := math.Floor(f)
+	return time.Unix(0, int64(i)*int64(unit)+int64((f-i)*float64(unit))).UTC(), nil
+}
@@ -0,0 +1,143 @@
+package csv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validCSV = `# report of 2017-07-14
+host,region,load,up,name
+a,eu,1.5,true,web
+b,us,2,false,db
+`
+
+func TestParseHeader(t *testing.T) {
+	parser := CSVParser{
+		MetricName:     "csv_test",
+		SkipRows:       1,
+		HeaderRowCount: 1,
+		TagColumns:     []string{"host", "region"},
+	}
+	require.NoError(t, parser.Compile())
+	metrics, err := parser.Parse([]byte(validCSV))
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+
+	assert.Equal(t, "csv_test", metrics[0].Name())
+	assert.Equal(t, map[string]string{"host": "a", "region": "eu"}, metrics[0].Tags())
+	assert.Equal(t, map[string]interface{}{
+		"load": 1.5,
+		"up":   true,
+		"name": "web",
+	}, metrics[0].Fields())
+	assert.Equal(t, map[string]interface{}{
+		"load": int64(2),
+		"up":   false,
+		"name": "db",
+	}, metrics[1].Fields())
+}
+
+func TestParseMultipleHeaderRows(t *testing.T) {
+	parser := CSVParser{
+		MetricName:     "csv_test",
+		HeaderRowCount: 2,
+		SkipColumns:    1,
+	}
+	require.NoError(t, parser.Compile())
+	metrics, err := parser.Parse([]byte("id,cpu,cpu\n,_user,_system\n1,10,20\n"))
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, map[string]interface{}{
+		"cpu_user":   int64(10),
+		"cpu_system": int64(20),
+	}, metrics[0].Fields())
+}
+
+func TestParseColumnTypes(t *testing.T) {
+	parser := CSVParser{
+		MetricName:  "csv_test",
+		ColumnNames: []string{"a", "b", "c", "d"},
+		ColumnTypes: []string{"float", "string", "int"},
+		Delimiter:   ";",
+		TrimSpace:   true,
+	}
+	require.NoError(t, parser.Compile())
+	metrics, err := parser.Parse([]byte(" 1 ; 2 ; 3 ; 4 \n"))
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, map[string]interface{}{
+		"a": float64(1),
+		"b": "2",
+		"c": int64(3),
+		"d": int64(4),
+	}, metrics[0].Fields())
+
+	_, err = parser.Parse([]byte("1;2;x;4\n"))
+	assert.Error(t, err)
+}
+
+func TestParseTimestampAndMeasurement(t *testing.T) {
+	tests := []struct {
+		format string
+		value  string
+	}{
+		{"unix", "1500000000"},
+		{"unix_ms", "1500000000000"},
+		{"unix_ns", "1500000000000000000"},
+		{"2006-01-02 15:04:05", "2017-07-14 02:40:00"},
+	}
+	for _, tt := range tests {
+		parser := CSVParser{
+			MetricName:        "csv_test",
+			ColumnNames:       []string{"time", "measurement", "value"},
+			MeasurementColumn: "measurement",
+			TimestampColumn:   "time",
+			TimestampFormat:   tt.format,
+		}
+		require.NoError(t, parser.Compile())
+		metrics, err := parser.Parse([]byte(tt.value + ",cpu,42\n"))
+		require.NoError(t, err, tt.format)
+		require.Len(t, metrics, 1)
+		assert.Equal(t, "cpu", metrics[0].Name())
+		assert.Equal(t, map[string]interface{}{"value": int64(42)}, metrics[0].Fields())
+		assert.True(t, time.Unix(1500000000, 0).Equal(metrics[0].Time()), tt.format)
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	parser := CSVParser{MetricName: "csv_test", HeaderRowCount: 1}
+	require.NoError(t, parser.Compile())
+	_, err := parser.ParseLine("1,2")
+	assert.Error(t, err)
+
+	parser.ColumnNames = []string{"a", "b"}
+	m, err := parser.ParseLine(`1,"x,y"`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": int64(1), "b": "x,y"}, m.Fields())
+}
+
+func TestParseComment(t *testing.T) {
+	parser := CSVParser{
+		MetricName:  "csv_test",
+		ColumnNames: []string{"a"},
+		Comment:     "#",
+	}
+	require.NoError(t, parser.Compile())
+	metrics, err := parser.Parse([]byte("# a comment\n1\n2\n"))
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, parser := range []CSVParser{
+		{Delimiter: ",;"},
+		{ColumnTypes: []string{"integer"}},
+		{TimestampColumn: "time"},
+		{SkipRows: -1},
+	} {
+		assert.Error(t, parser.Compile())
+	}
+}
@@ -100,7 +100,11 @@ func (p *GraphiteParser) addToMatcher(tmplt parsedTemplate) error {
 	tags := map[string]string{}
 	if tmplt.tagstring != "" {
 		for _, kv := range strings.Split(tmplt.tagstring, ",") {
-			parts := strings.Split(kv, "=")
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return fmt.Errorf("invalid tag %q in template %q",
+					kv, tmplt.template)
+			}
 			tags[parts[0]] = parts[1]
 		}
 	}
@@ -162,34 +166,17 @@ func (p *GraphiteParser) ParseLine(line string) (telegraf.Metric, error) {
 	}
 
 	// decode the name and tags
-	template := p.matcher.Match(fields[0])
-	measurement, tags, field, err := template.Apply(fields[0])
+	measurement, tags, field, err := p.apply(fields[0])
 	if err != nil {
 		return nil, err
 	}
 
-	// Could not extract measurement, use the raw value
-	if measurement == "" {
-		measurement = fields[0]
-	}
-
 	// Parse value.
 	v, err := strconv.ParseFloat(fields[1], 64)
 	if err != nil {
 		return nil, fmt.Errorf(`field "%s" value: %s`, fields[0], err)
 	}
 
-	if math.IsNaN(v) || math.IsInf(v, 0) {
-		return nil, &UnsupposedValueError{Field: fields[0], Value: v}
-	}
-
-	fieldValues := map[string]interface{}{}
-	if field != "" {
-		fieldValues[field] = v
-	} else {
-		fieldValues["value"] = v
-	}
-
 	// If no 3rd field, use now as timestamp
 	timestamp := time.Now().UTC()
 
@@ -210,6 +197,54 @@ func (p *GraphiteParser) ParseLine(line string) (telegraf.Metric, error) {
 			}
 		}
 	}
+	return p.newMetric(fields[0], measurement, tags, field, v, timestamp)
+}
+
+// ParseValue returns the metric of the value v of the Graphite metric name
+// at timestamp, whose measurement, tags and field are given by the templates.
+func (p *GraphiteParser) ParseValue(name string, v float64, timestamp time.Time) (telegraf.Metric, error) {
+	measurement, tags, field, err := p.apply(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.newMetric(name, measurement, tags, field, v, timestamp)
+}
+
+// apply returns the measurement, tags and field of the metric name given by
+// the templates, the measurement being the name if they do not set it.
+func (p *GraphiteParser) apply(name string) (string, map[string]string, string, error) {
+	template := p.matcher.Match(name)
+	measurement, tags, field, err := template.Apply(name)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	// Could not extract measurement, use the raw value
+	if measurement == "" {
+		measurement = name
+	}
+	return measurement, tags, field, nil
+}
+
+func (p *GraphiteParser) newMetric(
+	name string,
+	measurement string,
+	tags map[string]string,
+	field string,
+	v float64,
+	timestamp time.Time,
+) (telegraf.Metric, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, &UnsupposedValueError{Field: name, Value: v}
+	}
+
+	fieldValues := map[string]interface{}{}
+	if field != "" {
+		fieldValues[field] = v
+	} else {
+		fieldValues["value"] = v
+	}
+
 	// Set the default tags on the point if they are not already set
 	for k, v := range p.DefaultTags {
 		if _, ok := tags[k]; !ok {
@@ -242,6 +277,16 @@ func (p *GraphiteParser) ApplyTemplate(line string) (string, map[string]string,
 	return name, tags, field, err
 }
 
+// Matches returns whether a configured template applies to the given line,
+// rather than the default "measurement*" template.
+func (p *GraphiteParser) Matches(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	return p.matcher.hasDefault || p.matcher.root.Search(fields[0]) != nil
+}
+
 // template represents a pattern and tags to map a graphite metric string to a influxdb Point
 type template struct {
 	tags              []string
@@ -286,11 +331,6 @@ func (t *template) Apply(line string) (string, map[string]string, string, error)
 		field       []string
 	)
 
-	// Set any default tags
-	for k, v := range t.defaultTags {
-		tags[k] = append(tags[k], v)
-	}
-
 	// See if an invalid combination has been specified in the template:
 	for _, tag := range t.tags {
 		if tag == "measurement*" {
@@ -326,7 +366,18 @@ func (t *template) Apply(line string) (string, map[string]string, string, error)
 			measurement = append(measurement, fields[i:]...)
 			break
 		default:
-			tags[tag] = append(tags[tag], fields[i])
+			// an empty segment is missing, let the default fill it
+			if fields[i] != "" {
+				tags[tag] = append(tags[tag], fields[i])
+			}
+		}
+	}
+
+	// Set the default tags, a default only applies when the line does not
+	// have the segment; tags absent from the template are literals.
+	for k, v := range t.defaultTags {
+		if _, ok := tags[k]; !ok {
+			tags[k] = []string{v}
 		}
 	}
 
@@ -344,6 +395,8 @@ func (t *template) Apply(line string) (string, map[string]string, string, error)
 type matcher struct {
 	root            *node
 	defaultTemplate *template
+	// hasDefault is set if a template without filter was added
+	hasDefault bool
 }
 
 func newMatcher() *matcher {
@@ -356,6 +409,7 @@ func newMatcher() *matcher {
 func (m *matcher) Add(filter string, template *template) {
 	if filter == "" {
 		m.AddDefaultTemplate(template)
+		m.hasDefault = true
 		return
 	}
 	m.root.Insert(filter, template)
@@ -606,6 +606,58 @@ func TestParseTemplateWhitespace(t *testing.T) {
 	assert.Contains(t, m.String(), ",zone=1c")
 }
 
+func TestParseTemplateTagDefaults(t *testing.T) {
+	p, err := NewGraphiteParser("",
+		[]string{"servers.* .host.region.measurement* env=prod,region=unknown"},
+		nil)
+	assert.NoError(t, err)
+
+	// the line has every segment, the default is not used
+	m, err := p.ParseLine("servers.localhost.us-east.cpu_load 11 1435077219")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"host":   "localhost",
+		"region": "us-east",
+		"env":    "prod",
+	}, m.Tags())
+
+	// the region segment is empty, the default fills it
+	m, err = p.ParseLine("servers.localhost..cpu_load 11 1435077219")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"host":   "localhost",
+		"region": "unknown",
+		"env":    "prod",
+	}, m.Tags())
+}
+
+func TestApplyTemplateMissingSegmentDefault(t *testing.T) {
+	p, err := NewGraphiteParser("_",
+		[]string{"measurement.host.field env=prod,host=unknown"}, nil)
+	assert.NoError(t, err)
+
+	measurement, tags, _, err := p.ApplyTemplate("requests")
+	assert.NoError(t, err)
+	assert.Equal(t, "requests", measurement)
+	assert.Equal(t, map[string]string{"host": "unknown", "env": "prod"}, tags)
+}
+
+func TestTemplateTagWithEquals(t *testing.T) {
+	p, err := NewGraphiteParser("_",
+		[]string{"measurement.measurement query=a=b"}, nil)
+	assert.NoError(t, err)
+
+	_, tags, _, err := p.ApplyTemplate("current.users")
+	assert.NoError(t, err)
+	assert.Equal(t, "a=b", tags["query"])
+}
+
+func TestTemplateInvalidTag(t *testing.T) {
+	_, err := NewGraphiteParser("_",
+		[]string{"measurement.measurement region"}, nil)
+	assert.Error(t, err)
+}
+
 // Test basic functionality of ApplyTemplate
 func TestApplyTemplate(t *testing.T) {
 	p, err := NewGraphiteParser("_",
@@ -768,6 +820,24 @@ func TestApplyTemplateMostSpecificTemplate(t *testing.T) {
 		tags)
 }
 
+func TestMatches(t *testing.T) {
+	p, err := NewGraphiteParser(".", []string{
+		"cpu.* .host.measurement*",
+		"mem.used measurement.field",
+	}, nil)
+	assert.NoError(t, err)
+
+	assert.True(t, p.Matches("cpu.server01.load"))
+	assert.True(t, p.Matches("mem.used 10"))
+	assert.False(t, p.Matches("mem.free"))
+	assert.False(t, p.Matches("disk.sda.used"))
+
+	// a template without filter matches everything
+	p, err = NewGraphiteParser(".", []string{"measurement.host"}, nil)
+	assert.NoError(t, err)
+	assert.True(t, p.Matches("disk.sda.used"))
+}
+
 // Test Helpers
 func errstr(err error) string {
 	if err != nil {
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
 	"github.com/influxdata/telegraf/metric"
 )
 
@@ -16,21 +18,34 @@ type JSONParser struct {
 	MetricName  string
 	TagKeys     []string
 	DefaultTags map[string]string
-}
 
-func (p *JSONParser) parseArray(buf []byte) ([]telegraf.Metric, error) {
-	metrics := make([]telegraf.Metric, 0)
+	// Query is the path of the object or array of objects to parse, in a
+	// subset of the GJSON path syntax, see query.
+	Query string
+	// StringFields are the string values kept as fields, by their flattened
+	// key, glob patterns are supported.
+	StringFields []string
+	// TimeKey is the key of the timestamp of the objects, in the
+	// TimeFormat: unix, unix_ms, unix_us, unix_ns or a Go time layout. The
+	// objects are timestamped with the current time if empty.
+	TimeKey    string
+	TimeFormat string
 
-	var jsonOut []map[string]interface{}
-	err := json.Unmarshal(buf, &jsonOut)
+	stringFields filter.Filter
+}
+
+// Compile compiles the StringFields, it must be called once the options
+// are set.
+func (p *JSONParser) Compile() error {
+	var err error
+	p.stringFields, err = filter.Compile(p.StringFields)
 	if err != nil {
-		err = fmt.Errorf("unable to parse out as JSON Array, %s", err)
-		return nil, err
+		return fmt.Errorf("invalid json_string_fields: %s", err)
 	}
-	for _, item := range jsonOut {
-		metrics, err = p.parseObject(metrics, item)
+	if p.TimeKey != "" && p.TimeFormat == "" {
+		return fmt.Errorf("json_time_format must be set with json_time_key")
 	}
-	return metrics, nil
+	return nil
 }
 
 func (p *JSONParser) parseObject(metrics []telegraf.Metric, jsonOut map[string]interface{}) ([]telegraf.Metric, error) {
@@ -52,13 +67,33 @@ func (p *JSONParser) parseObject(metrics []telegraf.Metric, jsonOut map[string]i
 		delete(jsonOut, tag)
 	}
 
+	t := time.Now().UTC()
+	if p.TimeKey != "" {
+		var err error
+		t, err = parseTime(jsonOut[p.TimeKey], p.TimeFormat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time key %s: %s", p.TimeKey, err)
+		}
+		delete(jsonOut, p.TimeKey)
+	}
+
 	f := JSONFlattener{}
-	err := f.FlattenJSON("", jsonOut)
+	var err error
+	if p.stringFields != nil {
+		err = f.FullFlattenJSON("", jsonOut, true, false)
+		for k, v := range f.Fields {
+			if _, ok := v.(string); ok && !p.stringFields.Match(k) {
+				delete(f.Fields, k)
+			}
+		}
+	} else {
+		err = f.FlattenJSON("", jsonOut)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	metric, err := metric.New(p.MetricName, tags, f.Fields, time.Now().UTC())
+	metric, err := metric.New(p.MetricName, tags, f.Fields, t)
 
 	if err != nil {
 		return nil, err
@@ -66,19 +101,127 @@ func (p *JSONParser) parseObject(metrics []telegraf.Metric, jsonOut map[string]i
 	return append(metrics, metric), nil
 }
 
+// Parse parses the JSON object or array of objects of buf, or the ones at
+// the path of the Query.
 func (p *JSONParser) Parse(buf []byte) ([]telegraf.Metric, error) {
-
-	if !isarray(buf) {
-		metrics := make([]telegraf.Metric, 0)
-		var jsonOut map[string]interface{}
-		err := json.Unmarshal(buf, &jsonOut)
+	var jsonOut interface{}
+	err := json.Unmarshal(buf, &jsonOut)
+	if err != nil {
+		err = fmt.Errorf("unable to parse out as JSON, %s", err)
+		return nil, err
+	}
+	if p.Query != "" {
+		jsonOut, err = query(jsonOut, p.Query)
 		if err != nil {
-			err = fmt.Errorf("unable to parse out as JSON, %s", err)
 			return nil, err
 		}
-		return p.parseObject(metrics, jsonOut)
 	}
-	return p.parseArray(buf)
+
+	metrics := make([]telegraf.Metric, 0)
+	switch v := jsonOut.(type) {
+	case map[string]interface{}:
+		return p.parseObject(metrics, v)
+	case []interface{}:
+		for _, item := range v {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("unable to parse out as JSON Array, "+
+					"%T is not an object", item)
+			}
+			metrics, err = p.parseObject(metrics, obj)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return metrics, nil
+	default:
+		return nil, fmt.Errorf("unable to parse out as JSON, %T is not an "+
+			"object or an array", jsonOut)
+	}
+}
+
+// query returns the value at the path in v. The path is a subset of the
+// GJSON path syntax: keys separated by dots, dots and backslashes in the keys
+// being escaped with a backslash, and array indexes.
+func query(v interface{}, path string) (interface{}, error) {
+	var keys []string
+	var key bytes.Buffer
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '\\' && i+1 < len(path):
+			i++
+			key.WriteByte(path[i])
+		case c == '.':
+			keys = append(keys, key.String())
+			key.Reset()
+		default:
+			key.WriteByte(c)
+		}
+	}
+	keys = append(keys, key.String())
+
+	for i, k := range keys {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = t[k]; ok {
+				continue
+			}
+		case []interface{}:
+			if n, err := strconv.Atoi(k); err == nil && n >= 0 && n < len(t) {
+				v = t[n]
+				continue
+			}
+		}
+		return nil, fmt.Errorf("json_query %s: %s not found",
+			path, strings.Join(keys[:i+1], "."))
+	}
+	return v, nil
+}
+
+// parseTime parses the timestamp v, a number or a string, in the format.
+func parseTime(v interface{}, format string) (time.Time, error) {
+	var unit time.Duration
+	switch format {
+	case "unix":
+		unit = time.Second
+	case "unix_ms":
+		unit = time.Millisecond
+	case "unix_us":
+		unit = time.Microsecond
+	case "unix_ns":
+		unit = time.Nanosecond
+	}
+
+	switch v := v.(type) {
+	case float64:
+		if unit == 0 {
+			return time.Time{}, fmt.Errorf("number %v is not in the format %s", v, format)
+		}
+		return unixTime(v, unit), nil
+	case string:
+		if unit == 0 {
+			return time.Parse(format, v)
+		}
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(0, n*int64(unit)).UTC(), nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return unixTime(f, unit), nil
+	case nil:
+		return time.Time{}, fmt.Errorf("not found")
+	}
+	return time.Time{}, fmt.Errorf("%T is not a timestamp", v)
+}
+
+// unixTime returns the time of the timestamp f in unit, the integer and
+// fractional parts being converted separately not to lose precision.
+func unixTime(f float64, unit time.Duration) time.Time {
+	i := math.Floor(f)
+	return time.Unix(0, int64(i)*int64(unit)+int64((f-i)*float64(unit))).UTC()
 }
 
 func (p *JSONParser) ParseLine(line string) (telegraf.Metric, error) {
@@ -164,13 +307,3 @@ func (f *JSONFlattener) FullFlattenJSON(
 	}
 	return nil
 }
-
-func isarray(buf []byte) bool {
-	ia := bytes.IndexByte(buf, '[')
-	ib := bytes.IndexByte(buf, '{')
-	if ia > -1 && ia < ib {
-		return true
-	} else {
-		return false
-	}
-}
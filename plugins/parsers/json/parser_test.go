@@ -2,8 +2,10 @@ package json
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -418,3 +420,128 @@ func TestParseArrayWithTagKeys(t *testing.T) {
 		"othertag": "baz",
 	}, metrics[1].Tags())
 }
+
+const validJSONQuery = `
+{
+    "status": "ok",
+    "data": {
+        "hosts": [
+            {"name": "a", "load": 1.5, "state": "up", "ts": 1500000000},
+            {"name": "b", "load": 0.5, "state": "down", "ts": 1500000010}
+        ],
+        "b.c": {"d": 3}
+    }
+}
+`
+
+func TestParseQuery(t *testing.T) {
+	parser := JSONParser{
+		MetricName: "json_test",
+		TagKeys:    []string{"name"},
+		Query:      "data.hosts",
+	}
+	require.NoError(t, parser.Compile())
+	metrics, err := parser.Parse([]byte(validJSONQuery))
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, map[string]interface{}{
+		"load": 1.5,
+		"ts":   float64(1500000000),
+	}, metrics[0].Fields())
+	assert.Equal(t, map[string]string{"name": "a"}, metrics[0].Tags())
+
+	// array index
+	parser.Query = "data.hosts.1"
+	metrics, err = parser.Parse([]byte(validJSONQuery))
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, map[string]string{"name": "b"}, metrics[0].Tags())
+
+	// escaped dot
+	parser.Query = `data.b\.c`
+	metrics, err = parser.Parse([]byte(validJSONQuery))
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, map[string]interface{}{"d": float64(3)}, metrics[0].Fields())
+
+	for _, q := range []string{"data.missing", "data.hosts.2", "status"} {
+		parser.Query = q
+		_, err = parser.Parse([]byte(validJSONQuery))
+		assert.Error(t, err, q)
+	}
+}
+
+func TestParseTimeKey(t *testing.T) {
+	tests := []struct {
+		format string
+		value  string
+	}{
+		{"unix", `1500000000`},
+		{"unix", `"1500000000"`},
+		{"unix", `1500000000.25`},
+		{"unix_ms", `1500000000250`},
+		{"unix_us", `1500000000250000`},
+		{"unix_ns", `"1500000000250000000"`},
+		{time.RFC3339Nano, `"2017-07-14T02:40:00.25Z"`},
+	}
+	for _, tt := range tests {
+		parser := JSONParser{
+			MetricName: "json_test",
+			TimeKey:    "time",
+			TimeFormat: tt.format,
+		}
+		require.NoError(t, parser.Compile())
+		metrics, err := parser.Parse([]byte(`{"a": 5, "time": ` + tt.value + `}`))
+		require.NoError(t, err, tt.value)
+		require.Len(t, metrics, 1)
+		assert.Equal(t, map[string]interface{}{"a": float64(5)}, metrics[0].Fields())
+		var want time.Time
+		if tt.value == `1500000000` || tt.value == `"1500000000"` {
+			want = time.Unix(1500000000, 0)
+		} else {
+			want = time.Unix(1500000000, 250000000)
+		}
+		assert.True(t, want.Equal(metrics[0].Time()), tt.value)
+	}
+}
+
+func TestParseTimeKeyInvalid(t *testing.T) {
+	parser := JSONParser{MetricName: "json_test", TimeKey: "time"}
+	assert.Error(t, parser.Compile())
+
+	parser.TimeFormat = "unix"
+	require.NoError(t, parser.Compile())
+	for _, v := range []string{`{"a": 5}`, `{"a": 5, "time": "now"}`,
+		`{"a": 5, "time": true}`} {
+		_, err := parser.Parse([]byte(v))
+		assert.Error(t, err, v)
+	}
+
+	parser.TimeFormat = time.RFC3339
+	require.NoError(t, parser.Compile())
+	_, err := parser.Parse([]byte(`{"a": 5, "time": 1500000000}`))
+	assert.Error(t, err)
+}
+
+func TestParseStringFields(t *testing.T) {
+	parser := JSONParser{
+		MetricName:   "json_test",
+		Query:        "data.hosts.0",
+		StringFields: []string{"sta*"},
+	}
+	require.NoError(t, parser.Compile())
+	metrics, err := parser.Parse([]byte(validJSONQuery))
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, map[string]interface{}{
+		"load":  1.5,
+		"state": "up",
+		"ts":    float64(1500000000),
+	}, metrics[0].Fields())
+}
+
+func TestParseArrayNotObject(t *testing.T) {
+	parser := JSONParser{MetricName: "json_test"}
+	_, err := parser.Parse([]byte(`[{"a": 5}, 6]`))
+	assert.Error(t, err)
+}
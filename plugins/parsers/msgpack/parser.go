@@ -0,0 +1,363 @@
+package msgpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// errShort is returned when the buffer ends in the middle of a value.
+var errShort = errors.New("truncated MessagePack value")
+
+// maxDepth is the maximum nesting of MessagePack arrays and maps.
+const maxDepth = 32
+
+// MsgpackParser parses the metrics written by the msgpack serializer: a
+// sequence of MessagePack maps, or arrays of maps, with the name, tags,
+// fields and timestamp (in nanoseconds) keys.
+type MsgpackParser struct {
+	DefaultTags map[string]string
+}
+
+func (p *MsgpackParser) Parse(buf []byte) ([]telegraf.Metric, error) {
+	metrics := make([]telegraf.Metric, 0)
+	for len(buf) > 0 {
+		v, n, err := decode(buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[n:]
+
+		switch v := v.(type) {
+		case map[string]interface{}:
+			m, err := p.parseMetric(v)
+			if err != nil {
+				return nil, err
+			}
+			metrics = append(metrics, m)
+		case []interface{}:
+			for _, item := range v {
+				obj, ok := item.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("array item is a %T, not a metric", item)
+				}
+				m, err := p.parseMetric(obj)
+				if err != nil {
+					return nil, err
+				}
+				metrics = append(metrics, m)
+			}
+		default:
+			return nil, fmt.Errorf("value is a %T, not a metric", v)
+		}
+	}
+	return metrics, nil
+}
+
+func (p *MsgpackParser) ParseLine(line string) (telegraf.Metric, error) {
+	metrics, err := p.Parse([]byte(line))
+	if err != nil {
+		return nil, err
+	}
+	if len(metrics) != 1 {
+		return nil, fmt.Errorf("can not parse the line: %s, for data format: msgpack",
+			line)
+	}
+	return metrics[0], nil
+}
+
+func (p *MsgpackParser) SetDefaultTags(tags map[string]string) {
+	p.DefaultTags = tags
+}
+
+// Split is a bufio.SplitFunc returning one MessagePack value at a time, for
+// the stream sockets.
+func (p *MsgpackParser) Split(data []byte, atEOF bool) (int, []byte, error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+	_, n, err := decode(data, 0)
+	if err == errShort && !atEOF {
+		// request more data
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, data[:n], nil
+}
+
+func (p *MsgpackParser) parseMetric(obj map[string]interface{}) (telegraf.Metric, error) {
+	name, ok := obj["name"].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("metric has no name")
+	}
+
+	tags := make(map[string]string, len(p.DefaultTags))
+	for k, v := range p.DefaultTags {
+		tags[k] = v
+	}
+	if t, ok := obj["tags"]; ok && t != nil {
+		tm, ok := t.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("tags of %s are a %T, not a map", name, t)
+		}
+		for k, v := range tm {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("tag %s of %s is a %T, not a string", k, name, v)
+			}
+			tags[k] = s
+		}
+	}
+
+	fm, ok := obj["fields"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("metric %s has no fields", name)
+	}
+	fields := make(map[string]interface{}, len(fm))
+	for k, v := range fm {
+		switch v.(type) {
+		case float64, int64, uint64, string, bool:
+			fields[k] = v
+		default:
+			return nil, fmt.Errorf("field %s of %s is a %T", k, name, v)
+		}
+	}
+
+	t := time.Now()
+	switch ts := obj["timestamp"].(type) {
+	case nil:
+	case int64:
+		t = time.Unix(0, ts)
+	case uint64:
+		return nil, fmt.Errorf("timestamp of %s is out of range", name)
+	case time.Time:
+		t = ts
+	default:
+		return nil, fmt.Errorf("timestamp of %s is a %T, not an integer", name, ts)
+	}
+	return metric.New(name, tags, fields, t)
+}
+
+// decode returns the value at the start of buf and its length. Integers are
+// returned as int64, or uint64 if they do not fit, floats as float64, str
+// and bin as string, the timestamp extension as time.Time.
+func decode(buf []byte, depth int) (interface{}, int, error) {
+	if len(buf) == 0 {
+		return nil, 0, errShort
+	}
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("MessagePack value nested too deeply")
+	}
+
+	b := buf[0]
+	switch {
+	case b <= 0x7f:
+		return int64(b), 1, nil
+	case b >= 0xe0:
+		return int64(int8(b)), 1, nil
+	case b&0xf0 == 0x80:
+		return decodeMap(buf, 1, int(b&0x0f), depth)
+	case b&0xf0 == 0x90:
+		return decodeArray(buf, 1, int(b&0x0f), depth)
+	case b&0xe0 == 0xa0:
+		return decodeString(buf, 1, int(b&0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, 1, nil
+	case 0xc2:
+		return false, 1, nil
+	case 0xc3:
+		return true, 1, nil
+	case 0xc4, 0xd9:
+		n, err := length(buf, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		return decodeString(buf, 2, n)
+	case 0xc5, 0xda:
+		n, err := length(buf, 2)
+		if err != nil {
+			return nil, 0, err
+		}
+		return decodeString(buf, 3, n)
+	case 0xc6, 0xdb:
+		n, err := length(buf, 4)
+		if err != nil {
+			return nil, 0, err
+		}
+		return decodeString(buf, 5, n)
+	case 0xca:
+		if len(buf) < 5 {
+			return nil, 0, errShort
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(buf[1:]))), 5, nil
+	case 0xcb:
+		if len(buf) < 9 {
+			return nil, 0, errShort
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(buf[1:])), 9, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		size := 1 << (b - 0xcc)
+		if len(buf) < 1+size {
+			return nil, 0, errShort
+		}
+		v := uintN(buf[1:], size)
+		if v > math.MaxInt64 {
+			return v, 1 + size, nil
+		}
+		return int64(v), 1 + size, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		if len(buf) < 1+size {
+			return nil, 0, errShort
+		}
+		// sign extend
+		shift := uint(64 - 8*size)
+		return int64(uintN(buf[1:], size)<<shift) >> shift, 1 + size, nil
+	case 0xd6, 0xd7, 0xc7:
+		return decodeExt(buf)
+	case 0xdc:
+		n, err := length(buf, 2)
+		if err != nil {
+			return nil, 0, err
+		}
+		return decodeArray(buf, 3, n, depth)
+	case 0xdd:
+		n, err := length(buf, 4)
+		if err != nil {
+			return nil, 0, err
+		}
+		return decodeArray(buf, 5, n, depth)
+	case 0xde:
+		n, err := length(buf, 2)
+		if err != nil {
+			return nil, 0, err
+		}
+		return decodeMap(buf, 3, n, depth)
+	case 0xdf:
+		n, err := length(buf, 4)
+		if err != nil {
+			return nil, 0, err
+		}
+		return decodeMap(buf, 5, n, depth)
+	}
+	return nil, 0, fmt.Errorf("unsupported MessagePack type 0x%x", b)
+}
+
+func uintN(buf []byte, size int) uint64 {
+	var v uint64
+	for _, b := range buf[:size] {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+// length reads the size bytes long length following the type byte.
+func length(buf []byte, size int) (int, error) {
+	if len(buf) < 1+size {
+		return 0, errShort
+	}
+	n := uintN(buf[1:], size)
+	if n > uint64(len(buf)) {
+		return 0, errShort
+	}
+	return int(n), nil
+}
+
+func decodeString(buf []byte, offset, n int) (interface{}, int, error) {
+	if len(buf) < offset+n {
+		return nil, 0, errShort
+	}
+	return string(buf[offset : offset+n]), offset + n, nil
+}
+
+func decodeArray(buf []byte, offset, n, depth int) (interface{}, int, error) {
+	// every item takes at least a byte
+	if n > len(buf)-offset {
+		return nil, 0, errShort
+	}
+	items := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, size, err := decode(buf[offset:], depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, v)
+		offset += size
+	}
+	return items, offset, nil
+}
+
+func decodeMap(buf []byte, offset, n, depth int) (interface{}, int, error) {
+	if n > len(buf)-offset {
+		return nil, 0, errShort
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, size, err := decode(buf[offset:], depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, 0, fmt.Errorf("map key is a %T, not a string", k)
+		}
+		offset += size
+
+		v, size, err := decode(buf[offset:], depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		m[key] = v
+		offset += size
+	}
+	return m, offset, nil
+}
+
+// decodeExt decodes the timestamp extension type (-1), the only extension
+// supported.
+func decodeExt(buf []byte) (interface{}, int, error) {
+	var n, offset int
+	switch buf[0] {
+	case 0xd6:
+		n, offset = 4, 1
+	case 0xd7:
+		n, offset = 8, 1
+	default:
+		if len(buf) < 2 {
+			return nil, 0, errShort
+		}
+		n, offset = int(buf[1]), 2
+	}
+	if len(buf) < offset+1+n {
+		return nil, 0, errShort
+	}
+	if int8(buf[offset]) != -1 {
+		return nil, 0, fmt.Errorf("unsupported MessagePack extension type %d",
+			int8(buf[offset]))
+	}
+	data := buf[offset+1 : offset+1+n]
+	size := offset + 1 + n
+
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), size, nil
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(v&0x3ffffffff), int64(v>>34)), size, nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data)
+		sec := int64(binary.BigEndian.Uint64(data[4:]))
+		return time.Unix(sec, int64(nsec)), size, nil
+	}
+	return nil, 0, fmt.Errorf("invalid MessagePack timestamp of %d bytes", n)
+}
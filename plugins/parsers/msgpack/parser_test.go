@@ -0,0 +1,122 @@
+package msgpack
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/serializers/msgpack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMetrics(t *testing.T) []telegraf.Metric {
+	m1, err := metric.New("cpu",
+		map[string]string{"cpu": "cpu0", "host": "localhost"},
+		map[string]interface{}{
+			"usage_idle": 91.5,
+			"count":      int64(-300000),
+			"big":        int64(1) << 40,
+			"up":         true,
+			"state":      "running",
+		},
+		time.Unix(0, 1500000000123456789))
+	require.NoError(t, err)
+	m2, err := metric.New("load", nil,
+		map[string]interface{}{"load1": 0.25},
+		time.Unix(-86400, 0))
+	require.NoError(t, err)
+	return []telegraf.Metric{m1, m2}
+}
+
+func TestRoundTrip(t *testing.T) {
+	metrics := testMetrics(t)
+	s := &msgpack.MsgpackSerializer{}
+	buf, err := s.SerializeBatch(metrics)
+	require.NoError(t, err)
+
+	p := MsgpackParser{}
+	parsed, err := p.Parse(buf)
+	require.NoError(t, err)
+	require.Len(t, parsed, 2)
+	for i, m := range parsed {
+		assert.Equal(t, metrics[i].Name(), m.Name())
+		assert.Equal(t, metrics[i].Tags(), m.Tags())
+		assert.Equal(t, metrics[i].Fields(), m.Fields())
+		assert.Equal(t, metrics[i].Time().UnixNano(), m.Time().UnixNano())
+	}
+}
+
+func TestParseDefaultTags(t *testing.T) {
+	s := &msgpack.MsgpackSerializer{}
+	buf, err := s.Serialize(testMetrics(t)[1])
+	require.NoError(t, err)
+
+	p := MsgpackParser{}
+	p.SetDefaultTags(map[string]string{"dc": "eu"})
+	m, err := p.ParseLine(string(buf))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"dc": "eu"}, m.Tags())
+}
+
+func TestParseArrayAndTimestampExtension(t *testing.T) {
+	// [{"name": "a", "fields": {"v": 1.5 (float32)}, "timestamp": ext -1}]
+	buf := []byte{
+		0x91, 0x83,
+		0xa4, 'n', 'a', 'm', 'e', 0xa1, 'a',
+		0xa6, 'f', 'i', 'e', 'l', 'd', 's', 0x81, 0xa1, 'v', 0xca, 0x3f, 0xc0, 0, 0,
+		0xa9, 't', 'i', 'm', 'e', 's', 't', 'a', 'm', 'p', 0xd6, 0xff, 0x59, 0x68, 0x2f, 0x00,
+	}
+	p := MsgpackParser{}
+	metrics, err := p.Parse(buf)
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "a", metrics[0].Name())
+	assert.Equal(t, map[string]interface{}{"v": 1.5}, metrics[0].Fields())
+	assert.Equal(t, int64(1500000000), metrics[0].Time().Unix())
+}
+
+func TestParseInvalid(t *testing.T) {
+	s := &msgpack.MsgpackSerializer{}
+	buf, err := s.Serialize(testMetrics(t)[0])
+	require.NoError(t, err)
+
+	p := MsgpackParser{}
+	for i := 1; i < len(buf); i++ {
+		_, err := p.Parse(buf[:i])
+		assert.Error(t, err, "truncated at %d", i)
+	}
+
+	for _, buf := range [][]byte{
+		{0x01},                           // not a map
+		{0x81, 0x01, 0x01},               // integer key
+		{0x81, 0xa4, 'n', 'a', 'm', 'e'}, // missing value
+		{0x81, 0xa4, 'n', 'a', 'm', 'e', 0xa1, 'a'}, // no fields
+		{0xc1},                         // never used
+		{0xdd, 0xff, 0xff, 0xff, 0xff}, // huge array
+	} {
+		_, err := p.Parse(buf)
+		assert.Error(t, err, "%x", buf)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	s := &msgpack.MsgpackSerializer{}
+	buf, err := s.SerializeBatch(testMetrics(t))
+	require.NoError(t, err)
+
+	p := MsgpackParser{}
+	scnr := bufio.NewScanner(bytes.NewReader(buf))
+	scnr.Split(p.Split)
+	var metrics []telegraf.Metric
+	for scnr.Scan() {
+		m, err := p.ParseLine(string(scnr.Bytes()))
+		require.NoError(t, err)
+		metrics = append(metrics, m)
+	}
+	require.NoError(t, scnr.Err())
+	assert.Len(t, metrics, 2)
+}
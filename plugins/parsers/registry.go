@@ -6,9 +6,11 @@ import (
 	"github.com/influxdata/telegraf"
 
 	"github.com/influxdata/telegraf/plugins/parsers/collectd"
+	"github.com/influxdata/telegraf/plugins/parsers/csv"
 	"github.com/influxdata/telegraf/plugins/parsers/graphite"
 	"github.com/influxdata/telegraf/plugins/parsers/influx"
 	"github.com/influxdata/telegraf/plugins/parsers/json"
+	"github.com/influxdata/telegraf/plugins/parsers/msgpack"
 	"github.com/influxdata/telegraf/plugins/parsers/nagios"
 	"github.com/influxdata/telegraf/plugins/parsers/value"
 )
@@ -20,6 +22,16 @@ type ParserInput interface {
 	SetParser(parser Parser)
 }
 
+// SubParserInput is an interface for input plugins whose sub-tables can
+// have their own data format.
+type SubParserInput interface {
+	// ParserTable returns the name of the sub-tables having a parser.
+	ParserTable() string
+	// SetSubParsers sets the parsers of the sub-tables, in order. The parser
+	// of a sub-table without data_format is nil.
+	SetSubParsers(parsers []Parser)
+}
+
 // Parser is an interface defining functions that a parser plugin must satisfy.
 type Parser interface {
 	// Parse takes a byte buffer separated by newlines
@@ -38,10 +50,18 @@ type Parser interface {
 	SetDefaultTags(tags map[string]string)
 }
 
+// Splitter is implemented by the parsers of formats that are not newline
+// delimited, the inputs reading streams use Split to frame the messages.
+type Splitter interface {
+	// Split is a bufio.SplitFunc returning a message at a time.
+	Split(data []byte, atEOF bool) (advance int, token []byte, err error)
+}
+
 // Config is a struct that covers the data types needed for all parser types,
 // and can be used to instantiate _any_ of the parsers.
 type Config struct {
-	// Dataformat can be one of: json, influx, graphite, value, nagios
+	// Dataformat can be one of: json, influx, graphite, value, nagios,
+	// collectd, msgpack, csv
 	DataFormat string
 
 	// Separator only applied to Graphite data.
@@ -51,6 +71,14 @@ type Config struct {
 
 	// TagKeys only apply to JSON data
 	TagKeys []string
+	// JSONQuery is the path of the objects to parse in the JSON data
+	JSONQuery string
+	// JSONStringFields are the string values of the JSON data kept as fields
+	JSONStringFields []string
+	// JSONTimeKey is the key of the timestamp of the JSON objects, in the
+	// JSONTimeFormat
+	JSONTimeKey    string
+	JSONTimeFormat string
 	// MetricName applies to JSON & value. This will be the name of the measurement.
 	MetricName string
 
@@ -64,6 +92,20 @@ type Config struct {
 	// DataType only applies to value, this will be the type to parse value to
 	DataType string
 
+	// The CSV options, see csv.CSVParser
+	CSVColumnNames       []string
+	CSVColumnTypes       []string
+	CSVComment           string
+	CSVDelimiter         string
+	CSVHeaderRowCount    int
+	CSVMeasurementColumn string
+	CSVSkipColumns       int
+	CSVSkipRows          int
+	CSVTagColumns        []string
+	CSVTimestampColumn   string
+	CSVTimestampFormat   string
+	CSVTrimSpace         bool
+
 	// DefaultTags are the default tags that will be added to all parsed metrics.
 	DefaultTags map[string]string
 }
@@ -74,8 +116,7 @@ func NewParser(config *Config) (Parser, error) {
 	var parser Parser
 	switch config.DataFormat {
 	case "json":
-		parser, err = NewJSONParser(config.MetricName,
-			config.TagKeys, config.DefaultTags)
+		parser, err = newJSONParser(config)
 	case "value":
 		parser, err = NewValueParser(config.MetricName,
 			config.DataType, config.DefaultTags)
@@ -89,6 +130,10 @@ func NewParser(config *Config) (Parser, error) {
 	case "collectd":
 		parser, err = NewCollectdParser(config.CollectdAuthFile,
 			config.CollectdSecurityLevel, config.CollectdTypesDB)
+	case "msgpack":
+		parser, err = NewMsgpackParser(config.DefaultTags)
+	case "csv":
+		parser, err = newCSVParser(config)
 	default:
 		err = fmt.Errorf("Invalid data format: %s", config.DataFormat)
 	}
@@ -108,6 +153,22 @@ func NewJSONParser(
 	return parser, nil
 }
 
+func newJSONParser(config *Config) (Parser, error) {
+	parser := &json.JSONParser{
+		MetricName:   config.MetricName,
+		TagKeys:      config.TagKeys,
+		DefaultTags:  config.DefaultTags,
+		Query:        config.JSONQuery,
+		StringFields: config.JSONStringFields,
+		TimeKey:      config.JSONTimeKey,
+		TimeFormat:   config.JSONTimeFormat,
+	}
+	if err := parser.Compile(); err != nil {
+		return nil, err
+	}
+	return parser, nil
+}
+
 func NewNagiosParser() (Parser, error) {
 	return &nagios.NagiosParser{}, nil
 }
@@ -143,3 +204,30 @@ func NewCollectdParser(
 ) (Parser, error) {
 	return collectd.NewCollectdParser(authFile, securityLevel, typesDB)
 }
+
+func NewMsgpackParser(defaultTags map[string]string) (Parser, error) {
+	return &msgpack.MsgpackParser{DefaultTags: defaultTags}, nil
+}
+
+func newCSVParser(config *Config) (Parser, error) {
+	parser := &csv.CSVParser{
+		MetricName:        config.MetricName,
+		DefaultTags:       config.DefaultTags,
+		Delimiter:         config.CSVDelimiter,
+		Comment:           config.CSVComment,
+		TrimSpace:         config.CSVTrimSpace,
+		SkipRows:          config.CSVSkipRows,
+		HeaderRowCount:    config.CSVHeaderRowCount,
+		ColumnNames:       config.CSVColumnNames,
+		SkipColumns:       config.CSVSkipColumns,
+		ColumnTypes:       config.CSVColumnTypes,
+		TagColumns:        config.CSVTagColumns,
+		MeasurementColumn: config.CSVMeasurementColumn,
+		TimestampColumn:   config.CSVTimestampColumn,
+		TimestampFormat:   config.CSVTimestampFormat,
+	}
+	if err := parser.Compile(); err != nil {
+		return nil, err
+	}
+	return parser, nil
+}
@@ -0,0 +1,352 @@
+package alert
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+// Alert evaluates threshold and ratio rules over a sliding window of the
+// metrics passing through it, and emits an alert metric whenever a rule
+// starts or stops firing.
+type Alert struct {
+	Window internal.Duration
+	Rules  []*Rule `toml:"rule"`
+
+	initialized bool
+}
+
+// Rule compares an aggregate of the recent values of a field, or the ratio
+// of the aggregates of two fields, to a threshold.
+type Rule struct {
+	Name        string
+	Measurement string
+	Field       string
+
+	// When set, the value compared is the aggregate of Field divided by the
+	// aggregate of DivisorField.
+	DivisorMeasurement string
+	DivisorField       string
+
+	// Function aggregating the values of the window, one of "mean", "min",
+	// "max", "sum", "last" or "count".
+	Function  string
+	Operator  string
+	Threshold float64
+	Severity  string
+
+	// GroupBy are the tag keys the rule is evaluated for separately.
+	GroupBy []string `toml:"group_by"`
+
+	compare func(v, threshold float64) bool
+	groups  map[string]*group
+}
+
+// group holds the window of a rule for a set of tag values.
+type group struct {
+	tags     map[string]string
+	values   []sample
+	divisors []sample
+	firing   bool
+}
+
+type sample struct {
+	time  time.Time
+	value float64
+}
+
+var sampleConfig = `
+  ## Values older than window, relative to the most recent metric, are not
+  ## taken into account.
+  window = "1m"
+
+  ## Alert when the mean CPU usage of a host is over 90% for the window.
+  [[processors.alert.rule]]
+    name = "high_cpu"
+    measurement = "cpu"
+    field = "usage_user"
+    ## Aggregate of the values in the window: mean, min, max, sum, last or
+    ## count.
+    function = "mean"
+    ## Comparison with the threshold: >, >=, <, <=, == or !=
+    operator = ">"
+    threshold = 90.0
+    ## Value of the severity tag of the alerts.
+    severity = "critical"
+    ## Evaluate the rule separately for every value of these tags.
+    group_by = ["host"]
+
+  ## Alert when more than 5% of the requests fail: the sum of the errors
+  ## divided by the sum of the requests.
+  # [[processors.alert.rule]]
+  #   name = "error_ratio"
+  #   measurement = "http"
+  #   field = "errors"
+  #   divisor_measurement = "http"
+  #   divisor_field = "requests"
+  #   function = "sum"
+  #   operator = ">"
+  #   threshold = 0.05
+  #   severity = "warning"
+`
+
+func (a *Alert) SampleConfig() string {
+	return sampleConfig
+}
+
+func (a *Alert) Description() string {
+	return "Emit alerts when threshold or ratio rules are met by recent metrics."
+}
+
+func (a *Alert) init() {
+	if a.Window.Duration <= 0 {
+		a.Window.Duration = time.Minute
+	}
+
+	rules := a.Rules[:0]
+	for _, r := range a.Rules {
+		if err := r.init(); err != nil {
+			log.Printf("E! [processors.alert] rule %q disabled: %s", r.Name, err)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	a.Rules = rules
+	a.initialized = true
+}
+
+func (r *Rule) init() error {
+	switch r.Operator {
+	case ">":
+		r.compare = func(v, t float64) bool { return v > t }
+	case ">=":
+		r.compare = func(v, t float64) bool { return v >= t }
+	case "<":
+		r.compare = func(v, t float64) bool { return v < t }
+	case "<=":
+		r.compare = func(v, t float64) bool { return v <= t }
+	case "==":
+		r.compare = func(v, t float64) bool { return v == t }
+	case "!=":
+		r.compare = func(v, t float64) bool { return v != t }
+	default:
+		return fmt.Errorf("unknown operator %q", r.Operator)
+	}
+
+	if r.Function == "" {
+		r.Function = "mean"
+	}
+	if _, ok := aggregate(r.Function, []sample{{value: 1}}); !ok {
+		return fmt.Errorf("unknown function %q", r.Function)
+	}
+	if r.Name == "" || r.Measurement == "" || r.Field == "" {
+		return fmt.Errorf("name, measurement and field are required")
+	}
+	if r.DivisorField != "" && r.DivisorMeasurement == "" {
+		r.DivisorMeasurement = r.Measurement
+	}
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+	r.groups = make(map[string]*group)
+	return nil
+}
+
+func (a *Alert) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	if !a.initialized {
+		a.init()
+	}
+
+	var latest time.Time
+	for _, m := range in {
+		for _, r := range a.Rules {
+			r.add(m)
+		}
+		if m.Time().After(latest) {
+			latest = m.Time()
+		}
+	}
+	if latest.IsZero() {
+		return in
+	}
+
+	for _, r := range a.Rules {
+		in = append(in, r.evaluate(latest, a.Window.Duration)...)
+	}
+	return in
+}
+
+// add records the values of m the rule uses.
+func (r *Rule) add(m telegraf.Metric) {
+	var values, divisors bool
+	if m.Name() == r.Measurement {
+		_, values = m.Fields()[r.Field]
+	}
+	if r.DivisorField != "" && m.Name() == r.DivisorMeasurement {
+		_, divisors = m.Fields()[r.DivisorField]
+	}
+	if !values && !divisors {
+		return
+	}
+
+	g := r.group(m.Tags())
+	if values {
+		if v, ok := toFloat(m.Fields()[r.Field]); ok {
+			g.values = append(g.values, sample{m.Time(), v})
+		}
+	}
+	if divisors {
+		if v, ok := toFloat(m.Fields()[r.DivisorField]); ok {
+			g.divisors = append(g.divisors, sample{m.Time(), v})
+		}
+	}
+}
+
+func (r *Rule) group(tags map[string]string) *group {
+	keys := make([]string, 0, len(r.GroupBy))
+	groupTags := make(map[string]string, len(r.GroupBy))
+	for _, k := range r.GroupBy {
+		keys = append(keys, k+"="+tags[k])
+		if v, ok := tags[k]; ok {
+			groupTags[k] = v
+		}
+	}
+	sort.Strings(keys)
+	id := strings.Join(keys, ",")
+
+	g, ok := r.groups[id]
+	if !ok {
+		g = &group{tags: groupTags}
+		r.groups[id] = g
+	}
+	return g
+}
+
+// evaluate drops the values older than window before now and returns an
+// alert for every group whose state changed. The values are expected to
+// arrive in chronological order.
+func (r *Rule) evaluate(now time.Time, window time.Duration) []telegraf.Metric {
+	cutoff := now.Add(-window)
+	var alerts []telegraf.Metric
+	for id, g := range r.groups {
+		g.values = expire(g.values, cutoff)
+		g.divisors = expire(g.divisors, cutoff)
+
+		value, ok := aggregate(r.Function, g.values)
+		if ok && r.DivisorField != "" {
+			var divisor float64
+			divisor, ok = aggregate(r.Function, g.divisors)
+			ok = ok && divisor != 0
+			if ok {
+				value /= divisor
+			}
+		}
+
+		firing := ok && r.compare(value, r.Threshold)
+		if firing != g.firing {
+			g.firing = firing
+			if m, err := r.alert(g, value, firing, now); err == nil {
+				alerts = append(alerts, m)
+			}
+		}
+
+		// forget the groups that did not send anything for a whole window
+		if !g.firing && len(g.values) == 0 && len(g.divisors) == 0 {
+			delete(r.groups, id)
+		}
+	}
+	return alerts
+}
+
+func (r *Rule) alert(
+	g *group,
+	value float64,
+	firing bool,
+	now time.Time,
+) (telegraf.Metric, error) {
+	tags := map[string]string{
+		"rule":     r.Name,
+		"severity": r.Severity,
+	}
+	for k, v := range g.tags {
+		tags[k] = v
+	}
+	status := "resolved"
+	if firing {
+		status = "firing"
+	}
+	fields := map[string]interface{}{
+		"status":    status,
+		"threshold": r.Threshold,
+	}
+	if firing {
+		fields["value"] = value
+	}
+	return metric.New("alert", tags, fields, now)
+}
+
+func expire(samples []sample, cutoff time.Time) []sample {
+	i := 0
+	for i < len(samples) && samples[i].time.Before(cutoff) {
+		i++
+	}
+	return samples[i:]
+}
+
+// aggregate returns the function of the values, false if there are no
+// values or the function is unknown.
+func aggregate(function string, samples []sample) (float64, bool) {
+	if len(samples) == 0 {
+		return 0, false
+	}
+	switch function {
+	case "count":
+		return float64(len(samples)), true
+	case "last":
+		return samples[len(samples)-1].value, true
+	case "sum", "mean":
+		var sum float64
+		for _, s := range samples {
+			sum += s.value
+		}
+		if function == "mean" {
+			return sum / float64(len(samples)), true
+		}
+		return sum, true
+	case "min", "max":
+		v := samples[0].value
+		for _, s := range samples[1:] {
+			if (function == "min" && s.value < v) ||
+				(function == "max" && s.value > v) {
+				v = s.value
+			}
+		}
+		return v, true
+	}
+	return 0, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func init() {
+	processors.Add("alert", func() telegraf.Processor {
+		return &Alert{}
+	})
+}
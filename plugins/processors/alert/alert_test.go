@@ -0,0 +1,135 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Unix(1500000000, 0)
+
+func newMetric(
+	name string,
+	tags map[string]string,
+	fields map[string]interface{},
+	offset time.Duration,
+) telegraf.Metric {
+	m, _ := metric.New(name, tags, fields, start.Add(offset))
+	return m
+}
+
+// alerts returns the alerts in out, the other metrics are passed through.
+func alerts(t *testing.T, in []telegraf.Metric, out []telegraf.Metric) []telegraf.Metric {
+	require.True(t, len(out) >= len(in))
+	for i := range in {
+		require.Equal(t, in[i], out[i])
+	}
+	return out[len(in):]
+}
+
+func TestThreshold(t *testing.T) {
+	a := &Alert{
+		Window: internal.Duration{Duration: 30 * time.Second},
+		Rules: []*Rule{{
+			Name:        "high_cpu",
+			Measurement: "cpu",
+			Field:       "usage",
+			Operator:    ">",
+			Threshold:   80,
+			Severity:    "critical",
+			GroupBy:     []string{"host"},
+		}},
+	}
+
+	cpu := func(host string, usage float64, offset time.Duration) telegraf.Metric {
+		return newMetric("cpu", map[string]string{"host": host, "cpu": "all"},
+			map[string]interface{}{"usage": usage}, offset)
+	}
+
+	in := []telegraf.Metric{cpu("a", 70, 0), cpu("b", 50, 0)}
+	assert.Empty(t, alerts(t, in, a.Apply(in...)))
+
+	// mean of host a is (70+100)/2
+	in = []telegraf.Metric{cpu("a", 100, 10*time.Second), cpu("b", 60, 10*time.Second)}
+	out := alerts(t, in, a.Apply(in...))
+	require.Len(t, out, 1)
+	assert.Equal(t, "alert", out[0].Name())
+	assert.Equal(t, map[string]string{
+		"rule":     "high_cpu",
+		"severity": "critical",
+		"host":     "a",
+	}, out[0].Tags())
+	assert.Equal(t, map[string]interface{}{
+		"status":    "firing",
+		"value":     float64(85),
+		"threshold": float64(80),
+	}, out[0].Fields())
+
+	// still firing, no new alert
+	in = []telegraf.Metric{cpu("a", 90, 20*time.Second)}
+	assert.Empty(t, alerts(t, in, a.Apply(in...)))
+
+	// the values of the first two periods left the window
+	in = []telegraf.Metric{cpu("a", 10, 45*time.Second)}
+	out = alerts(t, in, a.Apply(in...))
+	require.Len(t, out, 1)
+	assert.Equal(t, "resolved", out[0].Fields()["status"])
+	assert.Equal(t, "a", out[0].Tags()["host"])
+}
+
+func TestRatio(t *testing.T) {
+	a := &Alert{
+		Rules: []*Rule{{
+			Name:               "error_ratio",
+			Measurement:        "http_errors",
+			Field:              "count",
+			DivisorMeasurement: "http_requests",
+			DivisorField:       "count",
+			Function:           "sum",
+			Operator:           ">=",
+			Threshold:          0.1,
+		}},
+	}
+
+	in := []telegraf.Metric{
+		newMetric("http_requests", nil, map[string]interface{}{"count": int64(100)}, 0),
+		newMetric("http_errors", nil, map[string]interface{}{"count": int64(5)}, 0),
+	}
+	assert.Empty(t, alerts(t, in, a.Apply(in...)))
+
+	// 20 errors for 200 requests
+	in = []telegraf.Metric{
+		newMetric("http_requests", nil, map[string]interface{}{"count": int64(100)}, time.Second),
+		newMetric("http_errors", nil, map[string]interface{}{"count": int64(15)}, time.Second),
+	}
+	out := alerts(t, in, a.Apply(in...))
+	require.Len(t, out, 1)
+	assert.Equal(t, map[string]string{
+		"rule":     "error_ratio",
+		"severity": "warning",
+	}, out[0].Tags())
+	assert.InDelta(t, 0.1, out[0].Fields()["value"], 0.0001)
+}
+
+func TestInvalidRule(t *testing.T) {
+	a := &Alert{
+		Rules: []*Rule{
+			{Name: "bad_operator", Measurement: "cpu", Field: "usage", Operator: "=>"},
+			{Name: "bad_function", Measurement: "cpu", Field: "usage", Operator: ">",
+				Function: "median"},
+			{Name: "ok", Measurement: "cpu", Field: "usage", Operator: ">"},
+		},
+	}
+
+	m := newMetric("cpu", nil, map[string]interface{}{"usage": 1.0}, 0)
+	out := a.Apply(m)
+	require.Len(t, a.Rules, 1)
+	assert.Equal(t, "ok", a.Rules[0].Name)
+	require.Len(t, out, 2)
+	assert.Equal(t, "firing", out[1].Fields()["status"])
+}
@@ -1,5 +1,17 @@
 package all
 
 import (
+	_ "github.com/influxdata/telegraf/plugins/processors/alert"
+	_ "github.com/influxdata/telegraf/plugins/processors/aws_metadata"
+	_ "github.com/influxdata/telegraf/plugins/processors/batch_sampler"
+	_ "github.com/influxdata/telegraf/plugins/processors/converter"
+	_ "github.com/influxdata/telegraf/plugins/processors/derivative"
+	_ "github.com/influxdata/telegraf/plugins/processors/enrich"
+	_ "github.com/influxdata/telegraf/plugins/processors/execd"
+	_ "github.com/influxdata/telegraf/plugins/processors/lag"
+	_ "github.com/influxdata/telegraf/plugins/processors/lua"
 	_ "github.com/influxdata/telegraf/plugins/processors/printer"
+	_ "github.com/influxdata/telegraf/plugins/processors/rebucket"
+	_ "github.com/influxdata/telegraf/plugins/processors/regex"
+	_ "github.com/influxdata/telegraf/plugins/processors/round"
 )
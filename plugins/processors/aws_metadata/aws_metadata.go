@@ -0,0 +1,353 @@
+package aws_metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	internalaws "github.com/influxdata/telegraf/internal/config/aws"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+const (
+	defaultIMDSEndpoint = "http://169.254.169.254"
+	// asgTag is the EC2 tag holding the name of the auto scaling group
+	asgTag = "aws:autoscaling:groupName"
+)
+
+// identityTags maps the tags available from the instance identity document
+// to its keys.
+var identityTags = map[string]string{
+	"instance_id":       "instanceId",
+	"instance_type":     "instanceType",
+	"availability_zone": "availabilityZone",
+	"region":            "region",
+	"account_id":        "accountId",
+	"image_id":          "imageId",
+	"private_ip":        "privateIp",
+}
+
+// taskTags maps the tags available from the ECS task metadata to its keys.
+var taskTags = map[string]string{
+	"cluster":           "Cluster",
+	"task_arn":          "TaskARN",
+	"task_family":       "Family",
+	"task_revision":     "Revision",
+	"availability_zone": "AvailabilityZone",
+}
+
+// AwsMetadata tags the metrics with the identity of the EC2 instance or ECS
+// task telegraf runs on. The metadata is looked up once and refreshed every
+// refresh_interval, the metrics are not delayed by more than the timeout.
+type AwsMetadata struct {
+	IMDSTags        []string `toml:"imds_tags"`
+	EC2Tags         []string `toml:"ec2_tags"`
+	ECSTags         []string `toml:"ecs_tags"`
+	RefreshInterval internal.Duration
+	RetryInterval   internal.Duration
+	Timeout         internal.Duration
+	Overwrite       bool
+
+	Region    string `toml:"region"`
+	AccessKey string `toml:"access_key"`
+	SecretKey string `toml:"secret_key"`
+	RoleARN   string `toml:"role_arn"`
+	Profile   string `toml:"profile"`
+	Filename  string `toml:"shared_credential_file"`
+	Token     string `toml:"token"`
+
+	imdsEndpoint string
+	ecsEndpoint  string
+	// describeTags returns the EC2 tags of an instance, it is replaced by
+	// the tests
+	describeTags func(region, instanceID string, keys []string) (map[string]string, error)
+	client       *http.Client
+
+	mu        sync.Mutex
+	tags      map[string]string
+	refreshed time.Time
+	failed    time.Time
+}
+
+var sampleConfig = `
+  ## Tags from the EC2 instance identity document: instance_id,
+  ## instance_type, availability_zone, region, account_id, image_id,
+  ## private_ip, and autoscaling_group which is read with the EC2 API.
+  imds_tags = ["instance_id", "instance_type", "availability_zone"]
+
+  ## EC2 tags of the instance to add, read with the ec2:DescribeTags API.
+  # ec2_tags = ["Name", "env"]
+
+  ## Tags from the ECS task metadata, when telegraf runs in an ECS task:
+  ## cluster, task_arn, task_family, task_revision, availability_zone.
+  # ecs_tags = ["cluster", "task_family"]
+
+  ## How often the metadata is looked up again.
+  # refresh_interval = "1h"
+  ## Minimum time between two lookups after a failure.
+  # retry_interval = "1m"
+  ## Timeout of the lookups, the metrics wait for them.
+  # timeout = "5s"
+
+  ## Replace the tags the metrics already have.
+  # overwrite = false
+
+  ## Amazon Credentials, only used for ec2_tags and autoscaling_group.
+  ## The region defaults to the region of the instance.
+  ## Credentials are loaded in the following order
+  ## 1) Assumed credentials via STS if role_arn is specified
+  ## 2) explicit credentials from 'access_key' and 'secret_key'
+  ## 3) shared profile from 'profile'
+  ## 4) environment variables
+  ## 5) shared credentials file
+  ## 6) EC2 Instance Profile
+  #access_key = ""
+  #secret_key = ""
+  #token = ""
+  #role_arn = ""
+  #profile = ""
+  #shared_credential_file = ""
+`
+
+func (a *AwsMetadata) SampleConfig() string {
+	return sampleConfig
+}
+
+func (a *AwsMetadata) Description() string {
+	return "Add tags from the AWS EC2 instance or ECS task metadata."
+}
+
+func (a *AwsMetadata) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	tags := a.lookup()
+	for _, m := range in {
+		for k, v := range tags {
+			if a.Overwrite || !m.HasTag(k) {
+				m.AddTag(k, v)
+			}
+		}
+	}
+	return in
+}
+
+// lookup returns the cached tags, refreshing them when they are stale. A
+// failed refresh keeps the previous tags and is not retried before the
+// retry interval.
+func (a *AwsMetadata) lookup() map[string]string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if a.tags != nil && now.Sub(a.refreshed) < a.RefreshInterval.Duration {
+		return a.tags
+	}
+	if !a.failed.IsZero() && now.Sub(a.failed) < a.RetryInterval.Duration {
+		return a.tags
+	}
+
+	tags, err := a.fetch()
+	if err != nil {
+		log.Printf("E! [processors.aws_metadata] Unable to look up metadata: %s", err)
+		a.failed = now
+		return a.tags
+	}
+	a.failed = time.Time{}
+	a.tags = tags
+	a.refreshed = now
+	return a.tags
+}
+
+func (a *AwsMetadata) fetch() (map[string]string, error) {
+	if a.client == nil {
+		a.client = &http.Client{Timeout: a.Timeout.Duration}
+	}
+	tags := make(map[string]string)
+
+	var ec2Keys []string
+	for _, t := range a.IMDSTags {
+		if t == "autoscaling_group" {
+			ec2Keys = append(ec2Keys, asgTag)
+		} else if _, ok := identityTags[t]; !ok {
+			return nil, fmt.Errorf("unknown imds tag %q", t)
+		}
+	}
+	for _, t := range a.ECSTags {
+		if _, ok := taskTags[t]; !ok {
+			return nil, fmt.Errorf("unknown ecs tag %q", t)
+		}
+	}
+	ec2Keys = append(ec2Keys, a.EC2Tags...)
+
+	if len(a.IMDSTags) > 0 || len(ec2Keys) > 0 {
+		doc, err := a.identityDocument()
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range a.IMDSTags {
+			if v, ok := doc[identityTags[t]].(string); ok && v != "" {
+				tags[t] = v
+			}
+		}
+
+		if len(ec2Keys) > 0 {
+			region := a.Region
+			if region == "" {
+				region, _ = doc["region"].(string)
+			}
+			id, _ := doc["instanceId"].(string)
+			ec2Tags, err := a.describeTags(region, id, ec2Keys)
+			if err != nil {
+				return nil, fmt.Errorf("unable to describe the tags of %s: %s", id, err)
+			}
+			for k, v := range ec2Tags {
+				if k == asgTag {
+					k = "autoscaling_group"
+				}
+				tags[k] = v
+			}
+		}
+	}
+
+	if len(a.ECSTags) > 0 {
+		task, err := a.taskMetadata()
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range a.ECSTags {
+			switch v := task[taskTags[t]].(type) {
+			case string:
+				if v != "" {
+					tags[t] = v
+				}
+			case float64:
+				tags[t] = fmt.Sprint(v)
+			}
+		}
+	}
+	return tags, nil
+}
+
+// identityDocument returns the instance identity document, using an IMDSv2
+// session token when the metadata service provides one.
+func (a *AwsMetadata) identityDocument() (map[string]interface{}, error) {
+	req, err := http.NewRequest("PUT", a.imdsEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	var token string
+	if resp, err := a.client.Do(req); err == nil {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			token = string(body)
+		}
+	}
+
+	req, err = http.NewRequest("GET",
+		a.imdsEndpoint+"/latest/dynamic/instance-identity/document", nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+	return a.getJSON(req)
+}
+
+// taskMetadata returns the metadata of the ECS task, its endpoint is set by
+// the ECS agent in the environment of the containers.
+func (a *AwsMetadata) taskMetadata() (map[string]interface{}, error) {
+	endpoint := a.ecsEndpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
+	}
+	if endpoint == "" {
+		endpoint = os.Getenv("ECS_CONTAINER_METADATA_URI")
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("ECS_CONTAINER_METADATA_URI is not set, " +
+			"telegraf is not running in an ECS task")
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(endpoint, "/")+"/task", nil)
+	if err != nil {
+		return nil, err
+	}
+	return a.getJSON(req)
+}
+
+func (a *AwsMetadata) getJSON(req *http.Request) (map[string]interface{}, error) {
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status code %d", req.URL, resp.StatusCode)
+	}
+
+	var v map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %s", req.URL, err)
+	}
+	return v, nil
+}
+
+func (a *AwsMetadata) ec2DescribeTags(region, instanceID string, keys []string) (map[string]string, error) {
+	credentialConfig := &internalaws.CredentialConfig{
+		Region:    region,
+		AccessKey: a.AccessKey,
+		SecretKey: a.SecretKey,
+		RoleARN:   a.RoleARN,
+		Profile:   a.Profile,
+		Filename:  a.Filename,
+		Token:     a.Token,
+	}
+	svc := ec2.New(credentialConfig.Credentials())
+
+	input := &ec2.DescribeTagsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("resource-id"),
+				Values: []*string{aws.String(instanceID)},
+			},
+			{
+				Name:   aws.String("key"),
+				Values: aws.StringSlice(keys),
+			},
+		},
+	}
+	tags := make(map[string]string)
+	err := svc.DescribeTagsPages(input, func(page *ec2.DescribeTagsOutput, lastPage bool) bool {
+		for _, t := range page.Tags {
+			tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+		}
+		return true
+	})
+	return tags, err
+}
+
+func init() {
+	processors.Add("aws_metadata", func() telegraf.Processor {
+		a := &AwsMetadata{
+			IMDSTags:        []string{"instance_id", "instance_type", "availability_zone"},
+			RefreshInterval: internal.Duration{Duration: time.Hour},
+			RetryInterval:   internal.Duration{Duration: time.Minute},
+			Timeout:         internal.Duration{Duration: 5 * time.Second},
+			imdsEndpoint:    defaultIMDSEndpoint,
+		}
+		a.describeTags = a.ec2DescribeTags
+		return a
+	})
+}
@@ -0,0 +1,157 @@
+package aws_metadata
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const identityDocument = `{
+  "accountId": "123456789012",
+  "availabilityZone": "eu-west-1a",
+  "imageId": "ami-12345678",
+  "instanceId": "i-0123456789abcdef0",
+  "instanceType": "c5.large",
+  "privateIp": "10.0.0.1",
+  "region": "eu-west-1"
+}`
+
+const taskMetadata = `{
+  "Cluster": "prod",
+  "TaskARN": "arn:aws:ecs:eu-west-1:123456789012:task/prod/abcd",
+  "Family": "api",
+  "Revision": "42"
+}`
+
+type fakeAWS struct {
+	server   *httptest.Server
+	requests int
+	fail     bool
+}
+
+func newFakeAWS(t *testing.T) *fakeAWS {
+	f := &fakeAWS{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.requests++
+		if f.fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/latest/api/token":
+			fmt.Fprint(w, "token")
+		case r.URL.Path == "/latest/dynamic/instance-identity/document":
+			assert.Equal(t, "token", r.Header.Get("X-aws-ec2-metadata-token"))
+			fmt.Fprint(w, identityDocument)
+		case r.URL.Path == "/ecs/task":
+			fmt.Fprint(w, taskMetadata)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return f
+}
+
+func newAwsMetadata(f *fakeAWS) *AwsMetadata {
+	return &AwsMetadata{
+		RefreshInterval: internal.Duration{Duration: time.Hour},
+		RetryInterval:   internal.Duration{Duration: time.Hour},
+		Timeout:         internal.Duration{Duration: time.Second},
+		imdsEndpoint:    f.server.URL,
+		ecsEndpoint:     f.server.URL + "/ecs",
+	}
+}
+
+func newMetric(tags map[string]string) telegraf.Metric {
+	m, _ := metric.New("cpu", tags, map[string]interface{}{"value": 1.0}, time.Now())
+	return m
+}
+
+func TestApply(t *testing.T) {
+	f := newFakeAWS(t)
+	defer f.server.Close()
+
+	a := newAwsMetadata(f)
+	a.IMDSTags = []string{"instance_id", "instance_type", "availability_zone", "autoscaling_group"}
+	a.EC2Tags = []string{"env"}
+	a.ECSTags = []string{"cluster", "task_family", "task_revision"}
+	a.describeTags = func(region, id string, keys []string) (map[string]string, error) {
+		assert.Equal(t, "eu-west-1", region)
+		assert.Equal(t, "i-0123456789abcdef0", id)
+		assert.Equal(t, []string{"aws:autoscaling:groupName", "env"}, keys)
+		return map[string]string{"aws:autoscaling:groupName": "api-asg", "env": "prod"}, nil
+	}
+
+	out := a.Apply(newMetric(map[string]string{"env": "staging"}))
+	require.Len(t, out, 1)
+	assert.Equal(t, map[string]string{
+		"instance_id":       "i-0123456789abcdef0",
+		"instance_type":     "c5.large",
+		"availability_zone": "eu-west-1a",
+		"autoscaling_group": "api-asg",
+		"env":               "staging",
+		"cluster":           "prod",
+		"task_family":       "api",
+		"task_revision":     "42",
+	}, out[0].Tags())
+
+	// the metadata is cached
+	requests := f.requests
+	a.Overwrite = true
+	out = a.Apply(newMetric(map[string]string{"env": "staging"}))
+	assert.Equal(t, "prod", out[0].Tags()["env"])
+	assert.Equal(t, requests, f.requests)
+}
+
+func TestApplyFailure(t *testing.T) {
+	f := newFakeAWS(t)
+	defer f.server.Close()
+
+	a := newAwsMetadata(f)
+	a.IMDSTags = []string{"instance_id"}
+	a.RefreshInterval.Duration = 0
+
+	out := a.Apply(newMetric(nil))
+	assert.Equal(t, "i-0123456789abcdef0", out[0].Tags()["instance_id"])
+
+	// the previous tags are kept when a refresh fails, and the lookups are
+	// rate limited
+	f.fail = true
+	requests := f.requests
+	out = a.Apply(newMetric(nil))
+	assert.Equal(t, "i-0123456789abcdef0", out[0].Tags()["instance_id"])
+	assert.NotEqual(t, requests, f.requests)
+	requests = f.requests
+	out = a.Apply(newMetric(nil))
+	assert.Equal(t, "i-0123456789abcdef0", out[0].Tags()["instance_id"])
+	assert.Equal(t, requests, f.requests)
+}
+
+func TestApplyNotOnAWS(t *testing.T) {
+	f := newFakeAWS(t)
+	defer f.server.Close()
+	f.fail = true
+
+	a := newAwsMetadata(f)
+	a.IMDSTags = []string{"instance_id"}
+	out := a.Apply(newMetric(map[string]string{"host": "a"}))
+	assert.Equal(t, map[string]string{"host": "a"}, out[0].Tags())
+}
+
+func TestUnknownTag(t *testing.T) {
+	f := newFakeAWS(t)
+	defer f.server.Close()
+
+	a := newAwsMetadata(f)
+	a.IMDSTags = []string{"hostname"}
+	_, err := a.fetch()
+	assert.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package batch_sampler
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+// maxBatches is the number of recent batches whose sampling decision is
+// remembered.
+const maxBatches = 1024
+
+// BatchSampler copies one batch of metrics out of N, a batch being the
+// metrics sharing a timestamp, as produced by a gather or a flush, so that
+// the metrics of a sampled batch are consistent with each other.
+type BatchSampler struct {
+	N         int
+	Precision internal.Duration
+	BatchTags []string
+	TagKey    string
+	TagValue  string
+
+	// count is the number of batches seen
+	count uint64
+	// sampled holds the decision of the recent batches, keys is their order
+	sampled map[string]bool
+	keys    []string
+}
+
+var sampleConfig = `
+  ## Copy one batch out of n.
+  n = 100
+
+  ## A batch is the set of metrics sharing a timestamp truncated to
+  ## precision, and the values of batch_tags. Inputs and aggregators give the
+  ## same timestamp to the metrics of a gather or a period, with the
+  ## precision of the agent.
+  # precision = "1s"
+  # batch_tags = ["host"]
+
+  ## The copies carry this tag, route them with tagpass/tagdrop:
+  ##   [[outputs.file]]
+  ##     [outputs.file.tagpass]
+  ##       sampled = ["true"]
+  ## and set a tagdrop on the other outputs.
+  # tag_key = "sampled"
+  # tag_value = "true"
+`
+
+func (b *BatchSampler) SampleConfig() string {
+	return sampleConfig
+}
+
+func (b *BatchSampler) Description() string {
+	return "Copy one batch of metrics out of N, tagged, for debugging."
+}
+
+func (b *BatchSampler) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	if b.N <= 0 {
+		return in
+	}
+	if b.sampled == nil {
+		b.sampled = make(map[string]bool)
+	}
+
+	out := in
+	for _, m := range in {
+		if !b.isSampled(m) {
+			continue
+		}
+		c := m.Copy()
+		c.AddTag(b.TagKey, b.TagValue)
+		out = append(out, c)
+	}
+	return out
+}
+
+// isSampled returns whether the batch of m is sampled, deciding it when m
+// is the first metric of its batch.
+func (b *BatchSampler) isSampled(m telegraf.Metric) bool {
+	key := b.batchKey(m)
+	if sampled, ok := b.sampled[key]; ok {
+		return sampled
+	}
+
+	sampled := b.count%uint64(b.N) == 0
+	b.count++
+	b.sampled[key] = sampled
+	b.keys = append(b.keys, key)
+	if len(b.keys) > maxBatches {
+		delete(b.sampled, b.keys[0])
+		b.keys = b.keys[1:]
+	}
+	return sampled
+}
+
+func (b *BatchSampler) batchKey(m telegraf.Metric) string {
+	t := m.Time()
+	if b.Precision.Duration > 0 {
+		t = t.Truncate(b.Precision.Duration)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(strconv.FormatInt(t.UnixNano(), 10))
+	tags := m.Tags()
+	for _, k := range b.BatchTags {
+		buf.WriteByte(0)
+		buf.WriteString(tags[k])
+	}
+	return buf.String()
+}
+
+func init() {
+	processors.Add("batch_sampler", func() telegraf.Processor {
+		return &BatchSampler{
+			N:         100,
+			Precision: internal.Duration{Duration: time.Second},
+			TagKey:    "sampled",
+			TagValue:  "true",
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package batch_sampler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Unix(1500000000, 0)
+
+func newMetric(name string, tags map[string]string, offset time.Duration) telegraf.Metric {
+	m, _ := metric.New(name, tags, map[string]interface{}{"value": int64(1)},
+		start.Add(offset))
+	return m
+}
+
+func newSampler(n int) *BatchSampler {
+	return &BatchSampler{
+		N:         n,
+		Precision: internal.Duration{Duration: time.Second},
+		TagKey:    "sampled",
+		TagValue:  "true",
+	}
+}
+
+// sampled returns the copies in out, the other metrics are passed through.
+func sampled(t *testing.T, in []telegraf.Metric, out []telegraf.Metric) []telegraf.Metric {
+	require.True(t, len(out) >= len(in))
+	for i := range in {
+		require.Equal(t, in[i], out[i])
+		assert.False(t, out[i].HasTag("sampled"))
+	}
+	for _, m := range out[len(in):] {
+		assert.Equal(t, "true", m.Tags()["sampled"])
+	}
+	return out[len(in):]
+}
+
+func TestWholeBatches(t *testing.T) {
+	b := newSampler(2)
+
+	var copies []telegraf.Metric
+	for i := 0; i < 4; i++ {
+		// the metrics of a gather, processed one at a time
+		for _, name := range []string{"cpu", "mem", "disk"} {
+			in := []telegraf.Metric{
+				newMetric(name, nil, time.Duration(i)*10*time.Second+time.Duration(i)*time.Millisecond),
+			}
+			copies = append(copies, sampled(t, in, b.Apply(in...))...)
+		}
+	}
+
+	// batches 0 and 2 are copied entirely
+	require.Len(t, copies, 6)
+	for i, m := range copies {
+		batch := i / 3
+		assert.Equal(t, start.Add(time.Duration(batch*2)*10*time.Second), m.Time().Truncate(time.Second))
+	}
+	assert.Equal(t, "cpu", copies[0].Name())
+	assert.Equal(t, "disk", copies[5].Name())
+}
+
+func TestBatchTags(t *testing.T) {
+	b := newSampler(2)
+	b.BatchTags = []string{"host"}
+
+	in := []telegraf.Metric{
+		newMetric("cpu", map[string]string{"host": "a"}, 0),
+		newMetric("cpu", map[string]string{"host": "b"}, 0),
+		newMetric("mem", map[string]string{"host": "a"}, 0),
+		newMetric("mem", map[string]string{"host": "b"}, 0),
+	}
+	copies := sampled(t, in, b.Apply(in...))
+	require.Len(t, copies, 2)
+	for _, m := range copies {
+		assert.Equal(t, "a", m.Tags()["host"])
+	}
+}
+
+func TestForget(t *testing.T) {
+	b := newSampler(1)
+	for i := 0; i < maxBatches+10; i++ {
+		in := []telegraf.Metric{newMetric("cpu", nil, time.Duration(i)*time.Second)}
+		require.Len(t, sampled(t, in, b.Apply(in...)), 1)
+	}
+	assert.Len(t, b.sampled, maxBatches)
+	assert.Len(t, b.keys, maxBatches)
+}
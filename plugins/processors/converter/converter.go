@@ -0,0 +1,279 @@
+package converter
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+// Conversion lists the keys, globs are supported, converted to each type.
+type Conversion struct {
+	Tag     []string `toml:"tag"`
+	String  []string `toml:"string"`
+	Integer []string `toml:"integer"`
+	Boolean []string `toml:"boolean"`
+	Float   []string `toml:"float"`
+}
+
+// Converter converts tags to fields and the types of fields, or fields to
+// tags.
+type Converter struct {
+	Tags   *Conversion `toml:"tags"`
+	Fields *Conversion `toml:"fields"`
+
+	initialized bool
+	tagRules    []rule
+	fieldRules  []rule
+}
+
+// rule converts the keys matching filter to a type.
+type rule struct {
+	filter filter.Filter
+	to     string
+}
+
+var sampleConfig = `
+  ## Tags to convert to fields of the given type, globs are supported. The
+  ## tags whose value cannot be converted are kept.
+  [processors.converter.tags]
+    string = []
+    integer = []
+    boolean = []
+    float = []
+
+  ## Fields to convert to tags, or to another type. The fields whose value
+  ## cannot be converted are removed. The first matching type is used, in
+  ## the order tag, string, integer, boolean and float.
+  [processors.converter.fields]
+    tag = []
+    string = []
+    integer = []
+    boolean = []
+    float = []
+`
+
+func (c *Converter) SampleConfig() string {
+	return sampleConfig
+}
+
+func (c *Converter) Description() string {
+	return "Convert tags to fields and fields to tags, or change the type of fields."
+}
+
+func (c *Converter) init() {
+	c.initialized = true
+	c.tagRules = compile("tags", c.Tags)
+	c.fieldRules = compile("fields", c.Fields)
+}
+
+// compile returns the rules of a conversion, in order of precedence.
+func compile(section string, conv *Conversion) []rule {
+	if conv == nil {
+		return nil
+	}
+	var rules []rule
+	for _, r := range []struct {
+		to   string
+		keys []string
+	}{
+		{"tag", conv.Tag},
+		{"string", conv.String},
+		{"integer", conv.Integer},
+		{"boolean", conv.Boolean},
+		{"float", conv.Float},
+	} {
+		if len(r.keys) == 0 {
+			continue
+		}
+		f, err := filter.Compile(r.keys)
+		if err != nil {
+			log.Printf("E! [processors.converter] invalid %s %s %v, ignored: %s",
+				section, r.to, r.keys, err)
+			continue
+		}
+		rules = append(rules, rule{filter: f, to: r.to})
+	}
+	return rules
+}
+
+func (c *Converter) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	if !c.initialized {
+		c.init()
+	}
+	for i, m := range in {
+		if converted := c.convert(m); converted != nil {
+			in[i] = converted
+		}
+	}
+	return in
+}
+
+// convert returns the converted copy of m, or nil if nothing changed.
+func (c *Converter) convert(m telegraf.Metric) telegraf.Metric {
+	tags := m.Tags()
+	fields := m.Fields()
+	changed := false
+
+	for k, v := range m.Tags() {
+		to, ok := match(c.tagRules, k)
+		if !ok || to == "tag" {
+			continue
+		}
+		fv, ok := convertValue(v, to)
+		if !ok {
+			log.Printf("D! [processors.converter] could not convert tag %s=%q "+
+				"to %s", k, v, to)
+			continue
+		}
+		delete(tags, k)
+		fields[k] = fv
+		changed = true
+	}
+
+	for k, v := range m.Fields() {
+		to, ok := match(c.fieldRules, k)
+		if !ok {
+			continue
+		}
+		changed = true
+		delete(fields, k)
+		if to == "tag" {
+			tags[k] = fmt.Sprint(v)
+			continue
+		}
+		fv, ok := convertValue(v, to)
+		if !ok {
+			log.Printf("D! [processors.converter] could not convert field %s=%v "+
+				"to %s, removing it", k, v, to)
+			continue
+		}
+		fields[k] = fv
+	}
+
+	if !changed {
+		return nil
+	}
+	if len(fields) == 0 {
+		log.Printf("D! [processors.converter] %s has no field left, keeping it "+
+			"unchanged", m.Name())
+		return nil
+	}
+	out, err := metric.New(m.Name(), tags, fields, m.Time(), m.Type())
+	if err != nil {
+		log.Printf("E! [processors.converter] could not convert %s: %s",
+			m.Name(), err)
+		return nil
+	}
+	return out
+}
+
+func match(rules []rule, key string) (string, bool) {
+	for _, r := range rules {
+		if r.filter.Match(key) {
+			return r.to, true
+		}
+	}
+	return "", false
+}
+
+func convertValue(v interface{}, to string) (interface{}, bool) {
+	switch to {
+	case "string":
+		switch v := v.(type) {
+		case string:
+			return v, true
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		default:
+			return fmt.Sprint(v), true
+		}
+	case "integer":
+		return toInteger(v)
+	case "boolean":
+		return toBoolean(v)
+	case "float":
+		return toFloat(v)
+	}
+	return nil, false
+}
+
+func toInteger(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, false
+		}
+		return int64(v), true
+	case float64:
+		if math.IsNaN(v) || v >= math.MaxInt64 || v < math.MinInt64 {
+			return nil, false
+		}
+		return int64(v), true
+	case bool:
+		if v {
+			return int64(1), true
+		}
+		return int64(0), true
+	case string:
+		if i, err := strconv.ParseInt(v, 0, 64); err == nil {
+			return i, true
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return toInteger(f)
+		}
+	}
+	return nil, false
+}
+
+func toFloat(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		if v {
+			return float64(1), true
+		}
+		return float64(0), true
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func toBoolean(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case int64:
+		return v != 0, true
+	case uint64:
+		return v != 0, true
+	case float64:
+		return v != 0, true
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+func init() {
+	processors.Add("converter", func() telegraf.Processor {
+		return &Converter{}
+	})
+}
@@ -0,0 +1,87 @@
+package converter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMetric(tags map[string]string, fields map[string]interface{}) telegraf.Metric {
+	m, _ := metric.New("app", tags, fields, time.Unix(1500000000, 0))
+	return m
+}
+
+func TestFieldTypes(t *testing.T) {
+	c := &Converter{
+		Fields: &Conversion{
+			String:  []string{"code"},
+			Integer: []string{"count_*", "bad_int"},
+			Boolean: []string{"enabled"},
+			Float:   []string{"*"},
+		},
+	}
+
+	out := c.Apply(newMetric(nil, map[string]interface{}{
+		"code":        int64(404),
+		"count_a":     "42",
+		"count_b":     float64(3.9),
+		"count_c":     true,
+		"bad_int":     "abc",
+		"enabled":     "true",
+		"latency":     "1.5",
+		"temperature": int64(20),
+	}))
+	require.Len(t, out, 1)
+	assert.Equal(t, map[string]interface{}{
+		"code":        "404",
+		"count_a":     int64(42),
+		"count_b":     int64(3),
+		"count_c":     int64(1),
+		"enabled":     true,
+		"latency":     float64(1.5),
+		"temperature": float64(20),
+	}, out[0].Fields())
+}
+
+func TestTagsAndFields(t *testing.T) {
+	c := &Converter{
+		Tags: &Conversion{
+			Integer: []string{"port"},
+			String:  []string{"version"},
+		},
+		Fields: &Conversion{
+			Tag: []string{"status"},
+		},
+	}
+
+	out := c.Apply(newMetric(
+		map[string]string{"host": "a", "port": "8080", "version": "1.2"},
+		map[string]interface{}{"status": int64(200), "value": float64(1)},
+	))
+	assert.Equal(t, map[string]string{"host": "a", "status": "200"}, out[0].Tags())
+	assert.Equal(t, map[string]interface{}{
+		"port":    int64(8080),
+		"version": "1.2",
+		"value":   float64(1),
+	}, out[0].Fields())
+
+	// the tags which cannot be converted are kept
+	out = c.Apply(newMetric(
+		map[string]string{"port": "http"},
+		map[string]interface{}{"value": float64(1)},
+	))
+	assert.Equal(t, map[string]string{"port": "http"}, out[0].Tags())
+}
+
+func TestNoFieldLeft(t *testing.T) {
+	c := &Converter{
+		Fields: &Conversion{Tag: []string{"*"}},
+	}
+	m := newMetric(nil, map[string]interface{}{"value": "x"})
+	out := c.Apply(m)
+	assert.Equal(t, m, out[0])
+}
@@ -0,0 +1,243 @@
+package derivative
+
+import (
+	"log"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+// Derivative converts counter fields to rates: the difference with the
+// previous value of the field in the same series, divided by the time
+// elapsed.
+type Derivative struct {
+	Fields      []string `toml:"fields"`
+	Suffix      string   `toml:"suffix"`
+	Unit        internal.Duration
+	MaxInterval internal.Duration
+
+	fieldFilter filter.Filter
+	initialized bool
+	// last holds the previous value of the counters, by series and field
+	last map[uint64]map[string]sample
+	// pruned is the time of the last removal of the stale series
+	pruned time.Time
+}
+
+type sample struct {
+	// value is a float64, int64 or uint64
+	value interface{}
+	t     time.Time
+}
+
+var sampleConfig = `
+  ## Fields converted to rates, globs are supported. Restrict the
+  ## measurements with namepass.
+  fields = ["*_total"]
+  # namepass = ["nginx", "net"]
+
+  ## Suffix of the rate fields, which are added next to the counters. If
+  ## empty, the counters are replaced by their rate, and the first value of
+  ## each counter is dropped.
+  # suffix = "_rate"
+
+  ## Rates are per unit of time.
+  # unit = "1s"
+
+  ## If the previous value of a counter is older than max_interval, no rate
+  ## is computed and the series is forgotten once stale. 0 is unlimited.
+  # max_interval = "5m"
+`
+
+func (d *Derivative) SampleConfig() string {
+	return sampleConfig
+}
+
+func (d *Derivative) Description() string {
+	return "Convert counter fields to per-second rates."
+}
+
+func (d *Derivative) init() {
+	d.initialized = true
+	d.last = make(map[uint64]map[string]sample)
+	f, err := filter.Compile(d.Fields)
+	if err != nil {
+		log.Printf("E! [processors.derivative] invalid fields %v, no rate "+
+			"computed: %s", d.Fields, err)
+		return
+	}
+	d.fieldFilter = f
+}
+
+func (d *Derivative) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	if !d.initialized {
+		d.init()
+	}
+	if d.fieldFilter == nil {
+		return in
+	}
+
+	out := in[:0]
+	for _, m := range in {
+		if m, ok := d.convert(m); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// convert returns m with the rates of its counters, or false if it has no
+// field left.
+func (d *Derivative) convert(m telegraf.Metric) (telegraf.Metric, bool) {
+	fields := m.Fields()
+	id := m.HashID()
+	t := m.Time()
+	d.prune(t)
+
+	// the rate fields must not be matched
+	var counters []string
+	for k := range fields {
+		if d.fieldFilter.Match(k) {
+			counters = append(counters, k)
+		}
+	}
+
+	changed := false
+	for _, k := range counters {
+		value := fields[k]
+		if _, ok := convert(value); !ok {
+			continue
+		}
+
+		rate, ok := d.rate(id, k, value, t)
+		if d.Suffix == "" {
+			delete(fields, k)
+			changed = true
+		}
+		if ok {
+			fields[k+d.Suffix] = rate
+			changed = true
+		}
+	}
+	if !changed {
+		return m, true
+	}
+	if len(fields) == 0 {
+		return nil, false
+	}
+
+	out, err := metric.New(m.Name(), m.Tags(), fields, t, m.Type())
+	if err != nil {
+		log.Printf("E! [processors.derivative] could not add the rates to %s: %s",
+			m.Name(), err)
+		return m, true
+	}
+	return out, true
+}
+
+// rate records the value of a counter and returns its rate since the
+// previous value. There is no rate for the first value, after a reset of
+// the counter, or when the previous value is too old.
+func (d *Derivative) rate(id uint64, field string, value interface{}, t time.Time) (float64, bool) {
+	series, ok := d.last[id]
+	if !ok {
+		series = make(map[string]sample)
+		d.last[id] = series
+	}
+	prev, ok := series[field]
+	if ok && !t.After(prev.t) {
+		// out of order or duplicate value
+		return 0, false
+	}
+	series[field] = sample{value: value, t: t}
+
+	if !ok {
+		return 0, false
+	}
+	diff, ok := delta(prev.value, value)
+	if !ok {
+		return 0, false
+	}
+	elapsed := t.Sub(prev.t)
+	if d.MaxInterval.Duration > 0 && elapsed > d.MaxInterval.Duration {
+		return 0, false
+	}
+	unit := d.Unit.Duration
+	if unit <= 0 {
+		unit = time.Second
+	}
+	return diff * float64(unit) / float64(elapsed), true
+}
+
+// delta returns the increase of a counter, false if it decreased. Integers
+// are subtracted before being converted, which would lose the low digits of
+// the large counters.
+func delta(prev, cur interface{}) (float64, bool) {
+	switch c := cur.(type) {
+	case uint64:
+		if p, ok := prev.(uint64); ok {
+			if c < p {
+				return 0, false
+			}
+			return float64(c - p), true
+		}
+	case int64:
+		if p, ok := prev.(int64); ok {
+			if c < p {
+				return 0, false
+			}
+			return float64(uint64(c) - uint64(p)), true
+		}
+	}
+	p, _ := convert(prev)
+	v, _ := convert(cur)
+	if v < p {
+		return 0, false
+	}
+	return v - p, true
+}
+
+// prune forgets the series with no value since max_interval, at most once
+// per max_interval.
+func (d *Derivative) prune(now time.Time) {
+	if d.MaxInterval.Duration <= 0 || now.Sub(d.pruned) < d.MaxInterval.Duration {
+		return
+	}
+	d.pruned = now
+	for id, series := range d.last {
+		for field, s := range series {
+			if now.Sub(s.t) > d.MaxInterval.Duration {
+				delete(series, field)
+			}
+		}
+		if len(series) == 0 {
+			delete(d.last, id)
+		}
+	}
+}
+
+func convert(in interface{}) (float64, bool) {
+	switch v := in.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	processors.Add("derivative", func() telegraf.Processor {
+		return &Derivative{
+			Suffix: "_rate",
+			Unit:   internal.Duration{Duration: time.Second},
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package derivative
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Unix(1500000000, 0)
+
+func newMetric(host string, offset time.Duration, fields map[string]interface{}) telegraf.Metric {
+	m, _ := metric.New("net", map[string]string{"host": host}, fields,
+		start.Add(offset))
+	return m
+}
+
+func newDerivative() *Derivative {
+	return &Derivative{
+		Fields: []string{"*_total"},
+		Suffix: "_rate",
+		Unit:   internal.Duration{Duration: time.Second},
+	}
+}
+
+func TestRate(t *testing.T) {
+	d := newDerivative()
+
+	out := d.Apply(newMetric("a", 0, map[string]interface{}{
+		"bytes_total": int64(1000), "errors_total": int64(1), "up": true,
+	}))
+	require.Len(t, out, 1)
+	assert.Equal(t, map[string]interface{}{
+		"bytes_total": int64(1000), "errors_total": int64(1), "up": true,
+	}, out[0].Fields())
+
+	out = d.Apply(
+		newMetric("a", 10*time.Second, map[string]interface{}{
+			"bytes_total": int64(3000), "errors_total": int64(6), "up": true,
+		}),
+		// another series
+		newMetric("b", 10*time.Second, map[string]interface{}{
+			"bytes_total": int64(5000),
+		}),
+	)
+	require.Len(t, out, 2)
+	assert.Equal(t, map[string]interface{}{
+		"bytes_total":       int64(3000),
+		"bytes_total_rate":  float64(200),
+		"errors_total":      int64(6),
+		"errors_total_rate": float64(0.5),
+		"up":                true,
+	}, out[0].Fields())
+	assert.Equal(t, map[string]interface{}{"bytes_total": int64(5000)}, out[1].Fields())
+}
+
+func TestCounterReset(t *testing.T) {
+	d := newDerivative()
+	d.Apply(newMetric("a", 0, map[string]interface{}{"bytes_total": int64(1000)}))
+	out := d.Apply(newMetric("a", 10*time.Second, map[string]interface{}{"bytes_total": int64(10)}))
+	assert.Equal(t, map[string]interface{}{"bytes_total": int64(10)}, out[0].Fields())
+
+	out = d.Apply(newMetric("a", 20*time.Second, map[string]interface{}{"bytes_total": int64(110)}))
+	assert.Equal(t, float64(10), out[0].Fields()["bytes_total_rate"])
+}
+
+func TestUnsigned(t *testing.T) {
+	d := newDerivative()
+	d.Apply(newMetric("a", 0, map[string]interface{}{"bytes_total": uint64(1 << 62)}))
+	out := d.Apply(newMetric("a", 10*time.Second,
+		map[string]interface{}{"bytes_total": uint64(1<<62 + 100)}))
+	// the delta is exact, float64(1<<62 + 100) is 1<<62
+	assert.Equal(t, float64(10), out[0].Fields()["bytes_total_rate"])
+
+	// counter reset
+	out = d.Apply(newMetric("a", 20*time.Second, map[string]interface{}{"bytes_total": uint64(10)}))
+	assert.Equal(t, map[string]interface{}{"bytes_total": uint64(10)}, out[0].Fields())
+}
+
+func TestReplace(t *testing.T) {
+	d := newDerivative()
+	d.Suffix = ""
+	d.Unit = internal.Duration{Duration: time.Minute}
+
+	out := d.Apply(
+		newMetric("a", 0, map[string]interface{}{"bytes_total": int64(1000)}),
+		newMetric("b", 0, map[string]interface{}{"bytes_total": int64(1000), "up": true}),
+	)
+	// the metrics without rate are dropped
+	require.Len(t, out, 1)
+	assert.Equal(t, map[string]interface{}{"up": true}, out[0].Fields())
+
+	out = d.Apply(newMetric("a", 30*time.Second, map[string]interface{}{"bytes_total": int64(1600)}))
+	require.Len(t, out, 1)
+	assert.Equal(t, map[string]interface{}{"bytes_total": float64(1200)}, out[0].Fields())
+}
+
+func TestMaxInterval(t *testing.T) {
+	d := newDerivative()
+	d.MaxInterval = internal.Duration{Duration: time.Minute}
+
+	d.Apply(newMetric("a", 0, map[string]interface{}{"bytes_total": int64(1000)}))
+	d.Apply(newMetric("b", 0, map[string]interface{}{"bytes_total": int64(1000)}))
+	out := d.Apply(newMetric("a", 2*time.Minute, map[string]interface{}{"bytes_total": int64(2000)}))
+	assert.False(t, out[0].HasField("bytes_total_rate"))
+	// the stale series are forgotten
+	assert.Len(t, d.last, 1)
+
+	out = d.Apply(newMetric("a", 150*time.Second, map[string]interface{}{"bytes_total": int64(2300)}))
+	assert.Equal(t, float64(10), out[0].Fields()["bytes_total_rate"])
+}
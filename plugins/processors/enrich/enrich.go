@@ -0,0 +1,233 @@
+package enrich
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+// Enrich adds the tags of the row of a lookup table matching the value of
+// a tag of the metrics. The table is read from a CSV or JSON file, which is
+// read again when it changes.
+type Enrich struct {
+	File           string   `toml:"file"`
+	Format         string   `toml:"format"`
+	KeyTag         string   `toml:"key_tag"`
+	KeyColumn      string   `toml:"key_column"`
+	Tags           []string `toml:"tags"`
+	ReloadInterval internal.Duration
+	Overwrite      bool
+
+	mu sync.Mutex
+	// table maps the values of the key tag to the tags to add
+	table   map[string]map[string]string
+	modTime time.Time
+	checked time.Time
+}
+
+var sampleConfig = `
+  ## Lookup table, a CSV file with a header line or a JSON object mapping the
+  ## keys to objects of tags:
+  ##   {"web01": {"datacenter": "dc1", "rack": "r12", "team": "frontend"}}
+  file = "/etc/telegraf/hosts.csv"
+
+  ## Format of the file, "csv" or "json", by default the extension of the
+  ## file.
+  # format = "csv"
+
+  ## Tag of the metrics matched against the keys of the table.
+  key_tag = "host"
+
+  ## Column of the CSV file holding the keys, by default key_tag.
+  # key_column = "host"
+
+  ## Tags to add, by default all the columns of the row.
+  # tags = ["datacenter", "rack", "team"]
+
+  ## How often the modification time of the file is checked, the table is
+  ## read again when it changed.
+  # reload_interval = "1m"
+
+  ## Replace the tags the metrics already have.
+  # overwrite = false
+`
+
+func (e *Enrich) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *Enrich) Description() string {
+	return "Add tags from a lookup table keyed on a tag."
+}
+
+func (e *Enrich) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	table := e.lookupTable()
+	for _, m := range in {
+		key, ok := m.Tags()[e.KeyTag]
+		if !ok {
+			continue
+		}
+		for k, v := range table[key] {
+			if e.Overwrite || !m.HasTag(k) {
+				m.AddTag(k, v)
+			}
+		}
+	}
+	return in
+}
+
+// lookupTable returns the table, reading the file again when its
+// modification time changed. A file that cannot be read keeps the previous
+// table.
+func (e *Enrich) lookupTable() map[string]map[string]string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	if e.table != nil && now.Sub(e.checked) < e.ReloadInterval.Duration {
+		return e.table
+	}
+	e.checked = now
+
+	info, err := os.Stat(e.File)
+	if err != nil {
+		log.Printf("E! [processors.enrich] Unable to read the lookup table: %s", err)
+		return e.table
+	}
+	if e.table != nil && info.ModTime().Equal(e.modTime) {
+		return e.table
+	}
+
+	table, err := e.load()
+	if err != nil {
+		log.Printf("E! [processors.enrich] Unable to read the lookup table %s: %s",
+			e.File, err)
+		return e.table
+	}
+	e.table = table
+	e.modTime = info.ModTime()
+	return e.table
+}
+
+func (e *Enrich) load() (map[string]map[string]string, error) {
+	f, err := os.Open(e.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	format := e.Format
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(e.File), ".")
+	}
+	var table map[string]map[string]string
+	switch format {
+	case "csv":
+		table, err = e.loadCSV(f)
+	case "json":
+		table, err = loadJSON(f)
+	default:
+		return nil, fmt.Errorf("unknown format %q, must be csv or json", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(e.Tags) > 0 {
+		for key, tags := range table {
+			kept := make(map[string]string, len(e.Tags))
+			for _, k := range e.Tags {
+				if v, ok := tags[k]; ok {
+					kept[k] = v
+				}
+			}
+			table[key] = kept
+		}
+	}
+	return table, nil
+}
+
+func (e *Enrich) loadCSV(r io.Reader) (map[string]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the header: %s", err)
+	}
+	keyColumn := e.KeyColumn
+	if keyColumn == "" {
+		keyColumn = e.KeyTag
+	}
+	key := -1
+	for i, name := range header {
+		if name == keyColumn {
+			key = i
+		}
+	}
+	if key == -1 {
+		return nil, fmt.Errorf("no %q column", keyColumn)
+	}
+
+	table := make(map[string]map[string]string)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return table, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		tags := make(map[string]string, len(record)-1)
+		for i, v := range record {
+			if i != key && v != "" {
+				tags[header[i]] = v
+			}
+		}
+		table[record[key]] = tags
+	}
+}
+
+func loadJSON(r io.Reader) (map[string]map[string]string, error) {
+	var raw map[string]map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	table := make(map[string]map[string]string, len(raw))
+	for key, values := range raw {
+		tags := make(map[string]string, len(values))
+		for k, v := range values {
+			switch v := v.(type) {
+			case string:
+				if v != "" {
+					tags[k] = v
+				}
+			case float64, bool:
+				tags[k] = fmt.Sprint(v)
+			}
+		}
+		table[key] = tags
+	}
+	return table, nil
+}
+
+func init() {
+	processors.Add("enrich", func() telegraf.Processor {
+		return &Enrich{
+			KeyTag:         "host",
+			ReloadInterval: internal.Duration{Duration: time.Minute},
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package enrich
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const hostsCSV = `host,datacenter,rack,team
+# comments are ignored
+web01,dc1,r12,frontend
+db01,dc2,,storage
+`
+
+const hostsJSON = `{
+  "web01": {"datacenter": "dc1", "rack": "r12", "team": "frontend"},
+  "db01": {"datacenter": "dc2", "rack": 7}
+}`
+
+func newMetric(tags map[string]string) telegraf.Metric {
+	m, _ := metric.New("cpu", tags, map[string]interface{}{"usage": 0.5},
+		time.Unix(1500000000, 0))
+	return m
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "enrich")
+	require.NoError(t, err)
+	return dir
+}
+
+func TestCSV(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	e := &Enrich{
+		File:   writeFile(t, dir, "hosts.csv", hostsCSV),
+		KeyTag: "host",
+	}
+	out := e.Apply(
+		newMetric(map[string]string{"host": "web01"}),
+		newMetric(map[string]string{"host": "db01", "team": "dba"}),
+		newMetric(map[string]string{"host": "unknown"}),
+		newMetric(nil),
+	)
+	assert.Equal(t, map[string]string{
+		"host": "web01", "datacenter": "dc1", "rack": "r12", "team": "frontend",
+	}, out[0].Tags())
+	assert.Equal(t, map[string]string{
+		"host": "db01", "datacenter": "dc2", "team": "dba",
+	}, out[1].Tags())
+	assert.Equal(t, map[string]string{"host": "unknown"}, out[2].Tags())
+	assert.Equal(t, map[string]string{}, out[3].Tags())
+}
+
+func TestJSON(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	e := &Enrich{
+		File:      writeFile(t, dir, "hosts.txt", hostsJSON),
+		Format:    "json",
+		KeyTag:    "host",
+		Tags:      []string{"datacenter", "rack"},
+		Overwrite: true,
+	}
+	out := e.Apply(
+		newMetric(map[string]string{"host": "web01", "rack": "old"}),
+		newMetric(map[string]string{"host": "db01"}),
+	)
+	assert.Equal(t, map[string]string{
+		"host": "web01", "datacenter": "dc1", "rack": "r12",
+	}, out[0].Tags())
+	assert.Equal(t, map[string]string{
+		"host": "db01", "datacenter": "dc2", "rack": "7",
+	}, out[1].Tags())
+}
+
+func TestReload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "hosts.csv", hostsCSV)
+	e := &Enrich{File: path, KeyTag: "host"}
+	out := e.Apply(newMetric(map[string]string{"host": "web01"}))
+	assert.Equal(t, "dc1", out[0].Tags()["datacenter"])
+
+	// an invalid table keeps the previous one
+	writeFile(t, dir, "hosts.csv", "name,datacenter\nweb01,dc3\n")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	out = e.Apply(newMetric(map[string]string{"host": "web01"}))
+	assert.Equal(t, "dc1", out[0].Tags()["datacenter"])
+
+	writeFile(t, dir, "hosts.csv", "host,datacenter\nweb01,dc3\n")
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	out = e.Apply(newMetric(map[string]string{"host": "web01"}))
+	assert.Equal(t, "dc3", out[0].Tags()["datacenter"])
+}
+
+func TestMissingFile(t *testing.T) {
+	e := &Enrich{File: "/nonexistent/hosts.csv", KeyTag: "host"}
+	out := e.Apply(newMetric(map[string]string{"host": "web01"}))
+	assert.Equal(t, map[string]string{"host": "web01"}, out[0].Tags())
+}
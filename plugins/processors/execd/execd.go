@@ -0,0 +1,243 @@
+package execd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/processors"
+	"github.com/influxdata/telegraf/plugins/serializers/influx"
+)
+
+const (
+	defaultTimeout      = 5 * time.Second
+	defaultRestartDelay = 10 * time.Second
+	// maximum length of a line of the output
+	maxLineSize = 1024 * 1024
+)
+
+var sampleConfig = `
+  ## Program to run and its arguments. It reads the metrics from stdin, in
+  ## the influx line protocol, each followed by an empty line, and must
+  ## write the metrics replacing it, if any, to stdout followed by an empty
+  ## line.
+  command = ["/usr/local/bin/enrich.py"]
+
+  ## Environment variables of the program, in addition to those of telegraf.
+  # environment = ["PYTHONUNBUFFERED=1"]
+
+  ## Time given to the program to answer a metric, the metric is passed
+  ## through unchanged and the program restarted when it is over.
+  # timeout = "5s"
+
+  ## Delay before restarting the program after it failed, the metrics are
+  ## passed through unchanged meanwhile.
+  # restart_delay = "10s"
+`
+
+// Execd pipes the metrics through a long-lived program, so that processors
+// can be written in any language.
+type Execd struct {
+	Command      []string
+	Environment  []string
+	Timeout      internal.Duration
+	RestartDelay internal.Duration
+
+	serializer influx.InfluxSerializer
+	proc       *process
+	restartAt  time.Time
+}
+
+// process is a running program.
+type process struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	// lines are the lines of stdout, closed at its end
+	lines chan string
+}
+
+func (e *Execd) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *Execd) Description() string {
+	return "Pipe the metrics through a long-lived program."
+}
+
+// Apply sends each metric to the program and returns the metrics it wrote
+// back, in order. The metric is returned unchanged if the program failed.
+func (e *Execd) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	if len(e.Command) == 0 {
+		return in
+	}
+	out := make([]telegraf.Metric, 0, len(in))
+	for _, m := range in {
+		metrics, err := e.process(m)
+		if err != nil {
+			log.Printf("E! [processors.execd] %s, passing %s through: %s",
+				e.Command[0], m.Name(), err)
+			out = append(out, m)
+			continue
+		}
+		out = append(out, metrics...)
+	}
+	return out
+}
+
+// process sends m to the program, started if needed, and reads its answer.
+func (e *Execd) process(m telegraf.Metric) ([]telegraf.Metric, error) {
+	if e.proc == nil {
+		if time.Now().Before(e.restartAt) {
+			return nil, fmt.Errorf("waiting to restart the program")
+		}
+		if err := e.start(); err != nil {
+			e.failed()
+			return nil, err
+		}
+	}
+
+	line, err := e.serializer.Serialize(m)
+	if err != nil {
+		// the program cannot receive it, but is fine
+		return nil, err
+	}
+	if _, err := e.proc.stdin.Write(append(line, '\n')); err != nil {
+		e.failed()
+		return nil, fmt.Errorf("unable to write to the program: %s", err)
+	}
+
+	timeout := e.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var metrics []telegraf.Metric
+	for {
+		select {
+		case line, ok := <-e.proc.lines:
+			if !ok {
+				e.failed()
+				return nil, fmt.Errorf("the program exited")
+			}
+			if strings.TrimSpace(line) == "" {
+				return metrics, nil
+			}
+			parsed, err := metric.Parse([]byte(line + "\n"))
+			if err != nil {
+				log.Printf("E! [processors.execd] %s wrote invalid line protocol: %s",
+					e.Command[0], err)
+				continue
+			}
+			for _, p := range parsed {
+				// the line protocol does not hold the type of the metric
+				typed, err := metric.New(p.Name(), p.Tags(), p.Fields(), p.Time(), m.Type())
+				if err != nil {
+					log.Printf("E! [processors.execd] %s wrote an invalid metric: %s",
+						e.Command[0], err)
+					continue
+				}
+				metrics = append(metrics, typed)
+			}
+		case <-timer.C:
+			e.failed()
+			return nil, fmt.Errorf("no answer after %s", timeout)
+		}
+	}
+}
+
+// start starts the program.
+func (e *Execd) start() error {
+	cmd := exec.Command(e.Command[0], e.Command[1:]...)
+	if len(e.Environment) > 0 {
+		cmd.Env = append(os.Environ(), e.Environment...)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	p := &process{cmd: cmd, stdin: stdin, lines: make(chan string)}
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				log.Printf("W! [processors.execd] [%s] %s", e.Command[0], line)
+			}
+		}
+		io.Copy(ioutil.Discard, stderr)
+	}()
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+		for scanner.Scan() {
+			p.lines <- scanner.Text()
+		}
+		if err := scanner.Err(); err != nil {
+			log.Printf("E! [processors.execd] unable to read the output of %s: %s",
+				e.Command[0], err)
+		}
+		close(p.lines)
+		io.Copy(ioutil.Discard, stdout)
+		<-stderrDone
+		if err := cmd.Wait(); err != nil {
+			log.Printf("E! [processors.execd] %s exited: %s", e.Command[0], err)
+		}
+	}()
+
+	e.proc = p
+	log.Printf("I! [processors.execd] started %s", e.Command[0])
+	return nil
+}
+
+// failed kills the program, which is restarted after the restart delay.
+func (e *Execd) failed() {
+	delay := e.RestartDelay.Duration
+	if delay <= 0 {
+		delay = defaultRestartDelay
+	}
+	e.restartAt = time.Now().Add(delay)
+	if e.proc == nil {
+		return
+	}
+	e.proc.stdin.Close()
+	e.proc.cmd.Process.Kill()
+	// let the reader of stdout reach the end
+	go func(lines chan string) {
+		for range lines {
+		}
+	}(e.proc.lines)
+	e.proc = nil
+}
+
+func init() {
+	processors.Add("execd", func() telegraf.Processor {
+		return &Execd{
+			Timeout:      internal.Duration{Duration: defaultTimeout},
+			RestartDelay: internal.Duration{Duration: defaultRestartDelay},
+		}
+	})
+}
@@ -0,0 +1,107 @@
+// +build !windows
+
+package execd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// script echoes the empty lines and runs each metric through filter.
+const script = `while read -r line; do
+  if [ -z "$line" ]; then echo; else echo "$line" | %s; fi
+done`
+
+func newExecd(filter string) *Execd {
+	return &Execd{
+		Command:      []string{"sh", "-c", fmt.Sprintf(script, filter)},
+		Timeout:      internal.Duration{Duration: 5 * time.Second},
+		RestartDelay: internal.Duration{Duration: time.Millisecond},
+	}
+}
+
+func newMetric(name string) telegraf.Metric {
+	m, _ := metric.New(name, map[string]string{"host": "a"},
+		map[string]interface{}{"value": int64(1)}, time.Unix(1500000000, 0),
+		telegraf.Counter)
+	return m
+}
+
+func TestApply(t *testing.T) {
+	e := newExecd(`sed 's/^cpu,/cpu,team=web,/'`)
+	defer e.failed()
+
+	out := e.Apply(newMetric("cpu"), newMetric("mem"))
+	require.Len(t, out, 2)
+	assert.Equal(t, "cpu", out[0].Name())
+	assert.Equal(t, map[string]string{"host": "a", "team": "web"}, out[0].Tags())
+	assert.Equal(t, map[string]interface{}{"value": int64(1)}, out[0].Fields())
+	assert.Equal(t, telegraf.Counter, out[0].Type())
+	assert.True(t, time.Unix(1500000000, 0).Equal(out[0].Time()))
+	assert.Equal(t, "mem", out[1].Name())
+	assert.Equal(t, map[string]string{"host": "a"}, out[1].Tags())
+}
+
+func TestApplyDropAndDuplicate(t *testing.T) {
+	// the metrics named drop are dropped and the others written twice
+	e := newExecd(`sed -e '/^drop/d' -e 'p'`)
+	defer e.failed()
+
+	out := e.Apply(newMetric("a"), newMetric("drop"), newMetric("b"))
+	var names []string
+	for _, m := range out {
+		names = append(names, m.Name())
+	}
+	assert.Equal(t, []string{"a", "a", "b", "b"}, names)
+}
+
+func TestApplyTimeout(t *testing.T) {
+	e := &Execd{
+		Command:      []string{"sh", "-c", "cat > /dev/null"},
+		Timeout:      internal.Duration{Duration: 50 * time.Millisecond},
+		RestartDelay: internal.Duration{Duration: time.Hour},
+	}
+	m := newMetric("cpu")
+	out := e.Apply(m)
+	require.Len(t, out, 1)
+	assert.Equal(t, m, out[0])
+	assert.Nil(t, e.proc)
+
+	// the metrics pass through until the program is restarted
+	start := time.Now()
+	out = e.Apply(m)
+	assert.Equal(t, []telegraf.Metric{m}, out)
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+}
+
+func TestApplyRestart(t *testing.T) {
+	// the program answers one metric and exits
+	e := &Execd{
+		Command: []string{"sh", "-c",
+			`read -r line; read -r empty; echo "answered value=1i"; echo; exit 1`},
+		Timeout:      internal.Duration{Duration: 5 * time.Second},
+		RestartDelay: internal.Duration{Duration: time.Millisecond},
+	}
+	defer e.failed()
+
+	out := e.Apply(newMetric("cpu"))
+	require.Len(t, out, 1)
+	assert.Equal(t, "answered", out[0].Name())
+
+	// the program exited, the metric is passed through
+	out = e.Apply(newMetric("cpu"))
+	require.Len(t, out, 1)
+	assert.Equal(t, "cpu", out[0].Name())
+
+	time.Sleep(10 * time.Millisecond)
+	out = e.Apply(newMetric("cpu"))
+	require.Len(t, out, 1)
+	assert.Equal(t, "answered", out[0].Name())
+}
@@ -0,0 +1,113 @@
+package lag
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+// Lag annotates the metrics with their lag, the time elapsed between their
+// timestamp and their processing, to measure the ingestion delay of the
+// inputs.
+type Lag struct {
+	Field    string    `toml:"field"`
+	Tag      string    `toml:"tag"`
+	Overflow string    `toml:"overflow"`
+	Buckets  []*Bucket `toml:"bucket"`
+
+	once sync.Once
+	now  func() time.Time
+}
+
+// Bucket is a value of the tag, for the lags up to Max.
+type Bucket struct {
+	Name string
+	Max  internal.Duration
+}
+
+var defaultBuckets = []*Bucket{
+	{Name: "fresh", Max: internal.Duration{Duration: 10 * time.Second}},
+	{Name: "late", Max: internal.Duration{Duration: time.Minute}},
+}
+
+var sampleConfig = `
+  ## Field holding the lag, the time elapsed since the timestamp of the
+  ## metric, in milliseconds. Empty not to add it.
+  field = "lag_ms"
+
+  ## Tag holding the bucket of the lag, empty not to add it.
+  # tag = "lag"
+
+  ## Bucket of the lags over the max of the last bucket, empty not to tag
+  ## them.
+  # overflow = "very_late"
+
+  ## Buckets of the tag, each for the lags up to its max. By default, fresh
+  ## up to 10s and late up to 1m.
+  # [[processors.lag.bucket]]
+  #   name = "fresh"
+  #   max = "10s"
+  # [[processors.lag.bucket]]
+  #   name = "late"
+  #   max = "1m"
+`
+
+func (l *Lag) SampleConfig() string {
+	return sampleConfig
+}
+
+func (l *Lag) Description() string {
+	return "Add the lag of the metrics, as a field or a tag bucket."
+}
+
+func (l *Lag) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	l.once.Do(func() {
+		if len(l.Buckets) == 0 {
+			l.Buckets = defaultBuckets
+		}
+		sort.SliceStable(l.Buckets, func(i, j int) bool {
+			return l.Buckets[i].Max.Duration < l.Buckets[j].Max.Duration
+		})
+		if l.now == nil {
+			l.now = time.Now
+		}
+	})
+
+	now := l.now()
+	for _, m := range in {
+		lag := now.Sub(m.Time())
+		if l.Field != "" {
+			m.AddField(l.Field, int64(lag/time.Millisecond))
+		}
+		if l.Tag != "" {
+			if bucket := l.bucket(lag); bucket != "" {
+				m.AddTag(l.Tag, bucket)
+			}
+		}
+	}
+	return in
+}
+
+// bucket returns the name of the first bucket whose max is over lag, or
+// the overflow bucket. The lags in the future are in the first bucket.
+func (l *Lag) bucket(lag time.Duration) string {
+	for _, b := range l.Buckets {
+		if lag <= b.Max.Duration {
+			return b.Name
+		}
+	}
+	return l.Overflow
+}
+
+func init() {
+	processors.Add("lag", func() telegraf.Processor {
+		return &Lag{
+			Field:    "lag_ms",
+			Overflow: "very_late",
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package lag
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Unix(1500000000, 0)
+
+func newMetric(age time.Duration) telegraf.Metric {
+	m, _ := metric.New("cpu", map[string]string{"host": "a"},
+		map[string]interface{}{"usage": 0.5}, now.Add(-age))
+	return m
+}
+
+func TestLagField(t *testing.T) {
+	l := &Lag{Field: "lag_ms", now: func() time.Time { return now }}
+	out := l.Apply(newMetric(1500*time.Millisecond), newMetric(-time.Second))
+	assert.Equal(t, int64(1500), out[0].Fields()["lag_ms"])
+	assert.Equal(t, int64(-1000), out[1].Fields()["lag_ms"])
+	assert.False(t, out[0].HasTag("lag"))
+}
+
+func TestLagDefaultBuckets(t *testing.T) {
+	l := &Lag{Tag: "lag", Overflow: "very_late", now: func() time.Time { return now }}
+	out := l.Apply(
+		newMetric(-time.Second),
+		newMetric(10*time.Second),
+		newMetric(30*time.Second),
+		newMetric(time.Hour),
+	)
+	var buckets []string
+	for _, m := range out {
+		assert.False(t, m.HasField("lag_ms"))
+		buckets = append(buckets, m.Tags()["lag"])
+	}
+	assert.Equal(t, []string{"fresh", "fresh", "late", "very_late"}, buckets)
+}
+
+func TestLagBuckets(t *testing.T) {
+	l := &Lag{
+		Tag: "delay",
+		Buckets: []*Bucket{
+			{Name: "slow", Max: internal.Duration{Duration: time.Hour}},
+			{Name: "fast", Max: internal.Duration{Duration: time.Second}},
+		},
+		now: func() time.Time { return now },
+	}
+	out := l.Apply(newMetric(time.Minute), newMetric(0), newMetric(2*time.Hour))
+	assert.Equal(t, "slow", out[0].Tags()["delay"])
+	assert.Equal(t, "fast", out[1].Tags()["delay"])
+	// no overflow bucket
+	assert.False(t, out[2].HasTag("delay"))
+}
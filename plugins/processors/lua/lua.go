@@ -0,0 +1,260 @@
+package lua
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/processors"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Lua transforms the metrics with the apply function of a Lua script.
+type Lua struct {
+	// Source is the script, Script the path of a file with the script.
+	Source string `toml:"source"`
+	Script string `toml:"script"`
+
+	sync.Mutex
+	state *lua.LState
+	apply lua.LValue
+	// failed is set when the script can not be loaded, the metrics are then
+	// passed through
+	failed bool
+}
+
+var sampleConfig = `
+  ## The script, inline or in a file, must define a function apply(metric)
+  ## which returns the metric, a list of metrics or nil to drop it. A metric
+  ## is a table with the keys name, tags, fields and time, in nanoseconds.
+  ## The global variables of the script, such as the table state, are kept
+  ## between the calls.
+  source = '''
+function apply(metric)
+  metric.tags.source = "lua"
+  return metric
+end
+'''
+  # script = "/etc/telegraf/transform.lua"
+`
+
+func (l *Lua) SampleConfig() string {
+	return sampleConfig
+}
+
+func (l *Lua) Description() string {
+	return "Transform metrics with a Lua script."
+}
+
+func (l *Lua) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.state == nil && !l.failed {
+		if err := l.load(); err != nil {
+			log.Printf("E! [processors.lua] %s, metrics are passed through", err)
+			l.failed = true
+		}
+	}
+	if l.failed {
+		return in
+	}
+
+	out := in[:0:0]
+	for _, m := range in {
+		metrics, err := l.call(m)
+		if err != nil {
+			log.Printf("E! [processors.lua] %s", err)
+			out = append(out, m)
+			continue
+		}
+		out = append(out, metrics...)
+	}
+	return out
+}
+
+// load runs the script, with only the base, table, string and math
+// libraries, the functions of the base library loading files or code being
+// removed.
+func (l *Lua) load() error {
+	if (l.Source == "") == (l.Script == "") {
+		return errors.New("either source or script must be set")
+	}
+
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.SetGlobal("state", L.NewTable())
+
+	var err error
+	if l.Source != "" {
+		err = L.DoString(l.Source)
+	} else {
+		err = L.DoFile(l.Script)
+	}
+	if err != nil {
+		L.Close()
+		return fmt.Errorf("unable to load the script: %s", err)
+	}
+
+	apply := L.GetGlobal("apply")
+	if apply.Type() != lua.LTFunction {
+		L.Close()
+		return errors.New("the script does not define the function apply")
+	}
+	l.state, l.apply = L, apply
+	return nil
+}
+
+// call calls the apply function of the script with m.
+func (l *Lua) call(m telegraf.Metric) ([]telegraf.Metric, error) {
+	L := l.state
+	t := m.Time()
+	err := L.CallByParam(lua.P{Fn: l.apply, NRet: 1, Protect: true}, toTable(L, m))
+	if err != nil {
+		return nil, err
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+
+	if ret == lua.LNil {
+		return nil, nil
+	}
+	tbl, ok := ret.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("apply returned a %s, not a metric", ret.Type())
+	}
+	if _, ok := tbl.RawGetInt(1).(*lua.LTable); !ok {
+		out, err := fromTable(tbl, m, t)
+		if err != nil {
+			return nil, err
+		}
+		return []telegraf.Metric{out}, nil
+	}
+
+	var metrics []telegraf.Metric
+	for i := 1; i <= tbl.Len(); i++ {
+		mt, ok := tbl.RawGetInt(i).(*lua.LTable)
+		if !ok {
+			return nil, fmt.Errorf("apply returned a list with a %s, not a metric",
+				tbl.RawGetInt(i).Type())
+		}
+		out, err := fromTable(mt, m, t)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, out)
+	}
+	return metrics, nil
+}
+
+// toTable returns the Lua table of m.
+func toTable(L *lua.LState, m telegraf.Metric) *lua.LTable {
+	tags := L.NewTable()
+	for k, v := range m.Tags() {
+		tags.RawSetString(k, lua.LString(v))
+	}
+	fields := L.NewTable()
+	for k, v := range m.Fields() {
+		switch v := v.(type) {
+		case float64:
+			fields.RawSetString(k, lua.LNumber(v))
+		case int64:
+			fields.RawSetString(k, lua.LNumber(v))
+		case uint64:
+			fields.RawSetString(k, lua.LNumber(v))
+		case string:
+			fields.RawSetString(k, lua.LString(v))
+		case bool:
+			fields.RawSetString(k, lua.LBool(v))
+		}
+	}
+
+	tbl := L.NewTable()
+	tbl.RawSetString("name", lua.LString(m.Name()))
+	tbl.RawSetString("tags", tags)
+	tbl.RawSetString("fields", fields)
+	tbl.RawSetString("time", lua.LNumber(m.UnixNano()))
+	return tbl
+}
+
+// fromTable returns the metric of a Lua table returned by the script for
+// the metric in, whose time is t. Integer fields of in stay integers if
+// their value is still an integer, other numbers are floats.
+func fromTable(tbl *lua.LTable, in telegraf.Metric, t time.Time) (telegraf.Metric, error) {
+	name, ok := tbl.RawGetString("name").(lua.LString)
+	if !ok || name == "" {
+		return nil, errors.New("apply returned a metric without name")
+	}
+
+	tags := make(map[string]string)
+	if lt, ok := tbl.RawGetString("tags").(*lua.LTable); ok {
+		lt.ForEach(func(k, v lua.LValue) {
+			switch v.(type) {
+			case lua.LString, lua.LNumber, lua.LBool:
+				tags[k.String()] = v.String()
+			}
+		})
+	}
+
+	fields := make(map[string]interface{})
+	if lt, ok := tbl.RawGetString("fields").(*lua.LTable); ok {
+		lt.ForEach(func(k, v lua.LValue) {
+			key := k.String()
+			switch v := v.(type) {
+			case lua.LNumber:
+				f := float64(v)
+				switch in.Fields()[key].(type) {
+				case int64:
+					if f == math.Trunc(f) {
+						fields[key] = int64(f)
+						return
+					}
+				case uint64:
+					if f == math.Trunc(f) && f >= 0 {
+						fields[key] = uint64(f)
+						return
+					}
+				}
+				fields[key] = f
+			case lua.LString:
+				fields[key] = string(v)
+			case lua.LBool:
+				fields[key] = bool(v)
+			}
+		})
+	}
+
+	// the time only changes if the script changed it, as a number it does
+	// not have the precision of the nanoseconds of the metric
+	if ns, ok := tbl.RawGetString("time").(lua.LNumber); ok &&
+		ns != lua.LNumber(in.UnixNano()) {
+		t = time.Unix(0, int64(ns))
+	}
+	return metric.New(string(name), tags, fields, t)
+}
+
+func init() {
+	processors.Add("lua", func() telegraf.Processor {
+		return &Lua{}
+	})
+}
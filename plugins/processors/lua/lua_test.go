@@ -0,0 +1,115 @@
+package lua
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func newMetric(name string, tags map[string]string, fields map[string]interface{}) telegraf.Metric {
+	m, _ := metric.New(name, tags, fields, time.Unix(1500000000, 123456789))
+	return m
+}
+
+func TestApply(t *testing.T) {
+	l := &Lua{Source: `
+function apply(metric)
+  metric.name = "http_" .. metric.name
+  metric.tags.region = string.upper(metric.tags.region)
+  metric.tags.host = nil
+  metric.fields.requests = metric.fields.requests * 2
+  metric.fields.ratio = metric.fields.requests / 3
+  metric.fields.ok = true
+  return metric
+end
+`}
+
+	out := l.Apply(newMetric("server",
+		map[string]string{"region": "eu", "host": "a"},
+		map[string]interface{}{"requests": int64(3)}))
+	require.Len(t, out, 1)
+	assert.Equal(t, "http_server", out[0].Name())
+	assert.Equal(t, map[string]string{"region": "EU"}, out[0].Tags())
+	assert.Equal(t, map[string]interface{}{
+		"requests": int64(6),
+		"ratio":    2.0,
+		"ok":       true,
+	}, out[0].Fields())
+	// the time keeps its nanoseconds
+	assert.Equal(t, time.Unix(1500000000, 123456789), out[0].Time())
+}
+
+func TestApplyDropAndEmit(t *testing.T) {
+	l := &Lua{Source: `
+function apply(metric)
+  if metric.tags.drop then
+    return nil
+  end
+  local copy = {name = "copy", tags = metric.tags, fields = {value = 1.5}}
+  return {metric, copy}
+end
+`}
+
+	out := l.Apply(
+		newMetric("cpu", map[string]string{"drop": "yes"},
+			map[string]interface{}{"value": 1.0}),
+		newMetric("mem", map[string]string{"host": "a"},
+			map[string]interface{}{"value": 2.0}),
+	)
+	require.Len(t, out, 2)
+	assert.Equal(t, "mem", out[0].Name())
+	assert.Equal(t, "copy", out[1].Name())
+	assert.Equal(t, map[string]string{"host": "a"}, out[1].Tags())
+	assert.Equal(t, map[string]interface{}{"value": 1.5}, out[1].Fields())
+	assert.Equal(t, out[0].Time(), out[1].Time())
+}
+
+// Test that the globals of the script are kept between the calls
+func TestApplyState(t *testing.T) {
+	l := &Lua{Source: `
+function apply(metric)
+  state.count = (state.count or 0) + 1
+  metric.fields.count = state.count
+  return metric
+end
+`}
+
+	for i := 1; i <= 3; i++ {
+		out := l.Apply(newMetric("cpu", nil, map[string]interface{}{"value": 1.0}))
+		require.Len(t, out, 1)
+		assert.Equal(t, float64(i), out[0].Fields()["count"])
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	m := newMetric("cpu", nil, map[string]interface{}{"value": 1.0})
+
+	// invalid scripts pass the metrics through
+	for _, source := range []string{"function apply(", "x = 1", ""} {
+		l := &Lua{Source: source}
+		assert.Equal(t, []telegraf.Metric{m}, l.Apply(m), source)
+	}
+
+	// so do the metrics the script fails on
+	l := &Lua{Source: `
+function apply(metric)
+  return metric.fields.missing + 1
+end
+`}
+	assert.Equal(t, []telegraf.Metric{m}, l.Apply(m))
+
+	// the unsafe functions are not available
+	l = &Lua{Source: `
+function apply(metric)
+  dofile("/etc/passwd")
+  return metric
+end
+`}
+	assert.Equal(t, []telegraf.Metric{m}, l.Apply(m))
+	assert.Equal(t, lua.LNil, l.state.GetGlobal("os"))
+}
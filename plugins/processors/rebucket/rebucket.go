@@ -0,0 +1,199 @@
+package rebucket
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+const infBucket = "+Inf"
+
+// Rebucket converts the histograms scraped by the prometheus input, one
+// field per bucket named after its upper bound and holding its cumulative
+// count, to coarser buckets or to quantiles.
+type Rebucket struct {
+	Buckets   []float64 `toml:"buckets"`
+	Quantiles []float64 `toml:"quantiles"`
+
+	warned bool
+}
+
+// bucket is an upper bound and the number of observations lower or equal
+// to it.
+type bucket struct {
+	upper float64
+	count float64
+}
+
+var sampleConfig = `
+  ## Upper bounds of the new buckets, the +Inf bucket is always kept. The
+  ## counts are exact for the bounds of the original buckets, and linearly
+  ## interpolated for the others.
+  buckets = [0.01, 0.1, 1.0, 10.0]
+
+  ## Or replace the buckets by these quantiles, estimated by linear
+  ## interpolation in the buckets like the histogram_quantile function of
+  ## Prometheus. The fields are named after the quantiles, like the ones of
+  ## Prometheus summaries.
+  # quantiles = [0.5, 0.9, 0.99]
+
+  ## Restrict the conversion to some histograms.
+  # namepass = ["http_request_duration_seconds"]
+`
+
+func (r *Rebucket) SampleConfig() string {
+	return sampleConfig
+}
+
+func (r *Rebucket) Description() string {
+	return "Convert the buckets of Prometheus histograms to coarser buckets or quantiles."
+}
+
+func (r *Rebucket) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	if len(r.Buckets) > 0 && len(r.Quantiles) > 0 {
+		if !r.warned {
+			log.Printf("E! [processors.rebucket] buckets and quantiles cannot " +
+				"be both set, the histograms are not converted")
+			r.warned = true
+		}
+		return in
+	}
+	if len(r.Buckets) == 0 && len(r.Quantiles) == 0 {
+		return in
+	}
+
+	for i, m := range in {
+		buckets, others, ok := histogram(m)
+		if !ok {
+			continue
+		}
+
+		fields := others
+		if len(r.Quantiles) > 0 {
+			for _, q := range r.Quantiles {
+				if v, ok := quantile(q, buckets); ok {
+					fields[fmt.Sprint(q)] = v
+				}
+			}
+		} else {
+			for _, b := range r.Buckets {
+				fields[fmt.Sprint(b)] = countAt(b, buckets)
+			}
+			fields[infBucket] = buckets[len(buckets)-1].count
+		}
+
+		out, err := metric.New(m.Name(), m.Tags(), fields, m.Time(), m.Type())
+		if err != nil {
+			log.Printf("E! [processors.rebucket] could not convert %s: %s",
+				m.Name(), err)
+			continue
+		}
+		in[i] = out
+	}
+	return in
+}
+
+// histogram returns the buckets of m, sorted by upper bound and ending
+// with the +Inf bucket, and its other fields. m is a histogram if it has a
+// +Inf field, count and sum fields, and its other fields are named after
+// numbers.
+func histogram(m telegraf.Metric) ([]bucket, map[string]interface{}, bool) {
+	if !m.HasField(infBucket) || !m.HasField("count") || !m.HasField("sum") {
+		return nil, nil, false
+	}
+
+	fields := m.Fields()
+	var buckets []bucket
+	others := make(map[string]interface{})
+	for k, v := range fields {
+		if k == "count" || k == "sum" {
+			others[k] = v
+			continue
+		}
+		upper, err := strconv.ParseFloat(k, 64)
+		if err != nil {
+			return nil, nil, false
+		}
+		count, ok := v.(float64)
+		if !ok {
+			return nil, nil, false
+		}
+		buckets = append(buckets, bucket{upper: upper, count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].upper < buckets[j].upper
+	})
+	return buckets, others, true
+}
+
+// countAt returns the number of observations lower or equal to upper,
+// interpolated between the bounds of the buckets.
+func countAt(upper float64, buckets []bucket) float64 {
+	lower := bucket{}
+	for i, b := range buckets {
+		if b.upper == upper {
+			return b.count
+		}
+		if b.upper > upper {
+			if math.IsInf(b.upper, 1) {
+				// nothing is known above the last finite bound
+				return lower.count
+			}
+			if i == 0 && (b.upper <= 0 || upper < 0) {
+				return 0
+			}
+			return lower.count + (b.count-lower.count)*
+				(upper-lower.upper)/(b.upper-lower.upper)
+		}
+		lower = b
+	}
+	return lower.count
+}
+
+// quantile estimates the q-quantile of the observations of the buckets,
+// like the histogram_quantile function of Prometheus.
+func quantile(q float64, buckets []bucket) (float64, bool) {
+	if q < 0 || q > 1 || len(buckets) < 2 {
+		return 0, false
+	}
+	total := buckets[len(buckets)-1].count
+	if total == 0 {
+		return 0, false
+	}
+
+	rank := q * total
+	i := sort.Search(len(buckets)-1, func(i int) bool {
+		return buckets[i].count >= rank
+	})
+	if i == len(buckets)-1 {
+		// in the +Inf bucket, the best estimate is the last finite bound
+		return buckets[len(buckets)-2].upper, true
+	}
+	if i == 0 && buckets[0].upper <= 0 {
+		return buckets[0].upper, true
+	}
+
+	start, prev := 0.0, 0.0
+	if i > 0 {
+		start = buckets[i-1].upper
+		prev = buckets[i-1].count
+	}
+	end := buckets[i].upper
+	count := buckets[i].count - prev
+	if count == 0 {
+		return end, true
+	}
+	return start + (end-start)*((rank-prev)/count), true
+}
+
+func init() {
+	processors.Add("rebucket", func() telegraf.Processor {
+		return &Rebucket{}
+	})
+}
@@ -0,0 +1,110 @@
+package rebucket
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newHistogram returns a histogram like the ones of the prometheus input:
+// 10 observations, 2 up to 0.1, 6 up to 0.5, 8 up to 1 and 10 up to 5.
+func newHistogram() telegraf.Metric {
+	m, _ := metric.New("http_request_duration_seconds",
+		map[string]string{"handler": "/api"},
+		map[string]interface{}{
+			"0.1":   float64(2),
+			"0.5":   float64(6),
+			"1":     float64(8),
+			"5":     float64(10),
+			"+Inf":  float64(10),
+			"count": float64(10),
+			"sum":   float64(12.5),
+		},
+		time.Now(),
+	)
+	return m
+}
+
+func TestBuckets(t *testing.T) {
+	r := &Rebucket{Buckets: []float64{0.5, 3}}
+	out := r.Apply(newHistogram())
+
+	require.Len(t, out, 1)
+	assert.Equal(t, "http_request_duration_seconds", out[0].Name())
+	assert.Equal(t, map[string]string{"handler": "/api"}, out[0].Tags())
+	assert.Equal(t, map[string]interface{}{
+		"0.5":   float64(6),
+		"3":     float64(9),
+		"+Inf":  float64(10),
+		"count": float64(10),
+		"sum":   float64(12.5),
+	}, out[0].Fields())
+}
+
+func TestBucketsOutOfRange(t *testing.T) {
+	r := &Rebucket{Buckets: []float64{0.05, 10}}
+	out := r.Apply(newHistogram())
+
+	require.Len(t, out, 1)
+	fields := out[0].Fields()
+	assert.Equal(t, float64(1), fields["0.05"])
+	// nothing is known of the observations between 5 and +Inf
+	assert.Equal(t, float64(10), fields["10"])
+}
+
+func TestQuantiles(t *testing.T) {
+	r := &Rebucket{Quantiles: []float64{0.1, 0.5, 0.9, 1}}
+	out := r.Apply(newHistogram())
+
+	require.Len(t, out, 1)
+	fields := out[0].Fields()
+	assert.Len(t, fields, 6)
+	assert.InDelta(t, 0.05, fields["0.1"], 1e-9)
+	assert.InDelta(t, 0.4, fields["0.5"], 1e-9)
+	assert.InDelta(t, 3.0, fields["0.9"], 1e-9)
+	assert.InDelta(t, 5.0, fields["1"], 1e-9)
+	assert.Equal(t, float64(10), fields["count"])
+}
+
+func TestQuantileInInfBucket(t *testing.T) {
+	inf := math.Inf(1)
+	buckets := []bucket{{1, 5}, {2, 8}, {inf, 10}}
+	v, ok := quantile(0.95, buckets)
+	require.True(t, ok)
+	assert.Equal(t, 2.0, v)
+
+	_, ok = quantile(0.5, []bucket{{1, 0}, {inf, 0}})
+	assert.False(t, ok)
+}
+
+func TestNotHistogram(t *testing.T) {
+	summary, _ := metric.New("rpc_duration_seconds", nil,
+		map[string]interface{}{"0.5": 0.2, "count": float64(4), "sum": 1.0},
+		time.Now(),
+	)
+	gauge, _ := metric.New("cpu", nil,
+		map[string]interface{}{"usage": 42.0},
+		time.Now(),
+	)
+	in := []telegraf.Metric{summary, gauge}
+	r := &Rebucket{Quantiles: []float64{0.9}}
+	out := r.Apply(in...)
+
+	assert.Equal(t, in, out)
+	assert.Equal(t, map[string]interface{}{"0.5": 0.2, "count": float64(4), "sum": 1.0},
+		out[0].Fields())
+}
+
+func TestBucketsAndQuantiles(t *testing.T) {
+	h := newHistogram()
+	r := &Rebucket{Buckets: []float64{1}, Quantiles: []float64{0.5}}
+	out := r.Apply(h)
+
+	require.Len(t, out, 1)
+	assert.Len(t, out[0].Fields(), 7)
+}
@@ -0,0 +1,202 @@
+package regex
+
+import (
+	"log"
+	"regexp"
+	"sort"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+// Regex rewrites tag values, field keys and measurement names with regular
+// expressions.
+type Regex struct {
+	Tags         []*converter `toml:"tags"`
+	FieldRename  []*converter `toml:"field_rename"`
+	MetricRename []*converter `toml:"metric_rename"`
+
+	initialized bool
+}
+
+// converter replaces the matches of Pattern with Replacement, which can
+// refer to the groups of the pattern, ie "${1}" or "${name}".
+type converter struct {
+	// Key is the tag whose value is rewritten, it is not used to rename
+	// fields and measurements.
+	Key         string
+	Pattern     string
+	Replacement string
+	// ResultKey is the tag the rewritten value is stored in, by default the
+	// value of Key is replaced.
+	ResultKey string `toml:"result_key"`
+	// GroupTags adds a tag for every named group of the pattern matching
+	// the value.
+	GroupTags bool `toml:"group_tags"`
+
+	regex *regexp.Regexp
+}
+
+var sampleConfig = `
+  ## Tag values: the matches of pattern in the value of the tag key are
+  ## replaced by replacement, which can refer to the groups of the pattern
+  ## with ${1} or ${name}. Tags not matching the pattern are not changed.
+  [[processors.regex.tags]]
+    key = "path"
+    pattern = "/[0-9]+(/|$)"
+    replacement = "/:id${1}"
+    ## Store the result in another tag instead of replacing the value.
+    # result_key = "route"
+    ## Add a tag for every named group of the pattern, ie "service" with
+    ## pattern = "^/api/(?P<service>[^/]+)".
+    # group_tags = false
+
+  ## Field keys: the matches of pattern in every field key are replaced. A
+  ## renamed field replaces the field already having its new name, of the
+  ## fields renamed to the same name the one with the last key in
+  ## lexical order wins.
+  # [[processors.regex.field_rename]]
+  #   pattern = "^search_"
+  #   replacement = ""
+
+  ## Measurement names: the matches of pattern in the name are replaced.
+  ## group_tags also applies.
+  # [[processors.regex.metric_rename]]
+  #   pattern = "^rabbitmq_queue_(?P<queue>.+)$"
+  #   replacement = "rabbitmq_queue"
+  #   group_tags = true
+`
+
+func (r *Regex) SampleConfig() string {
+	return sampleConfig
+}
+
+func (r *Regex) Description() string {
+	return "Rewrite tag values, field keys and measurement names with regular expressions."
+}
+
+func (r *Regex) init() {
+	r.Tags = compile("tags", r.Tags)
+	r.FieldRename = compile("field_rename", r.FieldRename)
+	r.MetricRename = compile("metric_rename", r.MetricRename)
+	r.initialized = true
+}
+
+// compile compiles the patterns of the converters and returns the valid
+// ones.
+func compile(section string, converters []*converter) []*converter {
+	valid := converters[:0]
+	for _, c := range converters {
+		regex, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			log.Printf("E! [processors.regex] %s converter disabled, invalid "+
+				"pattern %q: %s", section, c.Pattern, err)
+			continue
+		}
+		c.regex = regex
+		valid = append(valid, c)
+	}
+	return valid
+}
+
+func (r *Regex) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	if !r.initialized {
+		r.init()
+	}
+
+	for i, m := range in {
+		for _, c := range r.Tags {
+			value, ok := m.Tags()[c.Key]
+			if !ok || !c.regex.MatchString(value) {
+				continue
+			}
+			key := c.Key
+			if c.ResultKey != "" {
+				key = c.ResultKey
+			}
+			m.AddTag(key, c.regex.ReplaceAllString(value, c.Replacement))
+			c.addGroupTags(m, value)
+		}
+
+		if len(r.FieldRename) > 0 {
+			if renamed := r.renameFields(m); renamed != nil {
+				in[i] = renamed
+				m = renamed
+			}
+		}
+
+		for _, c := range r.MetricRename {
+			name := m.Name()
+			if !c.regex.MatchString(name) {
+				continue
+			}
+			if renamed := c.regex.ReplaceAllString(name, c.Replacement); renamed != "" {
+				m.SetName(renamed)
+			}
+			c.addGroupTags(m, name)
+		}
+	}
+	return in
+}
+
+// renameFields returns a copy of m with its fields renamed, or nil if no
+// field is renamed. The metric is rebuilt rather than edited with
+// RemoveField, which cannot remove the last field of a metric. A renamed
+// field replaces the field already having its new name, and the fields
+// renamed to the same name are applied in the order of their keys, the last
+// one wins.
+func (r *Regex) renameFields(m telegraf.Metric) telegraf.Metric {
+	fields := m.Fields()
+	changed := false
+	for _, c := range r.FieldRename {
+		renamed := make(map[string]interface{}, len(fields))
+		var matched []string
+		for k, v := range fields {
+			if c.regex.MatchString(k) && c.regex.ReplaceAllString(k, c.Replacement) != "" {
+				matched = append(matched, k)
+				continue
+			}
+			renamed[k] = v
+		}
+		sort.Strings(matched)
+		for _, k := range matched {
+			name := c.regex.ReplaceAllString(k, c.Replacement)
+			changed = changed || name != k
+			renamed[name] = fields[k]
+		}
+		fields = renamed
+	}
+	if !changed {
+		return nil
+	}
+
+	out, err := metric.New(m.Name(), m.Tags(), fields, m.Time(), m.Type())
+	if err != nil {
+		log.Printf("E! [processors.regex] could not rename the fields of %s: %s",
+			m.Name(), err)
+		return nil
+	}
+	return out
+}
+
+// addGroupTags adds the non empty named groups of the first match of the
+// pattern in value as tags.
+func (c *converter) addGroupTags(m telegraf.Metric, value string) {
+	if !c.GroupTags {
+		return
+	}
+	match := c.regex.FindStringSubmatch(value)
+	for i, name := range c.regex.SubexpNames() {
+		if i == 0 || name == "" || i >= len(match) || match[i] == "" {
+			continue
+		}
+		m.AddTag(name, match[i])
+	}
+}
+
+func init() {
+	processors.Add("regex", func() telegraf.Processor {
+		return &Regex{}
+	})
+}
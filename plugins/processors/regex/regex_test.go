@@ -0,0 +1,134 @@
+package regex
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMetric(name string, tags map[string]string, fields map[string]interface{}) telegraf.Metric {
+	m, _ := metric.New(name, tags, fields, time.Unix(1500000000, 0))
+	return m
+}
+
+func TestTags(t *testing.T) {
+	r := &Regex{
+		Tags: []*converter{
+			{
+				Key:         "path",
+				Pattern:     "/[0-9]+(/|$)",
+				Replacement: "/:id${1}",
+			},
+			{
+				Key:         "path",
+				Pattern:     "^/api/(?P<service>[^/]+)/.*$",
+				Replacement: "${service}",
+				ResultKey:   "endpoint",
+				GroupTags:   true,
+			},
+		},
+	}
+
+	out := r.Apply(
+		newMetric("http", map[string]string{"path": "/api/users/42/orders/7"},
+			map[string]interface{}{"duration": 1.5}),
+		newMetric("http", map[string]string{"path": "/health"},
+			map[string]interface{}{"duration": 0.1}),
+		newMetric("http", nil, map[string]interface{}{"duration": 0.1}),
+	)
+	require.Len(t, out, 3)
+	assert.Equal(t, map[string]string{
+		"path":     "/api/users/:id/orders/:id",
+		"endpoint": "users",
+		"service":  "users",
+	}, out[0].Tags())
+	assert.Equal(t, map[string]string{"path": "/health"}, out[1].Tags())
+	assert.Equal(t, map[string]string{}, out[2].Tags())
+}
+
+func TestFieldRename(t *testing.T) {
+	r := &Regex{
+		FieldRename: []*converter{{
+			Pattern:     "^search_(.*)_total$",
+			Replacement: "${1}",
+		}},
+	}
+
+	out := r.Apply(newMetric("es", nil, map[string]interface{}{
+		"search_query_total": int64(3),
+		"search_fetch_total": int64(4),
+		"query":              int64(1),
+		"docs":               int64(5),
+	}))
+	assert.Equal(t, map[string]interface{}{
+		"query": int64(3),
+		"fetch": int64(4),
+		"docs":  int64(5),
+	}, out[0].Fields())
+}
+
+// Test that the renamed fields always replace the existing ones, and that
+// the fields renamed to the same name are applied in the order of their keys
+func TestFieldRenameCollisions(t *testing.T) {
+	r := &Regex{
+		FieldRename: []*converter{{
+			Pattern:     "^(?:renamed|z)_(.*)$",
+			Replacement: "${1}",
+		}},
+	}
+
+	fields := map[string]interface{}{
+		"renamed_last": "renamed",
+		"z_last":       "z",
+	}
+	expected := map[string]interface{}{"last": "z"}
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("f%02d", i)
+		fields[key] = "original"
+		fields["renamed_"+key] = "renamed"
+		expected[key] = "renamed"
+	}
+
+	out := r.Apply(newMetric("m", nil, fields))
+	assert.Equal(t, expected, out[0].Fields())
+}
+
+func TestMetricRename(t *testing.T) {
+	r := &Regex{
+		MetricRename: []*converter{{
+			Pattern:     "^rabbitmq_queue_(?P<queue>.+)$",
+			Replacement: "rabbitmq_queue",
+			GroupTags:   true,
+		}},
+	}
+
+	out := r.Apply(
+		newMetric("rabbitmq_queue_orders", map[string]string{"host": "a"},
+			map[string]interface{}{"messages": int64(3)}),
+		newMetric("rabbitmq_node", map[string]string{"host": "a"},
+			map[string]interface{}{"mem_used": int64(3)}),
+	)
+	assert.Equal(t, "rabbitmq_queue", out[0].Name())
+	assert.Equal(t, map[string]string{"host": "a", "queue": "orders"}, out[0].Tags())
+	assert.Equal(t, "rabbitmq_node", out[1].Name())
+	assert.Equal(t, map[string]string{"host": "a"}, out[1].Tags())
+}
+
+func TestInvalidPattern(t *testing.T) {
+	r := &Regex{
+		Tags: []*converter{
+			{Key: "path", Pattern: "(", Replacement: "x"},
+			{Key: "path", Pattern: "^/", Replacement: ""},
+		},
+	}
+
+	out := r.Apply(newMetric("http", map[string]string{"path": "/health"},
+		map[string]interface{}{"duration": 0.1}))
+	assert.Len(t, r.Tags, 1)
+	assert.Equal(t, "health", out[0].Tags()["path"])
+}
@@ -0,0 +1,187 @@
+package round
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+// maxExactInt is the largest magnitude of the integers a float64 holds
+// exactly, larger integer fields are not rounded.
+const maxExactInt = 1 << 53
+
+// Round rounds the numeric fields to a number of decimals or of significant
+// figures.
+type Round struct {
+	Rules []*Rule `toml:"rule"`
+
+	once sync.Once
+}
+
+// Rule rounds the fields matching Fields of the metrics matching
+// Measurements, globs are supported and an empty list matches everything.
+type Rule struct {
+	Measurements []string `toml:"measurements"`
+	Fields       []string `toml:"fields"`
+	// Decimals is the number of decimals kept, a negative number rounds to
+	// tens, hundreds...
+	Decimals int `toml:"decimals"`
+	// SignificantFigures is the number of significant figures kept, used
+	// instead of Decimals when set.
+	SignificantFigures int `toml:"significant_figures"`
+
+	measurements filter.Filter
+	fields       filter.Filter
+	invalid      bool
+}
+
+var sampleConfig = `
+  ## Rules rounding the numeric fields, the first rule matching both the
+  ## measurement and the field applies. Globs are supported, an empty list
+  ## matches everything.
+  [[processors.round.rule]]
+    measurements = ["cpu"]
+    fields = ["usage_*"]
+    ## Number of decimals kept, a negative number rounds to tens, hundreds...
+    ## The integer fields are only rounded to tens and above.
+    decimals = 2
+
+  [[processors.round.rule]]
+    fields = ["*"]
+    ## Number of significant figures kept, used instead of decimals when set.
+    significant_figures = 4
+`
+
+func (r *Round) SampleConfig() string {
+	return sampleConfig
+}
+
+func (r *Round) Description() string {
+	return "Round numeric fields to a number of decimals or significant figures."
+}
+
+func (r *Round) init() {
+	for _, rule := range r.Rules {
+		var err error
+		if rule.measurements, err = filter.Compile(rule.Measurements); err == nil {
+			rule.fields, err = filter.Compile(rule.Fields)
+		}
+		if err != nil {
+			log.Printf("E! [processors.round] invalid rule %v %v, ignored: %s",
+				rule.Measurements, rule.Fields, err)
+			rule.invalid = true
+		}
+	}
+}
+
+func (r *Round) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	r.once.Do(r.init)
+	for i, m := range in {
+		if rounded := r.round(m); rounded != nil {
+			in[i] = rounded
+		}
+	}
+	return in
+}
+
+// round returns the rounded copy of m, or nil if no field changed.
+func (r *Round) round(m telegraf.Metric) telegraf.Metric {
+	var rules []*Rule
+	for _, rule := range r.Rules {
+		if !rule.invalid && (rule.measurements == nil || rule.measurements.Match(m.Name())) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	fields := m.Fields()
+	changed := false
+	for k, v := range fields {
+		for _, rule := range rules {
+			if rule.fields != nil && !rule.fields.Match(k) {
+				continue
+			}
+			if rounded, ok := rule.apply(v); ok && rounded != v {
+				fields[k] = rounded
+				changed = true
+			}
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	out, err := metric.New(m.Name(), m.Tags(), fields, m.Time(), m.Type())
+	if err != nil {
+		log.Printf("E! [processors.round] could not round %s: %s", m.Name(), err)
+		return nil
+	}
+	return out
+}
+
+// apply returns the rounded value of a numeric field, of the same type.
+func (rule *Rule) apply(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case float64:
+		return rule.roundFloat(v), true
+	case int64:
+		if !rule.roundsIntegers() || v > maxExactInt || v < -maxExactInt {
+			return nil, false
+		}
+		return int64(rule.roundFloat(float64(v))), true
+	case uint64:
+		if !rule.roundsIntegers() || v > maxExactInt {
+			return nil, false
+		}
+		return uint64(rule.roundFloat(float64(v))), true
+	}
+	return nil, false
+}
+
+// roundsIntegers reports whether the rule can change an integer.
+func (rule *Rule) roundsIntegers() bool {
+	return rule.SignificantFigures > 0 || rule.Decimals < 0
+}
+
+// roundFloat rounds f to the nearest value with the decimals or significant
+// figures of the rule, which is then the float closest to that decimal.
+func (rule *Rule) roundFloat(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	scale := float64(1)
+	var s string
+	switch {
+	case rule.SignificantFigures > 0:
+		s = strconv.FormatFloat(f, 'g', rule.SignificantFigures, 64)
+	case rule.Decimals >= 0:
+		s = strconv.FormatFloat(f, 'f', rule.Decimals, 64)
+	default:
+		scale = math.Pow10(-rule.Decimals)
+		s = strconv.FormatFloat(f/scale, 'f', 0, 64)
+	}
+	r, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return f
+	}
+	if r == 0 {
+		// no negative zero
+		return 0
+	}
+	return r * scale
+}
+
+func init() {
+	processors.Add("round", func() telegraf.Processor {
+		return &Round{}
+	})
+}
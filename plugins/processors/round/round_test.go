@@ -0,0 +1,100 @@
+package round
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMetric(name string, fields map[string]interface{}) telegraf.Metric {
+	m, _ := metric.New(name, map[string]string{"host": "a"}, fields,
+		time.Unix(1500000000, 0))
+	return m
+}
+
+func TestRoundFloat(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		in   float64
+		out  float64
+	}{
+		{Rule{Decimals: 2}, 0.1 + 0.2, 0.3},
+		{Rule{Decimals: 2}, 1.005001, 1.01},
+		{Rule{Decimals: 0}, 2.5001, 3},
+		{Rule{Decimals: -2}, 1234.5, 1200},
+		{Rule{Decimals: 1}, -0.04, 0},
+		{Rule{SignificantFigures: 3}, 123456.7, 123000},
+		{Rule{SignificantFigures: 3}, 0.00123456, 0.00123},
+		{Rule{SignificantFigures: 2, Decimals: 5}, 98.76, 99},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.out, tt.rule.roundFloat(tt.in), "%+v %v", tt.rule, tt.in)
+	}
+	rule := Rule{Decimals: 2}
+	assert.True(t, math.IsNaN(rule.roundFloat(math.NaN())))
+	assert.True(t, math.IsInf(rule.roundFloat(math.Inf(1)), 1))
+	assert.False(t, math.Signbit(rule.roundFloat(-0.001)))
+}
+
+func TestApply(t *testing.T) {
+	r := &Round{
+		Rules: []*Rule{
+			{Measurements: []string{"cpu"}, Fields: []string{"usage_*"}, Decimals: 1},
+			{Fields: []string{"bytes"}, Decimals: -3},
+			{SignificantFigures: 2},
+		},
+	}
+
+	out := r.Apply(
+		newMetric("cpu", map[string]interface{}{
+			"usage_idle": 97.4567,
+			"load":       1.2345,
+			"count":      int64(7),
+			"label":      "ok",
+		}),
+		newMetric("net", map[string]interface{}{
+			"bytes":   int64(123456),
+			"packets": uint64(987),
+			"errors":  int64(math.MaxInt64),
+		}),
+	)
+	require.Len(t, out, 2)
+	assert.Equal(t, map[string]interface{}{
+		"usage_idle": 97.5,
+		"load":       1.2,
+		"count":      int64(7),
+		"label":      "ok",
+	}, out[0].Fields())
+	assert.Equal(t, map[string]string{"host": "a"}, out[0].Tags())
+	assert.Equal(t, time.Unix(1500000000, 0), out[0].Time())
+	assert.Equal(t, map[string]interface{}{
+		"bytes":   int64(123000),
+		"packets": uint64(990),
+		"errors":  int64(math.MaxInt64),
+	}, out[1].Fields())
+}
+
+func TestApplyUnchanged(t *testing.T) {
+	r := &Round{
+		Rules: []*Rule{{Measurements: []string{"cpu"}, Decimals: 2}},
+	}
+	m := newMetric("mem", map[string]interface{}{"used": 1.23456})
+	out := r.Apply(m)
+	require.Len(t, out, 1)
+	assert.True(t, m == out[0])
+
+	m = newMetric("cpu", map[string]interface{}{"used": 1.5, "n": int64(3)})
+	out = r.Apply(m)
+	assert.True(t, m == out[0])
+
+	// the unsigned integers a float64 does not hold exactly are kept
+	r = &Round{Rules: []*Rule{{SignificantFigures: 2}}}
+	m = newMetric("net", map[string]interface{}{"bytes": uint64(math.MaxUint64)})
+	out = r.Apply(m)
+	assert.True(t, m == out[0])
+}
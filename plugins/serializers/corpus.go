@@ -0,0 +1,190 @@
+package serializers
+
+import (
+	"bytes"
+	ejson "encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/parsers/msgpack"
+)
+
+// CorpusEntry is a metric of the serializer test corpus.
+type CorpusEntry struct {
+	// Name describes what the metric exercises
+	Name   string
+	Metric telegraf.Metric
+}
+
+// corpusTime is the timestamp of the corpus metrics, it has a non zero
+// sub-second part to exercise the timestamp precisions.
+var corpusTime = time.Unix(1500000000, 123456789)
+
+// Corpus returns metrics with unusual names, tags and field values that
+// every serializer must either serialize into valid output or reject with
+// an error. It is used by the tests and benchmarks of this package and can
+// be used by any plugin producing a serialized format.
+func Corpus() []CorpusEntry {
+	entries := []struct {
+		name   string
+		mname  string
+		tags   map[string]string
+		fields map[string]interface{}
+		t      time.Time
+	}{
+		{"simple", "cpu",
+			map[string]string{"host": "localhost", "cpu": "cpu0"},
+			map[string]interface{}{"usage_idle": 98.5, "usage_user": 1.5},
+			corpusTime},
+		{"no tags", "load", nil,
+			map[string]interface{}{"load1": 0.25},
+			corpusTime},
+		{"unicode", "température",
+			map[string]string{"région": "Île-de-France", "ключ": "значение"},
+			map[string]interface{}{"valeur_°C": 21.5, "文字": "中文"},
+			corpusTime},
+		{"separators", "my measurement,with=separators",
+			map[string]string{"tag key,=": "tag value,= with spaces"},
+			map[string]interface{}{"field key,=": int64(1)},
+			corpusTime},
+		{"dots and slashes", "disk.io",
+			map[string]string{"path": "/var/lib/docker", "device": "sda1.part"},
+			map[string]interface{}{"read.bytes": int64(4096)},
+			corpusTime},
+		{"newlines", "multi\nline",
+			map[string]string{"tag": "a\nb", "tab": "c\td"},
+			map[string]interface{}{"field\nkey": int64(1), "message": "first\nsecond\r\n"},
+			corpusTime},
+		{"quotes and backslashes", "quotes",
+			map[string]string{"quoted": `"tag"`, "path": `C:\Windows\System32`},
+			map[string]interface{}{"message": `say "hi" \ then \"bye\"`, "value": 1.0},
+			corpusTime},
+		{"empty string field", "empty",
+			map[string]string{"host": "localhost"},
+			map[string]interface{}{"message": "", "value": int64(0)},
+			corpusTime},
+		{"integer limits", "limits",
+			map[string]string{"host": "localhost"},
+			map[string]interface{}{
+				"max": int64(math.MaxInt64), "min": int64(math.MinInt64),
+				"uint_max": uint64(math.MaxUint64),
+			},
+			corpusTime},
+		{"float limits", "limits",
+			map[string]string{"host": "localhost"},
+			map[string]interface{}{
+				"max": math.MaxFloat64, "smallest": math.SmallestNonzeroFloat64,
+				"negative": -1e-300, "zero": 0.0,
+			},
+			corpusTime},
+		{"nan", "special", nil,
+			map[string]interface{}{"nan": math.NaN(), "value": 1.0},
+			corpusTime},
+		{"infinity", "special", nil,
+			map[string]interface{}{"inf": math.Inf(1), "ninf": math.Inf(-1)},
+			corpusTime},
+		{"booleans", "flags", nil,
+			map[string]interface{}{"up": true, "down": false},
+			corpusTime},
+		{"long values", "long",
+			map[string]string{"tag": longString(1024)},
+			map[string]interface{}{"message": longString(64 * 1024)},
+			corpusTime},
+		{"epoch", "epoch", nil,
+			map[string]interface{}{"value": 1.0},
+			time.Unix(0, 0)},
+		{"before epoch", "epoch", nil,
+			map[string]interface{}{"value": 1.0},
+			time.Unix(-86400, 0)},
+	}
+
+	corpus := make([]CorpusEntry, 0, len(entries))
+	for _, e := range entries {
+		m, err := metric.New(e.mname, e.tags, e.fields, e.t)
+		if err != nil {
+			panic("invalid corpus metric " + e.name + ": " + err.Error())
+		}
+		corpus = append(corpus, CorpusEntry{Name: e.name, Metric: m})
+	}
+	return corpus
+}
+
+func longString(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = 'a' + byte(i%26)
+	}
+	return string(b)
+}
+
+// Validate returns an error if buf is not well formed output of the data
+// format: newline terminated lines that are valid line protocol for influx,
+// JSON objects with a name, tags, fields and timestamp for json, and
+// "path value timestamp" for graphite. msgpack output must be read back by
+// the msgpack parser.
+func Validate(dataFormat string, buf []byte) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	if dataFormat == "msgpack" {
+		p := &msgpack.MsgpackParser{}
+		metrics, err := p.Parse(buf)
+		if err != nil {
+			return err
+		}
+		if len(metrics) == 0 {
+			return fmt.Errorf("no metric in msgpack output")
+		}
+		return nil
+	}
+	if buf[len(buf)-1] != '\n' {
+		return fmt.Errorf("output does not end with a newline")
+	}
+
+	lines := bytes.Split(buf[:len(buf)-1], []byte("\n"))
+	switch dataFormat {
+	case "influx":
+		metrics, err := metric.Parse(buf)
+		if err != nil {
+			return err
+		}
+		if len(metrics) != len(lines) {
+			return fmt.Errorf("%d lines parsed as %d metrics", len(lines), len(metrics))
+		}
+	case "json":
+		for _, line := range lines {
+			var m struct {
+				Name      *string
+				Tags      map[string]string
+				Fields    map[string]interface{}
+				Timestamp *int64
+			}
+			if err := ejson.Unmarshal(line, &m); err != nil {
+				return fmt.Errorf("invalid JSON %q: %s", line, err)
+			}
+			if m.Name == nil || m.Fields == nil || m.Timestamp == nil {
+				return fmt.Errorf("incomplete JSON metric %q", line)
+			}
+		}
+	case "graphite":
+		for _, line := range lines {
+			parts := bytes.Split(line, []byte(" "))
+			if len(parts) != 3 || len(parts[0]) == 0 {
+				return fmt.Errorf("invalid graphite line %q", line)
+			}
+			if _, err := strconv.ParseFloat(string(parts[1]), 64); err != nil {
+				return fmt.Errorf("invalid graphite value in %q", line)
+			}
+			if _, err := strconv.ParseInt(string(parts[2]), 10, 64); err != nil {
+				return fmt.Errorf("invalid graphite timestamp in %q", line)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown data format %s", dataFormat)
+	}
+	return nil
+}
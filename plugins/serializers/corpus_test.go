@@ -0,0 +1,60 @@
+package serializers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// corpusConfigs are the serializers the corpus is run against, new data
+// formats must be added here.
+var corpusConfigs = []struct {
+	name   string
+	config *Config
+}{
+	{"influx", &Config{DataFormat: "influx"}},
+	{"graphite", &Config{DataFormat: "graphite"}},
+	{"graphite_template", &Config{DataFormat: "graphite", Prefix: "telegraf",
+		Template: "tags.measurement.field"}},
+	{"json", &Config{DataFormat: "json"}},
+	{"json_ms", &Config{DataFormat: "json", TimestampUnits: time.Millisecond}},
+	{"msgpack", &Config{DataFormat: "msgpack"}},
+}
+
+// TestCorpus checks that every serializer either rejects the corpus metrics
+// with an error or produces valid output.
+func TestCorpus(t *testing.T) {
+	for _, c := range corpusConfigs {
+		s, err := NewSerializer(c.config)
+		require.NoError(t, err)
+
+		for _, e := range Corpus() {
+			buf, err := s.Serialize(e.Metric)
+			if err != nil {
+				t.Logf("%s: %s: rejected: %s", c.name, e.Name, err)
+				continue
+			}
+			assert.NoError(t, Validate(c.config.DataFormat, buf),
+				"%s: %s: %q", c.name, e.Name, buf)
+		}
+	}
+}
+
+func BenchmarkSerialize(b *testing.B) {
+	corpus := Corpus()
+	for _, c := range corpusConfigs {
+		s, err := NewSerializer(c.config)
+		require.NoError(b, err)
+
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, e := range corpus {
+					s.Serialize(e.Metric)
+				}
+			}
+		})
+	}
+}
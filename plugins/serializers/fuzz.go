@@ -0,0 +1,41 @@
+// +build gofuzz
+
+package serializers
+
+import (
+	"github.com/influxdata/telegraf/metric"
+)
+
+var fuzzConfigs = []*Config{
+	{DataFormat: "influx"},
+	{DataFormat: "graphite"},
+	{DataFormat: "json"},
+	{DataFormat: "msgpack"},
+}
+
+// Fuzz is the entry point for go-fuzz. It parses data as line protocol and
+// panics if a serializer produces invalid output for one of the metrics.
+// The Corpus metrics serialized as line protocol make a good initial corpus.
+func Fuzz(data []byte) int {
+	metrics, err := metric.Parse(data)
+	if err != nil || len(metrics) == 0 {
+		return 0
+	}
+
+	for _, config := range fuzzConfigs {
+		s, err := NewSerializer(config)
+		if err != nil {
+			panic(err)
+		}
+		for _, m := range metrics {
+			buf, err := s.Serialize(m)
+			if err != nil {
+				continue
+			}
+			if err := Validate(config.DataFormat, buf); err != nil {
+				panic(config.DataFormat + ": " + err.Error() + ": " + m.String())
+			}
+		}
+	}
+	return 1
+}
@@ -3,6 +3,7 @@ package graphite
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/influxdata/telegraf"
@@ -12,7 +13,8 @@ const DEFAULT_TEMPLATE = "host.tags.measurement.field"
 
 var (
 	fieldDeleter   = strings.NewReplacer(".FIELDNAME", "", "FIELDNAME.", "")
-	sanitizedChars = strings.NewReplacer("/", "-", "@", "-", "*", "-", " ", "_", "..", ".", `\`, "", ")", "_", "(", "_")
+	sanitizedChars = strings.NewReplacer("/", "-", "@", "-", "*", "-", " ", "_", "..", ".", `\`, "", ")", "_", "(", "_",
+		"\n", "_", "\r", "_", "\t", "_")
 )
 
 type GraphiteSerializer struct {
@@ -32,20 +34,25 @@ func (s *GraphiteSerializer) Serialize(metric telegraf.Metric) ([]byte, error) {
 	}
 
 	for fieldName, value := range metric.Fields() {
+		var valueStr string
 		switch v := value.(type) {
 		case string:
 			continue
 		case bool:
+			valueStr = "0"
 			if v {
-				value = 1
-			} else {
-				value = 0
+				valueStr = "1"
 			}
+		case uint64:
+			// %#v would write it in hexadecimal
+			valueStr = strconv.FormatUint(v, 10)
+		default:
+			valueStr = fmt.Sprintf("%#v", value)
 		}
-		metricString := fmt.Sprintf("%s %#v %d\n",
+		metricString := fmt.Sprintf("%s %s %d\n",
 			// insert "field" section of template
 			sanitizedChars.Replace(InsertField(bucket, fieldName)),
-			value,
+			valueStr,
 			timestamp)
 		point := []byte(metricString)
 		out = append(out, point...)
@@ -114,6 +114,27 @@ func TestSerializeMetricHost(t *testing.T) {
 }
 
 // test that a field named "value" gets ignored.
+func TestSerializeMetricNewline(t *testing.T) {
+	now := time.Now()
+	tags := map[string]string{
+		"host": "local\nhost",
+		"cpu":  "cpu\t0",
+	}
+	fields := map[string]interface{}{
+		"usage_idle": float64(91.5),
+	}
+	m, err := metric.New("cpu", tags, fields, now)
+	assert.NoError(t, err)
+
+	s := GraphiteSerializer{}
+	buf, _ := s.Serialize(m)
+	mS := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	assert.NoError(t, err)
+
+	expS := []string{fmt.Sprintf("local_host.cpu_0.cpu.usage_idle 91.5 %d", now.Unix())}
+	assert.Equal(t, expS, mS)
+}
+
 func TestSerializeValueField(t *testing.T) {
 	now := time.Now()
 	tags := map[string]string{
@@ -215,6 +236,25 @@ func TestSerializeValueBoolean(t *testing.T) {
 	assert.Equal(t, expS, mS)
 }
 
+func TestSerializeValueUnsigned(t *testing.T) {
+	now := time.Now()
+	tags := map[string]string{
+		"host": "localhost",
+	}
+	fields := map[string]interface{}{
+		"bytes": uint64(18446744073709551615),
+	}
+	m, err := metric.New("mem", tags, fields, now)
+	assert.NoError(t, err)
+
+	s := GraphiteSerializer{}
+	buf, err := s.Serialize(m)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		fmt.Sprintf("localhost.mem.bytes 18446744073709551615 %d\n", now.Unix()),
+		string(buf))
+}
+
 // test that fields with spaces get fixed.
 func TestSerializeFieldWithSpaces(t *testing.T) {
 	now := time.Now()
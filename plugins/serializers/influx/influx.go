@@ -1,12 +1,37 @@
 package influx
 
 import (
+	"bytes"
+	"fmt"
+
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
 )
 
 type InfluxSerializer struct {
+	// UintSupport writes the unsigned integer fields as such, InfluxDB
+	// supports them since 1.4. They are written as integers capped to the
+	// maximum integer otherwise.
+	UintSupport bool
 }
 
 func (s *InfluxSerializer) Serialize(m telegraf.Metric) ([]byte, error) {
-	return m.Serialize(), nil
+	if !s.UintSupport {
+		m = metric.UintToInt(m)
+	}
+	out := m.Serialize()
+
+	// line protocol cannot escape newlines, they would split the metric
+	if i := bytes.IndexByte(out, '\n'); i >= 0 && i < len(out)-1 {
+		return nil, fmt.Errorf("%s contains a newline, line protocol does not support it",
+			m.Name())
+	}
+	// NaN and infinite fields are not valid line protocol, the line is only
+	// parsed back when it may contain one of them
+	if bytes.Contains(out, []byte("NaN")) || bytes.Contains(out, []byte("Inf")) {
+		if _, err := metric.Parse(out); err != nil {
+			return nil, fmt.Errorf("invalid line protocol for %s: %s", m.Name(), err)
+		}
+	}
+	return out, nil
 }
@@ -2,6 +2,7 @@ package influx
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"testing"
 	"time"
@@ -31,6 +32,28 @@ func TestSerializeMetricFloat(t *testing.T) {
 	assert.Equal(t, expS, mS)
 }
 
+func TestSerializeMetricUint(t *testing.T) {
+	now := time.Now()
+	fields := map[string]interface{}{
+		"small": uint64(42),
+		"large": uint64(18446744073709551615),
+	}
+	m, err := metric.New("mem", nil, fields, now)
+	assert.NoError(t, err)
+
+	s := InfluxSerializer{}
+	buf, err := s.Serialize(m)
+	assert.NoError(t, err)
+	assert.Contains(t, string(buf), "small=42i")
+	assert.Contains(t, string(buf), "large=9223372036854775807i")
+
+	s = InfluxSerializer{UintSupport: true}
+	buf, err = s.Serialize(m)
+	assert.NoError(t, err)
+	assert.Contains(t, string(buf), "small=42u")
+	assert.Contains(t, string(buf), "large=18446744073709551615u")
+}
+
 func TestSerializeMetricInt(t *testing.T) {
 	now := time.Now()
 	tags := map[string]string{
@@ -70,3 +93,20 @@ func TestSerializeMetricString(t *testing.T) {
 	expS := []string{fmt.Sprintf("cpu,cpu=cpu0 usage_idle=\"foobar\" %d", now.UnixNano())}
 	assert.Equal(t, expS, mS)
 }
+
+func TestSerializeInvalidMetrics(t *testing.T) {
+	now := time.Now()
+	s := InfluxSerializer{}
+
+	m, err := metric.New("cpu", nil,
+		map[string]interface{}{"usage_idle": math.NaN()}, now)
+	assert.NoError(t, err)
+	_, err = s.Serialize(m)
+	assert.Error(t, err)
+
+	m, err = metric.New("cpu", map[string]string{"cpu": "cpu\n0"},
+		map[string]interface{}{"usage_idle": float64(91.5)}, now)
+	assert.NoError(t, err)
+	_, err = s.Serialize(m)
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package msgpack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/influxdata/telegraf"
+)
+
+// MsgpackSerializer encodes each metric as a MessagePack map with the
+// name, tags, fields and timestamp keys, the timestamp is in nanoseconds.
+// Batches are the concatenation of the maps.
+type MsgpackSerializer struct{}
+
+func (s *MsgpackSerializer) Serialize(metric telegraf.Metric) ([]byte, error) {
+	return appendMetric(nil, metric)
+}
+
+func (s *MsgpackSerializer) SerializeBatch(metrics []telegraf.Metric) ([]byte, error) {
+	var buf []byte
+	var err error
+	for _, m := range metrics {
+		buf, err = appendMetric(buf, m)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func appendMetric(buf []byte, m telegraf.Metric) ([]byte, error) {
+	buf = appendMapHeader(buf, 4)
+	buf = appendString(buf, "name")
+	buf = appendString(buf, m.Name())
+
+	// keys are sorted so that the output is deterministic
+	tags := m.Tags()
+	buf = appendString(buf, "tags")
+	buf = appendMapHeader(buf, len(tags))
+	for _, k := range sortedKeys(tags) {
+		buf = appendString(buf, k)
+		buf = appendString(buf, tags[k])
+	}
+
+	fields := m.Fields()
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf = appendString(buf, "fields")
+	buf = appendMapHeader(buf, len(fields))
+	for _, k := range keys {
+		buf = appendString(buf, k)
+		switch v := fields[k].(type) {
+		case float64:
+			buf = appendFloat(buf, v)
+		case int64:
+			buf = appendInt(buf, v)
+		case uint64:
+			buf = appendUint(buf, v)
+		case string:
+			buf = appendString(buf, v)
+		case bool:
+			buf = appendBool(buf, v)
+		default:
+			return nil, fmt.Errorf("unsupported type %T for field %s", v, k)
+		}
+	}
+
+	buf = appendString(buf, "timestamp")
+	buf = appendInt(buf, m.UnixNano())
+	return buf, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendMapHeader(buf []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(buf, 0xde, byte(n>>8), byte(n))
+	default:
+		return append(buf, 0xdf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendString(buf []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xda, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(buf, s...)
+}
+
+// appendInt uses the smallest representation of v.
+func appendInt(buf []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendUint(buf, uint64(v))
+	case v >= -32:
+		return append(buf, byte(v))
+	case v >= math.MinInt8:
+		return append(buf, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return append(buf, 0xd1, byte(v>>8), byte(v))
+	case v >= math.MinInt32:
+		return append(buf, 0xd2, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		buf = append(buf, 0xd3, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(buf[len(buf)-8:], uint64(v))
+		return buf
+	}
+}
+
+func appendUint(buf []byte, v uint64) []byte {
+	switch {
+	case v < 128:
+		return append(buf, byte(v))
+	case v <= math.MaxUint8:
+		return append(buf, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return append(buf, 0xcd, byte(v>>8), byte(v))
+	case v <= math.MaxUint32:
+		return append(buf, 0xce, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		buf = append(buf, 0xcf, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(buf[len(buf)-8:], v)
+		return buf
+	}
+}
+
+func appendFloat(buf []byte, v float64) []byte {
+	buf = append(buf, 0xcb, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(buf[len(buf)-8:], math.Float64bits(v))
+	return buf
+}
+
+func appendBool(buf []byte, v bool) []byte {
+	if v {
+		return append(buf, 0xc3)
+	}
+	return append(buf, 0xc2)
+}
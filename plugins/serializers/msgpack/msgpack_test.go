@@ -0,0 +1,73 @@
+package msgpack
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerialize(t *testing.T) {
+	m, err := metric.New("cpu",
+		map[string]string{"cpu": "cpu0"},
+		map[string]interface{}{"usage_idle": 91.5, "count": int64(-3), "up": true},
+		time.Unix(0, 1500000000123456789))
+	require.NoError(t, err)
+
+	s := MsgpackSerializer{}
+	buf, err := s.Serialize(m)
+	require.NoError(t, err)
+
+	exp := []byte{
+		0x84,
+		0xa4, 'n', 'a', 'm', 'e', 0xa3, 'c', 'p', 'u',
+		0xa4, 't', 'a', 'g', 's', 0x81, 0xa3, 'c', 'p', 'u', 0xa4, 'c', 'p', 'u', '0',
+		0xa6, 'f', 'i', 'e', 'l', 'd', 's', 0x83,
+		0xa5, 'c', 'o', 'u', 'n', 't', 0xfd,
+		0xa2, 'u', 'p', 0xc3,
+		0xaa, 'u', 's', 'a', 'g', 'e', '_', 'i', 'd', 'l', 'e',
+		0xcb, 0x40, 0x56, 0xe0, 0, 0, 0, 0, 0,
+		0xa9, 't', 'i', 'm', 'e', 's', 't', 'a', 'm', 'p',
+		0xcf, 0x14, 0xd1, 0x12, 0x0d, 0x82, 0x71, 0xcd, 0x15,
+	}
+	assert.Equal(t, exp, buf)
+}
+
+func TestSerializeBatch(t *testing.T) {
+	m1, _ := metric.New("a", nil, map[string]interface{}{"v": int64(1)}, time.Unix(0, 0))
+	m2, _ := metric.New("b", nil, map[string]interface{}{"v": int64(2)}, time.Unix(0, 0))
+
+	s := MsgpackSerializer{}
+	b1, err := s.Serialize(m1)
+	require.NoError(t, err)
+	b2, err := s.Serialize(m2)
+	require.NoError(t, err)
+	batch, err := s.SerializeBatch([]telegraf.Metric{m1, m2})
+	require.NoError(t, err)
+	assert.Equal(t, append(b1, b2...), batch)
+}
+
+func TestAppendInt(t *testing.T) {
+	tests := []struct {
+		v   int64
+		exp []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0xcc, 0x80}},
+		{65535, []byte{0xcd, 0xff, 0xff}},
+		{65536, []byte{0xce, 0, 1, 0, 0}},
+		{-1, []byte{0xff}},
+		{-32, []byte{0xe0}},
+		{-33, []byte{0xd0, 0xdf}},
+		{-129, []byte{0xd1, 0xff, 0x7f}},
+		{math.MinInt64, []byte{0xd3, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.exp, appendInt(nil, tt.v), "%d", tt.v)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/influxdata/telegraf/plugins/serializers/graphite"
 	"github.com/influxdata/telegraf/plugins/serializers/influx"
 	"github.com/influxdata/telegraf/plugins/serializers/json"
+	"github.com/influxdata/telegraf/plugins/serializers/msgpack"
 )
 
 // SerializerOutput is an interface for output plugins that are able to
@@ -30,7 +31,7 @@ type Serializer interface {
 // Config is a struct that covers the data types needed for all serializer types,
 // and can be used to instantiate _any_ of the serializers.
 type Config struct {
-	// Dataformat can be one of: influx, graphite, or json
+	// Dataformat can be one of: influx, graphite, json or msgpack
 	DataFormat string
 
 	// Prefix to add to all measurements, only supports Graphite
@@ -42,6 +43,10 @@ type Config struct {
 
 	// Timestamp units to use for JSON formatted output
 	TimestampUnits time.Duration
+
+	// Write unsigned integers with the u suffix rather than as integers,
+	// only supports Influx
+	InfluxUintSupport bool
 }
 
 // NewSerializer a Serializer interface based on the given config.
@@ -50,11 +55,13 @@ func NewSerializer(config *Config) (Serializer, error) {
 	var serializer Serializer
 	switch config.DataFormat {
 	case "influx":
-		serializer, err = NewInfluxSerializer()
+		serializer, err = NewInfluxSerializerConfig(config.InfluxUintSupport)
 	case "graphite":
 		serializer, err = NewGraphiteSerializer(config.Prefix, config.Template)
 	case "json":
 		serializer, err = NewJsonSerializer(config.TimestampUnits)
+	case "msgpack":
+		serializer, err = NewMsgpackSerializer()
 	default:
 		err = fmt.Errorf("Invalid data format: %s", config.DataFormat)
 	}
@@ -65,10 +72,18 @@ func NewJsonSerializer(timestampUnits time.Duration) (Serializer, error) {
 	return &json.JsonSerializer{TimestampUnits: timestampUnits}, nil
 }
 
+func NewMsgpackSerializer() (Serializer, error) {
+	return &msgpack.MsgpackSerializer{}, nil
+}
+
 func NewInfluxSerializer() (Serializer, error) {
 	return &influx.InfluxSerializer{}, nil
 }
 
+func NewInfluxSerializerConfig(uintSupport bool) (Serializer, error) {
+	return &influx.InfluxSerializer{UintSupport: uintSupport}, nil
+}
+
 func NewGraphiteSerializer(prefix, template string) (Serializer, error) {
 	return &graphite.GraphiteSerializer{
 		Prefix:   prefix,
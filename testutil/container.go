@@ -0,0 +1,189 @@
+package testutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Container describes a docker container that an integration test depends
+// on. Containers are started and removed through the docker command line
+// client so that no docker API library is required to run the tests.
+type Container struct {
+	// Name of the container, it is removed before being started so that
+	// leftovers from a previous run do not collide.
+	Name string
+	// Image to run, ie "wurstmeister/kafka"
+	Image string
+	// Ports to publish in docker's "host:container" format
+	Ports []string
+	// Env is passed to the container as environment variables
+	Env map[string]string
+	// Links to other containers in docker's "name:alias" format
+	Links []string
+	// Cmd is appended after the image name
+	Cmd []string
+
+	// WaitFor is a host:port that must accept TCP connections before the
+	// container is considered started.
+	WaitFor string
+	// WaitTimeout is how long to wait for WaitFor, defaults to 60s
+	WaitTimeout time.Duration
+}
+
+// Start runs the container in the background and waits for it to listen on
+// its WaitFor address.
+func (c *Container) Start() error {
+	// ignore the error, the container most likely does not exist
+	exec.Command("docker", "rm", "-f", c.Name).Run()
+
+	args := []string{"run", "-d", "--name", c.Name}
+	for _, p := range c.Ports {
+		args = append(args, "-p", p)
+	}
+	for _, l := range c.Links {
+		args = append(args, "--link", l)
+	}
+	// sort the environment so that the command line is deterministic
+	keys := make([]string, 0, len(c.Env))
+	for k := range c.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-e", k+"="+c.Env[k])
+	}
+	args = append(args, c.Image)
+	args = append(args, c.Cmd...)
+
+	out, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("unable to start container %s: %s (%s)",
+			c.Name, err, strings.TrimSpace(string(out)))
+	}
+
+	if c.WaitFor == "" {
+		return nil
+	}
+	timeout := c.WaitTimeout
+	if timeout == 0 {
+		timeout = 60 * time.Second
+	}
+	return WaitForTCP(c.WaitFor, timeout)
+}
+
+// Terminate stops and removes the container.
+func (c *Container) Terminate() error {
+	out, err := exec.Command("docker", "rm", "-f", c.Name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("unable to remove container %s: %s (%s)",
+			c.Name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// DockerAvailable returns true if the docker client can reach a daemon.
+func DockerAvailable() bool {
+	return exec.Command("docker", "info").Run() == nil
+}
+
+// WaitForTCP polls addr until it accepts a TCP connection or timeout expires.
+func WaitForTCP(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s: %s", addr, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// DruidStub is an HTTP server standing in for the Tranquility server of a
+// Druid cluster, no docker image of Druid being small enough to start in the
+// integration tests. It stores the rows posted to /v1/post/{datasource}, as
+// a JSON array or as one JSON object per line, gzipped or not.
+type DruidStub struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	rows map[string][]map[string]interface{}
+}
+
+// NewDruidStub starts a DruidStub, it must be closed by the caller.
+func NewDruidStub() *DruidStub {
+	d := &DruidStub{rows: make(map[string][]map[string]interface{})}
+	d.Server = httptest.NewServer(http.HandlerFunc(d.ingest))
+	return d
+}
+
+// Rows returns the rows received for datasource.
+func (d *DruidStub) Rows(datasource string) []map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]map[string]interface{}(nil), d.rows[datasource]...)
+}
+
+func (d *DruidStub) ingest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || !strings.HasPrefix(r.URL.Path, "/v1/post/") {
+		http.NotFound(w, r)
+		return
+	}
+	datasource := strings.TrimPrefix(r.URL.Path, "/v1/post/")
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+	buf, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var rows []map[string]interface{}
+	if bytes.HasPrefix(bytes.TrimSpace(buf), []byte("[")) {
+		err = json.Unmarshal(buf, &rows)
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		for dec.More() {
+			var row map[string]interface{}
+			if err = dec.Decode(&row); err != nil {
+				break
+			}
+			rows = append(rows, row)
+		}
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid rows: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	d.mu.Lock()
+	d.rows[datasource] = append(d.rows[datasource], rows...)
+	d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"result":{"received":%d,"sent":%d}}`, len(rows), len(rows))
+}